@@ -0,0 +1,304 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	NPMIPtable "github.com/Azure/azure-container-networking/npm/pkg/dataplane/iptables"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/parse"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// allowlistFile is the name of the structured allowlist in the config directories, next to the regex files
+const allowlistFile = "allowlist.yaml"
+
+// Allowlist is the structured allowlist of iptables rules, matched against the fields of the parsed rules
+// rather than against the raw lines, so that it doesn't depend on how an iptables version formats them.
+type Allowlist struct {
+	Rules []AllowedRule `json:"rules"`
+}
+
+// AllowedRule allows the rules which match all of its fields. Empty fields match anything.
+// String fields are exact matches, except for '*' which matches any sequence of characters.
+// The user chains its Tables and Chain match are allowed too, if Chain is set, and their policies if Policy is set.
+type AllowedRule struct {
+	// Description is a free-form explanation of why the rules are allowed
+	Description string `json:"description,omitempty"`
+	// Tables are the tables the rules can be in
+	Tables []string `json:"tables,omitempty"`
+	Chain  string   `json:"chain,omitempty"`
+	// Policy is the policy of built-in chains. If set, only policies are allowed, not rules.
+	Policy   string `json:"policy,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+	// Target is the target the rules jump to
+	Target        string            `json:"target,omitempty"`
+	TargetOptions map[string]string `json:"targetOptions,omitempty"`
+	// Modules are match modules the rules must use, along with the values of some of their options
+	Modules []AllowedModule `json:"modules,omitempty"`
+	// Comment is the value of the comment match module
+	Comment string `json:"comment,omitempty"`
+	// Owner is the owner match module, which matches the process which created the packets
+	Owner *AllowedOwner `json:"owner,omitempty"`
+}
+
+// AllowedModule is a match module of an AllowedRule. Options are keyed by name without the leading "--",
+// and negated options are prefixed with "not-".
+type AllowedModule struct {
+	Name    string            `json:"name"`
+	Options map[string]string `json:"options,omitempty"`
+}
+
+// AllowedOwner is the owner match module of an AllowedRule
+type AllowedOwner struct {
+	UID string `json:"uid,omitempty"`
+	GID string `json:"gid,omitempty"`
+}
+
+// compiledAllowlist is an Allowlist with its patterns compiled
+type compiledAllowlist struct {
+	rules []compiledRule
+}
+
+type compiledRule struct {
+	tables        []string
+	chain         *regexp.Regexp
+	policy        *regexp.Regexp
+	protocol      *regexp.Regexp
+	target        *regexp.Regexp
+	targetOptions map[string]*regexp.Regexp
+	modules       []compiledModule
+}
+
+type compiledModule struct {
+	name    string
+	options map[string]*regexp.Regexp
+}
+
+// loadAllowlist reads the structured allowlist in path, returning nil if there is none
+func loadAllowlist(fileReader FileLineReader, path string) (*compiledAllowlist, error) {
+	lines, err := fileReader.Read(path)
+	if err != nil {
+		klog.V(2).Infof("No structured allowlist found at %s", path)
+		return nil, nil //nolint:nilerr // the allowlist is optional, like the regex files
+	}
+	allowlist := &Allowlist{}
+	if err := yaml.UnmarshalStrict([]byte(strings.Join(lines, "\n")), allowlist); err != nil {
+		return nil, fmt.Errorf("failed to decode allowlist %s: %w", path, err)
+	}
+	return allowlist.compile(), nil
+}
+
+func (a *Allowlist) compile() *compiledAllowlist {
+	compiled := &compiledAllowlist{rules: make([]compiledRule, 0, len(a.Rules))}
+	for i := range a.Rules {
+		rule := &a.Rules[i]
+		c := compiledRule{
+			tables:        rule.Tables,
+			chain:         compilePattern(rule.Chain),
+			policy:        compilePattern(rule.Policy),
+			protocol:      compilePattern(rule.Protocol),
+			target:        compilePattern(rule.Target),
+			targetOptions: compileOptions(rule.TargetOptions),
+		}
+		for _, module := range rule.Modules {
+			c.modules = append(c.modules, compiledModule{name: module.Name, options: compileOptions(module.Options)})
+		}
+		if rule.Comment != "" {
+			c.modules = append(c.modules, compiledModule{name: "comment", options: compileOptions(map[string]string{"comment": rule.Comment})})
+		}
+		if rule.Owner != nil {
+			options := map[string]string{}
+			if rule.Owner.UID != "" {
+				options["uid-owner"] = rule.Owner.UID
+			}
+			if rule.Owner.GID != "" {
+				options["gid-owner"] = rule.Owner.GID
+			}
+			c.modules = append(c.modules, compiledModule{name: "owner", options: compileOptions(options)})
+		}
+		compiled.rules = append(compiled.rules, c)
+	}
+	return compiled
+}
+
+// compilePattern compiles a pattern where '*' matches any sequence of characters, returning nil for empty patterns
+func compilePattern(pattern string) *regexp.Regexp {
+	if pattern == "" {
+		return nil
+	}
+	parts := strings.Split(pattern, "*")
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+}
+
+func compileOptions(options map[string]string) map[string]*regexp.Regexp {
+	compiled := make(map[string]*regexp.Regexp, len(options))
+	for option, value := range options {
+		compiled[option] = compilePattern(value)
+	}
+	return compiled
+}
+
+// filter returns the rules of table which aren't allowed. rules are the lines listed by iptables -S.
+func (a *compiledAllowlist) filter(table string, rules []string) []string {
+	parsed := parseRules(table, rules)
+	var remaining []string
+	for i, rule := range rules {
+		if a.allows(table, rule, parsed[i]) {
+			klog.V(3).Infof("MATCHED: '%s' -> structured allowlist", rule)
+			continue
+		}
+		remaining = append(remaining, rule)
+	}
+	return remaining
+}
+
+// allows returns whether a line of table listed by iptables -S is allowed, given its parsed rule if it is one
+func (a *compiledAllowlist) allows(table, line string, rule *NPMIPtable.Rule) bool {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return false
+	}
+	chain := fields[1]
+	for i := range a.rules {
+		c := &a.rules[i]
+		if !c.matchesChain(table, chain) {
+			continue
+		}
+		switch fields[0] {
+		case "-N":
+			if c.chain != nil {
+				return true
+			}
+		case "-P":
+			if c.policy != nil && len(fields) > 2 && c.policy.MatchString(fields[2]) {
+				return true
+			}
+		case "-A":
+			if c.policy == nil && rule != nil && c.matches(rule) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *compiledRule) matchesChain(table, chain string) bool {
+	return (len(c.tables) == 0 || slices.Contains(c.tables, table)) && matchPattern(c.chain, chain)
+}
+
+func (c *compiledRule) matches(rule *NPMIPtable.Rule) bool {
+	if !matchPattern(c.protocol, rule.Protocol) {
+		return false
+	}
+	if c.target != nil || len(c.targetOptions) > 0 {
+		if rule.Target == nil || !matchPattern(c.target, rule.Target.Name) || !matchOptions(c.targetOptions, rule.Target.OptionValueMap) {
+			return false
+		}
+	}
+	for _, module := range c.modules {
+		if !hasModule(rule.Modules, module) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasModule(modules []*NPMIPtable.Module, allowed compiledModule) bool {
+	for _, module := range modules {
+		if module.Verb == allowed.name && matchOptions(allowed.options, module.OptionValueMap) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchOptions(allowed map[string]*regexp.Regexp, options map[string][]string) bool {
+	for option, pattern := range allowed {
+		values, ok := options[option]
+		if !ok || !matchPattern(pattern, optionValue(values)) {
+			return false
+		}
+	}
+	return true
+}
+
+// optionValue joins the values of an option, which NPM's parser splits on spaces, including inside quotes
+func optionValue(values []string) string {
+	value := strings.Join(values, " ")
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = value[1 : len(value)-1]
+	}
+	return value
+}
+
+func matchPattern(pattern *regexp.Regexp, value string) bool {
+	return pattern == nil || pattern.MatchString(value)
+}
+
+// parseRules parses the rules of a table listed by iptables -S with NPM's iptables-save parser.
+// The returned slice is aligned with rules, and is nil for the lines which aren't appended rules.
+func parseRules(table string, rules []string) []*NPMIPtable.Rule {
+	parsed := make([]*NPMIPtable.Rule, len(rules))
+	var appended []int
+	for i, rule := range rules {
+		if strings.HasPrefix(rule, "-A ") {
+			appended = append(appended, i)
+		}
+	}
+	if len(appended) == 0 {
+		return parsed
+	}
+
+	lines := make([]string, len(appended))
+	for i, idx := range appended {
+		lines[i] = rules[idx]
+	}
+	parsedTable := parse.IptablesSave(table, saveOutput(table, lines))
+
+	// the parser groups the rules by chain, in order
+	next := map[string]int{}
+	for _, idx := range appended {
+		chain := ruleChain(rules[idx])
+		parsed[idx] = nthRule(parsedTable, rules[idx], next[chain])
+		next[chain]++
+	}
+	return parsed
+}
+
+func ruleChain(rule string) string {
+	fields := strings.Fields(rule)
+	if len(fields) < 2 {
+		return ""
+	}
+	return fields[1]
+}
+
+func nthRule(table *NPMIPtable.Table, rule string, n int) *NPMIPtable.Rule {
+	chain, ok := table.Chains[ruleChain(rule)]
+	if !ok || n >= len(chain.Rules) {
+		return nil
+	}
+	return chain.Rules[n]
+}
+
+// saveOutput formats rule lines as the iptables-save output of table, which is what the parser reads
+func saveOutput(table string, lines []string) []byte {
+	// the parser drops the rules of chains which aren't declared
+	var save strings.Builder
+	save.WriteString("*" + table + "\n")
+	declared := map[string]bool{}
+	for _, line := range lines {
+		if chain := ruleChain(line); !declared[chain] {
+			save.WriteString(":" + chain + " - [0:0]\n")
+			declared[chain] = true
+		}
+	}
+	save.WriteString(strings.Join(lines, "\n") + "\nCOMMIT\n")
+	return []byte(save.String())
+}
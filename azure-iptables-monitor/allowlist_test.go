@@ -0,0 +1,225 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testAllowlist = `
+rules:
+- description: kube-proxy services
+  tables: [nat]
+  chain: KUBE-*
+- description: dns from kube-proxy
+  chain: KUBE-SERVICES
+  protocol: tcp
+  comment: kube-system/kube-dns:*
+  modules:
+  - name: tcp
+    options:
+      dport: "53"
+  target: KUBE-SVC-*
+- description: root traffic
+  owner:
+    uid: "0"
+  target: ACCEPT
+- description: everything but ssh
+  chain: OUTPUT
+  modules:
+  - name: tcp
+    options:
+      not-dport: "22"
+  target: DROP
+- description: masquerade to the node
+  chain: POSTROUTING
+  target: SNAT
+  targetOptions:
+    to-source: 10.0.0.*
+- description: default policies
+  chain: INPUT
+  policy: ACCEPT
+`
+
+func loadTestAllowlist(t *testing.T) *compiledAllowlist {
+	t.Helper()
+	fileReader := NewMockFileLineReader()
+	fileReader.files["/etc/config/allowlist.yaml"] = strings.Split(testAllowlist, "\n")
+	allowlist, err := loadAllowlist(fileReader, "/etc/config/allowlist.yaml")
+	require.NoError(t, err)
+	require.NotNil(t, allowlist)
+	return allowlist
+}
+
+func TestLoadAllowlist(t *testing.T) {
+	fileReader := NewMockFileLineReader()
+
+	allowlist, err := loadAllowlist(fileReader, "/etc/config/allowlist.yaml")
+	require.NoError(t, err)
+	require.Nil(t, allowlist, "missing allowlist is optional")
+
+	fileReader.files["/etc/config/allowlist.yaml"] = []string{"rules:", "- chian: INPUT"}
+	_, err = loadAllowlist(fileReader, "/etc/config/allowlist.yaml")
+	require.Error(t, err, "unknown fields are rejected")
+
+	require.Len(t, loadTestAllowlist(t).rules, 6)
+}
+
+func TestParseRules(t *testing.T) {
+	rules := []string{
+		"-N KUBE-SERVICES",
+		`-A KUBE-SERVICES -d 10.0.0.10/32 -p tcp -m comment --comment "kube-system/kube-dns:dns-tcp cluster IP" -m tcp --dport 53 -j KUBE-SVC-ERIFXISQEP7F7OF4`,
+		"-A FOO",
+		"-A KUBE-SERVICES -j RETURN",
+	}
+
+	parsed := parseRules("nat", rules)
+
+	require.Len(t, parsed, 4)
+	require.Nil(t, parsed[0], "chain declarations are not rules")
+	require.NotNil(t, parsed[1])
+	require.Equal(t, "tcp", parsed[1].Protocol)
+	require.Equal(t, "KUBE-SVC-ERIFXISQEP7F7OF4", parsed[1].Target.Name)
+	require.NotNil(t, parsed[2], "rules without matches or target are parsed too")
+	require.Nil(t, parsed[2].Target)
+	require.NotNil(t, parsed[3])
+	require.Equal(t, "RETURN", parsed[3].Target.Name)
+}
+
+func TestAllowlistFilter(t *testing.T) {
+	allowlist := loadTestAllowlist(t)
+
+	testCases := []struct {
+		name     string
+		table    string
+		rule     string
+		expected bool // true if the rule is allowed
+	}{
+		{
+			name:     "any rule in chain of table",
+			table:    "nat",
+			rule:     "-A KUBE-MARK-MASQ -j MARK --set-xmark 0x4000/0x4000",
+			expected: true,
+		},
+		{
+			name:     "user chain in chain of table",
+			table:    "nat",
+			rule:     "-N KUBE-MARK-MASQ",
+			expected: true,
+		},
+		{
+			name:     "chain in other table",
+			table:    "mangle",
+			rule:     "-A KUBE-MARK-MASQ -j MARK --set-xmark 0x4000/0x4000",
+			expected: false,
+		},
+		{
+			name:     "comment with spaces, module option and target",
+			table:    "filter",
+			rule:     `-A KUBE-SERVICES -d 10.0.0.10/32 -p tcp -m comment --comment "kube-system/kube-dns:dns-tcp cluster IP" -m tcp --dport 53 -j KUBE-SVC-ERIFXISQEP7F7OF4`,
+			expected: true,
+		},
+		{
+			name:     "formatting of other iptables versions",
+			table:    "filter",
+			rule:     `-A KUBE-SERVICES -p tcp -d 10.0.0.10/32 -m tcp --dport 53 -m comment --comment "kube-system/kube-dns:dns-tcp cluster IP" -j KUBE-SVC-ERIFXISQEP7F7OF4`,
+			expected: true,
+		},
+		{
+			name:     "wrong module option",
+			table:    "filter",
+			rule:     `-A KUBE-SERVICES -d 10.0.0.10/32 -p tcp -m comment --comment "kube-system/kube-dns:dns-tcp cluster IP" -m tcp --dport 54 -j KUBE-SVC-ERIFXISQEP7F7OF4`,
+			expected: false,
+		},
+		{
+			name:     "owner",
+			table:    "filter",
+			rule:     "-A OUTPUT -m owner --uid-owner 0 -j ACCEPT",
+			expected: true,
+		},
+		{
+			name:     "other owner",
+			table:    "filter",
+			rule:     "-A OUTPUT -m owner --uid-owner 1000 -j ACCEPT",
+			expected: false,
+		},
+		{
+			name:     "negated module option",
+			table:    "filter",
+			rule:     "-A OUTPUT -p tcp -m tcp ! --dport 22 -j DROP",
+			expected: true,
+		},
+		{
+			name:     "not negated module option",
+			table:    "filter",
+			rule:     "-A OUTPUT -p tcp -m tcp --dport 22 -j DROP",
+			expected: false,
+		},
+		{
+			name:     "target option",
+			table:    "nat",
+			rule:     "-A POSTROUTING -j SNAT --to-source 10.0.0.4",
+			expected: true,
+		},
+		{
+			name:     "wrong target option",
+			table:    "nat",
+			rule:     "-A POSTROUTING -j SNAT --to-source 10.1.0.4",
+			expected: false,
+		},
+		{
+			name:     "policy",
+			table:    "filter",
+			rule:     "-P INPUT ACCEPT",
+			expected: true,
+		},
+		{
+			name:     "other policy",
+			table:    "filter",
+			rule:     "-P INPUT DROP",
+			expected: false,
+		},
+		{
+			name:     "user chain without allowed chain",
+			table:    "filter",
+			rule:     "-N USER",
+			expected: false,
+		},
+		{
+			name:     "unparsable rule",
+			table:    "filter",
+			rule:     "-A USER",
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			remaining := allowlist.filter(tc.table, []string{tc.rule})
+			require.Equal(t, tc.expected, len(remaining) == 0)
+		})
+	}
+}
+
+func TestNodeHasUserIPTablesRulesWithAllowlist(t *testing.T) {
+	fileReader := NewMockFileLineReader()
+	fileReader.files["/etc/config/allowlist.yaml"] = strings.Split(testAllowlist, "\n")
+
+	iptablesClient := NewMockIPTablesClient()
+	iptablesClient.rules = map[string]map[string][]string{
+		"filter": {
+			"OUTPUT": []string{"-A OUTPUT -m owner --uid-owner 0 -j ACCEPT"},
+		},
+		"nat": {
+			"KUBE-SERVICES": []string{"-A KUBE-SERVICES -j KUBE-NODEPORTS"},
+		},
+	}
+	require.False(t, nodeHasUserIPTablesRules(fileReader, "/etc/config/", iptablesClient))
+
+	// legacy regex files still apply along with the structured allowlist
+	iptablesClient.rules["filter"]["INPUT"] = []string{"-A INPUT -j LOG"}
+	require.True(t, nodeHasUserIPTablesRules(fileReader, "/etc/config/", iptablesClient))
+	fileReader.files["/etc/config/filter"] = []string{"^-A INPUT -j LOG$"}
+	require.False(t, nodeHasUserIPTablesRules(fileReader, "/etc/config/", iptablesClient))
+}
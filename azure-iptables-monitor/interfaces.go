@@ -21,12 +21,22 @@ type FileLineReader interface {
 type IPTablesClient interface {
 	ListChains(table string) ([]string, error)
 	List(table, chain string) ([]string, error)
+	// the operations below are only used to remove and restore rules in remediation mode
+	Exists(table, chain string, rulespec ...string) (bool, error)
+	Insert(table, chain string, pos int, rulespec ...string) error
+	Delete(table, chain string, rulespec ...string) error
+	ChainExists(table, chain string) (bool, error)
+	NewChain(table, chain string) error
+	DeleteChain(table, chain string) error
 }
 
 // KubeClient interface with direct methods for testing
 type KubeClient interface {
 	GetNode(ctx context.Context, name string) (*corev1.Node, error)
 	CreateEvent(ctx context.Context, namespace string, event *corev1.Event) (*corev1.Event, error)
+	GetConfigMap(ctx context.Context, namespace, name string) (*corev1.ConfigMap, error)
+	CreateConfigMap(ctx context.Context, namespace string, configMap *corev1.ConfigMap) (*corev1.ConfigMap, error)
+	UpdateConfigMap(ctx context.Context, namespace string, configMap *corev1.ConfigMap) (*corev1.ConfigMap, error)
 }
 
 // DynamicClient interface with direct method for testing
@@ -53,6 +63,8 @@ type Dependencies struct {
 	EBPFClient    EBPFClient
 	FileReader    FileLineReader
 	RouteManager  RouteManager
+	// Remediator removes unexpected rules when remediation is enabled, nil otherwise
+	Remediator *Remediator
 }
 
 // Config struct holds runtime configuration
@@ -67,6 +79,10 @@ type Config struct {
 	NodeName                         string
 	TerminateOnSuccess               bool
 	InstallRoutesForHealthProbeReply bool
+	Remediate                        bool
+	RemediationGracePeriod           int
+	SnapshotPath                     string
+	SnapshotNamespace                string
 }
 
 // Implementation types that wrap real k8s clients
@@ -88,6 +104,18 @@ func (k *realKubeClient) CreateEvent(ctx context.Context, namespace string, even
 	return k.client.CoreV1().Events(namespace).Create(ctx, event, metav1.CreateOptions{}) // nolint
 }
 
+func (k *realKubeClient) GetConfigMap(ctx context.Context, namespace, name string) (*corev1.ConfigMap, error) {
+	return k.client.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{}) // nolint
+}
+
+func (k *realKubeClient) CreateConfigMap(ctx context.Context, namespace string, configMap *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	return k.client.CoreV1().ConfigMaps(namespace).Create(ctx, configMap, metav1.CreateOptions{}) // nolint
+}
+
+func (k *realKubeClient) UpdateConfigMap(ctx context.Context, namespace string, configMap *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	return k.client.CoreV1().ConfigMaps(namespace).Update(ctx, configMap, metav1.UpdateOptions{}) // nolint
+}
+
 // realDynamicClient wraps dynamic.Interface
 type realDynamicClient struct {
 	client dynamic.Interface
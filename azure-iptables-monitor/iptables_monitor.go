@@ -39,6 +39,11 @@ var (
 	pinPath                          = flag.String("mapPath", "/azure-block-iptables-bpf-map/iptables_block_event_counter", "Path to pinned bpf map")
 	terminateOnSuccess               = flag.Bool("terminateOnSuccess", false, "Whether to terminate the program when no user iptables rules found")
 	installRoutesForHealthProbeReply = flag.Bool("installRoutesForHealthProbeReply", false, "Whether to install loopback routes for replies sent to kubelet health probes")
+	remediate                        = flag.Bool("remediate", false, "Whether to remove unexpected iptables rules once present for the grace period, saving them to a snapshot first")
+	remediationGracePeriod           = flag.Int("remediationGracePeriod", 600, "How long unexpected iptables rules must be present before being removed in remediation mode (in seconds)")
+	snapshotPath                     = flag.String("snapshotPath", "", "Path of the local file to save removed iptables rules to. If empty, they are saved to a ConfigMap")
+	snapshotNamespace                = flag.String("snapshotNamespace", "kube-system", "Namespace of the ConfigMap to save removed iptables rules to")
+	restore                          = flag.Bool("restore", false, "Whether to restore the iptables rules saved to the snapshot and exit")
 )
 
 const (
@@ -215,7 +220,12 @@ func GetRules(client IPTablesClient, tableName string) ([]string, error) {
 // hasUnexpectedRules checks if any rules in currentRules don't match any of the allowedPatterns
 // Returns true if there are unexpected rules, false if all rules match expected patterns
 func hasUnexpectedRules(currentRules, allowedPatterns []string) bool {
-	foundUnexpectedRules := false
+	return len(unexpectedRules(currentRules, allowedPatterns)) > 0
+}
+
+// unexpectedRules returns the rules in currentRules which don't match any of the allowedPatterns
+func unexpectedRules(currentRules, allowedPatterns []string) []string {
+	var unexpected []string
 
 	// compile regex patterns
 	compiledPatterns := make([]*regexp.Regexp, 0, len(allowedPatterns))
@@ -240,18 +250,24 @@ func hasUnexpectedRules(currentRules, allowedPatterns []string) bool {
 		}
 		if !ruleMatched {
 			klog.Infof("Unexpected rule: %s", rule)
-			foundUnexpectedRules = true
 			// continue to iterate over remaining rules to identify all unexpected rules
+			unexpected = append(unexpected, rule)
 		}
 	}
 
-	return foundUnexpectedRules
+	return unexpected
 }
 
 // nodeHasUserIPTablesRules returns true if the node has iptables rules that do not match the regex
 // specified in the rule's respective table: nat, mangle, filter, raw, or security
 // The global file's regexes can match to a rule in any table
 func nodeHasUserIPTablesRules(fileReader FileLineReader, path string, iptablesClient IPTablesClient) bool {
+	return len(findUserIPTablesRules(fileReader, path, iptablesClient, familyIPv4)) > 0
+}
+
+// findUserIPTablesRules returns the iptables rules of the node that do not match the regex
+// specified in the rule's respective table, as in nodeHasUserIPTablesRules, nor the structured allowlist
+func findUserIPTablesRules(fileReader FileLineReader, path string, iptablesClient IPTablesClient, family string) []UnexpectedRule {
 	tables := []string{"nat", "mangle", "filter", "raw", "security"}
 
 	globalPatterns, err := fileReader.Read(filepath.Join(path, "global"))
@@ -260,7 +276,12 @@ func nodeHasUserIPTablesRules(fileReader FileLineReader, path string, iptablesCl
 		klog.V(2).Infof("No global patterns file found, using empty patterns")
 	}
 
-	userIPTablesRules := false
+	allowlist, err := loadAllowlist(fileReader, filepath.Join(path, allowlistFile))
+	if err != nil {
+		klog.Errorf("Ignoring structured allowlist: %v", err)
+	}
+
+	var userIPTablesRules []UnexpectedRule
 
 	klog.V(2).Infof("Using reference patterns files in %s", path)
 
@@ -281,9 +302,15 @@ func nodeHasUserIPTablesRules(fileReader FileLineReader, path string, iptablesCl
 		referencePatterns = append(referencePatterns, globalPatterns...)
 
 		klog.V(3).Infof("===== %s =====", table)
-		if hasUnexpectedRules(rules, referencePatterns) {
+		if allowlist != nil {
+			rules = allowlist.filter(table, rules)
+		}
+		unexpected := unexpectedRules(rules, referencePatterns)
+		if len(unexpected) > 0 {
 			klog.Infof("Unexpected rules detected in table %s", table)
-			userIPTablesRules = true
+		}
+		for _, rule := range unexpected {
+			userIPTablesRules = append(userIPTablesRules, UnexpectedRule{Family: family, Table: table, Rule: rule})
 		}
 	}
 
@@ -291,20 +318,34 @@ func nodeHasUserIPTablesRules(fileReader FileLineReader, path string, iptablesCl
 }
 
 // Check returns true if the node has user iptables rules (ipv4 or ipv6, based on the config), false otherwise
+// In remediation mode, the user iptables rules which are removed no longer count as found.
 func Check(cfg Config, deps Dependencies, previousBlocks *uint64) bool {
-	userIPTablesRulesFound := nodeHasUserIPTablesRules(deps.FileReader, cfg.ConfigPath4, deps.IPTablesV4)
-	if userIPTablesRulesFound {
+	userIPTablesRules := findUserIPTablesRules(deps.FileReader, cfg.ConfigPath4, deps.IPTablesV4, familyIPv4)
+	if len(userIPTablesRules) > 0 {
 		klog.Info("Above user iptables rules detected in IPv4 iptables")
 	}
 
 	// check ip6tables rules if enabled
 	if cfg.IPv6Enabled {
-		userIP6TablesRulesFound := nodeHasUserIPTablesRules(deps.FileReader, cfg.ConfigPath6, deps.IPTablesV6)
-		if userIP6TablesRulesFound {
+		userIP6TablesRules := findUserIPTablesRules(deps.FileReader, cfg.ConfigPath6, deps.IPTablesV6, familyIPv6)
+		if len(userIP6TablesRules) > 0 {
 			klog.Info("Above user iptables rules detected in IPv6 iptables")
 		}
-		userIPTablesRulesFound = userIPTablesRulesFound || userIP6TablesRulesFound
+		userIPTablesRules = append(userIPTablesRules, userIP6TablesRules...)
+	}
+
+	if deps.Remediator != nil {
+		remaining := deps.Remediator.Remediate(deps, userIPTablesRules)
+		if removed := len(userIPTablesRules) - len(remaining); removed > 0 && cfg.SendEvents {
+			msg := fmt.Sprintf("Removed %d unexpected iptables rules present for longer than the grace period. "+
+				"The removed rules are saved to a snapshot and can be restored with -restore", removed)
+			if err := createNodeEvent(deps.KubeClient, cfg.NodeName, "RemovedIPTablesRules", msg, corev1.EventTypeWarning); err != nil {
+				klog.Errorf("failed to create remediation event: %v", err)
+			}
+		}
+		userIPTablesRules = remaining
 	}
+	userIPTablesRulesFound := len(userIPTablesRules) > 0
 
 	// update label based on whether user iptables rules were found
 	err := patchLabel(deps.DynamicClient, userIPTablesRulesFound, cfg.NodeName)
@@ -365,6 +406,15 @@ func installHealthProbeReplyRoutes(deps Dependencies, ipv6Enabled bool) {
 	}
 }
 
+// newSnapshotStore returns the store for the snapshot of removed rules, which is the local file at
+// SnapshotPath if set, or else a ConfigMap in SnapshotNamespace
+func newSnapshotStore(cfg Config, kubeClient KubeClient) SnapshotStore {
+	if cfg.SnapshotPath != "" {
+		return NewFileSnapshotStore(cfg.SnapshotPath)
+	}
+	return NewConfigMapSnapshotStore(kubeClient, cfg.SnapshotNamespace, cfg.NodeName)
+}
+
 // Run runs Check in a loop and handles the number of blocks
 func Run(cfg Config, deps Dependencies) {
 	if cfg.InstallRoutesForHealthProbeReply {
@@ -410,6 +460,10 @@ func main() {
 		PinPath:                          *pinPath,
 		TerminateOnSuccess:               *terminateOnSuccess,
 		InstallRoutesForHealthProbeReply: *installRoutesForHealthProbeReply,
+		Remediate:                        *remediate,
+		RemediationGracePeriod:           *remediationGracePeriod,
+		SnapshotPath:                     *snapshotPath,
+		SnapshotNamespace:                *snapshotNamespace,
 		NodeName:                         currentNodeName,
 	}
 
@@ -450,6 +504,21 @@ func main() {
 		FileReader:    OSFileLineReader{},
 	}
 
+	snapshotStore := newSnapshotStore(cfg, deps.KubeClient)
+	if *restore {
+		restored, err := Restore(deps, snapshotStore)
+		if err != nil {
+			klog.Fatalf("failed to restore iptables rules (restored %d): %v", restored, err)
+		}
+		klog.Infof("Restored %d iptables rules", restored)
+		return
+	}
+
+	if cfg.Remediate {
+		deps.Remediator = NewRemediator(cfg.NodeName, time.Duration(cfg.RemediationGracePeriod)*time.Second, snapshotStore)
+		klog.Infof("Remediation enabled with a grace period of %ds", cfg.RemediationGracePeriod)
+	}
+
 	if *installRoutesForHealthProbeReply {
 		deps.RouteManager = NewRouteManager()
 		klog.Info("Route installation for health probe reply enabled")
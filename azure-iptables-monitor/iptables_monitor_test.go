@@ -6,10 +6,13 @@ import (
 	"fmt"
 	"net/netip"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
@@ -76,11 +79,57 @@ func (m *MockIPTablesClient) List(table, chain string) ([]string, error) {
 	return rules, nil
 }
 
+func mockRule(chain string, rulespec []string) string {
+	return strings.Join(append([]string{"-A", chain}, rulespec...), " ")
+}
+
+// Exists returns whether the rule is in the given table and chain
+func (m *MockIPTablesClient) Exists(table, chain string, rulespec ...string) (bool, error) {
+	return slices.Contains(m.rules[table][chain], mockRule(chain, rulespec)), nil
+}
+
+// Insert inserts the rule at the 1-based position pos of the given table and chain
+func (m *MockIPTablesClient) Insert(table, chain string, pos int, rulespec ...string) error {
+	m.rules[table][chain] = slices.Insert(m.rules[table][chain], pos-1, mockRule(chain, rulespec))
+	return nil
+}
+
+// Delete deletes the rule from the given table and chain
+func (m *MockIPTablesClient) Delete(table, chain string, rulespec ...string) error {
+	rule := mockRule(chain, rulespec)
+	m.rules[table][chain] = slices.DeleteFunc(m.rules[table][chain], func(r string) bool { return r == rule })
+	return nil
+}
+
+// ChainExists returns whether the chain is in the given table
+func (m *MockIPTablesClient) ChainExists(table, chain string) (bool, error) {
+	_, exists := m.rules[table][chain]
+	return exists, nil
+}
+
+// NewChain creates an empty chain in the given table
+func (m *MockIPTablesClient) NewChain(table, chain string) error {
+	if m.rules[table] == nil {
+		m.rules[table] = make(map[string][]string)
+	}
+	m.rules[table][chain] = []string{}
+	return nil
+}
+
+// DeleteChain deletes the chain from the given table
+func (m *MockIPTablesClient) DeleteChain(table, chain string) error {
+	delete(m.rules[table], chain)
+	return nil
+}
+
 // MockKubeClient for event handling
 type MockKubeClient struct {
-	Node  *corev1.Node
-	Event *corev1.Event
-	Error error
+	Node       *corev1.Node
+	Event      *corev1.Event
+	ConfigMaps map[string]*corev1.ConfigMap
+	Error      error
+
+	EventCalls int
 }
 
 func NewMockKubeClient() *MockKubeClient {
@@ -92,9 +141,40 @@ func (m *MockKubeClient) GetNode(_ context.Context, _ string) (*corev1.Node, err
 }
 
 func (m *MockKubeClient) CreateEvent(_ context.Context, _ string, _ *corev1.Event) (*corev1.Event, error) {
+	m.EventCalls++
 	return m.Event, m.Error
 }
 
+func (m *MockKubeClient) GetConfigMap(_ context.Context, namespace, name string) (*corev1.ConfigMap, error) {
+	if m.Error != nil {
+		return nil, m.Error
+	}
+	configMap, exists := m.ConfigMaps[namespace+"/"+name]
+	if !exists {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, name)
+	}
+	return configMap.DeepCopy(), nil
+}
+
+func (m *MockKubeClient) CreateConfigMap(_ context.Context, namespace string, configMap *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	if m.Error != nil {
+		return nil, m.Error
+	}
+	if m.ConfigMaps == nil {
+		m.ConfigMaps = make(map[string]*corev1.ConfigMap)
+	}
+	m.ConfigMaps[namespace+"/"+configMap.Name] = configMap.DeepCopy()
+	return configMap, nil
+}
+
+func (m *MockKubeClient) UpdateConfigMap(_ context.Context, namespace string, configMap *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	if m.Error != nil {
+		return nil, m.Error
+	}
+	m.ConfigMaps[namespace+"/"+configMap.Name] = configMap.DeepCopy()
+	return configMap, nil
+}
+
 // MockDynamicClient for patching
 type MockDynamicClient struct {
 	Error error
@@ -0,0 +1,477 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	familyIPv4 = "ipv4"
+	familyIPv6 = "ipv6"
+
+	snapshotConfigMapPrefix = "azure-iptables-monitor-snapshot-"
+	snapshotKey             = "snapshot.json"
+
+	// maxSnapshotRules is how many removed rules the snapshot keeps, so that it stays well below the 1MiB limit of
+	// ConfigMaps. The rules removed earliest are dropped first.
+	maxSnapshotRules = 1000
+)
+
+var (
+	ErrUnbalancedQuotes   = errors.New("unbalanced quotes")
+	ErrRuleNotRemovable   = errors.New("only appended rules and user chains can be removed")
+	ErrRuleNotFound       = errors.New("rule not found in chain")
+	ErrNoIPTablesClient   = errors.New("no iptables client for family")
+	ErrRestoreIncomplete  = errors.New("some rules could not be restored")
+	ErrSnapshotWithoutKey = errors.New("snapshot configmap has no " + snapshotKey)
+)
+
+// UnexpectedRule is a rule which doesn't match any of the allowed patterns of its table
+type UnexpectedRule struct {
+	Family string
+	Table  string
+	Rule   string
+}
+
+func (u UnexpectedRule) key() string {
+	return u.Family + "/" + u.Table + "/" + u.Rule
+}
+
+// SnapshotRule is a rule removed by remediation, along with where it was so that it can be restored
+type SnapshotRule struct {
+	Family string `json:"family"`
+	Table  string `json:"table"`
+	Chain  string `json:"chain"`
+	// Position is the 1-based position of the rule in its chain, or 0 if the rule creates the chain
+	Position  int       `json:"position"`
+	Rule      string    `json:"rule"`
+	RemovedAt time.Time `json:"removedAt"`
+}
+
+// Snapshot holds the rules removed from a node by remediation, for later review or restoring
+type Snapshot struct {
+	Node  string         `json:"node"`
+	Rules []SnapshotRule `json:"rules"`
+	// Dropped is how many removed rules were dropped from the snapshot to keep it under maxSnapshotRules,
+	// which a restore can't put back
+	Dropped int `json:"dropped,omitempty"`
+}
+
+// SnapshotStore persists the snapshot of removed rules
+type SnapshotStore interface {
+	// Load returns the saved snapshot, or an empty snapshot if none was saved yet
+	Load() (*Snapshot, error)
+	Save(snapshot *Snapshot) error
+}
+
+// fileSnapshotStore saves the snapshot to a local file
+type fileSnapshotStore struct {
+	path string
+}
+
+func NewFileSnapshotStore(path string) SnapshotStore {
+	return &fileSnapshotStore{path: path}
+}
+
+func (f *fileSnapshotStore) Load() (*Snapshot, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Snapshot{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot %s: %w", f.path, err)
+	}
+	snapshot := &Snapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot %s: %w", f.path, err)
+	}
+	return snapshot, nil
+}
+
+// Save writes the snapshot to a temporary file which is then renamed, so a crash never leaves a partial snapshot
+func (f *fileSnapshotStore) Save(snapshot *Snapshot) error {
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write snapshot %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, f.path); err != nil {
+		return fmt.Errorf("failed to rename snapshot %s to %s: %w", tmp, f.path, err)
+	}
+	return nil
+}
+
+// configMapSnapshotStore saves the snapshot to a ConfigMap
+type configMapSnapshotStore struct {
+	client    KubeClient
+	namespace string
+	name      string
+}
+
+// NewConfigMapSnapshotStore saves the snapshot of the node to a ConfigMap in namespace named after the node
+func NewConfigMapSnapshotStore(client KubeClient, namespace, nodeName string) SnapshotStore {
+	return &configMapSnapshotStore{client: client, namespace: namespace, name: snapshotConfigMapPrefix + nodeName}
+}
+
+func (c *configMapSnapshotStore) Load() (*Snapshot, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	configMap, err := c.client.GetConfigMap(ctx, c.namespace, c.name)
+	if apierrors.IsNotFound(err) {
+		return &Snapshot{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get snapshot configmap %s/%s: %w", c.namespace, c.name, err)
+	}
+	data, ok := configMap.Data[snapshotKey]
+	if !ok {
+		return nil, fmt.Errorf("configmap %s/%s: %w", c.namespace, c.name, ErrSnapshotWithoutKey)
+	}
+	snapshot := &Snapshot{}
+	if err := json.Unmarshal([]byte(data), snapshot); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot configmap %s/%s: %w", c.namespace, c.name, err)
+	}
+	return snapshot, nil
+}
+
+func (c *configMapSnapshotStore) Save(snapshot *Snapshot) error {
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	configMap, err := c.client.GetConfigMap(ctx, c.namespace, c.name)
+	if apierrors.IsNotFound(err) {
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: c.name, Namespace: c.namespace},
+			Data:       map[string]string{snapshotKey: string(data)},
+		}
+		if _, err := c.client.CreateConfigMap(ctx, c.namespace, configMap); err != nil {
+			return fmt.Errorf("failed to create snapshot configmap %s/%s: %w", c.namespace, c.name, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get snapshot configmap %s/%s: %w", c.namespace, c.name, err)
+	}
+	if configMap.Data == nil {
+		configMap.Data = map[string]string{}
+	}
+	configMap.Data[snapshotKey] = string(data)
+	if _, err := c.client.UpdateConfigMap(ctx, c.namespace, configMap); err != nil {
+		return fmt.Errorf("failed to update snapshot configmap %s/%s: %w", c.namespace, c.name, err)
+	}
+	return nil
+}
+
+// Remediator removes unexpected rules once they have been present for a grace period,
+// after saving them to a snapshot from which they can be restored
+type Remediator struct {
+	nodeName    string
+	gracePeriod time.Duration
+	store       SnapshotStore
+	now         func() time.Time
+	// firstSeen is when each currently unexpected rule was first found
+	firstSeen map[string]time.Time
+}
+
+func NewRemediator(nodeName string, gracePeriod time.Duration, store SnapshotStore) *Remediator {
+	return &Remediator{
+		nodeName:    nodeName,
+		gracePeriod: gracePeriod,
+		store:       store,
+		now:         time.Now,
+		firstSeen:   make(map[string]time.Time),
+	}
+}
+
+// Remediate removes the rules in found which have been unexpected for at least the grace period, and returns the
+// rules which are still on the node. Rules are only removed once they are saved to the snapshot.
+func (r *Remediator) Remediate(deps Dependencies, found []UnexpectedRule) []UnexpectedRule {
+	now := r.now()
+	firstSeen := make(map[string]time.Time, len(found))
+	var due, remaining []UnexpectedRule
+	for _, rule := range found {
+		first, ok := r.firstSeen[rule.key()]
+		if !ok {
+			first = now
+		}
+		firstSeen[rule.key()] = first
+		if now.Sub(first) >= r.gracePeriod {
+			due = append(due, rule)
+		} else {
+			remaining = append(remaining, rule)
+		}
+	}
+	// forget the rules which are gone, so that they get a new grace period if they come back
+	r.firstSeen = firstSeen
+	if len(due) == 0 {
+		return remaining
+	}
+
+	removals := make([]SnapshotRule, 0, len(due))
+	for _, rule := range due {
+		removal, err := locateRule(deps, rule, now)
+		if err != nil {
+			klog.Errorf("Not removing unexpected %s rule in table %s: %s: %v", rule.Family, rule.Table, rule.Rule, err)
+			remaining = append(remaining, rule)
+			continue
+		}
+		removals = append(removals, removal)
+	}
+	if len(removals) == 0 {
+		return remaining
+	}
+
+	if err := r.appendToSnapshot(removals); err != nil {
+		klog.Errorf("Not removing unexpected rules since they could not be saved: %v", err)
+		return found
+	}
+
+	// chains can only be deleted once their rules, and the rules jumping to them, are removed
+	sort.SliceStable(removals, func(i, j int) bool {
+		return removals[i].Position != 0 && removals[j].Position == 0
+	})
+	for _, removal := range removals {
+		rule := UnexpectedRule{Family: removal.Family, Table: removal.Table, Rule: removal.Rule}
+		if err := removeRule(deps, removal); err != nil {
+			klog.Errorf("Failed to remove unexpected %s rule in table %s: %s: %v", removal.Family, removal.Table, removal.Rule, err)
+			remaining = append(remaining, rule)
+			continue
+		}
+		klog.Infof("Removed unexpected %s rule in table %s: %s", removal.Family, removal.Table, removal.Rule)
+		delete(r.firstSeen, rule.key())
+	}
+	return remaining
+}
+
+func (r *Remediator) appendToSnapshot(removals []SnapshotRule) error {
+	snapshot, err := r.store.Load()
+	if err != nil {
+		return err
+	}
+	snapshot.Node = r.nodeName
+	snapshot.Rules = append(snapshot.Rules, removals...)
+	if dropped := len(snapshot.Rules) - maxSnapshotRules; dropped > 0 {
+		// restoring reorders the rules which failed to be restored, so they are sorted by removal time first
+		sort.SliceStable(snapshot.Rules, func(i, j int) bool {
+			return snapshot.Rules[i].RemovedAt.Before(snapshot.Rules[j].RemovedAt)
+		})
+		snapshot.Rules = snapshot.Rules[dropped:]
+		snapshot.Dropped += dropped
+		klog.Warningf("Dropped the %d earliest removed rules from the snapshot, which keeps at most %d rules. "+
+			"%d removed rules were dropped in total and won't be restored", dropped, maxSnapshotRules, snapshot.Dropped)
+	}
+	return r.store.Save(snapshot)
+}
+
+// Restore puts the rules in the snapshot back in place and removes them from the snapshot.
+// Rules which are already present are skipped, and rules which fail to be restored are kept in the snapshot.
+// It returns the number of rules restored, and ErrRestoreIncomplete if rules failed or were dropped from the snapshot.
+func Restore(deps Dependencies, store SnapshotStore) (int, error) {
+	snapshot, err := store.Load()
+	if err != nil {
+		return 0, err
+	}
+
+	// positions were recorded before the rules removed at the same time, but after those removed earlier.
+	// so restore the latest removals first, with chains before rules and rules in the order of their positions.
+	rules := snapshot.Rules
+	sort.SliceStable(rules, func(i, j int) bool {
+		if !rules[i].RemovedAt.Equal(rules[j].RemovedAt) {
+			return rules[i].RemovedAt.After(rules[j].RemovedAt)
+		}
+		return rules[i].Position < rules[j].Position
+	})
+
+	restored := 0
+	var failed []SnapshotRule
+	for i := range rules {
+		if err := restoreRule(deps, rules[i]); err != nil {
+			klog.Errorf("Failed to restore %s rule in table %s: %s: %v", rules[i].Family, rules[i].Table, rules[i].Rule, err)
+			failed = append(failed, rules[i])
+			continue
+		}
+		klog.Infof("Restored %s rule in table %s: %s", rules[i].Family, rules[i].Table, rules[i].Rule)
+		restored++
+	}
+
+	// the dropped rules are only reported once
+	dropped := snapshot.Dropped
+	snapshot.Rules = failed
+	snapshot.Dropped = 0
+	if err := store.Save(snapshot); err != nil {
+		return restored, err
+	}
+	if len(failed) > 0 || dropped > 0 {
+		return restored, fmt.Errorf("%d rules failed and %d rules were dropped from the snapshot: %w", len(failed), dropped, ErrRestoreIncomplete)
+	}
+	return restored, nil
+}
+
+func iptablesClientFor(deps Dependencies, family string) (IPTablesClient, error) {
+	var client IPTablesClient
+	switch family {
+	case familyIPv4:
+		client = deps.IPTablesV4
+	case familyIPv6:
+		client = deps.IPTablesV6
+	}
+	if client == nil {
+		return nil, fmt.Errorf("%s: %w", family, ErrNoIPTablesClient)
+	}
+	return client, nil
+}
+
+// locateRule finds the chain and the position in it of an unexpected rule
+func locateRule(deps Dependencies, rule UnexpectedRule, now time.Time) (SnapshotRule, error) {
+	args, err := splitRule(rule.Rule)
+	if err != nil {
+		return SnapshotRule{}, err
+	}
+	if len(args) < 2 || (args[0] != "-A" && args[0] != "-N") {
+		return SnapshotRule{}, ErrRuleNotRemovable
+	}
+	removal := SnapshotRule{Family: rule.Family, Table: rule.Table, Chain: args[1], Rule: rule.Rule, RemovedAt: now}
+	if args[0] == "-N" {
+		return removal, nil
+	}
+
+	client, err := iptablesClientFor(deps, rule.Family)
+	if err != nil {
+		return SnapshotRule{}, err
+	}
+	rules, err := client.List(rule.Table, removal.Chain)
+	if err != nil {
+		return SnapshotRule{}, fmt.Errorf("failed to list rules for table %s chain %s: %w", rule.Table, removal.Chain, err)
+	}
+	position := 0
+	for _, r := range rules {
+		if !strings.HasPrefix(r, "-A ") {
+			continue
+		}
+		position++
+		if r == rule.Rule {
+			removal.Position = position
+			return removal, nil
+		}
+	}
+	return SnapshotRule{}, ErrRuleNotFound
+}
+
+func removeRule(deps Dependencies, removal SnapshotRule) error {
+	client, err := iptablesClientFor(deps, removal.Family)
+	if err != nil {
+		return err
+	}
+	if removal.Position == 0 {
+		return client.DeleteChain(removal.Table, removal.Chain) //nolint:wrapcheck // the iptables error names the chain
+	}
+	args, err := splitRule(removal.Rule)
+	if err != nil {
+		return err
+	}
+	return client.Delete(removal.Table, removal.Chain, args[2:]...) //nolint:wrapcheck // the iptables error names the rule
+}
+
+func restoreRule(deps Dependencies, removal SnapshotRule) error {
+	client, err := iptablesClientFor(deps, removal.Family)
+	if err != nil {
+		return err
+	}
+	chainExists, err := client.ChainExists(removal.Table, removal.Chain)
+	if err != nil {
+		return fmt.Errorf("failed to check chain %s exists: %w", removal.Chain, err)
+	}
+	if !chainExists {
+		if err := client.NewChain(removal.Table, removal.Chain); err != nil {
+			return fmt.Errorf("failed to create chain %s: %w", removal.Chain, err)
+		}
+	}
+	if removal.Position == 0 {
+		return nil
+	}
+
+	args, err := splitRule(removal.Rule)
+	if err != nil {
+		return err
+	}
+	rulespec := args[2:]
+	exists, err := client.Exists(removal.Table, removal.Chain, rulespec...)
+	if err != nil {
+		return fmt.Errorf("failed to check rule exists: %w", err)
+	}
+	if exists {
+		return nil
+	}
+
+	// the chain may have fewer rules than when the rule was removed
+	rules, err := client.List(removal.Table, removal.Chain)
+	if err != nil {
+		return fmt.Errorf("failed to list rules for table %s chain %s: %w", removal.Table, removal.Chain, err)
+	}
+	count := 0
+	for _, r := range rules {
+		if strings.HasPrefix(r, "-A ") {
+			count++
+		}
+	}
+	return client.Insert(removal.Table, removal.Chain, min(removal.Position, count+1), rulespec...) //nolint:wrapcheck // the iptables error names the rule
+}
+
+// splitRule splits a rule as listed by iptables -S into its arguments.
+// iptables quotes arguments containing spaces with double quotes, escaping quotes and backslashes inside them.
+func splitRule(rule string) ([]string, error) {
+	var (
+		args                    []string
+		arg                     strings.Builder
+		inArg, quoted, escaping bool
+	)
+	for _, c := range rule {
+		switch {
+		case escaping:
+			arg.WriteRune(c)
+			escaping = false
+		case c == '\\' && quoted:
+			escaping = true
+		case c == '"':
+			quoted = !quoted
+			inArg = true
+		case c == ' ' && !quoted:
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quoted || escaping {
+		return nil, fmt.Errorf("rule %q: %w", rule, ErrUnbalancedQuotes)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSplitRule(t *testing.T) {
+	testCases := []struct {
+		name        string
+		rule        string
+		expected    []string
+		expectedErr error
+	}{
+		{
+			name:     "simple rule",
+			rule:     "-A INPUT -s 10.0.0.1/32 -j DROP",
+			expected: []string{"-A", "INPUT", "-s", "10.0.0.1/32", "-j", "DROP"},
+		},
+		{
+			name:     "quoted comment",
+			rule:     `-A INPUT -m comment --comment "my rule" -j ACCEPT`,
+			expected: []string{"-A", "INPUT", "-m", "comment", "--comment", "my rule", "-j", "ACCEPT"},
+		},
+		{
+			name:     "escaped quote in comment",
+			rule:     `-A INPUT -m comment --comment "say \"hi\"" -j ACCEPT`,
+			expected: []string{"-A", "INPUT", "-m", "comment", "--comment", `say "hi"`, "-j", "ACCEPT"},
+		},
+		{
+			name:     "empty quoted argument",
+			rule:     `-A INPUT -m comment --comment "" -j ACCEPT`,
+			expected: []string{"-A", "INPUT", "-m", "comment", "--comment", "", "-j", "ACCEPT"},
+		},
+		{
+			name:        "unbalanced quotes",
+			rule:        `-A INPUT -m comment --comment "my rule -j ACCEPT`,
+			expectedErr: ErrUnbalancedQuotes,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			args, err := splitRule(tc.rule)
+			if tc.expectedErr != nil {
+				require.ErrorIs(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, args)
+		})
+	}
+}
+
+func newRemediationDeps() (Dependencies, *MockIPTablesClient, *MockIPTablesClient) {
+	iptablesV4 := NewMockIPTablesClient()
+	iptablesV4.rules = map[string]map[string][]string{
+		"filter": {
+			"INPUT": []string{"-A INPUT -j ACCEPT", "-A INPUT -s 10.0.0.1/32 -j DROP", "-A INPUT -s 10.0.0.2/32 -j DROP", "-A INPUT -j LOG"},
+		},
+	}
+	iptablesV6 := NewMockIPTablesClient()
+	iptablesV6.rules = map[string]map[string][]string{
+		"nat": {
+			"POSTROUTING": []string{"-A POSTROUTING -j MASQUERADE"},
+		},
+	}
+	return Dependencies{IPTablesV4: iptablesV4, IPTablesV6: iptablesV6}, iptablesV4, iptablesV6
+}
+
+// failingSnapshotStore fails to save snapshots
+type failingSnapshotStore struct{}
+
+var errSnapshotSave = errors.New("save failed")
+
+func (failingSnapshotStore) Load() (*Snapshot, error) { return &Snapshot{}, nil }
+func (failingSnapshotStore) Save(*Snapshot) error     { return errSnapshotSave }
+
+func TestRemediateAfterGracePeriod(t *testing.T) {
+	deps, iptablesV4, iptablesV6 := newRemediationDeps()
+	store := NewFileSnapshotStore(filepath.Join(t.TempDir(), "snapshot.json"))
+	remediator := NewRemediator("test-node", 10*time.Minute, store)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	remediator.now = func() time.Time { return now }
+
+	found := []UnexpectedRule{
+		{Family: familyIPv4, Table: "filter", Rule: "-A INPUT -s 10.0.0.1/32 -j DROP"},
+		{Family: familyIPv4, Table: "filter", Rule: "-A INPUT -s 10.0.0.2/32 -j DROP"},
+		{Family: familyIPv6, Table: "nat", Rule: "-A POSTROUTING -j MASQUERADE"},
+	}
+
+	// within the grace period nothing is removed
+	remaining := remediator.Remediate(deps, found)
+	require.Equal(t, found, remaining)
+	now = now.Add(5 * time.Minute)
+	remaining = remediator.Remediate(deps, found)
+	require.Equal(t, found, remaining)
+	require.Len(t, iptablesV4.rules["filter"]["INPUT"], 4)
+
+	// once the grace period is over, the rules are saved and removed
+	now = now.Add(5 * time.Minute)
+	remaining = remediator.Remediate(deps, found)
+	require.Empty(t, remaining)
+	require.Equal(t, []string{"-A INPUT -j ACCEPT", "-A INPUT -j LOG"}, iptablesV4.rules["filter"]["INPUT"])
+	require.Empty(t, iptablesV6.rules["nat"]["POSTROUTING"])
+
+	snapshot, err := store.Load()
+	require.NoError(t, err)
+	require.Equal(t, "test-node", snapshot.Node)
+	require.Equal(t, []SnapshotRule{
+		{Family: familyIPv4, Table: "filter", Chain: "INPUT", Position: 2, Rule: "-A INPUT -s 10.0.0.1/32 -j DROP", RemovedAt: now},
+		{Family: familyIPv4, Table: "filter", Chain: "INPUT", Position: 3, Rule: "-A INPUT -s 10.0.0.2/32 -j DROP", RemovedAt: now},
+		{Family: familyIPv6, Table: "nat", Chain: "POSTROUTING", Position: 1, Rule: "-A POSTROUTING -j MASQUERADE", RemovedAt: now},
+	}, snapshot.Rules)
+
+	// restoring puts the rules back where they were and empties the snapshot
+	restored, err := Restore(deps, store)
+	require.NoError(t, err)
+	require.Equal(t, 3, restored)
+	require.Equal(t, []string{"-A INPUT -j ACCEPT", "-A INPUT -s 10.0.0.1/32 -j DROP", "-A INPUT -s 10.0.0.2/32 -j DROP", "-A INPUT -j LOG"},
+		iptablesV4.rules["filter"]["INPUT"])
+	require.Equal(t, []string{"-A POSTROUTING -j MASQUERADE"}, iptablesV6.rules["nat"]["POSTROUTING"])
+
+	snapshot, err = store.Load()
+	require.NoError(t, err)
+	require.Empty(t, snapshot.Rules)
+
+	// restoring again is a no-op
+	restored, err = Restore(deps, store)
+	require.NoError(t, err)
+	require.Zero(t, restored)
+}
+
+func TestRemediateResetsGracePeriodOfRulesWhichGoAway(t *testing.T) {
+	deps, iptablesV4, _ := newRemediationDeps()
+	remediator := NewRemediator("test-node", 10*time.Minute, NewFileSnapshotStore(filepath.Join(t.TempDir(), "snapshot.json")))
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	remediator.now = func() time.Time { return now }
+
+	found := []UnexpectedRule{{Family: familyIPv4, Table: "filter", Rule: "-A INPUT -j LOG"}}
+	remediator.Remediate(deps, found)
+	now = now.Add(5 * time.Minute)
+	remediator.Remediate(deps, nil)
+	now = now.Add(5 * time.Minute)
+	remaining := remediator.Remediate(deps, found)
+
+	require.Equal(t, found, remaining)
+	require.Contains(t, iptablesV4.rules["filter"]["INPUT"], "-A INPUT -j LOG")
+}
+
+func TestRemediateDoesNotRemoveUnsavedRules(t *testing.T) {
+	deps, iptablesV4, _ := newRemediationDeps()
+	remediator := NewRemediator("test-node", 0, failingSnapshotStore{})
+
+	found := []UnexpectedRule{{Family: familyIPv4, Table: "filter", Rule: "-A INPUT -j LOG"}}
+	remaining := remediator.Remediate(deps, found)
+
+	require.Equal(t, found, remaining)
+	require.Contains(t, iptablesV4.rules["filter"]["INPUT"], "-A INPUT -j LOG")
+}
+
+func TestRemediateDropsEarliestRulesFromFullSnapshot(t *testing.T) {
+	deps, _, _ := newRemediationDeps()
+	store := NewFileSnapshotStore(filepath.Join(t.TempDir(), "snapshot.json"))
+	removedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	full := &Snapshot{Node: "test-node"}
+	// the rules saved latest come first, as restoring leaves them
+	for i := maxSnapshotRules; i > 0; i-- {
+		full.Rules = append(full.Rules, SnapshotRule{Family: familyIPv4, Table: "filter", Chain: "INPUT", Position: 1,
+			Rule: "-A INPUT -j DROP", RemovedAt: removedAt.Add(time.Duration(i) * time.Minute)})
+	}
+	require.NoError(t, store.Save(full))
+	remediator := NewRemediator("test-node", 0, store)
+
+	remediator.Remediate(deps, []UnexpectedRule{{Family: familyIPv4, Table: "filter", Rule: "-A INPUT -j LOG"}})
+
+	snapshot, err := store.Load()
+	require.NoError(t, err)
+	require.Len(t, snapshot.Rules, maxSnapshotRules)
+	require.Equal(t, removedAt.Add(2*time.Minute), snapshot.Rules[0].RemovedAt)
+	require.Equal(t, "-A INPUT -j LOG", snapshot.Rules[maxSnapshotRules-1].Rule)
+	require.Equal(t, 1, snapshot.Dropped)
+
+	// the restore reports the dropped rules, once
+	restored, err := Restore(deps, store)
+	require.ErrorIs(t, err, ErrRestoreIncomplete)
+	require.Equal(t, maxSnapshotRules, restored)
+	snapshot, err = store.Load()
+	require.NoError(t, err)
+	require.Zero(t, snapshot.Dropped)
+	_, err = Restore(deps, store)
+	require.NoError(t, err)
+}
+
+func TestRemediateUserChain(t *testing.T) {
+	deps, iptablesV4, _ := newRemediationDeps()
+	iptablesV4.rules["filter"]["USER"] = []string{"-A USER -j DROP"}
+	iptablesV4.rules["filter"]["INPUT"] = append(iptablesV4.rules["filter"]["INPUT"], "-A INPUT -j USER")
+	store := NewFileSnapshotStore(filepath.Join(t.TempDir(), "snapshot.json"))
+	remediator := NewRemediator("test-node", 0, store)
+
+	found := []UnexpectedRule{
+		{Family: familyIPv4, Table: "filter", Rule: "-N USER"},
+		{Family: familyIPv4, Table: "filter", Rule: "-A INPUT -j USER"},
+		{Family: familyIPv4, Table: "filter", Rule: "-A USER -j DROP"},
+		{Family: familyIPv4, Table: "filter", Rule: "-P FORWARD DROP"},
+	}
+	remaining := remediator.Remediate(deps, found)
+
+	// policies can't be removed
+	require.Equal(t, []UnexpectedRule{{Family: familyIPv4, Table: "filter", Rule: "-P FORWARD DROP"}}, remaining)
+	require.NotContains(t, iptablesV4.rules["filter"], "USER")
+	require.NotContains(t, iptablesV4.rules["filter"]["INPUT"], "-A INPUT -j USER")
+
+	restored, err := Restore(deps, store)
+	require.NoError(t, err)
+	require.Equal(t, 3, restored)
+	require.Equal(t, []string{"-A USER -j DROP"}, iptablesV4.rules["filter"]["USER"])
+	require.Contains(t, iptablesV4.rules["filter"]["INPUT"], "-A INPUT -j USER")
+}
+
+func TestRestoreInReverseOrderOfRemoval(t *testing.T) {
+	deps, iptablesV4, _ := newRemediationDeps()
+	store := NewFileSnapshotStore(filepath.Join(t.TempDir(), "snapshot.json"))
+	remediator := NewRemediator("test-node", 0, store)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	remediator.now = func() time.Time { return now }
+
+	// the second removal is recorded at position 2, after the first removal
+	remediator.Remediate(deps, []UnexpectedRule{{Family: familyIPv4, Table: "filter", Rule: "-A INPUT -s 10.0.0.1/32 -j DROP"}})
+	now = now.Add(time.Minute)
+	remediator.Remediate(deps, []UnexpectedRule{{Family: familyIPv4, Table: "filter", Rule: "-A INPUT -s 10.0.0.2/32 -j DROP"}})
+	require.Equal(t, []string{"-A INPUT -j ACCEPT", "-A INPUT -j LOG"}, iptablesV4.rules["filter"]["INPUT"])
+
+	_, err := Restore(deps, store)
+	require.NoError(t, err)
+	require.Equal(t, []string{"-A INPUT -j ACCEPT", "-A INPUT -s 10.0.0.1/32 -j DROP", "-A INPUT -s 10.0.0.2/32 -j DROP", "-A INPUT -j LOG"},
+		iptablesV4.rules["filter"]["INPUT"])
+}
+
+func TestRestoreKeepsRulesWhichFail(t *testing.T) {
+	deps, _, _ := newRemediationDeps()
+	store := NewFileSnapshotStore(filepath.Join(t.TempDir(), "snapshot.json"))
+	require.NoError(t, store.Save(&Snapshot{Rules: []SnapshotRule{
+		{Family: familyIPv6, Table: "nat", Chain: "POSTROUTING", Position: 1, Rule: "-A POSTROUTING -j MASQUERADE"},
+	}}))
+
+	// no ip6tables client when IPv6 is disabled
+	deps.IPTablesV6 = nil
+	restored, err := Restore(deps, store)
+	require.ErrorIs(t, err, ErrRestoreIncomplete)
+	require.Zero(t, restored)
+
+	snapshot, err := store.Load()
+	require.NoError(t, err)
+	require.Len(t, snapshot.Rules, 1)
+}
+
+func TestConfigMapSnapshotStore(t *testing.T) {
+	kubeClient := NewMockKubeClient()
+	store := NewConfigMapSnapshotStore(kubeClient, "kube-system", "test-node")
+
+	snapshot, err := store.Load()
+	require.NoError(t, err)
+	require.Empty(t, snapshot.Rules)
+
+	snapshot.Node = "test-node"
+	snapshot.Rules = []SnapshotRule{{Family: familyIPv4, Table: "filter", Chain: "INPUT", Position: 1, Rule: "-A INPUT -j DROP"}}
+	require.NoError(t, store.Save(snapshot))
+	require.Contains(t, kubeClient.ConfigMaps, "kube-system/azure-iptables-monitor-snapshot-test-node")
+
+	snapshot.Rules = append(snapshot.Rules, SnapshotRule{Family: familyIPv4, Table: "filter", Chain: "INPUT", Position: 2, Rule: "-A INPUT -j LOG"})
+	require.NoError(t, store.Save(snapshot))
+
+	loaded, err := store.Load()
+	require.NoError(t, err)
+	require.Equal(t, snapshot, loaded)
+}
+
+func TestCheckWithRemediation(t *testing.T) {
+	fileReader := NewMockFileLineReader()
+	fileReader.files["/etc/config/ipv4/filter"] = []string{"^-A INPUT -j ACCEPT$"}
+
+	deps, iptablesV4, _ := newRemediationDeps()
+	kubeClient := NewMockKubeClient()
+	kubeClient.Node = &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "test-node", UID: "test-uid"}}
+	kubeClient.Event = &corev1.Event{}
+	deps.KubeClient = kubeClient
+	deps.DynamicClient = NewMockDynamicClient()
+	deps.EBPFClient = NewMockEBPFClient()
+	deps.FileReader = fileReader
+	deps.Remediator = NewRemediator("test-node", 0, NewConfigMapSnapshotStore(kubeClient, "kube-system", "test-node"))
+
+	cfg := Config{
+		ConfigPath4: "/etc/config/ipv4",
+		SendEvents:  true,
+		NodeName:    "test-node",
+	}
+	previousBlocks := uint64(0)
+
+	// the unexpected rules are removed, so the node no longer has user iptables rules
+	require.False(t, Check(cfg, deps, &previousBlocks))
+	require.Equal(t, []string{"-A INPUT -j ACCEPT"}, iptablesV4.rules["filter"]["INPUT"])
+	require.Equal(t, 1, kubeClient.EventCalls, "Expected an event for the removed rules")
+	mockDynamic := deps.DynamicClient.(*MockDynamicClient)
+	require.Len(t, mockDynamic.PatchCalls, 1)
+	require.Contains(t, string(mockDynamic.PatchCalls[0].Data), `"false"`)
+}
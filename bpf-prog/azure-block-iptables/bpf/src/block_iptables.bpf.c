@@ -13,7 +13,6 @@
 #define EPERM 1
 #define IPT_SO_SET_REPLACE 64
 #define TASK_COMM_LEN 16
-#define COMM_COUNT 6
 #define IPPROTO_IP 0
 #define IPPROTO_IP6 41
 #define AF_NETLINK 16
@@ -22,34 +21,107 @@
 #define NFNL_SUBSYS_NFTABLES 10
 #define NFT_MSG_NEWRULE 6
 
-#define CILIUM_AGENT "cilium-agent"
-#define IP_MASQ "ip-masq"
-#define AZURE_CNS "azure-cns"
-#define ISTIO_NODE_AGENT "install-cni"
-#define NFS_MOUNT_SCRIPTS "nfs" // nfvsv3mountscript, nfsv4mountscript
-#define WAAGENT "python" // this allows all python processes including waagent. Will narrow down in the future.
+#define MAX_ALLOWLIST_ENTRIES 256
+
+// Keys of the event counters.
+#define EVENT_BLOCKED 0
+#define EVENT_ALLOWED 1
+#define EVENT_AUDITED 2
+
+// Netfilter operations reported in block events.
+#define OP_IPT_SO_SET_REPLACE 1
+#define OP_NFT_NEWRULE 2
+
+#define BLOCK_EVENTS_SIZE (256 * 1024)
 
 char __license[] SEC("license") = "Dual MIT/GPL";
 volatile const u64 host_netns_inode = 4026531840; // Initialized by userspace
 
 struct {
     __uint(type, BPF_MAP_TYPE_ARRAY);
-    __uint(max_entries, 2);
+    __uint(max_entries, 3);
     __type(key, u32);
     __type(value, u64);
     __uint(pinning, LIBBPF_PIN_BY_NAME);
 } iptables_block_event_counter SEC(".maps");
 
+// comm_key is a prefix of a command name. Looking up a whole command name matches the longest allowed prefix of it.
+struct comm_key {
+    u32 prefixlen; // in bits
+    char comm[TASK_COMM_LEN];
+};
+
+// exe_key identifies an executable by the inode of its file.
+struct exe_key {
+    u64 ino;
+    u32 dev;
+    u32 pad;
+};
+
+// The allowlist is populated by userspace. Processes whose parent's command name starts with an allowed prefix,
+// whose parent runs an allowed executable, or which are in an allowed cgroup may install iptables rules.
+struct {
+    __uint(type, BPF_MAP_TYPE_LPM_TRIE);
+    __uint(max_entries, MAX_ALLOWLIST_ENTRIES);
+    __uint(map_flags, BPF_F_NO_PREALLOC);
+    __type(key, struct comm_key);
+    __type(value, u8);
+    __uint(pinning, LIBBPF_PIN_BY_NAME);
+} iptables_block_allow_comm SEC(".maps");
+
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, MAX_ALLOWLIST_ENTRIES);
+    __type(key, u64);
+    __type(value, u8);
+    __uint(pinning, LIBBPF_PIN_BY_NAME);
+} iptables_block_allow_cgroup SEC(".maps");
+
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, MAX_ALLOWLIST_ENTRIES);
+    __type(key, struct exe_key);
+    __type(value, u8);
+    __uint(pinning, LIBBPF_PIN_BY_NAME);
+} iptables_block_allow_exe SEC(".maps");
+
+// The config is populated by userspace. If its only value is non-zero, rules which would be blocked are counted but allowed.
+struct {
+    __uint(type, BPF_MAP_TYPE_ARRAY);
+    __uint(max_entries, 1);
+    __type(key, u32);
+    __type(value, u32);
+    __uint(pinning, LIBBPF_PIN_BY_NAME);
+} iptables_block_config SEC(".maps");
+
+// block_event is a record of a process which tried to install an iptables rule without being allowed to.
+struct block_event {
+    u64 cgroup_id;
+    u32 pid;
+    u32 ppid;
+    char comm[TASK_COMM_LEN];
+    char parent_comm[TASK_COMM_LEN];
+    u8 op;
+    u8 audited;
+    u8 pad[6];
+};
+
+// Block events are read from userspace to report which processes tried to install iptables rules.
+struct {
+    __uint(type, BPF_MAP_TYPE_RINGBUF);
+    __uint(max_entries, BLOCK_EVENTS_SIZE);
+    __uint(pinning, LIBBPF_PIN_BY_NAME);
+} iptables_block_events SEC(".maps");
+
 // This function checks if the parent process of the current task is allowed to install iptables rules.
-// It checks the parent's command name against a predefined list of allowed prefixes.
+// It checks the parent's command name and executable, and the cgroup of the current task, against the allowlist.
 bool is_allowed_parent ()
 {
     struct task_struct *task = (struct task_struct *)bpf_get_current_task();
     struct task_struct *parent_task = NULL;
-
-    // Allow cilium-agent, ip-masq-agent, nfs, istio, waagent and azure-cns
-    char parent_comm[TASK_COMM_LEN] = {};
-    const char target_prefixes[COMM_COUNT][TASK_COMM_LEN] = {CILIUM_AGENT, IP_MASQ, AZURE_CNS, ISTIO_NODE_AGENT, NFS_MOUNT_SCRIPTS, WAAGENT};
+    struct comm_key comm = {.prefixlen = TASK_COMM_LEN * 8};
+    struct exe_key exe = {};
+    u64 cgroup_id = 0;
 
     // Safely get parent task_struct
     parent_task = BPF_CORE_READ(task, real_parent);
@@ -57,31 +129,38 @@ bool is_allowed_parent ()
         return 0;
 
     // Safely read parent->comm
-    if (bpf_core_read_str(&parent_comm, sizeof(parent_comm), &parent_task->comm) < 0)
+    if (bpf_core_read_str(&comm.comm, sizeof(comm.comm), &parent_task->comm) < 0)
         return 0;
 
-    // Check if parent_comm is an allowed command
-    #pragma unroll
-    for(int p = 0; p < COMM_COUNT; p++) {
-        int match = 1;
-        for (int i = 0; i < TASK_COMM_LEN && target_prefixes[p][i] != '\0'; i++) {
-            if (parent_comm[i] != target_prefixes[p][i]) {
-                match = 0;
-                break;
-            }
-        }
+    // Check if parent_comm starts with an allowed prefix
+    if (bpf_map_lookup_elem(&iptables_block_allow_comm, &comm))
+        return 1;
 
-        if(match) {
-            return 1;
-        }
-    }
+    // Check if the current task is in an allowed cgroup
+    cgroup_id = bpf_get_current_cgroup_id();
+    if (bpf_map_lookup_elem(&iptables_block_allow_cgroup, &cgroup_id))
+        return 1;
 
-    parent_comm[TASK_COMM_LEN - 1] = '\0'; // Ensure null termination
-    bpf_printk("Blocked iptables rule - parent comm: %s, pid: %d\n", parent_comm, BPF_CORE_READ(parent_task, pid));
+    // Check if the parent runs an allowed executable
+    exe.ino = BPF_CORE_READ(parent_task, mm, exe_file, f_inode, i_ino);
+    exe.dev = BPF_CORE_READ(parent_task, mm, exe_file, f_inode, i_sb, s_dev);
+    if (exe.ino && bpf_map_lookup_elem(&iptables_block_allow_exe, &exe))
+        return 1;
+
+    comm.comm[TASK_COMM_LEN - 1] = '\0'; // Ensure null termination
+    bpf_printk("Blocked iptables rule - parent comm: %s, pid: %d\n", comm.comm, BPF_CORE_READ(parent_task, pid));
 
     return 0; // Block
 }
 
+// check if rules which would be blocked are only counted
+bool is_audit_only() {
+    u32 key = 0;
+    u32 *audit_only = bpf_map_lookup_elem(&iptables_block_config, &key);
+
+    return audit_only && *audit_only;
+}
+
 // check if the current task is in the host network namespace
 // This function compares the inode number of the current network namespace with the host's network namespace inode
 // The host's network namespace inode is initialized by userspace when the BPF program is loaded.
@@ -108,10 +187,10 @@ bool is_host_ns() {
     return 1;
 }
 
-// Increment the event counters in the BPF map. Key is 0 for blocked rules and 1 for allowed rules.
+// Increment the event counters in the BPF map. Key is 0 for blocked rules, 1 for allowed rules
+// and 2 for rules which would have been blocked in audit-only mode.
 // This counter will be read from userspace to track the number of blocked/allowed events.
-void increment_event_counter(bool isAllow) {
-    u32 key = isAllow ? 1 : 0;
+void increment_event_counter(u32 key) {
     u64 *value;
 
     value = bpf_map_lookup_elem(&iptables_block_event_counter, &key);
@@ -123,6 +202,44 @@ void increment_event_counter(bool isAllow) {
     }
 }
 
+// Submit a block event about the current task. Events are dropped if userspace doesn't keep up with them.
+void submit_block_event(u8 op, bool audited) {
+    struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+    struct task_struct *parent_task = NULL;
+    struct block_event *event;
+
+    event = bpf_ringbuf_reserve(&iptables_block_events, sizeof(*event), 0);
+    if (!event)
+        return;
+
+    __builtin_memset(event, 0, sizeof(*event));
+    event->cgroup_id = bpf_get_current_cgroup_id();
+    event->pid = bpf_get_current_pid_tgid() >> 32;
+    bpf_get_current_comm(&event->comm, sizeof(event->comm));
+    parent_task = BPF_CORE_READ(task, real_parent);
+    if (parent_task) {
+        event->ppid = BPF_CORE_READ(parent_task, tgid);
+        bpf_core_read_str(&event->parent_comm, sizeof(event->parent_comm), &parent_task->comm);
+    }
+    event->op = op;
+    event->audited = audited;
+
+    bpf_ringbuf_submit(event, 0);
+}
+
+// Returns the verdict for a rule from a process which isn't allowed: blocked, or allowed in audit-only mode.
+int block(u8 op) {
+    if (is_audit_only()) {
+        increment_event_counter(EVENT_AUDITED);
+        submit_block_event(op, true);
+        return 0;
+    }
+
+    increment_event_counter(EVENT_BLOCKED);
+    submit_block_event(op, false);
+    return -EPERM;
+}
+
 // blocking hook for iptables-legacy rule installation
 SEC("lsm/socket_setsockopt")
 int BPF_PROG(iptables_legacy_block, struct socket *sock, int level, int optname)
@@ -138,10 +255,9 @@ int BPF_PROG(iptables_legacy_block, struct socket *sock, int level, int optname)
             // block if not in host network namespace, and if the parent process is not allowed
             if (is_host_ns()) {
                 if (!is_allowed_parent()) {
-                    increment_event_counter(false);
-                    return -EPERM;
+                    return block(OP_IPT_SO_SET_REPLACE);
                 } else {
-                    increment_event_counter(true);
+                    increment_event_counter(EVENT_ALLOWED);
                     return 0; // Allow the operation
                 }
             }
@@ -212,14 +328,13 @@ int BPF_PROG(iptables_nftables_block, struct sock *sk, struct sk_buff *skb) {
         if (subsys_id == NFNL_SUBSYS_NFTABLES && cmd == NFT_MSG_NEWRULE) {
             // If the message is a new rule, check if the parent process is allowed
             // and whether we are in the host network namespace.
-            // If not allowed, increment the event counter and return -EPERM.
+            // If not allowed, increment the event counter and return -EPERM, unless in audit-only mode.
             if(is_allowed_parent()) {
-                increment_event_counter(true);
+                increment_event_counter(EVENT_ALLOWED);
                 // Allow the operation
                 return 0;
             } else {
-                increment_event_counter(false);
-                return -EPERM;
+                return block(OP_NFT_NEWRULE);
             }
         }
 
@@ -4,36 +4,59 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
 
+	"github.com/Azure/azure-container-networking/bpf-prog/azure-block-iptables/pkg/blockevents"
 	"github.com/Azure/azure-container-networking/bpf-prog/azure-block-iptables/pkg/bpfprogram"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 )
 
 // ProgramVersion is set during build
 var (
 	version         = "unknown"
 	ErrModeRequired = errors.New("mode is required")
-	ErrInvalidMode  = errors.New("invalid mode. Use -mode=attach or -mode=detach")
+	ErrInvalidMode  = errors.New("invalid mode. Use -mode=attach, -mode=detach, -mode=update or -mode=report")
+	ErrNodeName     = errors.New("NODE_NAME environment variable must be set to send events")
 )
 
+const metricsReadHeaderTimeout = 10 * time.Second
+
 // Config holds configuration for the application
 type Config struct {
-	Mode            string // "attach" or "detach"
+	Mode            string // "attach", "detach", "update" or "report"
 	Overwrite       bool   // force detach before attach
+	Allowlist       *bpfprogram.Allowlist
 	AttacherFactory bpfprogram.AttacherFactory
+	MetricsAddress  string // address to serve the metrics of block events on in report mode
+	SendEvents      bool   // emit block events as Events on the node in report mode
+	NodeName        string
 }
 
 // parseArgs parses command line arguments and returns the configuration
 func parseArgs() (*Config, error) {
 	var (
-		mode        = flag.String("mode", "", "Operation mode: 'attach' or 'detach' (required)")
-		overwrite   = flag.Bool("overwrite", false, "Force detach before attach (only applies to attach mode)")
-		showVersion = flag.Bool("version", false, "Show version information")
-		showHelp    = flag.Bool("help", false, "Show help information")
+		mode          = flag.String("mode", "", "Operation mode: 'attach', 'detach' or 'update' the allowlist of the attached program (required)")
+		overwrite     = flag.Bool("overwrite", false, "Force detach before attach (only applies to attach mode)")
+		metricsAddr   = flag.String("metrics-address", ":9100", "Address to serve Prometheus metrics of the block events on (only applies to report mode)")
+		sendEvents    = flag.Bool("events", false, "Emit block events as Kubernetes Events on the node named by NODE_NAME (only applies to report mode)")
+		allowlistPath = flag.String("allowlist", "", "Path to a YAML or JSON allowlist of the processes which may install iptables rules, e.g. mounted from a ConfigMap. Defaults to the built-in allowlist")
+		showVersion   = flag.Bool("version", false, "Show version information")
+		showHelp      = flag.Bool("help", false, "Show help information")
 	)
 
 	flag.Parse()
@@ -52,14 +75,33 @@ func parseArgs() (*Config, error) {
 		return nil, ErrModeRequired
 	}
 
-	if *mode != "attach" && *mode != "detach" {
+	if *mode != "attach" && *mode != "detach" && *mode != "update" && *mode != "report" {
 		return nil, ErrInvalidMode
 	}
 
+	nodeName := os.Getenv("NODE_NAME")
+	if *mode == "report" && *sendEvents && nodeName == "" {
+		return nil, ErrNodeName
+	}
+
+	allowlist := bpfprogram.DefaultAllowlist()
+	if *allowlistPath != "" {
+		var err error
+		if allowlist, err = bpfprogram.LoadAllowlist(*allowlistPath); err != nil {
+			return nil, errors.Wrap(err, "failed to load allowlist")
+		}
+	}
+
 	return &Config{
-		Mode:            *mode,
-		Overwrite:       *overwrite,
-		AttacherFactory: bpfprogram.NewProgram,
+		Mode:      *mode,
+		Overwrite: *overwrite,
+		Allowlist: allowlist,
+		AttacherFactory: func() bpfprogram.Attacher {
+			return bpfprogram.NewProgram(allowlist)
+		},
+		MetricsAddress: *metricsAddr,
+		SendEvents:     *sendEvents,
+		NodeName:       nodeName,
 	}, nil
 }
 
@@ -103,6 +145,77 @@ func detachMode(config *Config) error {
 	return nil
 }
 
+// updateMode handles the update operation
+func updateMode(config *Config) error {
+	log.Println("Starting update mode...")
+
+	// Initialize BPF program attacher using the factory
+	bp := config.AttacherFactory()
+
+	// Replace the allowlist in the maps of the attached BPF program
+	if err := bp.UpdateAllowlist(config.Allowlist); err != nil {
+		return errors.Wrap(err, "failed to update allowlist")
+	}
+
+	log.Println("Allowlist updated successfully")
+	return nil
+}
+
+// reportMode handles the report operation, reporting block events until terminated
+func reportMode(config *Config) error {
+	log.Println("Starting report mode...")
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	source, err := blockevents.NewReader(filepath.Join(bpfprogram.BPFMapPinPath, bpfprogram.BlockEventsMapName))
+	if err != nil {
+		return errors.Wrap(err, "failed to open block events, is the BPF program attached?")
+	}
+
+	var (
+		recorder record.EventRecorder
+		node     *corev1.ObjectReference
+	)
+	if config.SendEvents {
+		kubeConfig, err := rest.InClusterConfig()
+		if err != nil {
+			return errors.Wrap(err, "failed to create in-cluster config")
+		}
+		clientset, err := kubernetes.NewForConfig(kubeConfig)
+		if err != nil {
+			return errors.Wrap(err, "failed to create kubernetes clientset")
+		}
+		if recorder, node, err = blockevents.NewNodeEventRecorder(ctx, clientset, config.NodeName); err != nil {
+			return errors.Wrap(err, "failed to create event recorder")
+		}
+	}
+
+	reporter, err := blockevents.NewReporter(prometheus.DefaultRegisterer, recorder, node)
+	if err != nil {
+		return errors.Wrap(err, "failed to create block event reporter")
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	server := &http.Server{Addr: config.MetricsAddress, Handler: mux, ReadHeaderTimeout: metricsReadHeaderTimeout}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Metrics server failed: %v", err)
+			cancel()
+		}
+	}()
+	defer server.Close()
+
+	log.Printf("Reporting block events, serving metrics on %s", config.MetricsAddress)
+	if err := reporter.Run(ctx, source); err != nil && !errors.Is(err, context.Canceled) {
+		return errors.Wrap(err, "failed to report block events")
+	}
+
+	log.Println("Stopped reporting block events")
+	return nil
+}
+
 // run is the main application logic
 func run(config *Config) error {
 	switch config.Mode {
@@ -110,6 +223,10 @@ func run(config *Config) error {
 		return attachMode(config)
 	case "detach":
 		return detachMode(config)
+	case "update":
+		return updateMode(config)
+	case "report":
+		return reportMode(config)
 	default:
 		return ErrInvalidMode
 	}
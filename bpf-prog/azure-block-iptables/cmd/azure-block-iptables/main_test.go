@@ -64,3 +64,20 @@ func TestHandleFileEventWithMock(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateModeWithMock(t *testing.T) {
+	mockAttacher := bpfprogram.NewMockProgram()
+	allowlist := &bpfprogram.Allowlist{CommPrefixes: []string{"my-agent"}, AuditOnly: true}
+
+	if err := run(&Config{Mode: "update", Allowlist: allowlist, AttacherFactory: func() bpfprogram.Attacher { return mockAttacher }}); err != nil {
+		t.Errorf("Failed to run: %v", err)
+	}
+
+	if mockAttacher.Allowlist() != allowlist {
+		t.Errorf("Expected allowlist %+v, got %+v", allowlist, mockAttacher.Allowlist())
+	}
+
+	if mockAttacher.AttachCallCount() != 0 || mockAttacher.DetachCallCount() != 0 {
+		t.Errorf("Expected no attach or detach calls, got %d and %d", mockAttacher.AttachCallCount(), mockAttacher.DetachCallCount())
+	}
+}
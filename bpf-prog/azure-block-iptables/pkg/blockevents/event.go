@@ -0,0 +1,86 @@
+// Package blockevents reports the processes which tried to install iptables rules without being allowed to,
+// from the records the BPF program writes to its pinned ring buffer.
+package blockevents
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const taskCommLen = 16
+
+// Op is the netfilter operation a process tried to install a rule with.
+type Op uint8
+
+const (
+	// OpIptSetReplace is an iptables-legacy IPT_SO_SET_REPLACE setsockopt.
+	OpIptSetReplace Op = 1
+	// OpNftNewRule is an iptables-nft NFT_MSG_NEWRULE netlink message.
+	OpNftNewRule Op = 2
+)
+
+func (o Op) String() string {
+	switch o {
+	case OpIptSetReplace:
+		return "ipt_so_set_replace"
+	case OpNftNewRule:
+		return "nft_newrule"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is a process which tried to install an iptables rule without being allowed to.
+type Event struct {
+	PID        uint32
+	PPID       uint32
+	Comm       string
+	ParentComm string
+	CgroupID   uint64
+	Op         Op
+	// Audited is true if the rule was only counted, in audit-only mode, rather than blocked.
+	Audited bool
+}
+
+// rawEvent is the layout of struct block_event in the BPF program.
+type rawEvent struct {
+	CgroupID   uint64
+	PID        uint32
+	PPID       uint32
+	Comm       [taskCommLen]byte
+	ParentComm [taskCommLen]byte
+	Op         uint8
+	Audited    uint8
+	Pad        [6]uint8
+}
+
+// ErrShortRecord is returned when a record is smaller than a block event.
+var ErrShortRecord = errors.New("record is too short for a block event")
+
+// ParseEvent parses a record of the ring buffer of block events.
+func ParseEvent(record []byte) (Event, error) {
+	var raw rawEvent
+	if len(record) < binary.Size(raw) {
+		return Event{}, errors.Wrapf(ErrShortRecord, "got %d bytes", len(record))
+	}
+	if err := binary.Read(bytes.NewReader(record), binary.NativeEndian, &raw); err != nil {
+		return Event{}, errors.Wrap(err, "failed to decode block event")
+	}
+	return Event{
+		PID:        raw.PID,
+		PPID:       raw.PPID,
+		Comm:       commString(raw.Comm),
+		ParentComm: commString(raw.ParentComm),
+		CgroupID:   raw.CgroupID,
+		Op:         Op(raw.Op),
+		Audited:    raw.Audited != 0,
+	}, nil
+}
+
+func commString(comm [taskCommLen]byte) string {
+	b, _, _ := bytes.Cut(comm[:], []byte{0})
+	return strings.ToValidUTF8(string(b), "?")
+}
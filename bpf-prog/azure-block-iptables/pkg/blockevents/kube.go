@@ -0,0 +1,35 @@
+package blockevents
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// component is the source of the Events emitted on the Node.
+const component = "azure-block-iptables"
+
+// NewNodeEventRecorder returns an EventRecorder which emits Events through clientset, and a reference to the Node nodeName
+// to emit them on. Identical Events are deduplicated into a count on a single Event, and Events on the Node are rate limited.
+func NewNodeEventRecorder(ctx context.Context, clientset kubernetes.Interface, nodeName string) (record.EventRecorder, *corev1.ObjectReference, error) {
+	node, err := clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to get node %s", nodeName)
+	}
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: component, Host: nodeName})
+	ref := &corev1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Node",
+		Name:       node.Name,
+		UID:        node.UID, // required for the Events to show up in kubectl describe node
+	}
+	return recorder, ref, nil
+}
@@ -0,0 +1,46 @@
+//go:build linux
+// +build linux
+
+package blockevents
+
+import (
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/ringbuf"
+	"github.com/pkg/errors"
+)
+
+// Reader reads block events from the pinned ring buffer of the BPF program.
+type Reader struct {
+	rd *ringbuf.Reader
+}
+
+// NewReader opens the ring buffer of block events pinned at pinPath.
+func NewReader(pinPath string) (*Reader, error) {
+	m, err := ebpf.LoadPinnedMap(pinPath, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load pinned map %s", pinPath)
+	}
+	defer m.Close()
+	rd, err := ringbuf.NewReader(m)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create ring buffer reader")
+	}
+	return &Reader{rd: rd}, nil
+}
+
+// Read blocks until the next block event, or until the Reader is closed, in which case it returns ErrClosed.
+func (r *Reader) Read() (Event, error) {
+	record, err := r.rd.Read()
+	if err != nil {
+		if errors.Is(err, ringbuf.ErrClosed) {
+			return Event{}, ErrClosed
+		}
+		return Event{}, errors.Wrap(err, "failed to read ring buffer")
+	}
+	return ParseEvent(record.RawSample)
+}
+
+// Close closes the Reader, unblocking Read.
+func (r *Reader) Close() error {
+	return errors.Wrap(r.rd.Close(), "failed to close ring buffer reader")
+}
@@ -0,0 +1,145 @@
+package blockevents
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// Reasons of the Events emitted on the Node.
+const (
+	ReasonBlockedIPTablesRule = "BlockedIPTablesRule"
+	ReasonAuditedIPTablesRule = "AuditedIPTablesRule"
+)
+
+// ErrClosed is returned by a Source once it is closed.
+var ErrClosed = errors.New("block event source closed")
+
+// otherComm is the comm label of the processes which aren't known iptables tools.
+const otherComm = "other"
+
+// knownComms are the command names of the iptables tools counted by name. The command names of processes are
+// set by them, so any other command name is counted as otherComm to bound the cardinality of the metrics.
+// The kernel truncates command names to taskCommLen-1 characters, so the longer tools are keyed on their prefix.
+var knownComms = map[string]struct{}{
+	"iptables":        {},
+	"iptables-legacy": {}, // also iptables-legacy-restore
+	"iptables-nft":    {},
+	"iptables-restor": {}, // iptables-restore
+	"iptables-nft-re": {}, // iptables-nft-restore
+	"ip6tables":       {},
+	"ip6tables-legac": {}, // ip6tables-legacy and ip6tables-legacy-restore
+	"ip6tables-nft":   {},
+	"ip6tables-resto": {}, // ip6tables-restore
+	"ip6tables-nft-r": {}, // ip6tables-nft-restore
+	"xtables-legacy-": {}, // xtables-legacy-multi
+	"xtables-nft-mul": {}, // xtables-nft-multi
+	"nft":             {},
+}
+
+func commLabel(comm string) string {
+	if _, ok := knownComms[comm]; ok {
+		return comm
+	}
+	return otherComm
+}
+
+const (
+	// maxReadFailures is how many reads in a row may fail before Run gives up.
+	maxReadFailures = 10
+	// defaultMinReadBackoff and defaultMaxReadBackoff bound how long Run waits before reading again after a failed read.
+	defaultMinReadBackoff = 100 * time.Millisecond
+	defaultMaxReadBackoff = 10 * time.Second
+)
+
+// Source is where block events are read from.
+type Source interface {
+	// Read blocks until the next block event.
+	Read() (Event, error)
+	// Close unblocks Read, which then returns ErrClosed.
+	Close() error
+}
+
+// Reporter counts block events in Prometheus metrics by iptables tool, and emits them as Events on the Node.
+type Reporter struct {
+	blocks   *prometheus.CounterVec
+	recorder record.EventRecorder
+	node     *corev1.ObjectReference
+
+	minReadBackoff time.Duration
+	maxReadBackoff time.Duration
+}
+
+// NewReporter creates a Reporter which registers its metrics with registerer. If recorder is not nil,
+// block events are also emitted as Events on node, which must be referenced by UID to show up in kubectl describe.
+func NewReporter(registerer prometheus.Registerer, recorder record.EventRecorder, node *corev1.ObjectReference) (*Reporter, error) {
+	blocks := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "azure_block_iptables_blocked_rules_total",
+		Help: "Number of iptables rules which processes tried to install without being allowed to, by iptables tool. " +
+			"Processes which aren't known iptables tools are counted as comm other. " +
+			"Rules are only counted in audit-only mode, where verdict is audited.",
+	}, []string{"comm", "op", "verdict"})
+	if err := registerer.Register(blocks); err != nil {
+		return nil, errors.Wrap(err, "failed to register metrics")
+	}
+	return &Reporter{
+		blocks:         blocks,
+		recorder:       recorder,
+		node:           node,
+		minReadBackoff: defaultMinReadBackoff,
+		maxReadBackoff: defaultMaxReadBackoff,
+	}, nil
+}
+
+// Report records a block event. The full command names of the processes are only logged and emitted in the Event.
+func (r *Reporter) Report(event *Event) {
+	verdict, reason := "blocked", ReasonBlockedIPTablesRule
+	if event.Audited {
+		verdict, reason = "audited", ReasonAuditedIPTablesRule
+	}
+	r.blocks.WithLabelValues(commLabel(event.Comm), event.Op.String(), verdict).Inc()
+	msg := fmt.Sprintf("Process %s (pid %d), started by %s (pid %d) in cgroup %d, tried to install an iptables rule with %s but is not allowed to",
+		event.Comm, event.PID, event.ParentComm, event.PPID, event.CgroupID, event.Op)
+	log.Printf("%s: %s", reason, msg)
+	if r.recorder != nil {
+		r.recorder.Event(r.node, corev1.EventTypeWarning, reason, msg)
+	}
+}
+
+// Run reports the block events read from source until the Context is closed. After a failed read it backs off
+// before reading again, and it gives up once maxReadFailures reads in a row failed.
+func (r *Reporter) Run(ctx context.Context, source Source) error {
+	go func() {
+		<-ctx.Done()
+		if err := source.Close(); err != nil {
+			log.Printf("Warning: failed to close block event source: %v", err)
+		}
+	}()
+	failures, backoff := 0, r.minReadBackoff
+	for {
+		event, err := source.Read()
+		if err != nil {
+			if errors.Is(err, ErrClosed) {
+				return errors.Wrap(ctx.Err(), "block event reporter stopped")
+			}
+			if failures++; failures >= maxReadFailures {
+				return errors.Wrapf(err, "failed to read %d block events in a row", failures)
+			}
+			log.Printf("Warning: failed to read block event, retrying in %s: %v", backoff, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, r.maxReadBackoff)
+			continue
+		}
+		failures, backoff = 0, r.minReadBackoff
+		r.Report(&event)
+	}
+}
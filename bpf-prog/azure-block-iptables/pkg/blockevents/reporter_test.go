@@ -0,0 +1,168 @@
+package blockevents
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func comm(s string) [taskCommLen]byte {
+	var b [taskCommLen]byte
+	copy(b[:], s)
+	return b
+}
+
+func TestParseEvent(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, binary.Write(&buf, binary.NativeEndian, rawEvent{
+		CgroupID:   1234,
+		PID:        42,
+		PPID:       1,
+		Comm:       comm("iptables"),
+		ParentComm: comm("systemd"),
+		Op:         uint8(OpNftNewRule),
+		Audited:    1,
+	}))
+
+	event, err := ParseEvent(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, Event{
+		PID:        42,
+		PPID:       1,
+		Comm:       "iptables",
+		ParentComm: "systemd",
+		CgroupID:   1234,
+		Op:         OpNftNewRule,
+		Audited:    true,
+	}, event)
+
+	_, err = ParseEvent(buf.Bytes()[:8])
+	require.ErrorIs(t, err, ErrShortRecord)
+}
+
+func TestReport(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	recorder := record.NewFakeRecorder(10)
+	reporter, err := NewReporter(registry, recorder, &corev1.ObjectReference{Kind: "Node", Name: "node"})
+	require.NoError(t, err)
+
+	reporter.Report(&Event{PID: 42, Comm: "iptables", ParentComm: "bash", Op: OpIptSetReplace})
+	reporter.Report(&Event{PID: 42, Comm: "iptables", ParentComm: "bash", Op: OpIptSetReplace})
+	reporter.Report(&Event{PID: 43, Comm: "iptables", ParentComm: "bash", Op: OpNftNewRule, Audited: true})
+	reporter.Report(&Event{PID: 44, Comm: "kube-router-1", ParentComm: "bash", Op: OpNftNewRule})
+
+	assert.InDelta(t, 2, testutil.ToFloat64(reporter.blocks.WithLabelValues("iptables", "ipt_so_set_replace", "blocked")), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(reporter.blocks.WithLabelValues("iptables", "nft_newrule", "audited")), 0)
+	// processes which aren't iptables tools are counted together, but named in the Event.
+	assert.InDelta(t, 1, testutil.ToFloat64(reporter.blocks.WithLabelValues(otherComm, "nft_newrule", "blocked")), 0)
+	require.Len(t, recorder.Events, 4)
+	assert.Contains(t, <-recorder.Events, "Warning "+ReasonBlockedIPTablesRule+" Process iptables (pid 42)")
+	<-recorder.Events
+	assert.Contains(t, <-recorder.Events, "Warning "+ReasonAuditedIPTablesRule)
+	assert.Contains(t, <-recorder.Events, "Process kube-router-1 (pid 44)")
+}
+
+func TestReportWithoutRecorder(t *testing.T) {
+	reporter, err := NewReporter(prometheus.NewRegistry(), nil, nil)
+	require.NoError(t, err)
+	reporter.Report(&Event{Comm: "iptables", Op: OpIptSetReplace})
+	assert.InDelta(t, 1, testutil.ToFloat64(reporter.blocks.WithLabelValues("iptables", "ipt_so_set_replace", "blocked")), 0)
+}
+
+func TestCommLabel(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "iptables", want: "iptables"},
+		{name: "iptables-legacy", want: "iptables-legacy"},
+		{name: "iptables-nft", want: "iptables-nft"},
+		{name: "iptables-restore", want: "iptables-restor"},
+		{name: "iptables-nft-restore", want: "iptables-nft-re"},
+		{name: "iptables-legacy-restore", want: "iptables-legacy"},
+		{name: "ip6tables", want: "ip6tables"},
+		{name: "ip6tables-legacy", want: "ip6tables-legac"},
+		{name: "ip6tables-nft", want: "ip6tables-nft"},
+		{name: "ip6tables-restore", want: "ip6tables-resto"},
+		{name: "ip6tables-nft-restore", want: "ip6tables-nft-r"},
+		{name: "ip6tables-legacy-restore", want: "ip6tables-legac"},
+		{name: "xtables-legacy-multi", want: "xtables-legacy-"},
+		{name: "xtables-nft-multi", want: "xtables-nft-mul"},
+		{name: "nft", want: "nft"},
+		{name: "kube-router", want: otherComm},
+		{name: "iptables-wrapper", want: otherComm},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the kernel keeps the first taskCommLen-1 characters of the command name
+			var c [taskCommLen]byte
+			copy(c[:taskCommLen-1], tt.name)
+			assert.Equal(t, tt.want, commLabel(commString(c)))
+		})
+	}
+}
+
+// fakeSource returns its events and then blocks until closed. If err is set, reads fail with it instead.
+type fakeSource struct {
+	events chan Event
+	closed chan struct{}
+	err    error
+	reads  int
+}
+
+func (s *fakeSource) Read() (Event, error) {
+	s.reads++
+	if s.err != nil {
+		return Event{}, s.err
+	}
+	select {
+	case event := <-s.events:
+		return event, nil
+	case <-s.closed:
+		return Event{}, ErrClosed
+	}
+}
+
+func (s *fakeSource) Close() error {
+	close(s.closed)
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	reporter, err := NewReporter(prometheus.NewRegistry(), nil, nil)
+	require.NoError(t, err)
+	source := &fakeSource{events: make(chan Event), closed: make(chan struct{})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- reporter.Run(ctx, source) }()
+
+	source.events <- Event{Comm: "iptables", Op: OpIptSetReplace}
+	source.events <- Event{Comm: "iptables", Op: OpIptSetReplace}
+	cancel()
+
+	require.ErrorIs(t, <-done, context.Canceled)
+	assert.InDelta(t, 2, testutil.ToFloat64(reporter.blocks.WithLabelValues("iptables", "ipt_so_set_replace", "blocked")), 0)
+}
+
+func TestRunGivesUpOnReadFailures(t *testing.T) {
+	reporter, err := NewReporter(prometheus.NewRegistry(), nil, nil)
+	require.NoError(t, err)
+	reporter.minReadBackoff, reporter.maxReadBackoff = time.Millisecond, 2*time.Millisecond
+	errRead := errors.New("ring buffer broken")
+	source := &fakeSource{closed: make(chan struct{}), err: errRead}
+
+	err = reporter.Run(context.Background(), source)
+	require.ErrorIs(t, err, errRead)
+	assert.Equal(t, maxReadFailures, source.reads)
+}
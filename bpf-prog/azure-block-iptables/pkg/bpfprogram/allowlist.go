@@ -0,0 +1,106 @@
+package bpfprogram
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// taskCommLen is the length of the command names of tasks in the kernel, including the terminating NUL.
+	taskCommLen = 16
+	// MaxAllowlistEntries is the maximum number of each kind of entry in the allowlist.
+	MaxAllowlistEntries = 256
+)
+
+var (
+	ErrInvalidCommPrefix = errors.New("comm prefixes must be 1 to 15 characters")
+	ErrRelativePath      = errors.New("paths must be absolute")
+	ErrTooManyEntries    = errors.Errorf("the allowlist may have at most %d entries of each kind", MaxAllowlistEntries)
+)
+
+// Allowlist configures which processes may install iptables rules in the host network namespace.
+// It is read from a YAML or JSON file, which can be mounted from a ConfigMap.
+type Allowlist struct {
+	// CommPrefixes allow processes whose parent's command name starts with any of them.
+	CommPrefixes []string `json:"commPrefixes,omitempty"`
+	// ExecutablePaths allow processes whose parent runs any of these executables. The executables are matched by
+	// their inode, so the paths only need to point to the same files as on the host, e.g. through a hostPath mount.
+	ExecutablePaths []string `json:"executablePaths,omitempty"`
+	// CgroupIDs allow processes in any of these cgroup v2 cgroups.
+	CgroupIDs []uint64 `json:"cgroupIDs,omitempty"`
+	// CgroupPaths allow processes in any of these cgroup v2 cgroups, e.g. /sys/fs/cgroup/system.slice/kubelet.service.
+	CgroupPaths []string `json:"cgroupPaths,omitempty"`
+	// AuditOnly counts the rules which would be blocked, without blocking them.
+	AuditOnly bool `json:"auditOnly,omitempty"`
+}
+
+// DefaultAllowlist returns the allowlist used when none is configured.
+func DefaultAllowlist() *Allowlist {
+	return &Allowlist{
+		CommPrefixes: []string{
+			"cilium-agent",
+			"ip-masq",
+			"azure-cns",
+			"install-cni", // istio
+			"nfs",         // nfsv3mountscript, nfsv4mountscript
+			"python",      // this allows all python processes including waagent. Will narrow down in the future.
+		},
+	}
+}
+
+// LoadAllowlist reads the allowlist from the YAML or JSON file at path.
+func LoadAllowlist(path string) (*Allowlist, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read allowlist %s", path)
+	}
+	allowlist := &Allowlist{}
+	if err := yaml.UnmarshalStrict(b, allowlist); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse allowlist %s", path)
+	}
+	if err := allowlist.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "invalid allowlist %s", path)
+	}
+	return allowlist, nil
+}
+
+// Validate returns an error if the allowlist can't be loaded into the BPF maps.
+func (a *Allowlist) Validate() error {
+	if len(a.CommPrefixes) > MaxAllowlistEntries || len(a.ExecutablePaths) > MaxAllowlistEntries ||
+		len(a.CgroupIDs)+len(a.CgroupPaths) > MaxAllowlistEntries {
+		return ErrTooManyEntries
+	}
+	for _, prefix := range a.CommPrefixes {
+		if prefix == "" || len(prefix) >= taskCommLen {
+			return errors.Wrapf(ErrInvalidCommPrefix, "invalid comm prefix %q", prefix)
+		}
+	}
+	for _, path := range append(append([]string{}, a.ExecutablePaths...), a.CgroupPaths...) {
+		if !filepath.IsAbs(path) {
+			return errors.Wrapf(ErrRelativePath, "invalid path %q", path)
+		}
+	}
+	return nil
+}
+
+// commKey is a prefix of a command name in the iptables_block_allow_comm LPM trie.
+type commKey struct {
+	Prefixlen uint32 // in bits
+	Comm      [taskCommLen]byte
+}
+
+func newCommKey(prefix string) commKey {
+	key := commKey{Prefixlen: uint32(len(prefix) * 8)} //nolint:gosec // prefixes are validated to be shorter than taskCommLen
+	copy(key.Comm[:], prefix)
+	return key
+}
+
+// exeKey identifies an executable by its inode in the iptables_block_allow_exe map.
+type exeKey struct {
+	Ino uint64
+	Dev uint32 // encoded as in the kernel
+	Pad uint32
+}
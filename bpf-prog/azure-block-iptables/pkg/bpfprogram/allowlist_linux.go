@@ -0,0 +1,45 @@
+//go:build linux
+// +build linux
+
+package bpfprogram
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// allowlistKeys are the keys of the allowlist in the BPF maps.
+type allowlistKeys struct {
+	comms     []commKey
+	exes      []exeKey
+	cgroupIDs []uint64
+}
+
+// keys resolves the executables and cgroups of the allowlist to the keys of the BPF maps.
+func (a *Allowlist) keys() (*allowlistKeys, error) {
+	keys := &allowlistKeys{cgroupIDs: append([]uint64{}, a.CgroupIDs...)}
+	for _, prefix := range a.CommPrefixes {
+		keys.comms = append(keys.comms, newCommKey(prefix))
+	}
+	for _, path := range a.ExecutablePaths {
+		var stat unix.Stat_t
+		if err := unix.Stat(path, &stat); err != nil {
+			return nil, errors.Wrapf(err, "failed to stat executable %s", path)
+		}
+		keys.exes = append(keys.exes, exeKey{Ino: stat.Ino, Dev: kernelDev(stat.Dev)})
+	}
+	for _, path := range a.CgroupPaths {
+		// the ID of a cgroup v2 cgroup is the inode of its directory.
+		var stat unix.Stat_t
+		if err := unix.Stat(path, &stat); err != nil {
+			return nil, errors.Wrapf(err, "failed to stat cgroup %s", path)
+		}
+		keys.cgroupIDs = append(keys.cgroupIDs, stat.Ino)
+	}
+	return keys, nil
+}
+
+// kernelDev encodes a device number from stat as the kernel does in struct super_block.
+func kernelDev(dev uint64) uint32 {
+	return unix.Major(dev)<<20 | unix.Minor(dev)
+}
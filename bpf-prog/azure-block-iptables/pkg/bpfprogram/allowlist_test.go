@@ -0,0 +1,80 @@
+//go:build linux
+// +build linux
+
+package bpfprogram
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func writeAllowlist(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "allowlist.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadAllowlist(t *testing.T) {
+	allowlist, err := LoadAllowlist(writeAllowlist(t, `
+commPrefixes: [cilium-agent, my-agent]
+executablePaths: [/usr/bin/my-agent]
+cgroupIDs: [1234]
+cgroupPaths: [/sys/fs/cgroup/system.slice/my-agent.service]
+auditOnly: true
+`))
+	require.NoError(t, err)
+	assert.Equal(t, &Allowlist{
+		CommPrefixes:    []string{"cilium-agent", "my-agent"},
+		ExecutablePaths: []string{"/usr/bin/my-agent"},
+		CgroupIDs:       []uint64{1234},
+		CgroupPaths:     []string{"/sys/fs/cgroup/system.slice/my-agent.service"},
+		AuditOnly:       true,
+	}, allowlist)
+
+	_, err = LoadAllowlist(writeAllowlist(t, `comms: [my-agent]`))
+	require.Error(t, err, "unknown fields are rejected")
+
+	_, err = LoadAllowlist(writeAllowlist(t, `commPrefixes: [a-very-long-agent-name]`))
+	require.ErrorIs(t, err, ErrInvalidCommPrefix)
+
+	_, err = LoadAllowlist(writeAllowlist(t, `executablePaths: [bin/my-agent]`))
+	require.ErrorIs(t, err, ErrRelativePath)
+}
+
+func TestDefaultAllowlist(t *testing.T) {
+	require.NoError(t, DefaultAllowlist().Validate())
+}
+
+func TestAllowlistKeys(t *testing.T) {
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "my-agent")
+	require.NoError(t, os.WriteFile(exe, nil, 0o700))
+	var exeStat, dirStat unix.Stat_t
+	require.NoError(t, unix.Stat(exe, &exeStat))
+	require.NoError(t, unix.Stat(dir, &dirStat))
+
+	allowlist := &Allowlist{
+		CommPrefixes:    []string{"nfs"},
+		ExecutablePaths: []string{exe},
+		CgroupIDs:       []uint64{1234},
+		CgroupPaths:     []string{dir},
+	}
+	keys, err := allowlist.keys()
+	require.NoError(t, err)
+
+	comm := commKey{Prefixlen: 24}
+	copy(comm.Comm[:], "nfs")
+	assert.Equal(t, []commKey{comm}, keys.comms)
+	assert.Equal(t, []exeKey{{Ino: exeStat.Ino, Dev: unix.Major(exeStat.Dev)<<20 | unix.Minor(exeStat.Dev)}}, keys.exes)
+	assert.Equal(t, []uint64{1234, dirStat.Ino}, keys.cgroupIDs)
+
+	allowlist.ExecutablePaths = []string{filepath.Join(dir, "missing")}
+	_, err = allowlist.keys()
+	require.Error(t, err)
+}
@@ -9,6 +9,9 @@ type Attacher interface {
 	// Unpins the links and maps (causes detachment)
 	Detach() error
 
+	// UpdateAllowlist replaces the allowlist of the attached BPF program
+	UpdateAllowlist(*Allowlist) error
+
 	// IsAttached returns true if the BPF program is currently attached
 	IsAttached() bool
 
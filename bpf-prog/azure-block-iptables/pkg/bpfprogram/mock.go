@@ -9,6 +9,7 @@ type MockProgram struct {
 	detachError  error
 	attachCalled int
 	detachCalled int
+	allowlist    *Allowlist
 }
 
 // NewMockProgram creates a new mock BPF program manager instance.
@@ -43,6 +44,12 @@ func (m *MockProgram) Reset() {
 	m.detachError = nil
 	m.attachCalled = 0
 	m.detachCalled = 0
+	m.allowlist = nil
+}
+
+// Allowlist returns the allowlist passed to the last UpdateAllowlist() call.
+func (m *MockProgram) Allowlist() *Allowlist {
+	return m.allowlist
 }
 
 // Attach simulates attaching the BPF program.
@@ -83,6 +90,12 @@ func (m *MockProgram) Detach() error {
 	return nil
 }
 
+// UpdateAllowlist simulates replacing the allowlist of the BPF program.
+func (m *MockProgram) UpdateAllowlist(allowlist *Allowlist) error {
+	m.allowlist = allowlist
+	return nil
+}
+
 // IsAttached returns the mock's attached state.
 func (m *MockProgram) IsAttached() bool {
 	return m.attached
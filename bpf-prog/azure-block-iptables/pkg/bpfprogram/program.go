@@ -21,6 +21,16 @@ const (
 	BPFMapPinPath = "/sys/fs/bpf/azure-block-iptables"
 	// EventCounterMapName is the name used for pinning the event counter map
 	EventCounterMapName = "iptables_block_event_counter"
+	// AllowCommMapName is the name used for pinning the map of allowed command name prefixes
+	AllowCommMapName = "iptables_block_allow_comm"
+	// AllowCgroupMapName is the name used for pinning the map of allowed cgroup IDs
+	AllowCgroupMapName = "iptables_block_allow_cgroup"
+	// AllowExeMapName is the name used for pinning the map of allowed executables
+	AllowExeMapName = "iptables_block_allow_exe"
+	// ConfigMapName is the name used for pinning the config map
+	ConfigMapName = "iptables_block_config"
+	// BlockEventsMapName is the name used for pinning the ring buffer of block events
+	BlockEventsMapName = "iptables_block_events"
 	// IptablesLegacyBlockProgramName is the name used for pinning the legacy iptables block program
 	IptablesLegacyBlockProgramName = "iptables_legacy_block"
 	// IptablesNftablesBlockProgramName is the name used for pinning the nftables block program
@@ -31,16 +41,20 @@ const (
 
 var ErrEventCounterMapNotLoaded = errors.New("event counter map not loaded")
 
+// allowlistMapNames are the names of the maps which hold the allowlist and the config of the program.
+var allowlistMapNames = []string{AllowCommMapName, AllowCgroupMapName, AllowExeMapName, ConfigMapName}
+
 // Program implements the Manager interface for real BPF program operations.
 type Program struct {
-	objs     *blockservice.BlockIptablesObjects
-	links    []link.Link
-	attached bool
+	objs      *blockservice.BlockIptablesObjects
+	links     []link.Link
+	attached  bool
+	allowlist *Allowlist
 }
 
-// NewProgram creates a new BPF program manager instance.
-func NewProgram() Attacher {
-	return &Program{}
+// NewProgram creates a new BPF program manager instance which allows the processes in allowlist to install iptables rules.
+func NewProgram(allowlist *Allowlist) Attacher {
+	return &Program{allowlist: allowlist}
 }
 
 // CreatePinPath ensures the BPF map pin directory exists.
@@ -80,6 +94,102 @@ func (p *Program) unpinEventCounterMap() error {
 	return nil
 }
 
+// unpinMaps unpins the maps of the allowlist, the config and the block events from the filesystem
+func (p *Program) unpinMaps() error {
+	var errs []error
+	for _, name := range append(append([]string{}, allowlistMapNames...), BlockEventsMapName) {
+		pinPath := filepath.Join(BPFMapPinPath, name)
+		if err := os.Remove(pinPath); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, errors.Wrapf(err, "failed to remove pinned map %s", pinPath))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Errorf("failed to unpin maps: %v", errs)
+	}
+
+	log.Println("Allowlist and block events maps unpinned")
+	return nil
+}
+
+// UpdateAllowlist replaces the allowlist of the attached program, which is read from its pinned maps.
+func (p *Program) UpdateAllowlist(allowlist *Allowlist) error {
+	maps := make([]*ebpf.Map, len(allowlistMapNames))
+	for i, name := range allowlistMapNames {
+		m, err := ebpf.LoadPinnedMap(filepath.Join(BPFMapPinPath, name), nil)
+		if err != nil {
+			return errors.Wrapf(err, "failed to load pinned map %s, is the program attached?", name)
+		}
+		defer m.Close()
+		maps[i] = m
+	}
+	if err := updateAllowlistMaps(maps[0], maps[1], maps[2], maps[3], allowlist); err != nil {
+		return err
+	}
+	p.allowlist = allowlist
+	return nil
+}
+
+// updateAllowlistMaps writes the allowlist to the maps of the program.
+func updateAllowlistMaps(comms, cgroups, exes, config *ebpf.Map, allowlist *Allowlist) error {
+	keys, err := allowlist.keys()
+	if err != nil {
+		return errors.Wrap(err, "failed to resolve allowlist")
+	}
+	if err := replaceKeys(comms, keys.comms); err != nil {
+		return errors.Wrap(err, "failed to update allowed comm prefixes")
+	}
+	if err := replaceKeys(cgroups, keys.cgroupIDs); err != nil {
+		return errors.Wrap(err, "failed to update allowed cgroups")
+	}
+	if err := replaceKeys(exes, keys.exes); err != nil {
+		return errors.Wrap(err, "failed to update allowed executables")
+	}
+	var auditOnly uint32
+	if allowlist.AuditOnly {
+		auditOnly = 1
+	}
+	if err := config.Put(uint32(0), auditOnly); err != nil {
+		return errors.Wrap(err, "failed to update config")
+	}
+
+	log.Printf("Allowlist updated: %d comm prefixes, %d cgroups, %d executables, audit only: %t",
+		len(keys.comms), len(keys.cgroupIDs), len(keys.exes), allowlist.AuditOnly)
+	return nil
+}
+
+// replaceKeys makes keys the only keys of the map. The new keys are added before the stale keys are
+// deleted, so that processes which stay allowed are never blocked while the allowlist is replaced.
+func replaceKeys[K comparable](m *ebpf.Map, keys []K) error {
+	want := make(map[K]struct{}, len(keys))
+	for _, key := range keys {
+		want[key] = struct{}{}
+		if err := m.Put(key, uint8(1)); err != nil {
+			return errors.Wrapf(err, "failed to put %v", key)
+		}
+	}
+
+	var (
+		key   K
+		value uint8
+		stale []K
+	)
+	iter := m.Iterate()
+	for iter.Next(&key, &value) {
+		if _, ok := want[key]; !ok {
+			stale = append(stale, key)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return errors.Wrap(err, "failed to iterate map")
+	}
+	for _, key := range stale {
+		if err := m.Delete(key); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+			return errors.Wrapf(err, "failed to delete %v", key)
+		}
+	}
+	return nil
+}
+
 // unpinLinks unpins the links to BPF programs from the filesystem
 func (p *Program) unpinLinks() error {
 	var errs []error
@@ -168,6 +278,18 @@ func (p *Program) Attach() error {
 	}
 	p.objs = objs
 
+	// Populate the allowlist before attaching, so that allowed processes are never blocked
+	allowlist := p.allowlist
+	if allowlist == nil {
+		allowlist = DefaultAllowlist()
+	}
+	if err = updateAllowlistMaps(objs.IptablesBlockAllowComm, objs.IptablesBlockAllowCgroup, objs.IptablesBlockAllowExe,
+		objs.IptablesBlockConfig, allowlist); err != nil {
+		p.objs.Close()
+		p.objs = nil
+		return errors.Wrap(err, "failed to populate allowlist")
+	}
+
 	// Pin the event counter map to filesystem
 	if err = p.pinEventCounterMap(); err != nil {
 		return errors.Wrap(err, "failed to pin event counter map")
@@ -251,6 +373,11 @@ func (p *Program) cleanupPinnedResources() error {
 		log.Printf("Warning: failed to unpin event counter map: %v", err)
 	}
 
+	// Try to unpin the allowlist and block events maps
+	if err := p.unpinMaps(); err != nil {
+		log.Printf("Warning: failed to unpin maps: %v", err)
+	}
+
 	log.Println("Pinned resources cleanup completed")
 	return nil
 }
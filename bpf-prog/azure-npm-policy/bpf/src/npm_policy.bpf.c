@@ -0,0 +1,307 @@
+//go:build ignore
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+// tc programs for NPM's eBPF policy mode. NPM loads the compiled object at runtime
+// (see npm/pkg/dataplane/bpfpolicy) and attaches both programs to the host side veth of each selected Pod:
+// - npm_from_pod on tc ingress evaluates the egress rules of the packet's source endpoint
+// - npm_to_pod on tc egress evaluates the ingress rules of the packet's destination endpoint
+//
+// Struct layouts and limits must match npm/pkg/dataplane/bpfpolicy.
+
+#include <linux/bpf.h>
+#include <linux/pkt_cls.h>
+#include <linux/if_ether.h>
+#include <linux/ip.h>
+#include <linux/in.h>
+#include <bpf/bpf_helpers.h>
+#include <bpf/bpf_endian.h>
+#include <stdbool.h>
+#include <stddef.h>
+
+#define MAX_RULES_PER_DIRECTION 64
+#define MAX_SETS_PER_RULE 8
+#define MAX_ENDPOINTS 1024
+#define MAX_RULES (MAX_ENDPOINTS * MAX_RULES_PER_DIRECTION)
+#define MAX_SET_MEMBERS 262144
+#define MAX_FLOWS 65536
+#define MAX_HOST_IPS 64
+
+#define DIRECTION_INGRESS 0
+#define DIRECTION_EGRESS 1
+
+#define TARGET_ALLOW 1
+#define TARGET_DROP 2
+
+#define SET_KIND_HASH 1
+#define SET_KIND_CIDR 2
+#define SET_KIND_NAMED_PORT 3
+
+#define MATCH_SRC 0
+#define MATCH_DST 1
+
+// the set id is part of every LPM key, so it is always matched in full
+#define CIDR_KEY_SET_ID_BITS 32
+
+char __license[] SEC("license") = "Dual MIT/GPL";
+
+struct endpoint_value {
+    __u32 num_rules[2]; // indexed by direction
+};
+
+struct rule_key {
+    __u32 endpoint_ip;
+    __u32 direction;
+    __u32 index;
+};
+
+struct set_match {
+    __u32 set_id;
+    __u8 kind;
+    __u8 included;
+    __u8 match;
+    __u8 pad;
+};
+
+struct rule {
+    __u8 target;
+    __u8 protocol; // 0 matches any protocol
+    __u16 port_start; // host byte order. 0 matches any port
+    __u16 port_end;
+    __u8 num_sets;
+    __u8 pad;
+    struct set_match sets[MAX_SETS_PER_RULE];
+};
+
+struct hash_set_key {
+    __u32 set_id;
+    __u32 ip;
+};
+
+struct cidr_set_key {
+    __u32 prefixlen;
+    __u32 set_id;
+    __u32 ip;
+};
+
+struct named_port_key {
+    __u32 set_id;
+    __u32 ip;
+    __u16 port; // host byte order
+    __u8 protocol;
+    __u8 pad;
+};
+
+struct flow_key {
+    __u32 saddr;
+    __u32 daddr;
+    __u16 sport;
+    __u16 dport;
+    __u8 protocol;
+    __u8 hook;
+    __u16 pad;
+};
+
+struct packet {
+    __u32 saddr;
+    __u32 daddr;
+    __u16 sport; // host byte order
+    __u16 dport; // host byte order
+    __u8 protocol;
+};
+
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, MAX_ENDPOINTS);
+    __type(key, __u32);
+    __type(value, struct endpoint_value);
+} npm_endpoints SEC(".maps");
+
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, MAX_RULES);
+    __type(key, struct rule_key);
+    __type(value, struct rule);
+} npm_rules SEC(".maps");
+
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, MAX_SET_MEMBERS);
+    __type(key, struct hash_set_key);
+    __type(value, __u8);
+} npm_hash_sets SEC(".maps");
+
+struct {
+    __uint(type, BPF_MAP_TYPE_LPM_TRIE);
+    __uint(max_entries, MAX_SET_MEMBERS);
+    __uint(map_flags, BPF_F_NO_PREALLOC);
+    __type(key, struct cidr_set_key);
+    __type(value, __u8); // 1 for a match, 0 for nomatch
+} npm_cidr_sets SEC(".maps");
+
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, MAX_SET_MEMBERS);
+    __type(key, struct named_port_key);
+    __type(value, __u8);
+} npm_named_port_sets SEC(".maps");
+
+// node IPs are exempt like in iptables mode, where NPM only filters forwarded traffic
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, MAX_HOST_IPS);
+    __type(key, __u32);
+    __type(value, __u8);
+} npm_host_ips SEC(".maps");
+
+// allowed connections, so that replies and later packets skip evaluation like with conntrack in iptables mode
+struct {
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __uint(max_entries, MAX_FLOWS);
+    __type(key, struct flow_key);
+    __type(value, __u8);
+} npm_flows SEC(".maps");
+
+static __always_inline bool parse_packet(struct __sk_buff *skb, struct packet *pkt)
+{
+    void *data = (void *)(long)skb->data;
+    void *data_end = (void *)(long)skb->data_end;
+
+    struct ethhdr *eth = data;
+    if ((void *)(eth + 1) > data_end || eth->h_proto != bpf_htons(ETH_P_IP))
+        return false;
+
+    struct iphdr *ip = (void *)(eth + 1);
+    if ((void *)(ip + 1) > data_end || ip->ihl < 5)
+        return false;
+
+    pkt->saddr = ip->saddr;
+    pkt->daddr = ip->daddr;
+    pkt->protocol = ip->protocol;
+    pkt->sport = 0;
+    pkt->dport = 0;
+
+    // ports of non-first fragments are unknown, so only the first fragment can match a port
+    if (ip->frag_off & bpf_htons(0x1fff))
+        return true;
+
+    if (ip->protocol == IPPROTO_TCP || ip->protocol == IPPROTO_UDP || ip->protocol == IPPROTO_SCTP) {
+        __u16 *ports = (void *)ip + ip->ihl * 4;
+        if ((void *)(ports + 2) > data_end)
+            return true;
+        pkt->sport = bpf_ntohs(ports[0]);
+        pkt->dport = bpf_ntohs(ports[1]);
+    }
+    return true;
+}
+
+static __always_inline bool set_contains(const struct set_match *m, const struct packet *pkt)
+{
+    __u32 ip = m->match == MATCH_SRC ? pkt->saddr : pkt->daddr;
+
+    if (m->kind == SET_KIND_HASH) {
+        struct hash_set_key key = {.set_id = m->set_id, .ip = ip};
+        return bpf_map_lookup_elem(&npm_hash_sets, &key) != NULL;
+    }
+    if (m->kind == SET_KIND_CIDR) {
+        struct cidr_set_key key = {.prefixlen = CIDR_KEY_SET_ID_BITS + 32, .set_id = m->set_id, .ip = ip};
+        __u8 *matched = bpf_map_lookup_elem(&npm_cidr_sets, &key);
+        return matched && *matched;
+    }
+    if (m->kind == SET_KIND_NAMED_PORT) {
+        struct named_port_key key = {.set_id = m->set_id, .ip = pkt->daddr, .port = pkt->dport, .protocol = pkt->protocol};
+        return bpf_map_lookup_elem(&npm_named_port_sets, &key) != NULL;
+    }
+    return false;
+}
+
+static __always_inline bool rule_matches(const struct rule *r, const struct packet *pkt)
+{
+    if (r->protocol && r->protocol != pkt->protocol)
+        return false;
+    if (r->port_start && (pkt->dport < r->port_start || pkt->dport > r->port_end))
+        return false;
+
+    for (int i = 0; i < MAX_SETS_PER_RULE; i++) {
+        if (i >= r->num_sets)
+            break;
+        if (set_contains(&r->sets[i], pkt) != (bool)r->sets[i].included)
+            return false;
+    }
+    return true;
+}
+
+// Allow rules of any policy override drop rules, just like NPM's iptables chains.
+static __always_inline bool allowed(__u32 endpoint_ip, __u32 direction, const struct packet *pkt)
+{
+    struct endpoint_value *ep = bpf_map_lookup_elem(&npm_endpoints, &endpoint_ip);
+    if (!ep)
+        return true;
+
+    __u32 num_rules = ep->num_rules[direction & 1];
+    bool dropped = false;
+    for (__u32 i = 0; i < MAX_RULES_PER_DIRECTION; i++) {
+        if (i >= num_rules)
+            break;
+        struct rule_key key = {.endpoint_ip = endpoint_ip, .direction = direction, .index = i};
+        struct rule *r = bpf_map_lookup_elem(&npm_rules, &key);
+        if (!r || !rule_matches(r, pkt))
+            continue;
+        if (r->target == TARGET_ALLOW)
+            return true;
+        dropped = true;
+    }
+    return !dropped;
+}
+
+static __always_inline void track_flow(const struct packet *pkt, __u8 hook, __u8 reply_hook)
+{
+    __u8 one = 1;
+    struct flow_key forward = {.saddr = pkt->saddr, .daddr = pkt->daddr, .sport = pkt->sport, .dport = pkt->dport, .protocol = pkt->protocol, .hook = hook};
+    struct flow_key reply = {.saddr = pkt->daddr, .daddr = pkt->saddr, .sport = pkt->dport, .dport = pkt->sport, .protocol = pkt->protocol, .hook = reply_hook};
+    bpf_map_update_elem(&npm_flows, &forward, &one, BPF_ANY);
+    bpf_map_update_elem(&npm_flows, &reply, &one, BPF_ANY);
+}
+
+static __always_inline int evaluate(struct __sk_buff *skb, __u32 direction)
+{
+    struct packet pkt;
+    if (!parse_packet(skb, &pkt))
+        return TC_ACT_OK;
+
+    __u32 endpoint_ip = direction == DIRECTION_INGRESS ? pkt.daddr : pkt.saddr;
+    __u32 peer_ip = direction == DIRECTION_INGRESS ? pkt.saddr : pkt.daddr;
+    if (bpf_map_lookup_elem(&npm_host_ips, &peer_ip))
+        return TC_ACT_OK;
+
+    // the hook is part of the flow key so that a flow allowed by a local sender is still evaluated for a local receiver
+    struct flow_key key = {.saddr = pkt.saddr, .daddr = pkt.daddr, .sport = pkt.sport, .dport = pkt.dport, .protocol = pkt.protocol, .hook = direction};
+    if (bpf_map_lookup_elem(&npm_flows, &key))
+        return TC_ACT_OK;
+
+    if (!bpf_map_lookup_elem(&npm_endpoints, &endpoint_ip))
+        return TC_ACT_OK;
+
+    if (!allowed(endpoint_ip, direction, &pkt)) {
+#ifdef DEBUG
+        bpf_printk("npm dropped packet. direction: %u saddr: %pI4 daddr: %pI4", direction, &pkt.saddr, &pkt.daddr);
+#endif
+        return TC_ACT_SHOT;
+    }
+
+    track_flow(&pkt, direction, direction == DIRECTION_INGRESS ? DIRECTION_EGRESS : DIRECTION_INGRESS);
+    return TC_ACT_OK;
+}
+
+SEC("classifier")
+int npm_to_pod(struct __sk_buff *skb)
+{
+    return evaluate(skb, DIRECTION_INGRESS);
+}
+
+SEC("classifier")
+int npm_from_pod(struct __sk_buff *skb)
+{
+    return evaluate(skb, DIRECTION_EGRESS);
+}
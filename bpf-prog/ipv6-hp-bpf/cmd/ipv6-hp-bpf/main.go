@@ -2,91 +2,190 @@ package main
 
 import (
 	"bytes"
-	"net"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
 	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"github.com/Azure/azure-container-networking/bpf-prog/ipv6-hp-bpf/pkg/egress"
-	"github.com/Azure/azure-container-networking/bpf-prog/ipv6-hp-bpf/pkg/ingress"
-	"github.com/vishvananda/netlink"
-
+	"github.com/Azure/azure-container-networking/bpf-prog/ipv6-hp-bpf/pkg/bpfprogram"
+	"github.com/Azure/azure-container-networking/bpf-prog/ipv6-hp-bpf/pkg/metrics"
+	"github.com/Azure/azure-container-networking/bpf-prog/ipv6-hp-bpf/pkg/rewrite"
 	"github.com/cilium/ebpf/rlimit"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 )
 
+const (
+	// ModeAttach attaches the programs and exits, leaving them attached
+	ModeAttach = "attach"
+	// ModeDetach detaches the programs and unpins their maps
+	ModeDetach = "detach"
+	// ModeDaemon attaches the programs, serves their counters as metrics and reloads the config on SIGHUP
+	ModeDaemon = "daemon"
+)
+
+var ErrUnknownMode = errors.New("unknown mode")
+
 var logger *zap.Logger
 
+// Config is the configuration of the command, from its flags
+type Config struct {
+	Mode           string
+	ConfigPath     string
+	PinPath        string
+	MetricsAddress string
+}
+
 func main() {
 	// Set up logger
 	config := zap.NewProductionConfig()
 	config.OutputPaths = []string{"stdout", "/var/log/azure-ipv6-hp-bpf.log"}
 	logger, _ = config.Build()
 
+	cfg := Config{}
+	flag.StringVar(&cfg.Mode, "mode", ModeAttach, "Mode: attach, detach or daemon")
+	flag.StringVar(&cfg.ConfigPath, "config", "", "Path to the YAML or JSON config of the interfaces and addresses to rewrite. "+
+		"Defaults to the Azure load balancer health probe address on eth0")
+	flag.StringVar(&cfg.PinPath, "pin-path", bpfprogram.DefaultPinPath, "Path to pin the BPF maps under. Empty to not pin them")
+	flag.StringVar(&cfg.MetricsAddress, "metrics-address", ":9102", "Address to serve the metrics on, in daemon mode")
+	flag.Parse()
+
+	if err := run(cfg); err != nil {
+		logger.Error("Failed", zap.String("mode", cfg.Mode), zap.Error(err))
+		os.Exit(1)
+	}
+}
+
+func run(cfg Config) error {
+	rewrites, err := loadConfig(cfg.ConfigPath)
+	if err != nil {
+		return err
+	}
+
+	switch cfg.Mode {
+	case ModeAttach:
+		p, err := attach(cfg, rewrites)
+		if err != nil {
+			return err
+		}
+		return p.Close()
+	case ModeDetach:
+		return bpfprogram.Detach(rewrites, cfg.PinPath, logger)
+	case ModeDaemon:
+		return daemon(cfg, rewrites)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownMode, cfg.Mode)
+	}
+}
+
+func loadConfig(path string) (*rewrite.Config, error) {
+	if path == "" {
+		return rewrite.Default(), nil
+	}
+	return rewrite.Load(path)
+}
+
+// attach replaces the nftables rules of the health probes with the programs, and attaches them
+func attach(cfg Config, rewrites *rewrite.Config) (*bpfprogram.Program, error) {
 	// Remove resource limits for kernels <5.11.
 	if err := rlimit.RemoveMemlock(); err != nil {
-		logger.Error("Removing memlock", zap.Error(err))
-		return
+		return nil, fmt.Errorf("failed to remove memlock: %w", err)
+	}
+
+	if err := deleteNftablesProbeTable(); err != nil {
+		return nil, err
+	}
+
+	// Load the compiled eBPF ELF and load it into the kernel.
+	p, err := bpfprogram.Load(cfg.PinPath, logger)
+	if err != nil {
+		return nil, err
 	}
+	if err := p.Attach(rewrites); err != nil {
+		p.Close()
+		return nil, err
+	}
+	logger.Info("Attached programs", zap.Strings("interfaces", rewrites.Interfaces), zap.Bool("pinned", p.Pinned()))
+	return p, nil
+}
 
+// deleteNftablesProbeTable deletes the azureSLBProbe table, whose rules don't work on cilium clusters
+func deleteNftablesProbeTable() error {
 	// Check 'nft -n list tables ip6' to see if table exists
 	cmd := exec.Command("nft", "-n", "list", "tables", "ip6")
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		logger.Error("error running 'nft -n list tables ip6'", zap.Error(err), zap.String("output", string(output)))
-		return
+		return fmt.Errorf("error running 'nft -n list tables ip6': %w: %s", err, output)
 	}
 
 	// if azureSLBProbe table exists, delete it
 	if bytes.Contains(output, []byte("azureSLBProbe")) {
 		cmd := exec.Command("nft", "delete", "table", "ip6", "azureSLBProbe")
-		err = cmd.Run()
-		if err != nil {
-			logger.Error("failed to run 'nft delete table ip6 azureSLBProbe'", zap.Error(err))
-			return
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to run 'nft delete table ip6 azureSLBProbe': %w", err)
 		}
 	}
+	return nil
+}
 
-	ifname := "eth0"
-	iface, err := net.InterfaceByName(ifname)
+// daemon attaches the programs and serves their counters until it is terminated, reloading the config on SIGHUP.
+// The programs stay attached when it exits.
+func daemon(cfg Config, rewrites *rewrite.Config) error {
+	p, err := attach(cfg, rewrites)
 	if err != nil {
-		logger.Error("Getting interface", zap.String("interface", ifname), zap.Error(err))
-	}
-	logger.Info("Interface has index", zap.String("interface", ifname), zap.Int("index", iface.Index))
-
-	// Create a qdisc filter for traffic on the interface.
-	fq := &netlink.GenericQdisc{
-		QdiscAttrs: netlink.QdiscAttrs{
-			LinkIndex: iface.Index,
-			Handle:    netlink.MakeHandle(0xffff, 0),
-			Parent:    netlink.HANDLE_CLSACT,
-		},
-		QdiscType: "clsact",
-	}
-	if err := netlink.QdiscReplace(fq); err != nil {
-		logger.Error("failed setting egress qdisc", zap.Error(err))
-		return
+		return err
 	}
+	defer p.Close()
 
-	// Load the compiled eBPF ELF and load it into the kernel.
-	// Set up ingress and egress filters to attach to eth0 clsact qdisc
-	var objsEgress egress.EgressObjects
-	defer objsEgress.Close()
-	if err := egress.LoadEgressObjects(&objsEgress, nil); err != nil {
-		logger.Error("Failed to load eBPF egress objects", zap.Error(err))
-	}
-	if err := egress.SetupEgressFilter(iface.Index, &objsEgress, logger); err != nil {
-		logger.Error("Setting up egress filter", zap.Error(err))
-	} else {
-		logger.Info("Successfully set egress filter on", zap.String("interface", ifname))
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metrics.NewCollector(p.Counters, logger))
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	server := &http.Server{
+		Addr:              cfg.MetricsAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
 	}
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("Serving metrics", zap.String("address", cfg.MetricsAddress))
+		serverErr <- server.ListenAndServe()
+	}()
 
-	var objsIngress ingress.IngressObjects
-	if err := ingress.LoadIngressObjects(&objsIngress, nil); err != nil {
-		logger.Error("Loading eBPF ingress objects", zap.Error(err))
-	}
-	defer objsIngress.Close()
-	if err := ingress.SetupIngressFilter(iface.Index, &objsIngress, logger); err != nil {
-		logger.Error("Setting up ingress filter", zap.Error(err))
-	} else {
-		logger.Info("Successfully set ingress filter on", zap.String("interface", ifname))
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Exiting, leaving the programs attached")
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			return server.Shutdown(shutdownCtx)
+		case err := <-serverErr:
+			return fmt.Errorf("metrics server failed: %w", err)
+		case <-reload:
+			logger.Info("Reloading config", zap.String("path", cfg.ConfigPath))
+			rewrites, err := loadConfig(cfg.ConfigPath)
+			if err != nil {
+				logger.Error("Failed to reload config, keeping the current one", zap.Error(err))
+				continue
+			}
+			if err := p.Attach(rewrites); err != nil {
+				logger.Error("Failed to apply reloaded config", zap.Error(err))
+				continue
+			}
+			logger.Info("Applied reloaded config", zap.Strings("interfaces", rewrites.Interfaces))
+		}
 	}
 }
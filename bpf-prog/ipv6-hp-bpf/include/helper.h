@@ -4,15 +4,101 @@
 #define L4_HDR_OFF (ETH_HLEN + sizeof(struct ipv6hdr))
 #define BPF_F_PSEUDO_HDR (1ULL << 4)
 
-static __always_inline bool compare_ipv6_addr(const struct in6_addr *addr1, const struct in6_addr *addr2)
+#define MAX_IFACES 64
+#define MAX_REWRITES 64
+
+// Indexes of the counters of each direction
+#define COUNTER_REWRITTEN 0
+#define COUNTER_FAILED 1
+#define COUNTER_MAX 2
+
+// rewrite_key is a prefix of the addresses to rewrite, looked up with the full address
+struct rewrite_key
+{
+    __u32 prefixlen;
+    struct in6_addr addr;
+};
+
+// rewrite_value is the prefix to replace the matched prefix with, keeping the rest of the address
+struct rewrite_value
+{
+    struct in6_addr addr;
+    __u32 prefixlen;
+};
+
+// ipv6_hp_ifaces holds the indexes of the interfaces whose packets are rewritten
+struct
+{
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __type(key, __u32);
+    __type(value, __u8);
+    __uint(max_entries, MAX_IFACES);
+    __uint(pinning, LIBBPF_PIN_BY_NAME);
+} ipv6_hp_ifaces SEC(".maps");
+
+static __always_inline bool is_tcp_ipv6_on_iface(struct __sk_buff *skb)
+{
+    __u32 ifindex = skb->ifindex;
+    if (!bpf_map_lookup_elem(&ipv6_hp_ifaces, &ifindex))
+        return false;
+
+    if (skb->protocol != bpf_htons(ETH_P_IPV6))
+        return false;
+
+    __u8 nexthdr;
+    if (bpf_skb_load_bytes(skb, ETH_HLEN + offsetof(struct ipv6hdr, nexthdr), &nexthdr, sizeof(nexthdr)) != 0)
+        return false;
+
+    return nexthdr == IPPROTO_TCP;
+}
+
+static __always_inline void count(void *counters, __u32 counter)
+{
+    __u64 *value = bpf_map_lookup_elem(counters, &counter);
+    if (value)
+        *value += 1;
+}
+
+// rewrite_addr replaces the prefix of the address at offset in the packet with the one it maps to in rewrites,
+// and updates the TCP checksum. Returns 1 if the address was rewritten, 0 if it didn't match and < 0 on failure.
+static __always_inline int rewrite_addr(struct __sk_buff *skb, void *rewrites, void *counters, __u32 offset)
 {
+    struct rewrite_key key = {.prefixlen = 128};
+    if (bpf_skb_load_bytes(skb, offset, &key.addr, sizeof(key.addr)) != 0)
+        return 0;
+
+    struct rewrite_value *value = bpf_map_lookup_elem(rewrites, &key);
+    if (!value)
+        return 0;
+
+    struct in6_addr new_addr;
 #pragma unroll
     for (int i = 0; i < sizeof(struct in6_addr); i++)
     {
-        if (addr1->s6_addr[i] != addr2->s6_addr[i])
-        {
-            return false;
-        }
+        __u32 bits = value->prefixlen > i * 8 ? value->prefixlen - i * 8 : 0;
+        __u8 mask = bits >= 8 ? 0xff : (__u8)(0xff << (8 - bits));
+        new_addr.s6_addr[i] = (value->addr.s6_addr[i] & mask) | (key.addr.s6_addr[i] & ~mask);
+    }
+
+    int ret = bpf_skb_store_bytes(skb, offset, &new_addr, sizeof(new_addr), 0);
+    if (ret != 0)
+    {
+        bpf_printk("bpf_skb_store_bytes failed to store new address with error code %d.\n", ret);
+        count(counters, COUNTER_FAILED);
+        return ret;
+    }
+
+    // Update the checksum
+    __be32 sum = bpf_csum_diff((__be32 *)key.addr.s6_addr32, sizeof(key.addr),
+                               (__be32 *)new_addr.s6_addr32, sizeof(new_addr), 0);
+    ret = bpf_l4_csum_replace(skb, L4_HDR_OFF + offsetof(struct tcphdr, check), 0, sum, BPF_F_PSEUDO_HDR);
+    if (ret < 0)
+    {
+        bpf_printk("csum_l4_replace failed to update checksum: %d", ret);
+        count(counters, COUNTER_FAILED);
+        return ret;
     }
-    return true;
-}
\ No newline at end of file
+
+    count(counters, COUNTER_REWRITTEN);
+    return 1;
+}
@@ -0,0 +1,346 @@
+// Package bpfprogram manages the lifecycle of the ipv6-hp-bpf programs: loading them, configuring their maps,
+// and attaching them to and detaching them from the interfaces.
+package bpfprogram
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/Azure/azure-container-networking/bpf-prog/ipv6-hp-bpf/pkg/egress"
+	"github.com/Azure/azure-container-networking/bpf-prog/ipv6-hp-bpf/pkg/ingress"
+	"github.com/Azure/azure-container-networking/bpf-prog/ipv6-hp-bpf/pkg/metrics"
+	"github.com/Azure/azure-container-networking/bpf-prog/ipv6-hp-bpf/pkg/rewrite"
+	"github.com/cilium/ebpf"
+	"github.com/vishvananda/netlink"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultPinPath is where the maps are pinned, so that they outlive the process which loaded them
+	DefaultPinPath = "/sys/fs/bpf/ipv6-hp-bpf"
+
+	IfacesMapName          = "ipv6_hp_ifaces"
+	EgressRewritesMapName  = "ipv6_hp_egress_rewrites"
+	EgressCountersMapName  = "ipv6_hp_egress_counters"
+	IngressRewritesMapName = "ipv6_hp_ingress_rewrites"
+	IngressCountersMapName = "ipv6_hp_ingress_counters"
+)
+
+// Indexes of the counters of each direction, see include/helper.h
+const (
+	counterRewritten uint32 = iota
+	counterFailed
+)
+
+var pinnedMaps = []string{
+	IfacesMapName,
+	EgressRewritesMapName,
+	EgressCountersMapName,
+	IngressRewritesMapName,
+	IngressCountersMapName,
+}
+
+// Program is the pair of egress and ingress programs, and their maps
+type Program struct {
+	logger  *zap.Logger
+	pinPath string
+	egress  egress.EgressObjects
+	ingress ingress.IngressObjects
+	// ifaces are the indexes of the interfaces the programs are attached to, by name
+	ifaces map[string]int
+}
+
+// Load loads the programs into the kernel and pins their maps under pinPath. Maps already pinned there are reused,
+// so that the counters survive restarts, unless they are incompatible with the programs.
+// If pinPath is empty or the maps can't be pinned, e.g. because bpffs isn't mounted, the maps aren't pinned.
+func Load(pinPath string, logger *zap.Logger) (*Program, error) {
+	p := &Program{logger: logger, pinPath: pinPath, ifaces: map[string]int{}}
+	if p.pinPath != "" {
+		if err := os.MkdirAll(p.pinPath, 0o755); err != nil {
+			logger.Warn("Failed to create pin path, maps won't be pinned", zap.String("path", p.pinPath), zap.Error(err))
+			p.pinPath = ""
+		}
+	}
+
+	err := p.load()
+	if errors.Is(err, ebpf.ErrMapIncompatible) && p.pinPath != "" {
+		logger.Info("Pinned maps are incompatible with the programs, replacing them", zap.Error(err))
+		if err = unpinMaps(p.pinPath); err == nil {
+			err = p.load()
+		}
+	}
+	if err != nil && p.pinPath != "" {
+		logger.Warn("Failed to load programs with pinned maps, loading them without pinning", zap.Error(err))
+		p.pinPath = ""
+		err = p.load()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Program) load() error {
+	opts := &ebpf.CollectionOptions{}
+	if p.pinPath != "" {
+		opts.Maps.PinPath = p.pinPath
+	}
+	if err := egress.LoadEgressObjects(&p.egress, opts); err != nil {
+		return fmt.Errorf("failed to load egress objects: %w", err)
+	}
+
+	// share the interfaces map of the egress program, which is only shared by pinning otherwise
+	opts.MapReplacements = map[string]*ebpf.Map{IfacesMapName: p.egress.Ipv6HpIfaces}
+	if err := ingress.LoadIngressObjects(&p.ingress, opts); err != nil {
+		p.egress.Close()
+		return fmt.Errorf("failed to load ingress objects: %w", err)
+	}
+	return nil
+}
+
+// Pinned returns whether the maps are pinned
+func (p *Program) Pinned() bool {
+	return p.pinPath != ""
+}
+
+// Attach writes the interfaces and rewrites of config to the maps, and attaches the programs to the interfaces.
+// The programs are detached from the interfaces they were attached to by p which aren't in config anymore.
+func (p *Program) Attach(config *rewrite.Config) error {
+	ifaces := make(map[string]int, len(config.Interfaces))
+	for _, name := range config.Interfaces {
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			return fmt.Errorf("failed to get interface %s: %w", name, err)
+		}
+		ifaces[name] = iface.Index
+	}
+
+	if err := p.writeMaps(config, ifaces); err != nil {
+		return err
+	}
+
+	for name, index := range ifaces {
+		if err := p.attach(index); err != nil {
+			return fmt.Errorf("failed to attach programs to interface %s: %w", name, err)
+		}
+		p.logger.Info("Attached programs", zap.String("interface", name), zap.Int("index", index))
+	}
+
+	for name, index := range p.ifaces {
+		if _, ok := ifaces[name]; ok {
+			continue
+		}
+		if err := detach(index, p.logger); err != nil {
+			p.logger.Error("Failed to detach programs", zap.String("interface", name), zap.Error(err))
+			continue
+		}
+		p.logger.Info("Detached programs", zap.String("interface", name), zap.Int("index", index))
+	}
+	p.ifaces = ifaces
+	return nil
+}
+
+func (p *Program) attach(index int) error {
+	// Create a qdisc filter for traffic on the interface.
+	qdisc := &netlink.GenericQdisc{
+		QdiscAttrs: netlink.QdiscAttrs{
+			LinkIndex: index,
+			Handle:    netlink.MakeHandle(0xffff, 0),
+			Parent:    netlink.HANDLE_CLSACT,
+		},
+		QdiscType: "clsact",
+	}
+	if err := netlink.QdiscReplace(qdisc); err != nil {
+		return fmt.Errorf("failed to set clsact qdisc: %w", err)
+	}
+	if err := egress.SetupEgressFilter(index, &p.egress, p.logger); err != nil {
+		return fmt.Errorf("failed to set up egress filter: %w", err)
+	}
+	if err := ingress.SetupIngressFilter(index, &p.ingress, p.logger); err != nil {
+		return fmt.Errorf("failed to set up ingress filter: %w", err)
+	}
+	return nil
+}
+
+// writeMaps replaces the content of the interfaces and rewrites maps. The rewrites are written first so that
+// packets of newly added interfaces are rewritten with the new config.
+func (p *Program) writeMaps(config *rewrite.Config, ifaces map[string]int) error {
+	keys, values := config.Entries(rewrite.Egress)
+	if err := replaceRewrites(p.egress.Ipv6HpEgressRewrites, keys, values); err != nil {
+		return fmt.Errorf("failed to write %s: %w", EgressRewritesMapName, err)
+	}
+	keys, values = config.Entries(rewrite.Ingress)
+	if err := replaceRewrites(p.ingress.Ipv6HpIngressRewrites, keys, values); err != nil {
+		return fmt.Errorf("failed to write %s: %w", IngressRewritesMapName, err)
+	}
+
+	indexes := make(map[uint32]bool, len(ifaces))
+	for _, index := range ifaces {
+		indexes[uint32(index)] = true
+		if err := p.egress.Ipv6HpIfaces.Put(uint32(index), uint8(1)); err != nil {
+			return fmt.Errorf("failed to write %s: %w", IfacesMapName, err)
+		}
+	}
+	var index uint32
+	var stale []uint32
+	var value uint8
+	iter := p.egress.Ipv6HpIfaces.Iterate()
+	for iter.Next(&index, &value) {
+		if !indexes[index] {
+			stale = append(stale, index)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("failed to iterate %s: %w", IfacesMapName, err)
+	}
+	for _, index := range stale {
+		if err := p.egress.Ipv6HpIfaces.Delete(index); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+			return fmt.Errorf("failed to delete from %s: %w", IfacesMapName, err)
+		}
+	}
+	return nil
+}
+
+// replaceRewrites puts keys and values into the rewrites map m, and deletes its other entries
+func replaceRewrites(m *ebpf.Map, keys []rewrite.Key, values []rewrite.Value) error {
+	current := make(map[rewrite.Key]bool, len(keys))
+	for i := range keys {
+		current[keys[i]] = true
+		if err := m.Put(keys[i], values[i]); err != nil {
+			return err
+		}
+	}
+
+	var key rewrite.Key
+	var value rewrite.Value
+	var stale []rewrite.Key
+	iter := m.Iterate()
+	for iter.Next(&key, &value) {
+		if !current[key] {
+			stale = append(stale, key)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	for i := range stale {
+		if err := m.Delete(stale[i]); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Counters reads the counters of both programs
+func (p *Program) Counters() (map[rewrite.Direction]metrics.Counters, error) {
+	maps := map[rewrite.Direction]*ebpf.Map{
+		rewrite.Egress:  p.egress.Ipv6HpEgressCounters,
+		rewrite.Ingress: p.ingress.Ipv6HpIngressCounters,
+	}
+	counters := make(map[rewrite.Direction]metrics.Counters, len(maps))
+	for direction, m := range maps {
+		rewritten, err := sumCounter(m, counterRewritten)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s counters: %w", direction, err)
+		}
+		failed, err := sumCounter(m, counterFailed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s counters: %w", direction, err)
+		}
+		counters[direction] = metrics.Counters{Rewritten: rewritten, Failed: failed}
+	}
+	return counters, nil
+}
+
+// sumCounter sums the values of a per-CPU counter
+func sumCounter(m *ebpf.Map, counter uint32) (uint64, error) {
+	var values []uint64
+	if err := m.Lookup(counter, &values); err != nil {
+		return 0, err
+	}
+	var sum uint64
+	for _, value := range values {
+		sum += value
+	}
+	return sum, nil
+}
+
+// Close releases the programs and maps held by the process. The programs stay attached, and pinned maps stay pinned.
+func (p *Program) Close() error {
+	return errors.Join(p.ingress.Close(), p.egress.Close())
+}
+
+// Detach detaches the programs from the interfaces of config and from the interfaces in the pinned interfaces map,
+// and unpins the maps
+func Detach(config *rewrite.Config, pinPath string, logger *zap.Logger) error {
+	indexes := map[int]bool{}
+	for _, name := range config.Interfaces {
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			logger.Warn("Failed to get interface, skipping it", zap.String("interface", name), zap.Error(err))
+			continue
+		}
+		indexes[iface.Index] = true
+	}
+
+	if pinPath != "" {
+		pinnedIndexes(pinPath, indexes, logger)
+	}
+
+	var errs []error
+	for index := range indexes {
+		if err := detach(index, logger); err != nil {
+			errs = append(errs, fmt.Errorf("failed to detach programs from interface %d: %w", index, err))
+			continue
+		}
+		logger.Info("Detached programs", zap.Int("index", index))
+	}
+	if pinPath != "" {
+		if err := unpinMaps(pinPath); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// pinnedIndexes adds the indexes in the pinned interfaces map to indexes
+func pinnedIndexes(pinPath string, indexes map[int]bool, logger *zap.Logger) {
+	ifacesMap, err := ebpf.LoadPinnedMap(filepath.Join(pinPath, IfacesMapName), nil)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logger.Warn("Failed to load pinned interfaces map", zap.Error(err))
+		}
+		return
+	}
+	defer ifacesMap.Close()
+
+	var index uint32
+	var value uint8
+	iter := ifacesMap.Iterate()
+	for iter.Next(&index, &value) {
+		indexes[int(index)] = true
+	}
+	if err := iter.Err(); err != nil {
+		logger.Warn("Failed to iterate pinned interfaces map", zap.Error(err))
+	}
+}
+
+func detach(index int, logger *zap.Logger) error {
+	if err := egress.RemoveEgressFilter(index, logger); err != nil {
+		return err
+	}
+	return ingress.RemoveIngressFilter(index, logger)
+}
+
+// unpinMaps removes the pinned maps, if they exist
+func unpinMaps(pinPath string) error {
+	for _, name := range pinnedMaps {
+		if err := os.Remove(filepath.Join(pinPath, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to unpin map %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package bpfprogram
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"os"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/bpf-prog/ipv6-hp-bpf/pkg/metrics"
+	"github.com/Azure/azure-container-networking/bpf-prog/ipv6-hp-bpf/pkg/rewrite"
+	"github.com/cilium/ebpf"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+const (
+	tcActUnspec = ^uint32(0) // TC_ACT_UNSPEC is -1
+	ethHdrLen   = 14
+	ipv6HdrLen  = 40
+	tcpHdrLen   = 20
+	protoTCP    = 6
+	protoUDP    = 17
+)
+
+// loadTestProgram loads the programs without pinning their maps, configured to rewrite the packets on the loopback
+// interface, which is the interface BPF_PROG_TEST_RUN runs the programs on.
+func loadTestProgram(t *testing.T, config *rewrite.Config) *Program {
+	t.Helper()
+	if os.Geteuid() != 0 {
+		t.Skip("loading BPF programs requires root")
+	}
+
+	p, err := Load("", zap.NewNop())
+	require.NoError(t, err)
+	t.Cleanup(func() { p.Close() })
+
+	lo, err := net.InterfaceByName("lo")
+	require.NoError(t, err)
+	ifaces := map[string]int{}
+	for _, name := range config.Interfaces {
+		ifaces[name] = lo.Index
+	}
+	require.NoError(t, p.writeMaps(config, ifaces))
+	return p
+}
+
+// packet builds an Ethernet frame of an IPv6 packet from src to dst, with a TCP header if proto is TCP
+func packet(src, dst netip.Addr, proto uint8) []byte {
+	pkt := make([]byte, ethHdrLen+ipv6HdrLen+tcpHdrLen)
+	binary.BigEndian.PutUint16(pkt[12:], 0x86dd)
+
+	ip := pkt[ethHdrLen:]
+	ip[0] = 6 << 4
+	binary.BigEndian.PutUint16(ip[4:], tcpHdrLen)
+	ip[6] = proto
+	ip[7] = 64
+	src16, dst16 := src.As16(), dst.As16()
+	copy(ip[8:24], src16[:])
+	copy(ip[24:40], dst16[:])
+
+	l4 := ip[ipv6HdrLen:]
+	binary.BigEndian.PutUint16(l4[0:], 54321)
+	binary.BigEndian.PutUint16(l4[2:], 80)
+	l4[12] = 5 << 4 // data offset
+	l4[13] = 0x02   // SYN
+	if proto == protoTCP {
+		binary.BigEndian.PutUint16(l4[16:], ^checksum(pkt))
+	}
+	return pkt
+}
+
+// checksum returns the ones' complement sum of the IPv6 pseudo header and the TCP segment of pkt, which is 0xffff
+// if its checksum is valid
+func checksum(pkt []byte) uint16 {
+	ip := pkt[ethHdrLen:]
+	l4 := ip[ipv6HdrLen:]
+
+	var sum uint32
+	add := func(b []byte) {
+		for i := 0; i+1 < len(b); i += 2 {
+			sum += uint32(binary.BigEndian.Uint16(b[i:]))
+		}
+	}
+	add(ip[8:40]) // addresses
+	sum += uint32(len(l4)) + uint32(ip[6])
+	add(l4)
+	for sum > 0xffff {
+		sum = (sum & 0xffff) + (sum >> 16)
+	}
+	return uint16(sum)
+}
+
+func run(t *testing.T, prog *ebpf.Program, pkt []byte) []byte {
+	t.Helper()
+	out := make([]byte, len(pkt))
+	ret, err := prog.Run(&ebpf.RunOptions{Data: pkt, DataOut: out})
+	require.NoError(t, err)
+	require.Equal(t, tcActUnspec, ret, "packets are never dropped unless the rewrite fails")
+	return out
+}
+
+func srcAddr(pkt []byte) netip.Addr {
+	return netip.AddrFrom16([16]byte(pkt[ethHdrLen+8 : ethHdrLen+24]))
+}
+
+func dstAddr(pkt []byte) netip.Addr {
+	return netip.AddrFrom16([16]byte(pkt[ethHdrLen+24 : ethHdrLen+40]))
+}
+
+func TestEgress(t *testing.T) {
+	config := &rewrite.Config{
+		Interfaces: []string{"eth0"},
+		Rewrites: []rewrite.Rewrite{
+			{
+				Global:    netip.MustParsePrefix("2603:1062:0:1:fe80:1234:5678:9abc/128"),
+				LinkLocal: netip.MustParsePrefix("fe80::1234:5678:9abc/128"),
+			},
+			{
+				Global:    netip.MustParsePrefix("2001:db8:1::/64"),
+				LinkLocal: netip.MustParsePrefix("fe80::/64"),
+			},
+		},
+	}
+	p := loadTestProgram(t, config)
+	node := netip.MustParseAddr("2001:db8:2::4")
+
+	tests := []struct {
+		name     string
+		dst      string
+		proto    uint8
+		expected string
+	}{
+		{name: "address", dst: "2603:1062:0:1:fe80:1234:5678:9abc", proto: protoTCP, expected: "fe80::1234:5678:9abc"},
+		{name: "prefix keeps interface identifier", dst: "2001:db8:1::abcd", proto: protoTCP, expected: "fe80::abcd"},
+		{name: "no match", dst: "2001:db8:3::1", proto: protoTCP, expected: "2001:db8:3::1"},
+		{name: "not tcp", dst: "2001:db8:1::abcd", proto: protoUDP, expected: "2001:db8:1::abcd"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := run(t, p.egress.GuaToLinklocal, packet(node, netip.MustParseAddr(tt.dst), tt.proto))
+			require.Equal(t, netip.MustParseAddr(tt.expected), dstAddr(out))
+			require.Equal(t, node, srcAddr(out), "source is never rewritten on egress")
+			if tt.proto == protoTCP {
+				require.Equal(t, uint16(0xffff), checksum(out), "checksum is updated")
+			}
+		})
+	}
+
+	counters, err := p.Counters()
+	require.NoError(t, err)
+	require.Equal(t, metrics.Counters{Rewritten: 2}, counters[rewrite.Egress])
+	require.Equal(t, metrics.Counters{}, counters[rewrite.Ingress])
+}
+
+func TestIngress(t *testing.T) {
+	config := &rewrite.Config{
+		Interfaces: []string{"eth0"},
+		Rewrites: []rewrite.Rewrite{{
+			Global:    netip.MustParsePrefix("2001:db8:1::/64"),
+			LinkLocal: netip.MustParsePrefix("fe80::/64"),
+		}},
+	}
+	p := loadTestProgram(t, config)
+	node := netip.MustParseAddr("2001:db8:2::4")
+
+	out := run(t, p.ingress.LinklocalToGua, packet(netip.MustParseAddr("fe80::abcd"), node, protoTCP))
+	require.Equal(t, netip.MustParseAddr("2001:db8:1::abcd"), srcAddr(out))
+	require.Equal(t, node, dstAddr(out), "destination is never rewritten on ingress")
+	require.Equal(t, uint16(0xffff), checksum(out))
+
+	counters, err := p.Counters()
+	require.NoError(t, err)
+	require.Equal(t, metrics.Counters{Rewritten: 1}, counters[rewrite.Ingress])
+}
+
+func TestOtherInterface(t *testing.T) {
+	config := &rewrite.Config{
+		Interfaces: []string{"eth0"},
+		Rewrites: []rewrite.Rewrite{{
+			Global:    netip.MustParsePrefix("2001:db8:1::/64"),
+			LinkLocal: netip.MustParsePrefix("fe80::/64"),
+		}},
+	}
+	p := loadTestProgram(t, config)
+	// remove the loopback interface from the interfaces map
+	require.NoError(t, p.writeMaps(config, nil))
+
+	pkt := packet(netip.MustParseAddr("2001:db8:2::4"), netip.MustParseAddr("2001:db8:1::abcd"), protoTCP)
+	require.Equal(t, pkt, run(t, p.egress.GuaToLinklocal, pkt))
+}
+
+func TestWriteMapsReplacesRewrites(t *testing.T) {
+	config := &rewrite.Config{
+		Interfaces: []string{"eth0"},
+		Rewrites: []rewrite.Rewrite{{
+			Global:    netip.MustParsePrefix("2001:db8:1::/64"),
+			LinkLocal: netip.MustParsePrefix("fe80::/64"),
+		}},
+	}
+	p := loadTestProgram(t, config)
+
+	lo, err := net.InterfaceByName("lo")
+	require.NoError(t, err)
+	config.Rewrites[0].Global = netip.MustParsePrefix("2001:db8:5::/64")
+	require.NoError(t, p.writeMaps(config, map[string]int{"eth0": lo.Index}))
+
+	node := netip.MustParseAddr("2001:db8:2::4")
+	out := run(t, p.egress.GuaToLinklocal, packet(node, netip.MustParseAddr("2001:db8:1::abcd"), protoTCP))
+	require.Equal(t, netip.MustParseAddr("2001:db8:1::abcd"), dstAddr(out), "removed rewrites don't apply")
+	out = run(t, p.egress.GuaToLinklocal, packet(node, netip.MustParseAddr("2001:db8:5::abcd"), protoTCP))
+	require.Equal(t, netip.MustParseAddr("fe80::abcd"), dstAddr(out))
+}
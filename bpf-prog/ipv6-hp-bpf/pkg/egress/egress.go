@@ -7,8 +7,40 @@ import (
 	"go.uber.org/zap"
 )
 
+// FilterName identifies the egress filter on the links
+const FilterName = "ipv6_hp_egress"
+
 // SetupEgressFilter sets up the egress filter
 func SetupEgressFilter(ifaceIndex int, objs *EgressObjects, logger *zap.Logger) error {
+	// Delete the existing filter to avoid duplicate filters after restarting the daemonset
+	if err := RemoveEgressFilter(ifaceIndex, logger); err != nil {
+		return err
+	}
+
+	egressFilter := &netlink.BpfFilter{
+		FilterAttrs: netlink.FilterAttrs{
+			LinkIndex: ifaceIndex,
+			Parent:    netlink.HANDLE_MIN_EGRESS,
+			Protocol:  syscall.ETH_P_ALL,
+			Priority:  1,
+		},
+		Fd:           objs.GuaToLinklocal.FD(),
+		Name:         FilterName,
+		DirectAction: true,
+	}
+
+	if err := netlink.FilterReplace(egressFilter); err != nil {
+		logger.Error("failed setting egress filter", zap.Error(err))
+		return err
+	} else {
+		logger.Info("Successfully set egress filter on", zap.Int("ifaceIndex", ifaceIndex))
+	}
+
+	return nil
+}
+
+// RemoveEgressFilter deletes the egress filter from the link, if it exists
+func RemoveEgressFilter(ifaceIndex int, logger *zap.Logger) error {
 	link, err := netlink.LinkByIndex(ifaceIndex)
 	if err != nil {
 		logger.Error("Failed to get link", zap.Error(err))
@@ -22,10 +54,9 @@ func SetupEgressFilter(ifaceIndex int, objs *EgressObjects, logger *zap.Logger)
 		return err
 	}
 
-	// Check if egress filter exists and delete it. Filter is identified by its name.
-	// this is to avoid duplicate filters after restarting the daemonset
+	// Filter is identified by its name
 	for _, filter := range filters {
-		if filter, ok := filter.(*netlink.BpfFilter); ok && filter.Name == "ipv6_hp_egress" {
+		if filter, ok := filter.(*netlink.BpfFilter); ok && filter.Name == FilterName {
 			if err := netlink.FilterDel(filter); err != nil {
 				logger.Error("Failed to delete filter", zap.Error(err))
 				return err
@@ -34,24 +65,5 @@ func SetupEgressFilter(ifaceIndex int, objs *EgressObjects, logger *zap.Logger)
 		}
 	}
 
-	egressFilter := &netlink.BpfFilter{
-		FilterAttrs: netlink.FilterAttrs{
-			LinkIndex: ifaceIndex,
-			Parent:    netlink.HANDLE_MIN_EGRESS,
-			Protocol:  syscall.ETH_P_ALL,
-			Priority:  1,
-		},
-		Fd:           objs.GuaToLinklocal.FD(),
-		Name:         "ipv6_hp_egress",
-		DirectAction: true,
-	}
-
-	if err := netlink.FilterReplace(egressFilter); err != nil {
-		logger.Error("failed setting egress filter", zap.Error(err))
-		return err
-	} else {
-		logger.Info("Successfully set egress filter on", zap.Int("ifaceIndex", ifaceIndex))
-	}
-
 	return nil
 }
@@ -7,8 +7,40 @@ import (
 	"go.uber.org/zap"
 )
 
+// FilterName identifies the ingress filter on the links
+const FilterName = "ipv6_hp_ingress"
+
 // SetupIngressFilter sets up the ingress filter
 func SetupIngressFilter(ifaceIndex int, objs *IngressObjects, logger *zap.Logger) error {
+	// Delete the existing filter to avoid duplicate filters after restarting the daemonset
+	if err := RemoveIngressFilter(ifaceIndex, logger); err != nil {
+		return err
+	}
+
+	ingressFilter := &netlink.BpfFilter{
+		FilterAttrs: netlink.FilterAttrs{
+			LinkIndex: ifaceIndex,
+			Parent:    netlink.HANDLE_MIN_INGRESS,
+			Protocol:  syscall.ETH_P_ALL,
+			Priority:  1,
+		},
+		Fd:           objs.LinklocalToGua.FD(),
+		Name:         FilterName,
+		DirectAction: true,
+	}
+
+	if err := netlink.FilterReplace(ingressFilter); err != nil {
+		logger.Error("failed setting ingress filter", zap.Error(err))
+		return err
+	} else {
+		logger.Info("Successfully set ingress filter on", zap.Int("ifaceIndex", ifaceIndex))
+	}
+
+	return nil
+}
+
+// RemoveIngressFilter deletes the ingress filter from the link, if it exists
+func RemoveIngressFilter(ifaceIndex int, logger *zap.Logger) error {
 	link, err := netlink.LinkByIndex(ifaceIndex)
 	if err != nil {
 		logger.Error("Failed to get link", zap.Error(err))
@@ -22,10 +54,9 @@ func SetupIngressFilter(ifaceIndex int, objs *IngressObjects, logger *zap.Logger
 		return err
 	}
 
-	// Check if egress filter exists and delete it. Filter is identified by its name.
-	// this is to avoid duplicate filters after restarting the daemonsetS
+	// Filter is identified by its name
 	for _, filter := range filters {
-		if filter, ok := filter.(*netlink.BpfFilter); ok && filter.Name == "ipv6_hp_ingress" {
+		if filter, ok := filter.(*netlink.BpfFilter); ok && filter.Name == FilterName {
 			if err := netlink.FilterDel(filter); err != nil {
 				logger.Error("Failed to delete filter", zap.Error(err))
 				return err
@@ -34,24 +65,5 @@ func SetupIngressFilter(ifaceIndex int, objs *IngressObjects, logger *zap.Logger
 		}
 	}
 
-	ingressFilter := &netlink.BpfFilter{
-		FilterAttrs: netlink.FilterAttrs{
-			LinkIndex: ifaceIndex,
-			Parent:    netlink.HANDLE_MIN_INGRESS,
-			Protocol:  syscall.ETH_P_ALL,
-			Priority:  1,
-		},
-		Fd:           objs.LinklocalToGua.FD(),
-		Name:         "ipv6_hp_ingress",
-		DirectAction: true,
-	}
-
-	if err := netlink.FilterReplace(ingressFilter); err != nil {
-		logger.Error("failed setting ingress filter", zap.Error(err))
-		return err
-	} else {
-		logger.Info("Successfully set ingress filter on", zap.Int("ifaceIndex", ifaceIndex))
-	}
-
 	return nil
 }
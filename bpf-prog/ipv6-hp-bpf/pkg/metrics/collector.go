@@ -0,0 +1,63 @@
+// Package metrics exports the counters of the ipv6-hp-bpf programs as Prometheus metrics.
+package metrics
+
+import (
+	"github.com/Azure/azure-container-networking/bpf-prog/ipv6-hp-bpf/pkg/rewrite"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// Counters are the counters of a program, summed over the CPUs
+type Counters struct {
+	// Rewritten is the number of packets whose address was rewritten
+	Rewritten uint64
+	// Failed is the number of packets whose address matched a rewrite but couldn't be rewritten, and were dropped
+	Failed uint64
+}
+
+// ReadFunc reads the counters of the program of each direction
+type ReadFunc func() (map[rewrite.Direction]Counters, error)
+
+// Collector collects the counters from the BPF maps on each scrape. The counters live in the maps rather than
+// in the process, so that they keep counting when the daemon restarts.
+type Collector struct {
+	read      ReadFunc
+	logger    *zap.Logger
+	rewritten *prometheus.Desc
+	failed    *prometheus.Desc
+}
+
+func NewCollector(read ReadFunc, logger *zap.Logger) *Collector {
+	return &Collector{
+		read:   read,
+		logger: logger,
+		rewritten: prometheus.NewDesc(
+			"ipv6_hp_bpf_rewritten_packets_total",
+			"Number of packets whose address was rewritten.",
+			[]string{"direction"}, nil,
+		),
+		failed: prometheus.NewDesc(
+			"ipv6_hp_bpf_rewrite_failures_total",
+			"Number of packets which failed to be rewritten and were dropped.",
+			[]string{"direction"}, nil,
+		),
+	}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.rewritten
+	ch <- c.failed
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	counters, err := c.read()
+	if err != nil {
+		c.logger.Error("Failed to read counters", zap.Error(err))
+		ch <- prometheus.NewInvalidMetric(c.rewritten, err)
+		return
+	}
+	for direction, counter := range counters {
+		ch <- prometheus.MustNewConstMetric(c.rewritten, prometheus.CounterValue, float64(counter.Rewritten), string(direction))
+		ch <- prometheus.MustNewConstMetric(c.failed, prometheus.CounterValue, float64(counter.Failed), string(direction))
+	}
+}
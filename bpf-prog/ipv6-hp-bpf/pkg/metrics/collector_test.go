@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/bpf-prog/ipv6-hp-bpf/pkg/rewrite"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestCollect(t *testing.T) {
+	collector := NewCollector(func() (map[rewrite.Direction]Counters, error) {
+		return map[rewrite.Direction]Counters{
+			rewrite.Egress:  {Rewritten: 3, Failed: 1},
+			rewrite.Ingress: {Rewritten: 2},
+		}, nil
+	}, zap.NewNop())
+
+	expected := `
+# HELP ipv6_hp_bpf_rewrite_failures_total Number of packets which failed to be rewritten and were dropped.
+# TYPE ipv6_hp_bpf_rewrite_failures_total counter
+ipv6_hp_bpf_rewrite_failures_total{direction="egress"} 1
+ipv6_hp_bpf_rewrite_failures_total{direction="ingress"} 0
+# HELP ipv6_hp_bpf_rewritten_packets_total Number of packets whose address was rewritten.
+# TYPE ipv6_hp_bpf_rewritten_packets_total counter
+ipv6_hp_bpf_rewritten_packets_total{direction="egress"} 3
+ipv6_hp_bpf_rewritten_packets_total{direction="ingress"} 2
+`
+	require.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected)))
+}
+
+func TestCollectError(t *testing.T) {
+	collector := NewCollector(func() (map[rewrite.Direction]Counters, error) {
+		return nil, errors.New("map closed")
+	}, zap.NewNop())
+
+	registry := prometheus.NewPedanticRegistry()
+	require.NoError(t, registry.Register(collector))
+	_, err := registry.Gather()
+	require.Error(t, err)
+}
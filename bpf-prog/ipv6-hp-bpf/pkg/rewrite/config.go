@@ -0,0 +1,114 @@
+// Package rewrite holds the configuration of the addresses ipv6-hp-bpf rewrites, and its encoding into the BPF maps.
+package rewrite
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// MaxInterfaces and MaxRewrites are the sizes of the BPF maps, see include/helper.h
+	MaxInterfaces = 64
+	MaxRewrites   = 64
+)
+
+var (
+	ErrNoInterfaces         = errors.New("no interfaces configured")
+	ErrTooManyInterfaces    = fmt.Errorf("more than %d interfaces configured", MaxInterfaces)
+	ErrTooManyRewrites      = fmt.Errorf("more than %d rewrites configured", MaxRewrites)
+	ErrNotIPv6              = errors.New("prefix is not IPv6")
+	ErrNotGlobalUnicast     = errors.New("prefix is not global unicast")
+	ErrNotLinkLocal         = errors.New("prefix is not link local")
+	ErrPrefixLengthMismatch = errors.New("global and link local prefixes have different lengths")
+	ErrDuplicatePrefix      = errors.New("prefix is rewritten more than once")
+)
+
+var (
+	linkLocalPrefix = netip.MustParsePrefix("fe80::/10")
+
+	// the address of the Azure load balancer health probes, and the link local address the node answers them on
+	defaultInterface = "eth0"
+	defaultGlobal    = netip.MustParsePrefix("2603:1062:0:1:fe80:1234:5678:9abc/128")
+	defaultLinkLocal = netip.MustParsePrefix("fe80::1234:5678:9abc/128")
+)
+
+// Config is the configuration of the interfaces and addresses to rewrite
+type Config struct {
+	// Interfaces are the names of the interfaces the programs are attached to
+	Interfaces []string `json:"interfaces"`
+	// Rewrites are the pairs of prefixes to rewrite
+	Rewrites []Rewrite `json:"rewrites"`
+}
+
+// Rewrite is a pair of prefixes of the same length. Egress packets to Global are rewritten to LinkLocal,
+// and ingress packets from LinkLocal are rewritten from Global. The bits after the prefix are kept.
+type Rewrite struct {
+	Global    netip.Prefix `json:"global"`
+	LinkLocal netip.Prefix `json:"linkLocal"`
+}
+
+// Default returns the configuration of the Azure load balancer health probes on eth0
+func Default() *Config {
+	return &Config{
+		Interfaces: []string{defaultInterface},
+		Rewrites:   []Rewrite{{Global: defaultGlobal, LinkLocal: defaultLinkLocal}},
+	}
+}
+
+// Load reads and validates the YAML or JSON config file at path
+func Load(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+	config := &Config{}
+	if err := yaml.UnmarshalStrict(b, config); err != nil {
+		return nil, fmt.Errorf("failed to decode config %s: %w", path, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Validate checks the config can be written to the BPF maps
+func (c *Config) Validate() error {
+	if len(c.Interfaces) == 0 {
+		return ErrNoInterfaces
+	}
+	if len(c.Interfaces) > MaxInterfaces {
+		return ErrTooManyInterfaces
+	}
+	if len(c.Rewrites) > MaxRewrites {
+		return ErrTooManyRewrites
+	}
+	globals := map[netip.Prefix]bool{}
+	linkLocals := map[netip.Prefix]bool{}
+	for _, r := range c.Rewrites {
+		if !r.Global.Addr().Is6() || !r.LinkLocal.Addr().Is6() || r.Global.Addr().Is4In6() || r.LinkLocal.Addr().Is4In6() {
+			return fmt.Errorf("%w: %s, %s", ErrNotIPv6, r.Global, r.LinkLocal)
+		}
+		if !r.Global.Addr().IsGlobalUnicast() {
+			return fmt.Errorf("%w: %s", ErrNotGlobalUnicast, r.Global)
+		}
+		if !r.LinkLocal.Addr().IsLinkLocalUnicast() || r.LinkLocal.Bits() < linkLocalPrefix.Bits() {
+			return fmt.Errorf("%w: %s", ErrNotLinkLocal, r.LinkLocal)
+		}
+		if r.Global.Bits() != r.LinkLocal.Bits() {
+			return fmt.Errorf("%w: %s, %s", ErrPrefixLengthMismatch, r.Global, r.LinkLocal)
+		}
+		global, linkLocal := r.Global.Masked(), r.LinkLocal.Masked()
+		if globals[global] {
+			return fmt.Errorf("%w: %s", ErrDuplicatePrefix, r.Global)
+		}
+		if linkLocals[linkLocal] {
+			return fmt.Errorf("%w: %s", ErrDuplicatePrefix, r.LinkLocal)
+		}
+		globals[global], linkLocals[linkLocal] = true, true
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package rewrite
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+
+	_, err := Load(path)
+	require.Error(t, err, "missing config")
+
+	require.NoError(t, os.WriteFile(path, []byte(`
+interfaces: [eth0, eth1]
+rewrites:
+- global: 2603:1062:0:1:fe80:1234:5678:9abc/128
+  linkLocal: fe80::1234:5678:9abc/128
+- global: 2001:db8:1::/64
+  linkLocal: fe80::/64
+`), 0o600))
+	config, err := Load(path)
+	require.NoError(t, err)
+	require.Equal(t, []string{"eth0", "eth1"}, config.Interfaces)
+	require.Len(t, config.Rewrites, 2)
+	require.Equal(t, netip.MustParsePrefix("2001:db8:1::/64"), config.Rewrites[1].Global)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"interfaces": ["eth0"], "rewrite": []}`), 0o600))
+	_, err = Load(path)
+	require.Error(t, err, "unknown fields are rejected")
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"interfaces": ["eth0"], "rewrites": [{"global": "2001:db8::1/128", "linkLocal": "fe80::1/64"}]}`), 0o600))
+	_, err = Load(path)
+	require.ErrorIs(t, err, ErrPrefixLengthMismatch)
+}
+
+func TestDefault(t *testing.T) {
+	require.NoError(t, Default().Validate())
+}
+
+func TestValidate(t *testing.T) {
+	rewrite := func(global, linkLocal string) Rewrite {
+		return Rewrite{Global: netip.MustParsePrefix(global), LinkLocal: netip.MustParsePrefix(linkLocal)}
+	}
+
+	tests := []struct {
+		name     string
+		config   Config
+		expected error
+	}{
+		{
+			name:   "valid",
+			config: Config{Interfaces: []string{"eth0"}, Rewrites: []Rewrite{rewrite("2001:db8::/64", "fe80::/64")}},
+		},
+		{
+			name:   "no rewrites",
+			config: Config{Interfaces: []string{"eth0"}},
+		},
+		{
+			name:     "no interfaces",
+			config:   Config{Rewrites: []Rewrite{rewrite("2001:db8::/64", "fe80::/64")}},
+			expected: ErrNoInterfaces,
+		},
+		{
+			name:     "missing prefix",
+			config:   Config{Interfaces: []string{"eth0"}, Rewrites: []Rewrite{{LinkLocal: netip.MustParsePrefix("fe80::/64")}}},
+			expected: ErrNotIPv6,
+		},
+		{
+			name:     "ipv4",
+			config:   Config{Interfaces: []string{"eth0"}, Rewrites: []Rewrite{rewrite("10.0.0.0/8", "fe80::/8")}},
+			expected: ErrNotIPv6,
+		},
+		{
+			name:     "global is link local",
+			config:   Config{Interfaces: []string{"eth0"}, Rewrites: []Rewrite{rewrite("fe80::1/128", "fe80::2/128")}},
+			expected: ErrNotGlobalUnicast,
+		},
+		{
+			name:     "link local is global",
+			config:   Config{Interfaces: []string{"eth0"}, Rewrites: []Rewrite{rewrite("2001:db8::1/128", "2001:db8::2/128")}},
+			expected: ErrNotLinkLocal,
+		},
+		{
+			name:     "link local prefix shorter than fe80::/10",
+			config:   Config{Interfaces: []string{"eth0"}, Rewrites: []Rewrite{rewrite("2000::/8", "fe80::/8")}},
+			expected: ErrNotLinkLocal,
+		},
+		{
+			name:     "different lengths",
+			config:   Config{Interfaces: []string{"eth0"}, Rewrites: []Rewrite{rewrite("2001:db8::/64", "fe80::/96")}},
+			expected: ErrPrefixLengthMismatch,
+		},
+		{
+			name: "duplicate global",
+			config: Config{Interfaces: []string{"eth0"}, Rewrites: []Rewrite{
+				rewrite("2001:db8::/64", "fe80::/64"),
+				rewrite("2001:db8::1/64", "fe80:0:0:1::/64"),
+			}},
+			expected: ErrDuplicatePrefix,
+		},
+		{
+			name: "duplicate link local",
+			config: Config{Interfaces: []string{"eth0"}, Rewrites: []Rewrite{
+				rewrite("2001:db8::/64", "fe80::/64"),
+				rewrite("2001:db8:0:1::/64", "fe80::/64"),
+			}},
+			expected: ErrDuplicatePrefix,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.expected == nil {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEntries(t *testing.T) {
+	config := &Config{
+		Interfaces: []string{"eth0"},
+		Rewrites: []Rewrite{{
+			Global:    netip.MustParsePrefix("2001:db8::1/64"),
+			LinkLocal: netip.MustParsePrefix("fe80::/64"),
+		}},
+	}
+
+	keys, values := config.Entries(Egress)
+	require.Equal(t, []Key{{PrefixLen: 64, Addr: netip.MustParseAddr("2001:db8::").As16()}}, keys, "keys are masked")
+	require.Equal(t, []Value{{PrefixLen: 64, Addr: netip.MustParseAddr("fe80::").As16()}}, values)
+
+	keys, values = config.Entries(Ingress)
+	require.Equal(t, []Key{{PrefixLen: 64, Addr: netip.MustParseAddr("fe80::").As16()}}, keys)
+	require.Equal(t, []Value{{PrefixLen: 64, Addr: netip.MustParseAddr("2001:db8::").As16()}}, values)
+}
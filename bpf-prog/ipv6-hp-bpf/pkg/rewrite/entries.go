@@ -0,0 +1,38 @@
+package rewrite
+
+// Direction is the direction of the packets a program rewrites
+type Direction string
+
+const (
+	// Egress rewrites the destination of the packets from the global unicast prefixes to the link local ones
+	Egress Direction = "egress"
+	// Ingress rewrites the source of the packets from the link local prefixes to the global unicast ones
+	Ingress Direction = "ingress"
+)
+
+// Key is the key of the rewrites maps, struct rewrite_key in include/helper.h
+type Key struct {
+	PrefixLen uint32
+	Addr      [16]byte
+}
+
+// Value is the value of the rewrites maps, struct rewrite_value in include/helper.h
+type Value struct {
+	Addr      [16]byte
+	PrefixLen uint32
+}
+
+// Entries returns the entries of the rewrites map of the program of direction
+func (c *Config) Entries(direction Direction) ([]Key, []Value) {
+	keys := make([]Key, 0, len(c.Rewrites))
+	values := make([]Value, 0, len(c.Rewrites))
+	for _, r := range c.Rewrites {
+		from, to := r.Global.Masked(), r.LinkLocal.Masked()
+		if direction == Ingress {
+			from, to = to, from
+		}
+		keys = append(keys, Key{PrefixLen: uint32(from.Bits()), Addr: from.Addr().As16()})
+		values = append(values, Value{Addr: to.Addr().As16(), PrefixLen: uint32(to.Bits())})
+	}
+	return keys, values
+}
@@ -0,0 +1,181 @@
+// Package events records a structured event for each invocation of the CNI plugin,
+// so that what a given container went through can be reconstructed after the fact.
+package events
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	acntime "github.com/Azure/azure-container-networking/internal/time"
+	"github.com/Azure/azure-container-networking/network"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+)
+
+// Invocation is the record of a single CNI command.
+type Invocation struct {
+	Command      string    `json:"command"`
+	Start        time.Time `json:"start"`
+	ContainerID  string    `json:"containerID"`
+	PodName      string    `json:"podName,omitempty"`
+	PodNamespace string    `json:"podNamespace,omitempty"`
+	Netns        string    `json:"netns,omitempty"`
+	IfName       string    `json:"ifName,omitempty"`
+	Args         string    `json:"args,omitempty"`
+	Path         string    `json:"path,omitempty"`
+	// StdinData is the network configuration the command was invoked with, with its secrets redacted,
+	// and NetconfHash is the SHA-256 of the unredacted configuration.
+	StdinData   string `json:"stdinData,omitempty"`
+	NetconfHash string `json:"netconfHash,omitempty"`
+	// IPAMResult is the result of IPAM, keyed as in the IPAM result of the plugin.
+	IPAMResult map[string]network.InterfaceInfo `json:"ipamResult,omitempty"`
+	Endpoints  []Endpoint                       `json:"endpoints,omitempty"`
+	Error      string                           `json:"error,omitempty"`
+	Phases     []Phase                          `json:"phases,omitempty"`
+	Duration   acntime.Duration                 `json:"duration"`
+
+	phaseStart time.Time
+	inPhase    bool
+}
+
+// Endpoint summarizes an endpoint which the command created or deleted.
+type Endpoint struct {
+	EndpointID  string      `json:"endpointID"`
+	NetworkID   string      `json:"networkID,omitempty"`
+	IfName      string      `json:"ifName,omitempty"`
+	NICType     cns.NICType `json:"nicType,omitempty"`
+	MacAddress  string      `json:"macAddress,omitempty"`
+	IPAddresses []string    `json:"ipAddresses,omitempty"`
+}
+
+// Phase is how long a phase of the command took.
+type Phase struct {
+	Name     string           `json:"name"`
+	Duration acntime.Duration `json:"duration"`
+}
+
+// New starts recording the command invoked with args.
+func New(command string, args *cniSkel.CmdArgs) *Invocation {
+	now := time.Now()
+	inv := &Invocation{
+		Command:     command,
+		Start:       now,
+		ContainerID: args.ContainerID,
+		Netns:       args.Netns,
+		IfName:      args.IfName,
+		Args:        args.Args,
+		Path:        args.Path,
+		phaseStart:  now,
+	}
+	if len(args.StdinData) > 0 {
+		sum := sha256.Sum256(args.StdinData)
+		inv.StdinData = redactNetconf(args.StdinData)
+		inv.NetconfHash = hex.EncodeToString(sum[:])
+	}
+	return inv
+}
+
+// redacted replaces secrets in the recorded network configuration.
+const redacted = "REDACTED"
+
+// redactNetconf returns the network configuration with the values of the tracing export headers, which are
+// typically credentials, redacted. A configuration which isn't a JSON object isn't recorded, since its secrets
+// can't be found.
+func redactNetconf(stdinData []byte) string {
+	var netconf map[string]json.RawMessage
+	if err := json.Unmarshal(stdinData, &netconf); err != nil {
+		return ""
+	}
+	rawTracing, ok := netconf["tracing"]
+	if !ok {
+		return string(stdinData)
+	}
+
+	var tracing map[string]json.RawMessage
+	if err := json.Unmarshal(rawTracing, &tracing); err != nil {
+		// the plugin fails to parse a tracing config which isn't an object, so there's nothing to record
+		delete(netconf, "tracing")
+	} else if rawHeaders, ok := tracing["otlpHeaders"]; ok {
+		var headers map[string]json.RawMessage
+		if err := json.Unmarshal(rawHeaders, &headers); err != nil {
+			delete(tracing, "otlpHeaders")
+		} else {
+			for name := range headers {
+				headers[name], _ = json.Marshal(redacted)
+			}
+			tracing["otlpHeaders"], _ = json.Marshal(headers)
+		}
+		netconf["tracing"], _ = json.Marshal(tracing)
+	}
+
+	redactedNetconf, err := json.Marshal(netconf)
+	if err != nil {
+		return ""
+	}
+	return string(redactedNetconf)
+}
+
+// StartPhase ends the current phase, if any, and starts timing the named phase.
+func (inv *Invocation) StartPhase(name string) {
+	inv.endPhase()
+	inv.Phases = append(inv.Phases, Phase{Name: name})
+	inv.inPhase = true
+}
+
+// SetEndpoints records the endpoints the command created or deleted.
+func (inv *Invocation) SetEndpoints(epInfos []*network.EndpointInfo) {
+	inv.Endpoints = inv.Endpoints[:0]
+	for _, epInfo := range epInfos {
+		if epInfo == nil {
+			continue
+		}
+		ep := Endpoint{
+			EndpointID: epInfo.EndpointID,
+			NetworkID:  epInfo.NetworkID,
+			IfName:     epInfo.IfName,
+			NICType:    epInfo.NICType,
+			MacAddress: epInfo.MacAddress.String(),
+		}
+		for i := range epInfo.IPAddresses {
+			ep.IPAddresses = append(ep.IPAddresses, epInfo.IPAddresses[i].String())
+		}
+		inv.Endpoints = append(inv.Endpoints, ep)
+	}
+}
+
+// Finish ends the current phase and records the outcome of the command.
+func (inv *Invocation) Finish(err error) {
+	inv.endPhase()
+	inv.Duration = acntime.Duration{Duration: time.Since(inv.Start)}
+	if err != nil {
+		inv.Error = err.Error()
+	}
+}
+
+// Matches returns whether the invocation was for the container or the pod.
+// Containers match by ID prefix, and pods either by name or by namespace/name.
+// Empty arguments match any invocation.
+func (inv *Invocation) Matches(containerID, pod string) bool {
+	if containerID != "" && !strings.HasPrefix(inv.ContainerID, containerID) {
+		return false
+	}
+	if pod == "" {
+		return true
+	}
+	if namespace, name, ok := strings.Cut(pod, "/"); ok {
+		return inv.PodNamespace == namespace && inv.PodName == name
+	}
+	return inv.PodName == pod
+}
+
+func (inv *Invocation) endPhase() {
+	now := time.Now()
+	if inv.inPhase {
+		inv.Phases[len(inv.Phases)-1].Duration = acntime.Duration{Duration: now.Sub(inv.phaseStart)}
+	}
+	inv.phaseStart = now
+	inv.inPhase = false
+}
@@ -0,0 +1,47 @@
+package events
+
+import (
+	"testing"
+
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRedactsNetconf(t *testing.T) {
+	tests := []struct {
+		name  string
+		stdin string
+		want  string
+	}{
+		{
+			name:  "without tracing",
+			stdin: `{"name":"azure","type":"azure-vnet"}`,
+			want:  `{"name":"azure","type":"azure-vnet"}`,
+		},
+		{
+			name:  "tracing headers",
+			stdin: `{"name":"azure","tracing":{"otlpEndpoint":"collector:4318","otlpHeaders":{"Authorization":"Bearer secret"}}}`,
+			want:  `{"name":"azure","tracing":{"otlpEndpoint":"collector:4318","otlpHeaders":{"Authorization":"REDACTED"}}}`,
+		},
+		{
+			name:  "malformed tracing headers",
+			stdin: `{"name":"azure","tracing":{"otlpHeaders":"Bearer secret"}}`,
+			want:  `{"name":"azure","tracing":{}}`,
+		},
+		{
+			name:  "not an object",
+			stdin: `"Bearer secret"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv := New("ADD", &cniSkel.CmdArgs{StdinData: []byte(tt.stdin)})
+			if tt.want == "" {
+				require.Empty(t, inv.StdinData)
+			} else {
+				require.JSONEq(t, tt.want, inv.StdinData)
+			}
+			require.NotEmpty(t, inv.NetconfHash)
+		})
+	}
+}
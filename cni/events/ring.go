@@ -0,0 +1,143 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/Azure/azure-container-networking/cni/log"
+	"github.com/Azure/azure-container-networking/internal/lockedfile"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultMaxEntries is the number of invocations kept by the default ring file.
+	DefaultMaxEntries = 256
+	ringFilePerm      = 0o600
+	// maxLineSize bounds the size of a single record when reading the ring file.
+	maxLineSize = 1 << 20
+)
+
+// DefaultPath is the path of the ring file the CNI plugin records its invocations to.
+var DefaultPath = log.LogPath + "azure-vnet-events.jsonl"
+
+// Recorder records invocations.
+type Recorder interface {
+	Record(inv *Invocation) error
+}
+
+// Ring is a file of the most recent invocations, as one JSON record per line, oldest first.
+// Once it holds maxEntries records, recording an invocation drops the oldest one.
+//
+// The file is replaced atomically, so readers always see a complete file. Writers are serialized
+// by a lock file next to it, since the CNI plugin doesn't hold its store lock in every mode.
+type Ring struct {
+	path       string
+	maxEntries int
+	mu         *lockedfile.Mutex
+}
+
+// NewRing returns a Ring at path, which keeps at most maxEntries invocations.
+func NewRing(path string, maxEntries int) *Ring {
+	return &Ring{path: path, maxEntries: maxEntries, mu: lockedfile.MutexAt(path + ".lock")}
+}
+
+// Record appends the invocation to the ring file.
+func (r *Ring) Record(inv *Invocation) error {
+	record, err := json.Marshal(inv)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal invocation")
+	}
+
+	// the ring file is read, modified and replaced under the lock, so that no record is lost
+	unlock, err := r.mu.Lock()
+	if err != nil {
+		return errors.Wrap(err, "failed to lock ring file")
+	}
+	defer unlock()
+
+	lines, err := r.lines()
+	if err != nil {
+		return err
+	}
+	lines = append(lines, record)
+	if len(lines) > r.maxEntries {
+		lines = lines[len(lines)-r.maxEntries:]
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), filepath.Base(r.path)+".*")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary ring file")
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck // the file was renamed on success
+	w := bufio.NewWriter(tmp)
+	for _, line := range lines {
+		_, _ = w.Write(line)
+		_ = w.WriteByte('\n')
+	}
+	if err = w.Flush(); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "failed to write ring file")
+	}
+	if err = tmp.Chmod(ringFilePerm); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "failed to set ring file permissions")
+	}
+	if err = tmp.Close(); err != nil {
+		return errors.Wrap(err, "failed to close ring file")
+	}
+	return errors.Wrap(os.Rename(tmp.Name(), r.path), "failed to replace ring file")
+}
+
+// Read returns the invocations in the ring file, oldest first.
+// Records which can't be decoded are skipped.
+func (r *Ring) Read() ([]Invocation, error) {
+	lines, err := r.lines()
+	if err != nil {
+		return nil, err
+	}
+	invs := make([]Invocation, 0, len(lines))
+	for _, line := range lines {
+		var inv Invocation
+		if err := json.Unmarshal(line, &inv); err != nil {
+			continue
+		}
+		invs = append(invs, inv)
+	}
+	return invs, nil
+}
+
+// lines returns the records in the ring file, which is empty if it doesn't exist yet.
+func (r *Ring) lines() ([][]byte, error) {
+	f, err := os.Open(r.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open ring file")
+	}
+	defer f.Close()
+
+	var lines [][]byte
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, maxLineSize)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			lines = append(lines, bytes.Clone(line))
+		}
+	}
+	return lines, errors.Wrap(scanner.Err(), "failed to read ring file")
+}
+
+// Filter returns the invocations which match the container or the pod, as in Invocation.Matches.
+func Filter(invs []Invocation, containerID, pod string) []Invocation {
+	var matched []Invocation
+	for i := range invs {
+		if invs[i].Matches(containerID, pod) {
+			matched = append(matched, invs[i])
+		}
+	}
+	return matched
+}
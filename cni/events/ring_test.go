@@ -0,0 +1,104 @@
+package events
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	ring := NewRing(path, 3)
+
+	// reading a ring file which doesn't exist yet returns no invocations
+	invs, err := ring.Read()
+	require.NoError(t, err)
+	require.Empty(t, invs)
+
+	for i := 0; i < 5; i++ {
+		inv := New("ADD", &cniSkel.CmdArgs{ContainerID: "container-" + strconv.Itoa(i), StdinData: []byte(`{"name":"azure"}`)})
+		inv.StartPhase("parse")
+		inv.StartPhase("ipam")
+		inv.Finish(errors.New("ipam failed"))
+		require.NoError(t, ring.Record(inv))
+	}
+
+	// only the newest invocations are kept, oldest first
+	invs, err = ring.Read()
+	require.NoError(t, err)
+	require.Len(t, invs, 3)
+	for i, inv := range invs {
+		require.Equal(t, "container-"+strconv.Itoa(i+2), inv.ContainerID)
+		require.Equal(t, "ipam failed", inv.Error)
+		require.Len(t, inv.Phases, 2)
+		require.Equal(t, "ipam", inv.Phases[1].Name)
+		require.Len(t, inv.NetconfHash, 64)
+	}
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(ringFilePerm), info.Mode().Perm())
+}
+
+func TestRingConcurrentRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	// each invocation of the plugin records with its own Ring
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			inv := New("ADD", &cniSkel.CmdArgs{ContainerID: "container-" + strconv.Itoa(i)})
+			inv.Finish(nil)
+			require.NoError(t, NewRing(path, DefaultMaxEntries).Record(inv))
+		}(i)
+	}
+	wg.Wait()
+
+	invs, err := NewRing(path, DefaultMaxEntries).Read()
+	require.NoError(t, err)
+	require.Len(t, invs, 20, "no record should be lost")
+}
+
+func TestRingSkipsCorruptRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("{\"command\":\"DEL\",\"containerID\":\"a\"}\n{\"command\":\n"), ringFilePerm))
+
+	invs, err := NewRing(path, DefaultMaxEntries).Read()
+	require.NoError(t, err)
+	require.Len(t, invs, 1)
+	require.Equal(t, "a", invs[0].ContainerID)
+}
+
+func TestFilter(t *testing.T) {
+	invs := []Invocation{
+		{ContainerID: "abcdef", PodName: "coredns", PodNamespace: "kube-system"},
+		{ContainerID: "abc123", PodName: "coredns", PodNamespace: "default"},
+		{ContainerID: "123456", PodName: "nginx", PodNamespace: "default"},
+	}
+	tests := []struct {
+		name        string
+		containerID string
+		pod         string
+		want        int
+	}{
+		{name: "all", want: 3},
+		{name: "container ID prefix", containerID: "abc", want: 2},
+		{name: "pod name", pod: "coredns", want: 2},
+		{name: "pod namespace and name", pod: "default/coredns", want: 1},
+		{name: "container and pod", containerID: "abc", pod: "kube-system/coredns", want: 1},
+		{name: "no match", containerID: "fff", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Len(t, Filter(invs, tt.containerID, tt.pod), tt.want)
+		})
+	}
+}
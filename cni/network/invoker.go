@@ -1,6 +1,7 @@
 package network
 
 import (
+	"context"
 	"net"
 
 	"github.com/Azure/azure-container-networking/cni"
@@ -20,11 +21,21 @@ type IPAMInvoker interface {
 }
 
 type IPAMAddConfig struct {
+	// ctx carries the trace of the CNI command to the IPAM source.
+	ctx     context.Context
 	nwCfg   *cni.NetworkConfig
 	args    *cniSkel.CmdArgs
 	options map[string]interface{}
 }
 
+// requestCtx returns the context requests to the IPAM source are made with.
+func (ipamAddConfig IPAMAddConfig) requestCtx() context.Context {
+	if ipamAddConfig.ctx == nil {
+		return context.TODO()
+	}
+	return ipamAddConfig.ctx
+}
+
 type IPAMAddResult struct {
 	interfaceInfo map[string]network.InterfaceInfo
 	// ncResponse and host subnet prefix were moved into interface info
@@ -161,7 +161,7 @@ func (invoker *CNSIPAMInvoker) Add(addConfig IPAMAddConfig) (IPAMAddResult, erro
 	logger.Info("Requesting IP for pod using ipconfig",
 		zap.Any("pod", podInfo),
 		zap.Any("ipconfig", ipconfigs))
-	response, err := invoker.cnsClient.RequestIPs(context.TODO(), ipconfigs)
+	response, err := invoker.cnsClient.RequestIPs(addConfig.requestCtx(), ipconfigs)
 	if err != nil {
 		if cnscli.IsUnsupportedAPI(err) {
 			// If RequestIPs is not supported by CNS, use RequestIPAddress API
@@ -173,7 +173,7 @@ func (invoker *CNSIPAMInvoker) Add(addConfig IPAMAddConfig) (IPAMAddResult, erro
 				InfraContainerID:    addConfig.args.ContainerID,
 			}
 
-			res, errRequestIP := invoker.cnsClient.RequestIPAddress(context.TODO(), ipconfig)
+			res, errRequestIP := invoker.cnsClient.RequestIPAddress(addConfig.requestCtx(), ipconfig)
 			if errRequestIP != nil {
 				// if the old API fails as well then we just return the error
 				logger.Error("Failed to request IP address from CNS using RequestIPAddress",
@@ -14,6 +14,7 @@ import (
 
 	"github.com/Azure/azure-container-networking/cni"
 	"github.com/Azure/azure-container-networking/cni/api"
+	"github.com/Azure/azure-container-networking/cni/events"
 	"github.com/Azure/azure-container-networking/cni/log"
 	"github.com/Azure/azure-container-networking/cni/util"
 	"github.com/Azure/azure-container-networking/cns"
@@ -29,10 +30,13 @@ import (
 	nnscontracts "github.com/Azure/azure-container-networking/proto/nodenetworkservice/3.302.0.744"
 	"github.com/Azure/azure-container-networking/store"
 	"github.com/Azure/azure-container-networking/telemetry"
+	"github.com/Azure/azure-container-networking/tracing"
 	cniSkel "github.com/containernetworking/cni/pkg/skel"
 	cniTypes "github.com/containernetworking/cni/pkg/types"
 	cniTypesCurr "github.com/containernetworking/cni/pkg/types/100"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -48,10 +52,12 @@ const (
 	// Supported IP version. Currently support only IPv4
 	ipamV6                = "azure-vnet-ipamv6"
 	defaultRequestTimeout = 15 * time.Second
-	ipv4FullMask          = 32
-	ipv6FullMask          = 128
-	ibInterfacePrefix     = "ib"
-	apipaInterfacePrefix  = "apipa"
+	// tracingShutdownTimeout bounds how long a command waits to export its spans
+	tracingShutdownTimeout = 2 * time.Second
+	ipv4FullMask           = 32
+	ipv6FullMask           = 128
+	ibInterfacePrefix      = "ib"
+	apipaInterfacePrefix   = "apipa"
 )
 
 // CNI Operation Types
@@ -84,6 +90,8 @@ type NetPlugin struct {
 	nnsClient          NnsClient
 	multitenancyClient MultitenancyClient
 	netClient          InterfaceGetter
+	recorder           events.Recorder
+	reportOperations   bool
 }
 
 type PolicyArgs struct {
@@ -147,6 +155,23 @@ func NewPlugin(name string,
 	}, nil
 }
 
+// SetRecorder sets where the plugin records its ADD and DEL invocations. Invocations aren't recorded by default.
+func (plugin *NetPlugin) SetRecorder(recorder events.Recorder) {
+	plugin.recorder = recorder
+}
+
+// record finishes recording the invocation and reports it to CNS, neither of which must fail the command.
+// nwCfg is nil if the network configuration couldn't be parsed.
+func (plugin *NetPlugin) record(inv *events.Invocation, nwCfg *cni.NetworkConfig, err error) {
+	inv.Finish(err)
+	if plugin.recorder != nil {
+		if recordErr := plugin.recorder.Record(inv); recordErr != nil {
+			logger.Warn("Failed to record invocation", zap.String("containerID", inv.ContainerID), zap.Error(recordErr))
+		}
+	}
+	plugin.reportOperation(inv, nwCfg)
+}
+
 // Starts the plugin.
 func (plugin *NetPlugin) Start(config *common.PluginConfig) error {
 	// Initialize base plugin.
@@ -320,13 +345,46 @@ func addNatIPV6SubnetInfo(nwCfg *cni.NetworkConfig,
 }
 
 func (plugin *NetPlugin) addIpamInvoker(ipamAddConfig IPAMAddConfig) (IPAMAddResult, error) {
+	var span trace.Span
+	ipamAddConfig.ctx, span = tracing.Start(ipamAddConfig.requestCtx(), "NetPlugin.addIpamInvoker")
 	ipamAddResult, err := plugin.ipamInvoker.Add(ipamAddConfig)
+	tracing.End(span, err)
 	if err != nil {
 		return IPAMAddResult{}, errors.Wrap(err, "failed to add ipam invoker")
 	}
 	return ipamAddResult, nil
 }
 
+// initTracing starts exporting the spans of this command if tracing is configured.
+// The returned func flushes the spans, and must be called before the command completes.
+func (plugin *NetPlugin) initTracing(nwCfg *cni.NetworkConfig) func() {
+	if nwCfg.Tracing == nil {
+		return func() {}
+	}
+	shutdown, err := tracing.Init(context.Background(), plugin.Name, *nwCfg.Tracing)
+	if err != nil {
+		// tracing is best effort, so don't fail the command
+		logger.Error("Failed to initialize tracing", zap.Error(err))
+		return func() {}
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			logger.Error("Failed to export traces", zap.Error(err))
+		}
+	}
+}
+
+// operationStatusDimensions returns the custom dimensions of the duration metric of a command which completed with err.
+func operationStatusDimensions(err error) map[string]string {
+	status := telemetry.SucceededStr
+	if err != nil {
+		status = telemetry.FailedStr
+	}
+	return map[string]string{telemetry.StatusStr: status}
+}
+
 // get network
 func (plugin *NetPlugin) getNetworkID(netNs string, interfaceInfo *network.InterfaceInfo, nwCfg *cni.NetworkConfig) (string, error) {
 	networkID, err := plugin.getNetworkName(netNs, interfaceInfo, nwCfg)
@@ -356,9 +414,17 @@ func (plugin *NetPlugin) Add(args *cniSkel.CmdArgs) error {
 		enableSnatForDNS bool
 		k8sPodName       string
 		epInfos          []*network.EndpointInfo
+		nwCfg            *cni.NetworkConfig
+		err              error
 	)
 
 	startTime := time.Now()
+	inv := events.New(CNI_ADD, args)
+	defer func() {
+		inv.IPAMResult = ipamAddResult.interfaceInfo
+		inv.SetEndpoints(epInfos)
+		plugin.record(inv, nwCfg, err)
+	}()
 	logger.Info("Processing ADD command",
 		zap.String("containerId", args.ContainerID),
 		zap.String("netNS", args.Netns),
@@ -368,7 +434,8 @@ func (plugin *NetPlugin) Add(args *cniSkel.CmdArgs) error {
 		zap.ByteString("stdinData", args.StdinData))
 
 	// Parse network configuration from stdin.
-	nwCfg, err := cni.ParseNetworkConfig(args.StdinData)
+	inv.StartPhase(cns.CNIPhaseParse)
+	nwCfg, err = cni.ParseNetworkConfig(args.StdinData)
 	if err != nil {
 		err = plugin.Errorf("Failed to parse network configuration: %v.", err)
 		return err
@@ -384,8 +451,17 @@ func (plugin *NetPlugin) Add(args *cniSkel.CmdArgs) error {
 	if err != nil {
 		return err
 	}
+	inv.PodName, inv.PodNamespace = k8sPodName, k8sNamespace
 	telemetryClient.Settings().ContainerName = k8sPodName + ":" + k8sNamespace
 
+	shutdownTracing := plugin.initTracing(nwCfg)
+	defer shutdownTracing()
+	ctx, span := tracing.Start(context.Background(), "NetPlugin.Add",
+		attribute.String("container.id", args.ContainerID),
+		attribute.String("k8s.pod.name", k8sPodName),
+		attribute.String("k8s.namespace.name", k8sNamespace))
+	defer func() { tracing.End(span, err) }()
+
 	plugin.setCNIReportDetails(args.ContainerID, CNI_ADD, "")
 	telemetryClient.SendEvent(fmt.Sprintf("[cni-net] Processing ADD command with args {ContainerID:%v Netns:%v IfName:%v Args:%v Path:%v StdinData:%s}.",
 		args.ContainerID, args.Netns, args.IfName, args.Args, args.Path, args.StdinData))
@@ -441,7 +517,7 @@ func (plugin *NetPlugin) Add(args *cniSkel.CmdArgs) error {
 		telemetryClient.SendEvent(fmt.Sprintf("ADD command completed with [ipamAddResult]: %s [epInfos]: %s [error]: %v ", ipamAddResult.PrettyString(), network.FormatSliceOfPointersToString(epInfos), err))
 
 		operationTimeMs := time.Since(startTime).Milliseconds()
-		telemetryClient.SendMetric(telemetry.CNIAddTimeMetricStr, float64(operationTimeMs), make(map[string]string))
+		telemetryClient.SendMetric(telemetry.CNIAddTimeMetricStr, float64(operationTimeMs), operationStatusDimensions(err))
 	}()
 
 	ipamAddResult = IPAMAddResult{interfaceInfo: make(map[string]network.InterfaceInfo)}
@@ -450,20 +526,23 @@ func (plugin *NetPlugin) Add(args *cniSkel.CmdArgs) error {
 	if len(k8sContainerID) == 0 {
 		errMsg := "Container ID not specified in CNI Args"
 		logger.Error(errMsg)
-		return plugin.Errorf("%s", errMsg)
+		err = plugin.Errorf("%s", errMsg)
+		return err
 	}
 
 	k8sIfName := args.IfName
 	if len(k8sIfName) == 0 {
 		errMsg := "Interfacename not specified in CNI Args"
 		logger.Error(errMsg)
-		return plugin.Errorf("%s", errMsg)
+		err = plugin.Errorf("%s", errMsg)
+		return err
 	}
 
 	platformInit(nwCfg)
 	if nwCfg.ExecutionMode == string(util.Baremetal) {
 		var res *nnscontracts.ConfigureContainerNetworkingResponse
 		logger.Info("Baremetal mode. Calling vnet agent for ADD")
+		inv.StartPhase(cns.CNIPhaseNNS)
 		res, err = plugin.nnsClient.AddContainerNetworking(context.Background(), k8sPodName, args.Netns)
 
 		if err == nil {
@@ -491,8 +570,9 @@ func (plugin *NetPlugin) Add(args *cniSkel.CmdArgs) error {
 	}
 
 	options := make(map[string]any)
-	ipamAddConfig := IPAMAddConfig{nwCfg: nwCfg, args: args, options: options}
+	ipamAddConfig := IPAMAddConfig{ctx: ctx, nwCfg: nwCfg, args: args, options: options}
 
+	inv.StartPhase(cns.CNIPhaseIPAM)
 	if nwCfg.MultiTenancy {
 		// triggered only in swift v1 multitenancy
 		// dual nic multitenancy -> two interface infos
@@ -506,7 +586,7 @@ func (plugin *NetPlugin) Add(args *cniSkel.CmdArgs) error {
 			return fmt.Errorf("%w", err)
 		}
 
-		ipamAddResult, err = plugin.multitenancyClient.GetAllNetworkContainers(context.TODO(), nwCfg, k8sPodName, k8sNamespace, args.IfName)
+		ipamAddResult, err = plugin.multitenancyClient.GetAllNetworkContainers(ctx, nwCfg, k8sPodName, k8sNamespace, args.IfName)
 		if err != nil {
 			err = fmt.Errorf("GetAllNetworkContainers failed for podname %s namespace %s. error: %w", k8sPodName, k8sNamespace, err)
 			logger.Error("GetAllNetworkContainers failed",
@@ -520,7 +600,8 @@ func (plugin *NetPlugin) Add(args *cniSkel.CmdArgs) error {
 			errMsg := fmt.Sprintf("received multiple NC results %+v from CNS while dualnic feature is not supported", ipamAddResult.interfaceInfo)
 			logger.Error("received multiple NC results from CNS while dualnic feature is not supported",
 				zap.Any("results", ipamAddResult.interfaceInfo))
-			return plugin.Errorf("%s", errMsg)
+			err = plugin.Errorf("%s", errMsg)
+			return err
 		}
 	} else {
 		// when nwcfg.multitenancy (use multitenancy flag for swift v1 only) is false
@@ -557,6 +638,7 @@ func (plugin *NetPlugin) Add(args *cniSkel.CmdArgs) error {
 		}
 	}()
 
+	inv.StartPhase(cns.CNIPhaseEndpointInfo)
 	infraSeen := false
 	endpointIndex := 1
 
@@ -625,7 +707,8 @@ func (plugin *NetPlugin) Add(args *cniSkel.CmdArgs) error {
 		}
 	}()
 
-	err = plugin.nm.EndpointCreate(cnsclient, epInfos)
+	inv.StartPhase(cns.CNIPhaseEndpointCreate)
+	err = plugin.nm.EndpointCreate(ctx, cnsclient, epInfos)
 	if err != nil {
 		return errors.Wrap(err, "failed to create endpoint") // behavior can change if you don't assign to err prior to returning
 	}
@@ -968,8 +1051,14 @@ func (plugin *NetPlugin) Delete(args *cniSkel.CmdArgs) error {
 		k8sNamespace string
 		networkID    string
 		nwInfo       network.EndpointInfo
+		epInfos      []*network.EndpointInfo
 	)
 	startTime := time.Now()
+	inv := events.New(CNI_DEL, args)
+	defer func() {
+		inv.SetEndpoints(epInfos)
+		plugin.record(inv, nwCfg, err)
+	}()
 	logger.Info("Processing DEL command",
 		zap.String("containerId", args.ContainerID),
 		zap.String("netNS", args.Netns),
@@ -984,10 +1073,11 @@ func (plugin *NetPlugin) Delete(args *cniSkel.CmdArgs) error {
 			zap.Error(log.NewErrorWithoutStackTrace(err)))
 		telemetryClient.SendEvent(fmt.Sprintf("DEL command completed: [podname]: %s [namespace]: %s [error]: %v", k8sPodName, k8sNamespace, err))
 		operationTimeMs := time.Since(startTime).Milliseconds()
-		telemetryClient.SendMetric(telemetry.CNIDelTimeMetricStr, float64(operationTimeMs), make(map[string]string))
+		telemetryClient.SendMetric(telemetry.CNIDelTimeMetricStr, float64(operationTimeMs), operationStatusDimensions(err))
 	}()
 
 	// Parse network configuration from stdin.
+	inv.StartPhase(cns.CNIPhaseParse)
 	if nwCfg, err = cni.ParseNetworkConfig(args.StdinData); err != nil {
 		err = plugin.Errorf("[cni-net] Failed to parse network configuration: %v", err)
 		return err
@@ -1002,6 +1092,7 @@ func (plugin *NetPlugin) Delete(args *cniSkel.CmdArgs) error {
 	if k8sPodName, k8sNamespace, err = plugin.getPodInfo(args.Args); err != nil {
 		logger.Error("Failed to get POD info", zap.Error(err))
 	}
+	inv.PodName, inv.PodNamespace = k8sPodName, k8sNamespace
 	telemetryClient.Settings().ContainerName = k8sPodName + ":" + k8sNamespace
 
 	plugin.setCNIReportDetails(args.ContainerID, CNI_DEL, "")
@@ -1014,6 +1105,7 @@ func (plugin *NetPlugin) Delete(args *cniSkel.CmdArgs) error {
 
 	logger.Info("Execution mode", zap.String("mode", nwCfg.ExecutionMode))
 	if nwCfg.ExecutionMode == string(util.Baremetal) {
+		inv.StartPhase(cns.CNIPhaseNNS)
 		_, err = plugin.nnsClient.DeleteContainerNetworking(context.Background(), k8sPodName, args.Netns)
 		if err != nil {
 			return fmt.Errorf("nnsClient.DeleteContainerNetworking failed with err %w", err)
@@ -1042,6 +1134,7 @@ func (plugin *NetPlugin) Delete(args *cniSkel.CmdArgs) error {
 	// with CNI SPEC as mentioned below.
 
 	// We get the network id and nw info here to preserve existing behavior
+	inv.StartPhase(cns.CNIPhaseEndpointState)
 	networkID, err = plugin.getNetworkID(args.Netns, nil, nwCfg)
 	if nwInfo, err = plugin.nm.GetNetworkInfo(networkID); err != nil {
 		if !nwCfg.MultiTenancy {
@@ -1072,7 +1165,6 @@ func (plugin *NetPlugin) Delete(args *cniSkel.CmdArgs) error {
 	}
 	logger.Info("Retrieved network info, populating endpoint infos with container id", zap.String("containerID", args.ContainerID))
 
-	var epInfos []*network.EndpointInfo
 	if plugin.nm.IsStatelessCNIMode() {
 		// network ID is passed in and used only for migration
 		// otherwise, in stateless, we don't need the network id for deletion
@@ -1096,6 +1188,7 @@ func (plugin *NetPlugin) Delete(args *cniSkel.CmdArgs) error {
 	if len(epInfos) == 0 {
 		endpointID := plugin.nm.GetEndpointID(args.ContainerID, args.IfName)
 		if !nwCfg.MultiTenancy {
+			inv.StartPhase(cns.CNIPhaseIPAM)
 			logger.Warn("Could not query endpoint",
 				zap.String("endpoint", endpointID),
 				zap.Error(err))
@@ -1111,6 +1204,7 @@ func (plugin *NetPlugin) Delete(args *cniSkel.CmdArgs) error {
 		return err
 	}
 	logger.Info("Deleting the endpoints", zap.Any("endpointInfos", epInfos))
+	inv.StartPhase(cns.CNIPhaseEndpointDelete)
 	// populate ep infos here in loop if necessary
 	// delete endpoints
 	for _, epInfo := range epInfos {
@@ -1124,6 +1218,7 @@ func (plugin *NetPlugin) Delete(args *cniSkel.CmdArgs) error {
 		}
 	}
 	logger.Info("Deleting the endpoints from the ipam")
+	inv.StartPhase(cns.CNIPhaseIPAM)
 	// delete endpoint state in cns and in statefile
 	for _, epInfo := range epInfos {
 		// Skip known non-Infra NIC types: their IPs are not allocated by ipamInvoker.Add
@@ -1161,6 +1256,7 @@ func (plugin *NetPlugin) Delete(args *cniSkel.CmdArgs) error {
 		}
 	}
 	logger.Info("Deleting endpoint state from statefile")
+	inv.StartPhase(cns.CNIPhaseState)
 	err = plugin.nm.DeleteState(epInfos)
 	if err != nil {
 		return plugin.RetriableError(fmt.Errorf("failed to delete state: %w", err))
@@ -1182,12 +1278,18 @@ func (plugin *NetPlugin) Update(args *cniSkel.CmdArgs) error {
 		targetNetworkConfig *cns.GetNetworkContainerResponse
 	)
 
+	startTime := time.Now()
+	inv := events.New(CNI_UPDATE, args)
+	defer func() {
+		plugin.record(inv, nwCfg, err)
+	}()
 	logger.Info("Processing UPDATE command",
 		zap.String("netns", args.Netns),
 		zap.String("args", args.Args),
 		zap.String("path", args.Path))
 
 	// Parse network configuration from stdin.
+	inv.StartPhase(cns.CNIPhaseParse)
 	if nwCfg, err = cni.ParseNetworkConfig(args.StdinData); err != nil {
 		err = plugin.Errorf("Failed to parse network configuration: %v.", err)
 		return err
@@ -1223,6 +1325,9 @@ func (plugin *NetPlugin) Update(args *cniSkel.CmdArgs) error {
 		logger.Info("UPDATE command completed",
 			zap.Any("result", result),
 			zap.Error(log.NewErrorWithoutStackTrace(err)))
+
+		operationTimeMs := time.Since(startTime).Milliseconds()
+		telemetryClient.SendMetric(telemetry.CNIUpdateTimeMetricStr, float64(operationTimeMs), operationStatusDimensions(err))
 	}()
 
 	// Parse Pod arguments.
@@ -1236,24 +1341,29 @@ func (plugin *NetPlugin) Update(args *cniSkel.CmdArgs) error {
 	if len(k8sNamespace) == 0 {
 		errMsg := "Required parameter Pod Namespace not specified in CNI Args during UPDATE"
 		logger.Error(errMsg)
-		return plugin.Errorf("%s", errMsg)
+		err = plugin.Errorf("%s", errMsg)
+		return err
 	}
 
 	k8sPodName := string(podCfg.K8S_POD_NAME)
 	if len(k8sPodName) == 0 {
 		errMsg := "Required parameter Pod Name not specified in CNI Args during UPDATE"
 		logger.Error(errMsg)
-		return plugin.Errorf("%s", errMsg)
+		err = plugin.Errorf("%s", errMsg)
+		return err
 	}
+	inv.PodName, inv.PodNamespace = k8sPodName, k8sNamespace
 
 	// Initialize values from network config.
 	networkID := nwCfg.Name
 
 	// Query the network.
+	inv.StartPhase(cns.CNIPhaseEndpointState)
 	if _, err = plugin.nm.GetNetworkInfo(networkID); err != nil {
 		errMsg := fmt.Sprintf("Failed to query network during CNI UPDATE: %v", err)
 		logger.Error(errMsg)
-		return plugin.Errorf("%s", errMsg)
+		err = plugin.Errorf("%s", errMsg)
+		return err
 	}
 
 	// Query the existing endpoint since this is an update.
@@ -1277,10 +1387,12 @@ func (plugin *NetPlugin) Update(args *cniSkel.CmdArgs) error {
 		PodName:      k8sPodName,
 		PodNamespace: k8sNamespace,
 	}
+	inv.StartPhase(cns.CNIPhaseCNS)
 	if orchestratorContext, err = json.Marshal(podInfo); err != nil {
 		logger.Error("Marshalling KubernetesPodInfo failed",
 			zap.Error(err))
-		return plugin.Errorf("%s", err.Error())
+		err = plugin.Errorf("%s", err.Error())
+		return err
 	}
 
 	cnsclient, err := cnscli.New(nwCfg.CNSUrl, defaultRequestTimeout)
@@ -1288,13 +1400,15 @@ func (plugin *NetPlugin) Update(args *cniSkel.CmdArgs) error {
 		logger.Error("failed to initialized cns client",
 			zap.String("url", nwCfg.CNSUrl),
 			zap.String("error", err.Error()))
-		return plugin.Errorf("%s", err.Error())
+		err = plugin.Errorf("%s", err.Error())
+		return err
 	}
 
 	if targetNetworkConfig, err = cnsclient.GetNetworkContainer(context.TODO(), orchestratorContext); err != nil {
 		logger.Info("GetNetworkContainer failed",
 			zap.Error(err))
-		return plugin.Errorf("%s", err.Error())
+		err = plugin.Errorf("%s", err.Error())
+		return err
 	}
 
 	logger.Info("Network config received from cns",
@@ -1341,6 +1455,7 @@ func (plugin *NetPlugin) Update(args *cniSkel.CmdArgs) error {
 	}
 
 	// Update the endpoint.
+	inv.StartPhase(cns.CNIPhaseEndpointUpdate)
 	logger.Info("Now updating existing endpoint with targetNetworkConfig",
 		zap.String("endpoint", existingEpInfo.EndpointID),
 		zap.Any("config", targetNetworkConfig))
@@ -0,0 +1,77 @@
+package network
+
+import (
+	"context"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cni"
+	"github.com/Azure/azure-container-networking/cni/events"
+	"github.com/Azure/azure-container-networking/cns"
+	cnscli "github.com/Azure/azure-container-networking/cns/client"
+	"github.com/Azure/azure-container-networking/network"
+	"go.uber.org/zap"
+)
+
+// operationReportTimeout bounds how long a command waits for CNS to take its report, so CNS can't slow CNI down.
+const operationReportTimeout = time.Second
+
+// ReportOperationsToCNS makes the plugin report the duration and result of its commands to CNS,
+// which aggregates them into metrics. Commands are only reported when CNS is in use.
+func (plugin *NetPlugin) ReportOperationsToCNS() {
+	plugin.reportOperations = true
+}
+
+// reportOperation reports the invocation to CNS, which must not fail the command.
+func (plugin *NetPlugin) reportOperation(inv *events.Invocation, nwCfg *cni.NetworkConfig) {
+	if !plugin.reportOperations || nwCfg == nil || (nwCfg.IPAM.Type != network.AzureCNS && !nwCfg.MultiTenancy) {
+		return
+	}
+	cnsClient, err := cnscli.New(nwCfg.CNSUrl, operationReportTimeout)
+	if err != nil {
+		logger.Warn("Failed to create cns client to report operation", zap.Error(err))
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), operationReportTimeout)
+	defer cancel()
+	if err := cnsClient.ReportCNIOperation(ctx, newCNIOperationReport(inv)); err != nil {
+		logger.Warn("Failed to report operation to CNS", zap.String("operation", inv.Command), zap.Error(err))
+	}
+}
+
+func newCNIOperationReport(inv *events.Invocation) *cns.CNIOperationReport {
+	report := &cns.CNIOperationReport{
+		Operation: inv.Command,
+		NICType:   operationNICType(inv),
+		Duration:  inv.Duration,
+	}
+	for _, phase := range inv.Phases {
+		report.Phases = append(report.Phases, cns.CNIOperationPhase{Name: phase.Name, Duration: phase.Duration})
+	}
+	// a command fails in the phase it ended in.
+	if inv.Error != "" && len(inv.Phases) > 0 {
+		report.ErrorClass = inv.Phases[len(inv.Phases)-1].Name
+	}
+	return report
+}
+
+// operationNICType returns the type of the NIC the command was for, preferring the infra NIC when there are several.
+func operationNICType(inv *events.Invocation) cns.NICType {
+	var nicType cns.NICType
+	for i := range inv.Endpoints {
+		if inv.Endpoints[i].NICType == cns.InfraNIC {
+			return cns.InfraNIC
+		}
+		if nicType == "" {
+			nicType = inv.Endpoints[i].NICType
+		}
+	}
+	for key := range inv.IPAMResult {
+		if inv.IPAMResult[key].NICType == cns.InfraNIC {
+			return cns.InfraNIC
+		}
+		if nicType == "" {
+			nicType = inv.IPAMResult[key].NICType
+		}
+	}
+	return nicType
+}
@@ -0,0 +1,49 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cni/events"
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/network"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCNIOperationReport(t *testing.T) {
+	tests := []struct {
+		name           string
+		inv            *events.Invocation
+		wantNICType    cns.NICType
+		wantErrorClass string
+	}{
+		{
+			name: "success",
+			inv: &events.Invocation{
+				Command:   CNI_ADD,
+				Phases:    []events.Phase{{Name: "parse"}, {Name: "ipam"}, {Name: "endpointCreate"}},
+				Endpoints: []events.Endpoint{{NICType: cns.DelegatedVMNIC}, {NICType: cns.InfraNIC}},
+			},
+			wantNICType: cns.InfraNIC,
+		},
+		{
+			name: "failed in ipam",
+			inv: &events.Invocation{
+				Command:    CNI_ADD,
+				Phases:     []events.Phase{{Name: "parse"}, {Name: "ipam"}},
+				IPAMResult: map[string]network.InterfaceInfo{"key": {NICType: cns.DelegatedVMNIC}},
+				Error:      "IPAM Invoker Add failed",
+			},
+			wantNICType:    cns.DelegatedVMNIC,
+			wantErrorClass: "ipam",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := newCNIOperationReport(tt.inv)
+			require.Equal(t, tt.inv.Command, report.Operation)
+			require.Equal(t, tt.wantNICType, report.NICType)
+			require.Equal(t, tt.wantErrorClass, report.ErrorClass)
+			require.Len(t, report.Phases, len(tt.inv.Phases))
+		})
+	}
+}
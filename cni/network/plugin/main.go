@@ -10,6 +10,7 @@ import (
 
 	"github.com/Azure/azure-container-networking/cni"
 	"github.com/Azure/azure-container-networking/cni/api"
+	"github.com/Azure/azure-container-networking/cni/events"
 	zaplog "github.com/Azure/azure-container-networking/cni/log"
 	"github.com/Azure/azure-container-networking/cni/network"
 	"github.com/Azure/azure-container-networking/common"
@@ -75,6 +76,8 @@ func rootExecute() error {
 		network.PrintCNIError(fmt.Sprintf("Failed to create network plugin, err:%v.\n", err))
 		return errors.Wrap(err, "Create plugin error")
 	}
+	netPlugin.SetRecorder(events.NewRing(events.DefaultPath, events.DefaultMaxEntries))
+	netPlugin.ReportOperationsToCNS()
 
 	// Check CNI_COMMAND value
 	cniCmd := os.Getenv(cni.Cmd)
@@ -0,0 +1,76 @@
+package network
+
+import (
+	"github.com/Azure/azure-container-networking/cni"
+	"github.com/Azure/azure-container-networking/cni/events"
+	"github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/network"
+	"github.com/Azure/azure-container-networking/nns"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	"github.com/pkg/errors"
+)
+
+// lastInvocation keeps the invocation recorded last.
+type lastInvocation struct {
+	inv *events.Invocation
+}
+
+func (l *lastInvocation) Record(inv *events.Invocation) error {
+	l.inv = inv
+	return nil
+}
+
+// replayIpamInvoker returns an IPAM invoker which returns the IPAM result of the invocation,
+// or fails as the invocation did if IPAM didn't return a result.
+func replayIpamInvoker(inv *events.Invocation) IPAMInvoker {
+	return &MockIpamInvoker{
+		add: func(IPAMAddConfig) (IPAMAddResult, error) {
+			if len(inv.IPAMResult) == 0 && inv.Error != "" {
+				return IPAMAddResult{}, errors.New(inv.Error)
+			}
+			return IPAMAddResult{interfaceInfo: inv.IPAMResult}, nil
+		},
+		ipMap: make(map[string]bool),
+	}
+}
+
+// Replay runs a recorded ADD again in dry-run, to debug how the plugin handled it.
+// IPAM returns the recorded IPAM result, and endpoints are created by a mock network manager, so the host isn't changed.
+// It returns the invocation recorded by the replay, whether the replayed ADD succeeded or not.
+func Replay(inv *events.Invocation) (*events.Invocation, error) {
+	if inv.Command != CNI_ADD {
+		return nil, errors.Errorf("only %s invocations can be replayed, not %s", CNI_ADD, inv.Command)
+	}
+	nwCfg, err := cni.ParseNetworkConfig([]byte(inv.StdinData))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse recorded network configuration")
+	}
+	if nwCfg.MultiTenancy {
+		return nil, errors.New("multitenancy invocations can't be replayed")
+	}
+	stdinData := []byte(inv.StdinData)
+	if nwCfg.Tracing != nil {
+		// don't export the spans of the replay to the collector of the recorded invocation.
+		nwCfg.Tracing = nil
+		stdinData = nwCfg.Serialize()
+	}
+
+	plugin, err := NewPlugin("replay", &common.PluginConfig{}, &nns.MockGrpcClient{}, &Multitenancy{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create plugin")
+	}
+	plugin.nm = network.NewMockNetworkmanager(network.NewMockEndpointClient(nil))
+	plugin.ipamInvoker = replayIpamInvoker(inv)
+	replayed := &lastInvocation{}
+	plugin.SetRecorder(replayed)
+
+	_ = plugin.Add(&cniSkel.CmdArgs{
+		ContainerID: inv.ContainerID,
+		Netns:       inv.Netns,
+		IfName:      inv.IfName,
+		Args:        inv.Args,
+		Path:        inv.Path,
+		StdinData:   stdinData,
+	})
+	return replayed.inv, nil
+}
@@ -0,0 +1,57 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cni/events"
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAndReplayAdd(t *testing.T) {
+	plugin := GetTestResources()
+	recorded := &lastInvocation{}
+	plugin.SetRecorder(recorded)
+
+	err := plugin.Add(&cniSkel.CmdArgs{
+		StdinData:   nwCfg.Serialize(),
+		ContainerID: "replay-container",
+		Netns:       "replay-container",
+		Args:        fmt.Sprintf("K8S_POD_NAME=%v;K8S_POD_NAMESPACE=%v", "test-pod", "test-pod-ns"),
+		IfName:      eth0IfName,
+	})
+	require.NoError(t, err)
+
+	inv := recorded.inv
+	require.NotNil(t, inv)
+	require.Equal(t, CNI_ADD, inv.Command)
+	require.Equal(t, "test-pod", inv.PodName)
+	require.Equal(t, "test-pod-ns", inv.PodNamespace)
+	require.Empty(t, inv.Error)
+	require.NotEmpty(t, inv.IPAMResult)
+	require.Len(t, inv.Endpoints, 1)
+	phases := make([]string, 0, len(inv.Phases))
+	for _, phase := range inv.Phases {
+		phases = append(phases, phase.Name)
+	}
+	require.Equal(t, []string{"parse", "ipam", "endpointInfo", "endpointCreate"}, phases)
+
+	// replay the invocation as it would be read back from the ring file
+	b, err := json.Marshal(inv)
+	require.NoError(t, err)
+	var stored events.Invocation
+	require.NoError(t, json.Unmarshal(b, &stored))
+
+	replayed, err := Replay(&stored)
+	require.NoError(t, err)
+	require.Empty(t, replayed.Error)
+	require.Equal(t, inv.NetconfHash, replayed.NetconfHash)
+	require.Equal(t, inv.Endpoints, replayed.Endpoints)
+}
+
+func TestReplayOnlyAdd(t *testing.T) {
+	_, err := Replay(&events.Invocation{Command: CNI_DEL})
+	require.Error(t, err)
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/Azure/azure-container-networking/cni/log"
 	acn "github.com/Azure/azure-container-networking/common"
 	"github.com/Azure/azure-container-networking/telemetry"
+	"github.com/Azure/azure-container-networking/telemetry/sinks"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -170,6 +171,14 @@ func main() {
 	if err := tb.CreateAITelemetryHandle(aiConfig, config.DisableAll, config.DisableTrace, config.DisableMetric); err != nil { // nolint
 		logger.Error("AI Handle creation error:", zap.Error(err))
 	}
+
+	telemetrySinks, err := sinks.New(context.Background(), config.Sinks, logger)
+	if err != nil {
+		logger.Error("Failed to create telemetry sinks", zap.Error(err))
+	}
+	for _, sink := range telemetrySinks {
+		tb.AddSink(sink)
+	}
 	logger.Info("Report to host interval", zap.Duration("seconds", config.ReportToHostIntervalInSeconds))
 	tb.PushData(context.Background())
 	telemetry.CloseAITelemetryHandle()
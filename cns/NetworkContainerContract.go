@@ -38,6 +38,7 @@ const (
 	PathDebugIPAddresses                     = "/debug/ipaddresses"
 	PathDebugPodContext                      = "/debug/podcontext"
 	PathDebugRestData                        = "/debug/restdata"
+	PathDebugPodBundle                       = "/debug/podbundle"
 	NumberOfCPUCores                         = NumberOfCPUCoresPath
 	NMAgentSupportedAPIs                     = NmAgentSupportedApisPath
 	EndpointAPI                              = EndpointPath
@@ -597,6 +598,12 @@ type GetPodContextResponse struct {
 	Response   Response
 }
 
+// PodDebugBundleRequest is used in CNS Client debug mode to get a tar.gz bundle of what is needed to debug the network of a pod
+type PodDebugBundleRequest struct {
+	PodNamespace string `json:"podNamespace"`
+	PodName      string `json:"podName"`
+}
+
 // IPAddressState Only used in the GetIPConfig API to return IPs that match a filter
 type IPAddressState struct {
 	IPAddress string
@@ -14,6 +14,7 @@ import (
 	"github.com/Azure/azure-container-networking/cns/types"
 	"github.com/Azure/azure-container-networking/crd/multitenancy/api/v1alpha1"
 	"github.com/Azure/azure-container-networking/crd/nodenetworkconfig/api/v1alpha"
+	acntime "github.com/Azure/azure-container-networking/internal/time"
 	"github.com/pkg/errors"
 )
 
@@ -35,6 +36,8 @@ const (
 	V2Prefix                      = "/v0.2"
 	EndpointPath                  = "/network/endpoints/"
 	IBDevicesPath                 = "/ibdevices"
+	LogLevelPath                  = "/debug/loglevel"
+	CNIOperationsPath             = "/network/cni/operations"
 	// Service Fabric SWIFTV2 mode
 	StandaloneSWIFTV2 SWIFTV2Mode = "StandaloneSWIFTV2"
 	// K8s SWIFTV2 mode
@@ -408,3 +411,59 @@ type GetIBDeviceStatusResponse struct {
 	Status       v1alpha1.InfinibandStatus `json:"status"`       // Device status (e.g., "Unprogrammed", "Programming", "Programmed" etc.)"
 	Message      string                    `json:"message"`      // Additional message or error description
 }
+
+// SetLogLevelRequest overrides the level of the CNS logger, globally or for the loggers of a named component.
+type SetLogLevelRequest struct {
+	// Component is the component to override the level of, e.g. "ipam-pool-monitor", or empty for all components.
+	Component string `json:"component,omitempty"`
+	// Level is the level to log at, e.g. "debug", or empty to remove the override.
+	Level string `json:"level,omitempty"`
+	// RevertAfter removes the override after the duration, e.g. "10m", if positive.
+	RevertAfter acntime.Duration `json:"revertAfter"`
+}
+
+// LogLevelOverride is a level which overrides the configured level of the CNS logger.
+type LogLevelOverride struct {
+	Level string `json:"level"`
+	// Expires is when the override is removed, if it is removed automatically.
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// LogLevelResponse describes the overrides of the level of the CNS logger.
+type LogLevelResponse struct {
+	Response   Response                    `json:"response"`
+	Global     *LogLevelOverride           `json:"global,omitempty"`
+	Components map[string]LogLevelOverride `json:"components,omitempty"`
+}
+
+// CNIOperationReport reports the outcome of a CNI command, which CNS aggregates into metrics.
+type CNIOperationReport struct {
+	// Operation is the CNI command, one of ADD, DEL or UPDATE.
+	Operation string `json:"operation"`
+	// NICType is the type of the NIC the command was for, if known.
+	NICType NICType `json:"nicType,omitempty"`
+	// ErrorClass is the phase of the command which failed, e.g. "ipam", or empty if the command succeeded.
+	ErrorClass string              `json:"errorClass,omitempty"`
+	Duration   acntime.Duration    `json:"duration"`
+	Phases     []CNIOperationPhase `json:"phases,omitempty"`
+}
+
+// Phases of CNI commands, which are also the error classes of CNIOperationReports.
+const (
+	CNIPhaseParse          = "parse"
+	CNIPhaseNNS            = "nns"
+	CNIPhaseIPAM           = "ipam"
+	CNIPhaseCNS            = "cns"
+	CNIPhaseState          = "state"
+	CNIPhaseEndpointInfo   = "endpointInfo"
+	CNIPhaseEndpointState  = "endpointState"
+	CNIPhaseEndpointCreate = "endpointCreate"
+	CNIPhaseEndpointDelete = "endpointDelete"
+	CNIPhaseEndpointUpdate = "endpointUpdate"
+)
+
+// CNIOperationPhase is how long a phase of a CNI command took.
+type CNIOperationPhase struct {
+	Name     string           `json:"name"`
+	Duration acntime.Duration `json:"duration"`
+}
@@ -0,0 +1,61 @@
+package certsource
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testLogger struct {
+	t        *testing.T
+	warnings []string
+	errors   []string
+}
+
+func (l *testLogger) Printf(format string, args ...any) {
+	l.t.Logf(format, args...)
+}
+
+func (l *testLogger) Warnf(format string, args ...any) {
+	l.warnings = append(l.warnings, fmt.Sprintf(format, args...))
+}
+
+func (l *testLogger) Errorf(format string, args ...any) {
+	l.errors = append(l.errors, fmt.Sprintf(format, args...))
+}
+
+// newTestCertificate returns a self-signed certificate expiring at notAfter, and its PEM bundle with its key
+func newTestCertificate(t *testing.T, commonName string, notAfter time.Time) (*tls.Certificate, []byte) {
+	t.Helper()
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	derBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, &privateKey.PublicKey, privateKey)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(derBytes)
+	require.NoError(t, err)
+
+	privBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+	pemBundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
+	pemBundle = append(pemBundle, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privBytes})...)
+
+	return &tls.Certificate{Certificate: [][]byte{derBytes}, PrivateKey: privateKey, Leaf: leaf}, pemBundle
+}
@@ -0,0 +1,149 @@
+package certsource
+
+import (
+	"context"
+	"crypto/tls"
+	"path/filepath"
+	"sync"
+	"time"
+
+	localtls "github.com/Azure/azure-container-networking/server/tls"
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+const (
+	FileSourceName = "file"
+
+	// fileResyncInterval is how often the certificate file is re-read, in case a change to it wasn't notified.
+	fileResyncInterval = time.Minute
+)
+
+// FileSource serves the certificate and private key of the PEM file at TlsSettings.TLSCertificatePath,
+// reloading them when the file changes. On Windows, the file is encrypted with DPAPI.
+type FileSource struct {
+	settings localtls.TlsSettings
+	logger   logger
+
+	m    sync.RWMutex
+	cert *tls.Certificate
+}
+
+// NewFileSource returns a FileSource. When there's no error, its GetCertificate method is ready for use,
+// returning the certificate read from the file during construction.
+func NewFileSource(settings localtls.TlsSettings, l logger) (*FileSource, error) {
+	s := &FileSource{
+		settings: settings,
+		logger:   l,
+	}
+
+	cert, err := s.load()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not load initial cert")
+	}
+
+	s.cert = cert
+	s.logger.Printf("initial certificate loaded from %s: %s", s.settings.TLSCertificatePath, describe(cert))
+	return s, nil
+}
+
+func (s *FileSource) Name() string {
+	return FileSourceName
+}
+
+// GetCertificate returns the latest certificate read from the file.
+func (s *FileSource) GetCertificate() *tls.Certificate {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return s.cert
+}
+
+// Refresh reloads the certificate when the file changes, and at least every minute.
+// It watches the directory of the file rather than the file itself, so that the file can be replaced,
+// as kubelet does when updating secrets. It blocks until ctx is done.
+func (s *FileSource) Refresh(ctx context.Context) error {
+	ticker := time.NewTicker(fileResyncInterval)
+	defer ticker.Stop()
+
+	var events <-chan fsnotify.Event
+	var watchErrs <-chan error
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		defer watcher.Close()
+		err = watcher.Add(filepath.Dir(s.settings.TLSCertificatePath))
+	}
+	if err != nil {
+		s.logger.Errorf("could not watch certificate file %s, only re-reading it every %s: %v", s.settings.TLSCertificatePath, fileResyncInterval, err)
+	} else {
+		events, watchErrs = watcher.Events, watcher.Errors
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "refresh canceled")
+		case <-ticker.C:
+			s.reload()
+		case _, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			s.reload()
+		case err, ok := <-watchErrs:
+			if !ok {
+				watchErrs = nil
+				continue
+			}
+			s.logger.Errorf("error watching certificate file %s: %v", s.settings.TLSCertificatePath, err)
+		}
+	}
+}
+
+// reload reads the file and swaps the certificate if it changed. The current certificate is kept if the file
+// can't be read, as it may be in the middle of being written.
+func (s *FileSource) reload() {
+	cert, err := s.load()
+	if err != nil {
+		s.logger.Errorf("could not reload certificate from %s, keeping the current one: %v", s.settings.TLSCertificatePath, err)
+		return
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if cert.Leaf.Equal(s.cert.Leaf) {
+		return
+	}
+
+	oldThumbprint := sha1String(s.cert.Leaf.Raw)
+	s.cert = cert
+	s.logger.Printf("certificate reloaded from %s. old sha1 thumbprint: %s, certificate: %s", s.settings.TLSCertificatePath, oldThumbprint, describe(cert))
+}
+
+func (s *FileSource) load() (*tls.Certificate, error) {
+	tlsCertRetriever, err := localtls.GetTlsCertificateRetriever(s.settings)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get certificate retriever")
+	}
+
+	leafCertificate, err := tlsCertRetriever.GetCertificate()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get certificate")
+	}
+
+	if leafCertificate == nil {
+		return nil, errors.New("certificate retrieval returned empty")
+	}
+
+	privateKey, err := tlsCertRetriever.GetPrivateKey()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get certificate private key")
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{leafCertificate.Raw},
+		PrivateKey:  privateKey,
+		Leaf:        leafCertificate,
+	}, nil
+}
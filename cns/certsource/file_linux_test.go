@@ -0,0 +1,71 @@
+package certsource
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	localtls "github.com/Azure/azure-container-networking/server/tls"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSource(t *testing.T) {
+	l := &testLogger{t: t}
+	path := filepath.Join(t.TempDir(), "cert.pem")
+	_, pemBundle := newTestCertificate(t, "first.com", time.Now().Add(time.Hour))
+	require.NoError(t, os.WriteFile(path, pemBundle, 0o600))
+
+	_, err := NewFileSource(localtls.TlsSettings{TLSCertificatePath: filepath.Join(t.TempDir(), "missing.pem")}, l)
+	require.Error(t, err)
+
+	s, err := NewFileSource(localtls.TlsSettings{TLSCertificatePath: path}, l)
+	require.NoError(t, err)
+	require.Equal(t, "first.com", s.GetCertificate().Leaf.Subject.CommonName)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.Refresh(ctx)
+	}()
+
+	// replace the file the way kubelet updates secrets, with a rename
+	_, pemBundle = newTestCertificate(t, "second.com", time.Now().Add(time.Hour))
+	tmp := path + ".tmp"
+	require.NoError(t, os.WriteFile(tmp, pemBundle, 0o600))
+	require.NoError(t, os.Rename(tmp, path))
+	require.Eventually(t, func() bool {
+		if s.GetCertificate().Leaf.Subject.CommonName == "second.com" {
+			return true
+		}
+		// the directory may not be watched yet, notify another change
+		now := time.Now()
+		_ = os.Chtimes(path, now, now)
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.Error(t, <-done)
+}
+
+func TestFileSourceKeepsCertificateOnInvalidFile(t *testing.T) {
+	l := &testLogger{t: t}
+	path := filepath.Join(t.TempDir(), "cert.pem")
+	_, pemBundle := newTestCertificate(t, "first.com", time.Now().Add(time.Hour))
+	require.NoError(t, os.WriteFile(path, pemBundle, 0o600))
+
+	s, err := NewFileSource(localtls.TlsSettings{TLSCertificatePath: path}, l)
+	require.NoError(t, err)
+	cert := s.GetCertificate()
+
+	require.NoError(t, os.WriteFile(path, []byte("partially written"), 0o600))
+	s.reload()
+	require.Same(t, cert, s.GetCertificate())
+	require.Len(t, l.errors, 1)
+
+	// unchanged certificates aren't swapped
+	require.NoError(t, os.WriteFile(path, pemBundle, 0o600))
+	s.reload()
+	require.Same(t, cert, s.GetCertificate())
+}
@@ -0,0 +1,55 @@
+package certsource
+
+import (
+	"context"
+	"time"
+
+	"github.com/Azure/azure-container-networking/keyvault"
+	localtls "github.com/Azure/azure-container-networking/server/tls"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/pkg/errors"
+)
+
+const KeyVaultSourceName = "keyvault"
+
+// KeyVaultSource serves the latest version of a certificate in KeyVault, refreshed at
+// TlsSettings.KeyVaultCertificateRefreshInterval.
+type KeyVaultSource struct {
+	*keyvault.CertRefresher
+	interval time.Duration
+}
+
+// NewKeyVaultSource returns a KeyVaultSource authenticating with the managed identity of TlsSettings.MSIResourceID.
+// When there's no error, its GetCertificate method is ready for use.
+func NewKeyVaultSource(ctx context.Context, settings localtls.TlsSettings, l logger) (*KeyVaultSource, error) {
+	credOpts := azidentity.ManagedIdentityCredentialOptions{ID: azidentity.ResourceID(settings.MSIResourceID)}
+	cred, err := azidentity.NewManagedIdentityCredential(&credOpts)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create managed identity credential")
+	}
+
+	kvs, err := keyvault.NewShim(settings.KeyVaultURL, cred)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create new keyvault shim")
+	}
+
+	cr, err := keyvault.NewCertRefresher(ctx, kvs, l, settings.KeyVaultCertificateName)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create new cert refresher")
+	}
+
+	return &KeyVaultSource{
+		CertRefresher: cr,
+		interval:      settings.KeyVaultCertificateRefreshInterval,
+	}, nil
+}
+
+func (s *KeyVaultSource) Name() string {
+	return KeyVaultSourceName
+}
+
+// Refresh refreshes the certificate at the configured interval. It blocks until ctx is done or the certificate
+// couldn't be refreshed before it expired.
+func (s *KeyVaultSource) Refresh(ctx context.Context) error {
+	return s.CertRefresher.Refresh(ctx, s.interval) //nolint:wrapcheck // EventualExpirationErr is meant to be returned as is
+}
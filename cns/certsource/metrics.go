@@ -0,0 +1,43 @@
+package certsource
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const sourceLabel = "source"
+
+var (
+	// expirationTimestamp is the expiration of the served certificate, to alert on certificates which aren't rotated
+	// before they expire.
+	expirationTimestamp = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "cns_tls_certificate_expiration_timestamp_seconds",
+			Help: "Expiration of the served TLS certificate, in seconds since the epoch.",
+		},
+		[]string{sourceLabel},
+	)
+	// expiring is 1 when the served certificate expires within the configured warning threshold.
+	expiring = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "cns_tls_certificate_expiring",
+			Help: "Whether the served TLS certificate expires within the warning threshold.",
+		},
+		[]string{sourceLabel},
+	)
+	rotations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cns_tls_certificate_rotations_total",
+			Help: "Number of times the served TLS certificate was rotated.",
+		},
+		[]string{sourceLabel},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		expirationTimestamp,
+		expiring,
+		rotations,
+	)
+}
@@ -0,0 +1,82 @@
+package certsource
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+)
+
+const (
+	// checkInterval is how often the certificate of a source is checked for rotations and expiration.
+	checkInterval = time.Minute
+	// warningInterval is how often a certificate about to expire is warned about.
+	warningInterval = time.Hour
+)
+
+// MonitorExpiry exports the expiration of the certificate of source and its rotations as metrics, and warns when the
+// certificate expires in less than warnBefore, until ctx is done. A zero warnBefore disables the warnings.
+func MonitorExpiry(ctx context.Context, source Source, warnBefore time.Duration, l logger) {
+	m := &monitor{
+		source:     source,
+		warnBefore: warnBefore,
+		logger:     l,
+		now:        time.Now,
+	}
+	m.check()
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.check()
+		}
+	}
+}
+
+type monitor struct {
+	source     Source
+	warnBefore time.Duration
+	logger     logger
+	now        func() time.Time
+
+	cert        *tls.Certificate
+	lastWarning time.Time
+}
+
+func (m *monitor) check() {
+	cert := m.source.GetCertificate()
+	if cert == nil || cert.Leaf == nil {
+		return
+	}
+	name := m.source.Name()
+
+	if cert != m.cert {
+		if m.cert != nil {
+			rotations.WithLabelValues(name).Inc()
+		}
+		m.cert = cert
+		m.lastWarning = time.Time{}
+		expirationTimestamp.WithLabelValues(name).Set(float64(cert.Leaf.NotAfter.Unix()))
+	}
+
+	now := m.now()
+	remaining := cert.Leaf.NotAfter.Sub(now)
+	if m.warnBefore <= 0 || remaining >= m.warnBefore {
+		expiring.WithLabelValues(name).Set(0)
+		return
+	}
+
+	expiring.WithLabelValues(name).Set(1)
+	if now.Sub(m.lastWarning) < warningInterval {
+		return
+	}
+	m.lastWarning = now
+	if remaining <= 0 {
+		m.logger.Errorf("certificate from %s has expired and hasn't been rotated: %s", name, describe(cert))
+		return
+	}
+	m.logger.Warnf("certificate from %s expires in %s and hasn't been rotated: %s", name, remaining.Round(time.Minute), describe(cert))
+}
@@ -0,0 +1,79 @@
+package certsource
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSource struct {
+	cert *tls.Certificate
+}
+
+func (f *fakeSource) GetCertificate() *tls.Certificate { return f.cert }
+
+func (f *fakeSource) Refresh(context.Context) error { return nil }
+
+func (f *fakeSource) Name() string { return "fake" }
+
+func TestMonitor(t *testing.T) {
+	now := time.Now()
+	l := &testLogger{t: t}
+	cert, _ := newTestCertificate(t, "first.com", now.Add(72*time.Hour))
+	source := &fakeSource{cert: cert}
+	m := &monitor{
+		source:     source,
+		warnBefore: 48 * time.Hour,
+		logger:     l,
+		now:        func() time.Time { return now },
+	}
+	rotationsBefore := testutil.ToFloat64(rotations.WithLabelValues("fake"))
+
+	m.check()
+	require.InDelta(t, float64(cert.Leaf.NotAfter.Unix()), testutil.ToFloat64(expirationTimestamp.WithLabelValues("fake")), 0)
+	require.Zero(t, testutil.ToFloat64(expiring.WithLabelValues("fake")))
+	require.Empty(t, l.warnings)
+
+	// within the warning threshold
+	now = now.Add(25 * time.Hour)
+	m.check()
+	require.InDelta(t, 1, testutil.ToFloat64(expiring.WithLabelValues("fake")), 0)
+	require.Len(t, l.warnings, 1)
+
+	// warnings aren't repeated before warningInterval
+	now = now.Add(time.Minute)
+	m.check()
+	require.Len(t, l.warnings, 1)
+	now = now.Add(warningInterval)
+	m.check()
+	require.Len(t, l.warnings, 2)
+
+	// rotated
+	rotated, _ := newTestCertificate(t, "second.com", now.Add(72*time.Hour))
+	source.cert = rotated
+	m.check()
+	require.InDelta(t, rotationsBefore+1, testutil.ToFloat64(rotations.WithLabelValues("fake")), 0)
+	require.InDelta(t, float64(rotated.Leaf.NotAfter.Unix()), testutil.ToFloat64(expirationTimestamp.WithLabelValues("fake")), 0)
+	require.Zero(t, testutil.ToFloat64(expiring.WithLabelValues("fake")))
+
+	// expired
+	now = rotated.Leaf.NotAfter.Add(time.Minute)
+	m.check()
+	require.Len(t, l.errors, 1)
+}
+
+func TestMonitorWithoutWarnings(t *testing.T) {
+	l := &testLogger{t: t}
+	cert, _ := newTestCertificate(t, "first.com", time.Now().Add(time.Minute))
+	m := &monitor{
+		source: &fakeSource{cert: cert},
+		logger: l,
+		now:    time.Now,
+	}
+	m.check()
+	require.Empty(t, l.warnings)
+}
@@ -0,0 +1,35 @@
+// Package certsource provides the TLS certificate served by CNS, keeping it up to date as it is rotated.
+package certsource
+
+import (
+	"context"
+	//nolint:gosec // sha1 only used to display cert thumbprint in logs for cross-verification with the source.
+	"crypto/sha1"
+	"crypto/tls"
+	"fmt"
+)
+
+type logger interface {
+	Printf(format string, args ...any)
+	Warnf(format string, args ...any)
+	Errorf(format string, args ...any)
+}
+
+// Source provides the latest version of a TLS certificate.
+type Source interface {
+	// GetCertificate returns the latest certificate, with its Leaf parsed.
+	GetCertificate() *tls.Certificate
+	// Refresh keeps the certificate up to date. It blocks until ctx is done or refreshing fails.
+	Refresh(ctx context.Context) error
+	// Name identifies the kind of source in logs and metrics.
+	Name() string
+}
+
+func describe(cert *tls.Certificate) string {
+	return fmt.Sprintf("subject: %s, sha1 thumbprint: %s, expiration: %s", cert.Leaf.Subject, sha1String(cert.Leaf.Raw), cert.Leaf.NotAfter)
+}
+
+func sha1String(bs []byte) string {
+	//nolint:gosec // sha1 only used to display cert thumbprint in logs for cross-verification with the source.
+	return fmt.Sprintf("%X", sha1.Sum(bs))
+}
@@ -12,7 +12,9 @@ import (
 
 	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/cns/restserver"
+	"github.com/Azure/azure-container-networking/cns/spiffe"
 	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/tracing"
 	"github.com/pkg/errors"
 )
 
@@ -46,8 +48,13 @@ var clientPaths = []string{
 	cns.NetworkContainersURLPath,
 	cns.GetHomeAz,
 	cns.EndpointAPI,
+	cns.LogLevelPath,
+	cns.CNIOperationsPath,
+	cns.PathDebugPodBundle,
 }
 
+var ErrSPIFFERequiresHTTPS = errors.New("SPIFFE mTLS requires an https base URL")
+
 type do interface {
 	Do(*http.Request) (*http.Response, error)
 }
@@ -79,7 +86,41 @@ func New(baseURL string, requestTimeout time.Duration) (*Client, error) {
 
 	return &Client{
 		client: &http.Client{
-			Timeout: requestTimeout,
+			Timeout:   requestTimeout,
+			Transport: tracing.NewTransport(nil),
+		},
+		routes: routes,
+	}, nil
+}
+
+// NewWithSPIFFE returns a new CNS client which connects over mTLS to the https baseURL of the CNS TLS port,
+// authenticating with the X509-SVID of source. It only accepts CNS servers whose X509-SVID is verified by the bundles
+// of source and has a SPIFFE ID in allowedServerIDs. The caller owns source, which must stay open while the client is used.
+func NewWithSPIFFE(baseURL string, requestTimeout time.Duration, source spiffe.Source, allowedServerIDs []string) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse base URL %s", baseURL)
+	}
+	if u.Scheme != "https" {
+		return nil, errors.Wrapf(ErrSPIFFERequiresHTTPS, "base URL %s", baseURL)
+	}
+
+	allowlist, err := spiffe.ParseAllowlist(allowedServerIDs)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse allowed server SPIFFE IDs")
+	}
+
+	routes, err := buildRoutes(baseURL, clientPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert // the default transport is an *http.Transport
+	transport.TLSClientConfig = spiffe.ClientTLSConfig(source, allowlist)
+	return &Client{
+		client: &http.Client{
+			Timeout:   requestTimeout,
+			Transport: tracing.NewTransport(transport),
 		},
 		routes: routes,
 	}, nil
@@ -1134,3 +1175,126 @@ func (c *Client) DeleteEndpointState(ctx context.Context, endpointID string) (*c
 
 	return &response, nil
 }
+
+// GetLogLevels returns the overrides of the CNS logger levels.
+// The admin token authenticates the request.
+func (c *Client) GetLogLevels(ctx context.Context, token string) (*cns.LogLevelResponse, error) {
+	u := c.routes[cns.LogLevelPath]
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), http.NoBody)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build request")
+	}
+	return c.doLogLevelRequest(req, token)
+}
+
+// SetLogLevel overrides the level of the CNS logger, globally or for a component, and returns the overrides.
+// The admin token authenticates the request.
+func (c *Client) SetLogLevel(ctx context.Context, token string, setLogLevelRequest cns.SetLogLevelRequest) (*cns.LogLevelResponse, error) {
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(setLogLevelRequest); err != nil {
+		return nil, errors.Wrap(err, "failed to encode SetLogLevelRequest")
+	}
+	u := c.routes[cns.LogLevelPath]
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), &body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build request")
+	}
+	req.Header.Set(headerContentType, contentTypeJSON)
+	return c.doLogLevelRequest(req, token)
+}
+
+func (c *Client) doLogLevelRequest(req *http.Request, token string) (*cns.LogLevelResponse, error) {
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, &ConnectionFailureErr{cause: err}
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("http response %d", res.StatusCode)
+	}
+
+	var resp cns.LogLevelResponse
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return nil, errors.Wrap(err, "failed to decode LogLevelResponse")
+	}
+	if resp.Response.ReturnCode != 0 {
+		return nil, errors.New(resp.Response.Message)
+	}
+	return &resp, nil
+}
+
+// ReportCNIOperation reports the outcome of a CNI command to CNS, which aggregates it into its CNI operation metrics.
+func (c *Client) ReportCNIOperation(ctx context.Context, report *cns.CNIOperationReport) error {
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(report); err != nil {
+		return errors.Wrap(err, "failed to encode CNIOperationReport")
+	}
+	u := c.routes[cns.CNIOperationsPath]
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), &body)
+	if err != nil {
+		return errors.Wrap(err, "failed to build request")
+	}
+	req.Header.Set(headerContentType, contentTypeJSON)
+	res, err := c.client.Do(req)
+	if err != nil {
+		return &ConnectionFailureErr{cause: err}
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return errors.Errorf("http response %d", res.StatusCode)
+	}
+
+	var resp cns.Response
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return errors.Wrap(err, "failed to decode Response")
+	}
+	if resp.ReturnCode != 0 {
+		return &CNSClientError{
+			Code: resp.ReturnCode,
+			Err:  errors.New(resp.Message),
+		}
+	}
+	return nil
+}
+
+// GetPodDebugBundle writes the debug bundle of a pod, a tar.gz, to w.
+// The admin token authenticates the request.
+func (c *Client) GetPodDebugBundle(ctx context.Context, token string, podDebugBundleRequest cns.PodDebugBundleRequest, w io.Writer) error {
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(podDebugBundleRequest); err != nil {
+		return errors.Wrap(err, "failed to encode PodDebugBundleRequest")
+	}
+	u := c.routes[cns.PathDebugPodBundle]
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), &body)
+	if err != nil {
+		return errors.Wrap(err, "failed to build request")
+	}
+	req.Header.Set(headerContentType, contentTypeJSON)
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := c.client.Do(req)
+	if err != nil {
+		return &ConnectionFailureErr{cause: err}
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return errors.Errorf("http response %d", res.StatusCode)
+	}
+
+	// CNS answers with a Response instead of a bundle when it can't collect one.
+	if res.Header.Get(headerContentType) != "application/gzip" {
+		var resp cns.Response
+		if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+			return errors.Wrap(err, "failed to decode Response")
+		}
+		return &CNSClientError{
+			Code: resp.ReturnCode,
+			Err:  errors.New(resp.Message),
+		}
+	}
+	_, err = io.Copy(w, res.Body)
+	return errors.Wrap(err, "failed to read bundle")
+}
@@ -3,12 +3,14 @@ package client
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"sort"
@@ -21,12 +23,17 @@ import (
 	"github.com/Azure/azure-container-networking/cns/fakes"
 	"github.com/Azure/azure-container-networking/cns/logger"
 	"github.com/Azure/azure-container-networking/cns/restserver"
+	"github.com/Azure/azure-container-networking/cns/spiffe"
+	"github.com/Azure/azure-container-networking/cns/spiffe/spiffetest"
 	"github.com/Azure/azure-container-networking/cns/types"
 	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/tracing"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/uuid"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -344,7 +351,8 @@ func TestNew(t *testing.T) {
 			want: &Client{
 				routes: emptyRoutes,
 				client: &http.Client{
-					Timeout: 0,
+					Timeout:   0,
+					Transport: tracing.NewTransport(nil),
 				},
 			},
 			wantErr: false,
@@ -355,7 +363,8 @@ func TestNew(t *testing.T) {
 			want: &Client{
 				routes: fqdnRoutes,
 				client: &http.Client{
-					Timeout: 0,
+					Timeout:   0,
+					Transport: tracing.NewTransport(nil),
 				},
 			},
 			wantErr: false,
@@ -366,7 +375,8 @@ func TestNew(t *testing.T) {
 			want: &Client{
 				routes: fqdnWithPortRoutes,
 				client: &http.Client{
-					Timeout: 0,
+					Timeout:   0,
+					Transport: tracing.NewTransport(nil),
 				},
 			},
 			wantErr: false,
@@ -392,6 +402,77 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestNewPropagatesTraceContext(t *testing.T) {
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		_ = json.NewEncoder(w).Encode(&cns.IPConfigsResponse{})
+	}))
+	defer server.Close()
+
+	client, err := New(server.URL, DefaultTimeout)
+	require.NoError(t, err)
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+	_, err = client.RequestIPs(ctx, cns.IPConfigsRequest{PodInterfaceID: "testpodinterfaceid", InfraContainerID: "testcontainerid"})
+	require.NoError(t, err)
+	require.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", traceparent)
+}
+
+func TestNewWithSPIFFE(t *testing.T) {
+	trustDomain := spiffeid.RequireTrustDomainFromString("example.org")
+	ca := spiffetest.NewCA(t, trustDomain)
+	cnsID := spiffeid.RequireFromPath(trustDomain, "/ns/kube-system/sa/azure-cns")
+	clientID := spiffeid.RequireFromPath(trustDomain, "/ns/kube-system/sa/dnc")
+
+	newSource := func(id spiffeid.ID) spiffe.Source {
+		workloadAPI := spiffetest.NewWorkloadAPI(t)
+		workloadAPI.SetX509SVID(t, ca.CreateX509SVID(t, id), ca.Bundle())
+		source, err := spiffe.NewWorkloadAPISource(context.Background(), workloadAPI.Addr())
+		require.NoError(t, err)
+		t.Cleanup(func() { source.Close() })
+		return source
+	}
+
+	// the CNS server only accepts the clients of the kube-system namespace
+	serverAllowlist, err := spiffe.ParseAllowlist([]string{"spiffe://example.org/ns/kube-system/*"})
+	require.NoError(t, err)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(&cns.IPConfigsResponse{})
+	}))
+	server.Listener = tls.NewListener(server.Listener, spiffe.ServerTLSConfig(newSource(cnsID), serverAllowlist))
+	server.Start()
+	defer server.Close()
+	serverURL := "https://" + server.Listener.Addr().String()
+	clientSource := newSource(clientID)
+
+	client, err := NewWithSPIFFE(serverURL, DefaultTimeout, clientSource, []string{cnsID.String()})
+	require.NoError(t, err)
+	_, err = client.RequestIPs(context.Background(), cns.IPConfigsRequest{PodInterfaceID: "testpodinterfaceid", InfraContainerID: "testcontainerid"})
+	require.NoError(t, err)
+
+	client, err = NewWithSPIFFE(serverURL, DefaultTimeout, clientSource, []string{"spiffe://example.org/ns/kube-system/sa/other"})
+	require.NoError(t, err)
+	_, err = client.RequestIPs(context.Background(), cns.IPConfigsRequest{PodInterfaceID: "testpodinterfaceid", InfraContainerID: "testcontainerid"})
+	require.Error(t, err, "servers which aren't allowed are rejected")
+
+	client, err = NewWithSPIFFE(serverURL, DefaultTimeout, newSource(spiffeid.RequireFromPath(trustDomain, "/ns/default/sa/app")), []string{cnsID.String()})
+	require.NoError(t, err)
+	_, err = client.RequestIPs(context.Background(), cns.IPConfigsRequest{PodInterfaceID: "testpodinterfaceid", InfraContainerID: "testcontainerid"})
+	require.Error(t, err, "clients which aren't allowed are rejected by the server")
+
+	_, err = NewWithSPIFFE("http://localhost:10090", DefaultTimeout, clientSource, []string{cnsID.String()})
+	require.ErrorIs(t, err, ErrSPIFFERequiresHTTPS)
+	_, err = NewWithSPIFFE(serverURL, DefaultTimeout, clientSource, nil)
+	require.ErrorIs(t, err, spiffe.ErrEmptyAllowlist)
+}
+
 func TestBuildRoutes(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -6,18 +6,28 @@ import (
 	"os"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/cns/client"
+	"github.com/Azure/azure-container-networking/cns/configuration"
 	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/pkg/errors"
 )
 
 const (
-	envCNSIPAddress = "CNSIpAddress"
-	envCNSPort      = "CNSPort"
-	getCmdArg       = "get"
-	getInMemoryData = "getInMemory"
-	getPodCmdArg    = "getPodContexts"
+	envCNSIPAddress      = "CNSIpAddress"
+	envCNSPort           = "CNSPort"
+	envCNSAdminTokenPath = "CNSAdminTokenPath"
+	getCmdArg            = "get"
+	getInMemoryData      = "getInMemory"
+	getPodCmdArg         = "getPodContexts"
+	logLevelCmdArg       = "logLevel"
+	podBundleCmdArg      = "podBundle"
+
+	componentOpt   = "component="
+	revertAfterOpt = "revertAfter="
+	resetLevel     = "reset"
 )
 
 func HandleCNSClientCommands(ctx context.Context, cmd string, arg string) error {
@@ -36,8 +46,12 @@ func HandleCNSClientCommands(ctx context.Context, cmd string, arg string) error
 		return getPodCmd(ctx, cnsClient)
 	case strings.EqualFold(getInMemoryData, cmd):
 		return getInMemory(ctx, cnsClient)
+	case strings.EqualFold(logLevelCmdArg, cmd):
+		return logLevelCmd(ctx, cnsClient, arg)
+	case strings.EqualFold(podBundleCmdArg, cmd):
+		return podBundleCmd(ctx, cnsClient, arg)
 	default:
-		return fmt.Errorf("No debug cmd supplied, options are: %v", getCmdArg)
+		return fmt.Errorf("No debug cmd supplied, options are: %v", []string{getCmdArg, getPodCmdArg, getInMemoryData, logLevelCmdArg, podBundleCmdArg})
 	}
 }
 
@@ -99,3 +113,137 @@ func getInMemory(ctx context.Context, client *client.Client) error {
 		data.HTTPRestServiceData.PodIPIDByPodInterfaceKey, data.HTTPRestServiceData.PodIPConfigState)
 	return nil
 }
+
+// logLevelCmd prints the overrides of the CNS logger levels, after applying the override in arg if any.
+// arg is "<level|reset> [component=<name>] [revertAfter=<duration>]", e.g. "debug component=ipam-pool-monitor revertAfter=10m".
+func logLevelCmd(ctx context.Context, client *client.Client, arg string) error {
+	token, err := readAdminToken()
+	if err != nil {
+		return err
+	}
+
+	var resp *cns.LogLevelResponse
+	if strings.TrimSpace(arg) == "" {
+		resp, err = client.GetLogLevels(ctx, token)
+	} else {
+		var req cns.SetLogLevelRequest
+		req, err = parseSetLogLevelRequest(arg)
+		if err != nil {
+			return err
+		}
+		resp, err = client.SetLogLevel(ctx, token, req)
+	}
+	if err != nil {
+		return err
+	}
+
+	printLogLevels(resp)
+	return nil
+}
+
+func parseSetLogLevelRequest(arg string) (cns.SetLogLevelRequest, error) {
+	var req cns.SetLogLevelRequest
+	opts := strings.Fields(arg)
+	if !strings.EqualFold(opts[0], resetLevel) {
+		req.Level = opts[0]
+	}
+	for _, opt := range opts[1:] {
+		switch {
+		case strings.HasPrefix(opt, componentOpt):
+			req.Component = strings.TrimPrefix(opt, componentOpt)
+		case strings.HasPrefix(opt, revertAfterOpt):
+			d, err := time.ParseDuration(strings.TrimPrefix(opt, revertAfterOpt))
+			if err != nil {
+				return req, errors.Wrapf(err, "invalid %s", opt)
+			}
+			req.RevertAfter.Duration = d
+		default:
+			return req, errors.Errorf("unknown option %s, options are: %v", opt, []string{componentOpt, revertAfterOpt})
+		}
+	}
+	return req, nil
+}
+
+// podBundleCmd writes the debug bundle of a pod to a file.
+// arg is "<namespace>/<name> [output file]", the output file defaulting to "<namespace>_<name>.tar.gz".
+func podBundleCmd(ctx context.Context, client *client.Client, arg string) error {
+	req, out, err := parsePodBundleArg(arg)
+	if err != nil {
+		return err
+	}
+	token, err := readAdminToken()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(out, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create %s", out)
+	}
+	if err := client.GetPodDebugBundle(ctx, token, req, f); err != nil {
+		f.Close()
+		os.Remove(out)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrapf(err, "failed to write %s", out)
+	}
+	fmt.Printf("Wrote debug bundle of pod %s/%s to %s\n", req.PodNamespace, req.PodName, out)
+	return nil
+}
+
+func parsePodBundleArg(arg string) (req cns.PodDebugBundleRequest, out string, err error) {
+	opts := strings.Fields(arg)
+	if len(opts) == 0 || len(opts) > 2 {
+		return req, "", errors.Errorf("invalid argument %q, expected <namespace>/<name> [output file]", arg)
+	}
+	namespace, name, ok := strings.Cut(opts[0], "/")
+	if !ok || namespace == "" || name == "" {
+		return req, "", errors.Errorf("invalid pod %q, expected <namespace>/<name>", opts[0])
+	}
+	req = cns.PodDebugBundleRequest{PodNamespace: namespace, PodName: name}
+	out = namespace + "_" + name + ".tar.gz"
+	if len(opts) == 2 {
+		out = opts[1]
+	}
+	return req, out, nil
+}
+
+// readAdminToken reads the token CNS authenticates admin requests with.
+func readAdminToken() (string, error) {
+	path := os.Getenv(envCNSAdminTokenPath)
+	if path == "" {
+		path = configuration.DefaultAdminTokenPath
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read admin token")
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+func printLogLevels(resp *cns.LogLevelResponse) {
+	printOverride := func(name string, o cns.LogLevelOverride) {
+		if o.Expires != nil {
+			fmt.Printf("%s: %s until %s\n", name, o.Level, o.Expires.Format(time.RFC3339))
+			return
+		}
+		fmt.Printf("%s: %s\n", name, o.Level)
+	}
+
+	if resp.Global == nil && len(resp.Components) == 0 {
+		fmt.Println("No log level overrides")
+		return
+	}
+	if resp.Global != nil {
+		printOverride("global", *resp.Global)
+	}
+	components := make([]string, 0, len(resp.Components))
+	for component := range resp.Components {
+		components = append(components, component)
+	}
+	sort.Strings(components)
+	for _, component := range components {
+		printOverride(component, resp.Components[component])
+	}
+}
@@ -33,6 +33,8 @@ type SidecarTelemetrySettings struct {
 	EnableCNITelemetry bool `json:"EnableCNITelemetry"`
 	// Path to the CNI telemetry socket file that azure-vnet CNI connects to
 	CNITelemetrySocketPath string `json:"CNITelemetrySocketPath"`
+	// Sinks the CNI reports and metrics are sent to in addition to AppInsights
+	Sinks telemetry.SinkConfig `json:"Sinks"`
 }
 
 // SidecarConfig wraps the sidecar-specific telemetry settings.
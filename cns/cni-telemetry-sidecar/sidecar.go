@@ -10,6 +10,7 @@ import (
 	"github.com/Azure/azure-container-networking/aitelemetry"
 	"github.com/Azure/azure-container-networking/cns/configuration"
 	"github.com/Azure/azure-container-networking/telemetry"
+	"github.com/Azure/azure-container-networking/telemetry/sinks"
 	"go.uber.org/zap"
 )
 
@@ -80,6 +81,11 @@ func (s *TelemetrySidecar) buildTelemetryConfig(cnsConfig *configuration.CNSConf
 		refreshTimeout = defaultRefreshTimeoutInSecs
 	}
 
+	var sinkConfig telemetry.SinkConfig
+	if sidecarConfig := s.configManager.GetSidecarConfig(); sidecarConfig != nil {
+		sinkConfig = sidecarConfig.TelemetrySettings.Sinks
+	}
+
 	return telemetry.TelemetryConfig{
 		ReportToHostIntervalInSeconds: time.Duration(defaultReportToHostIntervalInSecs) * time.Second,
 		DisableAll:                    ts.DisableAll,
@@ -92,6 +98,7 @@ func (s *TelemetrySidecar) buildTelemetryConfig(cnsConfig *configuration.CNSConf
 		DebugMode:                     ts.DebugMode,
 		GetEnvRetryCount:              defaultGetEnvRetryCount,
 		GetEnvRetryWaitTimeInSecs:     defaultGetEnvRetryWaitTimeInSecs,
+		Sinks:                         sinkConfig,
 	}
 }
 
@@ -159,8 +166,17 @@ func (s *TelemetrySidecar) startTelemetryService(ctx context.Context, config tel
 		}
 	}
 
+	telemetrySinks, err := sinks.New(ctx, config.Sinks, s.logger)
+	if err != nil {
+		s.logger.Warn("Telemetry sinks initialization failed, continuing without them", zap.Error(err))
+	}
+	for _, sink := range telemetrySinks {
+		s.telemetryBuffer.AddSink(sink)
+	}
+
 	s.logger.Info("Telemetry service started",
-		zap.Bool("appInsightsEnabled", telemetry.GetAIMetadata() != ""))
+		zap.Bool("appInsightsEnabled", telemetry.GetAIMetadata() != ""),
+		zap.Int("sinks", len(telemetrySinks)))
 
 	go s.telemetryBuffer.PushData(ctx)
 	return nil
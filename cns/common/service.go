@@ -5,6 +5,7 @@ package common
 
 import (
 	"errors"
+	"sync"
 
 	"github.com/Azure/azure-container-networking/cns/logger"
 	acn "github.com/Azure/azure-container-networking/common"
@@ -22,6 +23,8 @@ type Service struct {
 	Store       store.KeyValueStore
 	ChannelMode string
 	Logger      *zap.Logger
+	// optionsMutex guards Options, which can be set while requests are served when the config is reloaded.
+	optionsMutex sync.RWMutex
 }
 
 // ServiceAPI defines base interface.
@@ -96,10 +99,14 @@ func (service *Service) Uninitialize() {
 
 // GetOption gets the option value for the given key.
 func (service *Service) GetOption(key string) interface{} {
+	service.optionsMutex.RLock()
+	defer service.optionsMutex.RUnlock()
 	return service.Options[key]
 }
 
 // SetOption sets the option value for the given key.
 func (service *Service) SetOption(key string, value interface{}) {
+	service.optionsMutex.Lock()
+	defer service.optionsMutex.Unlock()
 	service.Options[key] = value
 }
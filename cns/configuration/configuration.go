@@ -13,6 +13,7 @@ import (
 	"github.com/Azure/azure-container-networking/cns/logger"
 	loggerv2 "github.com/Azure/azure-container-networking/cns/logger/v2"
 	"github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/tracing"
 	"github.com/pkg/errors"
 )
 
@@ -20,10 +21,13 @@ const (
 	// EnvCNSConfig is the CNS_CONFIGURATION_PATH env var key
 	EnvCNSConfig      = "CNS_CONFIGURATION_PATH"
 	defaultConfigName = "cns_config.json"
+	// DefaultAdminTokenPath is where CNS writes the token which authenticates requests to its admin APIs.
+	DefaultAdminTokenPath = "/var/run/azure-cns-admin.token"
 )
 
 type CNSConfig struct {
 	AZRSettings                     AZRSettings
+	AdminTokenPath                  string
 	AsyncPodDeletePath              string
 	CNIConflistFilepath             string
 	CNIConflistScenario             string
@@ -33,11 +37,13 @@ type CNSConfig struct {
 	EnableCNIConflistGeneration     bool
 	EnableIPAMv2                    bool
 	EnableK8sDevicePlugin           bool
+	EnableKubeEvents                bool
 	EnableLoggerV2                  bool
+	EnableNCStatusReporting         bool
 	EnablePprof                     bool
 	EnableStateMigration            bool
 	EnableSubnetScarcity            bool
-	EnableStaleHNSCleanupOnNCCreate bool
+	EnableStaleHNSCleanupOnNCCreate bool `reloadable:"true"`
 	EnableSwiftV1DualStack          bool
 	EnableSwiftV2                   bool
 	IPv6PrefixClamp                 int
@@ -49,14 +55,17 @@ type CNSConfig struct {
 	ManagedSettings                 ManagedSettings
 	MellanoxMonitorIntervalSecs     int
 	MetricsBindAddress              string
-	ProgramSNATIPTables             bool
+	ProgramSNATIPTables             bool `reloadable:"true"`
+	SPIFFESettings                  SPIFFESettings
 	SyncHostNCTimeoutMs             int
-	SyncHostNCVersionIntervalMs     int
+	SyncHostNCVersionIntervalMs     int `reloadable:"true"`
+	TLSCertificateExpiryWarningDays int
 	TLSCertificatePath              string
 	TLSEndpoint                     string
 	TLSPort                         string
 	TLSSubjectName                  string
 	TelemetrySettings               TelemetrySettings
+	Tracing                         tracing.Config
 	UseHTTPS                        bool
 	UseMTLS                         bool
 	WatchPods                       bool `json:"-"`
@@ -80,7 +89,7 @@ type TelemetrySettings struct {
 	// Configure the maximum delay before sending queued telemetry in milliseconds
 	TelemetryBatchIntervalInSecs int
 	// Heartbeat interval for sending heartbeat metric
-	HeartBeatIntervalInMins int
+	HeartBeatIntervalInMins int `reloadable:"true"`
 	// Enable thread for getting metadata from wireserver
 	DisableMetadataRefreshThread bool
 	// Refresh interval in milliseconds for metadata thread
@@ -88,9 +97,9 @@ type TelemetrySettings struct {
 	// Disable debug logging for telemetry messages
 	DebugMode bool
 	// Interval for sending snapshot events.
-	SnapshotIntervalInMins int
+	SnapshotIntervalInMins int `reloadable:"true"`
 	// Interval for sending config snapshot events.
-	ConfigSnapshotIntervalInMins int
+	ConfigSnapshotIntervalInMins int `reloadable:"true"`
 	// AppInsightsInstrumentationKey allows the user to override the default appinsights ikey
 	AppInsightsInstrumentationKey string
 }
@@ -116,6 +125,18 @@ type KeyVaultSettings struct {
 	RefreshIntervalInHrs int
 }
 
+// SPIFFESettings configures mTLS with SPIFFE X509-SVIDs, which identify clients by the SPIFFE ID in their URI SAN.
+type SPIFFESettings struct {
+	// WorkloadAPIAddress is the address of the SPIFFE Workload API, such as unix:///run/spire/sockets/agent.sock.
+	// If set, mTLS is served with the X509-SVID of CNS and clients are verified against the SPIFFE trust bundles,
+	// instead of the TLS certificate and its CAs.
+	WorkloadAPIAddress string
+	// AllowedClientIDs are the SPIFFE IDs of the clients allowed to connect over mTLS. Entries are trust domains,
+	// "spiffe://example.org", IDs, "spiffe://example.org/ns/kube-system/sa/dnc", or path prefixes ending with "/*".
+	// If set, they replace MtlsClientCertSubjectName.
+	AllowedClientIDs []string
+}
+
 type GRPCSettings struct {
 	Enable    bool
 	IPAddress string
@@ -235,6 +256,9 @@ func SetCNSConfigDefaults(config *CNSConfig) {
 	if config.AsyncPodDeletePath == "" {
 		config.AsyncPodDeletePath = "/var/run/azure-vnet/deleteIDs"
 	}
+	if config.AdminTokenPath == "" {
+		config.AdminTokenPath = DefaultAdminTokenPath
+	}
 	if config.GRPCSettings.IPAddress == "" {
 		config.GRPCSettings.IPAddress = "localhost"
 	}
@@ -245,6 +269,9 @@ func SetCNSConfigDefaults(config *CNSConfig) {
 	if config.MinTLSVersion == "" {
 		config.MinTLSVersion = "TLS 1.2"
 	}
+	if config.TLSCertificateExpiryWarningDays == 0 {
+		config.TLSCertificateExpiryWarningDays = 30 //nolint:gomnd // default warning threshold
+	}
 	// Validate IPv6PrefixClamp to avoid invalid prefix lengths reaching netip.PrefixFrom.
 	// If IPv6PrefixClamp less than 120, large amount of IPs will be generated which could lead to OOM.
 	// If IPv6PrefixClamp greater than 128, it's an error in config since max prefix length for IPv6 is 128.
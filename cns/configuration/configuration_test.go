@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/tracing"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -85,6 +86,11 @@ func TestReadConfigFromFile(t *testing.T) {
 					TelemetryBatchIntervalInSecs: 15,
 					TelemetryBatchSizeBytes:      16384,
 				},
+				Tracing: tracing.Config{
+					OTLPEndpoint: "http://localhost:4318",
+					OTLPHeaders:  map[string]string{"authorization": "token"},
+					SampleRatio:  0.5,
+				},
 				AZRSettings: AZRSettings{
 					PopulateHomeAzCacheRetryIntervalSecs: 60,
 				},
@@ -92,6 +98,10 @@ func TestReadConfigFromFile(t *testing.T) {
 				UseMTLS:       true,
 				WireserverIP:  "168.63.129.16",
 				MinTLSVersion: "TLS 1.3",
+				SPIFFESettings: SPIFFESettings{
+					WorkloadAPIAddress: "unix:///run/spire/sockets/agent.sock",
+					AllowedClientIDs:   []string{"spiffe://example.org/ns/kube-system/*"},
+				},
 			},
 			wantErr: false,
 		},
@@ -219,13 +229,15 @@ func TestSetCNSConfigDefaults(t *testing.T) {
 				},
 				WireserverIP:       "168.63.129.16",
 				AsyncPodDeletePath: "/var/run/azure-vnet/deleteIDs",
+				AdminTokenPath:     DefaultAdminTokenPath,
 				GRPCSettings: GRPCSettings{
 					Enable:    false,
 					IPAddress: "localhost",
 					Port:      8080,
 				},
-				MinTLSVersion:             "TLS 1.2",
-				MtlsClientCertSubjectName: "",
+				MinTLSVersion:                   "TLS 1.2",
+				MtlsClientCertSubjectName:       "",
+				TLSCertificateExpiryWarningDays: 30,
 			},
 		},
 		{
@@ -257,8 +269,9 @@ func TestSetCNSConfigDefaults(t *testing.T) {
 					IPAddress: "192.168.1.1",
 					Port:      9090,
 				},
-				MinTLSVersion:             "TLS 1.3",
-				MtlsClientCertSubjectName: "example.com",
+				MinTLSVersion:                   "TLS 1.3",
+				MtlsClientCertSubjectName:       "example.com",
+				TLSCertificateExpiryWarningDays: 7,
 			},
 			want: CNSConfig{
 				ChannelMode: "Other",
@@ -284,13 +297,15 @@ func TestSetCNSConfigDefaults(t *testing.T) {
 				},
 				WireserverIP:       "168.63.129.16",
 				AsyncPodDeletePath: "/var/run/azure-vnet/deleteIDs",
+				AdminTokenPath:     DefaultAdminTokenPath,
 				GRPCSettings: GRPCSettings{
 					Enable:    false,
 					IPAddress: "192.168.1.1",
 					Port:      9090,
 				},
-				MinTLSVersion:             "TLS 1.3",
-				MtlsClientCertSubjectName: "example.com",
+				MinTLSVersion:                   "TLS 1.3",
+				MtlsClientCertSubjectName:       "example.com",
+				TLSCertificateExpiryWarningDays: 7,
 			},
 		},
 	}
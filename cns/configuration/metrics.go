@@ -0,0 +1,26 @@
+package configuration
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	reloadResultApplied       = "applied"
+	reloadResultInvalid       = "invalid"
+	reloadResultNonReloadable = "non_reloadable"
+)
+
+// configReloads counts the changes to the config file by whether they were applied, or rejected because the file
+// is invalid or changes fields which can't be reloaded.
+var configReloads = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "cns_config_reloads_total",
+		Help: "Number of changes to the config file, by result.",
+	},
+	[]string{"result"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(configReloads)
+}
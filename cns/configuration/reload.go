@@ -0,0 +1,61 @@
+package configuration
+
+import (
+	"reflect"
+	"strings"
+)
+
+// reloadableTag marks the fields of CNSConfig which can be changed without restarting CNS, as `reloadable:"true"`.
+// Changes to a reloadable struct field are reloadable down to all of its fields.
+const reloadableTag = "reloadable"
+
+// changedFields returns the paths of the fields which differ between the configs, such as
+// "TelemetrySettings.HeartBeatIntervalInMins", split by whether they are reloadable. Unexported fields and fields
+// which aren't read from the config file, tagged `json:"-"`, are ignored.
+func changedFields(old, updated *CNSConfig) (reloadable, nonReloadable []string) {
+	d := &configDiff{}
+	d.compare("", reflect.ValueOf(old).Elem(), reflect.ValueOf(updated).Elem(), false)
+	return d.reloadable, d.nonReloadable
+}
+
+type configDiff struct {
+	reloadable    []string
+	nonReloadable []string
+}
+
+func (d *configDiff) compare(path string, old, updated reflect.Value, reloadable bool) {
+	switch old.Kind() { //nolint:exhaustive // other kinds are compared as a whole
+	case reflect.Struct:
+		t := old.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() || field.Tag.Get("json") == "-" {
+				continue
+			}
+			fieldPath := field.Name
+			if path != "" {
+				fieldPath = path + "." + field.Name
+			}
+			d.compare(fieldPath, old.Field(i), updated.Field(i), reloadable || field.Tag.Get(reloadableTag) == "true")
+		}
+		return
+	case reflect.Pointer:
+		if !old.IsNil() && !updated.IsNil() {
+			d.compare(path, old.Elem(), updated.Elem(), reloadable)
+			return
+		}
+	}
+
+	if reflect.DeepEqual(old.Interface(), updated.Interface()) {
+		return
+	}
+	if reloadable {
+		d.reloadable = append(d.reloadable, path)
+	} else {
+		d.nonReloadable = append(d.nonReloadable, path)
+	}
+}
+
+func joinFields(fields []string) string {
+	return strings.Join(fields, ", ")
+}
@@ -0,0 +1,224 @@
+package configuration
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/pkg/errors"
+)
+
+const schemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+var (
+	// channelModes are the valid values of CNSConfig.ChannelMode.
+	channelModes = []string{cns.Direct, cns.Managed, cns.CRD, cns.MultiTenantCRD, cns.AzureHost}
+	// tlsVersions are the valid values of CNSConfig.MinTLSVersion.
+	tlsVersions = []string{"TLS 1.2", "TLS 1.3"}
+
+	// schemaEnums restricts the values of the string fields of CNSConfig, by field path.
+	schemaEnums = map[string][]string{
+		"ChannelMode":   channelModes,
+		"MinTLSVersion": tlsVersions,
+	}
+)
+
+// JSONSchema is the subset of JSON Schema used to describe the config file.
+type JSONSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	AdditionalProperties any                    `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	Minimum              *int                   `json:"minimum,omitempty"`
+}
+
+// Schema returns the JSON Schema of the config file, generated from CNSConfig. Objects don't allow properties
+// which aren't fields of the config, since they are ignored by CNS and usually are typos.
+func Schema() *JSONSchema {
+	s := schemaOf("", reflect.TypeOf(CNSConfig{}))
+	s.Schema = schemaDraft
+	s.Title = "CNS configuration"
+	return s
+}
+
+// MarshalSchema returns the JSON Schema of the config file as indented JSON.
+func MarshalSchema() ([]byte, error) {
+	b, err := json.MarshalIndent(Schema(), "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal config schema")
+	}
+	return append(b, '\n'), nil
+}
+
+var jsonMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+func schemaOf(path string, t reflect.Type) *JSONSchema {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	// types which marshal themselves, such as durations, are described by the JSON their zero value marshals to.
+	if t.Kind() == reflect.Struct && t.Implements(jsonMarshaler) {
+		return schemaOfMarshaler(t)
+	}
+
+	switch t.Kind() { //nolint:exhaustive // other kinds aren't used in the config
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &JSONSchema{Type: "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		zero := 0
+		return &JSONSchema{Type: "integer", Minimum: &zero}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: "number"}
+	case reflect.String:
+		return &JSONSchema{Type: "string", Enum: schemaEnums[path]}
+	case reflect.Slice, reflect.Array:
+		return &JSONSchema{Type: "array", Items: schemaOf(path, t.Elem())}
+	case reflect.Map:
+		return &JSONSchema{Type: "object", AdditionalProperties: schemaOf(path, t.Elem())}
+	case reflect.Struct:
+		s := &JSONSchema{Type: "object", Properties: map[string]*JSONSchema{}, AdditionalProperties: false}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, ok := jsonFieldName(field)
+			if !ok {
+				continue
+			}
+			fieldPath := field.Name
+			if path != "" {
+				fieldPath = path + "." + field.Name
+			}
+			s.Properties[name] = schemaOf(fieldPath, field.Type)
+		}
+		return s
+	default:
+		// any JSON value.
+		return &JSONSchema{}
+	}
+}
+
+func schemaOfMarshaler(t reflect.Type) *JSONSchema {
+	b, err := reflect.Zero(t).Interface().(json.Marshaler).MarshalJSON()
+	if err != nil {
+		return &JSONSchema{}
+	}
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return &JSONSchema{}
+	}
+	return &JSONSchema{Type: jsonType(v)}
+}
+
+// jsonFieldName returns the name of the field in the config file, or false if it isn't read from the file.
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	if !field.IsExported() {
+		return "", false
+	}
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	if name, _, _ := strings.Cut(tag, ","); name != "" {
+		return name, true
+	}
+	return field.Name, true
+}
+
+// jsonType returns the JSON Schema type of a value unmarshaled from JSON.
+func jsonType(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// property returns the schema of the property named name. Like encoding/json, names which only differ in case match
+// if there isn't an exact match.
+func (s *JSONSchema) property(name string) (*JSONSchema, bool) {
+	if prop, ok := s.Properties[name]; ok {
+		return prop, true
+	}
+	for k, prop := range s.Properties {
+		if strings.EqualFold(k, name) {
+			return prop, true
+		}
+	}
+	return nil, false
+}
+
+// validateSchema validates the content of the config file against the schema, and adds a violation for each value
+// of the wrong type, property which isn't a field of the config, and value which isn't allowed.
+func validateSchema(v *violations, s *JSONSchema, path string, value any) {
+	switch s.Type {
+	case "":
+		return
+	case "integer":
+		n, ok := value.(float64)
+		if !ok || n != float64(int64(n)) {
+			v.add(path, "must be an integer")
+			return
+		}
+		if s.Minimum != nil && n < float64(*s.Minimum) {
+			v.add(path, "must be at least %d", *s.Minimum)
+		}
+		return
+	default:
+		if jsonType(value) != s.Type {
+			v.add(path, "must be of type %s", s.Type)
+			return
+		}
+	}
+
+	switch value := value.(type) {
+	case string:
+		if len(s.Enum) > 0 && !slices.Contains(s.Enum, value) {
+			v.add(path, "must be one of %s", strings.Join(s.Enum, ", "))
+		}
+	case []any:
+		for i, item := range value {
+			validateSchema(v, s.Items, path+"["+strconv.Itoa(i)+"]", item)
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(value))
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			propPath := k
+			if path != "" {
+				propPath = path + "." + k
+			}
+			if prop, ok := s.property(k); ok {
+				validateSchema(v, prop, propPath, value[k])
+				continue
+			}
+			switch additional := s.AdditionalProperties.(type) {
+			case *JSONSchema:
+				validateSchema(v, additional, propPath, value[k])
+			case bool:
+				if !additional {
+					v.add(propPath, "is not a config field")
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package configuration
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update the schema file")
+
+// TestSchemaFile checks that the schema file of the platform is up to date with CNSConfig, which has platform specific
+// logger fields. Run with -update to regenerate it.
+func TestSchemaFile(t *testing.T) {
+	file := "cns_config.schema.json"
+	if runtime.GOOS == "windows" {
+		file = "cns_config_windows.schema.json"
+	}
+	got, err := MarshalSchema()
+	require.NoError(t, err)
+	if *update {
+		require.NoError(t, os.WriteFile(file, got, 0o644)) //nolint:gosec // the schema is public
+	}
+	want, err := os.ReadFile(file)
+	require.NoError(t, err)
+	require.JSONEq(t, string(want), string(got), "%s is out of date, run go test -run TestSchemaFile -update", file)
+}
+
+func TestSchema(t *testing.T) {
+	s := Schema()
+	require.Equal(t, "object", s.Type)
+	require.Equal(t, false, s.AdditionalProperties)
+	require.Equal(t, channelModes, s.Properties["ChannelMode"].Enum)
+	require.Equal(t, "integer", s.Properties["TelemetrySettings"].Properties["HeartBeatIntervalInMins"].Type)
+	require.Equal(t, "integer", s.Properties["GRPCSettings"].Properties["Port"].Type)
+	require.Equal(t, 0, *s.Properties["GRPCSettings"].Properties["Port"].Minimum)
+	require.Equal(t, "array", s.Properties["SPIFFESettings"].Properties["AllowedClientIDs"].Type)
+	// json tags name the properties, and durations are strings.
+	require.Equal(t, "number", s.Properties["Tracing"].Properties["sampleRatio"].Type)
+	require.Equal(t, "string", s.Properties["Logger"].Properties["appInsights"].Properties["grace_period"].Type)
+	// fields which aren't read from the file aren't in the schema.
+	require.NotContains(t, s.Properties, "WatchPods")
+	require.NotContains(t, s.Properties["Logger"].Properties, "Levels")
+}
+
+func TestValidateSchema(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want []Violation
+	}{
+		{
+			name: "valid",
+			json: `{"ChannelMode": "CRD", "channelmode": "CRD", "GRPCSettings": {"Port": 8080}, "Tracing": {"otlpHeaders": {"a": "b"}}}`,
+		},
+		{
+			name: "unknown fields",
+			json: `{"ChanelMode": "CRD", "TelemetrySettings": {"DisableAl": true}}`,
+			want: []Violation{
+				{Field: "ChanelMode", Message: "is not a config field"},
+				{Field: "TelemetrySettings.DisableAl", Message: "is not a config field"},
+			},
+		},
+		{
+			name: "wrong types",
+			json: `{"UseHTTPS": "true", "SyncHostNCVersionIntervalMs": 1.5, "GRPCSettings": {"Port": -1}, "SPIFFESettings": {"AllowedClientIDs": [1]}}`,
+			want: []Violation{
+				{Field: "GRPCSettings.Port", Message: "must be at least 0"},
+				{Field: "SPIFFESettings.AllowedClientIDs[0]", Message: "must be of type string"},
+				{Field: "SyncHostNCVersionIntervalMs", Message: "must be an integer"},
+				{Field: "UseHTTPS", Message: "must be of type boolean"},
+			},
+		},
+		{
+			name: "enum",
+			json: `{"ChannelMode": "crd"}`,
+			want: []Violation{
+				{Field: "ChannelMode", Message: "must be one of Direct, Managed, CRD, MultiTenantCRD, AzureHost"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var raw any
+			require.NoError(t, json.Unmarshal([]byte(tt.json), &raw))
+			var v violations
+			validateSchema(&v, Schema(), "", raw)
+			require.Equal(t, tt.want, []Violation(v))
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package configuration
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/spiffe"
+	"github.com/pkg/errors"
+)
+
+// Violation is a field of the config which is invalid, by itself or in combination with other fields.
+type Violation struct {
+	// Field is the path of the field in the config file, by the JSON names of the fields, such as
+	// "TelemetrySettings.HeartBeatIntervalInMins" or "Tracing.sampleRatio". Violations of the schema use the same paths.
+	Field   string
+	Message string
+}
+
+func (v Violation) String() string {
+	return v.Field + ": " + v.Message
+}
+
+// ValidationError lists all of the violations of an invalid config, so that they can be fixed at once.
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	s := make([]string, len(e.Violations))
+	for i := range e.Violations {
+		s[i] = e.Violations[i].String()
+	}
+	return fmt.Sprintf("invalid config, %d violation(s): %s", len(e.Violations), strings.Join(s, "; "))
+}
+
+type violations []Violation
+
+func (v *violations) add(field, format string, args ...any) {
+	*v = append(*v, Violation{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v violations) err() error {
+	if len(v) == 0 {
+		return nil
+	}
+	return &ValidationError{Violations: v}
+}
+
+// crdFeatures are the features which are only started by CNS in ChannelMode CRD, by field.
+// EnableSwiftV2 isn't one of them, since it also enables the device plugin with EnableK8sDevicePlugin in other modes.
+var crdFeatures = []struct {
+	field   string
+	enabled func(*CNSConfig) bool
+}{
+	{"EnableIPAMv2", func(c *CNSConfig) bool { return c.EnableIPAMv2 }},
+	{"EnableNCStatusReporting", func(c *CNSConfig) bool { return c.EnableNCStatusReporting }},
+	{"EnableStateMigration", func(c *CNSConfig) bool { return c.EnableStateMigration }},
+	{"EnableSwiftV1DualStack", func(c *CNSConfig) bool { return c.EnableSwiftV1DualStack }},
+}
+
+// Validate checks the values of the config, and the combinations of fields which CNS can't run with.
+// The config must have its defaults set by SetCNSConfigDefaults. If it's invalid, the error is a *ValidationError.
+func Validate(config *CNSConfig) error {
+	var v violations
+
+	if !slices.Contains(channelModes, config.ChannelMode) {
+		v.add("ChannelMode", "must be one of %s", strings.Join(channelModes, ", "))
+	}
+	if !slices.Contains(tlsVersions, config.MinTLSVersion) {
+		v.add("MinTLSVersion", "must be one of %s", strings.Join(tlsVersions, ", "))
+	}
+
+	// endpoint state
+	if config.ChannelMode == cns.AzureHost && !config.ManageEndpointState {
+		v.add("ManageEndpointState", "must be true in ChannelMode %s", cns.AzureHost)
+	}
+	if config.EnableStateMigration && !config.ManageEndpointState {
+		v.add("EnableStateMigration", "requires ManageEndpointState, since the state is migrated from CNI to the endpoint state of CNS")
+	}
+
+	// channel modes
+	if config.ChannelMode == cns.Managed {
+		for field, value := range map[string]string{
+			"ManagedSettings.PrivateEndpoint":         config.ManagedSettings.PrivateEndpoint,
+			"ManagedSettings.InfrastructureNetworkID": config.ManagedSettings.InfrastructureNetworkID,
+			"ManagedSettings.NodeID":                  config.ManagedSettings.NodeID,
+		} {
+			if value == "" {
+				v.add(field, "must be set in ChannelMode %s", cns.Managed)
+			}
+		}
+	}
+	// TLS
+	spiffeEnabled := config.SPIFFESettings.WorkloadAPIAddress != ""
+	if config.UseMTLS && !config.UseHTTPS {
+		v.add("UseMTLS", "requires UseHTTPS")
+	}
+	if config.UseHTTPS && !spiffeEnabled && config.TLSCertificatePath == "" && config.KeyVaultSettings.URL == "" {
+		v.add("UseHTTPS", "requires TLSCertificatePath, KeyVaultSettings.URL or SPIFFESettings.WorkloadAPIAddress")
+	}
+	if (config.KeyVaultSettings.URL == "") != (config.KeyVaultSettings.CertificateName == "") {
+		v.add("KeyVaultSettings", "URL and CertificateName must be set together")
+	}
+	if spiffeEnabled {
+		if !config.UseMTLS {
+			v.add("SPIFFESettings.WorkloadAPIAddress", "requires UseMTLS")
+		}
+		if _, err := spiffe.ParseAllowlist(config.SPIFFESettings.AllowedClientIDs); err != nil {
+			v.add("SPIFFESettings.AllowedClientIDs", "%v", err)
+		}
+	}
+
+	// intervals, which are defaulted if they're zero
+	for field, value := range map[string]int{
+		"AZRSettings.PopulateHomeAzCacheRetryIntervalSecs": config.AZRSettings.PopulateHomeAzCacheRetryIntervalSecs,
+		"KeyVaultSettings.RefreshIntervalInHrs":            config.KeyVaultSettings.RefreshIntervalInHrs,
+		"ManagedSettings.NodeSyncIntervalInSeconds":        config.ManagedSettings.NodeSyncIntervalInSeconds,
+		"SyncHostNCTimeoutMs":                              config.SyncHostNCTimeoutMs,
+		"SyncHostNCVersionIntervalMs":                      config.SyncHostNCVersionIntervalMs,
+		"TLSCertificateExpiryWarningDays":                  config.TLSCertificateExpiryWarningDays,
+		"TelemetrySettings.HeartBeatIntervalInMins":        config.TelemetrySettings.HeartBeatIntervalInMins,
+		"TelemetrySettings.RefreshIntervalInSecs":          config.TelemetrySettings.RefreshIntervalInSecs,
+		"TelemetrySettings.SnapshotIntervalInMins":         config.TelemetrySettings.SnapshotIntervalInMins,
+		"TelemetrySettings.TelemetryBatchIntervalInSecs":   config.TelemetrySettings.TelemetryBatchIntervalInSecs,
+		"TelemetrySettings.TelemetryBatchSizeBytes":        config.TelemetrySettings.TelemetryBatchSizeBytes,
+	} {
+		if value <= 0 {
+			v.add(field, "must be positive")
+		}
+	}
+	for field, value := range map[string]int{
+		"MellanoxMonitorIntervalSecs":                    config.MellanoxMonitorIntervalSecs,
+		"TelemetrySettings.ConfigSnapshotIntervalInMins": config.TelemetrySettings.ConfigSnapshotIntervalInMins,
+	} {
+		if value < 0 {
+			v.add(field, "must not be negative")
+		}
+	}
+	if config.Tracing.SampleRatio < 0 || config.Tracing.SampleRatio > 1 {
+		v.add("Tracing.sampleRatio", "must be between 0 and 1")
+	}
+
+	slices.SortStableFunc(v, func(a, b Violation) int { return strings.Compare(a.Field, b.Field) })
+	return v.err()
+}
+
+// Warnings returns the fields of the config which are ignored in its ChannelMode. They don't stop CNS from running,
+// but the features they enable aren't started.
+func Warnings(config *CNSConfig) []Violation {
+	var v violations
+	if config.ChannelMode != cns.CRD {
+		for _, feature := range crdFeatures {
+			if feature.enabled(config) {
+				v.add(feature.field, "is ignored outside ChannelMode %s", cns.CRD)
+			}
+		}
+	}
+	return v
+}
+
+// ValidateFile validates the config file at the path ReadConfig uses for cmdLineConfigPath against the schema of
+// the config, and then validates the config it sets with Validate. If it's invalid, the error is a *ValidationError
+// listing all of the violations. The Warnings of the config are returned either way.
+func ValidateFile(cmdLineConfigPath string) ([]Violation, error) {
+	path, err := getConfigFilePath(cmdLineConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read config file %s", path)
+	}
+
+	var raw any
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse config file %s", path)
+	}
+	var v violations
+	validateSchema(&v, Schema(), "", raw)
+
+	var config CNSConfig
+	if err := json.Unmarshal(content, &config); err != nil {
+		if len(v) > 0 {
+			// the schema violations explain why the config can't be unmarshaled.
+			return nil, v.err()
+		}
+		return nil, errors.Wrap(err, "failed to unmarshal config")
+	}
+	SetCNSConfigDefaults(&config)
+	var validationErr *ValidationError
+	if errors.As(Validate(&config), &validationErr) {
+		v = append(v, validationErr.Violations...)
+	}
+	return Warnings(&config), v.err()
+}
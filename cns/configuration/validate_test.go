@@ -0,0 +1,195 @@
+package configuration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config CNSConfig
+		want   []string
+	}{
+		{
+			name:   "defaults",
+			config: CNSConfig{},
+		},
+		{
+			name: "crd with managed endpoint state",
+			config: CNSConfig{
+				ChannelMode:          cns.CRD,
+				ManageEndpointState:  true,
+				EnableStateMigration: true,
+				EnableSwiftV2:        true,
+			},
+		},
+		{
+			name:   "unknown channel mode and tls version",
+			config: CNSConfig{ChannelMode: "crd", MinTLSVersion: "TLS 1.1"},
+			want:   []string{"ChannelMode", "MinTLSVersion"},
+		},
+		{
+			name:   "endpoint state",
+			config: CNSConfig{ChannelMode: cns.AzureHost, EnableStateMigration: true},
+			want:   []string{"EnableStateMigration", "ManageEndpointState"},
+		},
+		{
+			name:   "managed without settings",
+			config: CNSConfig{ChannelMode: cns.Managed, ManagedSettings: ManagedSettings{NodeID: "node"}},
+			want:   []string{"ManagedSettings.InfrastructureNetworkID", "ManagedSettings.PrivateEndpoint"},
+		},
+		{
+			name:   "https without certificate",
+			config: CNSConfig{UseHTTPS: true, KeyVaultSettings: KeyVaultSettings{CertificateName: "cert"}},
+			want:   []string{"KeyVaultSettings", "UseHTTPS"},
+		},
+		{
+			name:   "spiffe without mtls",
+			config: CNSConfig{SPIFFESettings: SPIFFESettings{WorkloadAPIAddress: "unix:///run/spire/sockets/agent.sock"}},
+			want:   []string{"SPIFFESettings.AllowedClientIDs", "SPIFFESettings.WorkloadAPIAddress"},
+		},
+		{
+			name: "mtls without https",
+			config: CNSConfig{
+				UseMTLS: true,
+				SPIFFESettings: SPIFFESettings{
+					WorkloadAPIAddress: "unix:///run/spire/sockets/agent.sock",
+					AllowedClientIDs:   []string{"spiffe://example.org"},
+				},
+			},
+			want: []string{"UseMTLS"},
+		},
+		{
+			name: "spiffe",
+			config: CNSConfig{
+				UseHTTPS: true,
+				UseMTLS:  true,
+				SPIFFESettings: SPIFFESettings{
+					WorkloadAPIAddress: "unix:///run/spire/sockets/agent.sock",
+					AllowedClientIDs:   []string{"spiffe://example.org/ns/kube-system/*"},
+				},
+			},
+		},
+		{
+			name: "negative intervals",
+			config: CNSConfig{
+				SyncHostNCVersionIntervalMs: -1,
+				MellanoxMonitorIntervalSecs: -1,
+				TelemetrySettings:           TelemetrySettings{HeartBeatIntervalInMins: -1, ConfigSnapshotIntervalInMins: -1},
+			},
+			want: []string{
+				"MellanoxMonitorIntervalSecs",
+				"SyncHostNCVersionIntervalMs",
+				"TelemetrySettings.ConfigSnapshotIntervalInMins",
+				"TelemetrySettings.HeartBeatIntervalInMins",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			SetCNSConfigDefaults(&config)
+			err := Validate(&config)
+			if len(tt.want) == 0 {
+				require.NoError(t, err)
+				return
+			}
+			var validationErr *ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			got := make([]string, len(validationErr.Violations))
+			for i, v := range validationErr.Violations {
+				got[i] = v.Field
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	// SwiftV2 also enables the device plugin outside ChannelMode CRD.
+	config := &CNSConfig{ChannelMode: cns.AzureHost, EnableIPAMv2: true, EnableSwiftV2: true, EnableK8sDevicePlugin: true}
+	require.Equal(t, []Violation{
+		{Field: "EnableIPAMv2", Message: "is ignored outside ChannelMode CRD"},
+	}, Warnings(config))
+
+	config.ChannelMode = cns.CRD
+	require.Empty(t, Warnings(config))
+}
+
+func TestViolationFieldsAreJSONPaths(t *testing.T) {
+	config := CNSConfig{
+		ChannelMode:          cns.Managed,
+		EnableStateMigration: true,
+		UseHTTPS:             true,
+		UseMTLS:              true,
+		KeyVaultSettings:     KeyVaultSettings{CertificateName: "cert"},
+		SPIFFESettings: SPIFFESettings{
+			WorkloadAPIAddress: "unix:///run/spire/sockets/agent.sock",
+			AllowedClientIDs:   []string{"https://example.org"},
+		},
+		MellanoxMonitorIntervalSecs: -1,
+		SyncHostNCVersionIntervalMs: -1,
+	}
+	SetCNSConfigDefaults(&config)
+	config.MinTLSVersion = "TLS 1.1"
+	config.Tracing.SampleRatio = 2
+	var validationErr *ValidationError
+	require.ErrorAs(t, Validate(&config), &validationErr)
+	fields := []string{}
+	for _, v := range validationErr.Violations {
+		fields = append(fields, v.Field)
+	}
+	for _, feature := range crdFeatures {
+		fields = append(fields, feature.field)
+	}
+
+	for _, field := range fields {
+		s := Schema()
+		for _, name := range strings.Split(field, ".") {
+			prop, ok := s.Properties[name]
+			require.True(t, ok, "%s isn't the JSON path of a field of the config", field)
+			s = prop
+		}
+	}
+}
+
+func TestValidateFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		path := filepath.Join(dir, "cns_config.json")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	warnings, err := ValidateFile("./cns_config.json")
+	require.NoError(t, err)
+	require.Empty(t, warnings)
+
+	// schema and semantic violations are listed together.
+	warnings, err = ValidateFile(write(`{"ChannelMode": "Direct", "UseMTLS": true, "EnableIPAMv2": true, "Typo": 1}`))
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	require.Equal(t, []Violation{
+		{Field: "Typo", Message: "is not a config field"},
+		{Field: "UseMTLS", Message: "requires UseHTTPS"},
+	}, validationErr.Violations)
+	require.Equal(t, []Violation{{Field: "EnableIPAMv2", Message: "is ignored outside ChannelMode CRD"}}, warnings)
+
+	// a config which can't be unmarshaled only has the schema violations.
+	_, err = ValidateFile(write(`{"ChannelMode": 1, "UseMTLS": true}`))
+	require.ErrorAs(t, err, &validationErr)
+	require.Equal(t, []Violation{{Field: "ChannelMode", Message: "must be of type string"}}, validationErr.Violations)
+
+	_, err = ValidateFile(write(`{`))
+	require.Error(t, err)
+	require.NotErrorAs(t, err, &validationErr)
+
+	_, err = ValidateFile(filepath.Join(dir, "missing.json"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
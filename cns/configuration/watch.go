@@ -0,0 +1,177 @@
+package configuration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+// resyncInterval is how often the config file is re-read, in case a change to it wasn't notified.
+const resyncInterval = time.Minute
+
+var ErrNonReloadableChange = errors.New("fields which can't be reloaded changed, restart CNS to apply them")
+
+// ReloadFunc applies the reloadable fields of updated to a running component. old is the previously applied config.
+// Both configs have their defaults set, and must not be modified.
+type ReloadFunc func(old, updated *CNSConfig)
+
+// Watcher watches the config file, and applies the changes to its reloadable fields to the running components.
+// Changes to any other field reject the whole file, since CNS runs with a config it read at startup.
+type Watcher struct {
+	path    string
+	current atomic.Pointer[CNSConfig]
+
+	// m serializes the reloads, and guards the content of the file and the handlers.
+	m        sync.Mutex
+	content  []byte
+	handlers []ReloadFunc
+}
+
+// NewWatcher returns a Watcher of the config file at the path ReadConfig uses for cmdLineConfigPath. initial is the
+// config CNS started with, before it was modified by CNS, which changes to the file are compared with.
+func NewWatcher(cmdLineConfigPath string, initial *CNSConfig) (*Watcher, error) {
+	path, err := getConfigFilePath(cmdLineConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	current, err := copyConfig(initial)
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{path: path}
+	w.current.Store(current)
+	return w, nil
+}
+
+// OnReload registers f to be called when the reloadable fields of the config change.
+func (w *Watcher) OnReload(f ReloadFunc) {
+	w.m.Lock()
+	defer w.m.Unlock()
+	w.handlers = append(w.handlers, f)
+}
+
+// Current returns the latest applied config. It must not be modified. Handlers called while a config is being
+// applied get the previous config.
+func (w *Watcher) Current() *CNSConfig {
+	return w.current.Load()
+}
+
+// Watch reloads the config file when it changes, and at least every minute. It watches the directory of the file
+// rather than the file itself, so that the file can be replaced, as kubelet does when updating ConfigMaps.
+// It blocks until ctx is done.
+func (w *Watcher) Watch(ctx context.Context) {
+	ticker := time.NewTicker(resyncInterval)
+	defer ticker.Stop()
+
+	var events <-chan fsnotify.Event
+	var watchErrs <-chan error
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		defer watcher.Close()
+		err = watcher.Add(filepath.Dir(w.path))
+	}
+	if err != nil {
+		logger.Errorf("[Configuration] Could not watch config file %s, only re-reading it every %s: %v", w.path, resyncInterval, err)
+	} else {
+		events, watchErrs = watcher.Events, watcher.Errors
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.reload()
+		case _, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			w.reload()
+		case err, ok := <-watchErrs:
+			if !ok {
+				watchErrs = nil
+				continue
+			}
+			logger.Errorf("[Configuration] Error watching config file %s: %v", w.path, err)
+		}
+	}
+}
+
+// reload reads the config file and applies it if its reloadable fields changed. The file is only processed once
+// per content, so that a rejected change is not logged on every resync.
+func (w *Watcher) reload() {
+	content, err := os.ReadFile(w.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		logger.Errorf("[Configuration] Could not read config file %s, keeping the current config: %v", w.path, err)
+		return
+	}
+
+	w.m.Lock()
+	defer w.m.Unlock()
+	if w.content != nil && bytes.Equal(content, w.content) {
+		return
+	}
+	w.content = content
+
+	if err := w.apply(content); err != nil {
+		logger.Errorf("[Configuration] Rejected config file %s, keeping the current config: %v", w.path, err)
+	}
+}
+
+// apply parses the content of the config file and calls the handlers if only reloadable fields changed.
+func (w *Watcher) apply(content []byte) error {
+	var updated CNSConfig
+	if err := json.Unmarshal(content, &updated); err != nil {
+		configReloads.WithLabelValues(reloadResultInvalid).Inc()
+		return errors.Wrap(err, "failed to unmarshal config")
+	}
+	SetCNSConfigDefaults(&updated)
+	if err := Validate(&updated); err != nil {
+		configReloads.WithLabelValues(reloadResultInvalid).Inc()
+		return err
+	}
+
+	current := w.current.Load()
+	reloadable, nonReloadable := changedFields(current, &updated)
+	if len(nonReloadable) > 0 {
+		configReloads.WithLabelValues(reloadResultNonReloadable).Inc()
+		return errors.Wrapf(ErrNonReloadableChange, "%s", joinFields(nonReloadable))
+	}
+	if len(reloadable) == 0 {
+		return nil
+	}
+
+	for _, f := range w.handlers {
+		f(current, &updated)
+	}
+	w.current.Store(&updated)
+	configReloads.WithLabelValues(reloadResultApplied).Inc()
+	logger.Printf("[Configuration] Reloaded config file %s, changed fields: %s", w.path, joinFields(reloadable))
+	return nil
+}
+
+// copyConfig returns a deep copy of the fields of config read from the config file.
+func copyConfig(config *CNSConfig) (*CNSConfig, error) {
+	b, err := json.Marshal(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal config")
+	}
+	var c CNSConfig
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal config")
+	}
+	return &c, nil
+}
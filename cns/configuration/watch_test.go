@@ -0,0 +1,166 @@
+package configuration
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns/logger"
+	cores "github.com/Azure/azure-container-networking/cns/logger/v2/cores"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangedFields(t *testing.T) {
+	tests := []struct {
+		name              string
+		update            func(*CNSConfig)
+		wantReloadable    []string
+		wantNonReloadable []string
+	}{
+		{
+			name:   "unchanged",
+			update: func(*CNSConfig) {},
+		},
+		{
+			name: "reloadable",
+			update: func(c *CNSConfig) {
+				c.SyncHostNCVersionIntervalMs = 5000
+				c.TelemetrySettings.HeartBeatIntervalInMins = 10
+				c.Logger.Level = "debug"
+			},
+			wantReloadable: []string{"Logger.Level", "SyncHostNCVersionIntervalMs", "TelemetrySettings.HeartBeatIntervalInMins"},
+		},
+		{
+			name: "non reloadable",
+			update: func(c *CNSConfig) {
+				c.ProgramSNATIPTables = true
+				c.ChannelMode = "AzureHost"
+				c.TelemetrySettings.DisableAll = true
+				c.ManagedSettings.NodeID = "node"
+			},
+			wantReloadable:    []string{"ProgramSNATIPTables"},
+			wantNonReloadable: []string{"ChannelMode", "ManagedSettings.NodeID", "TelemetrySettings.DisableAll"},
+		},
+		{
+			name: "pointer set",
+			update: func(c *CNSConfig) {
+				c.Logger.AppInsights = &cores.AppInsightsConfig{}
+			},
+			wantNonReloadable: []string{"Logger.AppInsights"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := &CNSConfig{}
+			SetCNSConfigDefaults(old)
+			updated, err := copyConfig(old)
+			require.NoError(t, err)
+			tt.update(updated)
+
+			reloadable, nonReloadable := changedFields(old, updated)
+			require.ElementsMatch(t, tt.wantReloadable, reloadable)
+			require.ElementsMatch(t, tt.wantNonReloadable, nonReloadable)
+		})
+	}
+}
+
+func TestWatcherReload(t *testing.T) {
+	logger.InitLogger("testlogs", 0, 0, t.TempDir()+"/")
+	path := filepath.Join(t.TempDir(), "cns_config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"ChannelMode": "CRD", "SyncHostNCVersionIntervalMs": 1000}`), 0o600))
+	initial, err := ReadConfig(path)
+	require.NoError(t, err)
+	SetCNSConfigDefaults(initial)
+
+	w, err := NewWatcher(path, initial)
+	require.NoError(t, err)
+	var reloads []*CNSConfig
+	w.OnReload(func(old, updated *CNSConfig) {
+		require.Equal(t, w.Current(), old)
+		reloads = append(reloads, updated)
+	})
+	applied := testutil.ToFloat64(configReloads.WithLabelValues(reloadResultApplied))
+	invalid := testutil.ToFloat64(configReloads.WithLabelValues(reloadResultInvalid))
+	nonReloadable := testutil.ToFloat64(configReloads.WithLabelValues(reloadResultNonReloadable))
+
+	// the config CNS started with isn't reloaded
+	w.reload()
+	require.Empty(t, reloads)
+
+	// reloadable changes are applied
+	require.NoError(t, os.WriteFile(path, []byte(`{"ChannelMode": "CRD", "SyncHostNCVersionIntervalMs": 2000}`), 0o600))
+	w.reload()
+	require.Len(t, reloads, 1)
+	require.Equal(t, 2000, reloads[0].SyncHostNCVersionIntervalMs)
+	require.Equal(t, 2000, w.Current().SyncHostNCVersionIntervalMs)
+	require.InDelta(t, applied+1, testutil.ToFloat64(configReloads.WithLabelValues(reloadResultApplied)), 0)
+
+	// changes to other fields reject the whole file
+	require.NoError(t, os.WriteFile(path, []byte(`{"ChannelMode": "Direct", "SyncHostNCVersionIntervalMs": 3000}`), 0o600))
+	w.reload()
+	require.Len(t, reloads, 1)
+	require.Equal(t, 2000, w.Current().SyncHostNCVersionIntervalMs)
+	require.InDelta(t, nonReloadable+1, testutil.ToFloat64(configReloads.WithLabelValues(reloadResultNonReloadable)), 0)
+
+	// a rejected file is only processed once
+	w.reload()
+	require.InDelta(t, nonReloadable+1, testutil.ToFloat64(configReloads.WithLabelValues(reloadResultNonReloadable)), 0)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"ChannelMode": `), 0o600))
+	w.reload()
+	require.Len(t, reloads, 1)
+	require.InDelta(t, invalid+1, testutil.ToFloat64(configReloads.WithLabelValues(reloadResultInvalid)), 0)
+
+	// reloadable changes are validated
+	require.NoError(t, os.WriteFile(path, []byte(`{"ChannelMode": "CRD", "SyncHostNCVersionIntervalMs": -1}`), 0o600))
+	w.reload()
+	require.Len(t, reloads, 1)
+	require.Equal(t, 2000, w.Current().SyncHostNCVersionIntervalMs)
+	require.InDelta(t, invalid+2, testutil.ToFloat64(configReloads.WithLabelValues(reloadResultInvalid)), 0)
+
+	// a removed file keeps the current config
+	require.NoError(t, os.Remove(path))
+	w.reload()
+	require.Equal(t, 2000, w.Current().SyncHostNCVersionIntervalMs)
+}
+
+func TestWatcherWatch(t *testing.T) {
+	logger.InitLogger("testlogs", 0, 0, t.TempDir()+"/")
+	path := filepath.Join(t.TempDir(), "cns_config.json")
+	initial := &CNSConfig{}
+	SetCNSConfigDefaults(initial)
+
+	w, err := NewWatcher(path, initial)
+	require.NoError(t, err)
+	reloaded := make(chan *CNSConfig, 1)
+	w.OnReload(func(_, updated *CNSConfig) {
+		select {
+		case reloaded <- updated:
+		default:
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Watch(ctx)
+
+	// the file is replaced, as kubelet does when updating ConfigMaps.
+	tmp := filepath.Join(filepath.Dir(path), "tmp.json")
+	require.NoError(t, os.WriteFile(tmp, []byte(`{"TelemetrySettings": {"HeartBeatIntervalInMins": 5}}`), 0o600))
+	require.Eventually(t, func() bool {
+		// retried until the watcher has started watching the directory.
+		if err := os.Rename(tmp, path); err == nil {
+			require.NoError(t, os.WriteFile(tmp, []byte(`{"TelemetrySettings": {"HeartBeatIntervalInMins": 5}}`), 0o600))
+		}
+		select {
+		case updated := <-reloaded:
+			require.Equal(t, 5, updated.TelemetrySettings.HeartBeatIntervalInMins)
+			return true
+		default:
+			return false
+		}
+	}, 5*time.Second, 50*time.Millisecond)
+}
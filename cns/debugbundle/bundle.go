@@ -0,0 +1,67 @@
+// Package debugbundle collects what is needed to debug the network of a pod into a single tar.gz.
+// Everything added to a bundle is redacted first, so bundles can be shared.
+package debugbundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const bundleFilePerm = 0o600
+
+// Writer writes files to a tar.gz bundle.
+type Writer struct {
+	gz  *gzip.Writer
+	tw  *tar.Writer
+	now time.Time
+}
+
+// NewWriter returns a Writer which writes the bundle to w. The bundle is complete once the Writer is closed.
+func NewWriter(w io.Writer) *Writer {
+	gz := gzip.NewWriter(w)
+	return &Writer{gz: gz, tw: tar.NewWriter(gz), now: time.Now()}
+}
+
+// AddJSON adds v as the JSON file name, with the values of secret fields redacted.
+func (w *Writer) AddJSON(name string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal %s", name)
+	}
+	if b, err = RedactJSON(b); err != nil {
+		return errors.Wrapf(err, "failed to redact %s", name)
+	}
+	return w.add(name, b)
+}
+
+// AddText adds b as the file name, with secrets redacted.
+func (w *Writer) AddText(name string, b []byte) error {
+	return w.add(name, RedactText(b))
+}
+
+// Close completes the bundle.
+func (w *Writer) Close() error {
+	if err := w.tw.Close(); err != nil {
+		return errors.Wrap(err, "failed to close tar writer")
+	}
+	return errors.Wrap(w.gz.Close(), "failed to close gzip writer")
+}
+
+func (w *Writer) add(name string, b []byte) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    bundleFilePerm,
+		Size:    int64(len(b)),
+		ModTime: w.now,
+	}
+	if err := w.tw.WriteHeader(hdr); err != nil {
+		return errors.Wrapf(err, "failed to write header of %s", name)
+	}
+	_, err := w.tw.Write(b)
+	return errors.Wrapf(err, "failed to write %s", name)
+}
@@ -0,0 +1,119 @@
+package debugbundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/stretchr/testify/require"
+)
+
+// readBundle returns the files of the tar.gz b by name.
+func readBundle(t *testing.T, b []byte) map[string]string {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(b))
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+	files := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		require.NoError(t, err)
+		content, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[hdr.Name] = string(content)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	require.NoError(t, w.AddJSON("state.json", map[string]string{"id": "nc", "authorizationToken": "secret"}))
+	require.NoError(t, w.AddText("out.txt", []byte("Bearer secret\n")))
+	require.NoError(t, w.Close())
+
+	files := readBundle(t, b.Bytes())
+	require.Len(t, files, 2)
+	require.JSONEq(t, `{"id": "nc", "authorizationToken": "[REDACTED]"}`, files["state.json"])
+	require.Equal(t, "Bearer [REDACTED]\n", files["out.txt"])
+}
+
+func TestLogExcerpt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cns.log")
+	lines := []string{"pod-a 1", "pod-b 2", "10.0.0.4 3", "pod-a 4", "other 5", "pod-a 6"}
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600))
+
+	excerpt, err := LogExcerpt(path, []string{"pod-a", "10.0.0.4", ""}, 10)
+	require.NoError(t, err)
+	require.Equal(t, "pod-a 1\n10.0.0.4 3\npod-a 4\npod-a 6\n", string(excerpt))
+
+	// only the last lines are kept
+	excerpt, err = LogExcerpt(path, []string{"pod-a", "10.0.0.4"}, 2)
+	require.NoError(t, err)
+	require.Equal(t, "pod-a 4\npod-a 6\n", string(excerpt))
+
+	excerpt, err = LogExcerpt(path, []string{"pod-a"}, 0)
+	require.NoError(t, err)
+	require.Empty(t, excerpt)
+
+	_, err = LogExcerpt(filepath.Join(t.TempDir(), "missing.log"), []string{"pod-a"}, 10)
+	require.Error(t, err)
+}
+
+func TestCollectFiles(t *testing.T) {
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "cns.log")
+	stateFile := filepath.Join(dir, "state.json")
+	require.NoError(t, os.WriteFile(logFile, []byte("pod-a token=abc\npod-b\n"), 0o600))
+	require.NoError(t, os.WriteFile(stateFile, []byte(`{"Password": "hunter2", "Networks": {"azure": {"Endpoints": {
+		"a": {"PODName": "pod-a"},
+		"b": {"PODName": "pod-b"}
+	}}}}`), 0o600))
+
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	cfg := Config{
+		LogFiles:    []string{logFile, filepath.Join(dir, "missing.log")},
+		StateFiles:  []string{stateFile},
+		MaxLogLines: DefaultMaxLogLines,
+	}
+	require.NoError(t, CollectFiles(w, cfg, []string{"pod-a"}))
+	require.NoError(t, w.Close())
+
+	files := readBundle(t, b.Bytes())
+	require.Equal(t, "pod-a token=[REDACTED]\n", files["logs/cns.log"])
+	require.Contains(t, files["logs/missing.log"], "error: ")
+	// only the endpoints of the pod are kept from the state file
+	require.JSONEq(t, `{"Password": "[REDACTED]", "Networks": {"azure": {"Endpoints": {"a": {"PODName": "pod-a"}}}}}`, files["state/state.json"])
+}
+
+func TestRunCommands(t *testing.T) {
+	exec := platform.NewMockExecClient(false)
+	exec.SetExecCommand(func(cmd string, _ ...string) (string, error) {
+		if cmd == "missing" {
+			return "", platform.ErrMockExec
+		}
+		return cmd + " output\n", nil
+	})
+
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	require.NoError(t, RunCommands(context.Background(), exec, w, []Command{
+		{File: "ok.txt", Name: "ok"},
+		{File: "missing.txt", Name: "missing"},
+	}))
+	require.NoError(t, w.Close())
+
+	files := readBundle(t, b.Bytes())
+	require.Equal(t, "ok output\n", files["ok.txt"])
+	require.Contains(t, files["missing.txt"], platform.ErrMockExec.Error())
+}
@@ -0,0 +1,130 @@
+package debugbundle
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultMaxLogLines is the number of lines about a pod kept from each log file by default.
+const DefaultMaxLogLines = 1000
+
+// Config configures the files a bundle collects from the host.
+type Config struct {
+	// LogFiles are searched for the lines about the pod.
+	LogFiles []string
+	// StateFiles are added with only the endpoints of the pod, e.g. the state file of CNI.
+	StateFiles []string
+	// MaxLogLines is the number of lines about the pod kept from each log file.
+	MaxLogLines int
+}
+
+// DefaultConfig returns the Config which collects the logs and state of CNS and CNI from their default locations,
+// with the CNS log file at cnsLogFile.
+func DefaultConfig(cnsLogFile string) Config {
+	return Config{
+		LogFiles:    append([]string{cnsLogFile}, defaultLogFiles...),
+		StateFiles:  defaultStateFiles,
+		MaxLogLines: DefaultMaxLogLines,
+	}
+}
+
+// CollectFiles adds the excerpts of the log files and state files which mention any of terms.
+// A file which can't be read adds its error instead.
+func CollectFiles(w *Writer, cfg Config, terms []string) error {
+	for _, logFile := range cfg.LogFiles {
+		name := path.Join("logs", filepath.Base(logFile))
+		excerpt, err := LogExcerpt(logFile, terms, cfg.MaxLogLines)
+		if err != nil {
+			excerpt = []byte("error: " + err.Error() + "\n")
+		}
+		if err := w.AddText(name, excerpt); err != nil {
+			return err
+		}
+	}
+	for _, stateFile := range cfg.StateFiles {
+		name := path.Join("state", filepath.Base(stateFile))
+		b, err := os.ReadFile(stateFile)
+		if err != nil {
+			if err := w.AddText(name, []byte("error: "+err.Error()+"\n")); err != nil {
+				return err
+			}
+			continue
+		}
+		if json.Valid(b) {
+			if b, err = StateExcerpt(b, terms); err != nil {
+				return errors.Wrapf(err, "failed to filter %s", name)
+			}
+		}
+		if err := w.addFile(name, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StateExcerpt returns the JSON state file b with only the endpoints which mention any of terms, since a state file
+// such as CNI's holds the endpoints of every pod on the node. The endpoints are the values of "Endpoints" objects.
+func StateExcerpt(b []byte, terms []string) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var v any
+	if err := d.Decode(&v); err != nil {
+		return nil, errors.Wrap(err, "failed to decode JSON")
+	}
+	needles := make([][]byte, len(terms))
+	for i := range terms {
+		needles[i] = []byte(terms[i])
+	}
+	if err := filterEndpoints(v, needles); err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(v)
+	return b, errors.Wrap(err, "failed to encode JSON")
+}
+
+func filterEndpoints(v any, needles [][]byte) error {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if endpoints, ok := value.(map[string]any); ok && key == "Endpoints" {
+				for id, endpoint := range endpoints {
+					b, err := json.Marshal(endpoint)
+					if err != nil {
+						return errors.Wrapf(err, "failed to encode endpoint %s", id)
+					}
+					if !containsAny(b, needles) {
+						delete(endpoints, id)
+					}
+				}
+				continue
+			}
+			if err := filterEndpoints(value, needles); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for i := range v {
+			if err := filterEndpoints(v[i], needles); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addFile adds b, redacting it as JSON if it is a JSON document, and as text otherwise.
+func (w *Writer) addFile(name string, b []byte) error {
+	if json.Valid(b) {
+		redacted, err := RedactJSON(b)
+		if err != nil {
+			return errors.Wrapf(err, "failed to redact %s", name)
+		}
+		return w.add(name, redacted)
+	}
+	return w.AddText(name, b)
+}
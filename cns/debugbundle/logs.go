@@ -0,0 +1,68 @@
+package debugbundle
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// maxLogLineSize bounds the size of the lines read from log files.
+const maxLogLineSize = 1 << 20
+
+// LogExcerpt returns the last maxLines lines of the log file at path which contain any of terms.
+func LogExcerpt(path string, terms []string, maxLines int) ([]byte, error) {
+	if maxLines <= 0 {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open %s", path)
+	}
+	defer f.Close()
+
+	needles := make([][]byte, 0, len(terms))
+	for _, term := range terms {
+		if term != "" {
+			needles = append(needles, []byte(term))
+		}
+	}
+
+	// keep the last maxLines matching lines in a ring.
+	lines := make([][]byte, 0, maxLines)
+	next := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, maxLogLineSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if !containsAny(line, needles) {
+			continue
+		}
+		if len(lines) < maxLines {
+			lines = append(lines, bytes.Clone(line))
+			continue
+		}
+		lines[next] = bytes.Clone(line)
+		next = (next + 1) % maxLines
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", path)
+	}
+
+	var excerpt bytes.Buffer
+	for i := range lines {
+		excerpt.Write(lines[(next+i)%len(lines)])
+		excerpt.WriteByte('\n')
+	}
+	return excerpt.Bytes(), nil
+}
+
+func containsAny(line []byte, needles [][]byte) bool {
+	for _, needle := range needles {
+		if bytes.Contains(line, needle) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package debugbundle
+
+import (
+	"context"
+	"path"
+
+	"github.com/Azure/azure-container-networking/platform"
+)
+
+// Command is a command whose output is added to a bundle.
+type Command struct {
+	// File is the name of the file of the bundle the output is added as.
+	File string
+	Name string
+	Args []string
+}
+
+// RunCommands adds the output of the commands to the bundle.
+// A command which fails adds its error instead, so a tool missing from the host doesn't fail the bundle.
+func RunCommands(ctx context.Context, exec platform.ExecClient, w *Writer, cmds []Command) error {
+	for _, cmd := range cmds {
+		out, err := exec.ExecuteCommand(ctx, cmd.Name, cmd.Args...)
+		if err != nil {
+			out += "\nerror: " + err.Error() + "\n"
+		}
+		if err := w.AddText(cmd.File, []byte(out)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CollectNetwork adds dumps of the links, addresses, routes, rules and neighbors of the host,
+// and of the network namespaces of the pod, which are found from the host side of the pod's veths.
+func CollectNetwork(ctx context.Context, exec platform.ExecClient, w *Writer, hostVeths []string) error {
+	if err := RunCommands(ctx, exec, w, hostCommands); err != nil {
+		return err
+	}
+	for _, hostVeth := range hostVeths {
+		cmds, err := podCommands(ctx, exec, hostVeth)
+		if err != nil {
+			if err := w.AddText(path.Join("netns", hostVeth, "error.txt"), []byte(err.Error()+"\n")); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := RunCommands(ctx, exec, w, cmds); err != nil {
+			return err
+		}
+	}
+	return nil
+}
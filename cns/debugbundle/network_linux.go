@@ -0,0 +1,129 @@
+package debugbundle
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+)
+
+var (
+	defaultLogFiles   = []string{"/var/log/azure-vnet.log", "/var/log/azure-vnet-ipam.log", "/var/log/azure-vnet-events.jsonl"}
+	defaultStateFiles = []string{"/var/run/azure-vnet.json"}
+)
+
+var hostCommands = []Command{
+	{File: "host/ip-link.txt", Name: "ip", Args: []string{"-d", "link", "show"}},
+	{File: "host/ip-addr.txt", Name: "ip", Args: []string{"addr", "show"}},
+	{File: "host/ip-route.txt", Name: "ip", Args: []string{"route", "show", "table", "all"}},
+	{File: "host/ip-6-route.txt", Name: "ip", Args: []string{"-6", "route", "show", "table", "all"}},
+	{File: "host/ip-rule.txt", Name: "ip", Args: []string{"rule", "show"}},
+	{File: "host/ip-6-rule.txt", Name: "ip", Args: []string{"-6", "rule", "show"}},
+	{File: "host/ip-neigh.txt", Name: "ip", Args: []string{"neigh", "show"}},
+	{File: "host/iptables-save.txt", Name: "iptables-save"},
+	{File: "host/ip6tables-save.txt", Name: "ip6tables-save"},
+	{File: "host/ipset.txt", Name: "ipset", Args: []string{"list"}},
+}
+
+var (
+	// procDir holds the network namespace of each process, as <pid>/ns/net.
+	procDir = "/proc"
+	// netnsIDOf returns the id of the network namespace at path, as the link_netnsid of the links in the host
+	// network namespace whose peers are in it.
+	netnsIDOf = func(path string) (int, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to open network namespace")
+		}
+		defer f.Close()
+		id, err := netlink.GetNetNsIdByFd(int(f.Fd()))
+		return id, errors.Wrap(err, "failed to get network namespace id")
+	}
+)
+
+// podCommands returns the commands which dump the network namespace on the other side of hostVeth.
+func podCommands(ctx context.Context, exec platform.ExecClient, hostVeth string) ([]Command, error) {
+	netnsCmd, err := peerNetns(ctx, exec, hostVeth)
+	if err != nil {
+		return nil, err
+	}
+	dir := path.Join("netns", hostVeth)
+	inNetns := func(file string, args ...string) Command {
+		cmdArgs := append(append(append([]string{}, netnsCmd[1:]...), "ip"), args...)
+		return Command{File: path.Join(dir, file), Name: netnsCmd[0], Args: cmdArgs}
+	}
+	return []Command{
+		inNetns("ip-link.txt", "-d", "link", "show"),
+		inNetns("ip-addr.txt", "addr", "show"),
+		inNetns("ip-route.txt", "route", "show", "table", "all"),
+		inNetns("ip-6-route.txt", "-6", "route", "show", "table", "all"),
+		inNetns("ip-rule.txt", "rule", "show"),
+		inNetns("ip-neigh.txt", "neigh", "show"),
+	}, nil
+}
+
+// peerNetns returns the command which runs a command in the network namespace of the peer of hostVeth:
+// "ip netns exec" for a named network namespace, or nsenter into the network namespace of a process for one which
+// the container runtime didn't name.
+func peerNetns(ctx context.Context, exec platform.ExecClient, hostVeth string) ([]string, error) {
+	out, err := exec.ExecuteCommand(ctx, "ip", "-j", "link", "show", "dev", hostVeth)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to show link %s", hostVeth)
+	}
+	var links []struct {
+		LinkNetnsID *int `json:"link_netnsid"`
+	}
+	if err = json.Unmarshal([]byte(out), &links); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode link %s", hostVeth)
+	}
+	if len(links) == 0 || links[0].LinkNetnsID == nil {
+		return nil, errors.Errorf("peer of link %s is not in another network namespace", hostVeth)
+	}
+
+	if out, err = exec.ExecuteCommand(ctx, "ip", "-j", "netns", "list"); err != nil {
+		return nil, errors.Wrap(err, "failed to list network namespaces")
+	}
+	var namespaces []struct {
+		Name string `json:"name"`
+		ID   *int   `json:"id"`
+	}
+	if err = json.Unmarshal([]byte(out), &namespaces); err != nil {
+		return nil, errors.Wrap(err, "failed to decode network namespaces")
+	}
+	id := *links[0].LinkNetnsID
+	for _, ns := range namespaces {
+		if ns.ID != nil && *ns.ID == id {
+			return []string{"ip", "netns", "exec", ns.Name}, nil
+		}
+	}
+
+	if netnsPath, ok := processNetns(id); ok {
+		return []string{"nsenter", "--net=" + netnsPath}, nil
+	}
+	return nil, errors.Errorf("no named network namespace or process has network namespace id %d", id)
+}
+
+// processNetns returns the path of the network namespace of a process in the network namespace with id, such as the
+// pause container of a pod whose network namespace the container runtime didn't name.
+func processNetns(id int) (string, bool) {
+	entries, err := os.ReadDir(procDir)
+	if err != nil {
+		return "", false
+	}
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil || !entry.IsDir() {
+			continue
+		}
+		netnsPath := filepath.Join(procDir, entry.Name(), "ns", "net")
+		if nsID, err := netnsIDOf(netnsPath); err == nil && nsID == id {
+			return netnsPath, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,58 @@
+package debugbundle
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectNetwork(t *testing.T) {
+	// the network namespace of the pod behind azv3 was created by the container runtime without a name
+	defaultProcDir, defaultNetnsIDOf := procDir, netnsIDOf
+	t.Cleanup(func() { procDir, netnsIDOf = defaultProcDir, defaultNetnsIDOf })
+	procDir = t.TempDir()
+	for _, pid := range []string{"1", "42", "self"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(procDir, pid, "ns"), 0o755))
+	}
+	netnsIDOf = func(path string) (int, error) {
+		if path == filepath.Join(procDir, "42", "ns", "net") {
+			return 2, nil
+		}
+		return -1, nil
+	}
+
+	exec := platform.NewMockExecClient(false)
+	exec.SetExecCommand(func(cmd string, args ...string) (string, error) {
+		switch strings.Join(append([]string{cmd}, args...), " ") {
+		case "ip -j link show dev azv1":
+			return `[{"ifname":"azv1","link_netnsid":1}]`, nil
+		case "ip -j link show dev azv2":
+			return `[{"ifname":"azv2"}]`, nil
+		case "ip -j link show dev azv3":
+			return `[{"ifname":"azv3","link_netnsid":2}]`, nil
+		case "ip -j link show dev azv4":
+			return `[{"ifname":"azv4","link_netnsid":3}]`, nil
+		case "ip -j netns list":
+			return `[{"name":"cni-0","id":0},{"name":"cni-1","id":1}]`, nil
+		}
+		return strings.Join(args, " "), nil
+	})
+
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	require.NoError(t, CollectNetwork(context.Background(), exec, w, []string{"azv1", "azv2", "azv3", "azv4"}))
+	require.NoError(t, w.Close())
+
+	files := readBundle(t, b.Bytes())
+	require.Equal(t, "route show table all", files["host/ip-route.txt"])
+	require.Equal(t, "netns exec cni-1 ip route show table all", files["netns/azv1/ip-route.txt"])
+	require.Contains(t, files["netns/azv2/error.txt"], "not in another network namespace")
+	require.Equal(t, "--net="+filepath.Join(procDir, "42", "ns", "net")+" ip route show table all", files["netns/azv3/ip-route.txt"])
+	require.Contains(t, files["netns/azv4/error.txt"], "network namespace id 3")
+}
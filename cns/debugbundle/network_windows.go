@@ -0,0 +1,30 @@
+package debugbundle
+
+import (
+	"context"
+
+	"github.com/Azure/azure-container-networking/platform"
+)
+
+func powershell(file, command string) Command {
+	return Command{File: file, Name: "powershell.exe", Args: []string{"-NoProfile", "-NonInteractive", "-Command", command}}
+}
+
+var (
+	defaultLogFiles   = []string{`C:\k\azure-vnet.log`, `C:\k\azure-vnet-ipam.log`, `C:\k\azure-vnet-events.jsonl`}
+	defaultStateFiles = []string{`C:\k\azure-vnet.json`}
+)
+
+var hostCommands = []Command{
+	powershell("host/hns-networks.json", "Get-HnsNetwork | ConvertTo-Json -Depth 10"),
+	powershell("host/hns-endpoints.json", "Get-HnsEndpoint | ConvertTo-Json -Depth 10"),
+	powershell("host/hns-policylists.json", "Get-HnsPolicyList | ConvertTo-Json -Depth 10"),
+	{File: "host/ipconfig.txt", Name: "ipconfig", Args: []string{"/all"}},
+	{File: "host/route.txt", Name: "route", Args: []string{"print"}},
+	{File: "host/neighbors.txt", Name: "netsh", Args: []string{"interface", "ip", "show", "neighbors"}},
+}
+
+// podCommands returns no commands, since the endpoints of pods are in the HNS dumps of the host.
+func podCommands(context.Context, platform.ExecClient, string) ([]Command, error) {
+	return nil, nil
+}
@@ -0,0 +1,66 @@
+package debugbundle
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// Redacted replaces secrets in bundles.
+const Redacted = "[REDACTED]"
+
+var (
+	// secretKey matches the keys of JSON fields which hold secrets, e.g. AuthorizationToken.
+	secretKey = regexp.MustCompile(`(?i)(token|secret|password|passwd|credential|privatekey|apikey|signature)`)
+	// secretText matches secrets in text, keeping what precedes them in the first group.
+	secretText = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)(bearer\s+)[a-z0-9\-._~+/]+=*`),
+		regexp.MustCompile(`(?i)((?:token|secret|password|passwd|credential|apikey|signature|sig)"?\s*[:=]\s*"?)[^"\s&,;}]+`),
+	}
+)
+
+// RedactJSON replaces the values of the fields of the JSON document b whose keys look like they hold secrets,
+// and redacts the secrets in its other strings as RedactText does.
+func RedactJSON(b []byte) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var v any
+	if err := d.Decode(&v); err != nil {
+		return nil, errors.Wrap(err, "failed to decode JSON")
+	}
+	b, err := json.MarshalIndent(redactValue(v), "", "  ")
+	return b, errors.Wrap(err, "failed to encode JSON")
+}
+
+// RedactText replaces the secrets in b, such as bearer tokens and "password=..." pairs.
+func RedactText(b []byte) []byte {
+	for _, re := range secretText {
+		b = re.ReplaceAll(b, []byte("${1}"+Redacted))
+	}
+	return b
+}
+
+func redactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if _, isString := value.(string); isString && secretKey.MatchString(key) {
+				v[key] = Redacted
+				continue
+			}
+			v[key] = redactValue(value)
+		}
+		return v
+	case []any:
+		for i := range v {
+			v[i] = redactValue(v[i])
+		}
+		return v
+	case string:
+		return string(RedactText([]byte(v)))
+	default:
+		return v
+	}
+}
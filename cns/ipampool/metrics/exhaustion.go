@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// IpamTimeToAvailableIP measures how long Pods wait on the IP pool to scale once it runs out of IPs: from the first
+// IP allocation which fails because no IP is available, to the IP pool monitor observing an available IP again.
+var IpamTimeToAvailableIP = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "ipam_time_to_available_ip_seconds",
+		Help:    "Time in seconds from IP allocations failing because no IP is available to an IP being available, by batch size.",
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 15), //nolint:gomnd // 50 ms to ~800 seconds
+	},
+	[]string{"batch"},
+)
+
+// exhaustedSince is when IP allocations started failing because no IP is available, in Unix nanoseconds,
+// or zero if an IP has been available since.
+var exhaustedSince atomic.Int64
+
+// MarkPoolExhausted records that an IP allocation failed because no IP is available.
+// If the IP pool is already marked as exhausted, this method noops.
+func MarkPoolExhausted() {
+	exhaustedSince.CompareAndSwap(0, time.Now().UnixNano())
+}
+
+// ObserveAvailableIPs records the time since the IP pool was marked as exhausted once it has available IPs,
+// labeled with the batch size it is scaling by. If the IP pool isn't marked as exhausted, this method noops.
+func ObserveAvailableIPs(available, batch int64) {
+	if available <= 0 {
+		return
+	}
+	if since := exhaustedSince.Swap(0); since != 0 {
+		IpamTimeToAvailableIP.WithLabelValues(strconv.FormatInt(batch, 10)).Observe(time.Since(time.Unix(0, since)).Seconds()) //nolint:gomnd // it's decimal
+	}
+}
+
+func init() {
+	metrics.Registry.MustRegister(
+		IpamTimeToAvailableIP,
+	)
+}
@@ -187,6 +187,7 @@ func (o *observer) observeMetrics(ctx context.Context) error {
 	IpamRequestedIPConfigCount.WithLabelValues(labels...).Set(float64(state.requestedIPs))
 	IpamSecondaryIPCount.WithLabelValues(labels...).Set(float64(state.secondaryIPs))
 	IpamTotalIPCount.WithLabelValues(labels...).Set(float64(state.secondaryIPs + int64(len(meta.primaryIPAddresses))))
+	ObserveAvailableIPs(state.available, meta.batch)
 	if meta.exhausted {
 		IpamSubnetExhaustionState.WithLabelValues(labels...).Set(float64(SubnetIPExhausted))
 	} else {
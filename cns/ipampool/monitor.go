@@ -497,6 +497,7 @@ func observeIPPoolState(state ipPoolState, meta metaState) {
 	metrics.IpamRequestedIPConfigCount.WithLabelValues(labels...).Set(float64(state.requestedIPs))
 	metrics.IpamSecondaryIPCount.WithLabelValues(labels...).Set(float64(state.secondaryIPs))
 	metrics.IpamTotalIPCount.WithLabelValues(labels...).Set(float64(state.secondaryIPs + int64(len(meta.primaryIPAddresses))))
+	metrics.ObserveAvailableIPs(state.available, meta.batch)
 	if meta.exhausted {
 		metrics.IpamSubnetExhaustionState.WithLabelValues(labels...).Set(float64(metrics.SubnetIPExhausted))
 	} else {
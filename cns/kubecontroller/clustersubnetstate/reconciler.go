@@ -3,6 +3,7 @@ package clustersubnetstate
 import (
 	"context"
 
+	"github.com/Azure/azure-container-networking/cns/kubeevents"
 	"github.com/Azure/azure-container-networking/crd/clustersubnetstate"
 	"github.com/Azure/azure-container-networking/crd/clustersubnetstate/api/v1alpha1"
 	"github.com/pkg/errors"
@@ -17,16 +18,26 @@ type cssClient interface {
 }
 
 type Reconciler struct {
-	cli  cssClient
-	sink chan<- v1alpha1.ClusterSubnetState
+	cli    cssClient
+	sink   chan<- v1alpha1.ClusterSubnetState
+	events *kubeevents.Recorder
+	// exhausted is whether each subnet was last seen exhausted, to emit Events only when it changes.
+	exhausted map[string]bool
 }
 
 func New(sink chan<- v1alpha1.ClusterSubnetState) *Reconciler {
 	return &Reconciler{
-		sink: sink,
+		sink:      sink,
+		exhausted: map[string]bool{},
 	}
 }
 
+// WithEventRecorder emits Kubernetes Events on the NNC when subnets become exhausted or are no longer exhausted with events.
+func (r *Reconciler) WithEventRecorder(events *kubeevents.Recorder) *Reconciler {
+	r.events = events
+	return r
+}
+
 func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
 	css, err := r.cli.Get(ctx, req.NamespacedName)
 	if err != nil {
@@ -34,10 +45,22 @@ func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 		return reconcile.Result{}, errors.Wrapf(err, "failed to get css %s", req.String())
 	}
 	cssReconcilerErrorCount.With(prometheus.Labels{cssReconcilerCRDWatcherStateLabel: "succeeded"}).Inc()
+	r.recordExhaustion(css)
 	r.sink <- *css
 	return reconcile.Result{}, nil
 }
 
+// recordExhaustion emits an Event when the exhaustion of the subnet changes, or when it is first seen exhausted.
+// It is only called by Reconcile, which the controller doesn't call concurrently.
+func (r *Reconciler) recordExhaustion(css *v1alpha1.ClusterSubnetState) {
+	// subnets which haven't been seen yet count as not exhausted.
+	if r.exhausted[css.Name] == css.Status.Exhausted {
+		return
+	}
+	r.exhausted[css.Name] = css.Status.Exhausted
+	r.events.SubnetExhaustionChanged(css.Name, css.Status.Exhausted)
+}
+
 func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.cli = clustersubnetstate.NewClient(mgr.GetClient())
 	err := ctrl.NewControllerManagedBy(mgr).
@@ -5,6 +5,7 @@ import (
 	"sync"
 
 	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/kubeevents"
 	"github.com/Azure/azure-container-networking/cns/logger"
 	"github.com/Azure/azure-container-networking/cns/restserver"
 	cnstypes "github.com/Azure/azure-container-networking/cns/types"
@@ -12,6 +13,7 @@ import (
 	"github.com/Azure/azure-container-networking/crd/nodenetworkconfig/api/v1alpha"
 	"github.com/pkg/errors"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -50,6 +52,8 @@ type Reconciler struct {
 	isSwiftV2          bool
 	initializer        nodenetworkconfigSink
 	ipv6PrefixClamp    int
+	events             *kubeevents.Recorder
+	statusWriter       *StatusWriter
 }
 
 // NewReconciler creates a NodeNetworkConfig Reconciler which will get updates from the Kubernetes
@@ -68,6 +72,18 @@ func NewReconciler(cnscli cnsClient, initializer nodenetworkconfigSink, ipampool
 	}
 }
 
+// WithEventRecorder emits Kubernetes Events on the NNC about NCs which fail to be created or updated with events.
+func (r *Reconciler) WithEventRecorder(events *kubeevents.Recorder) *Reconciler {
+	r.events = events
+	return r
+}
+
+// WithStatusWriter records the results of creating or updating NCs in statusWriter, which writes them to the NNC.
+func (r *Reconciler) WithStatusWriter(statusWriter *StatusWriter) *Reconciler {
+	r.statusWriter = statusWriter
+	return r
+}
+
 // Reconcile is called on CRD status changes
 func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
 	listenersToNotify := []nodenetworkconfigSink{}
@@ -82,6 +98,7 @@ func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 		return reconcile.Result{}, errors.Wrapf(err, "failed to get NodeNetworkConfig %v", req.NamespacedName)
 	}
 	hasNNC.Set(1)
+	r.events.SetNodeNetworkConfig(nnc)
 	logger.Printf("[cns-rc] CRD Spec: %+v", nnc.Spec)
 
 	ipAssignments := 0
@@ -96,6 +113,8 @@ func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 		validNCIDs[i] = nnc.Status.NetworkContainers[i].ID
 	}
 	r.cnscli.MustEnsureNoStaleNCs(validNCIDs)
+	// the NCs of the NNC may have been added or removed, so their states are written again.
+	r.statusWriter.Notify()
 
 	// call initFunc on first reconcile and never again
 	if r.initializer != nil {
@@ -134,6 +153,8 @@ func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 		if err != nil {
 			logger.Errorf("[cns-rc] failed to generate CreateNCRequest from NC: %v, assignmentMode %s", err,
 				nnc.Status.NetworkContainers[i].AssignmentMode)
+			r.events.NCCreateOrUpdateFailed(nnc.Status.NetworkContainers[i].ID, err)
+			r.statusWriter.SetNCResult(nnc.Status.NetworkContainers[i].ID, err)
 			return reconcile.Result{}, errors.Wrapf(err, "failed to generate CreateNCRequest from NC "+
 				"assignmentMode %s", nnc.Status.NetworkContainers[i].AssignmentMode)
 		}
@@ -141,8 +162,11 @@ func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 		responseCode := r.cnscli.CreateOrUpdateNetworkContainerInternal(req)
 		if err := restserver.ResponseCodeToError(responseCode); err != nil {
 			logger.Errorf("[cns-rc] Error creating or updating NC in reconcile: %v", err)
+			r.events.NCCreateOrUpdateFailed(req.NetworkContainerid, err)
+			r.statusWriter.SetNCResult(req.NetworkContainerid, err)
 			return reconcile.Result{}, errors.Wrap(err, "failed to create or update network container")
 		}
+		r.statusWriter.SetNCResult(req.NetworkContainerid, nil)
 		ipAssignments += len(req.SecondaryIPConfigs)
 	}
 
@@ -185,21 +209,7 @@ func (r *Reconciler) SetupWithManager(mgr ctrl.Manager, node *v1.Node, filterGen
 	r.nnccli = nodenetworkconfig.NewClient(mgr.GetClient())
 	err := ctrl.NewControllerManagedBy(mgr).
 		For(&v1alpha.NodeNetworkConfig{}).
-		WithEventFilter(predicate.Funcs{
-			// ignore delete events.
-			DeleteFunc: func(event.DeleteEvent) bool {
-				return false
-			},
-			UpdateFunc: func(ue event.UpdateEvent) bool {
-				if ue.ObjectOld == nil || ue.ObjectNew == nil {
-					return false
-				}
-				if filterGenerationChange {
-					return ue.ObjectOld.GetGeneration() == ue.ObjectNew.GetGeneration()
-				}
-				return true
-			},
-		}).
+		WithEventFilter(eventFilter(filterGenerationChange)).
 		WithEventFilter(predicate.NewPredicateFuncs(func(object client.Object) bool {
 			// match on node controller ref for all other events.
 			return metav1.IsControlledBy(object, node)
@@ -214,3 +224,48 @@ func (r *Reconciler) SetupWithManager(mgr ctrl.Manager, node *v1.Node, filterGen
 	}
 	return nil
 }
+
+// eventFilter ignores delete events, and updates which only change the NC statuses written by the StatusWriter,
+// so that the status writes don't trigger reconciles.
+func eventFilter(filterGenerationChange bool) predicate.Funcs {
+	return predicate.Funcs{
+		// ignore delete events.
+		DeleteFunc: func(event.DeleteEvent) bool {
+			return false
+		},
+		UpdateFunc: func(ue event.UpdateEvent) bool {
+			if ue.ObjectOld == nil || ue.ObjectNew == nil {
+				return false
+			}
+			if onlyNCStatusesChanged(ue.ObjectOld, ue.ObjectNew) {
+				return false
+			}
+			if filterGenerationChange {
+				return ue.ObjectOld.GetGeneration() == ue.ObjectNew.GetGeneration()
+			}
+			return true
+		},
+	}
+}
+
+// onlyNCStatusesChanged returns whether the NNCs only differ in their NC statuses and server-set metadata.
+func onlyNCStatusesChanged(oldObj, newObj client.Object) bool {
+	oldNNC, ok := oldObj.(*v1alpha.NodeNetworkConfig)
+	if !ok {
+		return false
+	}
+	newNNC, ok := newObj.(*v1alpha.NodeNetworkConfig)
+	if !ok {
+		return false
+	}
+	if equality.Semantic.DeepEqual(oldNNC.Status.NetworkContainerStatuses, newNNC.Status.NetworkContainerStatuses) {
+		return false
+	}
+	oldNNC, newNNC = oldNNC.DeepCopy(), newNNC.DeepCopy()
+	for _, nnc := range []*v1alpha.NodeNetworkConfig{oldNNC, newNNC} {
+		nnc.Status.NetworkContainerStatuses = nil
+		nnc.ResourceVersion = ""
+		nnc.ManagedFields = nil
+	}
+	return equality.Semantic.DeepEqual(oldNNC, newNNC)
+}
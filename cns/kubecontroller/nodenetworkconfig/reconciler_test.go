@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/kubeevents"
 	"github.com/Azure/azure-container-networking/cns/logger"
 	cnstypes "github.com/Azure/azure-container-networking/cns/types"
 	"github.com/Azure/azure-container-networking/crd/nodenetworkconfig/api/v1alpha"
@@ -12,8 +13,11 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
@@ -339,3 +343,47 @@ func TestReconcileInitializerRetriesAfterFailure(t *testing.T) {
 	assert.Equal(t, 1, createCalls)
 	assert.Nil(t, r.initializer)
 }
+
+func TestReconcileEmitsEventOnNCCreateOrUpdateFailure(t *testing.T) {
+	logger.InitLogger("", 0, 0, "")
+
+	cnsClient := mockCNSClient{
+		state:            cnsClientState{reqsByNCID: make(map[string]*cns.CreateNetworkContainerRequest)},
+		createOrUpdateNC: func(*cns.CreateNetworkContainerRequest) cnstypes.ResponseCode { return cnstypes.UnexpectedError },
+		update:           func(*v1alpha.NodeNetworkConfig) error { return nil },
+	}
+	ncGetter := mockNCGetter{get: func(context.Context, types.NamespacedName) (*v1alpha.NodeNetworkConfig, error) {
+		return &v1alpha.NodeNetworkConfig{Status: validSwiftStatus}, nil
+	}}
+
+	events := record.NewFakeRecorder(1)
+	r := NewReconciler(&cnsClient, nil, &cnsClient, "", false, 0).WithEventRecorder(kubeevents.NewRecorder(events, nil, "node"))
+	r.nnccli = &ncGetter
+
+	_, err := r.Reconcile(context.Background(), reconcile.Request{})
+	require.Error(t, err)
+	require.Len(t, events.Events, 1)
+	assert.Contains(t, <-events.Events, "Warning "+kubeevents.ReasonFailedNCCreateOrUpdate+" Failed to create or update NC "+validSwiftRequest.NetworkContainerid)
+}
+
+func TestEventFilterIgnoresNCStatusUpdates(t *testing.T) {
+	oldNNC := &v1alpha.NodeNetworkConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "nnc", Generation: 1, ResourceVersion: "1"},
+		Status: v1alpha.NodeNetworkConfigStatus{
+			NetworkContainers: []v1alpha.NetworkContainer{{ID: "nc1", Version: 1}},
+		},
+	}
+	statusUpdate := oldNNC.DeepCopy()
+	statusUpdate.ResourceVersion = "2"
+	statusUpdate.Status.NetworkContainerStatuses = []v1alpha.NetworkContainerStatus{{ID: "nc1", IPsInUse: 3}}
+	ncUpdate := statusUpdate.DeepCopy()
+	ncUpdate.ResourceVersion = "3"
+	ncUpdate.Status.NetworkContainers[0].Version = 2
+
+	for _, filterGenerationChange := range []bool{true, false} {
+		filter := eventFilter(filterGenerationChange)
+		assert.False(t, filter.Update(event.UpdateEvent{ObjectOld: oldNNC, ObjectNew: statusUpdate}), "NC status writes don't reconcile")
+		assert.True(t, filter.Update(event.UpdateEvent{ObjectOld: statusUpdate, ObjectNew: ncUpdate}), "NC updates reconcile")
+		assert.True(t, filter.Update(event.UpdateEvent{ObjectOld: oldNNC, ObjectNew: oldNNC}), "resyncs reconcile")
+	}
+}
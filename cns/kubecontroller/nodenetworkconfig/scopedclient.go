@@ -34,3 +34,9 @@ func (sc *ScopedClient) PatchSpec(ctx context.Context, spec *v1alpha.NodeNetwork
 	nnc, err := sc.Client.PatchSpec(ctx, sc.NamespacedName, spec, fieldManager)
 	return nnc, errors.Wrapf(err, "failed to patch nnc %v", sc.NamespacedName)
 }
+
+// PatchNetworkContainerStatuses replaces the NetworkContainerStatuses in the status of the associated NodeNetworkConfig.
+func (sc *ScopedClient) PatchNetworkContainerStatuses(ctx context.Context, statuses []v1alpha.NetworkContainerStatus) (*v1alpha.NodeNetworkConfig, error) {
+	nnc, err := sc.Client.PatchNetworkContainerStatuses(ctx, sc.NamespacedName, statuses)
+	return nnc, errors.Wrapf(err, "failed to patch nnc status %v", sc.NamespacedName)
+}
@@ -0,0 +1,217 @@
+package nodenetworkconfig
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/restserver"
+	"github.com/Azure/azure-container-networking/crd/nodenetworkconfig/api/v1alpha"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultStatusWriteDebounce is how long changes to the states of the NCs are collected by default before they
+// are written to the NNC.
+const DefaultStatusWriteDebounce = time.Second
+
+// statusWriteRetryInterval is how long to wait before writing the states of the NCs again after failing to.
+const statusWriteRetryInterval = 30 * time.Second
+
+// Reasons of the conditions of NetworkContainerStatuses.
+const (
+	reasonProgrammed           = "Programmed"
+	reasonNotProgrammed        = "NotProgrammed"
+	reasonNotCreated           = "NotCreated"
+	reasonCreateOrUpdateFailed = "CreateOrUpdateFailed"
+	reasonVersionSynced        = "VersionSynced"
+	reasonVersionMismatch      = "VersionMismatch"
+)
+
+type ncHostStateGetter interface {
+	GetNCHostStates() map[string]restserver.NCHostState
+}
+
+type nncStatusClient interface {
+	Get(context.Context) (*v1alpha.NodeNetworkConfig, error)
+	PatchNetworkContainerStatuses(context.Context, []v1alpha.NetworkContainerStatus) (*v1alpha.NodeNetworkConfig, error)
+}
+
+// StatusWriter writes whether each NC of the NNC is programmed, the version it is programmed to on the host,
+// how many of its IPs are in use, and the last error creating or updating it back to the status of the NNC.
+type StatusWriter struct {
+	cnscli   ncHostStateGetter
+	nnccli   nncStatusClient
+	nodeIP   string
+	debounce time.Duration
+	// changed is signaled when the states of the NCs may have changed.
+	changed chan struct{}
+
+	sync.Mutex
+	// lastErrors are the last errors creating or updating NCs, by NC ID.
+	lastErrors map[string]string
+}
+
+// NewStatusWriter creates a StatusWriter which writes the states of the NCs in CNS to the NNC when they change,
+// collecting the changes for debounce before writing them.
+// If nodeIP is set, only the NCs created for this Node IP are written, as the Reconciler only creates those.
+func NewStatusWriter(cnscli ncHostStateGetter, nnccli nncStatusClient, nodeIP string, debounce time.Duration) *StatusWriter {
+	return &StatusWriter{
+		cnscli:     cnscli,
+		nnccli:     nnccli,
+		nodeIP:     nodeIP,
+		debounce:   debounce,
+		changed:    make(chan struct{}, 1),
+		lastErrors: map[string]string{},
+	}
+}
+
+// SetNCResult records the result of creating or updating the NC in CNS.
+func (w *StatusWriter) SetNCResult(ncID string, err error) {
+	if w == nil {
+		return
+	}
+	w.Lock()
+	defer w.Unlock()
+	lastError, failed := w.lastErrors[ncID]
+	if err == nil {
+		if failed {
+			delete(w.lastErrors, ncID)
+			w.Notify()
+		}
+		return
+	}
+	if !failed || lastError != err.Error() {
+		w.lastErrors[ncID] = err.Error()
+		w.Notify()
+	}
+}
+
+// Notify tells the StatusWriter that the NCs of the NNC may have changed, so that their states are written.
+func (w *StatusWriter) Notify() {
+	if w == nil {
+		return
+	}
+	select {
+	case w.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Start writes the states of the NCs to the NNC when started and when they change until the Context is closed.
+// The states on the host are checked for changes every debounce, and changes are written at most once every debounce.
+func (w *StatusWriter) Start(ctx context.Context) error {
+	ticker := time.NewTicker(w.debounce)
+	defer ticker.Stop()
+	var hostStates map[string]restserver.NCHostState
+	var write <-chan time.Time
+	// the states of the NCs are written once on start, as they may have changed while CNS was stopped.
+	w.Notify()
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "nnc status writer stopped")
+		case <-ticker.C:
+			if current := w.cnscli.GetNCHostStates(); !maps.Equal(current, hostStates) {
+				hostStates = current
+				w.Notify()
+			}
+		case <-w.changed:
+			if write == nil {
+				write = time.After(w.debounce)
+			}
+		case <-write:
+			write = nil
+			if err := w.Write(ctx); err != nil {
+				logger.Errorf("[cns-rc] failed to write NC statuses to NNC: %v", err)
+				write = time.After(statusWriteRetryInterval)
+			}
+		}
+	}
+}
+
+// Write patches the states of the NCs into the NNC, if they changed since they were last written.
+func (w *StatusWriter) Write(ctx context.Context) error {
+	nnc, err := w.nnccli.Get(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get nnc")
+	}
+	statuses := w.statuses(nnc)
+	if equality.Semantic.DeepEqual(statuses, nnc.Status.NetworkContainerStatuses) {
+		return nil
+	}
+	if _, err := w.nnccli.PatchNetworkContainerStatuses(ctx, statuses); err != nil {
+		return errors.Wrap(err, "failed to patch nnc status")
+	}
+	return nil
+}
+
+// statuses returns the states of the NCs of the NNC. The conditions of the NCs are updated from their
+// current values, so that their transition times only change when they do.
+// The last errors of NCs which were removed from the NNC are forgotten.
+func (w *StatusWriter) statuses(nnc *v1alpha.NodeNetworkConfig) []v1alpha.NetworkContainerStatus {
+	hostStates := w.cnscli.GetNCHostStates()
+	current := make(map[string]*v1alpha.NetworkContainerStatus, len(nnc.Status.NetworkContainerStatuses))
+	for i := range nnc.Status.NetworkContainerStatuses {
+		current[nnc.Status.NetworkContainerStatuses[i].ID] = &nnc.Status.NetworkContainerStatuses[i]
+	}
+	ncIDs := make(map[string]struct{}, len(nnc.Status.NetworkContainers))
+	for i := range nnc.Status.NetworkContainers {
+		ncIDs[nnc.Status.NetworkContainers[i].ID] = struct{}{}
+	}
+
+	w.Lock()
+	defer w.Unlock()
+	for ncID := range w.lastErrors {
+		if _, ok := ncIDs[ncID]; !ok {
+			delete(w.lastErrors, ncID)
+		}
+	}
+	statuses := []v1alpha.NetworkContainerStatus{}
+	for i := range nnc.Status.NetworkContainers {
+		nc := &nnc.Status.NetworkContainers[i]
+		if w.nodeIP != "" && w.nodeIP != nc.NodeIP {
+			continue
+		}
+		status := v1alpha.NetworkContainerStatus{ID: nc.ID, HostVersion: -1, LastError: w.lastErrors[nc.ID]}
+		if c, ok := current[nc.ID]; ok {
+			status.Conditions = c.DeepCopy().Conditions
+		}
+		hostState, created := hostStates[nc.ID]
+		if created {
+			status.HostVersion = hostState.HostVersion
+			status.IPsInUse = hostState.IPsInUse
+		}
+		programmed := metav1.Condition{Type: v1alpha.NCConditionProgrammed, ObservedGeneration: nnc.Generation}
+		versionSynced := metav1.Condition{Type: v1alpha.NCConditionVersionSynced, ObservedGeneration: nnc.Generation}
+		switch {
+		case !created && status.LastError != "":
+			programmed.Status, programmed.Reason, programmed.Message = metav1.ConditionFalse, reasonCreateOrUpdateFailed, status.LastError
+		case !created:
+			programmed.Status, programmed.Reason, programmed.Message = metav1.ConditionFalse, reasonNotCreated, "NC isn't created in CNS"
+		case hostState.HostVersion < 0:
+			programmed.Status, programmed.Reason, programmed.Message = metav1.ConditionFalse, reasonNotProgrammed, "NC isn't programmed on the host"
+		default:
+			programmed.Status, programmed.Reason = metav1.ConditionTrue, reasonProgrammed
+		}
+		switch {
+		case !created:
+			versionSynced.Status, versionSynced.Reason, versionSynced.Message = metav1.ConditionUnknown, reasonNotCreated, "NC isn't created in CNS"
+		case hostState.HostVersion < hostState.Version:
+			versionSynced.Status, versionSynced.Reason = metav1.ConditionFalse, reasonVersionMismatch
+			versionSynced.Message = fmt.Sprintf("NC is programmed to version %d on the host, waiting for version %d", hostState.HostVersion, hostState.Version)
+		default:
+			versionSynced.Status, versionSynced.Reason = metav1.ConditionTrue, reasonVersionSynced
+			versionSynced.Message = fmt.Sprintf("NC is programmed to version %d on the host", hostState.HostVersion)
+		}
+		meta.SetStatusCondition(&status.Conditions, programmed)
+		meta.SetStatusCondition(&status.Conditions, versionSynced)
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
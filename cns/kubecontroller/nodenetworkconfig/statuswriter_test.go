@@ -0,0 +1,175 @@
+package nodenetworkconfig
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns/restserver"
+	"github.com/Azure/azure-container-networking/crd/nodenetworkconfig/api/v1alpha"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type mockNCHostStateGetter map[string]restserver.NCHostState
+
+func (m mockNCHostStateGetter) GetNCHostStates() map[string]restserver.NCHostState {
+	return m
+}
+
+type mockNNCStatusClient struct {
+	sync.Mutex
+	nnc     *v1alpha.NodeNetworkConfig
+	patches int
+}
+
+func (m *mockNNCStatusClient) Get(context.Context) (*v1alpha.NodeNetworkConfig, error) {
+	m.Lock()
+	defer m.Unlock()
+	return m.nnc.DeepCopy(), nil
+}
+
+func (m *mockNNCStatusClient) PatchNetworkContainerStatuses(_ context.Context, statuses []v1alpha.NetworkContainerStatus) (*v1alpha.NodeNetworkConfig, error) {
+	m.Lock()
+	defer m.Unlock()
+	m.patches++
+	m.nnc.Status.NetworkContainerStatuses = statuses
+	return m.nnc, nil
+}
+
+func findNCStatus(t *testing.T, statuses []v1alpha.NetworkContainerStatus, ncID string) *v1alpha.NetworkContainerStatus {
+	t.Helper()
+	for i := range statuses {
+		if statuses[i].ID == ncID {
+			return &statuses[i]
+		}
+	}
+	t.Fatalf("no status for NC %s", ncID)
+	return nil
+}
+
+func TestStatusWriterWrite(t *testing.T) {
+	nodeIP := "10.0.0.10"
+	nnccli := &mockNNCStatusClient{nnc: &v1alpha.NodeNetworkConfig{
+		Status: v1alpha.NodeNetworkConfigStatus{
+			NetworkContainers: []v1alpha.NetworkContainer{
+				{ID: "synced", NodeIP: nodeIP},
+				{ID: "outdated", NodeIP: nodeIP},
+				{ID: "unprogrammed", NodeIP: nodeIP},
+				{ID: "failed", NodeIP: nodeIP},
+				{ID: "other-node", NodeIP: "10.0.0.11"},
+			},
+		},
+	}}
+	cnscli := mockNCHostStateGetter{
+		"synced":       {HostVersion: 2, Version: 2, IPsInUse: 3},
+		"outdated":     {HostVersion: 1, Version: 2, IPsInUse: 1},
+		"unprogrammed": {HostVersion: -1, Version: 1},
+	}
+	w := NewStatusWriter(cnscli, nnccli, nodeIP, DefaultStatusWriteDebounce)
+	w.SetNCResult("failed", errors.New("subnet full"))
+
+	require.NoError(t, w.Write(context.Background()))
+	assert.Equal(t, 1, nnccli.patches)
+	statuses := nnccli.nnc.Status.NetworkContainerStatuses
+	require.Len(t, statuses, 4)
+
+	synced := findNCStatus(t, statuses, "synced")
+	assert.Equal(t, int64(2), synced.HostVersion)
+	assert.Equal(t, int64(3), synced.IPsInUse)
+	assert.True(t, meta.IsStatusConditionTrue(synced.Conditions, v1alpha.NCConditionProgrammed))
+	assert.True(t, meta.IsStatusConditionTrue(synced.Conditions, v1alpha.NCConditionVersionSynced))
+
+	outdated := findNCStatus(t, statuses, "outdated")
+	assert.True(t, meta.IsStatusConditionTrue(outdated.Conditions, v1alpha.NCConditionProgrammed))
+	assert.Equal(t, reasonVersionMismatch, meta.FindStatusCondition(outdated.Conditions, v1alpha.NCConditionVersionSynced).Reason)
+
+	unprogrammed := findNCStatus(t, statuses, "unprogrammed")
+	assert.Equal(t, int64(-1), unprogrammed.HostVersion)
+	assert.Equal(t, reasonNotProgrammed, meta.FindStatusCondition(unprogrammed.Conditions, v1alpha.NCConditionProgrammed).Reason)
+
+	failed := findNCStatus(t, statuses, "failed")
+	assert.Equal(t, "subnet full", failed.LastError)
+	programmed := meta.FindStatusCondition(failed.Conditions, v1alpha.NCConditionProgrammed)
+	assert.Equal(t, metav1.ConditionFalse, programmed.Status)
+	assert.Equal(t, reasonCreateOrUpdateFailed, programmed.Reason)
+	assert.Equal(t, metav1.ConditionUnknown, meta.FindStatusCondition(failed.Conditions, v1alpha.NCConditionVersionSynced).Status)
+
+	// nothing is patched if the states of the NCs didn't change.
+	require.NoError(t, w.Write(context.Background()))
+	assert.Equal(t, 1, nnccli.patches)
+
+	// the transition times of the conditions only change when they do.
+	transitioned := meta.FindStatusCondition(synced.Conditions, v1alpha.NCConditionProgrammed).LastTransitionTime
+	cnscli["outdated"] = restserver.NCHostState{HostVersion: 2, Version: 2, IPsInUse: 1}
+	w.SetNCResult("failed", nil)
+	require.NoError(t, w.Write(context.Background()))
+	assert.Equal(t, 2, nnccli.patches)
+	statuses = nnccli.nnc.Status.NetworkContainerStatuses
+	assert.True(t, meta.IsStatusConditionTrue(findNCStatus(t, statuses, "outdated").Conditions, v1alpha.NCConditionVersionSynced))
+	assert.Empty(t, findNCStatus(t, statuses, "failed").LastError)
+	assert.Equal(t, transitioned, meta.FindStatusCondition(findNCStatus(t, statuses, "synced").Conditions, v1alpha.NCConditionProgrammed).LastTransitionTime)
+}
+
+func TestStatusWriterForgetsRemovedNCs(t *testing.T) {
+	nnccli := &mockNNCStatusClient{nnc: &v1alpha.NodeNetworkConfig{
+		Status: v1alpha.NodeNetworkConfigStatus{
+			NetworkContainers: []v1alpha.NetworkContainer{{ID: "kept"}, {ID: "removed"}},
+		},
+	}}
+	w := NewStatusWriter(mockNCHostStateGetter{}, nnccli, "", DefaultStatusWriteDebounce)
+	w.SetNCResult("kept", errors.New("subnet full"))
+	w.SetNCResult("removed", errors.New("subnet full"))
+	require.NoError(t, w.Write(context.Background()))
+	assert.Len(t, w.lastErrors, 2)
+
+	nnccli.nnc.Status.NetworkContainers = nnccli.nnc.Status.NetworkContainers[:1]
+	require.NoError(t, w.Write(context.Background()))
+	assert.Equal(t, map[string]string{"kept": "subnet full"}, w.lastErrors)
+}
+
+func TestStatusWriterStart(t *testing.T) {
+	nnccli := &mockNNCStatusClient{nnc: &v1alpha.NodeNetworkConfig{
+		Status: v1alpha.NodeNetworkConfigStatus{
+			NetworkContainers: []v1alpha.NetworkContainer{{ID: "nc"}},
+		},
+	}}
+	w := NewStatusWriter(mockNCHostStateGetter{}, nnccli, "", 10*time.Millisecond)
+	patches := func() int {
+		nnccli.Lock()
+		defer nnccli.Unlock()
+		return nnccli.patches
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Start(ctx) }()
+	// the states of the NCs are written on start.
+	require.Eventually(t, func() bool { return patches() == 1 }, time.Second, time.Millisecond)
+
+	// changes are collected and written together.
+	w.SetNCResult("nc", errors.New("subnet full"))
+	w.SetNCResult("nc", errors.New("subnet still full"))
+	require.Eventually(t, func() bool { return patches() == 2 }, time.Second, time.Millisecond)
+	nnccli.Lock()
+	assert.Equal(t, "subnet still full", nnccli.nnc.Status.NetworkContainerStatuses[0].LastError)
+	nnccli.Unlock()
+
+	// nothing is written if nothing changed.
+	w.Notify()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 2, patches())
+
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestStatusWriterNil(t *testing.T) {
+	var w *StatusWriter
+	w.SetNCResult("nc", errors.New("failed"))
+	w.Notify()
+}
@@ -0,0 +1,179 @@
+// Package kubeevents emits Kubernetes Events about the IPAM of Pods and the Network Containers of the Node,
+// so that why a Pod is stuck in ContainerCreating can be seen with kubectl describe instead of only in the CNS logs.
+package kubeevents
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-container-networking/crd/nodenetworkconfig/api/v1alpha"
+	corev1 "k8s.io/api/core/v1"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/lru"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Reasons of the Events emitted by CNS.
+const (
+	ReasonFailedIPAssignment     = "FailedIPAssignment"
+	ReasonIPPendingProgramming   = "IPPendingProgramming"
+	ReasonFailedNCCreateOrUpdate = "FailedNCCreateOrUpdate"
+	ReasonSubnetExhausted        = "SubnetExhausted"
+	ReasonSubnetNotExhausted     = "SubnetNotExhausted"
+	ReasonNCVersionMismatch      = "NCVersionMismatch"
+)
+
+// Component is the source of the Events emitted by CNS.
+const Component = "azure-cns"
+
+const (
+	// maxMessageLength bounds the messages of Events, as errors may embed whole requests.
+	maxMessageLength = 1024
+	// Events about the same object are rate limited to a burst of burstSize, refilled at qps.
+	burstSize = 10
+	qps       = 1.0 / 60
+	// podEventInterval is how long an Event with the same reason isn't emitted again on a Pod,
+	// since CNI retries failed requests for IPs every few seconds.
+	podEventInterval = time.Minute
+	// maxPodEvents bounds the Pod Events remembered to deduplicate them. Once it's reached, the least recently emitted
+	// Events are forgotten, so new Events are always emitted.
+	maxPodEvents = 1000
+	// podLookupTimeout bounds looking up the UID of a Pod, which Events on the Pod reference.
+	podLookupTimeout = 5 * time.Second
+)
+
+// Recorder emits Events on Pods and on the NodeNetworkConfig of the Node.
+// A nil Recorder emits nothing, so that emitting Events is optional.
+type Recorder struct {
+	recorder record.EventRecorder
+	pods     client.Reader
+	nnc      atomic.Pointer[corev1.ObjectReference]
+
+	sync.Mutex
+	// podEvents are when Events were last emitted on Pods, by Pod and reason.
+	podEvents *lru.Cache
+}
+
+// NewBroadcaster returns an EventBroadcaster which sends Events to the apiserver through events.
+// Identical Events are deduplicated into a count on a single Event, similar Events are aggregated,
+// and Events about the same object are rate limited.
+func NewBroadcaster(events typedcorev1.EventInterface) record.EventBroadcaster {
+	broadcaster := record.NewBroadcasterWithCorrelatorOptions(record.CorrelatorOptions{
+		BurstSize: burstSize,
+		QPS:       qps,
+	})
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: events})
+	return broadcaster
+}
+
+// NewRecorder returns a Recorder which emits Events with recorder on behalf of CNS on nodeName.
+// pods looks up the Pods which Events are emitted on.
+func NewRecorder(recorder record.EventRecorder, pods client.Reader, nodeName string) *Recorder {
+	r := &Recorder{
+		recorder:  recorder,
+		pods:      pods,
+		podEvents: lru.New(maxPodEvents),
+	}
+	r.nnc.Store(&corev1.ObjectReference{
+		APIVersion: v1alpha.GroupVersion.String(),
+		Kind:       "NodeNetworkConfig",
+		Namespace:  "kube-system",
+		Name:       nodeName,
+	})
+	return r
+}
+
+// SetNodeNetworkConfig sets the NodeNetworkConfig of the Node which Events are emitted on.
+func (r *Recorder) SetNodeNetworkConfig(nnc *v1alpha.NodeNetworkConfig) {
+	if r == nil {
+		return
+	}
+	r.nnc.Store(&corev1.ObjectReference{
+		APIVersion: v1alpha.GroupVersion.String(),
+		Kind:       "NodeNetworkConfig",
+		Namespace:  nnc.Namespace,
+		Name:       nnc.Name,
+		UID:        nnc.UID,
+	})
+}
+
+// IPAssignmentFailed emits a Warning on the Pod that CNS failed to assign it IPs.
+func (r *Recorder) IPAssignmentFailed(podNamespace, podName string, err error) {
+	r.podEvent(podNamespace, podName, corev1.EventTypeWarning, ReasonFailedIPAssignment, "Failed to assign IPs: %v", err)
+}
+
+// IPPendingProgramming emits an Event on the Pod that it is waiting on IPs which are pending programming on the host.
+func (r *Recorder) IPPendingProgramming(podNamespace, podName string, err error) {
+	r.podEvent(podNamespace, podName, corev1.EventTypeNormal, ReasonIPPendingProgramming, "Waiting for IPs to be programmed on the host: %v", err)
+}
+
+// NCCreateOrUpdateFailed emits a Warning on the NodeNetworkConfig that CNS failed to create or update the NC.
+func (r *Recorder) NCCreateOrUpdateFailed(ncID string, err error) {
+	r.nncEvent(corev1.EventTypeWarning, ReasonFailedNCCreateOrUpdate, "Failed to create or update NC %s: %v", ncID, err)
+}
+
+// SubnetExhaustionChanged emits an Event on the NodeNetworkConfig when the exhaustion of the subnet changes.
+// While the subnet is exhausted, the IP pool of the Node scales one IP at a time.
+func (r *Recorder) SubnetExhaustionChanged(subnet string, exhausted bool) {
+	if exhausted {
+		r.nncEvent(corev1.EventTypeWarning, ReasonSubnetExhausted, "Subnet %s is exhausted, the IP pool scales one IP at a time", subnet)
+		return
+	}
+	r.nncEvent(corev1.EventTypeNormal, ReasonSubnetNotExhausted, "Subnet %s is no longer exhausted", subnet)
+}
+
+// NCVersionMismatch emits a Warning on the NodeNetworkConfig that the NC isn't programmed to its version on the host.
+func (r *Recorder) NCVersionMismatch(ncID, hostVersion, version string) {
+	r.nncEvent(corev1.EventTypeWarning, ReasonNCVersionMismatch,
+		"NC %s is programmed to version %s on the host, waiting for version %s", ncID, hostVersion, version)
+}
+
+func (r *Recorder) nncEvent(eventType, reason, messageFmt string, args ...any) {
+	if r == nil {
+		return
+	}
+	r.recorder.Event(r.nnc.Load(), eventType, reason, message(messageFmt, args...))
+}
+
+// podEvent emits an Event on the Pod, unless an Event with the same reason was emitted on it in the last podEventInterval.
+// The Pod is looked up asynchronously, so that requests for IPs aren't slowed down by emitting Events.
+func (r *Recorder) podEvent(podNamespace, podName, eventType, reason, messageFmt string, args ...any) {
+	if r == nil || podName == "" || !r.shouldEmitPodEvent(podNamespace+"/"+podName+"/"+reason) {
+		return
+	}
+	msg := message(messageFmt, args...)
+	go func() {
+		ref := &corev1.ObjectReference{APIVersion: "v1", Kind: "Pod", Namespace: podNamespace, Name: podName}
+		ctx, cancel := context.WithTimeout(context.Background(), podLookupTimeout)
+		defer cancel()
+		// Events are listed by the UID of the Pod they are on, so reference the Pod by UID if it can be found.
+		var pod corev1.Pod
+		if err := r.pods.Get(ctx, client.ObjectKey{Namespace: podNamespace, Name: podName}, &pod); err == nil {
+			ref.UID = pod.UID
+		}
+		r.recorder.Event(ref, eventType, reason, msg)
+	}()
+}
+
+func (r *Recorder) shouldEmitPodEvent(key string) bool {
+	r.Lock()
+	defer r.Unlock()
+	now := time.Now()
+	if last, ok := r.podEvents.Get(key); ok && now.Sub(last.(time.Time)) < podEventInterval {
+		return false
+	}
+	r.podEvents.Add(key, now)
+	return true
+}
+
+func message(messageFmt string, args ...any) string {
+	msg := fmt.Sprintf(messageFmt, args...)
+	if len(msg) > maxMessageLength {
+		msg = msg[:maxMessageLength-3] + "..."
+	}
+	return msg
+}
@@ -0,0 +1,123 @@
+package kubeevents
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/crd/nodenetworkconfig/api/v1alpha"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// objectRecorder records the objects Events are emitted on alongside the Events.
+type objectRecorder struct {
+	*record.FakeRecorder
+	objects chan runtime.Object
+}
+
+func (r *objectRecorder) Event(object runtime.Object, eventType, reason, message string) {
+	r.objects <- object
+	r.FakeRecorder.Event(object, eventType, reason, message)
+}
+
+func newTestRecorder(t *testing.T, pods ...runtime.Object) (*Recorder, *objectRecorder) {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+	events := &objectRecorder{FakeRecorder: record.NewFakeRecorder(10), objects: make(chan runtime.Object, 10)}
+	return NewRecorder(events, fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(pods...).Build(), "node"), events
+}
+
+func receive(t *testing.T, events *objectRecorder) (*corev1.ObjectReference, string) {
+	t.Helper()
+	select {
+	case object := <-events.objects:
+		return object.(*corev1.ObjectReference), <-events.Events
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event emitted")
+		return nil, ""
+	}
+}
+
+func TestNilRecorder(t *testing.T) {
+	var r *Recorder
+	r.SetNodeNetworkConfig(&v1alpha.NodeNetworkConfig{})
+	r.IPAssignmentFailed("ns", "pod", errors.New("failed"))
+	r.IPPendingProgramming("ns", "pod", errors.New("pending"))
+	r.NCCreateOrUpdateFailed("nc", errors.New("failed"))
+	r.SubnetExhaustionChanged("subnet", true)
+	r.NCVersionMismatch("nc", "0", "1")
+}
+
+func TestPodEvents(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pod", UID: types.UID("uid")}}
+	r, events := newTestRecorder(t, pod)
+
+	r.IPAssignmentFailed("ns", "pod", errors.New("no IPs available"))
+	ref, event := receive(t, events)
+	assert.Equal(t, "Pod", ref.Kind)
+	assert.Equal(t, types.UID("uid"), ref.UID)
+	assert.Equal(t, "Warning FailedIPAssignment Failed to assign IPs: no IPs available", event)
+
+	// the same reason isn't emitted again on the Pod, other reasons are.
+	r.IPAssignmentFailed("ns", "pod", errors.New("no IPs available"))
+	r.IPPendingProgramming("ns", "pod", errors.New("nc not programmed"))
+	_, event = receive(t, events)
+	assert.Equal(t, "Normal IPPendingProgramming Waiting for IPs to be programmed on the host: nc not programmed", event)
+
+	// Pods which can't be found are referenced by name.
+	r.IPAssignmentFailed("ns", "missing", errors.New("no IPs available"))
+	ref, _ = receive(t, events)
+	assert.Equal(t, "missing", ref.Name)
+	assert.Empty(t, ref.UID)
+
+	select {
+	case event := <-events.Events:
+		t.Fatalf("unexpected event %s", event)
+	default:
+	}
+}
+
+func TestShouldEmitPodEvent(t *testing.T) {
+	r, _ := newTestRecorder(t)
+	for i := 0; i < maxPodEvents; i++ {
+		require.True(t, r.shouldEmitPodEvent("ns/pod-"+strconv.Itoa(i)+"/reason"))
+	}
+	require.False(t, r.shouldEmitPodEvent("ns/pod-1/reason"))
+
+	// Events on new Pods are emitted once maxPodEvents are remembered, forgetting the least recent ones
+	require.True(t, r.shouldEmitPodEvent("ns/new/reason"))
+	require.True(t, r.shouldEmitPodEvent("ns/pod-0/reason"))
+	require.False(t, r.shouldEmitPodEvent("ns/pod-1/reason"))
+}
+
+func TestNNCEvents(t *testing.T) {
+	r, events := newTestRecorder(t)
+
+	r.NCVersionMismatch("nc", "1", "2")
+	ref, event := receive(t, events)
+	assert.Equal(t, "NodeNetworkConfig", ref.Kind)
+	assert.Equal(t, "kube-system", ref.Namespace)
+	assert.Equal(t, "node", ref.Name)
+	assert.Equal(t, "Warning NCVersionMismatch NC nc is programmed to version 1 on the host, waiting for version 2", event)
+
+	r.SetNodeNetworkConfig(&v1alpha.NodeNetworkConfig{ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "node", UID: types.UID("uid")}})
+	r.SubnetExhaustionChanged("subnet", true)
+	ref, event = receive(t, events)
+	assert.Equal(t, types.UID("uid"), ref.UID)
+	assert.Equal(t, "Warning SubnetExhausted Subnet subnet is exhausted, the IP pool scales one IP at a time", event)
+
+	r.NCCreateOrUpdateFailed("nc", errors.New(strings.Repeat("a", 2*maxMessageLength)))
+	_, event = receive(t, events)
+	assert.Len(t, event, len("Warning FailedNCCreateOrUpdate ")+maxMessageLength)
+	assert.True(t, strings.HasSuffix(event, "..."))
+}
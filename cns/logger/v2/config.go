@@ -42,6 +42,20 @@ func (c *Config) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// SetLevel changes Level, along with the level of the logger built from the Config by New.
+func (c *Config) SetLevel(level string) error {
+	lvl, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse Config Level")
+	}
+	c.Level = level
+	c.level = lvl
+	if c.atomicLevel != nil {
+		c.atomicLevel.SetLevel(lvl)
+	}
+	return nil
+}
+
 // Normalize checks the Config for missing/default values and sets them
 // if appropriate.
 func (c *Config) Normalize() {
@@ -70,5 +84,8 @@ func (c *Config) Normalize() {
 			c.AppInsights.MaxBatchSize = defaultMaxBatchSize
 		}
 	}
+	if c.Levels == nil {
+		c.Levels = NewLevels()
+	}
 	c.normalize()
 }
@@ -6,6 +6,7 @@ import (
 
 	cores "github.com/Azure/azure-container-networking/cns/logger/v2/cores"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
 )
 
 func TestUnmarshalJSON(t *testing.T) {
@@ -53,3 +54,18 @@ func TestUnmarshalJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestSetLevel(t *testing.T) {
+	cfg := &Config{Level: "info"}
+	z, closer, err := New(cfg)
+	require.NoError(t, err)
+	defer closer()
+	require.False(t, z.Core().Enabled(zapcore.DebugLevel))
+
+	require.NoError(t, cfg.SetLevel("debug"))
+	require.Equal(t, "debug", cfg.Level)
+	require.True(t, z.Core().Enabled(zapcore.DebugLevel))
+
+	require.Error(t, cfg.SetLevel("invalid"))
+	require.Equal(t, "debug", cfg.Level)
+}
@@ -2,6 +2,7 @@ package logger
 
 import (
 	cores "github.com/Azure/azure-container-networking/cns/logger/v2/cores"
+	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
@@ -9,11 +10,15 @@ const defaultFilePath = "/k/azurecns/azure-cns.log"
 
 type Config struct {
 	// Level is the general logging Level. If cores have more specific config it will override this.
-	Level       string                   `json:"level"`
+	Level       string                   `json:"level" reloadable:"true"`
 	level       zapcore.Level            `json:"-"`
 	AppInsights *cores.AppInsightsConfig `json:"appInsights,omitempty"`
 	File        *cores.FileConfig        `json:"file,omitempty"`
-	ETW         *cores.ETWConfig         `json:"etw,omitempty"`
+	// Levels overrides the levels of the logger at runtime. It is created by Normalize if nil.
+	Levels *Levels          `json:"-"`
+	ETW    *cores.ETWConfig `json:"etw,omitempty"`
+	// atomicLevel is the level of the stdout core of the logger, set by New so that Level can be changed by SetLevel.
+	atomicLevel *zap.AtomicLevel
 }
 
 func (c *Config) normalize() {
@@ -0,0 +1,171 @@
+package logger
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// ComponentKey is the field key which names the component a logger belongs to,
+// e.g. z.With(zap.String(ComponentKey, "ipam-pool-monitor")).
+const ComponentKey = "component"
+
+// LevelOverride is a level which overrides the configured level of the logger until it is reset or expires.
+type LevelOverride struct {
+	Level zapcore.Level
+	// Expires is when the override is reverted, or the zero Time if it isn't reverted automatically.
+	Expires time.Time
+}
+
+// Levels changes the levels of a logger at runtime, either globally or for the loggers of named components.
+// An override applies across all of the cores of the logger, regardless of their configured levels.
+// A component override takes precedence over a global override, which takes precedence over the configured levels.
+//
+// Levels is safe for concurrent use.
+type Levels struct {
+	mu         sync.RWMutex
+	global     *override
+	components map[string]*override
+}
+
+type override struct {
+	LevelOverride
+	timer *time.Timer
+}
+
+// NewLevels returns Levels without any overrides.
+func NewLevels() *Levels {
+	return &Levels{components: map[string]*override{}}
+}
+
+// Set overrides the level of the component, or the global level if component is empty.
+// If revertAfter is positive, the override is reset after revertAfter.
+func (l *Levels) Set(component string, level zapcore.Level, revertAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.reset(component)
+
+	o := &override{LevelOverride: LevelOverride{Level: level}}
+	if revertAfter > 0 {
+		o.Expires = time.Now().Add(revertAfter)
+		o.timer = time.AfterFunc(revertAfter, func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			// only revert this override, not one which replaced it since.
+			if l.get(component) == o {
+				l.reset(component)
+			}
+		})
+	}
+	if component == "" {
+		l.global = o
+		return
+	}
+	l.components[component] = o
+}
+
+// Reset removes the override of the component, or the global override if component is empty.
+func (l *Levels) Reset(component string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.reset(component)
+}
+
+// Global returns the global override, if any.
+func (l *Levels) Global() (LevelOverride, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.global == nil {
+		return LevelOverride{}, false
+	}
+	return l.global.LevelOverride, true
+}
+
+// Components returns the overrides of the components.
+func (l *Levels) Components() map[string]LevelOverride {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	components := make(map[string]LevelOverride, len(l.components))
+	for component, o := range l.components {
+		components[component] = o.LevelOverride
+	}
+	return components
+}
+
+// level returns the level which overrides the configured levels of the component's logger, if any.
+func (l *Levels) level(component string) (zapcore.Level, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if o, ok := l.components[component]; ok {
+		return o.Level, true
+	}
+	if l.global != nil {
+		return l.global.Level, true
+	}
+	return zapcore.InvalidLevel, false
+}
+
+func (l *Levels) get(component string) *override {
+	if component == "" {
+		return l.global
+	}
+	return l.components[component]
+}
+
+func (l *Levels) reset(component string) {
+	o := l.get(component)
+	if o == nil {
+		return
+	}
+	if o.timer != nil {
+		o.timer.Stop()
+	}
+	if component == "" {
+		l.global = nil
+		return
+	}
+	delete(l.components, component)
+}
+
+// levelCore wraps a core so that its level can be overridden by Levels.
+// Entries enabled by an override are written to every core of the wrapped core,
+// and all other entries are checked by the wrapped core as usual.
+type levelCore struct {
+	zapcore.Core
+	levels    *Levels
+	component string
+}
+
+func newLevelCore(core zapcore.Core, levels *Levels) zapcore.Core {
+	return &levelCore{Core: core, levels: levels}
+}
+
+func (c *levelCore) Enabled(lvl zapcore.Level) bool {
+	if level, ok := c.levels.level(c.component); ok {
+		return lvl >= level
+	}
+	return c.Core.Enabled(lvl)
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	component := c.component
+	for i := range fields {
+		if fields[i].Key == ComponentKey && fields[i].Type == zapcore.StringType {
+			component = fields[i].String
+		}
+	}
+	return &levelCore{Core: c.Core.With(fields), levels: c.levels, component: component}
+}
+
+//nolint:gocritic // ignore hugeparam in interface impl
+func (c *levelCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	level, ok := c.levels.level(c.component)
+	if !ok {
+		return c.Core.Check(entry, checked)
+	}
+	if entry.Level >= level {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
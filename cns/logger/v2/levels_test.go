@@ -0,0 +1,75 @@
+package logger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLevelCore(t *testing.T) {
+	infoCore, infoLogs := observer.New(zapcore.InfoLevel)
+	warnCore, warnLogs := observer.New(zapcore.WarnLevel)
+	levels := NewLevels()
+	z := zap.New(newLevelCore(zapcore.NewTee(infoCore, warnCore), levels))
+	monitor := z.With(zap.String(ComponentKey, "ipam-pool-monitor"))
+	watcher := z.With(zap.String(ComponentKey, "pod-watcher"))
+
+	// without overrides, each core filters by its configured level
+	z.Debug("debug")
+	z.Info("info")
+	require.Equal(t, 1, infoLogs.Len())
+	require.Equal(t, 0, warnLogs.Len())
+
+	// a global override applies to every core
+	levels.Set("", zapcore.DebugLevel, 0)
+	z.Debug("debug")
+	require.Equal(t, 2, infoLogs.Len())
+	require.Equal(t, 1, warnLogs.Len())
+
+	// a component override takes precedence over the global override
+	levels.Set("ipam-pool-monitor", zapcore.ErrorLevel, 0)
+	monitor.Warn("warn")
+	watcher.Debug("debug")
+	require.Equal(t, 3, infoLogs.Len())
+	require.Equal(t, "pod-watcher", infoLogs.All()[2].ContextMap()[ComponentKey])
+
+	// resetting the global override restores the configured levels for other components
+	levels.Reset("")
+	watcher.Debug("debug")
+	monitor.Error("error")
+	require.Equal(t, 4, infoLogs.Len())
+	require.Equal(t, "ipam-pool-monitor", infoLogs.All()[3].ContextMap()[ComponentKey])
+
+	levels.Reset("ipam-pool-monitor")
+	monitor.Warn("warn")
+	require.Equal(t, 5, infoLogs.Len())
+	require.Equal(t, 4, warnLogs.Len())
+}
+
+func TestLevelsRevert(t *testing.T) {
+	levels := NewLevels()
+
+	levels.Set("pod-watcher", zapcore.DebugLevel, 10*time.Millisecond)
+	override, ok := levels.Components()["pod-watcher"]
+	require.True(t, ok)
+	require.Equal(t, zapcore.DebugLevel, override.Level)
+	require.False(t, override.Expires.IsZero())
+
+	require.Eventually(t, func() bool {
+		_, ok := levels.Components()["pod-watcher"]
+		return !ok
+	}, time.Second, 5*time.Millisecond)
+
+	// an override replacing one which reverts is not reverted
+	levels.Set("", zapcore.DebugLevel, 10*time.Millisecond)
+	levels.Set("", zapcore.WarnLevel, 0)
+	time.Sleep(50 * time.Millisecond)
+	override, ok = levels.Global()
+	require.True(t, ok)
+	require.Equal(t, zapcore.WarnLevel, override.Level)
+	require.True(t, override.Expires.IsZero())
+}
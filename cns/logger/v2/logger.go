@@ -19,7 +19,9 @@ func (c compoundCloser) Close() {
 // New creates a v2 CNS logger built with Zap.
 func New(cfg *Config) (*zap.Logger, func(), error) {
 	cfg.Normalize()
-	core := cores.StdoutCore(cfg.level)
+	atomicLevel := zap.NewAtomicLevelAt(cfg.level)
+	cfg.atomicLevel = &atomicLevel
+	core := cores.StdoutCore(atomicLevel)
 	closer := compoundCloser{}
 	if cfg.File != nil {
 		fileCore, fileCloser, err := cores.FileCore(cfg.File)
@@ -43,5 +45,5 @@ func New(cfg *Config) (*zap.Logger, func(), error) {
 		return nil, closer.Close, err
 	}
 	core = zapcore.NewTee(core, platformCore)
-	return zap.New(core), closer.Close, nil
+	return zap.New(newLevelCore(core, cfg.Levels)), closer.Close, nil
 }
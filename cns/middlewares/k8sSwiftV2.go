@@ -9,6 +9,7 @@ import (
 	"github.com/Azure/azure-container-networking/cns/middlewares/utils"
 	"github.com/Azure/azure-container-networking/cns/types"
 	"github.com/Azure/azure-container-networking/crd/multitenancy/api/v1alpha1"
+	"github.com/Azure/azure-container-networking/tracing"
 	"github.com/pkg/errors"
 	v1 "k8s.io/api/core/v1"
 	k8stypes "k8s.io/apimachinery/pkg/types"
@@ -39,6 +40,15 @@ type K8sSWIFTv2Middleware struct {
 var _ cns.IPConfigsHandlerMiddleware = (*K8sSWIFTv2Middleware)(nil)
 
 func (k *K8sSWIFTv2Middleware) GetPodInfoForIPConfigsRequest(ctx context.Context, req *cns.IPConfigsRequest) (podInfo cns.PodInfo, respCode types.ResponseCode, message string) {
+	ctx, span := tracing.Start(ctx, "K8sSWIFTv2Middleware.GetPodInfoForIPConfigsRequest")
+	defer func() {
+		var err error
+		if respCode != types.Success {
+			err = errors.New(message)
+		}
+		tracing.End(span, err)
+	}()
+
 	// gets pod info for the specified request
 	podInfo, pod, respCode, message := k.GetPodInfo(ctx, req)
 	if respCode != types.Success {
@@ -535,8 +535,8 @@ func (service *HTTPRestService) createOrUpdateNetworkContainer(w http.ResponseWr
 			}
 		} else if req.NetworkContainerType == cns.AzureContainerInstance {
 			// Clean up stale HNS resources from a previous NC that used the same delegated NIC.
-			cleanupEnabled := service.Options[common.OptEnableStaleHNSCleanupOnNCCreate] == true &&
-				service.Options[common.OptManageEndpointState] == true
+			cleanupEnabled := service.GetOption(common.OptEnableStaleHNSCleanupOnNCCreate) == true &&
+				service.GetOption(common.OptManageEndpointState) == true
 			hasDelegatedNIC := req.NetworkInterfaceInfo.MACAddress != "" &&
 				(req.NetworkInterfaceInfo.NICType == cns.DelegatedVMNIC || req.NetworkInterfaceInfo.NICType == cns.NodeNetworkInterfaceFrontendNIC)
 			if cleanupEnabled && hasDelegatedNIC {
@@ -0,0 +1,89 @@
+package restserver
+
+import (
+	"net/http"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/common"
+)
+
+const (
+	// otherLabelValue replaces label values reported by CNI which aren't expected, to bound the cardinality of the metrics.
+	otherLabelValue   = "other"
+	noErrorLabelValue = "none"
+)
+
+var (
+	cniOperations = map[string]bool{"ADD": true, "DEL": true, "UPDATE": true}
+	cniNICTypes   = map[cns.NICType]bool{
+		cns.InfraNIC:       true,
+		cns.DelegatedVMNIC: true,
+		cns.BackendNIC:     true,
+		cns.NodeNetworkInterfaceAccelnetFrontendNIC: true,
+		cns.ApipaNIC: true,
+	}
+	// cniPhases are the phases of CNI commands, which are also their error classes.
+	cniPhases = map[string]bool{
+		cns.CNIPhaseParse:          true,
+		cns.CNIPhaseNNS:            true,
+		cns.CNIPhaseIPAM:           true,
+		cns.CNIPhaseCNS:            true,
+		cns.CNIPhaseState:          true,
+		cns.CNIPhaseEndpointInfo:   true,
+		cns.CNIPhaseEndpointState:  true,
+		cns.CNIPhaseEndpointCreate: true,
+		cns.CNIPhaseEndpointDelete: true,
+		cns.CNIPhaseEndpointUpdate: true,
+	}
+)
+
+// reportCNIOperation records the outcome of a CNI command in the CNI operation metrics.
+func (service *HTTPRestService) reportCNIOperation(w http.ResponseWriter, r *http.Request) {
+	opName := "reportCNIOperation"
+	var resp cns.Response
+	if r.Method != http.MethodPost {
+		resp = cns.Response{ReturnCode: types.UnsupportedVerb, Message: "[Azure CNS] Error. reportCNIOperation did not receive a POST."}
+		err := common.Encode(w, &resp)
+		logger.Response(opName, resp, resp.ReturnCode, err)
+		return
+	}
+
+	var report cns.CNIOperationReport
+	if err := common.Decode(w, r, &report); err != nil {
+		return
+	}
+	if !cniOperations[report.Operation] {
+		resp = cns.Response{ReturnCode: types.InvalidParameter, Message: "unknown CNI operation " + report.Operation}
+		err := common.Encode(w, &resp)
+		logger.ResponseEx(opName, report, resp, resp.ReturnCode, err)
+		return
+	}
+
+	recordCNIOperation(&report)
+	err := common.Encode(w, &resp)
+	logger.Response(opName, resp, resp.ReturnCode, err)
+}
+
+func recordCNIOperation(report *cns.CNIOperationReport) {
+	nicType := otherLabelValue
+	if report.NICType == "" || cniNICTypes[report.NICType] {
+		nicType = string(report.NICType)
+	}
+	errorClass := noErrorLabelValue
+	if report.ErrorClass != "" {
+		errorClass = phaseLabelValue(report.ErrorClass)
+	}
+	cniOperationLatency.WithLabelValues(report.Operation, nicType, errorClass).Observe(report.Duration.Seconds())
+	for _, phase := range report.Phases {
+		cniOperationPhaseLatency.WithLabelValues(report.Operation, phaseLabelValue(phase.Name)).Observe(phase.Duration.Seconds())
+	}
+}
+
+func phaseLabelValue(phase string) string {
+	if cniPhases[phase] {
+		return phase
+	}
+	return otherLabelValue
+}
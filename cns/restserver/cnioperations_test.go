@@ -0,0 +1,67 @@
+package restserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/types"
+	acntime "github.com/Azure/azure-container-networking/internal/time"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportCNIOperation(t *testing.T) {
+	service := &HTTPRestService{}
+	do := func(t *testing.T, method string, report *cns.CNIOperationReport) cns.Response {
+		t.Helper()
+		var b bytes.Buffer
+		require.NoError(t, json.NewEncoder(&b).Encode(report))
+		w := httptest.NewRecorder()
+		service.reportCNIOperation(w, httptest.NewRequest(method, cns.CNIOperationsPath, &b))
+		var resp cns.Response
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		return resp
+	}
+
+	resp := do(t, http.MethodPost, &cns.CNIOperationReport{
+		Operation:  "ADD",
+		NICType:    cns.InfraNIC,
+		ErrorClass: "ipam",
+		Duration:   acntime.Duration{Duration: 100 * time.Millisecond},
+		Phases: []cns.CNIOperationPhase{
+			{Name: "parse", Duration: acntime.Duration{Duration: time.Millisecond}},
+			{Name: "ipam", Duration: acntime.Duration{Duration: 99 * time.Millisecond}},
+		},
+	})
+	require.Equal(t, types.Success, resp.ReturnCode)
+	require.Equal(t, 1, testutil.CollectAndCount(cniOperationLatency))
+	require.Equal(t, 2, testutil.CollectAndCount(cniOperationPhaseLatency))
+	require.True(t, cniOperationLatency.DeleteLabelValues("ADD", string(cns.InfraNIC), "ipam"))
+
+	// unexpected label values are replaced to bound the cardinality of the metrics
+	resp = do(t, http.MethodPost, &cns.CNIOperationReport{Operation: "DEL", NICType: "custom", ErrorClass: "no such phase!"})
+	require.Equal(t, types.Success, resp.ReturnCode)
+	require.True(t, cniOperationLatency.DeleteLabelValues("DEL", otherLabelValue, otherLabelValue))
+
+	// phases which CNI doesn't have are replaced too
+	resp = do(t, http.MethodPost, &cns.CNIOperationReport{
+		Operation:  "DEL",
+		ErrorClass: "unknownPhase",
+		Phases:     []cns.CNIOperationPhase{{Name: "unknownPhase"}, {Name: cns.CNIPhaseEndpointDelete}},
+	})
+	require.Equal(t, types.Success, resp.ReturnCode)
+	require.True(t, cniOperationLatency.DeleteLabelValues("DEL", "", otherLabelValue))
+	require.True(t, cniOperationPhaseLatency.DeleteLabelValues("DEL", otherLabelValue))
+	require.True(t, cniOperationPhaseLatency.DeleteLabelValues("DEL", cns.CNIPhaseEndpointDelete))
+
+	resp = do(t, http.MethodPost, &cns.CNIOperationReport{Operation: "CHECK"})
+	require.Equal(t, types.InvalidParameter, resp.ReturnCode)
+
+	resp = do(t, http.MethodGet, &cns.CNIOperationReport{})
+	require.Equal(t, types.UnsupportedVerb, resp.ReturnCode)
+}
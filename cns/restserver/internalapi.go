@@ -190,6 +190,43 @@ func (service *HTTPRestService) SyncHostNCVersion(ctx context.Context, channelMo
 
 var errNonExistentContainerStatus = errors.New("nonExistantContainerstatus")
 
+// NCHostState is the state of an NC on the host.
+type NCHostState struct {
+	// HostVersion is the version of the NC programmed on the host, -1 if it isn't programmed yet.
+	HostVersion int64
+	// Version is the version of the NC published by DNC.
+	Version int64
+	// IPsInUse is the number of IPs of the NC assigned to Pods.
+	IPsInUse int64
+}
+
+// GetNCHostStates returns the states on the host of the NCs in CNS, by NC ID.
+func (service *HTTPRestService) GetNCHostStates() map[string]NCHostState {
+	service.RLock()
+	defer service.RUnlock()
+	states := make(map[string]NCHostState, len(service.state.ContainerStatus))
+	for ncID, nc := range service.state.ContainerStatus {
+		state := NCHostState{HostVersion: -1}
+		if hostVersion, err := strconv.ParseInt(nc.HostVersion, 10, 64); err == nil {
+			state.HostVersion = hostVersion
+		}
+		if version, err := strconv.ParseInt(nc.CreateNetworkContainerRequest.Version, 10, 64); err == nil {
+			state.Version = version
+		}
+		states[ncID] = state
+	}
+	for _, ipConfig := range service.PodIPConfigState {
+		if ipConfig.GetState() != types.Assigned {
+			continue
+		}
+		if state, ok := states[ipConfig.NCID]; ok {
+			state.IPsInUse++
+			states[ipConfig.NCID] = state
+		}
+	}
+	return states
+}
+
 // syncHostVersion updates the CNS state with the latest programmed versions of NCs attached to the VM. If any NC in local CNS state
 // does not match the version that DNC claims to have published, this function will call NMAgent and list the latest programmed versions of
 // all NCs and update the CNS state accordingly. This function returns the the total number of NCs on this VM that have been programmed to
@@ -221,6 +258,7 @@ func (service *HTTPRestService) syncHostNCVersion(ctx context.Context, channelMo
 		}
 	}
 	if len(outdatedNCs) == 0 {
+		service.reportNCVersionMismatches(outdatedNCs)
 		return len(programmedNCs), nil
 	}
 
@@ -299,6 +337,7 @@ func (service *HTTPRestService) syncHostNCVersion(ctx context.Context, channelMo
 		// if we successfully updated the NC, pop it from the needs update set.
 		delete(outdatedNCs, ncID)
 	}
+	service.reportNCVersionMismatches(outdatedNCs)
 	// if we didn't empty out the needs update set, NMA has not programmed all the NCs we are expecting, and we
 	// need to return an error indicating that
 	if len(outdatedNCs) > 0 {
@@ -308,6 +347,31 @@ func (service *HTTPRestService) syncHostNCVersion(ctx context.Context, channelMo
 	return len(programmedNCs), nil
 }
 
+// reportNCVersionMismatches emits an NCVersionMismatch Event for each of the outdated NCs once, when its host version
+// stops matching its version, rather than on every sync while the mismatch lasts.
+func (service *HTTPRestService) reportNCVersionMismatches(outdatedNCs map[string]struct{}) {
+	for ncID := range service.ncVersionMismatches {
+		if _, ok := outdatedNCs[ncID]; !ok {
+			delete(service.ncVersionMismatches, ncID)
+		}
+	}
+	for ncID := range outdatedNCs {
+		ncInfo, ok := service.state.ContainerStatus[ncID]
+		if !ok {
+			continue
+		}
+		version := ncInfo.CreateNetworkContainerRequest.Version
+		if reported, ok := service.ncVersionMismatches[ncID]; ok && reported == version {
+			continue
+		}
+		if service.ncVersionMismatches == nil {
+			service.ncVersionMismatches = map[string]string{}
+		}
+		service.ncVersionMismatches[ncID] = version
+		service.kubeEvents.NCVersionMismatch(ncID, ncInfo.HostVersion, version)
+	}
+}
+
 func (service *HTTPRestService) ReconcileIPAssignment(podInfoByIP map[string]cns.PodInfo, ncReqs []*cns.CreateNetworkContainerRequest) types.ResponseCode {
 	// index all the secondary IP configs for all the nc reqs, for easier lookup later on.
 	allSecIPsIdx := make(map[string]*cns.CreateNetworkContainerRequest)
@@ -658,7 +722,7 @@ func (service *HTTPRestService) CreateOrUpdateNetworkContainerInternal(req *cns.
 		logger.Errorf(returnMessage)
 	}
 
-	if service.Options[common.OptProgramSNATIPTables] == true {
+	if service.GetOption(common.OptProgramSNATIPTables) == true {
 		returnCode, returnMessage = service.programSNATRules(req)
 		if returnCode != 0 {
 			logger.Errorf(returnMessage)
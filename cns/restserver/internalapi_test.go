@@ -21,6 +21,7 @@ import (
 	"github.com/Azure/azure-container-networking/cns/configuration"
 	"github.com/Azure/azure-container-networking/cns/fakes"
 	"github.com/Azure/azure-container-networking/cns/imds"
+	"github.com/Azure/azure-container-networking/cns/kubeevents"
 	"github.com/Azure/azure-container-networking/cns/types"
 	"github.com/Azure/azure-container-networking/crd/nodenetworkconfig/api/v1alpha"
 	nma "github.com/Azure/azure-container-networking/nmagent"
@@ -30,6 +31,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/exp/maps"
+	"k8s.io/client-go/tools/record"
 )
 
 const (
@@ -458,6 +460,24 @@ func TestSyncHostNCVersionErrorMissingNC(t *testing.T) {
 	}
 }
 
+func TestGetNCHostStates(t *testing.T) {
+	req := createNCReqeustForSyncHostNCVersion(t)
+
+	svc.Lock()
+	ncStatus := svc.state.ContainerStatus[req.NetworkContainerid]
+	ncStatus.CreateNetworkContainerRequest.Version = "2"
+	ncStatus.HostVersion = "1"
+	svc.state.ContainerStatus[req.NetworkContainerid] = ncStatus
+	for ipID, ipConfig := range svc.PodIPConfigState {
+		ipConfig.SetState(types.Assigned)
+		svc.PodIPConfigState[ipID] = ipConfig
+	}
+	svc.Unlock()
+
+	states := svc.GetNCHostStates()
+	assert.Equal(t, NCHostState{HostVersion: 1, Version: 2, IPsInUse: 1}, states[req.NetworkContainerid])
+}
+
 func TestSyncHostNCVersionLocalVersionHigher(t *testing.T) {
 	// Test scenario where local NC version is higher than consolidated NC version from IMDS
 	// This should trigger the "NC version from consolidated sources is decreasing" error
@@ -1758,3 +1778,41 @@ func setupIMDSMockAPIsWithCustomIDs(svc *HTTPRestService, interfaceIDs []string)
 	// Return cleanup function
 	return func() { svc.imdsClient = originalIMDS }
 }
+
+func TestReportNCVersionMismatches(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+	events := record.NewFakeRecorder(10)
+	svc.kubeEvents = kubeevents.NewRecorder(events, nil, "node")
+	svc.state.ContainerStatus = map[string]containerstatus{
+		"nc": {ID: "nc", HostVersion: "0", CreateNetworkContainerRequest: cns.CreateNetworkContainerRequest{Version: "1"}},
+	}
+	outdated := map[string]struct{}{"nc": {}}
+	received := func() int {
+		n := 0
+		for {
+			select {
+			case <-events.Events:
+				n++
+			default:
+				return n
+			}
+		}
+	}
+
+	// the Event is emitted when the mismatch starts, not on every sync while it lasts
+	svc.reportNCVersionMismatches(outdated)
+	svc.reportNCVersionMismatches(outdated)
+	assert.Equal(t, 1, received())
+
+	// a new version of the NC is a new mismatch
+	nc := svc.state.ContainerStatus["nc"]
+	nc.CreateNetworkContainerRequest.Version = "2"
+	svc.state.ContainerStatus["nc"] = nc
+	svc.reportNCVersionMismatches(outdated)
+	assert.Equal(t, 1, received())
+
+	// so is a mismatch after the NC was programmed
+	svc.reportNCVersionMismatches(map[string]struct{}{})
+	svc.reportNCVersionMismatches(outdated)
+	assert.Equal(t, 1, received())
+}
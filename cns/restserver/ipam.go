@@ -11,6 +11,7 @@ import (
 	"net/netip"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/cns/filter"
@@ -18,7 +19,9 @@ import (
 	"github.com/Azure/azure-container-networking/cns/types"
 	"github.com/Azure/azure-container-networking/common"
 	"github.com/Azure/azure-container-networking/store"
+	"github.com/Azure/azure-container-networking/tracing"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/exp/maps"
 )
 
@@ -29,6 +32,8 @@ var (
 	ErrOptManageEndpointState = errors.New("CNS is not set to manage the endpoint state")
 	ErrEndpointStateNotFound  = errors.New("endpoint state could not be found in the statefile")
 	ErrGetAllNCResponseEmpty  = errors.New("failed to get NC responses from statefile")
+	ErrNoAvailableIPs         = errors.New("no IPs available")
+	ErrIPsPendingProgramming  = errors.New("IPs pending programming")
 )
 
 const (
@@ -37,7 +42,16 @@ const (
 )
 
 // requestIPConfigHandlerHelper validates the request, assign IPs and return the IPConfigs
-func (service *HTTPRestService) requestIPConfigHandlerHelper(ctx context.Context, ipconfigsRequest cns.IPConfigsRequest) (*cns.IPConfigsResponse, error) {
+func (service *HTTPRestService) requestIPConfigHandlerHelper(ctx context.Context, ipconfigsRequest cns.IPConfigsRequest) (resp *cns.IPConfigsResponse, err error) {
+	ctx, span := tracing.Start(ctx, "HTTPRestService.requestIPConfigHandlerHelper", ipConfigsRequestAttributes(ipconfigsRequest)...)
+	defer func() { tracing.End(span, err) }()
+	defer func(start time.Time) { observeIPAllocation(resp, err, start) }(time.Now())
+	defer func() {
+		if err != nil {
+			service.recordIPAssignmentFailure(&ipconfigsRequest, err)
+		}
+	}()
+
 	// For SWIFT v2 scenario, the validator function will also modify the ipconfigsRequest.
 	podInfo, returnCode, returnMessage := service.validateIPConfigsRequest(ctx, ipconfigsRequest)
 	if returnCode != types.Success {
@@ -93,7 +107,7 @@ func (service *HTTPRestService) requestIPConfigHandlerHelper(ctx context.Context
 	}()
 
 	// Check if http rest service managed endpoint state is set
-	if service.Options[common.OptManageEndpointState] == true {
+	if service.GetOption(common.OptManageEndpointState) == true {
 		err = service.updateEndpointState(ipconfigsRequest, podInfo, podIPInfo)
 		if err != nil {
 			return &cns.IPConfigsResponse{
@@ -395,7 +409,10 @@ func (service *HTTPRestService) updateEndpointState(ipconfigsRequest cns.IPConfi
 }
 
 // ReleaseIPConfigHandlerHelper validates the request and removes the endpoint associated with the pod
-func (service *HTTPRestService) ReleaseIPConfigHandlerHelper(ctx context.Context, ipconfigsRequest cns.IPConfigsRequest) (*cns.IPConfigsResponse, error) {
+func (service *HTTPRestService) ReleaseIPConfigHandlerHelper(ctx context.Context, ipconfigsRequest cns.IPConfigsRequest) (_ *cns.IPConfigsResponse, err error) {
+	ctx, span := tracing.Start(ctx, "HTTPRestService.ReleaseIPConfigHandlerHelper", ipConfigsRequestAttributes(ipconfigsRequest)...)
+	defer func() { tracing.End(span, err) }()
+
 	podInfo, returnCode, returnMessage := service.validateIPConfigsRequest(ctx, ipconfigsRequest)
 	if returnCode != types.Success {
 		return &cns.IPConfigsResponse{
@@ -406,7 +423,7 @@ func (service *HTTPRestService) ReleaseIPConfigHandlerHelper(ctx context.Context
 		}, fmt.Errorf("failed to validate ip config request") //nolint:goerr113 // return error
 	}
 	// Check if http rest service managed endpoint state is set
-	if service.Options[common.OptManageEndpointState] == true {
+	if service.GetOption(common.OptManageEndpointState) == true {
 		if err := service.removeEndpointState(podInfo); err != nil {
 			resp := &cns.IPConfigsResponse{
 				Response: cns.Response{
@@ -1029,6 +1046,8 @@ func (service *HTTPRestService) AssignAvailableIPConfigs(podInfo cns.PodInfo) ([
 	podIPInfo := make([]cns.PodIpInfo, numberOfIPs)
 	// This map is used to store whether or not we have found an available IP from an NC when looping through the pool
 	ipsToAssign := make(map[string]cns.IPConfigurationStatus)
+	// This map is used to store whether there are IPs of a family which aren't available yet because they are pending programming
+	pendingProgramming := make(map[cns.IPFamily]bool)
 
 	// Searches for available IPs in the pool
 	for _, ipState := range service.PodIPConfigState {
@@ -1048,6 +1067,9 @@ func (service *HTTPRestService) AssignAvailableIPConfigs(podInfo cns.PodInfo) ([
 		}
 		// Checks if the current IP is available
 		if ipState.GetState() != types.Available {
+			if ipState.GetState() == types.PendingProgramming {
+				pendingProgramming[ipStateFamily] = true
+			}
 			continue
 		}
 		ipsToAssign[key] = ipState
@@ -1064,7 +1086,11 @@ func (service *HTTPRestService) AssignAvailableIPConfigs(podInfo cns.PodInfo) ([
 				if _, found := ipsToAssign[generateAssignedIPKey(ncID, ipFamily)]; found {
 					continue
 				}
-				return podIPInfo, errors.Errorf("not enough IPs available of type %s for %s, waiting on Azure CNS to allocate more with NC Status: %s",
+				cause := ErrNoAvailableIPs
+				if pendingProgramming[ipFamily] {
+					cause = ErrIPsPendingProgramming
+				}
+				return podIPInfo, errors.Wrapf(cause, "not enough IPs available of type %s for %s, waiting on Azure CNS to allocate more with NC Status: %s",
 					ipFamily, ncID, string(service.state.ContainerStatus[ncID].CreateNetworkContainerRequest.NCStatus))
 			}
 		}
@@ -1109,6 +1135,14 @@ func (service *HTTPRestService) AssignAvailableIPConfigs(podInfo cns.PodInfo) ([
 	return podIPInfo, nil
 }
 
+// ipConfigsRequestAttributes identifies the pod of an IPConfigsRequest on a span.
+func ipConfigsRequestAttributes(req cns.IPConfigsRequest) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("container.id", req.InfraContainerID),
+		attribute.String("cns.pod_interface_id", req.PodInterfaceID),
+	}
+}
+
 func generateAssignedIPKey(ncID string, ipFamily cns.IPFamily) string {
 	return fmt.Sprintf("%s_%s", ncID, string(ipFamily))
 }
@@ -1157,7 +1191,7 @@ func (service *HTTPRestService) EndpointHandlerAPI(w http.ResponseWriter, r *htt
 	service.Lock()
 	defer service.Unlock()
 	// Check if CNS is managing the CNI statefile
-	if service.Options[common.OptManageEndpointState] == false {
+	if service.GetOption(common.OptManageEndpointState) == false {
 		response := cns.Response{
 			ReturnCode: types.UnexpectedError,
 			Message:    fmt.Sprintf("[EndpointHandlerAPI] EndpointHandlerAPI failed with error: %s", ErrOptManageEndpointState),
@@ -1491,3 +1525,19 @@ func (service *HTTPRestService) getIPFamiliesMap() map[cns.IPFamily]struct{} {
 func (service *HTTPRestService) GetIPFamilyCount() int {
 	return len(service.getIPFamiliesMap())
 }
+
+// recordIPAssignmentFailure emits an Event on the Pod of the request about why it wasn't assigned IPs.
+func (service *HTTPRestService) recordIPAssignmentFailure(ipconfigsRequest *cns.IPConfigsRequest, err error) {
+	if service.kubeEvents == nil {
+		return
+	}
+	podInfo, podErr := cns.UnmarshalPodInfo(ipconfigsRequest.OrchestratorContext)
+	if podErr != nil {
+		return
+	}
+	if errors.Is(err, ErrIPsPendingProgramming) {
+		service.kubeEvents.IPPendingProgramming(podInfo.Namespace(), podInfo.Name(), err)
+		return
+	}
+	service.kubeEvents.IPAssignmentFailed(podInfo.Namespace(), podInfo.Name(), err)
+}
@@ -2321,6 +2321,7 @@ func TestIPAMRequestIPConfigsProgrammingPendingFailure(t *testing.T) {
 	_, err = requestIPConfigsHelper(svc, req)
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "not enough IPs available")
+	assert.ErrorIs(t, err, ErrIPsPendingProgramming)
 
 	// Verify no IPs were assigned
 	assignedIPs := svc.GetAssignedIPConfigs()
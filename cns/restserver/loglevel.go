@@ -0,0 +1,118 @@
+package restserver
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	loggerv2 "github.com/Azure/azure-container-networking/cns/logger/v2"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/common"
+	"go.uber.org/zap/zapcore"
+)
+
+const bearerPrefix = "Bearer "
+
+// RegisterLogLevelEndpoint serves the overrides of the CNS logger levels at cns.LogLevelPath.
+// GET returns the overrides, and POST changes them with a cns.SetLogLevelRequest.
+// Requests must be authenticated with token as a bearer token.
+func (service *HTTPRestService) RegisterLogLevelEndpoint(levels *loggerv2.Levels, token string) {
+	if service.Listener != nil {
+		service.Listener.AddHandler(cns.LogLevelPath, logLevelHandler(levels, token))
+	}
+}
+
+func logLevelHandler(levels *loggerv2.Levels, token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		opName := "logLevel"
+		if !authorized(r, token) {
+			resp := cns.LogLevelResponse{
+				Response: cns.Response{ReturnCode: types.StatusUnauthorized, Message: "missing or invalid bearer token"},
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+			err := common.Encode(w, &resp)
+			logger.Response(opName, resp, resp.Response.ReturnCode, err)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var req cns.SetLogLevelRequest
+			if err := common.Decode(w, r, &req); err != nil {
+				return
+			}
+			if resp, ok := setLogLevel(levels, &req); !ok {
+				err := common.Encode(w, &resp)
+				logger.ResponseEx(opName, req, resp, resp.Response.ReturnCode, err)
+				return
+			}
+			logger.Printf("[Azure CNS] Log level of component %q set to %q, reverting after %s", req.Component, req.Level, req.RevertAfter.Duration)
+		default:
+			resp := cns.LogLevelResponse{
+				Response: cns.Response{ReturnCode: types.UnsupportedVerb, Message: "[Azure CNS] Error. logLevel did not receive a GET or POST."},
+			}
+			err := common.Encode(w, &resp)
+			logger.Response(opName, resp, resp.Response.ReturnCode, err)
+			return
+		}
+
+		resp := logLevelResponse(levels)
+		err := common.Encode(w, &resp)
+		logger.Response(opName, resp, resp.Response.ReturnCode, err)
+	}
+}
+
+// authorized returns whether the request has the bearer token. Requests are never authorized if the token is empty.
+func authorized(r *http.Request, token string) bool {
+	auth := r.Header.Get("Authorization")
+	if token == "" || !strings.HasPrefix(auth, bearerPrefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, bearerPrefix)), []byte(token)) == 1
+}
+
+// setLogLevel applies the request to levels, or returns the response describing why it couldn't.
+func setLogLevel(levels *loggerv2.Levels, req *cns.SetLogLevelRequest) (cns.LogLevelResponse, bool) {
+	if req.Level == "" {
+		levels.Reset(req.Component)
+		return cns.LogLevelResponse{}, true
+	}
+	level, err := zapcore.ParseLevel(req.Level)
+	if err != nil {
+		return cns.LogLevelResponse{
+			Response: cns.Response{ReturnCode: types.InvalidParameter, Message: err.Error()},
+		}, false
+	}
+	levels.Set(req.Component, level, req.RevertAfter.Duration)
+	return cns.LogLevelResponse{}, true
+}
+
+func logLevelResponse(levels *loggerv2.Levels) cns.LogLevelResponse {
+	resp := cns.LogLevelResponse{
+		Response: cns.Response{ReturnCode: types.Success},
+	}
+	if global, ok := levels.Global(); ok {
+		o := toLogLevelOverride(global)
+		resp.Global = &o
+	}
+	components := levels.Components()
+	if len(components) > 0 {
+		resp.Components = make(map[string]cns.LogLevelOverride, len(components))
+		for name, o := range components {
+			resp.Components[name] = toLogLevelOverride(o)
+		}
+	}
+	return resp
+}
+
+func toLogLevelOverride(o loggerv2.LevelOverride) cns.LogLevelOverride {
+	override := cns.LogLevelOverride{Level: o.Level.String()}
+	if !o.Expires.IsZero() {
+		expires := o.Expires
+		override.Expires = &expires
+	}
+	return override
+}
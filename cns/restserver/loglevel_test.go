@@ -0,0 +1,89 @@
+package restserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	loggerv2 "github.com/Azure/azure-container-networking/cns/logger/v2"
+	"github.com/Azure/azure-container-networking/cns/types"
+	acntime "github.com/Azure/azure-container-networking/internal/time"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestLogLevelHandler(t *testing.T) {
+	const token = "token"
+	levels := loggerv2.NewLevels()
+	handler := logLevelHandler(levels, token)
+
+	do := func(t *testing.T, method, auth string, body any) (int, cns.LogLevelResponse) {
+		t.Helper()
+		var b bytes.Buffer
+		if body != nil {
+			require.NoError(t, json.NewEncoder(&b).Encode(body))
+		}
+		req := httptest.NewRequest(method, cns.LogLevelPath, &b)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		var resp cns.LogLevelResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		return w.Code, resp
+	}
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		for _, auth := range []string{"", "Bearer wrong", token} {
+			code, resp := do(t, http.MethodPost, auth, cns.SetLogLevelRequest{Level: "debug"})
+			require.Equal(t, http.StatusUnauthorized, code)
+			require.Equal(t, types.StatusUnauthorized, resp.Response.ReturnCode)
+		}
+		_, ok := levels.Global()
+		require.False(t, ok)
+	})
+
+	t.Run("set", func(t *testing.T) {
+		code, resp := do(t, http.MethodPost, "Bearer "+token, cns.SetLogLevelRequest{Level: "debug"})
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, types.Success, resp.Response.ReturnCode)
+		require.Equal(t, &cns.LogLevelOverride{Level: "debug"}, resp.Global)
+
+		code, resp = do(t, http.MethodPost, "Bearer "+token, cns.SetLogLevelRequest{
+			Component:   "ipam-pool-monitor",
+			Level:       "warn",
+			RevertAfter: acntime.Duration{Duration: time.Hour},
+		})
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, "warn", resp.Components["ipam-pool-monitor"].Level)
+		require.NotNil(t, resp.Components["ipam-pool-monitor"].Expires)
+
+		override, ok := levels.Components()["ipam-pool-monitor"]
+		require.True(t, ok)
+		require.Equal(t, zapcore.WarnLevel, override.Level)
+	})
+
+	t.Run("invalid level", func(t *testing.T) {
+		_, resp := do(t, http.MethodPost, "Bearer "+token, cns.SetLogLevelRequest{Level: "loud"})
+		require.Equal(t, types.InvalidParameter, resp.Response.ReturnCode)
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		_, resp := do(t, http.MethodPost, "Bearer "+token, cns.SetLogLevelRequest{Component: "ipam-pool-monitor"})
+		require.Equal(t, types.Success, resp.Response.ReturnCode)
+		require.Empty(t, resp.Components)
+
+		_, resp = do(t, http.MethodGet, "Bearer "+token, nil)
+		require.Equal(t, &cns.LogLevelOverride{Level: "debug"}, resp.Global)
+	})
+
+	t.Run("unsupported verb", func(t *testing.T) {
+		_, resp := do(t, http.MethodDelete, "Bearer "+token, nil)
+		require.Equal(t, types.UnsupportedVerb, resp.Response.ReturnCode)
+	})
+}
@@ -7,8 +7,10 @@ import (
 	"time"
 
 	"github.com/Azure/azure-container-networking/cns"
+	ipampoolmetrics "github.com/Azure/azure-container-networking/cns/ipampool/metrics"
 	"github.com/Azure/azure-container-networking/cns/logger"
 	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
 )
@@ -20,6 +22,14 @@ const (
 	cnsReturnCode            = "cns_return_code"
 	customerMetricLabel      = "customer_metric"
 	customerMetricLabelValue = "customer metric"
+
+	ipAllocationFailureReasonLabel = "reason"
+	// failure reasons of IP allocations.
+	ipAllocationSucceeded          = "none"
+	ipAllocationExhausted          = "exhausted"
+	ipAllocationNCNotProgrammed    = "nc_not_programmed"
+	ipAllocationPendingProgramming = "pending_programming"
+	ipAllocationOtherFailure       = "other"
 )
 
 var (
@@ -40,6 +50,22 @@ var (
 			Buckets: prometheus.ExponentialBuckets(0.001, 2, 15), // 1 ms to ~16 seconds
 		},
 	)
+	ipAllocationCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ip_allocation_total",
+			Help: "Count of Pod IP allocations by CNS return code and failure reason.",
+		},
+		[]string{cnsReturnCode, ipAllocationFailureReasonLabel},
+	)
+	ipAllocationLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "ip_allocation_latency_seconds",
+			Help: "Pod IP allocation request latency in seconds by CNS return code and failure reason.",
+			//nolint:gomnd // default bucket consts
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 15), // 1 ms to ~16 seconds
+		},
+		[]string{cnsReturnCode, ipAllocationFailureReasonLabel},
+	)
 	ipConfigStatusStateTransitionTime = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name: "ipconfigstatus_state_transition_seconds",
@@ -103,6 +129,24 @@ var (
 		},
 		[]string{},
 	)
+	cniOperationLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "cni_operation_latency_seconds",
+			Help: "Latency of CNI commands in seconds, as reported by CNI, by operation, NIC type and error class.",
+			//nolint:gomnd // default bucket consts
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 15), // 1 ms to ~16 seconds
+		},
+		[]string{"operation", "nic_type", "error_class"},
+	)
+	cniOperationPhaseLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "cni_operation_phase_latency_seconds",
+			Help: "Latency of the phases of CNI commands in seconds, as reported by CNI, by operation and phase.",
+			//nolint:gomnd // default bucket consts
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 15), // 1 ms to ~16 seconds
+		},
+		[]string{"operation", "phase"},
+	)
 	pendingReleaseIPCount = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name:        "cx_pending_release_ips_v2",
@@ -117,6 +161,8 @@ func init() {
 	metrics.Registry.MustRegister(
 		HTTPRequestLatency,
 		ipAssignmentLatency,
+		ipAllocationCount,
+		ipAllocationLatency,
 		ipConfigStatusStateTransitionTime,
 		syncHostNCVersionCount,
 		syncHostNCVersionLatency,
@@ -126,6 +172,8 @@ func init() {
 		availableIPCount,
 		pendingProgrammingIPCount,
 		pendingReleaseIPCount,
+		cniOperationLatency,
+		cniOperationPhaseLatency,
 	)
 }
 
@@ -143,6 +191,39 @@ func NewHandlerFuncWithHistogram(handler http.HandlerFunc, histogram *prometheus
 	}
 }
 
+// observeIPAllocation records the outcome and latency of a Pod IP allocation.
+// Allocations failing because no IP is available mark the IP pool as exhausted,
+// so the time until the pool scales up is observed by the IP pool monitor.
+func observeIPAllocation(resp *cns.IPConfigsResponse, err error, start time.Time) {
+	returnCode := types.UnexpectedError
+	if resp != nil {
+		returnCode = resp.Response.ReturnCode
+	}
+	reason := ipAllocationFailureReason(err)
+	// IPs pending programming are allocated to CNS, so the pool doesn't need to scale up for them.
+	if reason == ipAllocationExhausted {
+		ipampoolmetrics.MarkPoolExhausted()
+	}
+	ipAllocationCount.WithLabelValues(returnCode.String(), reason).Inc()
+	ipAllocationLatency.WithLabelValues(returnCode.String(), reason).Observe(time.Since(start).Seconds())
+}
+
+// ipAllocationFailureReason classifies why a Pod IP allocation failed.
+func ipAllocationFailureReason(err error) string {
+	switch {
+	case err == nil:
+		return ipAllocationSucceeded
+	case errors.Is(err, ErrNoNCs):
+		return ipAllocationNCNotProgrammed
+	case errors.Is(err, ErrIPsPendingProgramming):
+		return ipAllocationPendingProgramming
+	case errors.Is(err, ErrNoAvailableIPs):
+		return ipAllocationExhausted
+	default:
+		return ipAllocationOtherFailure
+	}
+}
+
 func stateTransitionMiddleware(i *cns.IPConfigurationStatus, s types.IPState) {
 	// if no state transition has been recorded yet, don't collect any metric
 	if i.LastStateTransition.IsZero() {
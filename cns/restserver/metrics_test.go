@@ -0,0 +1,77 @@
+package restserver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	ipampoolmetrics "github.com/Azure/azure-container-networking/cns/ipampool/metrics"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIPAllocationFailureReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{err: nil, want: ipAllocationSucceeded},
+		{err: ErrNoNCs, want: ipAllocationNCNotProgrammed},
+		{err: errors.Wrap(ErrNoAvailableIPs, "not enough IPs available"), want: ipAllocationExhausted},
+		{err: errors.Wrap(ErrIPsPendingProgramming, "not enough IPs available"), want: ipAllocationPendingProgramming},
+		{err: errors.New("failed to validate ip config request"), want: ipAllocationOtherFailure},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, ipAllocationFailureReason(tt.err), "%v", tt.err)
+	}
+}
+
+func TestRequestIPConfigObservesIPAllocation(t *testing.T) {
+	svc := getTestService(cns.KubernetesCRD)
+	ipconfigs := map[string]cns.IPConfigurationStatus{
+		"ip-1": newPodState(testIP1, "ip-1", testNCID, types.Available, 0),
+	}
+	require.NoError(t, updatePodIPConfigState(t, svc, ipconfigs, testNCID))
+
+	request := func(podInfo cns.PodInfo) {
+		req := cns.IPConfigsRequest{PodInterfaceID: podInfo.InterfaceID(), InfraContainerID: podInfo.InfraContainerID()}
+		req.OrchestratorContext, _ = podInfo.OrchestratorContext()
+		_, _ = svc.requestIPConfigHandlerHelper(context.Background(), req)
+	}
+	succeeded := ipAllocationCount.WithLabelValues(types.Success.String(), ipAllocationSucceeded)
+	exhausted := ipAllocationCount.WithLabelValues(types.FailedToAllocateIPConfig.String(), ipAllocationExhausted)
+	succeededBefore, exhaustedBefore := testutil.ToFloat64(succeeded), testutil.ToFloat64(exhausted)
+
+	request(testPod1Info)
+	request(testPod2Info)
+	assert.InDelta(t, succeededBefore+1, testutil.ToFloat64(succeeded), 0)
+	assert.InDelta(t, exhaustedBefore+1, testutil.ToFloat64(exhausted), 0)
+	assert.Positive(t, testutil.CollectAndCount(ipAllocationLatency))
+}
+
+func TestObserveIPAllocationMarksPoolExhausted(t *testing.T) {
+	// the batch label keeps the observations of this test apart
+	const batch = 7777
+	observations := func() uint64 {
+		var m dto.Metric
+		require.NoError(t, ipampoolmetrics.IpamTimeToAvailableIP.WithLabelValues("7777").(prometheus.Metric).Write(&m))
+		return m.GetHistogram().GetSampleCount()
+	}
+	ipampoolmetrics.ObserveAvailableIPs(1, batch)
+	before := observations()
+
+	// IPs pending programming don't make the pool scale up
+	observeIPAllocation(nil, errors.Wrap(ErrIPsPendingProgramming, "not enough IPs available"), time.Now())
+	ipampoolmetrics.ObserveAvailableIPs(1, batch)
+	assert.Equal(t, before, observations())
+
+	observeIPAllocation(nil, errors.Wrap(ErrNoAvailableIPs, "not enough IPs available"), time.Now())
+	ipampoolmetrics.ObserveAvailableIPs(1, batch)
+	assert.Equal(t, before+1, observations())
+}
@@ -0,0 +1,170 @@
+package restserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/debugbundle"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/pkg/errors"
+)
+
+// podDebugBundleTimeout bounds how long the commands which dump the network of the host and the pod can run for.
+const podDebugBundleTimeout = time.Minute
+
+// podDebugState is the state of CNS about a pod.
+type podDebugState struct {
+	IPConfigs         []cns.IPConfigurationStatus
+	Endpoints         map[string]EndpointInfo // key : container id
+	NetworkContainers map[string]containerstatus
+}
+
+// RegisterPodDebugBundleEndpoint serves bundles of what is needed to debug the network of a pod at cns.PathDebugPodBundle.
+// A bundle is a tar.gz, requested by POSTing a cns.PodDebugBundleRequest, with the state of CNS about the pod, dumps of the
+// network of the host and the pod, and the lines of the logs about the pod. Secrets are redacted from bundles.
+// Requests must be authenticated with token as a bearer token.
+func (service *HTTPRestService) RegisterPodDebugBundleEndpoint(cfg debugbundle.Config, token string) {
+	if service.Listener != nil {
+		service.Listener.AddHandler(cns.PathDebugPodBundle, service.podDebugBundleHandler(cfg, platform.NewExecClient(nil), token))
+	}
+}
+
+func (service *HTTPRestService) podDebugBundleHandler(cfg debugbundle.Config, exec platform.ExecClient, token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		opName := "podDebugBundle"
+		var req cns.PodDebugBundleRequest
+		resp := cns.Response{ReturnCode: types.Success}
+		switch {
+		case !authorized(r, token):
+			resp = cns.Response{ReturnCode: types.StatusUnauthorized, Message: "missing or invalid bearer token"}
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.Method != http.MethodPost:
+			resp = cns.Response{ReturnCode: types.UnsupportedVerb, Message: "[Azure CNS] Error. podDebugBundle did not receive a POST."}
+		default:
+			if err := common.Decode(w, r, &req); err != nil {
+				return
+			}
+			if req.PodNamespace == "" || req.PodName == "" {
+				resp = cns.Response{ReturnCode: types.InvalidParameter, Message: "podNamespace and podName are required"}
+			}
+		}
+		if resp.ReturnCode != types.Success {
+			err := common.Encode(w, &resp)
+			logger.ResponseEx(opName, req, resp, resp.ReturnCode, err)
+			return
+		}
+
+		state := service.podDebugState(req.PodNamespace, req.PodName)
+		if len(state.IPConfigs) == 0 && len(state.Endpoints) == 0 {
+			resp = cns.Response{ReturnCode: types.NotFound, Message: fmt.Sprintf("CNS has no state for pod %s/%s", req.PodNamespace, req.PodName)}
+			err := common.Encode(w, &resp)
+			logger.ResponseEx(opName, req, resp, resp.ReturnCode, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", req.PodNamespace+"_"+req.PodName+".tar.gz"))
+		ctx, cancel := context.WithTimeout(r.Context(), podDebugBundleTimeout)
+		defer cancel()
+		// the status has been written with the first byte of the bundle, so errors can only be logged from here on.
+		if err := writePodDebugBundle(ctx, w, &req, &state, cfg, exec); err != nil {
+			logger.Errorf("[Azure CNS] Failed to write debug bundle of pod %s/%s: %v", req.PodNamespace, req.PodName, err)
+			return
+		}
+		logger.Printf("[Azure CNS] Wrote debug bundle of pod %s/%s", req.PodNamespace, req.PodName)
+	}
+}
+
+// podDebugState returns the IP configurations and endpoints of the pod, and the network containers they belong to.
+func (service *HTTPRestService) podDebugState(podNamespace, podName string) podDebugState {
+	service.RLock()
+	defer service.RUnlock()
+
+	state := podDebugState{
+		Endpoints:         map[string]EndpointInfo{},
+		NetworkContainers: map[string]containerstatus{},
+	}
+	ncIDs := map[string]struct{}{}
+	for _, ipConfig := range service.PodIPConfigState {
+		if ipConfig.PodInfo == nil || ipConfig.PodInfo.Namespace() != podNamespace || ipConfig.PodInfo.Name() != podName {
+			continue
+		}
+		state.IPConfigs = append(state.IPConfigs, ipConfig)
+		ncIDs[ipConfig.NCID] = struct{}{}
+	}
+	for containerID, endpoint := range service.EndpointState {
+		if endpoint == nil || endpoint.PodNamespace != podNamespace || endpoint.PodName != podName {
+			continue
+		}
+		// copy the IPs of the endpoint, which may change once the lock is released.
+		copied := EndpointInfo{PodName: endpoint.PodName, PodNamespace: endpoint.PodNamespace, IfnameToIPMap: map[string]*IPInfo{}}
+		for ifName, ipInfo := range endpoint.IfnameToIPMap {
+			if ipInfo == nil {
+				continue
+			}
+			ipInfoCopy := *ipInfo
+			copied.IfnameToIPMap[ifName] = &ipInfoCopy
+			if ipInfo.NetworkContainerID != "" {
+				ncIDs[ipInfo.NetworkContainerID] = struct{}{}
+			}
+		}
+		state.Endpoints[containerID] = copied
+	}
+	if service.state != nil {
+		for ncID := range ncIDs {
+			if nc, ok := service.state.ContainerStatus[ncID]; ok {
+				state.NetworkContainers[ncID] = nc
+			}
+		}
+	}
+	return state
+}
+
+func writePodDebugBundle(ctx context.Context, w http.ResponseWriter, req *cns.PodDebugBundleRequest, state *podDebugState,
+	cfg debugbundle.Config, exec platform.ExecClient,
+) error {
+	// the lines of the logs about the pod mention its name, its containers or its IPs.
+	terms := []string{req.PodName}
+	var hostVeths []string
+	for containerID, endpoint := range state.Endpoints {
+		terms = append(terms, containerID)
+		for _, ipInfo := range endpoint.IfnameToIPMap {
+			if ipInfo != nil && ipInfo.HostVethName != "" {
+				hostVeths = append(hostVeths, ipInfo.HostVethName)
+			}
+		}
+	}
+	for i := range state.IPConfigs {
+		terms = append(terms, state.IPConfigs[i].IPAddress)
+	}
+
+	bundle := debugbundle.NewWriter(w)
+	if err := bundle.AddJSON("request.json", struct {
+		cns.PodDebugBundleRequest
+		Time time.Time `json:"time"`
+	}{PodDebugBundleRequest: *req, Time: time.Now()}); err != nil {
+		return err
+	}
+	if err := bundle.AddJSON("cns/ipconfigs.json", state.IPConfigs); err != nil {
+		return err
+	}
+	if err := bundle.AddJSON("cns/endpoints.json", state.Endpoints); err != nil {
+		return err
+	}
+	if err := bundle.AddJSON("cns/networkcontainers.json", state.NetworkContainers); err != nil {
+		return err
+	}
+	if err := debugbundle.CollectNetwork(ctx, exec, bundle, hostVeths); err != nil {
+		return err
+	}
+	if err := debugbundle.CollectFiles(bundle, cfg, terms); err != nil {
+		return err
+	}
+	return errors.Wrap(bundle.Close(), "failed to complete bundle")
+}
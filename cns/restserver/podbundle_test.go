@@ -0,0 +1,111 @@
+package restserver
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/debugbundle"
+	"github.com/Azure/azure-container-networking/cns/types"
+	"github.com/Azure/azure-container-networking/platform"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPodDebugBundleHandler(t *testing.T) {
+	const token = "token"
+	podInfo := cns.NewPodInfo("container-1", "eth0", "pod-a", "ns-a")
+	service := &HTTPRestService{
+		PodIPConfigState: map[string]cns.IPConfigurationStatus{
+			"ip-1": {ID: "ip-1", IPAddress: "10.0.0.4", NCID: "nc-1", PodInfo: podInfo},
+			"ip-2": {ID: "ip-2", IPAddress: "10.0.0.5", NCID: "nc-1"},
+		},
+		EndpointState: map[string]*EndpointInfo{
+			"container-1": {PodName: "pod-a", PodNamespace: "ns-a", IfnameToIPMap: map[string]*IPInfo{
+				"eth0": {HostVethName: "azv1", NetworkContainerID: "nc-1"},
+			}},
+			"container-2": {PodName: "pod-b", PodNamespace: "ns-a"},
+		},
+		state: &httpRestServiceState{
+			ContainerStatus: map[string]containerstatus{
+				"nc-1": {ID: "nc-1", CreateNetworkContainerRequest: cns.CreateNetworkContainerRequest{
+					NetworkContainerid: "nc-1",
+					AuthorizationToken: "nc-secret",
+				}},
+				"nc-2": {ID: "nc-2"},
+			},
+		},
+	}
+	handler := service.podDebugBundleHandler(debugbundle.Config{}, platform.NewMockExecClient(false), token)
+
+	do := func(t *testing.T, method, auth string, req cns.PodDebugBundleRequest) *httptest.ResponseRecorder {
+		t.Helper()
+		var b bytes.Buffer
+		require.NoError(t, json.NewEncoder(&b).Encode(req))
+		r := httptest.NewRequest(method, cns.PathDebugPodBundle, &b)
+		r.Header.Set("Authorization", auth)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+	decode := func(t *testing.T, w *httptest.ResponseRecorder) cns.Response {
+		t.Helper()
+		var resp cns.Response
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		return resp
+	}
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		w := do(t, http.MethodPost, "Bearer wrong", cns.PodDebugBundleRequest{PodNamespace: "ns-a", PodName: "pod-a"})
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+		require.Equal(t, types.StatusUnauthorized, decode(t, w).ReturnCode)
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		require.Equal(t, types.UnsupportedVerb, decode(t, do(t, http.MethodGet, "Bearer "+token, cns.PodDebugBundleRequest{})).ReturnCode)
+		require.Equal(t, types.InvalidParameter, decode(t, do(t, http.MethodPost, "Bearer "+token, cns.PodDebugBundleRequest{PodName: "pod-a"})).ReturnCode)
+		require.Equal(t, types.NotFound,
+			decode(t, do(t, http.MethodPost, "Bearer "+token, cns.PodDebugBundleRequest{PodNamespace: "ns-b", PodName: "pod-a"})).ReturnCode)
+	})
+
+	t.Run("bundle", func(t *testing.T) {
+		w := do(t, http.MethodPost, "Bearer "+token, cns.PodDebugBundleRequest{PodNamespace: "ns-a", PodName: "pod-a"})
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "application/gzip", w.Header().Get("Content-Type"))
+
+		gz, err := gzip.NewReader(w.Body)
+		require.NoError(t, err)
+		tr := tar.NewReader(gz)
+		files := map[string][]byte{}
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			files[hdr.Name], err = io.ReadAll(tr)
+			require.NoError(t, err)
+		}
+
+		var ipConfigs []cns.IPConfigurationStatus
+		require.NoError(t, json.Unmarshal(files["cns/ipconfigs.json"], &ipConfigs))
+		require.Len(t, ipConfigs, 1)
+		require.Equal(t, "10.0.0.4", ipConfigs[0].IPAddress)
+
+		var endpoints map[string]EndpointInfo
+		require.NoError(t, json.Unmarshal(files["cns/endpoints.json"], &endpoints))
+		require.Len(t, endpoints, 1)
+		require.Contains(t, endpoints, "container-1")
+
+		var ncs map[string]containerstatus
+		require.NoError(t, json.Unmarshal(files["cns/networkcontainers.json"], &ncs))
+		require.Len(t, ncs, 1)
+		require.Equal(t, debugbundle.Redacted, ncs["nc-1"].CreateNetworkContainerRequest.AuthorizationToken)
+		require.NotContains(t, string(files["cns/networkcontainers.json"]), "nc-secret")
+	})
+}
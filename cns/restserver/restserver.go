@@ -12,6 +12,7 @@ import (
 	"github.com/Azure/azure-container-networking/cns/common"
 	"github.com/Azure/azure-container-networking/cns/dockerclient"
 	"github.com/Azure/azure-container-networking/cns/imds"
+	"github.com/Azure/azure-container-networking/cns/kubeevents"
 	"github.com/Azure/azure-container-networking/cns/logger"
 	"github.com/Azure/azure-container-networking/cns/networkcontainers"
 	"github.com/Azure/azure-container-networking/cns/nodesubnet"
@@ -102,6 +103,9 @@ type HTTPRestService struct {
 	PnpIDByMacAddress          map[string]string
 	imdsClient                 imdsClient
 	nodesubnetIPFetcher        *nodesubnet.IPFetcher
+	kubeEvents                 *kubeevents.Recorder
+	// ncVersionMismatches are the versions of the NCs which an NCVersionMismatch Event was emitted for, by NC.
+	ncVersionMismatches map[string]string
 }
 
 type CNIConflistGenerator interface {
@@ -303,6 +307,7 @@ func (service *HTTPRestService) Init(config *common.ServiceConfig) error {
 	listener.AddHandler(cns.NetworkContainersURLPath, service.getOrRefreshNetworkContainers)
 	listener.AddHandler(cns.GetHomeAz, service.getHomeAz)
 	listener.AddHandler(cns.EndpointPath, service.EndpointHandlerAPI)
+	listener.AddHandler(cns.CNIOperationsPath, service.reportCNIOperation)
 	// This API is only needed for Direct channel mode.
 	if config.ChannelMode == cns.Direct {
 		listener.AddHandler(cns.GetVMUniqueID, service.getVMUniqueID)
@@ -399,3 +404,8 @@ func (service *HTTPRestService) MustGenerateCNIConflistOnce() {
 func (service *HTTPRestService) AttachIPConfigsHandlerMiddleware(middleware cns.IPConfigsHandlerMiddleware) {
 	service.IPConfigsHandlerMiddleware = middleware
 }
+
+// AttachKubeEventRecorder emits Kubernetes Events about failures to assign IPs to Pods and NCs which aren't programmed with recorder.
+func (service *HTTPRestService) AttachKubeEventRecorder(recorder *kubeevents.Recorder) {
+	service.kubeEvents = recorder
+}
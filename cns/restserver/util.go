@@ -120,7 +120,7 @@ func (service *HTTPRestService) restoreState() {
 		logger.Printf("[Azure CNS]  Restored state, %+v\n", service.state) //nolint:staticcheck // TODO: migrate to zap
 	}
 
-	if service.Options[acn.OptManageEndpointState] == true {
+	if service.GetOption(acn.OptManageEndpointState) == true {
 		if service.EndpointStateStore == nil {
 			//nolint:staticcheck // TODO: migrate to zap
 			logger.Errorf("[Azure CNS]  OptManageEndpointState is enabled but EndpointStateStore is not initialized; endpoint state persistence/restoration is disabled.")
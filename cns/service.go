@@ -12,20 +12,24 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/Azure/azure-container-networking/cns/certsource"
 	"github.com/Azure/azure-container-networking/cns/common"
 	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/spiffe"
 	acn "github.com/Azure/azure-container-networking/common"
-	"github.com/Azure/azure-container-networking/keyvault"
 	localtls "github.com/Azure/azure-container-networking/server/tls"
 	"github.com/Azure/azure-container-networking/store"
-	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/pkg/errors"
 )
 
 const (
 	defaultAPIServerPort = "10090"
 	genericData          = "com.microsoft.azure.network.generic"
+	// spiffeFetchTimeout is how long to wait for the first X509-SVID from the SPIFFE Workload API
+	spiffeFetchTimeout = time.Minute
 )
 
 var errTLSConfig = errors.New("unsupported TLS version name from config")
@@ -35,6 +39,8 @@ type Service struct {
 	*common.Service
 	EndpointType string
 	Listener     *acn.Listener
+	// stopCertRefresh stops refreshing the TLS certificate
+	stopCertRefresh context.CancelFunc
 }
 
 // NewService creates a new Service object.
@@ -111,15 +117,19 @@ func (service *Service) AddListener(config *common.ServiceConfig) error {
 		tlsAddress := net.JoinHostPort(hostParts[0], config.TLSSettings.TLSPort)
 
 		// Start the listener and HTTP and HTTPS server.
-		tlsConfig, err := getTLSConfig(config.TLSSettings, config.ErrChan) //nolint
+		ctx, cancel := context.WithCancel(context.Background())
+		tlsConfig, err := getTLSConfig(ctx, config.TLSSettings, config.ErrChan) //nolint
 		if err != nil {
+			cancel()
 			logger.Printf("Failed to compose Tls Configuration with error: %+v", err)
 			return errors.Wrap(err, "could not get tls config")
 		}
 
 		if err := nodeListener.StartTLS(config.ErrChan, tlsConfig, tlsAddress); err != nil {
+			cancel()
 			return errors.Wrap(err, "could not start tls")
 		}
+		service.stopCertRefresh = cancel
 	}
 
 	service.Listener = nodeListener
@@ -144,16 +154,67 @@ func (service *Service) Initialize(config *common.ServiceConfig) error {
 	return nil
 }
 
-func getTLSConfig(tlsSettings localtls.TlsSettings, errChan chan<- error) (*tls.Config, error) {
-	if tlsSettings.TLSCertificatePath != "" {
-		return getTLSConfigFromFile(tlsSettings)
+// getTLSConfig returns a TLS config serving the certificate of the source configured in tlsSettings, which is
+// refreshed until ctx is done.
+func getTLSConfig(ctx context.Context, tlsSettings localtls.TlsSettings, errChan chan<- error) (*tls.Config, error) {
+	if tlsSettings.UseMTLS && tlsSettings.SPIFFEWorkloadAPIAddress != "" {
+		return getSPIFFETLSConfig(ctx, tlsSettings)
 	}
 
-	if tlsSettings.KeyVaultURL != "" {
-		return getTLSConfigFromKeyVault(tlsSettings, errChan)
+	source, err := newCertSource(ctx, tlsSettings)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, errors.Errorf("invalid tls settings: %+v", tlsSettings)
+	tlsConfig, err := newTLSConfig(source, tlsSettings)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		if err := source.Refresh(ctx); ctx.Err() == nil {
+			errChan <- err
+		}
+	}()
+	go certsource.MonitorExpiry(ctx, source, tlsSettings.CertificateExpiryWarningThreshold, logger.Log)
+
+	logger.Debugf("TLS configured successfully from %s: %+v", source.Name(), tlsSettings)
+	return tlsConfig, nil
+}
+
+// getSPIFFETLSConfig returns an mTLS config serving the X509-SVID of the SPIFFE Workload API configured in tlsSettings,
+// which only accepts the clients whose X509-SVID is verified by the SPIFFE trust bundles and has an allowed SPIFFE ID.
+// The SVID and the bundles are rotated by the Workload API until ctx is done.
+func getSPIFFETLSConfig(ctx context.Context, tlsSettings localtls.TlsSettings) (*tls.Config, error) {
+	minTLSVersionNumber, err := parseTLSVersionName(tlsSettings.MinTLSVersion)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing MinTLSVersion from config")
+	}
+
+	allowlist, err := spiffe.ParseAllowlist(tlsSettings.MtlsAllowedClientSPIFFEIDs)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing allowed client SPIFFE IDs from config")
+	}
+
+	fetchCtx, cancel := context.WithTimeout(ctx, spiffeFetchTimeout)
+	defer cancel()
+	source, err := spiffe.NewWorkloadAPISource(fetchCtx, tlsSettings.SPIFFEWorkloadAPIAddress)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create SPIFFE source")
+	}
+	go func() {
+		<-ctx.Done()
+		if err := source.Close(); err != nil {
+			logger.Errorf("Failed to close SPIFFE source: %v", err)
+		}
+	}()
+
+	tlsConfig := spiffe.ServerTLSConfig(source, allowlist)
+	tlsConfig.MinVersion = minTLSVersionNumber
+	tlsConfig.MaxVersion = tls.VersionTLS13
+
+	logger.Debugf("TLS configured successfully from SPIFFE workload API: %+v", tlsSettings)
+	return tlsConfig, nil
 }
 
 // verifyPeerCertificate verifies the client certificate's subject name matches the expected subject name.
@@ -204,46 +265,46 @@ func maskHalf(s string) string {
 	return s[:half] + strings.Repeat("*", n-half)
 }
 
-func getTLSConfigFromFile(tlsSettings localtls.TlsSettings) (*tls.Config, error) {
-	tlsCertRetriever, err := localtls.GetTlsCertificateRetriever(tlsSettings)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to get certificate retriever")
-	}
-
-	leafCertificate, err := tlsCertRetriever.GetCertificate()
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to get certificate")
+func newCertSource(ctx context.Context, tlsSettings localtls.TlsSettings) (certsource.Source, error) {
+	if tlsSettings.TLSCertificatePath != "" {
+		source, err := certsource.NewFileSource(tlsSettings, logger.Log)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not create certificate file source")
+		}
+		return source, nil
 	}
 
-	if leafCertificate == nil {
-		return nil, errors.New("certificate retrieval returned empty")
+	if tlsSettings.KeyVaultURL != "" {
+		source, err := certsource.NewKeyVaultSource(ctx, tlsSettings, logger.Log)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not create keyvault certificate source")
+		}
+		return source, nil
 	}
 
-	privateKey, err := tlsCertRetriever.GetPrivateKey()
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to get certificate private key")
-	}
+	return nil, errors.Errorf("invalid tls settings: %+v", tlsSettings)
+}
 
-	tlsCert := tls.Certificate{
-		Certificate: [][]byte{leafCertificate.Raw},
-		PrivateKey:  privateKey,
-		Leaf:        leafCertificate,
-	}
+// newTLSConfig returns a TLS config serving the latest certificate of source and, for mTLS, verifying clients against
+// the CAs of that certificate. Certificates, ClientCAs and RootCAs hold the initial certificate so that the config can
+// be used by clients too, servers get the latest ones from GetConfigForClient on each handshake.
+func newTLSConfig(source certsource.Source, tlsSettings localtls.TlsSettings) (*tls.Config, error) {
 	minTLSVersionNumber, err := parseTLSVersionName(tlsSettings.MinTLSVersion)
 	if err != nil {
 		return nil, errors.Wrap(err, "parsing MinTLSVersion from config")
 	}
 
+	tlsCert := source.GetCertificate()
 	tlsConfig := &tls.Config{
 		MaxVersion: tls.VersionTLS13,
 		MinVersion: minTLSVersionNumber,
 		Certificates: []tls.Certificate{
-			tlsCert,
+			*tlsCert,
 		},
 	}
 
 	if tlsSettings.UseMTLS {
-		rootCAs, err := mtlsRootCAsFromCertificate(&tlsCert)
+		rootCAs, err := mtlsRootCAsFromCertificate(tlsCert)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to get root CAs for configuring mTLS")
 		}
@@ -253,65 +314,77 @@ func getTLSConfigFromFile(tlsSettings localtls.TlsSettings) (*tls.Config, error)
 		tlsConfig.VerifyPeerCertificate = func(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
 			return verifyPeerCertificate(verifiedChains, tlsSettings.MtlsClientCertSubjectName)
 		}
+
+		// clients with workload identities are identified by the SPIFFE ID in their URI SAN rather than their subject
+		if len(tlsSettings.MtlsAllowedClientSPIFFEIDs) > 0 {
+			allowlist, err := spiffe.ParseAllowlist(tlsSettings.MtlsAllowedClientSPIFFEIDs)
+			if err != nil {
+				return nil, errors.Wrap(err, "parsing allowed client SPIFFE IDs from config")
+			}
+			tlsConfig.VerifyPeerCertificate = func(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+				return allowlist.VerifyChains(verifiedChains)
+			}
+		}
 	}
-	logger.Debugf("TLS configured successfully from file: %+v", tlsSettings)
 
+	r := &certRotator{
+		source:  source,
+		base:    tlsConfig.Clone(),
+		useMTLS: tlsSettings.UseMTLS,
+	}
+	tlsConfig.GetCertificate = r.GetCertificate
+	tlsConfig.GetConfigForClient = r.GetConfigForClient
 	return tlsConfig, nil
 }
 
-func getTLSConfigFromKeyVault(tlsSettings localtls.TlsSettings, errChan chan<- error) (*tls.Config, error) {
-	credOpts := azidentity.ManagedIdentityCredentialOptions{ID: azidentity.ResourceID(tlsSettings.MSIResourceID)}
-	cred, err := azidentity.NewManagedIdentityCredential(&credOpts)
-	if err != nil {
-		return nil, errors.Wrap(err, "could not create managed identity credential")
-	}
+// certRotator hot-swaps the certificate served by a TLS server, and the mTLS client CA pool derived from it,
+// as the certificate of its source is rotated.
+type certRotator struct {
+	source  certsource.Source
+	base    *tls.Config
+	useMTLS bool
 
-	kvs, err := keyvault.NewShim(tlsSettings.KeyVaultURL, cred)
-	if err != nil {
-		return nil, errors.Wrap(err, "could not create new keyvault shim")
-	}
+	m      sync.Mutex
+	cert   *tls.Certificate
+	config *tls.Config
+}
 
-	ctx := context.TODO()
+// GetCertificate returns the latest certificate of the source.
+func (r *certRotator) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.source.GetCertificate(), nil
+}
 
-	cr, err := keyvault.NewCertRefresher(ctx, kvs, logger.Log, tlsSettings.KeyVaultCertificateName)
-	if err != nil {
-		return nil, errors.Wrap(err, "could not create new cert refresher")
-	}
+// GetConfigForClient returns the config for the latest certificate of the source, which is rebuilt when the
+// certificate is rotated. If the client CA pool can't be built from a rotated certificate, the previous config is
+// kept.
+func (r *certRotator) GetConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	cert := r.source.GetCertificate()
 
-	go func() {
-		errChan <- cr.Refresh(ctx, tlsSettings.KeyVaultCertificateRefreshInterval)
-	}()
-
-	minTLSVersionNumber, err := parseTLSVersionName(tlsSettings.MinTLSVersion)
-	if err != nil {
-		return nil, errors.Wrap(err, "parsing MinTLSVersion from config")
-	}
+	r.m.Lock()
+	defer r.m.Unlock()
 
-	tlsConfig := tls.Config{
-		MinVersion: minTLSVersionNumber,
-		MaxVersion: tls.VersionTLS13,
-		GetCertificate: func(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
-			return cr.GetCertificate(), nil
-		},
+	if r.config != nil && cert == r.cert {
+		return r.config, nil
 	}
 
-	if tlsSettings.UseMTLS {
-		tlsCert := cr.GetCertificate()
-		rootCAs, err := mtlsRootCAsFromCertificate(tlsCert)
+	config := r.base.Clone()
+	config.Certificates = nil
+	config.GetCertificate = r.GetCertificate
+	if r.useMTLS {
+		rootCAs, err := mtlsRootCAsFromCertificate(cert)
 		if err != nil {
+			if r.config != nil {
+				logger.Errorf("Failed to get root CAs of the rotated certificate for mTLS, keeping the previous ones: %v", err)
+				return r.config, nil
+			}
 			return nil, errors.Wrap(err, "failed to get root CAs for configuring mTLS")
 		}
-		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
-		tlsConfig.ClientCAs = rootCAs
-		tlsConfig.RootCAs = rootCAs
-		tlsConfig.VerifyPeerCertificate = func(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
-			return verifyPeerCertificate(verifiedChains, tlsSettings.MtlsClientCertSubjectName)
-		}
+		config.ClientCAs = rootCAs
+		config.RootCAs = rootCAs
 	}
 
-	logger.Debugf("TLS configured successfully from KV: %+v", tlsSettings)
-
-	return &tlsConfig, nil
+	r.cert, r.config = cert, config
+	return config, nil
 }
 
 // Given a TLS cert, return the root CAs
@@ -364,6 +437,9 @@ func (service *Service) StartListener(config *common.ServiceConfig) error {
 
 // Uninitialize cleans up the plugin.
 func (service *Service) Uninitialize() {
+	if service.stopCertRefresh != nil {
+		service.stopCertRefresh()
+	}
 	service.Listener.Stop()
 	service.Service.Uninitialize()
 }
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+const adminTokenBytes = 32
+
+// writeAdminToken generates the token which authenticates requests to the CNS admin APIs,
+// and writes it to path so that only local users who can read the file can use them.
+// The token changes each time CNS starts.
+func writeAdminToken(path string) (string, error) {
+	b := make([]byte, adminTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed to generate admin token")
+	}
+	token := hex.EncodeToString(b)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { //nolint:gomnd // rwxr-xr-x
+		return "", errors.Wrapf(err, "failed to create directory of %s", path)
+	}
+	// write to a temp file and rename it, so that the token is never readable with the wrong permissions.
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create admin token file")
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck // best effort, the file is renamed on success
+	if _, err := tmp.WriteString(token); err != nil {
+		_ = tmp.Close()
+		return "", errors.Wrap(err, "failed to write admin token")
+	}
+	if err := tmp.Close(); err != nil {
+		return "", errors.Wrap(err, "failed to close admin token file")
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", errors.Wrapf(err, "failed to move admin token to %s", path)
+	}
+	return token, nil
+}
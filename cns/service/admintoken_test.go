@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteAdminToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run", "azure-cns-admin.token")
+
+	token, err := writeAdminToken(path)
+	require.NoError(t, err)
+	require.Len(t, token, 2*adminTokenBytes)
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, token, string(b))
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	}
+
+	// the token changes each time it is written
+	second, err := writeAdminToken(path)
+	require.NoError(t, err)
+	require.NotEqual(t, token, second)
+}
@@ -12,6 +12,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
@@ -25,6 +26,7 @@ import (
 	"github.com/Azure/azure-container-networking/cns/cniconflist"
 	"github.com/Azure/azure-container-networking/cns/common"
 	"github.com/Azure/azure-container-networking/cns/configuration"
+	"github.com/Azure/azure-container-networking/cns/debugbundle"
 	"github.com/Azure/azure-container-networking/cns/deviceplugin"
 	"github.com/Azure/azure-container-networking/cns/endpointmanager"
 	"github.com/Azure/azure-container-networking/cns/fsnotify"
@@ -39,6 +41,7 @@ import (
 	mtpncctrl "github.com/Azure/azure-container-networking/cns/kubecontroller/multitenantpodnetworkconfig"
 	nncctrl "github.com/Azure/azure-container-networking/cns/kubecontroller/nodenetworkconfig"
 	podctrl "github.com/Azure/azure-container-networking/cns/kubecontroller/pod"
+	"github.com/Azure/azure-container-networking/cns/kubeevents"
 	"github.com/Azure/azure-container-networking/cns/logger"
 	loggerv2 "github.com/Azure/azure-container-networking/cns/logger/v2"
 	"github.com/Azure/azure-container-networking/cns/metric"
@@ -66,6 +69,7 @@ import (
 	localtls "github.com/Azure/azure-container-networking/server/tls"
 	"github.com/Azure/azure-container-networking/store"
 	"github.com/Azure/azure-container-networking/telemetry"
+	"github.com/Azure/azure-container-networking/tracing"
 	"github.com/avast/retry-go/v4"
 	"github.com/go-logr/zapr"
 	"github.com/google/go-cmp/cmp"
@@ -115,6 +119,7 @@ const (
 	defaultDevicePluginMaxRetryCount = 5
 	initialVnetNICCount              = 0
 	initialIBNICCount                = 0
+	tracingShutdownTimeout           = 5 * time.Second
 )
 
 type cniConflistScenario string
@@ -495,6 +500,10 @@ func startTelemetryService(ctx context.Context) {
 
 // Main is the entry point for CNS.
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == validateConfigCommand {
+		os.Exit(validateConfig(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	// Initialize and parse command line arguments.
 	acn.ParseArgs(&args, printVersion)
 
@@ -566,6 +575,21 @@ func main() {
 		}
 	}
 	configuration.SetCNSConfigDefaults(cnsconfig)
+	// fail with all of the violations, rather than when the invalid fields are used.
+	if err := configuration.Validate(cnsconfig); err != nil {
+		logger.Errorf("fatal: %v", err)
+		os.Exit(1)
+	}
+	for _, w := range configuration.Warnings(cnsconfig) {
+		logger.Warnf("[Azure CNS] Config %s", w)
+	}
+
+	// The reloadable fields of the config file are applied to the running components when it changes.
+	configWatcher, err := configuration.NewWatcher(cmdLineConfigPath, cnsconfig)
+	if err != nil {
+		logger.Errorf("fatal: failed to create cns config watcher: %v", err)
+		os.Exit(1)
+	}
 
 	disableTelemetry := cnsconfig.TelemetrySettings.DisableAll
 	if !disableTelemetry {
@@ -586,12 +610,24 @@ func main() {
 			logger.InitAI(aiConfig, ts.DisableTrace, ts.DisableMetric, ts.DisableEvent)
 		}
 
-		if cnsconfig.TelemetrySettings.ConfigSnapshotIntervalInMins > 0 {
-			go metric.SendCNSConfigSnapshot(rootCtx, cnsconfig)
-		}
+		runReloadable(rootCtx, configWatcher,
+			func(old, updated *configuration.CNSConfig) bool {
+				return old.TelemetrySettings.ConfigSnapshotIntervalInMins != updated.TelemetrySettings.ConfigSnapshotIntervalInMins
+			},
+			func(ctx context.Context, config *configuration.CNSConfig) {
+				if config.TelemetrySettings.ConfigSnapshotIntervalInMins > 0 {
+					metric.SendCNSConfigSnapshot(ctx, config)
+				}
+			})
 	}
 	logger.Printf("[Azure CNS] Using config: %+v", cnsconfig)
 
+	shutdownTracing, err := tracing.Init(rootCtx, name, cnsconfig.Tracing)
+	if err != nil {
+		logger.Errorf("fatal: failed to initialize tracing: %v", err)
+		os.Exit(1)
+	}
+
 	_, envEnableConflistGeneration := os.LookupEnv(envVarEnableCNIConflistGeneration)
 	var conflistGenerator restserver.CNIConflistGenerator
 	if cnsconfig.EnableCNIConflistGeneration || envEnableConflistGeneration {
@@ -654,6 +690,14 @@ func main() {
 		logger.Printf("hotswapping logger v2") //nolint:staticcheck // ignore new deprecation
 		logger.Log = loggerv2.AsV1(z, c)
 	}
+	configWatcher.OnReload(func(old, updated *configuration.CNSConfig) {
+		if old.Logger.Level == updated.Logger.Level {
+			return
+		}
+		if err := cnsconfig.Logger.SetLevel(updated.Logger.Level); err != nil {
+			logger.Errorf("[Azure CNS] Failed to reload logger level: %v", err)
+		}
+	})
 
 	// start the healthz/readyz/metrics server
 	readyCh := make(chan any)
@@ -789,6 +833,10 @@ func main() {
 	httpRemoteRestService.SetOption(acn.OptProgramSNATIPTables, cnsconfig.ProgramSNATIPTables)
 	httpRemoteRestService.SetOption(acn.OptManageEndpointState, cnsconfig.ManageEndpointState)
 	httpRemoteRestService.SetOption(acn.OptEnableStaleHNSCleanupOnNCCreate, cnsconfig.EnableStaleHNSCleanupOnNCCreate)
+	configWatcher.OnReload(func(_, updated *configuration.CNSConfig) {
+		httpRemoteRestService.SetOption(acn.OptProgramSNATIPTables, updated.ProgramSNATIPTables)
+		httpRemoteRestService.SetOption(acn.OptEnableStaleHNSCleanupOnNCCreate, updated.EnableStaleHNSCleanupOnNCCreate)
+	})
 
 	// Create default ext network if commandline option is set
 	if len(strings.TrimSpace(createDefaultExtNetworkType)) > 0 {
@@ -814,6 +862,9 @@ func main() {
 				UseMTLS:                            cnsconfig.UseMTLS,
 				MinTLSVersion:                      cnsconfig.MinTLSVersion,
 				MtlsClientCertSubjectName:          cnsconfig.MtlsClientCertSubjectName,
+				CertificateExpiryWarningThreshold:  time.Duration(cnsconfig.TLSCertificateExpiryWarningDays) * 24 * time.Hour,
+				SPIFFEWorkloadAPIAddress:           cnsconfig.SPIFFESettings.WorkloadAPIAddress,
+				MtlsAllowedClientSPIFFEIDs:         cnsconfig.SPIFFESettings.AllowedClientIDs,
 			}
 		}
 
@@ -877,7 +928,7 @@ func main() {
 
 		logger.Printf("Set GlobalPodInfoScheme %v (InitializeFromCNI=%t)", cns.GlobalPodInfoScheme, cnsconfig.InitializeFromCNI)
 
-		err = InitializeCRDState(rootCtx, z, httpRemoteRestService, cnsconfig)
+		err = InitializeCRDState(rootCtx, z, httpRemoteRestService, cnsconfig, configWatcher)
 		if err != nil {
 			logger.Errorf("Failed to start CRD Controller, err:%v.\n", err)
 			return
@@ -927,7 +978,7 @@ func main() {
 	// Initialize multi-tenant controller if the CNS is running in MultiTenantCRD mode.
 	// It must be started before we start HTTPRemoteRestService.
 	if config.ChannelMode == cns.MultiTenantCRD {
-		err = InitializeMultiTenantController(rootCtx, httpRemoteRestService, *cnsconfig)
+		err = InitializeMultiTenantController(rootCtx, httpRemoteRestService, *cnsconfig, configWatcher)
 		if err != nil {
 			logger.Errorf("Failed to start multiTenantController, err:%v.\n", err)
 			return
@@ -1013,6 +1064,18 @@ func main() {
 			httpRemoteRestService.RegisterPProfEndpoints()
 		}
 
+		adminToken, tokenErr := writeAdminToken(cnsconfig.AdminTokenPath)
+		if tokenErr != nil {
+			// without a token, requests to the admin APIs are rejected
+			logger.Errorf("Failed to write admin token, admin APIs are disabled: %v", tokenErr)
+		}
+		httpRemoteRestService.RegisterLogLevelEndpoint(cnsconfig.Logger.Levels, adminToken)
+		cnsLogFile := log.LogPath + name + ".log"
+		if logDirectory != "" {
+			cnsLogFile = filepath.Join(logDirectory, name+".log")
+		}
+		httpRemoteRestService.RegisterPodDebugBundleEndpoint(debugbundle.DefaultConfig(cnsLogFile), adminToken)
+
 		err = httpRemoteRestService.Start(&config)
 		if err != nil {
 			logger.Errorf("Failed to start CNS, err:%v.\n", err)
@@ -1077,9 +1140,22 @@ func main() {
 	}
 
 	if !disableTelemetry {
-		go metric.SendHeartBeat(rootCtx, time.Minute*time.Duration(cnsconfig.TelemetrySettings.HeartBeatIntervalInMins), homeAzMonitor, cnsconfig.ChannelMode)
-		go httpRemoteRestService.SendNCSnapShotPeriodically(rootCtx, cnsconfig.TelemetrySettings.SnapshotIntervalInMins)
+		runReloadable(rootCtx, configWatcher,
+			func(old, updated *configuration.CNSConfig) bool {
+				return old.TelemetrySettings.HeartBeatIntervalInMins != updated.TelemetrySettings.HeartBeatIntervalInMins
+			},
+			func(ctx context.Context, config *configuration.CNSConfig) {
+				metric.SendHeartBeat(ctx, time.Minute*time.Duration(config.TelemetrySettings.HeartBeatIntervalInMins), homeAzMonitor, cnsconfig.ChannelMode)
+			})
+		runReloadable(rootCtx, configWatcher,
+			func(old, updated *configuration.CNSConfig) bool {
+				return old.TelemetrySettings.SnapshotIntervalInMins != updated.TelemetrySettings.SnapshotIntervalInMins
+			},
+			func(ctx context.Context, config *configuration.CNSConfig) {
+				httpRemoteRestService.SendNCSnapShotPeriodically(ctx, config.TelemetrySettings.SnapshotIntervalInMins)
+			})
 	}
+	go configWatcher.Watch(rootCtx)
 
 	// If CNS is running on managed DNC mode
 	if config.ChannelMode == cns.Managed {
@@ -1147,6 +1223,13 @@ func main() {
 		logger.Errorf("lockclient cns unlock error:%v", err)
 	}
 
+	// rootCtx is already cancelled, so give the exporter a moment to flush buffered spans.
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	if err = shutdownTracing(shutdownCtx); err != nil {
+		logger.Errorf("failed to shut down tracing: %v", err)
+	}
+	cancelShutdown()
+
 	logger.Printf("CNS exited")
 	logger.Close()
 }
@@ -1236,7 +1319,7 @@ func pollNodeInfoCRDAndUpdatePlugin(ctx context.Context, zlog *zap.Logger, plugi
 	}
 }
 
-func InitializeMultiTenantController(ctx context.Context, httpRestService cns.HTTPService, cnsconfig configuration.CNSConfig) error {
+func InitializeMultiTenantController(ctx context.Context, httpRestService cns.HTTPService, cnsconfig configuration.CNSConfig, configWatcher *configuration.Watcher) error {
 	var multiTenantController multitenantcontroller.RequestController
 	kubeConfig, err := ctrl.GetConfig()
 	kubeConfig.UserAgent = fmt.Sprintf("azure-cns-%s", version)
@@ -1291,20 +1374,8 @@ func InitializeMultiTenantController(ctx context.Context, httpRestService cns.HT
 
 	// TODO: do we need this to be running?
 	logger.Printf("Starting SyncHostNCVersion")
-	go func() {
-		// Periodically poll vfp programmed NC version from NMAgent
-		tickerChannel := time.Tick(time.Duration(cnsconfig.SyncHostNCVersionIntervalMs) * time.Millisecond)
-		for {
-			select {
-			case <-tickerChannel:
-				timedCtx, cancel := context.WithTimeout(ctx, time.Duration(cnsconfig.SyncHostNCVersionIntervalMs)*time.Millisecond)
-				httpRestServiceImpl.SyncHostNCVersion(timedCtx, cnsconfig.ChannelMode)
-				cancel()
-			case <-ctx.Done():
-				return
-			}
-		}
-	}()
+	// Periodically poll vfp programmed NC version from NMAgent
+	go syncHostNCVersionPeriodically(ctx, configWatcher, httpRestServiceImpl, cnsconfig.ChannelMode)
 
 	return nil
 }
@@ -1365,7 +1436,7 @@ func reconcileInitialCNSState(
 // InitializeCRDState builds and starts the CRD controllers.
 //
 //nolint:gocyclo // legacy
-func InitializeCRDState(ctx context.Context, z *zap.Logger, httpRestService cns.HTTPService, cnsconfig *configuration.CNSConfig) error {
+func InitializeCRDState(ctx context.Context, z *zap.Logger, httpRestService cns.HTTPService, cnsconfig *configuration.CNSConfig, configWatcher *configuration.Watcher) error {
 	// convert interface type to implementation type
 	httpRestServiceImplementation, ok := httpRestService.(*restserver.HTTPRestService)
 	if !ok {
@@ -1500,6 +1571,18 @@ func InitializeCRDState(ctx context.Context, z *zap.Logger, httpRestService cns.
 		return errors.Wrap(err, "failed to create manager")
 	}
 
+	var kubeEvents *kubeevents.Recorder
+	if cnsconfig.EnableKubeEvents {
+		// the cached client only has the Pods of the Node if they are watched, otherwise it would watch all the Pods.
+		var pods client.Reader = manager.GetAPIReader()
+		if cnsconfig.WatchPods {
+			pods = manager.GetClient()
+		}
+		broadcaster := kubeevents.NewBroadcaster(clientset.CoreV1().Events(""))
+		kubeEvents = kubeevents.NewRecorder(broadcaster.NewRecorder(scheme, corev1.EventSource{Component: kubeevents.Component, Host: nodeName}), pods, nodeName)
+		httpRestServiceImplementation.AttachKubeEventRecorder(kubeEvents)
+	}
+
 	// this cachedscopedclient is built using the Manager's cached client, which is
 	// NOT SAFE TO USE UNTIL THE MANAGER IS STARTED!
 	// This is okay because it is only used to build the IPAMPoolMonitor, which does not
@@ -1533,7 +1616,13 @@ func InitializeCRDState(ctx context.Context, z *zap.Logger, httpRestService cns.
 
 	// get CNS Node IP to compare NC Node IP with this Node IP to ensure NCs were created for this node
 	nodeIP := configuration.NodeIP()
-	nncReconciler := nncctrl.NewReconciler(httpRestServiceImplementation, initializerWrapper, poolMonitor, nodeIP, cnsconfig.EnableSwiftV2, cnsconfig.IPv6PrefixClamp)
+	var ncStatusWriter *nncctrl.StatusWriter
+	if cnsconfig.EnableNCStatusReporting {
+		ncStatusWriter = nncctrl.NewStatusWriter(httpRestServiceImplementation, cachedscopedcli, nodeIP, nncctrl.DefaultStatusWriteDebounce)
+	}
+	nncReconciler := nncctrl.NewReconciler(httpRestServiceImplementation, initializerWrapper, poolMonitor, nodeIP, cnsconfig.EnableSwiftV2, cnsconfig.IPv6PrefixClamp).
+		WithEventRecorder(kubeEvents).
+		WithStatusWriter(ncStatusWriter)
 	// pass Node to the Reconciler for Controller xref
 	// IPAMv1 - reconcile only status changes (where generation doesn't change).
 	// IPAMv2 - reconcile all updates.
@@ -1544,7 +1633,7 @@ func InitializeCRDState(ctx context.Context, z *zap.Logger, httpRestService cns.
 
 	if cnsconfig.EnableSubnetScarcity {
 		// ClusterSubnetState reconciler
-		cssReconciler := cssctrl.New(cssCh)
+		cssReconciler := cssctrl.New(cssCh).WithEventRecorder(kubeEvents)
 		if err := cssReconciler.SetupWithManager(manager); err != nil {
 			return errors.Wrapf(err, "failed to setup css reconciler with manager")
 		}
@@ -1617,22 +1706,19 @@ func InitializeCRDState(ctx context.Context, z *zap.Logger, httpRestService cns.
 		break
 	}
 
-	go func() {
-		logger.Printf("Starting SyncHostNCVersion loop.")
-		// Periodically poll vfp programmed NC version from NMAgent
-		tickerChannel := time.Tick(time.Duration(cnsconfig.SyncHostNCVersionIntervalMs) * time.Millisecond)
-		for {
-			select {
-			case <-tickerChannel:
-				timedCtx, cancel := context.WithTimeout(ctx, time.Duration(cnsconfig.SyncHostNCVersionIntervalMs)*time.Millisecond)
-				httpRestServiceImplementation.SyncHostNCVersion(timedCtx, cnsconfig.ChannelMode)
-				cancel()
-			case <-ctx.Done():
-				logger.Printf("Stopping SyncHostNCVersion loop.")
-				return
+	if ncStatusWriter != nil {
+		// the status writer uses the Manager's cached client, so it is only started once the Reconciler has.
+		go func() {
+			logger.Printf("Starting NC status writer.")
+			if err := ncStatusWriter.Start(ctx); err != nil {
+				logger.Printf("Stopped NC status writer: %v", err)
 			}
-		}
-	}()
+		}()
+	}
+
+	logger.Printf("Starting SyncHostNCVersion loop.")
+	// Periodically poll vfp programmed NC version from NMAgent
+	go syncHostNCVersionPeriodically(ctx, configWatcher, httpRestServiceImplementation, cnsconfig.ChannelMode)
 	logger.Printf("Initialized SyncHostNCVersion loop.")
 	return nil
 }
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns/configuration"
+	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/restserver"
+)
+
+// runReloadable runs run with the current config, and restarts it with the reloaded config when changed reports
+// that a field it depends on changed. It stops when ctx is done.
+func runReloadable(
+	ctx context.Context,
+	configWatcher *configuration.Watcher,
+	changed func(old, updated *configuration.CNSConfig) bool,
+	run func(ctx context.Context, config *configuration.CNSConfig),
+) {
+	// the handlers of the watcher are called sequentially, so cancel doesn't need to be synchronized.
+	runCtx, cancel := context.WithCancel(ctx)
+	go run(runCtx, configWatcher.Current())
+	configWatcher.OnReload(func(old, updated *configuration.CNSConfig) {
+		if !changed(old, updated) {
+			return
+		}
+		cancel()
+		runCtx, cancel = context.WithCancel(ctx)
+		go run(runCtx, updated)
+	})
+}
+
+// syncHostNCVersionPeriodically polls the NC versions programmed by NMAgent at the SyncHostNCVersionIntervalMs of the
+// current config, so that a reloaded interval applies from the next poll. It stops when ctx is done.
+func syncHostNCVersionPeriodically(ctx context.Context, configWatcher *configuration.Watcher, service *restserver.HTTPRestService, channelMode string) {
+	for {
+		interval := time.Duration(configWatcher.Current().SyncHostNCVersionIntervalMs) * time.Millisecond
+		select {
+		case <-time.After(interval):
+			timedCtx, cancel := context.WithTimeout(ctx, interval)
+			service.SyncHostNCVersion(timedCtx, channelMode)
+			cancel()
+		case <-ctx.Done():
+			logger.Printf("Stopping SyncHostNCVersion loop.")
+			return
+		}
+	}
+}
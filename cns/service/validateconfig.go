@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/Azure/azure-container-networking/cns/configuration"
+	"github.com/pkg/errors"
+)
+
+// validateConfigCommand validates a config file without starting CNS, e.g. before rolling it out.
+const validateConfigCommand = "validate-config"
+
+// validateConfig runs the validate-config command with its args, and returns the exit code. It prints every
+// violation and warning of the config file, or the JSON Schema of the config file with -schema.
+func validateConfig(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet(validateConfigCommand, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	printSchema := fs.Bool("schema", false, "Print the JSON Schema of the config file instead of validating it")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s %s [-schema] [config file]\n", name, validateConfigCommand)
+		fmt.Fprintf(stderr, "The config file defaults to $%s, or %s next to %s.\n", configuration.EnvCNSConfig, "cns_config.json", name)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2 //nolint:gomnd // usage error
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return 2 //nolint:gomnd // usage error
+	}
+
+	if *printSchema {
+		b, err := configuration.MarshalSchema()
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		_, _ = stdout.Write(b)
+		return 0
+	}
+
+	warnings, err := configuration.ValidateFile(fs.Arg(0))
+	for _, w := range warnings {
+		fmt.Fprintf(stdout, "warning: %s\n", w)
+	}
+	var validationErr *configuration.ValidationError
+	if errors.As(err, &validationErr) {
+		for _, v := range validationErr.Violations {
+			fmt.Fprintln(stdout, v)
+		}
+		fmt.Fprintf(stderr, "config is invalid, %d violation(s)\n", len(validationErr.Violations))
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	fmt.Fprintln(stdout, "config is valid")
+	return 0
+}
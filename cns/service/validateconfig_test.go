@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateConfig(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.json")
+	require.NoError(t, os.WriteFile(valid, []byte(`{"ChannelMode": "AzureHost", "ManageEndpointState": true, "EnableIPAMv2": true}`), 0o600))
+	invalid := filepath.Join(dir, "invalid.json")
+	require.NoError(t, os.WriteFile(invalid, []byte(`{"ChannelMode": "AzureHost", "UseMTLS": true, "Typo": true}`), 0o600))
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStdout string
+	}{
+		{
+			name:       "valid",
+			args:       []string{valid},
+			wantStdout: "warning: EnableIPAMv2: is ignored outside ChannelMode CRD\nconfig is valid\n",
+		},
+		{
+			name:       "invalid",
+			args:       []string{invalid},
+			wantCode:   1,
+			wantStdout: "Typo: is not a config field\nManageEndpointState: must be true in ChannelMode AzureHost\nUseMTLS: requires UseHTTPS\n",
+		},
+		{
+			name:     "missing",
+			args:     []string{filepath.Join(dir, "missing.json")},
+			wantCode: 1,
+		},
+		{
+			name:     "usage",
+			args:     []string{valid, invalid},
+			wantCode: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			require.Equal(t, tt.wantCode, validateConfig(tt.args, &stdout, &stderr), stderr.String())
+			require.Equal(t, tt.wantStdout, stdout.String())
+		})
+	}
+}
+
+func TestValidateConfigSchema(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	require.Equal(t, 0, validateConfig([]string{"-schema"}, &stdout, &stderr))
+	var schema map[string]any
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &schema))
+	require.Equal(t, "object", schema["type"])
+}
@@ -14,16 +14,24 @@ import (
 	"encoding/pem"
 	"math/big"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/Azure/azure-container-networking/cns/certsource"
 	"github.com/Azure/azure-container-networking/cns/common"
 	"github.com/Azure/azure-container-networking/cns/logger"
+	"github.com/Azure/azure-container-networking/cns/spiffe"
+	"github.com/Azure/azure-container-networking/cns/spiffe/spiffetest"
 	acn "github.com/Azure/azure-container-networking/common"
 	serverTLS "github.com/Azure/azure-container-networking/server/tls"
 	"github.com/Azure/azure-container-networking/store"
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -193,7 +201,9 @@ func TestNewService(t *testing.T) {
 				err = svc.StartListener(config)
 				require.NoError(t, err)
 
-				mTLSConfig, err := getTLSConfigFromFile(config.TLSSettings)
+				source, err := certsource.NewFileSource(config.TLSSettings, logger.Log)
+				require.NoError(t, err)
+				mTLSConfig, err := newTLSConfig(source, config.TLSSettings)
 				require.NoError(t, err)
 
 				client := &http.Client{
@@ -382,6 +392,210 @@ func createTestCertificate(t *testing.T) string {
 	return testCertFilePath
 }
 
+type fakeCertSource struct {
+	m    sync.Mutex
+	cert *tls.Certificate
+}
+
+func (f *fakeCertSource) GetCertificate() *tls.Certificate {
+	f.m.Lock()
+	defer f.m.Unlock()
+	return f.cert
+}
+
+func (f *fakeCertSource) setCertificate(cert *tls.Certificate) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.cert = cert
+}
+
+func (f *fakeCertSource) Refresh(context.Context) error { return nil }
+
+func (f *fakeCertSource) Name() string { return "fake" }
+
+func loadTestCertificate(t *testing.T) *tls.Certificate {
+	t.Helper()
+	source, err := certsource.NewFileSource(serverTLS.TlsSettings{TLSCertificatePath: createTestCertificate(t)}, logger.Log)
+	require.NoError(t, err)
+	return source.GetCertificate()
+}
+
+func TestTLSConfigRotatesCertificate(t *testing.T) {
+	logger.InitLogger("azure-cns.log", 0, 0, "/")
+	first, second := loadTestCertificate(t), loadTestCertificate(t)
+	source := &fakeCertSource{cert: first}
+
+	tlsConfig, err := newTLSConfig(source, serverTLS.TlsSettings{MinTLSVersion: "TLS 1.2"})
+	require.NoError(t, err)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_ = conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}()
+		}
+	}()
+
+	servedCertificate := func() *x509.Certificate {
+		// #nosec G402 for test purposes only
+		conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{InsecureSkipVerify: true, MinVersion: tls.VersionTLS12})
+		require.NoError(t, err)
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0]
+	}
+
+	require.True(t, servedCertificate().Equal(first.Leaf))
+	source.setCertificate(second)
+	require.True(t, servedCertificate().Equal(second.Leaf), "rotated certificate is served without restarting the listener")
+}
+
+func TestTLSConfigRotatesClientCAs(t *testing.T) {
+	logger.InitLogger("azure-cns.log", 0, 0, "/")
+	first, second := loadTestCertificate(t), loadTestCertificate(t)
+	source := &fakeCertSource{cert: first}
+
+	tlsConfig, err := newTLSConfig(source, serverTLS.TlsSettings{MinTLSVersion: "TLS 1.2", UseMTLS: true})
+	require.NoError(t, err)
+	require.Equal(t, tls.RequireAndVerifyClientCert, tlsConfig.ClientAuth)
+
+	firstConfig, err := tlsConfig.GetConfigForClient(nil)
+	require.NoError(t, err)
+	firstCAs, err := mtlsRootCAsFromCertificate(first)
+	require.NoError(t, err)
+	require.True(t, firstConfig.ClientCAs.Equal(firstCAs))
+	require.NotNil(t, firstConfig.VerifyPeerCertificate)
+
+	sameConfig, err := tlsConfig.GetConfigForClient(nil)
+	require.NoError(t, err)
+	require.Same(t, firstConfig, sameConfig, "config is only rebuilt when the certificate is rotated")
+
+	source.setCertificate(second)
+	secondConfig, err := tlsConfig.GetConfigForClient(nil)
+	require.NoError(t, err)
+	secondCAs, err := mtlsRootCAsFromCertificate(second)
+	require.NoError(t, err)
+	require.True(t, secondConfig.ClientCAs.Equal(secondCAs))
+	served, err := secondConfig.GetCertificate(nil)
+	require.NoError(t, err)
+	require.Same(t, second, served)
+
+	source.setCertificate(&tls.Certificate{Certificate: [][]byte{[]byte("invalid")}})
+	keptConfig, err := tlsConfig.GetConfigForClient(nil)
+	require.NoError(t, err)
+	require.Same(t, secondConfig, keptConfig, "client CAs are kept when they can't be built from the rotated certificate")
+}
+
+func TestTLSConfigVerifiesClientSPIFFEID(t *testing.T) {
+	logger.InitLogger("azure-cns.log", 0, 0, "/")
+	source := &fakeCertSource{cert: loadTestCertificate(t)}
+
+	tlsConfig, err := newTLSConfig(source, serverTLS.TlsSettings{
+		MinTLSVersion:              "TLS 1.2",
+		UseMTLS:                    true,
+		MtlsClientCertSubjectName:  "example.com",
+		MtlsAllowedClientSPIFFEIDs: []string{"spiffe://example.org/ns/kube-system/*"},
+	})
+	require.NoError(t, err)
+
+	clientCert := func(uri string) [][]*x509.Certificate {
+		u, err := url.Parse(uri)
+		require.NoError(t, err)
+		return [][]*x509.Certificate{{{URIs: []*url.URL{u}, DNSNames: []string{"example.com"}}}}
+	}
+	require.NoError(t, tlsConfig.VerifyPeerCertificate(nil, clientCert("spiffe://example.org/ns/kube-system/sa/dnc")))
+	require.ErrorIs(t, tlsConfig.VerifyPeerCertificate(nil, clientCert("spiffe://example.org/ns/default/sa/dnc")), spiffe.ErrNotAllowed,
+		"the SPIFFE allowlist replaces the subject name")
+
+	_, err = newTLSConfig(source, serverTLS.TlsSettings{
+		MinTLSVersion:              "TLS 1.2",
+		UseMTLS:                    true,
+		MtlsAllowedClientSPIFFEIDs: []string{"example.org"},
+	})
+	require.Error(t, err)
+}
+
+func TestGetSPIFFETLSConfig(t *testing.T) {
+	logger.InitLogger("azure-cns.log", 0, 0, "/")
+	trustDomain := spiffeid.RequireTrustDomainFromString("example.org")
+	ca := spiffetest.NewCA(t, trustDomain)
+	cnsID := spiffeid.RequireFromPath(trustDomain, "/ns/kube-system/sa/azure-cns")
+	workloadAPI := spiffetest.NewWorkloadAPI(t)
+	workloadAPI.SetX509SVID(t, ca.CreateX509SVID(t, cnsID), ca.Bundle())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	tlsConfig, err := getTLSConfig(ctx, serverTLS.TlsSettings{
+		MinTLSVersion:              "TLS 1.2",
+		UseMTLS:                    true,
+		SPIFFEWorkloadAPIAddress:   workloadAPI.Addr(),
+		MtlsAllowedClientSPIFFEIDs: []string{"spiffe://example.org/ns/kube-system/*"},
+	}, make(chan error, 1))
+	require.NoError(t, err)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_ = conn.(*tls.Conn).Handshake()
+				_, _ = conn.Write([]byte("ok"))
+				conn.Close()
+			}()
+		}
+	}()
+
+	cnsAllowlist, err := spiffe.ParseAllowlist([]string{cnsID.String()})
+	require.NoError(t, err)
+	connect := func(clientID spiffeid.ID) error {
+		source := &staticSPIFFESource{svid: ca.CreateX509SVID(t, clientID), bundle: ca.Bundle()}
+		conn, err := tls.Dial("tcp", listener.Addr().String(), spiffe.ClientTLSConfig(source, cnsAllowlist))
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		// with TLS 1.3, the server verifies the client certificate after the client handshake completes
+		_, err = conn.Read(make([]byte, 2))
+		return err
+	}
+
+	require.NoError(t, connect(spiffeid.RequireFromPath(trustDomain, "/ns/kube-system/sa/dnc")))
+	require.Error(t, connect(spiffeid.RequireFromPath(trustDomain, "/ns/default/sa/app")))
+}
+
+func TestGetSPIFFETLSConfigRequiresAllowlist(t *testing.T) {
+	_, err := getTLSConfig(context.Background(), serverTLS.TlsSettings{
+		MinTLSVersion:            "TLS 1.2",
+		UseMTLS:                  true,
+		SPIFFEWorkloadAPIAddress: "unix:///run/spire/sockets/agent.sock",
+	}, make(chan error, 1))
+	require.ErrorIs(t, err, spiffe.ErrEmptyAllowlist)
+}
+
+// staticSPIFFESource is a spiffe.Source with a fixed X509-SVID and bundle
+type staticSPIFFESource struct {
+	svid   *x509svid.SVID
+	bundle *x509bundle.Bundle
+}
+
+func (s *staticSPIFFESource) GetX509SVID() (*x509svid.SVID, error) { return s.svid, nil }
+
+func (s *staticSPIFFESource) GetX509BundleForTrustDomain(td spiffeid.TrustDomain) (*x509bundle.Bundle, error) {
+	return s.bundle.GetX509BundleForTrustDomain(td) //nolint:wrapcheck // test
+}
+
 func TestTLSVersionNumber(t *testing.T) {
 	t.Run("unsupported ServerSettings.MinTLSVersion TLS 1.0", func(t *testing.T) {
 		versionNumber, err := parseTLSVersionName("TLS 1.0")
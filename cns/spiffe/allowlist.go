@@ -0,0 +1,103 @@
+// Package spiffe authenticates CNS servers and clients with SPIFFE X509-SVIDs, matching the SPIFFE IDs in the URI SAN
+// of their certificates against an allowlist rather than a fixed subject name.
+package spiffe
+
+import (
+	"crypto/x509"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/spiffetls/tlsconfig"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+)
+
+const wildcardSuffix = "/*"
+
+var (
+	ErrEmptyAllowlist = errors.New("no SPIFFE IDs allowed")
+	ErrNotAllowed     = errors.New("SPIFFE ID not allowed")
+)
+
+// Allowlist is the list of the SPIFFE IDs allowed to authenticate. Its entries are either:
+//   - a trust domain, "spiffe://example.org", which allows all the IDs of the trust domain
+//   - an ID, "spiffe://example.org/ns/kube-system/sa/dnc", which allows only this ID
+//   - a path ending with "/*", "spiffe://example.org/ns/kube-system/*", which allows the IDs under the path
+type Allowlist struct {
+	entries []allowlistEntry
+}
+
+type allowlistEntry struct {
+	trustDomain spiffeid.TrustDomain
+	// path is empty for trust domain entries
+	path   string
+	prefix bool
+}
+
+// ParseAllowlist parses the entries of an Allowlist.
+func ParseAllowlist(entries []string) (*Allowlist, error) {
+	if len(entries) == 0 {
+		return nil, ErrEmptyAllowlist
+	}
+
+	a := &Allowlist{entries: make([]allowlistEntry, 0, len(entries))}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry, "spiffe://") {
+			return nil, errors.Errorf("invalid allowlist entry %q: missing spiffe:// scheme", entry)
+		}
+
+		prefix := strings.HasSuffix(entry, wildcardSuffix)
+		id, err := spiffeid.FromString(strings.TrimSuffix(entry, wildcardSuffix))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid allowlist entry %q", entry)
+		}
+		if prefix && id.Path() == "" {
+			// spiffe://example.org/* is the same as spiffe://example.org
+			prefix = false
+		}
+		a.entries = append(a.entries, allowlistEntry{trustDomain: id.TrustDomain(), path: id.Path(), prefix: prefix})
+	}
+	return a, nil
+}
+
+// Match returns nil if id is allowed, and an error wrapping ErrNotAllowed otherwise. It is a spiffeid.Matcher.
+func (a *Allowlist) Match(id spiffeid.ID) error {
+	for _, entry := range a.entries {
+		if entry.matches(id) {
+			return nil
+		}
+	}
+	return errors.Wrapf(ErrNotAllowed, "%s", id)
+}
+
+func (e *allowlistEntry) matches(id spiffeid.ID) bool {
+	switch {
+	case !id.MemberOf(e.trustDomain):
+		return false
+	case e.path == "":
+		return true
+	case e.prefix:
+		return strings.HasPrefix(id.Path(), e.path+"/")
+	default:
+		return id.Path() == e.path
+	}
+}
+
+// Authorizer returns the tlsconfig.Authorizer of the Allowlist, for configs authenticating peers with SPIFFE bundles.
+func (a *Allowlist) Authorizer() tlsconfig.Authorizer {
+	return tlsconfig.AdaptMatcher(a.Match)
+}
+
+// VerifyChains checks that the SPIFFE ID of the leaf of the chains verified by crypto/tls is allowed,
+// for configs authenticating peers with CA pools rather than SPIFFE bundles.
+func (a *Allowlist) VerifyChains(verifiedChains [][]*x509.Certificate) error {
+	if len(verifiedChains) == 0 || len(verifiedChains[0]) == 0 {
+		return errors.New("no peer certificate provided during mTLS")
+	}
+
+	id, err := x509svid.IDFromCert(verifiedChains[0][0])
+	if err != nil {
+		return errors.Wrap(err, "failed to get SPIFFE ID of peer certificate")
+	}
+	return a.Match(id)
+}
@@ -0,0 +1,87 @@
+package spiffe
+
+import (
+	"crypto/x509"
+	"net/url"
+	"testing"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAllowlist(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		wantErr bool
+	}{
+		{name: "trust domain", entries: []string{"spiffe://example.org"}},
+		{name: "id and path prefix", entries: []string{"spiffe://example.org/ns/kube-system/sa/dnc", "spiffe://example.org/ns/default/*"}},
+		{name: "empty", entries: nil, wantErr: true},
+		{name: "missing scheme", entries: []string{"example.org"}, wantErr: true},
+		{name: "other scheme", entries: []string{"https://example.org/foo"}, wantErr: true},
+		{name: "invalid trust domain", entries: []string{"spiffe://Example.org"}, wantErr: true},
+		{name: "invalid path", entries: []string{"spiffe://example.org/foo/"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseAllowlist(tt.entries)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestAllowlistMatch(t *testing.T) {
+	allowlist, err := ParseAllowlist([]string{
+		"spiffe://trusted.org",
+		"spiffe://example.org/ns/kube-system/sa/dnc",
+		"spiffe://example.org/ns/default/*",
+		"spiffe://wildcard.org/*",
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		id      string
+		allowed bool
+	}{
+		{id: "spiffe://trusted.org/anything", allowed: true},
+		{id: "spiffe://example.org/ns/kube-system/sa/dnc", allowed: true},
+		{id: "spiffe://example.org/ns/kube-system/sa/dnc/child", allowed: false},
+		{id: "spiffe://example.org/ns/kube-system/sa/other", allowed: false},
+		{id: "spiffe://example.org/ns/default/sa/app", allowed: true},
+		{id: "spiffe://example.org/ns/default", allowed: false},
+		{id: "spiffe://example.org/ns/defaults/sa/app", allowed: false},
+		{id: "spiffe://wildcard.org/foo", allowed: true},
+		{id: "spiffe://untrusted.org/ns/default/sa/app", allowed: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			err := allowlist.Match(spiffeid.RequireFromString(tt.id))
+			if tt.allowed {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, ErrNotAllowed)
+		})
+	}
+}
+
+func TestAllowlistVerifyChains(t *testing.T) {
+	allowlist, err := ParseAllowlist([]string{"spiffe://example.org/ns/kube-system/*"})
+	require.NoError(t, err)
+
+	certWithURI := func(uri string) *x509.Certificate {
+		u, err := url.Parse(uri)
+		require.NoError(t, err)
+		return &x509.Certificate{URIs: []*url.URL{u}}
+	}
+
+	require.NoError(t, allowlist.VerifyChains([][]*x509.Certificate{{certWithURI("spiffe://example.org/ns/kube-system/sa/dnc")}}))
+	require.ErrorIs(t, allowlist.VerifyChains([][]*x509.Certificate{{certWithURI("spiffe://example.org/ns/default/sa/dnc")}}), ErrNotAllowed)
+	require.Error(t, allowlist.VerifyChains([][]*x509.Certificate{{{}}}), "certificates without a SPIFFE ID are rejected")
+	require.Error(t, allowlist.VerifyChains(nil))
+}
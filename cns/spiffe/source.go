@@ -0,0 +1,44 @@
+package spiffe
+
+import (
+	"context"
+	"crypto/tls"
+
+	"github.com/pkg/errors"
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffetls/tlsconfig"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+	"github.com/spiffe/go-spiffe/v2/workloadapi"
+)
+
+// Source provides the X509-SVID a workload authenticates with, and the X.509 bundles it authenticates its peers with.
+type Source interface {
+	x509svid.Source
+	x509bundle.Source
+}
+
+// NewWorkloadAPISource connects to the SPIFFE Workload API at address, such as unix:///run/spire/sockets/agent.sock,
+// and blocks until it receives the first X509-SVID and bundles. The source follows their rotations until it is closed.
+func NewWorkloadAPISource(ctx context.Context, address string) (*workloadapi.X509Source, error) {
+	source, err := workloadapi.NewX509Source(ctx, workloadapi.WithClientOptions(workloadapi.WithAddr(address)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch X509-SVID from workload API %s", address)
+	}
+	return source, nil
+}
+
+// ServerTLSConfig returns the mTLS config of a server which presents the X509-SVID of source,
+// and only accepts the clients whose X509-SVID is verified by the bundles of source and allowed by allowlist.
+func ServerTLSConfig(source Source, allowlist *Allowlist) *tls.Config {
+	config := tlsconfig.MTLSServerConfig(source, source, allowlist.Authorizer())
+	config.MinVersion = tls.VersionTLS12
+	return config
+}
+
+// ClientTLSConfig returns the mTLS config of a client which presents the X509-SVID of source,
+// and only accepts the servers whose X509-SVID is verified by the bundles of source and allowed by allowlist.
+func ClientTLSConfig(source Source, allowlist *Allowlist) *tls.Config {
+	config := tlsconfig.MTLSClientConfig(source, source, allowlist.Authorizer())
+	config.MinVersion = tls.VersionTLS12
+	return config
+}
@@ -0,0 +1,158 @@
+package spiffe_test
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns/spiffe"
+	"github.com/Azure/azure-container-networking/cns/spiffe/spiffetest"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	trustDomain = spiffeid.RequireTrustDomainFromString("example.org")
+	serverID    = spiffeid.RequireFromPath(trustDomain, "/ns/kube-system/sa/azure-cns")
+	clientID    = spiffeid.RequireFromPath(trustDomain, "/ns/kube-system/sa/dnc")
+)
+
+// startServer starts an HTTPS server authenticating with the X509-SVID served by workloadAPI
+func startServer(t *testing.T, workloadAPI *spiffetest.WorkloadAPI, allowedClients ...string) string {
+	t.Helper()
+	source, err := spiffe.NewWorkloadAPISource(context.Background(), workloadAPI.Addr())
+	require.NoError(t, err)
+	t.Cleanup(func() { source.Close() })
+	allowlist, err := spiffe.ParseAllowlist(allowedClients)
+	require.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	// StartTLS would replace the SVID with the certificate of httptest
+	server.Listener = tls.NewListener(server.Listener, spiffe.ServerTLSConfig(source, allowlist))
+	server.Start()
+	t.Cleanup(server.Close)
+	return "https://" + server.Listener.Addr().String()
+}
+
+// newClient returns an HTTPS client authenticating with the X509-SVID served by workloadAPI
+func newClient(t *testing.T, workloadAPI *spiffetest.WorkloadAPI, allowedServers ...string) *http.Client {
+	t.Helper()
+	source, err := spiffe.NewWorkloadAPISource(context.Background(), workloadAPI.Addr())
+	require.NoError(t, err)
+	t.Cleanup(func() { source.Close() })
+	allowlist, err := spiffe.ParseAllowlist(allowedServers)
+	require.NoError(t, err)
+
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: spiffe.ClientTLSConfig(source, allowlist)},
+	}
+}
+
+func get(client *http.Client, url string) error {
+	resp, err := client.Get(url) //nolint:noctx // test
+	if err != nil {
+		return err //nolint:wrapcheck // test
+	}
+	return resp.Body.Close() //nolint:wrapcheck // test
+}
+
+func TestMTLS(t *testing.T) {
+	ca := spiffetest.NewCA(t, trustDomain)
+	serverAPI := spiffetest.NewWorkloadAPI(t)
+	serverAPI.SetX509SVID(t, ca.CreateX509SVID(t, serverID), ca.Bundle())
+	clientAPI := spiffetest.NewWorkloadAPI(t)
+	clientAPI.SetX509SVID(t, ca.CreateX509SVID(t, clientID), ca.Bundle())
+
+	tests := []struct {
+		name           string
+		allowedClients []string
+		allowedServers []string
+		wantErr        bool
+	}{
+		{
+			name:           "allowed",
+			allowedClients: []string{"spiffe://example.org/ns/kube-system/*"},
+			allowedServers: []string{serverID.String()},
+		},
+		{
+			name:           "client not allowed",
+			allowedClients: []string{"spiffe://example.org/ns/default/*"},
+			allowedServers: []string{serverID.String()},
+			wantErr:        true,
+		},
+		{
+			name:           "server not allowed",
+			allowedClients: []string{"spiffe://example.org"},
+			allowedServers: []string{"spiffe://other.org"},
+			wantErr:        true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startServer(t, serverAPI, tt.allowedClients...)
+			client := newClient(t, clientAPI, tt.allowedServers...)
+
+			err := get(client, server)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestMTLSUntrustedCA(t *testing.T) {
+	ca := spiffetest.NewCA(t, trustDomain)
+	otherCA := spiffetest.NewCA(t, trustDomain)
+	serverAPI := spiffetest.NewWorkloadAPI(t)
+	serverAPI.SetX509SVID(t, ca.CreateX509SVID(t, serverID), ca.Bundle())
+	clientAPI := spiffetest.NewWorkloadAPI(t)
+	clientAPI.SetX509SVID(t, otherCA.CreateX509SVID(t, clientID), otherCA.Bundle())
+
+	server := startServer(t, serverAPI, "spiffe://example.org")
+	client := newClient(t, clientAPI, "spiffe://example.org")
+	require.Error(t, get(client, server))
+}
+
+func TestWorkloadAPISourceRotation(t *testing.T) {
+	ca := spiffetest.NewCA(t, trustDomain)
+	workloadAPI := spiffetest.NewWorkloadAPI(t)
+	workloadAPI.SetX509SVID(t, ca.CreateX509SVID(t, serverID), ca.Bundle())
+
+	source, err := spiffe.NewWorkloadAPISource(context.Background(), workloadAPI.Addr())
+	require.NoError(t, err)
+	defer source.Close()
+	svid, err := source.GetX509SVID()
+	require.NoError(t, err)
+	require.Equal(t, serverID, svid.ID)
+
+	// the SVID and the bundle rotate to a new CA
+	newCA := spiffetest.NewCA(t, trustDomain)
+	rotated := newCA.CreateX509SVID(t, serverID)
+	workloadAPI.SetX509SVID(t, rotated, newCA.Bundle())
+	require.Eventually(t, func() bool {
+		svid, err := source.GetX509SVID()
+		return err == nil && svid.Certificates[0].Equal(rotated.Certificates[0])
+	}, 10*time.Second, 10*time.Millisecond)
+	bundle, err := source.GetX509BundleForTrustDomain(trustDomain)
+	require.NoError(t, err)
+	require.True(t, bundle.Equal(newCA.Bundle()))
+}
+
+func TestNewWorkloadAPISourceCanceled(t *testing.T) {
+	// the workload API never serves an SVID
+	workloadAPI := spiffetest.NewWorkloadAPI(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := spiffe.NewWorkloadAPISource(ctx, workloadAPI.Addr())
+	require.Error(t, err)
+}
@@ -0,0 +1,23 @@
+package spiffetest
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// listen listens on a unix socket, in a short directory since socket paths are limited to 108 characters.
+func listen(t testing.TB) (net.Listener, string) {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "spiffetest")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "agent.sock")
+	listener, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	return listener, "unix://" + path
+}
@@ -0,0 +1,16 @@
+package spiffetest
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// listen listens on localhost, since the Workload API client on Windows only supports named pipes and TCP.
+func listen(t testing.TB) (net.Listener, string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	return listener, "tcp://" + listener.Addr().String()
+}
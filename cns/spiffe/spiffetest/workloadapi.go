@@ -0,0 +1,109 @@
+package spiffetest
+
+import (
+	"crypto/x509"
+	"sync"
+	"testing"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/proto/spiffe/workload"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// WorkloadAPI is a fake SPIFFE Workload API serving a single X509-SVID, which streams the updates of the SVID
+// and of the bundles to its clients.
+type WorkloadAPI struct {
+	workload.UnimplementedSpiffeWorkloadAPIServer
+
+	addr string
+
+	mu       sync.Mutex
+	response *workload.X509SVIDResponse
+	// updated is closed and replaced when the response changes
+	updated chan struct{}
+}
+
+// NewWorkloadAPI starts a WorkloadAPI, which is stopped when the test ends. Its clients block until SetX509SVID is called.
+func NewWorkloadAPI(t testing.TB) *WorkloadAPI {
+	t.Helper()
+	listener, addr := listen(t)
+	w := &WorkloadAPI{addr: addr, updated: make(chan struct{})}
+
+	server := grpc.NewServer()
+	workload.RegisterSpiffeWorkloadAPIServer(server, w)
+	go server.Serve(listener) //nolint:errcheck // Serve returns when the server is stopped
+	t.Cleanup(server.Stop)
+	return w
+}
+
+// Addr is the address of the WorkloadAPI, to configure its clients with.
+func (w *WorkloadAPI) Addr() string {
+	return w.addr
+}
+
+// SetX509SVID sets the X509-SVID served by the WorkloadAPI, along with the bundle of its trust domain
+// and the bundles of federated trust domains.
+func (w *WorkloadAPI) SetX509SVID(t testing.TB, svid *x509svid.SVID, bundles ...*x509bundle.Bundle) {
+	t.Helper()
+	svidKey, err := x509.MarshalPKCS8PrivateKey(svid.PrivateKey)
+	require.NoError(t, err)
+
+	response := &workload.X509SVIDResponse{
+		Svids: []*workload.X509SVID{{
+			SpiffeId:    svid.ID.String(),
+			X509Svid:    concatRawCertificates(svid.Certificates),
+			X509SvidKey: svidKey,
+		}},
+		FederatedBundles: map[string][]byte{},
+	}
+	for _, bundle := range bundles {
+		if bundle.TrustDomain() == svid.ID.TrustDomain() {
+			response.Svids[0].Bundle = concatRawCertificates(bundle.X509Authorities())
+		} else {
+			response.FederatedBundles[bundle.TrustDomain().IDString()] = concatRawCertificates(bundle.X509Authorities())
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.response = response
+	close(w.updated)
+	w.updated = make(chan struct{})
+}
+
+// FetchX509SVID streams the X509-SVID responses, as the Workload API spec requires.
+func (w *WorkloadAPI) FetchX509SVID(_ *workload.X509SVIDRequest, stream workload.SpiffeWorkloadAPI_FetchX509SVIDServer) error {
+	if md, ok := metadata.FromIncomingContext(stream.Context()); !ok || len(md["workload.spiffe.io"]) != 1 || md["workload.spiffe.io"][0] != "true" {
+		return status.Error(codes.InvalidArgument, "security header missing from request")
+	}
+
+	for {
+		w.mu.Lock()
+		response, updated := w.response, w.updated
+		w.mu.Unlock()
+
+		if response != nil {
+			if err := stream.Send(response); err != nil {
+				return err //nolint:wrapcheck // returned to grpc
+			}
+		}
+		select {
+		case <-updated:
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+func concatRawCertificates(certs []*x509.Certificate) []byte {
+	var raw []byte
+	for _, cert := range certs {
+		raw = append(raw, cert.Raw...)
+	}
+	return raw
+}
@@ -12,6 +12,7 @@ import (
 	"os"
 
 	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/tracing"
 	"github.com/pkg/errors"
 )
 
@@ -127,8 +128,9 @@ func (l *Listener) AddEndpoint(endpoint string) {
 }
 
 // AddHandler registers a protocol handler.
+// Requests are traced, continuing the trace propagated by the caller, if any.
 func (l *Listener) AddHandler(path string, handler http.HandlerFunc) {
-	l.mux.HandleFunc(path, handler)
+	l.mux.HandleFunc(path, tracing.HandlerFunc(path, handler))
 }
 
 // todo: Decode and Encode below should not be methods, just functions. They make no use of Listener fields.
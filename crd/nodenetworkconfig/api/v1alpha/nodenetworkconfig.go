@@ -84,6 +84,11 @@ type NodeNetworkConfigStatus struct {
 	Scaler            Scaler             `json:"scaler,omitempty"`
 	Status            Status             `json:"status,omitempty"`
 	NetworkContainers []NetworkContainer `json:"networkContainers,omitempty"`
+	// NetworkContainerStatuses are the states of the NetworkContainers on the Node, as reported by CNS.
+	// +listType=map
+	// +listMapKey=id
+	// +kubebuilder:validation:Optional
+	NetworkContainerStatuses []NetworkContainerStatus `json:"networkContainerStatuses,omitempty"`
 }
 
 // Scaler groups IP request params together
@@ -139,6 +144,30 @@ type NetworkContainer struct {
 	Status          NCStatus `json:"status,omitempty"`
 }
 
+// Types of the conditions of NetworkContainerStatuses.
+const (
+	// NCConditionProgrammed is whether the NC is created in CNS and programmed on the host.
+	NCConditionProgrammed = "Programmed"
+	// NCConditionVersionSynced is whether the version of the NC programmed on the host is the version of the NC.
+	NCConditionVersionSynced = "VersionSynced"
+)
+
+// NetworkContainerStatus is the state of a Network Container on the Node, as reported by CNS.
+type NetworkContainerStatus struct {
+	ID string `json:"id"`
+	// HostVersion is the version of the NC programmed on the host, -1 if it isn't programmed yet.
+	// +kubebuilder:validation:Optional
+	HostVersion int64 `json:"hostVersion"`
+	// IPsInUse is the number of IPs of the NC which are assigned to Pods.
+	// +kubebuilder:validation:Optional
+	IPsInUse int64 `json:"ipsInUse"`
+	// LastError is the last error creating or updating the NC in CNS, cleared once it succeeds.
+	LastError string `json:"lastError,omitempty"`
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
 // IPAssignment groups an IP address and Name. Name is a UUID set by the the IP address assigner.
 type IPAssignment struct {
 	Name string `json:"name,omitempty"`
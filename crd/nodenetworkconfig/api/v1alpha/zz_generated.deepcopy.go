@@ -5,6 +5,7 @@
 package v1alpha
 
 import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -43,6 +44,28 @@ func (in *NetworkContainer) DeepCopy() *NetworkContainer {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkContainerStatus) DeepCopyInto(out *NetworkContainerStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkContainerStatus.
+func (in *NetworkContainerStatus) DeepCopy() *NetworkContainerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkContainerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NodeNetworkConfig) DeepCopyInto(out *NodeNetworkConfig) {
 	*out = *in
@@ -133,6 +156,13 @@ func (in *NodeNetworkConfigStatus) DeepCopyInto(out *NodeNetworkConfigStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.NetworkContainerStatuses != nil {
+		in, out := &in.NetworkContainerStatuses, &out.NetworkContainerStatuses
+		*out = make([]NetworkContainerStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeNetworkConfigStatus.
@@ -2,6 +2,7 @@ package nodenetworkconfig
 
 import (
 	"context"
+	"encoding/json"
 	"reflect"
 
 	"github.com/Azure/azure-container-networking/crd"
@@ -115,6 +116,24 @@ func (c *Client) PatchSpec(ctx context.Context, key types.NamespacedName, spec *
 	return obj, nil
 }
 
+// PatchNetworkContainerStatuses replaces the NetworkContainerStatuses in the status of the NodeNetworkConfig specified by the NamespacedName.
+// It is a merge patch of only the NetworkContainerStatuses, so that the rest of the status, which is written by the control plane, is untouched.
+func (c *Client) PatchNetworkContainerStatuses(ctx context.Context, key types.NamespacedName, statuses []v1alpha.NetworkContainerStatus) (*v1alpha.NodeNetworkConfig, error) {
+	patch, err := json.Marshal(map[string]any{
+		"status": map[string]any{
+			"networkContainerStatuses": statuses,
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal nnc status patch")
+	}
+	obj := genPatchSkel(key)
+	if err := c.cli.Status().Patch(ctx, obj, client.RawPatch(types.MergePatchType, patch)); err != nil {
+		return nil, errors.Wrap(err, "failed to patch nnc status")
+	}
+	return obj, nil
+}
+
 // UpdateSpec does a fetch, deepcopy, and update of the NodeNetworkConfig with the passed spec.
 // Deprecated: UpdateSpec is deprecated and usage should migrate to PatchSpec.
 func (c *Client) UpdateSpec(ctx context.Context, key types.NamespacedName, spec *v1alpha.NodeNetworkConfigSpec) (*v1alpha.NodeNetworkConfig, error) {
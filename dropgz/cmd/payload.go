@@ -1,19 +1,28 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"os"
 
 	"github.com/Azure/azure-container-networking/dropgz/pkg/embed"
 	"github.com/Azure/azure-container-networking/dropgz/pkg/hash"
+	"github.com/Azure/azure-container-networking/dropgz/pkg/signature"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 )
 
+const publicKeyUsage = "PEM public key file the checksum file signature is verified with (default no signature verification)"
+
+var ErrFilesDiffer = errors.New("files differ from the payload")
+
 var (
-	compression embed.Compression
-	skipVerify  bool
-	outs        []string
+	compression   embed.Compression
+	skipVerify    bool
+	outs          []string
+	publicKeyPath string
 )
 
 // list subcommand
@@ -34,19 +43,57 @@ var list = &cobra.Command{
 	},
 }
 
-func checksum(srcs, dests []string) error {
-	if len(srcs) != len(dests) {
-		return errors.Wrapf(embed.ErrArgsMismatched, "%d and %d", len(srcs), len(dests))
+// loadChecksums reads the checksums from the payload manifest. If a public key is set, the manifest must have a valid
+// detached signature by this key.
+func loadChecksums() (hash.Checksums, error) {
+	manifest, err := readPayloadFile(embed.ManifestFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to extract checksum file")
 	}
-	rc, err := embed.Extract("sum.txt", compression)
+
+	if publicKeyPath != "" {
+		b, err := os.ReadFile(publicKeyPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read public key %s", publicKeyPath)
+		}
+		key, err := signature.ParsePublicKey(b)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse public key %s", publicKeyPath)
+		}
+		sig, err := readPayloadFile(embed.SignatureFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to extract checksum file signature")
+		}
+		if err := signature.Verify(key, manifest, sig); err != nil {
+			return nil, errors.Wrap(err, "failed to verify checksum file signature")
+		}
+		z.Info("verified checksum file signature", zap.String("key", publicKeyPath))
+	}
+
+	checksums, err := hash.Parse(bytes.NewReader(manifest))
 	if err != nil {
-		return errors.Wrap(err, "failed to extract checksum file")
+		return nil, errors.Wrap(err, "failed to parse checksums")
+	}
+	return checksums, nil
+}
+
+func readPayloadFile(name string) ([]byte, error) {
+	rc, err := embed.Extract(name, compression)
+	if err != nil {
+		return nil, err
 	}
 	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	return b, errors.Wrapf(err, "failed to read %s", name)
+}
 
-	checksums, err := hash.Parse(rc)
+func checksum(srcs, dests []string) error {
+	if len(srcs) != len(dests) {
+		return errors.Wrapf(embed.ErrArgsMismatched, "%d and %d", len(srcs), len(dests))
+	}
+	checksums, err := loadChecksums()
 	if err != nil {
-		return errors.Wrap(err, "failed to parse checksums")
+		return err
 	}
 	for i := range srcs {
 		valid, err := checksums.Check(srcs[i], dests[i])
@@ -74,17 +121,21 @@ var deploy = &cobra.Command{
 			return errors.Wrapf(embed.ErrArgsMismatched, "%d files, %d outputs", len(srcs), len(outs))
 		}
 		log := z.With(zap.Strings("sources", srcs), zap.Strings("outputs", outs), zap.String("cmd", "deploy"))
-		if err := embed.Deploy(log, srcs, outs, compression); err != nil {
+		var checksums hash.Checksums
+		if !skipVerify {
+			var err error
+			if checksums, err = loadChecksums(); err != nil {
+				return err
+			}
+		}
+		// files are verified before they replace the outputs
+		if err := embed.Deploy(log, srcs, outs, compression, checksums); err != nil {
 			return errors.Wrapf(err, "failed to deploy %s", srcs)
 		}
 		log.Info("successfully wrote files")
-		if skipVerify {
-			return nil
-		}
-		if err := checksum(srcs, outs); err != nil {
-			return err
+		if checksums != nil {
+			log.Info("verified file integrity")
 		}
-		log.Info("verified file integrity")
 		return nil
 	},
 	Args: cobra.OnlyValidArgs,
@@ -113,16 +164,104 @@ var verify = &cobra.Command{
 	Args: cobra.OnlyValidArgs,
 }
 
+// rollback subcommand
+var rollback = &cobra.Command{
+	Use:   "rollback [outputs]",
+	Short: "restore the output files from the backups kept by the last deploy",
+	RunE: func(_ *cobra.Command, dests []string) error {
+		if err := setLogLevel(); err != nil {
+			return err
+		}
+		log := z.With(zap.Strings("outputs", dests), zap.String("cmd", "rollback"))
+		if err := embed.Rollback(log, dests); err != nil {
+			return errors.Wrapf(err, "failed to roll back %s", dests)
+		}
+		log.Info("successfully restored files")
+		return nil
+	},
+	Args: cobra.MinimumNArgs(1),
+}
+
+// diff subcommand
+var diff = &cobra.Command{
+	Use:   "diff",
+	Short: "show the output files which differ from the payload",
+	RunE: func(_ *cobra.Command, srcs []string) error {
+		if err := setLogLevel(); err != nil {
+			return err
+		}
+		if len(srcs) == 0 {
+			var err error
+			if srcs, err = payloadFiles(); err != nil {
+				return err
+			}
+		}
+		if len(outs) == 0 {
+			outs = srcs
+		}
+		if len(srcs) != len(outs) {
+			return errors.Wrapf(embed.ErrArgsMismatched, "%d sources, %d destinations", len(srcs), len(outs))
+		}
+		checksums, err := loadChecksums()
+		if err != nil {
+			return err
+		}
+		differ := 0
+		for i := range srcs {
+			status, err := checksums.Status(srcs[i], outs[i])
+			if err != nil {
+				return errors.Wrapf(err, "failed to compare file at %s", outs[i])
+			}
+			if status != hash.Unchanged {
+				differ++
+			}
+			fmt.Printf("%s\t%s\t%s\n", status, srcs[i], outs[i])
+		}
+		if differ > 0 {
+			return errors.Wrapf(ErrFilesDiffer, "%d of %d files", differ, len(srcs))
+		}
+		return nil
+	},
+	Args: cobra.OnlyValidArgs,
+}
+
+// payloadFiles returns the files of the payload, without its manifest.
+func payloadFiles() ([]string, error) {
+	contents, err := embed.Contents()
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, c := range contents {
+		if c != embed.ManifestFile && c != embed.SignatureFile {
+			files = append(files, c)
+		}
+	}
+	return files, nil
+}
+
 func init() {
 	root.AddCommand(list)
 
 	verify.ValidArgs, _ = embed.Contents()
 	verify.Flags().StringSliceVarP(&outs, "output", "o", []string{}, "output file path")
+	verify.Flags().StringVar(&publicKeyPath, "public-key", "", publicKeyUsage)
 	root.AddCommand(verify)
 
+	diff.ValidArgs, _ = embed.Contents()
+	diff.Flags().StringSliceVarP(&outs, "output", "o", []string{}, "output file path")
+	diff.Flags().StringVarP((*string)(&compression), "compression", "c", "none", "compression type (default none)")
+	diff.Flags().StringVar(&publicKeyPath, "public-key", "", publicKeyUsage)
+	root.AddCommand(diff)
+
+	root.AddCommand(rollback)
+
 	deploy.ValidArgs, _ = embed.Contents() // setting this after the command is initialized is required
 	deploy.Flags().StringVarP((*string)(&compression), "compression", "c", "none", "compression type (default none)")
 	deploy.Flags().BoolVar(&skipVerify, "skip-verify", false, "set to disable checksum validation")
 	deploy.Flags().StringSliceVarP(&outs, "output", "o", []string{}, "output file path")
+	deploy.Flags().StringVar(&publicKeyPath, "public-key", "", publicKeyUsage)
+	// the signature only covers the checksums, so it can't be verified without verifying the files too
+	deploy.MarkFlagsMutuallyExclusive("skip-verify", "public-key")
 	root.AddCommand(deploy)
 }
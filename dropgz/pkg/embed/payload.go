@@ -10,16 +10,27 @@ import (
 	"path"
 	"path/filepath"
 
+	"github.com/Azure/azure-container-networking/dropgz/pkg/hash"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
 const (
-	cwd           = "fs"
-	oldFileSuffix = ".old"
+	cwd                  = "fs"
+	oldFileSuffix        = ".old"
+	rolledBackFileSuffix = ".rolledback"
+	tmpFileSuffix        = ".dropgz-*"
+	// ManifestFile is the manifest of the payload, listing the checksums of its files.
+	ManifestFile = "sum.txt"
+	// SignatureFile is the detached signature of the manifest.
+	SignatureFile = ManifestFile + ".sig"
 )
 
-var ErrArgsMismatched = errors.New("mismatched argument count")
+var (
+	ErrArgsMismatched   = errors.New("mismatched argument count")
+	ErrChecksumMismatch = errors.New("checksum validation failed")
+	ErrNoBackup         = errors.New("no backup to roll back to")
+)
 
 type Compression string
 
@@ -94,39 +105,167 @@ func Extract(p string, compression Compression) (*compoundReadCloser, error) {
 	return &compoundReadCloser{closer: f, readcloser: rc}, nil
 }
 
-func deploy(src, dest string, compression Compression) error {
+// deploy writes src to a temporary file next to dest, verifies it against checksums if they are set, then replaces
+// dest with it so that dest is never left partially written.
+func deploy(src, dest string, compression Compression, checksums hash.Checksums) error {
 	rc, err := Extract(src, compression)
 	if err != nil {
 		return err
 	}
 	defer rc.Close()
-	// check if the file exists at dest already and rename it as an old one
-	if _, err := os.Stat(dest); err == nil {
-		oldDest := dest + oldFileSuffix
-		if err = os.Rename(dest, oldDest); err != nil {
-			return errors.Wrapf(err, "failed to rename the %s to %s", dest, oldDest)
-		}
+
+	dir, name := filepath.Split(dest)
+	if dir == "" {
+		dir = "."
+	}
+	target, err := os.CreateTemp(dir, name+tmpFileSuffix)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create temporary file for %s", dest)
+	}
+	tmp := target.Name()
+	defer os.Remove(tmp) //nolint:errcheck // the temporary file is gone once it replaced dest
+
+	w := bufio.NewWriter(target)
+	if _, err = io.Copy(w, rc); err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = target.Sync()
+	}
+	if cerr := target.Close(); err == nil {
+		err = cerr
 	}
-	target, err := os.OpenFile(dest, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o755) //nolint:gomnd // executable file bitmask
 	if err != nil {
-		return errors.Wrapf(err, "failed to create file %s", dest)
+		return errors.Wrapf(err, "failed to copy %s to %s", src, tmp)
 	}
-	defer target.Close()
-	_, err = io.Copy(bufio.NewWriter(target), rc)
-	return errors.Wrapf(err, "failed to copy %s to %s", src, dest)
+	if err := os.Chmod(tmp, 0o755); err != nil { //nolint:gomnd // executable file bitmask
+		return errors.Wrapf(err, "failed to set mode of %s", tmp)
+	}
+
+	if checksums != nil {
+		valid, err := checksums.Check(src, tmp)
+		if err != nil {
+			return errors.Wrapf(err, "failed to validate %s", src)
+		}
+		if !valid {
+			return errors.Wrapf(ErrChecksumMismatch, "%s", src)
+		}
+	}
+	return replace(tmp, dest)
 }
 
-func Deploy(log *zap.Logger, srcs, dests []string, compression Compression) error {
+// replace moves src to dest, keeping the previous dest as its backup. dest is hard linked to the backup and atomically
+// replaced where possible, so that it is never missing. Otherwise, such as for executables running on Windows, dest is
+// moved to the backup before src is moved in its place.
+func replace(src, dest string) error {
+	if _, err := os.Lstat(dest); errors.Is(err, os.ErrNotExist) {
+		return errors.Wrapf(os.Rename(src, dest), "failed to rename %s to %s", src, dest)
+	}
+
+	backup := dest + oldFileSuffix
+	if err := os.Remove(backup); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.Wrapf(err, "failed to remove previous backup %s", backup)
+	}
+	if err := os.Link(dest, backup); err == nil {
+		if err := os.Rename(src, dest); err == nil {
+			return nil
+		}
+		if err := os.Remove(backup); err != nil {
+			return errors.Wrapf(err, "failed to remove backup %s", backup)
+		}
+	}
+
+	if err := os.Rename(dest, backup); err != nil {
+		return errors.Wrapf(err, "failed to rename the %s to %s", dest, backup)
+	}
+	if err := os.Rename(src, dest); err != nil {
+		if rerr := os.Rename(backup, dest); rerr != nil {
+			return errors.Wrapf(err, "failed to rename %s to %s, and to restore it from %s: %v", src, dest, backup, rerr)
+		}
+		return errors.Wrapf(err, "failed to rename %s to %s", src, dest)
+	}
+	return nil
+}
+
+// Deploy writes the srcs from the payload to the dests. If checksums are set, the srcs are verified against them
+// before they replace the dests. If any src fails to be deployed, the dests already replaced are restored from their
+// backups, and those which didn't exist before are removed, so that the dests are deployed together or not at all.
+func Deploy(log *zap.Logger, srcs, dests []string, compression Compression, checksums hash.Checksums) error {
 	if len(srcs) != len(dests) {
 		return errors.Wrapf(ErrArgsMismatched, "%d and %d", len(srcs), len(dests))
 	}
+	existed := make([]bool, len(dests))
 	for i := range srcs {
 		src := srcs[i]
 		dest := dests[i]
-		if err := deploy(src, dest, compression); err != nil {
+		_, err := os.Lstat(dest)
+		existed[i] = err == nil
+		if err := deploy(src, dest, compression, checksums); err != nil {
+			if uerr := undeploy(log, dests[:i], existed[:i]); uerr != nil {
+				return errors.Wrapf(err, "failed to deploy %s, and to undo the deployment of the previous files: %v", src, uerr)
+			}
 			return err
 		}
 		log.Info("wrote file", zap.String("src", src), zap.String("dest", dest))
 	}
 	return nil
 }
+
+// undeploy undoes the deployment of dests, restoring those which existed from their backups and removing the others.
+func undeploy(log *zap.Logger, dests []string, existed []bool) error {
+	var failed []string
+	for i := len(dests) - 1; i >= 0; i-- {
+		var err error
+		if existed[i] {
+			err = rollback(dests[i])
+		} else {
+			err = errors.Wrapf(os.Remove(dests[i]), "failed to remove %s", dests[i])
+		}
+		if err != nil {
+			log.Error("failed to undo deployment of file", zap.String("dest", dests[i]), zap.Error(err))
+			failed = append(failed, dests[i])
+			continue
+		}
+		log.Info("undid deployment of file", zap.String("dest", dests[i]))
+	}
+	if len(failed) > 0 {
+		return errors.Errorf("failed to undo deployment of %s", failed)
+	}
+	return nil
+}
+
+// rollback restores dest from the backup kept when it was last deployed.
+func rollback(dest string) error {
+	backup := dest + oldFileSuffix
+	if _, err := os.Lstat(backup); errors.Is(err, os.ErrNotExist) {
+		return errors.Wrapf(ErrNoBackup, "%s", dest)
+	}
+	if err := os.Rename(backup, dest); err == nil {
+		return nil
+	}
+
+	// dest can't be replaced, such as executables running on Windows, so move it out of the way first
+	rolledBack := dest + rolledBackFileSuffix
+	if err := os.Rename(dest, rolledBack); err != nil {
+		return errors.Wrapf(err, "failed to rename %s to %s", dest, rolledBack)
+	}
+	if err := os.Rename(backup, dest); err != nil {
+		if rerr := os.Rename(rolledBack, dest); rerr != nil {
+			return errors.Wrapf(err, "failed to restore %s from %s, and to move it back from %s: %v", dest, backup, rolledBack, rerr)
+		}
+		return errors.Wrapf(err, "failed to restore %s from %s", dest, backup)
+	}
+	return nil
+}
+
+// Rollback restores the dests from the backups kept when they were last deployed. The backups are consumed, so only
+// one deployment can be rolled back.
+func Rollback(log *zap.Logger, dests []string) error {
+	for _, dest := range dests {
+		if err := rollback(dest); err != nil {
+			return err
+		}
+		log.Info("restored file", zap.String("dest", dest), zap.String("backup", dest+oldFileSuffix))
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package embed
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/dropgz/pkg/hash"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplaceKeepsBackup(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "azure-vnet")
+	src := filepath.Join(dir, "new")
+
+	writeFile(t, src, "v1")
+	if err := replace(src, dest); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, dest); got != "v1" {
+		t.Fatalf("dest = %q, want v1", got)
+	}
+	if _, err := os.Stat(dest + oldFileSuffix); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("no backup expected for a new file: %v", err)
+	}
+
+	writeFile(t, src, "v2")
+	if err := replace(src, dest); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, dest); got != "v2" {
+		t.Fatalf("dest = %q, want v2", got)
+	}
+	if got := readFile(t, dest+oldFileSuffix); got != "v1" {
+		t.Fatalf("backup = %q, want v1", got)
+	}
+	if _, err := os.Stat(src); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("src should have been moved: %v", err)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "azure-vnet")
+
+	if err := Rollback(zap.NewNop(), []string{dest}); !errors.Is(err, ErrNoBackup) {
+		t.Fatalf("expected ErrNoBackup, got %v", err)
+	}
+
+	writeFile(t, dest, "v2")
+	writeFile(t, dest+oldFileSuffix, "v1")
+	if err := Rollback(zap.NewNop(), []string{dest}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, dest); got != "v1" {
+		t.Fatalf("dest = %q, want v1", got)
+	}
+	if err := Rollback(zap.NewNop(), []string{dest}); !errors.Is(err, ErrNoBackup) {
+		t.Fatalf("the backup is consumed by the rollback, got %v", err)
+	}
+}
+
+func TestDeployVerifiesChecksum(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, ManifestFile)
+	writeFile(t, dest, "previous")
+
+	// the embedded manifest is empty outside of builds
+	content := readFileFromPayload(t, ManifestFile)
+	valid := hash.Checksums{ManifestFile: fmt.Sprintf("%x", sha256.Sum256([]byte(content)))}
+	invalid := hash.Checksums{ManifestFile: fmt.Sprintf("%x", sha256.Sum256([]byte("tampered")))}
+
+	err := Deploy(zap.NewNop(), []string{ManifestFile}, []string{dest}, None, invalid)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+	}
+	if got := readFile(t, dest); got != "previous" {
+		t.Fatalf("dest replaced by a file which failed validation: %q", got)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("temporary files left behind: %v", entries)
+	}
+
+	if err := Deploy(zap.NewNop(), []string{ManifestFile}, []string{dest}, None, valid); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, dest); got != content {
+		t.Fatalf("dest = %q, want %q", got, content)
+	}
+	if got := readFile(t, dest+oldFileSuffix); got != "previous" {
+		t.Fatalf("backup = %q, want previous", got)
+	}
+}
+
+func TestDeployUndoesPartialDeployment(t *testing.T) {
+	dir := t.TempDir()
+	added := filepath.Join(dir, "added")
+	replaced := filepath.Join(dir, "replaced")
+	writeFile(t, replaced, "previous")
+
+	srcs := []string{ManifestFile, ManifestFile, "missing"}
+	dests := []string{added, replaced, filepath.Join(dir, "missing")}
+	if err := Deploy(zap.NewNop(), srcs, dests, None, nil); err == nil {
+		t.Fatal("expected deploying a file missing from the payload to fail")
+	}
+	if _, err := os.Stat(added); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("file which didn't exist before should have been removed: %v", err)
+	}
+	if got := readFile(t, replaced); got != "previous" {
+		t.Fatalf("replaced = %q, want previous", got)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("files left behind: %v", entries)
+	}
+}
+
+func readFileFromPayload(t *testing.T, name string) string {
+	t.Helper()
+	b, err := embedfs.ReadFile(cwd + "/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
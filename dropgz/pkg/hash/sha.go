@@ -29,6 +29,30 @@ func Parse(r io.Reader) (Checksums, error) {
 	return checksums, nil
 }
 
+// FileStatus is how a file on the host compares with its source in the payload.
+type FileStatus string
+
+const (
+	Unchanged FileStatus = "unchanged"
+	Modified  FileStatus = "modified"
+	Missing   FileStatus = "missing"
+)
+
+// Status returns how the file at dst compares with the checksum of src.
+func (sums Checksums) Status(src, dst string) (FileStatus, error) {
+	valid, err := sums.Check(src, dst)
+	if errors.Is(err, os.ErrNotExist) {
+		return Missing, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if !valid {
+		return Modified, nil
+	}
+	return Unchanged, nil
+}
+
 func (sums Checksums) Check(src, dst string) (bool, error) {
 	want, ok := sums[src]
 	if !ok {
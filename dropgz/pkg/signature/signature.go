@@ -0,0 +1,59 @@
+// Package signature verifies the detached signatures of the payload manifest, so that a payload can be trusted
+// before it is deployed. Signatures are made with the SHA-256 digest of the manifest for ECDSA and RSA keys, as with
+// "openssl dgst -sha256 -sign", and over the manifest itself for Ed25519 keys.
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrUnsupportedKey   = errors.New("unsupported public key type")
+)
+
+// ParsePublicKey parses a PEM encoded PKIX public key.
+func ParsePublicKey(b []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, errors.New("no PEM encoded public key found")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse public key")
+	}
+	switch key.(type) {
+	case ed25519.PublicKey, *ecdsa.PublicKey, *rsa.PublicKey:
+		return key, nil
+	default:
+		return nil, errors.Wrapf(ErrUnsupportedKey, "%T", key)
+	}
+}
+
+// Verify checks that sig is a signature of message by key.
+func Verify(key crypto.PublicKey, message, sig []byte) error {
+	digest := sha256.Sum256(message)
+	var valid bool
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(k, message, sig)
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(k, digest[:], sig)
+	case *rsa.PublicKey:
+		valid = rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) == nil
+	default:
+		return errors.Wrapf(ErrUnsupportedKey, "%T", key)
+	}
+	if !valid {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+var manifest = []byte("6b86b273ff34fce19d6b804eff5a3f5747ada4eaa22f1d49c01e52ddb7875b4b  azure-vnet\n")
+
+func encodePublicKey(t *testing.T, key crypto.PublicKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func TestVerify(t *testing.T) {
+	digest := sha256.Sum256(manifest)
+
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecSig, err := ecdsa.SignASN1(rand.Reader, ecKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048) //nolint:gomnd // test key size
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaSig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		key  crypto.PublicKey
+		sig  []byte
+	}{
+		{name: "ed25519", key: edPub, sig: ed25519.Sign(edKey, manifest)},
+		{name: "ecdsa", key: &ecKey.PublicKey, sig: ecSig},
+		{name: "rsa", key: &rsaKey.PublicKey, sig: rsaSig},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ParsePublicKey(encodePublicKey(t, tt.key))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := Verify(key, manifest, tt.sig); err != nil {
+				t.Fatalf("valid signature rejected: %v", err)
+			}
+
+			tampered := append([]byte("0"), manifest[1:]...)
+			if err := Verify(key, tampered, tt.sig); !errors.Is(err, ErrInvalidSignature) {
+				t.Fatalf("signature of tampered manifest accepted: %v", err)
+			}
+		})
+	}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	if _, err := ParsePublicKey([]byte("not a key")); err == nil {
+		t.Fatal("expected error for non PEM key")
+	}
+	if _, err := ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("garbage")})); err == nil {
+		t.Fatal("expected error for malformed key")
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/Azure/azure-container-networking/netlink"
 	"github.com/Azure/azure-container-networking/network/policy"
 	"github.com/Azure/azure-container-networking/platform"
+	"github.com/Azure/azure-container-networking/tracing"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
@@ -187,7 +188,9 @@ func (ifInfo *InterfaceInfo) PrettyString() string {
 }
 
 // NewEndpoint creates a new endpoint in the network.
+// The datapath operations, e.g. netlink and iptables or HNS calls, are traced in child spans of ctx.
 func (nw *network) newEndpoint(
+	ctx context.Context,
 	apipaCli apipaClient,
 	nl netlink.NetlinkInterface,
 	plc platform.ExecClient,
@@ -208,7 +211,7 @@ func (nw *network) newEndpoint(
 
 	// Call the platform implementation.
 	// Pass nil for epClient and will be initialized in newendpointImpl
-	ep, err = nw.newEndpointImpl(apipaCli, nl, plc, netioCli, nil, nsc, iptc, dhcpc, epInfo)
+	ep, err = nw.newEndpointImpl(ctx, apipaCli, nl, plc, netioCli, nil, nsc, iptc, dhcpc, epInfo)
 	if err != nil {
 		return nil, err
 	}
@@ -219,6 +222,16 @@ func (nw *network) newEndpoint(
 	return ep, nil
 }
 
+// traceDatapath runs a datapath operation of an endpoint in a child span of ctx. In Linux, the operations are the
+// calls to the EndpointClient, which create interfaces and routes with netlink and program iptables and ebtables
+// rules. In Windows, they are the HNS calls.
+func traceDatapath(ctx context.Context, name string, op func() error) error {
+	_, span := tracing.Start(ctx, name)
+	err := op()
+	tracing.End(span, err)
+	return err
+}
+
 // DeleteEndpoint deletes an existing endpoint from the network.
 func (nw *network) deleteEndpoint(nl netlink.NetlinkInterface, plc platform.ExecClient, nioc netio.NetIOInterface, nsc NamespaceClientInterface,
 	iptc ipTablesClient, dhcpc dhcpClient, endpointID string, mode string,
@@ -4,6 +4,7 @@
 package network
 
 import (
+	"context"
 	"crypto/sha1"
 	"encoding/hex"
 	"fmt"
@@ -50,6 +51,7 @@ func ConstructEndpointID(containerID string, _ string, ifName string) (string, s
 
 // newEndpointImpl creates a new endpoint in the network.
 func (nw *network) newEndpointImpl(
+	ctx context.Context,
 	_ apipaClient,
 	nl netlink.NetlinkInterface,
 	plc platform.ExecClient,
@@ -192,7 +194,7 @@ func (nw *network) newEndpointImpl(
 	// wrapping endpoint client commands in anonymous func so that namespace can be exit and closed before the next loop
 	//nolint:wrapcheck // ignore wrap check
 	err = func() error {
-		if epErr := epClient.AddEndpoints(epInfo); epErr != nil {
+		if epErr := traceDatapath(ctx, "endpointClient.AddEndpoints", func() error { return epClient.AddEndpoints(epInfo) }); epErr != nil {
 			return epErr
 		}
 
@@ -206,7 +208,7 @@ func (nw *network) newEndpointImpl(
 		}
 
 		// Setup rules for IP addresses on the container interface.
-		if epErr := epClient.AddEndpointRules(epInfo); epErr != nil {
+		if epErr := traceDatapath(ctx, "endpointClient.AddEndpointRules", func() error { return epClient.AddEndpointRules(epInfo) }); epErr != nil {
 			return epErr
 		}
 
@@ -220,7 +222,8 @@ func (nw *network) newEndpointImpl(
 			}
 			defer ns.Close()
 
-			if epErr := epClient.MoveEndpointsToContainerNS(epInfo, ns.GetFd()); epErr != nil {
+			moveEndpoints := func() error { return epClient.MoveEndpointsToContainerNS(epInfo, ns.GetFd()) }
+			if epErr := traceDatapath(ctx, "endpointClient.MoveEndpointsToContainerNS", moveEndpoints); epErr != nil {
 				return epErr
 			}
 
@@ -250,12 +253,14 @@ func (nw *network) newEndpointImpl(
 
 		// If a name for the container interface is specified...
 		if epInfo.IfName != "" {
-			if epErr := epClient.SetupContainerInterfaces(epInfo); epErr != nil {
+			if epErr := traceDatapath(ctx, "endpointClient.SetupContainerInterfaces", func() error { return epClient.SetupContainerInterfaces(epInfo) }); epErr != nil {
 				return epErr
 			}
 		}
 
-		return epClient.ConfigureContainerInterfacesAndRoutes(epInfo)
+		return traceDatapath(ctx, "endpointClient.ConfigureContainerInterfacesAndRoutes", func() error {
+			return epClient.ConfigureContainerInterfacesAndRoutes(epInfo)
+		})
 	}()
 	if err != nil {
 		return nil, err
@@ -1,6 +1,7 @@
 package network
 
 import (
+	"context"
 	"net"
 	"testing"
 
@@ -166,7 +167,7 @@ var _ = Describe("Test TestEndpointLinux", func() {
 			pl := platform.NewMockExecClient(false)
 			pl.SetExecRawCommand(checkTransparentRun)
 
-			ep, err := nw2.newEndpointImpl(nil, netlink.NewMockNetlink(false, ""), pl,
+			ep, err := nw2.newEndpointImpl(context.Background(), nil, netlink.NewMockNetlink(false, ""), pl,
 				netio.NewMockNetIO(false, 0), nil, NewMockNamespaceClient(), iptables.NewClient(), &mockDHCP{}, epInfo2)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(ep).NotTo(BeNil())
@@ -183,7 +184,7 @@ var _ = Describe("Test TestEndpointLinux", func() {
 			nl := netlink.NewMockNetlink(false, "")
 			nl.SetDeleteRouteValidationFn(checkTransparentRun)
 
-			ep2, err := nw2.newEndpointImpl(nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false),
+			ep2, err := nw2.newEndpointImpl(context.Background(), nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false),
 				netio.NewMockNetIO(false, 0), nil, NewMockNamespaceClient(), iptables.NewClient(), &mockDHCP{}, epInfo2)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(ep2).ToNot(BeNil())
@@ -143,6 +143,7 @@ func (nw *network) getEndpointWithVFDevice(plc platform.ExecClient, epInfo *Endp
 
 // newEndpointImpl creates a new endpoint in the network.
 func (nw *network) newEndpointImpl(
+	ctx context.Context,
 	cli apipaClient,
 	_ netlink.NetlinkInterface,
 	plc platform.ExecClient,
@@ -166,15 +167,15 @@ func (nw *network) newEndpointImpl(
 			return nil, err
 		}
 
-		return nw.newEndpointImplHnsV2(cli, epInfo)
+		return nw.newEndpointImplHnsV2(ctx, cli, epInfo)
 
 	}
 
-	return nw.newEndpointImplHnsV1(epInfo, plc)
+	return nw.newEndpointImplHnsV1(ctx, epInfo, plc)
 }
 
 // newEndpointImplHnsV1 creates a new endpoint in the network using HnsV1
-func (nw *network) newEndpointImplHnsV1(epInfo *EndpointInfo, plc platform.ExecClient) (*endpoint, error) {
+func (nw *network) newEndpointImplHnsV1(ctx context.Context, epInfo *EndpointInfo, plc platform.ExecClient) (*endpoint, error) {
 	var vlanid int
 
 	if epInfo.Data != nil {
@@ -211,7 +212,11 @@ func (nw *network) newEndpointImplHnsV1(epInfo *EndpointInfo, plc platform.ExecC
 		}
 	}
 
-	hnsResponse, err := Hnsv1.CreateEndpoint(hnsEndpoint, "")
+	var hnsResponse *hcsshim.HNSEndpoint
+	err = traceDatapath(ctx, "hns.CreateEndpoint", func() (hnsErr error) {
+		hnsResponse, hnsErr = Hnsv1.CreateEndpoint(hnsEndpoint, "")
+		return hnsErr //nolint:wrapcheck // not wrapped, as before
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -230,7 +235,9 @@ func (nw *network) newEndpointImplHnsV1(epInfo *EndpointInfo, plc platform.ExecC
 	} else {
 		// Attach the endpoint.
 		logger.Info("Attaching endpoint to container", zap.String("id", hnsResponse.Id), zap.String("ContainerID", epInfo.ContainerID))
-		err = Hnsv1.HotAttachEndpoint(epInfo.ContainerID, hnsResponse.Id)
+		err = traceDatapath(ctx, "hns.HotAttachEndpoint", func() error {
+			return Hnsv1.HotAttachEndpoint(epInfo.ContainerID, hnsResponse.Id) //nolint:wrapcheck // not wrapped, as before
+		})
 		if err != nil {
 			logger.Error("Failed to attach endpoint", zap.Error(err))
 			return nil, err
@@ -452,7 +459,7 @@ func (nw *network) createHostNCApipaEndpoint(cli apipaClient, epInfo *EndpointIn
 }
 
 // newEndpointImplHnsV2 creates a new endpoint in the network using Hnsv2
-func (nw *network) newEndpointImplHnsV2(cli apipaClient, epInfo *EndpointInfo) (*endpoint, error) {
+func (nw *network) newEndpointImplHnsV2(ctx context.Context, cli apipaClient, epInfo *EndpointInfo) (*endpoint, error) {
 	hcnEndpoint, err := nw.configureHcnEndpoint(epInfo)
 	if err != nil {
 		logger.Error("Failed to configure hcn endpoint due to", zap.Error(err))
@@ -461,7 +468,11 @@ func (nw *network) newEndpointImplHnsV2(cli apipaClient, epInfo *EndpointInfo) (
 
 	// Create the HCN endpoint.
 	logger.Info("Creating hcn endpoint", zap.Any("hcnEndpoint", hcnEndpoint), zap.String("computenetwork", hcnEndpoint.HostComputeNetwork))
-	hnsResponse, err := Hnsv2.CreateEndpoint(hcnEndpoint)
+	var hnsResponse *hcn.HostComputeEndpoint
+	err = traceDatapath(ctx, "hns.CreateEndpoint", func() (hnsErr error) {
+		hnsResponse, hnsErr = Hnsv2.CreateEndpoint(hcnEndpoint)
+		return hnsErr //nolint:wrapcheck // wrapped below
+	})
 	if err != nil {
 		return nil, fmt.Errorf("Failed to create endpoint: %s due to error: %v", hcnEndpoint.Name, err)
 	}
@@ -481,7 +492,10 @@ func (nw *network) newEndpointImplHnsV2(cli apipaClient, epInfo *EndpointInfo) (
 		return nil, fmt.Errorf("Failed to get hcn namespace: %s due to error: %v", epInfo.NetNsPath, err)
 	}
 
-	if err = Hnsv2.AddNamespaceEndpoint(namespace.Id, hnsResponse.Id); err != nil {
+	err = traceDatapath(ctx, "hns.AddNamespaceEndpoint", func() error {
+		return Hnsv2.AddNamespaceEndpoint(namespace.Id, hnsResponse.Id) //nolint:wrapcheck // wrapped below
+	})
+	if err != nil {
 		return nil, fmt.Errorf("Failed to add endpoint: %s to hcn namespace: %s due to error: %v", hnsResponse.Id, namespace.Id, err) //nolint
 	}
 
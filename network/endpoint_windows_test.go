@@ -7,6 +7,7 @@
 package network
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
@@ -57,7 +58,7 @@ func TestNewAndDeleteEndpointImplHnsV2(t *testing.T) {
 		NICType:      cns.InfraNIC,
 		HNSNetworkID: "853d3fb6-e9b3-49e2-a109-2acc5dda61f1",
 	}
-	ep, err := nw.newEndpointImplHnsV2(nil, epInfo)
+	ep, err := nw.newEndpointImplHnsV2(context.Background(), nil, epInfo)
 	if err != nil {
 		fmt.Printf("+%v", err)
 		t.Fatal(err)
@@ -172,7 +173,7 @@ func TestNewEndpointImplHnsv2Timesout(t *testing.T) {
 		},
 		MacAddress: net.HardwareAddr("00:00:5e:00:53:01"),
 	}
-	_, err := nw.newEndpointImplHnsV2(nil, epInfo)
+	_, err := nw.newEndpointImplHnsV2(context.Background(), nil, epInfo)
 
 	if err == nil {
 		t.Fatal("Failed to timeout HNS calls for creating endpoint")
@@ -199,7 +200,7 @@ func TestDeleteEndpointImplHnsv2Timeout(t *testing.T) {
 		},
 		MacAddress: net.HardwareAddr("00:00:5e:00:53:01"),
 	}
-	endpoint, err := nw.newEndpointImplHnsV2(nil, epInfo)
+	endpoint, err := nw.newEndpointImplHnsV2(context.Background(), nil, epInfo)
 	if err != nil {
 		fmt.Printf("+%v", err)
 		t.Fatal(err)
@@ -248,7 +249,7 @@ func TestCreateEndpointImplHnsv1Timeout(t *testing.T) {
 		},
 		MacAddress: net.HardwareAddr("00:00:5e:00:53:01"),
 	}
-	_, err := nw.newEndpointImplHnsV1(epInfo, nil)
+	_, err := nw.newEndpointImplHnsV1(context.Background(), epInfo, nil)
 
 	if err == nil {
 		t.Fatal("Failed to timeout HNS calls for creating endpoint")
@@ -275,7 +276,7 @@ func TestDeleteEndpointImplHnsv1Timeout(t *testing.T) {
 		},
 		MacAddress: net.HardwareAddr("00:00:5e:00:53:01"),
 	}
-	endpoint, err := nw.newEndpointImplHnsV1(epInfo, nil)
+	endpoint, err := nw.newEndpointImplHnsV1(context.Background(), epInfo, nil)
 	if err != nil {
 		fmt.Printf("+%v", err)
 		t.Fatal(err)
@@ -493,7 +494,7 @@ func TestNewEndpointImplHnsv2ForIBHappyPath(t *testing.T) {
 	}
 
 	// Happy Path
-	endpoint, err := nw.newEndpointImpl(nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false),
+	endpoint, err := nw.newEndpointImpl(context.Background(), nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(false),
 		netio.NewMockNetIO(false, 0), NewMockEndpointClient(nil), NewMockNamespaceClient(), iptables.NewClient(), &mockDHCP{}, epInfo)
 
 	if endpoint != nil || err != nil {
@@ -523,7 +524,7 @@ func TestNewEndpointImplHnsv2ForIBUnHappyPath(t *testing.T) {
 	}
 
 	// Set UnHappy Path
-	_, err := nw.newEndpointImpl(nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(true),
+	_, err := nw.newEndpointImpl(context.Background(), nil, netlink.NewMockNetlink(false, ""), platform.NewMockExecClient(true),
 		netio.NewMockNetIO(false, 0), NewMockEndpointClient(nil), NewMockNamespaceClient(), iptables.NewClient(), &mockDHCP{}, epInfo)
 
 	if err == nil {
@@ -558,7 +559,7 @@ func TestCreateAndDeleteEndpointImplHnsv2ForDelegatedHappyPath(t *testing.T) {
 	}
 
 	// Happy Path to create and delete endpoint for delegated NIC
-	ep, err := nw.newEndpointImplHnsV2(nil, epInfo)
+	ep, err := nw.newEndpointImplHnsV2(context.Background(), nil, epInfo)
 	if err != nil {
 		t.Fatalf("Failed to create endpoint for Delegated NIC due to %v", err)
 	}
@@ -106,7 +106,7 @@ type NetworkManager interface {
 	GetNumEndpointsByContainerID(containerID string) int
 
 	CreateEndpoint(client apipaClient, networkID string, epInfo *EndpointInfo) error
-	EndpointCreate(client apipaClient, epInfos []*EndpointInfo) error // TODO: change name
+	EndpointCreate(ctx context.Context, client apipaClient, epInfos []*EndpointInfo) error // TODO: change name
 	DeleteEndpoint(networkID string, endpointID string, epInfo *EndpointInfo, mode string) error
 	GetEndpointInfo(networkID string, endpointID string) (*EndpointInfo, error)
 	GetAllEndpoints(networkID string) (map[string]*EndpointInfo, error)
@@ -374,7 +374,7 @@ func (nm *networkManager) GetNetworkInfo(networkID string) (EndpointInfo, error)
 	return nwInfo, nil
 }
 
-func (nm *networkManager) createEndpoint(cli apipaClient, networkID string, epInfo *EndpointInfo) (*endpoint, error) {
+func (nm *networkManager) createEndpoint(ctx context.Context, cli apipaClient, networkID string, epInfo *EndpointInfo) (*endpoint, error) {
 	nm.Lock()
 	defer nm.Unlock()
 
@@ -390,7 +390,7 @@ func (nm *networkManager) createEndpoint(cli apipaClient, networkID string, epIn
 		}
 	}
 
-	ep, err := nw.newEndpoint(cli, nm.netlink, nm.plClient, nm.netio, nm.nsClient, nm.iptablesClient, nm.dhcpClient, epInfo)
+	ep, err := nw.newEndpoint(ctx, cli, nm.netlink, nm.plClient, nm.netio, nm.nsClient, nm.iptablesClient, nm.dhcpClient, epInfo)
 	if err != nil {
 		return nil, err
 	}
@@ -411,7 +411,7 @@ func (nm *networkManager) createEndpoint(cli apipaClient, networkID string, epIn
 
 // CreateEndpoint creates a new container endpoint (this is for compatibility-- add flow should no longer use this).
 func (nm *networkManager) CreateEndpoint(cli apipaClient, networkID string, epInfo *EndpointInfo) error {
-	_, err := nm.createEndpoint(cli, networkID, epInfo)
+	_, err := nm.createEndpoint(context.Background(), cli, networkID, epInfo)
 	return err
 }
 
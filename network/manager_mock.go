@@ -1,6 +1,7 @@
 package network
 
 import (
+	"context"
 	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/common"
 )
@@ -165,7 +166,7 @@ func (nm *MockNetworkManager) SaveState(eps []*endpoint) error {
 	return nil
 }
 
-func (nm *MockNetworkManager) EndpointCreate(client apipaClient, epInfos []*EndpointInfo) error {
+func (nm *MockNetworkManager) EndpointCreate(_ context.Context, client apipaClient, epInfos []*EndpointInfo) error {
 	eps := []*endpoint{}
 	for _, epInfo := range epInfos {
 		_, nwGetErr := nm.GetNetworkInfo(epInfo.NetworkID)
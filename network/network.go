@@ -4,6 +4,7 @@
 package network
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"strings"
@@ -11,7 +12,9 @@ import (
 	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/network/policy"
 	"github.com/Azure/azure-container-networking/platform"
+	"github.com/Azure/azure-container-networking/tracing"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
@@ -313,11 +316,15 @@ func (nm *networkManager) GetNumEndpointsByContainerID(containerID string) int {
 }
 
 // Creates the network and corresponding endpoint (should be called once during Add)
-func (nm *networkManager) EndpointCreate(cnsclient apipaClient, epInfos []*EndpointInfo) error {
+func (nm *networkManager) EndpointCreate(ctx context.Context, cnsclient apipaClient, epInfos []*EndpointInfo) (err error) {
+	ctx, span := tracing.Start(ctx, "networkManager.EndpointCreate")
+	defer func() { tracing.End(span, err) }()
+
 	eps := []*endpoint{} // save endpoints for stateless
 
 	for _, epInfo := range epInfos {
 		logger.Info("Creating endpoint and network", zap.String("endpointInfo", epInfo.PrettyString()))
+		attrs := endpointInfoAttributes(epInfo)
 		// check if network exists by searching through all external interfaces for the network
 		_, nwGetErr := nm.GetNetworkInfo(epInfo.NetworkID)
 		if nwGetErr != nil {
@@ -326,18 +333,25 @@ func (nm *networkManager) EndpointCreate(cnsclient apipaClient, epInfos []*Endpo
 			logger.Info("Found master interface", zap.String("masterIfName", epInfo.MasterIfName))
 
 			// Add the master as an external interface.
-			err := nm.AddExternalInterface(epInfo.MasterIfName, epInfo.HostSubnetPrefix, string(epInfo.NICType))
+			_, extIfSpan := tracing.Start(ctx, "networkManager.AddExternalInterface", attrs...)
+			err = nm.AddExternalInterface(epInfo.MasterIfName, epInfo.HostSubnetPrefix, string(epInfo.NICType))
+			tracing.End(extIfSpan, err)
 			if err != nil {
 				return err
 			}
 
 			// Create the network if it is not found
+			_, nwSpan := tracing.Start(ctx, "networkManager.CreateNetwork", attrs...)
 			err = nm.CreateNetwork(epInfo)
+			tracing.End(nwSpan, err)
 			if err != nil {
 				return err
 			}
 		}
-		ep, err := nm.createEndpoint(cnsclient, epInfo.NetworkID, epInfo)
+		epCtx, epSpan := tracing.Start(ctx, "networkManager.createEndpoint", attrs...)
+		var ep *endpoint
+		ep, err = nm.createEndpoint(epCtx, cnsclient, epInfo.NetworkID, epInfo)
+		tracing.End(epSpan, err)
 		if err != nil {
 			return err
 		}
@@ -345,10 +359,24 @@ func (nm *networkManager) EndpointCreate(cnsclient apipaClient, epInfos []*Endpo
 		eps = append(eps, ep)
 	}
 
-	if err := validateEndpoints(eps); err != nil {
+	if err = validateEndpoints(eps); err != nil {
 		return err
 	}
 
 	// save endpoints
-	return nm.SaveState(eps)
+	_, saveSpan := tracing.Start(ctx, "networkManager.SaveState")
+	err = nm.SaveState(eps)
+	tracing.End(saveSpan, err)
+	return err
+}
+
+// endpointInfoAttributes identifies the network and endpoint being created on a span.
+// The datapath operations behind a span, e.g. netlink and iptables or HNS calls, depend on the network mode.
+func endpointInfoAttributes(epInfo *EndpointInfo) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("network.id", epInfo.NetworkID),
+		attribute.String("network.mode", epInfo.Mode),
+		attribute.String("endpoint.id", epInfo.EndpointID),
+		attribute.String("endpoint.nic_type", string(epInfo.NICType)),
+	}
 }
@@ -184,6 +184,20 @@ func start(config npmconfig.Config, flags npmconfig.Flags) error {
 		}
 
 		npmV2DataplaneCfg.PlaceAzureChainFirst = config.Toggles.PlaceAzureChainFirst
+		// both managers must agree since the ipset manager owns the sets referenced by the policy manager's rules
+		npmV2DataplaneCfg.IPSetManagerCfg.NativeNftables = config.Toggles.EnableNativeNftables && !util.IsWindowsDP()
+		npmV2DataplaneCfg.PolicyManagerCfg.NativeNftables = config.Toggles.EnableNativeNftables && !util.IsWindowsDP()
+		if config.Toggles.EnableBPFPolicyMode && !util.IsWindowsDP() {
+			npmV2DataplaneCfg.PolicyMode = policies.BPFPolicyMode
+		}
+		if config.Toggles.EnableDriftDetection && !util.IsWindowsDP() {
+			if config.DriftDetectionPeriodInMinutes > 0 {
+				npmV2DataplaneCfg.DriftDetectionInterval = time.Duration(config.DriftDetectionPeriodInMinutes) * time.Minute
+			} else {
+				npmV2DataplaneCfg.DriftDetectionInterval = time.Duration(npmconfig.DefaultConfig.DriftDetectionPeriodInMinutes) * time.Minute
+			}
+			npmV2DataplaneCfg.ReapplyOnDrift = config.Toggles.ReapplyOnDrift
+		}
 		if config.Toggles.ApplyIPSetsOnNeed {
 			npmV2DataplaneCfg.IPSetMode = ipsets.ApplyOnNeed
 		} else {
@@ -9,6 +9,7 @@ const (
 	defaultMaxBatchedACLsPerPod = 30
 	defaultMaxPendingNetPols    = 100
 	defaultNetPolInterval       = 500
+	defaultDriftDetectionPeriod = 5
 	defaultListeningPort        = 10091
 	defaultGrpcPort             = 10092
 	defaultGrpcServicePort      = 9002
@@ -40,6 +41,8 @@ var DefaultConfig = Config{
 	MaxPendingNetPols:            defaultMaxPendingNetPols,
 	NetPolInvervalInMilliseconds: defaultNetPolInterval,
 
+	DriftDetectionPeriodInMinutes: defaultDriftDetectionPeriod,
+
 	Toggles: Toggles{
 		EnablePrometheusMetrics: true,
 		EnablePprof:             true,
@@ -52,6 +55,14 @@ var DefaultConfig = Config{
 		// NetPolInBackground is currently used in Linux to apply NetPol controller Add events in the background
 		NetPolInBackground: true,
 		EnableNPMLite:      false,
+		// EnableNativeNftables is currently used in Linux to program nftables directly instead of through iptables and ipset
+		EnableNativeNftables: false,
+		// EnableBPFPolicyMode is currently used in Linux to enforce policies with eBPF programs attached to Pod veths instead of iptables
+		EnableBPFPolicyMode: false,
+		// EnableDriftDetection is currently used in Linux to periodically compare ipsets and iptables in the kernel against NPM's cache
+		EnableDriftDetection: false,
+		// ReapplyOnDrift re-applies drifted ipsets and iptables chains. Relevant when EnableDriftDetection is true.
+		ReapplyOnDrift: false,
 	},
 
 	// Setting LogLevel to "info" by default. Set to "debug" to get application insight logs (creates a listener that outputs diagnosticMessageWriter logs).
@@ -86,6 +97,9 @@ type Config struct {
 	NetPolInvervalInMilliseconds int     `json:"NetPolInvervalInMilliseconds,omitempty"`
 	Toggles                      Toggles `json:"Toggles,omitempty"`
 	LogLevel                     string  `json:"LogLevel,omitempty"`
+
+	// DriftDetectionPeriodInMinutes applies for Linux only. Relevant when EnableDriftDetection is true.
+	DriftDetectionPeriodInMinutes int `json:"DriftDetectionPeriodInMinutes,omitempty"`
 }
 
 type Toggles struct {
@@ -100,6 +114,14 @@ type Toggles struct {
 	// NetPolInBackground
 	NetPolInBackground bool
 	EnableNPMLite      bool
+	// EnableNativeNftables applies for Linux only
+	EnableNativeNftables bool
+	// EnableBPFPolicyMode applies for Linux only and can't be combined with EnableNativeNftables
+	EnableBPFPolicyMode bool
+	// EnableDriftDetection applies for Linux only and is ignored with EnableNativeNftables or EnableBPFPolicyMode
+	EnableDriftDetection bool
+	// ReapplyOnDrift applies for Linux only
+	ReapplyOnDrift bool
 }
 
 type Flags struct {
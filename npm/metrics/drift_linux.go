@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DriftKind is the kind of kernel state which can drift from NPM's cache.
+type DriftKind string
+
+const (
+	IPSetDrift     DriftKind = "ipset"
+	PolicyDrift    DriftKind = "policy"
+	BaseChainDrift DriftKind = "base_chain"
+)
+
+func SetDataplaneDrift(kind DriftKind, count int) {
+	dataplaneDrift.With(prometheus.Labels{driftKindLabel: string(kind)}).Set(float64(count))
+}
+
+func IncDriftCheckFailures() {
+	driftCheckFailures.Inc()
+}
+
+func IncDriftReapplies(kind DriftKind, hadError bool) {
+	labels := getErrorLabels(hadError)
+	labels[driftKindLabel] = string(kind)
+	driftReapplies.With(labels).Inc()
+}
+
+func DataplaneDrift(kind DriftKind) (int, error) {
+	return getVecValue(dataplaneDrift, prometheus.Labels{driftKindLabel: string(kind)})
+}
+
+func TotalDriftCheckFailures() (int, error) {
+	return counterValue(driftCheckFailures)
+}
+
+func TotalDriftReapplies(kind DriftKind, hadError bool) (int, error) {
+	labels := getErrorLabels(hadError)
+	labels[driftKindLabel] = string(kind)
+	return counterValue(driftReapplies.With(labels))
+}
@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetDataplaneDrift(t *testing.T) {
+	SetDataplaneDrift(IPSetDrift, 3)
+	SetDataplaneDrift(PolicyDrift, 1)
+	SetDataplaneDrift(IPSetDrift, 2)
+
+	val, err := DataplaneDrift(IPSetDrift)
+	require.Nil(t, err, "failed to get metric")
+	require.Equal(t, 2, val, "should have the latest ipset drift")
+
+	val, err = DataplaneDrift(PolicyDrift)
+	require.Nil(t, err, "failed to get metric")
+	require.Equal(t, 1, val, "should have the latest policy drift")
+}
+
+func TestIncDriftCheckFailures(t *testing.T) {
+	before, err := TotalDriftCheckFailures()
+	require.Nil(t, err, "failed to get metric")
+	IncDriftCheckFailures()
+	after, err := TotalDriftCheckFailures()
+	require.Nil(t, err, "failed to get metric")
+	require.Equal(t, before+1, after, "should have failed once")
+}
+
+func TestIncDriftReapplies(t *testing.T) {
+	IncDriftReapplies(BaseChainDrift, false)
+	IncDriftReapplies(BaseChainDrift, true)
+	IncDriftReapplies(BaseChainDrift, false)
+
+	count, err := TotalDriftReapplies(BaseChainDrift, false)
+	require.Nil(t, err, "failed to get metric")
+	require.Equal(t, 2, count, "should have reapplied successfully twice")
+
+	count, err = TotalDriftReapplies(BaseChainDrift, true)
+	require.Nil(t, err, "failed to get metric")
+	require.Equal(t, 1, count, "should have failed to reapply once")
+}
@@ -127,6 +127,33 @@ var (
 	iptablesRestoreFailures *prometheus.CounterVec
 )
 
+const driftKindLabel = "kind"
+
+// linux drift detection metrics
+var (
+	dataplaneDrift       *prometheus.GaugeVec
+	driftCheckFailures   prometheus.Counter
+	driftReapplies       *prometheus.CounterVec
+	driftReappliesLabels = []string{driftKindLabel, hadErrorLabel}
+)
+
+const (
+	transportClientLabel    = "client"
+	transportEventTypeLabel = "event_type"
+	transportResumeLabel    = "resumed"
+)
+
+// controller transport metrics
+var (
+	transportEventsSent       *prometheus.CounterVec
+	transportEventsSentLabels = []string{transportClientLabel, transportEventTypeLabel}
+	transportBytesSent        *prometheus.CounterVec
+	transportSendFailures     *prometheus.CounterVec
+	transportClientLabels     = []string{transportClientLabel}
+	transportReconnects       *prometheus.CounterVec
+	transportReconnectsLabels = []string{transportResumeLabel}
+)
+
 type RegistryType string
 
 const (
@@ -196,6 +223,9 @@ func InitializeAll() {
 		register(itpablesRestoreLatency, "iptables_restore_latency_seconds", NodeMetrics)
 		register(iptablesDeleteLatency, "iptables_delete_latency_seconds", NodeMetrics)
 		register(iptablesRestoreFailures, "iptables_restore_failure_total", NodeMetrics)
+		register(dataplaneDrift, "dataplane_drift", NodeMetrics)
+		register(driftCheckFailures, "drift_check_failure_total", NodeMetrics)
+		register(driftReapplies, "drift_reapply_total", NodeMetrics)
 	}
 
 	log.Logf("Finished initializing all Prometheus metrics")
@@ -354,6 +384,35 @@ func InitializeLinuxMetrics() {
 		},
 		[]string{operationLabel},
 	)
+
+	dataplaneDrift = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "dataplane_drift",
+			Subsystem: linuxPrefix,
+			Help:      "Number of ipsets or iptables chains in the kernel which differed from NPM's cache during the last drift check, by kind label (ipset/policy/base_chain)",
+		},
+		[]string{driftKindLabel},
+	)
+
+	driftCheckFailures = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "drift_check_failure_total",
+			Subsystem: linuxPrefix,
+			Help:      "Number of failures while reading ipsets or iptables from the kernel to check for drift",
+		},
+	)
+
+	driftReapplies = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "drift_reapply_total",
+			Subsystem: linuxPrefix,
+			Help:      "Number of re-applies of drifted ipsets or iptables chains, by kind label (ipset/policy/base_chain)",
+		},
+		driftReappliesLabels,
+	)
 }
 
 // GetHandler returns the HTTP handler for the metrics endpoint
@@ -393,6 +452,12 @@ func initializeControllerMetrics() {
 	controllerPolicyExecTime = createControllerExecTimeSummaryVec(policyExecTimeName, controllerPolicyExecTimeHelp)
 	controllerPodExecTime = createControllerExecTimeSummaryVec(podExecTimeName, controllerPodExecTimeHelp)
 	controllerNamespaceExecTime = createControllerExecTimeSummaryVec(namespaceExecTimeName, controllerNamespaceExecTimeHelp)
+
+	// transport metrics for the controller in fan-out mode
+	transportEventsSent = createControllerCounterVec("transport_events_sent_total", "Number of events sent to each datapath client, by client and event_type labels", transportEventsSentLabels)
+	transportBytesSent = createControllerCounterVec("transport_bytes_sent_total", "Number of bytes of events sent to each datapath client", transportClientLabels)
+	transportSendFailures = createControllerCounterVec("transport_send_failure_total", "Number of failures while sending an event to each datapath client", transportClientLabels)
+	transportReconnects = createControllerCounterVec("transport_reconnect_total", "Number of datapath client connections, by whether the client resumed from its last sequence number or was hydrated", transportReconnectsLabels)
 }
 
 func register(collector prometheus.Collector, name string, registryType RegistryType) {
@@ -466,6 +531,20 @@ func createNodeSummaryVec(name, subsystem, helpMessage string, labels []string)
 	return summary
 }
 
+func createControllerCounterVec(name, helpMessage string, labels []string) *prometheus.CounterVec {
+	counterVec := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: controllerPrefix,
+			Name:      name,
+			Help:      helpMessage,
+		},
+		labels,
+	)
+	register(counterVec, name, NodeMetrics)
+	return counterVec
+}
+
 func createControllerExecTimeSummaryVec(name, helpMessage string) *prometheus.SummaryVec {
 	return createNodeSummaryVec(name, controllerPrefix, helpMessage, controllerExecTimeLabels)
 }
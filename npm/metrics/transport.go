@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RecordTransportEventSent records an event of the given type and size sent to a datapath client.
+func RecordTransportEventSent(client, eventType string, numBytes int) {
+	transportEventsSent.With(prometheus.Labels{transportClientLabel: client, transportEventTypeLabel: eventType}).Inc()
+	transportBytesSent.With(prometheus.Labels{transportClientLabel: client}).Add(float64(numBytes))
+}
+
+// IncTransportSendFailures increments the number of failed sends to a datapath client.
+func IncTransportSendFailures(client string) {
+	transportSendFailures.With(prometheus.Labels{transportClientLabel: client}).Inc()
+}
+
+// IncTransportReconnects increments the number of datapath client connections.
+// resumed is true if the client resumed from its last sequence number instead of being hydrated.
+func IncTransportReconnects(resumed bool) {
+	transportReconnects.With(prometheus.Labels{transportResumeLabel: strconv.FormatBool(resumed)}).Inc()
+}
+
+// DeleteTransportClient removes the metrics of a datapath client which is no longer tracked.
+func DeleteTransportClient(client string) {
+	transportEventsSent.DeletePartialMatch(prometheus.Labels{transportClientLabel: client})
+	transportBytesSent.DeletePartialMatch(prometheus.Labels{transportClientLabel: client})
+	transportSendFailures.DeletePartialMatch(prometheus.Labels{transportClientLabel: client})
+}
+
+// TotalTransportEventsSent returns the number of events of the given type sent to a datapath client.
+// This function is slow.
+func TotalTransportEventsSent(client, eventType string) (int, error) {
+	return counterValue(transportEventsSent.With(prometheus.Labels{transportClientLabel: client, transportEventTypeLabel: eventType}))
+}
+
+// TotalTransportBytesSent returns the number of bytes sent to a datapath client.
+// This function is slow.
+func TotalTransportBytesSent(client string) (int, error) {
+	return counterValue(transportBytesSent.With(prometheus.Labels{transportClientLabel: client}))
+}
+
+// TotalTransportSendFailures returns the number of failed sends to a datapath client.
+// This function is slow.
+func TotalTransportSendFailures(client string) (int, error) {
+	return counterValue(transportSendFailures.With(prometheus.Labels{transportClientLabel: client}))
+}
+
+// TotalTransportReconnects returns the number of datapath client connections which resumed or were hydrated.
+// This function is slow.
+func TotalTransportReconnects(resumed bool) (int, error) {
+	return counterValue(transportReconnects.With(prometheus.Labels{transportResumeLabel: strconv.FormatBool(resumed)}))
+}
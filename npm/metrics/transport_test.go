@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordTransportEventSent(t *testing.T) {
+	RecordTransportEventSent("npm-a", "Hydration", 100)
+	RecordTransportEventSent("npm-a", "GoalState", 20)
+	RecordTransportEventSent("npm-a", "GoalState", 30)
+	RecordTransportEventSent("npm-b", "GoalState", 5)
+
+	count, err := TotalTransportEventsSent("npm-a", "GoalState")
+	require.Nil(t, err, "failed to get metric")
+	require.Equal(t, 2, count, "should have sent two goal state events")
+
+	bytes, err := TotalTransportBytesSent("npm-a")
+	require.Nil(t, err, "failed to get metric")
+	require.Equal(t, 150, bytes, "should count the bytes of every event type")
+
+	DeleteTransportClient("npm-a")
+	bytes, err = TotalTransportBytesSent("npm-a")
+	require.Nil(t, err, "failed to get metric")
+	require.Equal(t, 0, bytes, "should reset the metrics of a deleted client")
+
+	bytes, err = TotalTransportBytesSent("npm-b")
+	require.Nil(t, err, "failed to get metric")
+	require.Equal(t, 5, bytes, "should keep the metrics of other clients")
+}
+
+func TestIncTransportReconnects(t *testing.T) {
+	before, err := TotalTransportReconnects(true)
+	require.Nil(t, err, "failed to get metric")
+	IncTransportReconnects(true)
+	IncTransportReconnects(false)
+	after, err := TotalTransportReconnects(true)
+	require.Nil(t, err, "failed to get metric")
+	require.Equal(t, before+1, after, "should have resumed once")
+}
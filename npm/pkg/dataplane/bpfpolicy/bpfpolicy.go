@@ -0,0 +1,159 @@
+// Package bpfpolicy programs the eBPF maps read by NPM's tc programs (see bpf-prog/azure-npm-policy).
+// It knows nothing about NetworkPolicies or ipsets: the IPSetManager writes Sets and the PolicyManager writes Endpoints.
+package bpfpolicy
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/netip"
+)
+
+// These limits must match bpf-prog/azure-npm-policy/bpf/src/npm_policy.bpf.c.
+const (
+	// MaxRulesPerDirection is the maximum number of ingress (or egress) rules for one endpoint.
+	MaxRulesPerDirection = 64
+	// MaxSetsPerRule is the maximum number of set matches in one rule.
+	MaxSetsPerRule = 8
+)
+
+// DefaultObjectPath is where the NPM image places the compiled tc programs.
+const DefaultObjectPath = "/usr/lib/azure-npm/npm_policy.bpf.o"
+
+var (
+	ErrUnsupported      = errors.New("eBPF policy mode is only supported on Linux")
+	ErrTooManyRules     = errors.New("too many rules for endpoint")
+	ErrTooManySets      = errors.New("too many sets in rule")
+	ErrInvalidEndpoint  = errors.New("endpoint must have an IPv4 address")
+	ErrNoVethForAddress = errors.New("no veth routes to endpoint")
+)
+
+// Direction is relative to the endpoint. Values are used as map keys.
+type Direction uint32
+
+const (
+	// Ingress is traffic sent to the endpoint.
+	Ingress Direction = 0
+	// Egress is traffic sent by the endpoint.
+	Egress Direction = 1
+)
+
+// SetKind decides which map holds a set's members. Values are used in map values.
+type SetKind uint8
+
+const (
+	// HashSetKind sets are a hash map of IPs. Lists are flattened into a hash set of their members' IPs.
+	HashSetKind SetKind = 1
+	// CIDRSetKind sets are an LPM trie of CIDRs, where the most specific CIDR decides whether an IP matches.
+	CIDRSetKind SetKind = 2
+	// NamedPortSetKind sets are a hash map of IP, protocol, and port.
+	NamedPortSetKind SetKind = 3
+)
+
+// Protocol numbers used in rules and named port members. Zero matches any protocol in a rule.
+const (
+	AnyProtocol  uint8 = 0
+	TCPProtocol  uint8 = 6
+	UDPProtocol  uint8 = 17
+	SCTPProtocol uint8 = 132
+)
+
+// SetID identifies a set in the maps. It is derived from the set's prefixed name.
+func SetID(prefixedName string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(prefixedName))
+	return h.Sum32()
+}
+
+// CIDR is a member of a CIDRSetKind set. NoMatch excludes the CIDR from a less specific CIDR in the set.
+type CIDR struct {
+	Prefix  netip.Prefix
+	NoMatch bool
+}
+
+// NamedPort is a member of a NamedPortSetKind set.
+type NamedPort struct {
+	IP       netip.Addr
+	Protocol uint8
+	Port     uint16
+}
+
+// Set holds the members of one set. Only the members for the set's Kind are used.
+type Set struct {
+	ID         uint32
+	Kind       SetKind
+	IPs        []netip.Addr
+	CIDRs      []CIDR
+	NamedPorts []NamedPort
+}
+
+// SetMatch requires the source or destination of a packet to be in (or not in) a set.
+// NamedPortSetKind sets always match the destination.
+type SetMatch struct {
+	SetID    uint32
+	Kind     SetKind
+	Included bool
+	Dst      bool
+}
+
+// Rule is one ACL. A PortStart of zero matches any port.
+type Rule struct {
+	Allow     bool
+	Protocol  uint8
+	PortStart uint16
+	PortEnd   uint16
+	Matches   []SetMatch
+}
+
+// Endpoint holds the rules of all policies selecting a Pod IP on this node.
+// For each direction, traffic is allowed if any rule allows it, otherwise dropped if any rule drops it, otherwise allowed.
+// This is the same verdict as NPM's iptables chains, where allow rules of any policy override drop rules.
+type Endpoint struct {
+	IP      netip.Addr
+	Ingress []Rule
+	Egress  []Rule
+}
+
+// Rules returns the endpoint's rules for a direction.
+func (ep *Endpoint) Rules(direction Direction) []Rule {
+	if direction == Ingress {
+		return ep.Ingress
+	}
+	return ep.Egress
+}
+
+// Validate checks that the endpoint fits in the maps.
+func (ep *Endpoint) Validate() error {
+	if !ep.IP.Is4() {
+		return fmt.Errorf("%w: %s", ErrInvalidEndpoint, ep.IP)
+	}
+	for _, direction := range []Direction{Ingress, Egress} {
+		rules := ep.Rules(direction)
+		if len(rules) > MaxRulesPerDirection {
+			return fmt.Errorf("%w: endpoint %s has %d rules for direction %d (max %d)", ErrTooManyRules, ep.IP, len(rules), direction, MaxRulesPerDirection)
+		}
+		for i := range rules {
+			if len(rules[i].Matches) > MaxSetsPerRule {
+				return fmt.Errorf("%w: endpoint %s has %d sets in rule %d (max %d)", ErrTooManySets, ep.IP, len(rules[i].Matches), i, MaxSetsPerRule)
+			}
+		}
+	}
+	return nil
+}
+
+// Maps programs NPM's eBPF maps and attaches the tc programs to endpoints.
+// Implementations must be safe for concurrent use since the IPSetManager and PolicyManager have separate locks.
+type Maps interface {
+	// Reset detaches the programs from all interfaces and empties all maps.
+	Reset() error
+	// ReplaceSet replaces all members of a set.
+	ReplaceSet(set *Set) error
+	// DeleteSet removes all members of a set.
+	DeleteSet(id uint32) error
+	// ReplaceEndpoint replaces all rules of an endpoint and attaches the programs to its veth if needed.
+	ReplaceEndpoint(ep *Endpoint) error
+	// DeleteEndpoint removes all rules of an endpoint and detaches the programs from its veth.
+	DeleteEndpoint(ip netip.Addr) error
+	// Close releases the loaded programs and maps. Attached programs keep running.
+	Close() error
+}
@@ -0,0 +1,145 @@
+package bpfpolicy
+
+import "net/netip"
+
+// The following structs mirror the keys and values in npm_policy.bpf.c.
+// Padding is explicit so that the Go and C layouts are identical.
+
+const (
+	targetAllow uint8 = 1
+	targetDrop  uint8 = 2
+
+	matchSrc uint8 = 0
+	matchDst uint8 = 1
+
+	// the set ID is part of every LPM key, so it is always matched in full
+	cidrKeySetIDBits = 32
+)
+
+type endpointValue struct {
+	NumRules [2]uint32
+}
+
+type ruleKey struct {
+	EndpointIP [4]byte
+	Direction  uint32
+	Index      uint32
+}
+
+type setMatchValue struct {
+	SetID    uint32
+	Kind     uint8
+	Included uint8
+	Match    uint8
+	Pad      uint8
+}
+
+type ruleValue struct {
+	Target    uint8
+	Protocol  uint8
+	PortStart uint16
+	PortEnd   uint16
+	NumSets   uint8
+	Pad       uint8
+	Sets      [MaxSetsPerRule]setMatchValue
+}
+
+type hashSetKey struct {
+	SetID uint32
+	IP    [4]byte
+}
+
+type cidrSetKey struct {
+	PrefixLen uint32
+	SetID     uint32
+	IP        [4]byte
+}
+
+type namedPortKey struct {
+	SetID    uint32
+	IP       [4]byte
+	Port     uint16
+	Protocol uint8
+	Pad      uint8
+}
+
+// setEntries holds the map entries for a set. Keys are comparable so that stale entries can be found by difference.
+type setEntries struct {
+	hash       map[hashSetKey]uint8
+	cidr       map[cidrSetKey]uint8
+	namedPorts map[namedPortKey]uint8
+}
+
+func entriesForSet(set *Set) *setEntries {
+	entries := &setEntries{
+		hash:       make(map[hashSetKey]uint8),
+		cidr:       make(map[cidrSetKey]uint8),
+		namedPorts: make(map[namedPortKey]uint8),
+	}
+	switch set.Kind {
+	case HashSetKind:
+		for _, ip := range set.IPs {
+			if ip.Is4() {
+				entries.hash[hashSetKey{SetID: set.ID, IP: ip.As4()}] = 1
+			}
+		}
+	case CIDRSetKind:
+		for _, member := range set.CIDRs {
+			if !member.Prefix.Addr().Is4() {
+				continue
+			}
+			prefix := member.Prefix.Masked()
+			key := cidrSetKey{
+				PrefixLen: uint32(cidrKeySetIDBits + prefix.Bits()),
+				SetID:     set.ID,
+				IP:        prefix.Addr().As4(),
+			}
+			if member.NoMatch {
+				entries.cidr[key] = 0
+			} else {
+				entries.cidr[key] = 1
+			}
+		}
+	case NamedPortSetKind:
+		for _, member := range set.NamedPorts {
+			if member.IP.Is4() {
+				entries.namedPorts[namedPortKey{SetID: set.ID, IP: member.IP.As4(), Port: member.Port, Protocol: member.Protocol}] = 1
+			}
+		}
+	}
+	return entries
+}
+
+func valueForRule(rule *Rule) ruleValue {
+	value := ruleValue{
+		Target:    targetDrop,
+		Protocol:  rule.Protocol,
+		PortStart: rule.PortStart,
+		PortEnd:   rule.PortEnd,
+		NumSets:   uint8(len(rule.Matches)),
+	}
+	if rule.Allow {
+		value.Target = targetAllow
+	}
+	for i, match := range rule.Matches {
+		if i >= MaxSetsPerRule {
+			break
+		}
+		value.Sets[i] = setMatchValue{
+			SetID: match.SetID,
+			Kind:  uint8(match.Kind),
+			Match: matchSrc,
+		}
+		if match.Included {
+			value.Sets[i].Included = 1
+		}
+		if match.Dst {
+			value.Sets[i].Match = matchDst
+		}
+	}
+	return value
+}
+
+func keyForRule(ip netip.Addr, direction Direction, index int) ruleKey {
+	return ruleKey{EndpointIP: ip.As4(), Direction: uint32(direction), Index: uint32(index)}
+}
@@ -0,0 +1,122 @@
+package bpfpolicy
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLayoutsMatchProgram(t *testing.T) {
+	// sizes of the structs in npm_policy.bpf.c
+	require.Equal(t, 8, binary.Size(endpointValue{}))
+	require.Equal(t, 12, binary.Size(ruleKey{}))
+	require.Equal(t, 8, binary.Size(setMatchValue{}))
+	require.Equal(t, 8+8*MaxSetsPerRule, binary.Size(ruleValue{}))
+	require.Equal(t, 8, binary.Size(hashSetKey{}))
+	require.Equal(t, 12, binary.Size(cidrSetKey{}))
+	require.Equal(t, 12, binary.Size(namedPortKey{}))
+}
+
+func TestEntriesForSet(t *testing.T) {
+	cidrSet := &Set{
+		ID:   7,
+		Kind: CIDRSetKind,
+		CIDRs: []CIDR{
+			{Prefix: netip.MustParsePrefix("10.0.0.0/16")},
+			{Prefix: netip.MustParsePrefix("10.0.1.5/24"), NoMatch: true},
+		},
+	}
+	entries := entriesForSet(cidrSet)
+	require.Equal(t, map[cidrSetKey]uint8{
+		{PrefixLen: 48, SetID: 7, IP: [4]byte{10, 0, 0, 0}}: 1,
+		{PrefixLen: 56, SetID: 7, IP: [4]byte{10, 0, 1, 0}}: 0,
+	}, entries.cidr)
+	require.Empty(t, entries.hash)
+	require.Empty(t, entries.namedPorts)
+
+	hashSet := &Set{ID: 8, Kind: HashSetKind, IPs: []netip.Addr{netip.MustParseAddr("10.0.0.1")}}
+	require.Equal(t, map[hashSetKey]uint8{{SetID: 8, IP: [4]byte{10, 0, 0, 1}}: 1}, entriesForSet(hashSet).hash)
+
+	namedPortSet := &Set{
+		ID:         9,
+		Kind:       NamedPortSetKind,
+		NamedPorts: []NamedPort{{IP: netip.MustParseAddr("10.0.0.1"), Protocol: TCPProtocol, Port: 8080}},
+	}
+	require.Equal(t, map[namedPortKey]uint8{{SetID: 9, IP: [4]byte{10, 0, 0, 1}, Port: 8080, Protocol: 6}: 1}, entriesForSet(namedPortSet).namedPorts)
+}
+
+func TestValueForRule(t *testing.T) {
+	rule := &Rule{
+		Allow:     true,
+		Protocol:  TCPProtocol,
+		PortStart: 80,
+		PortEnd:   90,
+		Matches: []SetMatch{
+			{SetID: 1, Kind: HashSetKind, Included: true},
+			{SetID: 2, Kind: CIDRSetKind, Included: false, Dst: true},
+		},
+	}
+	value := valueForRule(rule)
+	require.Equal(t, targetAllow, value.Target)
+	require.Equal(t, uint8(6), value.Protocol)
+	require.Equal(t, uint16(80), value.PortStart)
+	require.Equal(t, uint16(90), value.PortEnd)
+	require.Equal(t, uint8(2), value.NumSets)
+	require.Equal(t, setMatchValue{SetID: 1, Kind: 1, Included: 1, Match: matchSrc}, value.Sets[0])
+	require.Equal(t, setMatchValue{SetID: 2, Kind: 2, Included: 0, Match: matchDst}, value.Sets[1])
+
+	require.Equal(t, targetDrop, valueForRule(&Rule{}).Target)
+}
+
+func TestValidateEndpoint(t *testing.T) {
+	ep := &Endpoint{IP: netip.MustParseAddr("10.0.0.1"), Ingress: make([]Rule, MaxRulesPerDirection)}
+	require.NoError(t, ep.Validate())
+
+	ep.Egress = make([]Rule, MaxRulesPerDirection+1)
+	require.ErrorIs(t, ep.Validate(), ErrTooManyRules)
+
+	ep.Egress = []Rule{{Matches: make([]SetMatch, MaxSetsPerRule+1)}}
+	require.ErrorIs(t, ep.Validate(), ErrTooManySets)
+
+	ep = &Endpoint{IP: netip.MustParseAddr("fd00::1")}
+	require.ErrorIs(t, ep.Validate(), ErrInvalidEndpoint)
+}
+
+func TestFakeMapsAllows(t *testing.T) {
+	f := NewFakeMaps()
+	podIP := netip.MustParseAddr("10.0.0.1")
+	require.NoError(t, f.ReplaceSet(&Set{
+		ID:   1,
+		Kind: CIDRSetKind,
+		CIDRs: []CIDR{
+			{Prefix: netip.MustParsePrefix("10.1.0.0/16")},
+			{Prefix: netip.MustParsePrefix("10.1.2.0/24"), NoMatch: true},
+		},
+	}))
+	require.NoError(t, f.ReplaceEndpoint(&Endpoint{
+		IP: podIP,
+		Ingress: []Rule{
+			{Allow: true, Protocol: TCPProtocol, PortStart: 80, PortEnd: 80, Matches: []SetMatch{{SetID: 1, Kind: CIDRSetKind, Included: true}}},
+			{Allow: false},
+		},
+	}))
+
+	allowed := Packet{Src: netip.MustParseAddr("10.1.1.1"), Dst: podIP, Protocol: TCPProtocol, DstPort: 80}
+	require.True(t, f.Allows(podIP, Ingress, allowed))
+
+	wrongPort := allowed
+	wrongPort.DstPort = 81
+	require.False(t, f.Allows(podIP, Ingress, wrongPort))
+
+	excluded := allowed
+	excluded.Src = netip.MustParseAddr("10.1.2.1")
+	require.False(t, f.Allows(podIP, Ingress, excluded))
+
+	// no egress rules
+	require.True(t, f.Allows(podIP, Egress, Packet{Src: podIP, Dst: netip.MustParseAddr("8.8.8.8"), Protocol: UDPProtocol, DstPort: 53}))
+
+	require.NoError(t, f.DeleteEndpoint(podIP))
+	require.True(t, f.Allows(podIP, Ingress, wrongPort))
+}
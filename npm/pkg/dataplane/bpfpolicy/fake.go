@@ -0,0 +1,166 @@
+package bpfpolicy
+
+import (
+	"net/netip"
+	"sync"
+)
+
+// FakeMaps keeps the maps in memory and evaluates packets the same way as the tc programs.
+type FakeMaps struct {
+	sync.Mutex
+	Sets      map[uint32]*Set
+	Endpoints map[netip.Addr]*Endpoint
+	NumResets int
+	// Err is returned by every call if set
+	Err error
+}
+
+// Packet is the part of a packet which the tc programs look at.
+type Packet struct {
+	Src      netip.Addr
+	Dst      netip.Addr
+	Protocol uint8
+	DstPort  uint16
+}
+
+func NewFakeMaps() *FakeMaps {
+	return &FakeMaps{
+		Sets:      make(map[uint32]*Set),
+		Endpoints: make(map[netip.Addr]*Endpoint),
+	}
+}
+
+func (f *FakeMaps) Reset() error {
+	f.Lock()
+	defer f.Unlock()
+	if f.Err != nil {
+		return f.Err
+	}
+	f.Sets = make(map[uint32]*Set)
+	f.Endpoints = make(map[netip.Addr]*Endpoint)
+	f.NumResets++
+	return nil
+}
+
+func (f *FakeMaps) ReplaceSet(set *Set) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.Err != nil {
+		return f.Err
+	}
+	f.Sets[set.ID] = set
+	return nil
+}
+
+func (f *FakeMaps) DeleteSet(id uint32) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.Err != nil {
+		return f.Err
+	}
+	delete(f.Sets, id)
+	return nil
+}
+
+func (f *FakeMaps) ReplaceEndpoint(ep *Endpoint) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.Err != nil {
+		return f.Err
+	}
+	if err := ep.Validate(); err != nil {
+		return err
+	}
+	f.Endpoints[ep.IP] = ep
+	return nil
+}
+
+func (f *FakeMaps) DeleteEndpoint(ip netip.Addr) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.Err != nil {
+		return f.Err
+	}
+	delete(f.Endpoints, ip)
+	return nil
+}
+
+func (f *FakeMaps) Close() error {
+	return nil
+}
+
+// Allows returns whether the tc programs would allow the packet for the endpoint and direction.
+// Flow tracking is not emulated, so this is the verdict for the first packet of a connection.
+func (f *FakeMaps) Allows(endpoint netip.Addr, direction Direction, pkt Packet) bool {
+	f.Lock()
+	defer f.Unlock()
+
+	ep, ok := f.Endpoints[endpoint]
+	if !ok {
+		return true
+	}
+	dropped := false
+	for _, rule := range ep.Rules(direction) {
+		if !f.ruleMatches(&rule, pkt) {
+			continue
+		}
+		if rule.Allow {
+			return true
+		}
+		dropped = true
+	}
+	return !dropped
+}
+
+func (f *FakeMaps) ruleMatches(rule *Rule, pkt Packet) bool {
+	if rule.Protocol != AnyProtocol && rule.Protocol != pkt.Protocol {
+		return false
+	}
+	if rule.PortStart != 0 && (pkt.DstPort < rule.PortStart || pkt.DstPort > rule.PortEnd) {
+		return false
+	}
+	for _, match := range rule.Matches {
+		if f.setContains(match, pkt) != match.Included {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *FakeMaps) setContains(match SetMatch, pkt Packet) bool {
+	set, ok := f.Sets[match.SetID]
+	if !ok || set.Kind != match.Kind {
+		return false
+	}
+	ip := pkt.Src
+	if match.Dst || match.Kind == NamedPortSetKind {
+		ip = pkt.Dst
+	}
+
+	switch set.Kind {
+	case HashSetKind:
+		for _, member := range set.IPs {
+			if member == ip {
+				return true
+			}
+		}
+	case CIDRSetKind:
+		// longest prefix match
+		bestBits := -1
+		matched := false
+		for _, member := range set.CIDRs {
+			if member.Prefix.Contains(ip) && member.Prefix.Bits() > bestBits {
+				bestBits = member.Prefix.Bits()
+				matched = !member.NoMatch
+			}
+		}
+		return matched
+	case NamedPortSetKind:
+		for _, member := range set.NamedPorts {
+			if member.IP == ip && member.Protocol == pkt.Protocol && member.Port == pkt.DstPort {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,375 @@
+package bpfpolicy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/rlimit"
+	"github.com/vishvananda/netlink"
+	"k8s.io/klog"
+)
+
+const (
+	toPodProgram   = "npm_to_pod"
+	fromPodProgram = "npm_from_pod"
+
+	endpointsMap      = "npm_endpoints"
+	rulesMap          = "npm_rules"
+	hashSetsMap       = "npm_hash_sets"
+	cidrSetsMap       = "npm_cidr_sets"
+	namedPortSetsMap  = "npm_named_port_sets"
+	hostIPsMap        = "npm_host_ips"
+	flowsMap          = "npm_flows"
+	filterNamePrefix  = "azure_npm_"
+	toPodFilterName   = filterNamePrefix + "to_pod"
+	fromPodFilterName = filterNamePrefix + "from_pod"
+)
+
+// kernelMaps programs the maps of the tc programs loaded from an object file.
+// Maps aren't pinned. Attached filters keep the programs and maps alive until Reset() detaches them after a restart.
+type kernelMaps struct {
+	sync.Mutex
+	collection *ebpf.Collection
+	// sets holds the entries last written for each set
+	sets map[uint32]*setEntries
+	// numRules holds the number of rules last written for each endpoint and direction
+	numRules map[netip.Addr][2]int
+	// links holds the index of the veth each endpoint's programs are attached to
+	links map[netip.Addr]int
+}
+
+// NewMaps loads the tc programs and their maps from the object file.
+func NewMaps(objectPath string) (Maps, error) {
+	if err := rlimit.RemoveMemlock(); err != nil {
+		return nil, fmt.Errorf("failed to remove memlock limit: %w", err)
+	}
+	spec, err := ebpf.LoadCollectionSpec(objectPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load eBPF object %s: %w", objectPath, err)
+	}
+	collection, err := ebpf.NewCollection(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load eBPF programs and maps from %s: %w", objectPath, err)
+	}
+	for _, name := range []string{toPodProgram, fromPodProgram} {
+		if collection.Programs[name] == nil {
+			collection.Close()
+			return nil, fmt.Errorf("eBPF object %s is missing program %s", objectPath, name) //nolint:goerr113 // unexpected object file
+		}
+	}
+	for _, name := range []string{endpointsMap, rulesMap, hashSetsMap, cidrSetsMap, namedPortSetsMap, hostIPsMap, flowsMap} {
+		if collection.Maps[name] == nil {
+			collection.Close()
+			return nil, fmt.Errorf("eBPF object %s is missing map %s", objectPath, name) //nolint:goerr113 // unexpected object file
+		}
+	}
+
+	return &kernelMaps{
+		collection: collection,
+		sets:       make(map[uint32]*setEntries),
+		numRules:   make(map[netip.Addr][2]int),
+		links:      make(map[netip.Addr]int),
+	}, nil
+}
+
+func (k *kernelMaps) Reset() error {
+	k.Lock()
+	defer k.Unlock()
+
+	// detach NPM's filters from every link, including ones attached before a restart
+	links, err := netlink.LinkList()
+	if err != nil {
+		return fmt.Errorf("failed to list links: %w", err)
+	}
+	for _, link := range links {
+		if err := detachFilters(link.Attrs().Index); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range []string{endpointsMap, rulesMap, hashSetsMap, cidrSetsMap, namedPortSetsMap, hostIPsMap, flowsMap} {
+		if err := clearMap(k.collection.Maps[name]); err != nil {
+			return fmt.Errorf("failed to clear map %s: %w", name, err)
+		}
+	}
+	k.sets = make(map[uint32]*setEntries)
+	k.numRules = make(map[netip.Addr][2]int)
+	k.links = make(map[netip.Addr]int)
+
+	addrs, err := netlink.AddrList(nil, netlink.FAMILY_V4)
+	if err != nil {
+		return fmt.Errorf("failed to list host IPs: %w", err)
+	}
+	hostIPs := k.collection.Maps[hostIPsMap]
+	for i := range addrs {
+		ip, ok := netip.AddrFromSlice(addrs[i].IP.To4())
+		if !ok {
+			continue
+		}
+		if err := hostIPs.Update(ip.As4(), uint8(1), ebpf.UpdateAny); err != nil {
+			return fmt.Errorf("failed to add host IP %s: %w", ip, err)
+		}
+	}
+	return nil
+}
+
+func (k *kernelMaps) ReplaceSet(set *Set) error {
+	k.Lock()
+	defer k.Unlock()
+
+	entries := entriesForSet(set)
+	old := k.sets[set.ID]
+	// add the new entries before removing stale ones so that unchanged members always match
+	if err := updateEntries(k.collection.Maps[hashSetsMap], entries.hash); err != nil {
+		return err
+	}
+	if err := updateEntries(k.collection.Maps[cidrSetsMap], entries.cidr); err != nil {
+		return err
+	}
+	if err := updateEntries(k.collection.Maps[namedPortSetsMap], entries.namedPorts); err != nil {
+		return err
+	}
+	if old != nil {
+		if err := deleteStaleEntries(k.collection.Maps[hashSetsMap], old.hash, entries.hash); err != nil {
+			return err
+		}
+		if err := deleteStaleEntries(k.collection.Maps[cidrSetsMap], old.cidr, entries.cidr); err != nil {
+			return err
+		}
+		if err := deleteStaleEntries(k.collection.Maps[namedPortSetsMap], old.namedPorts, entries.namedPorts); err != nil {
+			return err
+		}
+	}
+	k.sets[set.ID] = entries
+	return nil
+}
+
+func (k *kernelMaps) DeleteSet(id uint32) error {
+	k.Lock()
+	defer k.Unlock()
+
+	old, ok := k.sets[id]
+	if !ok {
+		return nil
+	}
+	if err := deleteStaleEntries(k.collection.Maps[hashSetsMap], old.hash, nil); err != nil {
+		return err
+	}
+	if err := deleteStaleEntries(k.collection.Maps[cidrSetsMap], old.cidr, nil); err != nil {
+		return err
+	}
+	if err := deleteStaleEntries(k.collection.Maps[namedPortSetsMap], old.namedPorts, nil); err != nil {
+		return err
+	}
+	delete(k.sets, id)
+	return nil
+}
+
+func (k *kernelMaps) ReplaceEndpoint(ep *Endpoint) error {
+	if err := ep.Validate(); err != nil {
+		return err
+	}
+
+	k.Lock()
+	defer k.Unlock()
+
+	// write the rules, then the new rule counts, then delete rules past the new counts
+	rules := k.collection.Maps[rulesMap]
+	oldNumRules := k.numRules[ep.IP]
+	var value endpointValue
+	for _, direction := range []Direction{Ingress, Egress} {
+		epRules := ep.Rules(direction)
+		for i := range epRules {
+			if err := rules.Update(keyForRule(ep.IP, direction, i), valueForRule(&epRules[i]), ebpf.UpdateAny); err != nil {
+				return fmt.Errorf("failed to update rule %d for endpoint %s: %w", i, ep.IP, err)
+			}
+		}
+		value.NumRules[direction] = uint32(len(epRules))
+	}
+	if err := k.collection.Maps[endpointsMap].Update(ep.IP.As4(), value, ebpf.UpdateAny); err != nil {
+		return fmt.Errorf("failed to update endpoint %s: %w", ep.IP, err)
+	}
+	newNumRules := [2]int{len(ep.Ingress), len(ep.Egress)}
+	k.numRules[ep.IP] = newNumRules
+	for _, direction := range []Direction{Ingress, Egress} {
+		for i := newNumRules[direction]; i < oldNumRules[direction]; i++ {
+			if err := rules.Delete(keyForRule(ep.IP, direction, i)); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+				return fmt.Errorf("failed to delete rule %d for endpoint %s: %w", i, ep.IP, err)
+			}
+		}
+	}
+
+	if _, ok := k.links[ep.IP]; ok {
+		return nil
+	}
+	linkIndex, err := vethForAddress(ep.IP)
+	if err != nil {
+		return err
+	}
+	if err := k.attach(linkIndex); err != nil {
+		return err
+	}
+	k.links[ep.IP] = linkIndex
+	return nil
+}
+
+func (k *kernelMaps) DeleteEndpoint(ip netip.Addr) error {
+	k.Lock()
+	defer k.Unlock()
+
+	if linkIndex, ok := k.links[ip]; ok {
+		if err := detachFilters(linkIndex); err != nil {
+			return err
+		}
+		delete(k.links, ip)
+	}
+
+	if err := k.collection.Maps[endpointsMap].Delete(ip.As4()); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+		return fmt.Errorf("failed to delete endpoint %s: %w", ip, err)
+	}
+	numRules := k.numRules[ip]
+	for _, direction := range []Direction{Ingress, Egress} {
+		for i := 0; i < numRules[direction]; i++ {
+			if err := k.collection.Maps[rulesMap].Delete(keyForRule(ip, direction, i)); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+				return fmt.Errorf("failed to delete rule %d for endpoint %s: %w", i, ip, err)
+			}
+		}
+	}
+	delete(k.numRules, ip)
+	return nil
+}
+
+func (k *kernelMaps) Close() error {
+	k.collection.Close()
+	return nil
+}
+
+func (k *kernelMaps) attach(linkIndex int) error {
+	clsact := &netlink.GenericQdisc{
+		QdiscAttrs: netlink.QdiscAttrs{
+			LinkIndex: linkIndex,
+			Handle:    netlink.MakeHandle(0xffff, 0),
+			Parent:    netlink.HANDLE_CLSACT,
+		},
+		QdiscType: "clsact",
+	}
+	if err := netlink.QdiscReplace(clsact); err != nil {
+		return fmt.Errorf("failed to add clsact qdisc to link %d: %w", linkIndex, err)
+	}
+
+	filters := []*netlink.BpfFilter{
+		newFilter(linkIndex, netlink.HANDLE_MIN_EGRESS, toPodFilterName, k.collection.Programs[toPodProgram]),
+		newFilter(linkIndex, netlink.HANDLE_MIN_INGRESS, fromPodFilterName, k.collection.Programs[fromPodProgram]),
+	}
+	for _, filter := range filters {
+		if err := netlink.FilterReplace(filter); err != nil {
+			return fmt.Errorf("failed to attach %s to link %d: %w", filter.Name, linkIndex, err)
+		}
+	}
+	return nil
+}
+
+func newFilter(linkIndex int, parent uint32, name string, program *ebpf.Program) *netlink.BpfFilter {
+	return &netlink.BpfFilter{
+		FilterAttrs: netlink.FilterAttrs{
+			LinkIndex: linkIndex,
+			Parent:    parent,
+			Protocol:  syscall.ETH_P_ALL,
+			Priority:  1,
+		},
+		Fd:           program.FD(),
+		Name:         name,
+		DirectAction: true,
+	}
+}
+
+// detachFilters deletes NPM's filters from the link. A missing link has no filters.
+func detachFilters(linkIndex int) error {
+	link, err := netlink.LinkByIndex(linkIndex)
+	if err != nil {
+		var notFound netlink.LinkNotFoundError
+		if errors.As(err, &notFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to get link %d: %w", linkIndex, err)
+	}
+	for _, parent := range []uint32{netlink.HANDLE_MIN_INGRESS, netlink.HANDLE_MIN_EGRESS} {
+		filters, err := netlink.FilterList(link, parent)
+		if err != nil {
+			// links without a clsact qdisc have no filters
+			klog.Infof("[bpfpolicy] skipping link %s since its filters couldn't be listed. err: %v", link.Attrs().Name, err)
+			continue
+		}
+		for _, filter := range filters {
+			bpfFilter, ok := filter.(*netlink.BpfFilter)
+			if !ok || !strings.HasPrefix(bpfFilter.Name, filterNamePrefix) {
+				continue
+			}
+			if err := netlink.FilterDel(bpfFilter); err != nil {
+				return fmt.Errorf("failed to detach %s from link %s: %w", bpfFilter.Name, link.Attrs().Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// vethForAddress returns the index of the veth which the host routes the endpoint's IP to.
+// Pods must have a host route to their veth (e.g. Azure CNI in transparent mode).
+func vethForAddress(ip netip.Addr) (int, error) {
+	routes, err := netlink.RouteGet(net.IP(ip.AsSlice()))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get route to endpoint %s: %w", ip, err)
+	}
+	for i := range routes {
+		link, err := netlink.LinkByIndex(routes[i].LinkIndex)
+		if err != nil {
+			continue
+		}
+		if link.Type() == "veth" {
+			return routes[i].LinkIndex, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s", ErrNoVethForAddress, ip)
+}
+
+func updateEntries[K comparable](m *ebpf.Map, entries map[K]uint8) error {
+	for key, value := range entries {
+		if err := m.Update(key, value, ebpf.UpdateAny); err != nil {
+			return fmt.Errorf("failed to update map %s: %w", m.String(), err)
+		}
+	}
+	return nil
+}
+
+func deleteStaleEntries[K comparable](m *ebpf.Map, old, current map[K]uint8) error {
+	for key := range old {
+		if _, ok := current[key]; ok {
+			continue
+		}
+		if err := m.Delete(key); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+			return fmt.Errorf("failed to delete from map %s: %w", m.String(), err)
+		}
+	}
+	return nil
+}
+
+func clearMap(m *ebpf.Map) error {
+	for {
+		key, err := m.NextKeyBytes(nil)
+		if err != nil {
+			return fmt.Errorf("failed to get next key: %w", err)
+		}
+		if key == nil {
+			return nil
+		}
+		if err := m.Delete(key); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+			return fmt.Errorf("failed to delete key: %w", err)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package bpfpolicy
+
+// NewMaps is only supported on Linux.
+func NewMaps(_ string) (Maps, error) {
+	return nil, ErrUnsupported
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/Azure/azure-container-networking/common"
 	"github.com/Azure/azure-container-networking/npm/metrics"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/bpfpolicy"
 	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/ipsets"
 	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/policies"
 	"github.com/Azure/azure-container-networking/npm/util"
@@ -29,6 +30,8 @@ const (
 
 var (
 	ErrInvalidApplyConfig       = errors.New("invalid apply config")
+	ErrInvalidNftablesConfig    = errors.New("native nftables must be enabled for both the ipset manager and policy manager")
+	ErrInvalidBPFConfig         = errors.New("native nftables can't be enabled in BPF policy mode")
 	ErrIncorrectNumberOfNetPols = errors.New("expected to have exactly one netpol since dp.netPolInBackground == false")
 )
 
@@ -46,6 +49,11 @@ type Config struct {
 	MaxPendingNetPols  int
 	NetPolInterval     time.Duration
 	EnableNPMLite      bool
+	// DriftDetectionInterval is currently used in Linux's iptables mode to periodically compare ipsets and iptables in the kernel against the cache.
+	// Drift detection is disabled if zero.
+	DriftDetectionInterval time.Duration
+	// ReapplyOnDrift re-applies drifted ipsets and chains from the cache when drift is detected.
+	ReapplyOnDrift bool
 	*ipsets.IPSetManagerCfg
 	*policies.PolicyManagerCfg
 }
@@ -85,6 +93,25 @@ func NewDataPlane(nodeName string, ioShim *common.IOShim, cfg *Config, stopChann
 		cfg.IPSetManagerCfg.AddEmptySetToLists = true
 	}
 
+	if cfg.IPSetManagerCfg.NativeNftables != cfg.PolicyManagerCfg.NativeNftables {
+		return nil, ErrInvalidNftablesConfig
+	}
+
+	if cfg.PolicyManagerCfg.PolicyMode == policies.BPFPolicyMode {
+		if cfg.PolicyManagerCfg.NativeNftables {
+			return nil, ErrInvalidBPFConfig
+		}
+		if cfg.PolicyManagerCfg.BPFMaps == nil {
+			bpfMaps, err := bpfpolicy.NewMaps(bpfpolicy.DefaultObjectPath)
+			if err != nil {
+				return nil, npmerrors.SimpleErrorWrapper("failed to load eBPF policy program", err)
+			}
+			cfg.PolicyManagerCfg.BPFMaps = bpfMaps
+		}
+		// the IPSetManager writes set members to the same maps
+		cfg.IPSetManagerCfg.BPFMaps = cfg.PolicyManagerCfg.BPFMaps
+	}
+
 	dp := &DataPlane{
 		Config:    cfg,
 		policyMgr: policies.NewPolicyManager(ioShim, cfg.PolicyManagerCfg),
@@ -122,9 +149,12 @@ func NewDataPlane(nodeName string, ioShim *common.IOShim, cfg *Config, stopChann
 		return nil, err
 	}
 
-	// Prevent netpol in background unless we're in Linux and using nftables.
+	// Prevent netpol in background unless we're in Linux and using nftables (either natively or through iptables-nft).
 	// This step must be performed after bootupDataplane() because it calls util.DetectIptablesVersion(), which sets the proper value for util.Iptables
-	dp.netPolInBackground = cfg.NetPolInBackground && !util.IsWindowsDP() && (strings.Contains(util.Iptables, "nft") || dp.debug)
+	usingNftables := cfg.PolicyManagerCfg.NativeNftables || strings.Contains(util.Iptables, "nft")
+	// In BPF policy mode, policies are added to endpoints like in Windows, which requires adding one policy at a time.
+	usingBPF := cfg.PolicyManagerCfg.PolicyMode == policies.BPFPolicyMode
+	dp.netPolInBackground = cfg.NetPolInBackground && !util.IsWindowsDP() && !usingBPF && (usingNftables || dp.debug)
 	if dp.netPolInBackground {
 		msg := fmt.Sprintf("[DataPlane] dataplane configured to add netpols in background every %v or every %d calls to AddPolicy()", dp.NetPolInterval, dp.MaxPendingNetPols)
 		metrics.SendLog(util.DaemonDataplaneID, msg, true)
@@ -178,6 +208,24 @@ func (dp *DataPlane) RunPeriodicTasks() {
 		}
 	}()
 
+	if dp.DriftDetectionInterval > 0 && dp.canDetectDrift() {
+		klog.Infof("[DataPlane] detecting drift every %v. reapply on drift: %t", dp.DriftDetectionInterval, dp.ReapplyOnDrift)
+		go func() {
+			ticker := time.NewTicker(dp.DriftDetectionInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-dp.stopChannel:
+					return
+				case <-ticker.C:
+					// locks ipset manager, then policy manager
+					dp.detectDrift()
+				}
+			}
+		}()
+	}
+
 	if dp.netPolInBackground {
 		go func() {
 			ticker := time.NewTicker(dp.NetPolInterval)
@@ -592,6 +640,15 @@ func (dp *DataPlane) addPolicies(netPols []*policies.NPMNetworkPolicy) error {
 	return nil
 }
 
+func (dp *DataPlane) getSelectorIPSets(policy *policies.NPMNetworkPolicy) map[string]struct{} {
+	selectorIpSets := make(map[string]struct{})
+	for _, ipset := range policy.PodSelectorIPSets {
+		selectorIpSets[ipset.Metadata.GetPrefixName()] = struct{}{}
+	}
+	klog.Infof("policy %s has policy selector: %+v", policy.PolicyKey, selectorIpSets)
+	return selectorIpSets
+}
+
 // RemovePolicy takes in network policyKey (namespace/name of network policy) and removes it from dataplane and cache
 func (dp *DataPlane) RemovePolicy(policyKey string) error {
 	// TODO: Refactor non-error/warning klogs with Zap and set the following logs to "debug" level
@@ -0,0 +1,179 @@
+package dataplane
+
+import (
+	"fmt"
+
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/ipsets"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/policies"
+	"k8s.io/klog"
+)
+
+// updatePodBPF mirrors updatePod() in Windows, except that endpoints are Pods on this node (keyed by Pod IP)
+// instead of HNS endpoints, so there's no need to refresh endpoints.
+// 1. Will add the Pod to the endpoint cache and remove it once the Pod is deleted.
+// 2. Will remove policies from the endpoint when the Pod leaves a set, and add policies whose selector the Pod satisfies.
+func (dp *DataPlane) updatePodBPF(pod *updateNPMPod) error {
+	klog.Infof("[DataPlane] updatePod called. podKey: %s", pod.PodKey)
+	if len(pod.IPSetsToAdd) == 0 && len(pod.IPSetsToRemove) == 0 {
+		// nothing to do
+		return nil
+	}
+
+	// lock the endpoint cache while we read/modify the endpoint with the pod's IP
+	dp.endpointCache.Lock()
+	defer dp.endpointCache.Unlock()
+
+	endpoint, ok := dp.endpointCache.cache[pod.PodIP]
+	if !ok {
+		if len(pod.IPSetsToAdd) == 0 {
+			klog.Infof("[DataPlane] ignoring pod update since there is no corresponding endpoint. IP: %s. podKey: %s", pod.PodIP, pod.PodKey)
+			return nil
+		}
+		endpoint = newNPMEndpoint(pod.PodIP, pod.PodKey)
+		dp.endpointCache.cache[pod.PodIP] = endpoint
+	} else if pod.PodKey != endpoint.podKey {
+		// the IP was reused before the previous Pod's deletion was processed
+		klog.Infof("[DataPlane] pod key has changed. will remove all policies from endpoint. new podKey: %s. previous endpoint: %+v", pod.PodKey, endpoint)
+		if err := dp.removeAllPoliciesBPF(endpoint); err != nil {
+			return fmt.Errorf("failed to reset endpoint for pod with new pod key. new podKey: %s. previous endpoint: %+v. err: %w", pod.PodKey, endpoint, err)
+		}
+		endpoint.podKey = pod.PodKey
+
+		// all policies were removed, so there's no need to look for policies to delete
+		pod.IPSetsToRemove = nil
+	}
+
+	// for every ipset we're removing from the endpoint, remove from the endpoint any policy that requires the set
+	// see updatePod() in Windows for potential races with dp.AddPolicy()
+	for _, setName := range pod.IPSetsToRemove {
+		selectorReference, err := dp.ipsetMgr.GetSelectorReferencesBySet(setName)
+		if err != nil {
+			// ignore this set since it may have been deleted in the background reconcile thread
+			klog.Infof("[DataPlane] ignoring pod update for ipset to remove since the set does not exist. pod: %+v. set: %s", pod, setName)
+			continue
+		}
+
+		for policyKey := range selectorReference {
+			if _, ok := endpoint.netPolReference[policyKey]; !ok {
+				continue
+			}
+			endpointList := map[string]string{
+				endpoint.ip: endpoint.ip,
+			}
+			if err := dp.policyMgr.RemovePolicyForEndpoints(policyKey, endpointList); err != nil {
+				return err //nolint:wrapcheck // unnecessary to wrap error
+			}
+			delete(endpoint.netPolReference, policyKey)
+		}
+	}
+
+	// for every ipset we're adding to the endpoint, consider adding to the endpoint every policy that the set touches
+	toAddPolicies := make(map[string]struct{})
+	for _, setName := range pod.IPSetsToAdd {
+		selectorReference, err := dp.ipsetMgr.GetSelectorReferencesBySet(setName)
+		if err != nil {
+			// ignore this set since it may have been deleted in the background reconcile thread
+			klog.Infof("[DataPlane] ignoring pod update for ipset to add since the set does not exist. pod: %+v. set: %s", pod, setName)
+			continue
+		}
+
+		for policyKey := range selectorReference {
+			if _, ok := endpoint.netPolReference[policyKey]; ok {
+				continue
+			}
+
+			policy, ok := dp.policyMgr.GetPolicy(policyKey)
+			if !ok {
+				klog.Infof("[DataPlane] while updating pod, policy is referenced but does not exist. pod: [%s], policy: [%s], set [%s]", pod.PodKey, policyKey, setName)
+				continue
+			}
+
+			ok, err := dp.ipsetMgr.DoesIPSatisfySelectorIPSets(pod.PodIP, pod.PodKey, dp.getSelectorIPSets(policy))
+			if err != nil {
+				return fmt.Errorf("[DataPlane] error getting IPs satisfying selector ipsets: %w", err)
+			}
+			if ok {
+				toAddPolicies[policyKey] = struct{}{}
+			}
+		}
+	}
+
+	if len(toAddPolicies) > 0 {
+		successfulPolicies, err := dp.policyMgr.AddAllPolicies(toAddPolicies, endpoint.ip, endpoint.ip)
+		for policyKey := range successfulPolicies {
+			endpoint.netPolReference[policyKey] = struct{}{}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to add all policies while updating pod. endpoint: %+v. policies: %+v. err: %w", endpoint, toAddPolicies, err)
+		}
+	}
+
+	if len(endpoint.netPolReference) == 0 && !dp.isPodInNamespaceSet(pod) {
+		// the Pod was deleted
+		klog.Infof("[DataPlane] removing endpoint for deleted pod. endpoint: %+v", endpoint)
+		delete(dp.endpointCache.cache, pod.PodIP)
+	}
+
+	klog.Infof("[DataPlane] updatedPod complete. podKey: %s. endpoint: %+v", pod.PodKey, endpoint)
+	return nil
+}
+
+// removeAllPoliciesBPF removes every policy referenced by the endpoint.
+// The caller must lock the endpoint cache.
+func (dp *DataPlane) removeAllPoliciesBPF(endpoint *npmEndpoint) error {
+	endpointList := map[string]string{
+		endpoint.ip: endpoint.ip,
+	}
+	for policyKey := range endpoint.netPolReference {
+		if err := dp.policyMgr.RemovePolicyForEndpoints(policyKey, endpointList); err != nil {
+			return err //nolint:wrapcheck // unnecessary to wrap error
+		}
+		delete(endpoint.netPolReference, policyKey)
+	}
+	return nil
+}
+
+// isPodInNamespaceSet returns whether the Pod's IP still belongs to the Pod's namespace set.
+// Every Pod is in its namespace set until the Pod is deleted.
+func (dp *DataPlane) isPodInNamespaceSet(pod *updateNPMPod) bool {
+	namespaceSet := ipsets.NewIPSetMetadata(pod.Namespace(), ipsets.Namespace).GetPrefixName()
+	ok, err := dp.ipsetMgr.DoesIPSatisfySelectorIPSets(pod.PodIP, pod.PodKey, map[string]struct{}{namespaceSet: {}})
+	return err == nil && ok
+}
+
+// getEndpointsToApplyPoliciesBPF mirrors getEndpointsToApplyPolicies() in Windows.
+// It returns the Pods on this node which satisfy the policy's pod selector.
+func (dp *DataPlane) getEndpointsToApplyPoliciesBPF(netPols []*policies.NPMNetworkPolicy) (map[string]string, error) {
+	if len(netPols) != 1 {
+		return nil, ErrIncorrectNumberOfNetPols
+	}
+
+	netPol := netPols[0]
+	netpolSelectorIPs, err := dp.ipsetMgr.GetIPsFromSelectorIPSets(dp.getSelectorIPSets(netPol))
+	if err != nil {
+		return nil, err //nolint:wrapcheck // unnecessary to wrap error
+	}
+
+	// lock the endpoint cache while we read/modify the endpoints with IPs in the policy's pod selector
+	dp.endpointCache.Lock()
+	defer dp.endpointCache.Unlock()
+
+	endpointList := make(map[string]string)
+	for ip, podKey := range netpolSelectorIPs {
+		endpoint, ok := dp.endpointCache.cache[ip]
+		if !ok {
+			// the Pod is on another node or hasn't been processed by updatePod() yet
+			continue
+		}
+
+		if endpoint.podKey != podKey {
+			// in case the pod controller hasn't updated the dp yet that the IP's pod owner has changed
+			klog.Infof("[DataPlane] ignoring selector IP since the endpoint is assigned to a different podKey. ip: %s. podKey: %s. endpoint: %+v", ip, podKey, endpoint)
+			continue
+		}
+
+		endpointList[ip] = endpoint.ip
+		endpoint.netPolReference[netPol.PolicyKey] = struct{}{}
+	}
+	return endpointList, nil
+}
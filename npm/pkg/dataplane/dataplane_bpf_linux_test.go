@@ -0,0 +1,141 @@
+package dataplane
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/npm/metrics"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/bpfpolicy"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/ipsets"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/policies"
+	"github.com/stretchr/testify/require"
+)
+
+func bpfDPConfig(bpfMaps bpfpolicy.Maps) *Config {
+	return &Config{
+		IPSetManagerCfg: &ipsets.IPSetManagerCfg{
+			IPSetMode:   ipsets.ApplyAllIPSets,
+			NetworkName: "azure",
+		},
+		PolicyManagerCfg: &policies.PolicyManagerCfg{
+			NodeIP:     "6.7.8.9",
+			PolicyMode: policies.BPFPolicyMode,
+			BPFMaps:    bpfMaps,
+		},
+	}
+}
+
+func bpfDenyIngressPolicy() *policies.NPMNetworkPolicy {
+	return &policies.NPMNetworkPolicy{
+		Namespace: "x",
+		PolicyKey: "x/deny-app-ingress",
+		PodSelectorIPSets: []*ipsets.TranslatedIPSet{
+			{Metadata: ipsets.NewIPSetMetadata("x", ipsets.Namespace)},
+			{Metadata: ipsets.NewIPSetMetadata("app", ipsets.KeyLabelOfPod)},
+		},
+		ACLs: []*policies.ACLPolicy{
+			{
+				Target:    policies.Dropped,
+				Direction: policies.Ingress,
+			},
+		},
+	}
+}
+
+func newBPFDataPlane(t *testing.T, bpfMaps bpfpolicy.Maps) *DataPlane {
+	calls := append(policies.GetBPFBootupTestCalls(), ipsets.GetResetTestCalls()...)
+	ioshim := common.NewMockIOShim(calls)
+	t.Cleanup(func() { ioshim.VerifyCalls(t, calls) })
+
+	dp, err := NewDataPlane(nodeName, ioshim, bpfDPConfig(bpfMaps), make(chan struct{}, 1))
+	require.NoError(t, err)
+	return dp
+}
+
+func TestBPFDataPlaneRequiresIptables(t *testing.T) {
+	metrics.InitializeAll()
+
+	cfg := bpfDPConfig(bpfpolicy.NewFakeMaps())
+	cfg.IPSetManagerCfg.NativeNftables = true
+	cfg.PolicyManagerCfg.NativeNftables = true
+	_, err := NewDataPlane(nodeName, common.NewMockIOShim(nil), cfg, make(chan struct{}, 1))
+	require.ErrorIs(t, err, ErrInvalidBPFConfig)
+}
+
+func TestBPFDataPlanePodLifecycle(t *testing.T) {
+	metrics.InitializeAll()
+
+	fake := bpfpolicy.NewFakeMaps()
+	dp := newBPFDataPlane(t, fake)
+	require.False(t, dp.netPolInBackground)
+
+	nsSet := ipsets.NewIPSetMetadata("x", ipsets.Namespace)
+	appSet := ipsets.NewIPSetMetadata("app", ipsets.KeyLabelOfPod)
+	podA := NewPodMetadata("x/a", "10.0.0.1", nodeName)
+	offNodePod := NewPodMetadata("x/b", "10.0.0.2", "othernode")
+	ipA := netip.MustParseAddr(podA.PodIP)
+	packetToA := bpfpolicy.Packet{Src: netip.MustParseAddr("10.1.0.1"), Dst: ipA, Protocol: bpfpolicy.TCPProtocol, DstPort: 80}
+
+	require.NoError(t, dp.AddToSets([]*ipsets.IPSetMetadata{nsSet, appSet}, podA))
+	require.NoError(t, dp.AddToSets([]*ipsets.IPSetMetadata{nsSet, appSet}, offNodePod))
+	require.NoError(t, dp.ApplyDataPlane())
+	require.Contains(t, dp.endpointCache.cache, podA.PodIP)
+	require.NotContains(t, dp.endpointCache.cache, offNodePod.PodIP)
+	require.ElementsMatch(t, []netip.Addr{ipA, netip.MustParseAddr(offNodePod.PodIP)}, fake.Sets[bpfpolicy.SetID(nsSet.GetPrefixName())].IPs)
+
+	// the policy only applies to the Pod on this node
+	policy := bpfDenyIngressPolicy()
+	require.NoError(t, dp.AddPolicy(policy))
+	require.Equal(t, map[string]string{podA.PodIP: podA.PodIP}, policy.PodEndpoints)
+	require.Len(t, fake.Endpoints, 1)
+	require.False(t, fake.Allows(ipA, bpfpolicy.Ingress, packetToA))
+
+	// the Pod no longer satisfies the pod selector
+	require.NoError(t, dp.RemoveFromSets([]*ipsets.IPSetMetadata{appSet}, podA))
+	require.NoError(t, dp.ApplyDataPlane())
+	require.Empty(t, fake.Endpoints)
+	require.True(t, fake.Allows(ipA, bpfpolicy.Ingress, packetToA))
+	require.Contains(t, dp.endpointCache.cache, podA.PodIP)
+
+	// the Pod satisfies the pod selector again
+	require.NoError(t, dp.AddToSets([]*ipsets.IPSetMetadata{appSet}, podA))
+	require.NoError(t, dp.ApplyDataPlane())
+	require.Contains(t, dp.endpointCache.cache[podA.PodIP].netPolReference, policy.PolicyKey)
+	require.False(t, fake.Allows(ipA, bpfpolicy.Ingress, packetToA))
+
+	// the Pod is deleted
+	require.NoError(t, dp.RemoveFromSets([]*ipsets.IPSetMetadata{nsSet, appSet}, podA))
+	require.NoError(t, dp.ApplyDataPlane())
+	require.Empty(t, fake.Endpoints)
+	require.NotContains(t, dp.endpointCache.cache, podA.PodIP)
+
+	require.NoError(t, dp.RemovePolicy(policy.PolicyKey))
+	require.Empty(t, fake.Endpoints)
+}
+
+func TestBPFDataPlaneReusedIP(t *testing.T) {
+	metrics.InitializeAll()
+
+	fake := bpfpolicy.NewFakeMaps()
+	dp := newBPFDataPlane(t, fake)
+
+	nsSet := ipsets.NewIPSetMetadata("x", ipsets.Namespace)
+	appSet := ipsets.NewIPSetMetadata("app", ipsets.KeyLabelOfPod)
+	oldPod := NewPodMetadata("x/old", "10.0.0.1", nodeName)
+	newPod := NewPodMetadata("x/new", "10.0.0.1", nodeName)
+
+	require.NoError(t, dp.AddToSets([]*ipsets.IPSetMetadata{nsSet, appSet}, oldPod))
+	require.NoError(t, dp.ApplyDataPlane())
+	policy := bpfDenyIngressPolicy()
+	require.NoError(t, dp.AddPolicy(policy))
+	require.Len(t, fake.Endpoints, 1)
+
+	// a new Pod takes the IP before the old Pod's deletion is processed
+	require.NoError(t, dp.AddToSets([]*ipsets.IPSetMetadata{nsSet}, newPod))
+	require.NoError(t, dp.ApplyDataPlane())
+	require.Equal(t, newPod.PodKey, dp.endpointCache.cache[newPod.PodIP].podKey)
+	require.Empty(t, dp.endpointCache.cache[newPod.PodIP].netPolReference)
+	require.Empty(t, fake.Endpoints)
+	require.Empty(t, policy.PodEndpoints)
+}
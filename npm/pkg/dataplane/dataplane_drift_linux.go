@@ -0,0 +1,63 @@
+package dataplane
+
+import (
+	"github.com/Azure/azure-container-networking/npm/metrics"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/policies"
+	"github.com/Azure/azure-container-networking/npm/util"
+	"k8s.io/klog"
+)
+
+// canDetectDrift returns whether drift detection is supported.
+// It's only implemented for kernel ipsets and iptables, not native nftables or BPF policy mode.
+func (dp *DataPlane) canDetectDrift() bool {
+	return !dp.PolicyManagerCfg.NativeNftables && dp.PolicyMode != policies.BPFPolicyMode
+}
+
+// detectDrift compares the ipsets and iptables in the kernel against the cache and records drift in Prometheus metrics.
+// If ReapplyOnDrift is true, drifted ipsets are applied first since the drifted chains may reference them.
+func (dp *DataPlane) detectDrift() {
+	ipsetDrift, err := dp.ipsetMgr.VerifyIPSets(dp.ReapplyOnDrift)
+	if err != nil {
+		metrics.IncDriftCheckFailures()
+		metrics.SendErrorLogAndMetric(util.DaemonDataplaneID, "[DataPlane] failed to check ipsets for drift: %v", err)
+	} else {
+		numDriftedSets := ipsetDrift.NumDriftedSets()
+		metrics.SetDataplaneDrift(metrics.IPSetDrift, numDriftedSets)
+		if dp.ReapplyOnDrift && numDriftedSets > 0 {
+			err := dp.ipsetMgr.ApplyIPSets()
+			metrics.IncDriftReapplies(metrics.IPSetDrift, err != nil)
+			if err != nil {
+				metrics.SendErrorLogAndMetric(util.DaemonDataplaneID, "[DataPlane] failed to reapply drifted ipsets: %v", err)
+			}
+		}
+	}
+
+	chainDrift, err := dp.policyMgr.VerifyIptables()
+	if err != nil {
+		metrics.IncDriftCheckFailures()
+		metrics.SendErrorLogAndMetric(util.DaemonDataplaneID, "[DataPlane] failed to check iptables for drift: %v", err)
+		return
+	}
+
+	numBaseChainDrift := len(chainDrift.BaseChains)
+	if chainDrift.MissingJumpFromForward {
+		numBaseChainDrift++
+	}
+	metrics.SetDataplaneDrift(metrics.BaseChainDrift, numBaseChainDrift)
+	metrics.SetDataplaneDrift(metrics.PolicyDrift, len(chainDrift.PolicyKeys))
+	if !dp.ReapplyOnDrift || !chainDrift.HasDrift() {
+		return
+	}
+
+	kind := metrics.PolicyDrift
+	if numBaseChainDrift > 0 {
+		kind = metrics.BaseChainDrift
+	}
+	err = dp.policyMgr.RepairIptables(chainDrift)
+	metrics.IncDriftReapplies(kind, err != nil)
+	if err != nil {
+		metrics.SendErrorLogAndMetric(util.DaemonDataplaneID, "[DataPlane] failed to reapply drifted iptables: %v", err)
+		return
+	}
+	klog.Infof("[DataPlane] reapplied drifted iptables: %+v", chainDrift)
+}
@@ -0,0 +1,94 @@
+package dataplane
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/npm/metrics"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/ipsets"
+	testutils "github.com/Azure/azure-container-networking/test/utils"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	driftTestIPSetSaveCommand    = []string{"ipset", "save"}
+	driftTestIptablesSaveCommand = []string{"iptables-nft-save", "-t", "filter"}
+
+	// NPM's chains before any policies are added
+	driftTestBootupIptablesSave = strings.Join([]string{
+		"*filter",
+		":FORWARD ACCEPT [0:0]",
+		":AZURE-NPM - [0:0]",
+		":AZURE-NPM-ACCEPT - [0:0]",
+		":AZURE-NPM-EGRESS - [0:0]",
+		":AZURE-NPM-INGRESS - [0:0]",
+		":AZURE-NPM-INGRESS-ALLOW-MARK - [0:0]",
+		"-A FORWARD -m conntrack --ctstate NEW -j AZURE-NPM",
+		"-A AZURE-NPM-ACCEPT -j ACCEPT",
+		"-A AZURE-NPM-EGRESS -m mark --mark 0x800/0x800 -j DROP",
+		"-A AZURE-NPM-EGRESS -m mark --mark 0x200/0x200 -j AZURE-NPM-ACCEPT",
+		"-A AZURE-NPM-INGRESS -m mark --mark 0x400/0x400 -j DROP",
+		"-A AZURE-NPM-INGRESS-ALLOW-MARK -j MARK --set-xmark 0x200/0x200",
+		"-A AZURE-NPM-INGRESS-ALLOW-MARK -j AZURE-NPM-EGRESS",
+		"COMMIT",
+	}, "\n")
+)
+
+func TestDetectDriftAndReapply(t *testing.T) {
+	metrics.ReinitializeAll()
+
+	calls := getBootupTestCalls()
+	calls = append(calls, ipsets.GetApplyIPSetsTestCalls([]*ipsets.IPSetMetadata{setPodKey1.Metadata}, nil)...)
+	// the set is missing from the kernel
+	calls = append(calls, testutils.TestCmd{Cmd: driftTestIPSetSaveCommand})
+	calls = append(calls, ipsets.GetApplyIPSetsTestCalls([]*ipsets.IPSetMetadata{setPodKey1.Metadata}, nil)...)
+	calls = append(calls, testutils.TestCmd{Cmd: driftTestIptablesSaveCommand, Stdout: driftTestBootupIptablesSave})
+	ioshim := common.NewMockIOShim(calls)
+	defer ioshim.VerifyCalls(t, calls)
+
+	cfg := *dpCfg
+	cfg.ReapplyOnDrift = true
+	dp, err := NewDataPlane("testnode", ioshim, &cfg, nil)
+	require.NoError(t, err)
+	require.True(t, dp.canDetectDrift())
+
+	require.NoError(t, dp.AddToSets([]*ipsets.IPSetMetadata{setPodKey1.Metadata}, NewPodMetadata("x/a", "10.0.0.1", "testnode")))
+	require.NoError(t, dp.ApplyDataPlane())
+
+	dp.detectDrift()
+
+	val, err := metrics.DataplaneDrift(metrics.IPSetDrift)
+	require.NoError(t, err)
+	require.Equal(t, 1, val)
+	val, err = metrics.DataplaneDrift(metrics.PolicyDrift)
+	require.NoError(t, err)
+	require.Equal(t, 0, val)
+	val, err = metrics.DataplaneDrift(metrics.BaseChainDrift)
+	require.NoError(t, err)
+	require.Equal(t, 0, val)
+	val, err = metrics.TotalDriftReapplies(metrics.IPSetDrift, false)
+	require.NoError(t, err)
+	require.Equal(t, 1, val)
+}
+
+func TestDetectDriftFailures(t *testing.T) {
+	metrics.ReinitializeAll()
+
+	calls := getBootupTestCalls()
+	calls = append(calls,
+		testutils.TestCmd{Cmd: driftTestIPSetSaveCommand, ExitCode: 1},
+		testutils.TestCmd{Cmd: driftTestIptablesSaveCommand, ExitCode: 1},
+	)
+	ioshim := common.NewMockIOShim(calls)
+	defer ioshim.VerifyCalls(t, calls)
+
+	dp, err := NewDataPlane("testnode", ioshim, dpCfg, nil)
+	require.NoError(t, err)
+
+	dp.detectDrift()
+
+	val, err := metrics.TotalDriftCheckFailures()
+	require.NoError(t, err)
+	require.Equal(t, 2, val)
+}
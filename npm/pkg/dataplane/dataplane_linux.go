@@ -5,16 +5,22 @@ import (
 	npmerrors "github.com/Azure/azure-container-networking/npm/util/errors"
 )
 
-func (dp *DataPlane) getEndpointsToApplyPolicies(_ []*policies.NPMNetworkPolicy) (map[string]string, error) {
+func (dp *DataPlane) getEndpointsToApplyPolicies(netPols []*policies.NPMNetworkPolicy) (map[string]string, error) {
+	if dp.PolicyMode == policies.BPFPolicyMode {
+		return dp.getEndpointsToApplyPoliciesBPF(netPols)
+	}
 	// NOOP in Linux
 	return nil, nil
 }
 
 func (dp *DataPlane) shouldUpdatePod() bool {
-	return false
+	return dp.PolicyMode == policies.BPFPolicyMode
 }
 
 func (dp *DataPlane) updatePod(pod *updateNPMPod) error {
+	if dp.PolicyMode == policies.BPFPolicyMode {
+		return dp.updatePodBPF(pod)
+	}
 	// NOOP in Linux
 	return nil
 }
@@ -31,6 +37,6 @@ func (dp *DataPlane) bootupDataPlane() error {
 }
 
 func (dp *DataPlane) refreshPodEndpoints() error {
-	// NOOP in Linux
+	// NOOP in Linux. In BPF policy mode, updatePod() adds Pods on this node to the endpoint cache.
 	return nil
 }
@@ -299,15 +299,6 @@ func (dp *DataPlane) updatePod(pod *updateNPMPod) error {
 	return nil
 }
 
-func (dp *DataPlane) getSelectorIPSets(policy *policies.NPMNetworkPolicy) map[string]struct{} {
-	selectorIpSets := make(map[string]struct{})
-	for _, ipset := range policy.PodSelectorIPSets {
-		selectorIpSets[ipset.Metadata.GetPrefixName()] = struct{}{}
-	}
-	klog.Infof("policy %s has policy selector: %+v", policy.PolicyKey, selectorIpSets)
-	return selectorIpSets
-}
-
 func (dp *DataPlane) getEndpointsToApplyPolicies(netPols []*policies.NPMNetworkPolicy) (map[string]string, error) {
 	if len(netPols) != 1 {
 		return nil, ErrIncorrectNumberOfNetPols
@@ -478,6 +469,15 @@ func (dp *DataPlane) refreshPodEndpoints() error {
 	return nil
 }
 
+// canDetectDrift returns false since drift detection is unimplemented in Windows.
+func (dp *DataPlane) canDetectDrift() bool {
+	return false
+}
+
+func (dp *DataPlane) detectDrift() {
+	// NOOP in Windows
+}
+
 func (dp *DataPlane) setNetworkIDByName(networkName string) error {
 	// Get Network ID
 	timer := metrics.StartNewTimer()
@@ -31,16 +31,24 @@ type DPShim struct {
 	policyCache map[string]*policies.NPMNetworkPolicy
 	dirtyCache  *dirtyCache
 	mu          *sync.Mutex
+	// generation increases with each ApplyDataPlane which sends an event.
+	// setGenerations and policyGenerations hold the generation in which each object was last modified,
+	// so that each daemon is only sent the objects which changed since its last event.
+	generation        uint64
+	setGenerations    map[string]uint64
+	policyGenerations map[string]uint64
 }
 
 func NewDPSim(stopChannel <-chan struct{}) (*DPShim, error) {
 	return &DPShim{
-		OutChannel:  make(chan *protos.Events),
-		setCache:    make(map[string]*controlplane.ControllerIPSets),
-		policyCache: make(map[string]*policies.NPMNetworkPolicy),
-		stopChannel: stopChannel,
-		dirtyCache:  newDirtyCache(),
-		mu:          &sync.Mutex{},
+		OutChannel:        make(chan *protos.Events),
+		setCache:          make(map[string]*controlplane.ControllerIPSets),
+		policyCache:       make(map[string]*policies.NPMNetworkPolicy),
+		stopChannel:       stopChannel,
+		dirtyCache:        newDirtyCache(),
+		mu:                &sync.Mutex{},
+		setGenerations:    make(map[string]uint64),
+		policyGenerations: make(map[string]uint64),
 	}, nil
 }
 
@@ -445,6 +453,8 @@ func (dp *DPShim) ApplyDataPlane() error {
 		return nil
 	}
 
+	dp.updateGenerations()
+
 	go func() {
 		dp.OutChannel <- &protos.Events{
 			EventType: protos.Events_GoalState,
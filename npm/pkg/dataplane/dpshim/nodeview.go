@@ -0,0 +1,243 @@
+package dpshim
+
+import (
+	"sort"
+
+	"github.com/Azure/azure-container-networking/npm/pkg/controlplane"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/ipsets"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/policies"
+	"github.com/Azure/azure-container-networking/npm/pkg/protos"
+	npmerrors "github.com/Azure/azure-container-networking/npm/util/errors"
+	"k8s.io/klog"
+)
+
+// NodeView holds the ipsets and policies a daemon has been sent,
+// along with the generation each object was in when it was sent.
+type NodeView struct {
+	Sets     map[string]uint64
+	Policies map[string]uint64
+}
+
+func NewNodeView() *NodeView {
+	return &NodeView{
+		Sets:     make(map[string]uint64),
+		Policies: make(map[string]uint64),
+	}
+}
+
+// NodeGoalState returns the event which brings a daemon on nodeName from view to the current goal state of its node,
+// along with the view after the daemon processes the event.
+// A node's goal state only has the policies which select a pod on the node, and the ipsets referenced by those policies.
+// If view is nil, a Hydration event with the whole goal state of the node is returned.
+// Otherwise, a GoalState event with the ipsets and policies which were added, updated, or removed since view is returned,
+// or nil if nothing changed.
+func (dp *DPShim) NodeGoalState(nodeName string, view *NodeView) (*protos.Events, *NodeView, error) {
+	dp.lock()
+	defer dp.unlock()
+
+	hydrate := view == nil
+	if hydrate {
+		view = NewNodeView()
+	}
+
+	nodePolicies := dp.nodePolicies(nodeName)
+	nodeSets := dp.nodeSets(nodePolicies)
+
+	nextView := NewNodeView()
+	toApplySets := make([]*controlplane.ControllerIPSets, 0)
+	for _, setName := range sortedKeys(nodeSets) {
+		generation := dp.setGenerations[setName]
+		nextView.Sets[setName] = generation
+		if sentGeneration, ok := view.Sets[setName]; !ok || sentGeneration != generation {
+			toApplySets = append(toApplySets, nodeSets[setName])
+		}
+	}
+
+	toApplyPolicies := make([]*policies.NPMNetworkPolicy, 0)
+	for _, policyKey := range sortedKeys(nodePolicies) {
+		generation := dp.policyGenerations[policyKey]
+		nextView.Policies[policyKey] = generation
+		if sentGeneration, ok := view.Policies[policyKey]; !ok || sentGeneration != generation {
+			toApplyPolicies = append(toApplyPolicies, nodePolicies[policyKey])
+		}
+	}
+
+	toDeleteSets := make([]string, 0)
+	for _, setName := range sortedKeys(view.Sets) {
+		if _, ok := nextView.Sets[setName]; !ok {
+			toDeleteSets = append(toDeleteSets, setName)
+		}
+	}
+
+	toDeletePolicies := make([]string, 0)
+	for _, policyKey := range sortedKeys(view.Policies) {
+		if _, ok := nextView.Policies[policyKey]; !ok {
+			toDeletePolicies = append(toDeletePolicies, policyKey)
+		}
+	}
+
+	goalStates := make(map[string]*protos.GoalState)
+	if len(toApplySets) > 0 {
+		payload, err := controlplane.EncodeControllerIPSets(toApplySets)
+		if err != nil {
+			return nil, nil, npmerrors.ErrorWrapper(npmerrors.AppendIPSet, false, "NodeGoalState: failed to encode sets", err)
+		}
+		goalStates[controlplane.IpsetApply] = getGoalStateFromBuffer(payload)
+	}
+
+	if len(toDeleteSets) > 0 {
+		payload, err := controlplane.EncodeStrings(toDeleteSets)
+		if err != nil {
+			return nil, nil, npmerrors.ErrorWrapper(npmerrors.DeleteIPSet, false, "NodeGoalState: failed to encode sets", err)
+		}
+		goalStates[controlplane.IpsetRemove] = getGoalStateFromBuffer(payload)
+	}
+
+	if len(toApplyPolicies) > 0 {
+		payload, err := controlplane.EncodeNPMNetworkPolicies(toApplyPolicies)
+		if err != nil {
+			return nil, nil, npmerrors.ErrorWrapper(npmerrors.AddPolicy, false, "NodeGoalState: failed to encode policies", err)
+		}
+		goalStates[controlplane.PolicyApply] = getGoalStateFromBuffer(payload)
+	}
+
+	if len(toDeletePolicies) > 0 {
+		payload, err := controlplane.EncodeStrings(toDeletePolicies)
+		if err != nil {
+			return nil, nil, npmerrors.ErrorWrapper(npmerrors.RemovePolicy, false, "NodeGoalState: failed to encode policies", err)
+		}
+		goalStates[controlplane.PolicyRemove] = getGoalStateFromBuffer(payload)
+	}
+
+	if len(goalStates) == 0 {
+		klog.Infof("NodeGoalState: no changes to send to node %s", nodeName)
+		return nil, nextView, nil
+	}
+
+	eventType := protos.Events_GoalState
+	if hydrate {
+		eventType = protos.Events_Hydration
+	}
+
+	return &protos.Events{
+		EventType: eventType,
+		Payload:   goalStates,
+	}, nextView, nil
+}
+
+// updateGenerations starts a new generation for the objects in the dirty cache.
+func (dp *DPShim) updateGenerations() {
+	dp.generation++
+	for setName := range dp.dirtyCache.toAddorUpdateSets {
+		dp.setGenerations[setName] = dp.generation
+	}
+	for setName := range dp.dirtyCache.toDeleteSets {
+		delete(dp.setGenerations, setName)
+	}
+	for policyKey := range dp.dirtyCache.toAddorUpdatePolicies {
+		dp.policyGenerations[policyKey] = dp.generation
+	}
+	for policyKey := range dp.dirtyCache.toDeletePolicies {
+		delete(dp.policyGenerations, policyKey)
+	}
+}
+
+// nodePolicies returns the cached policies which select a pod on nodeName.
+func (dp *DPShim) nodePolicies(nodeName string) map[string]*policies.NPMNetworkPolicy {
+	nodePolicies := make(map[string]*policies.NPMNetworkPolicy)
+	for policyKey, policy := range dp.policyCache {
+		if dp.selectsPodOnNode(policy, nodeName) {
+			nodePolicies[policyKey] = policy
+		}
+	}
+	return nodePolicies
+}
+
+// selectsPodOnNode returns true if a pod on nodeName is a member of every pod selector ipset of the policy.
+// Pods without a node name are considered to be on every node.
+func (dp *DPShim) selectsPodOnNode(policy *policies.NPMNetworkPolicy, nodeName string) bool {
+	if len(policy.PodSelectorIPSets) == 0 {
+		return true
+	}
+
+	var selectedPods map[string]*dataplane.PodMetadata
+	for i, translatedSet := range policy.PodSelectorIPSets {
+		members := dp.podMembers(translatedSet.Metadata.GetPrefixName())
+		if i == 0 {
+			selectedPods = make(map[string]*dataplane.PodMetadata)
+			for podIP, pod := range members {
+				if pod.NodeName == nodeName || pod.NodeName == "" {
+					selectedPods[podIP] = pod
+				}
+			}
+			continue
+		}
+
+		for podIP := range selectedPods {
+			if _, ok := members[podIP]; !ok {
+				delete(selectedPods, podIP)
+			}
+		}
+	}
+	return len(selectedPods) > 0
+}
+
+// podMembers returns the pods in a hash set, or in the member sets of a list set.
+func (dp *DPShim) podMembers(setName string) map[string]*dataplane.PodMetadata {
+	set, ok := dp.setCache[setName]
+	if !ok {
+		return nil
+	}
+
+	if set.GetSetKind() == ipsets.HashSet {
+		return set.IPPodMetadata
+	}
+
+	members := make(map[string]*dataplane.PodMetadata)
+	for memberName := range set.MemberIPSets {
+		memberSet, ok := dp.setCache[memberName]
+		if !ok {
+			continue
+		}
+		for podIP, pod := range memberSet.IPPodMetadata {
+			members[podIP] = pod
+		}
+	}
+	return members
+}
+
+// nodeSets returns the cached ipsets referenced by the policies, including the members of referenced list sets.
+func (dp *DPShim) nodeSets(nodePolicies map[string]*policies.NPMNetworkPolicy) map[string]*controlplane.ControllerIPSets {
+	nodeSets := make(map[string]*controlplane.ControllerIPSets)
+	addSet := func(setName string) {
+		set, ok := dp.setCache[setName]
+		if !ok {
+			return
+		}
+		nodeSets[setName] = set
+		for memberName := range set.MemberIPSets {
+			if memberSet, ok := dp.setCache[memberName]; ok {
+				nodeSets[memberName] = memberSet
+			}
+		}
+	}
+
+	for _, policy := range nodePolicies {
+		for _, translatedSets := range [][]*ipsets.TranslatedIPSet{policy.PodSelectorIPSets, policy.ChildPodSelectorIPSets, policy.RuleIPSets} {
+			for _, translatedSet := range translatedSets {
+				addSet(translatedSet.Metadata.GetPrefixName())
+			}
+		}
+	}
+	return nodeSets
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,140 @@
+package dpshim
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/npm/pkg/controlplane"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/ipsets"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/policies"
+	"github.com/Azure/azure-container-networking/npm/pkg/protos"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	nodeTestNSSet       = ipsets.NewIPSetMetadata("ns1", ipsets.Namespace)
+	nodeTestAppASet     = ipsets.NewIPSetMetadata("app:a", ipsets.KeyValueLabelOfPod)
+	nodeTestAppBSet     = ipsets.NewIPSetMetadata("app:b", ipsets.KeyValueLabelOfPod)
+	nodeTestClientSet   = ipsets.NewIPSetMetadata("role:client", ipsets.KeyValueLabelOfPod)
+	nodeTestPodA        = dataplane.NewPodMetadata("ns1/a", "10.0.0.1", "node1")
+	nodeTestPodB        = dataplane.NewPodMetadata("ns1/b", "10.0.0.2", "node2")
+	nodeTestPodAOnNode2 = dataplane.NewPodMetadata("ns1/a2", "10.0.0.3", "node2")
+)
+
+func nodeTestPolicy(name string, selectorSet *ipsets.IPSetMetadata) *policies.NPMNetworkPolicy {
+	return &policies.NPMNetworkPolicy{
+		Namespace: "ns1",
+		PolicyKey: "ns1/" + name,
+		PodSelectorIPSets: []*ipsets.TranslatedIPSet{
+			{Metadata: nodeTestNSSet},
+			{Metadata: selectorSet},
+		},
+		RuleIPSets: []*ipsets.TranslatedIPSet{
+			{Metadata: nodeTestClientSet},
+		},
+	}
+}
+
+func newNodeTestDPShim(t *testing.T) *DPShim {
+	dp, err := NewDPSim(nil)
+	require.NoError(t, err)
+
+	require.NoError(t, dp.AddToSets([]*ipsets.IPSetMetadata{nodeTestNSSet, nodeTestAppASet}, nodeTestPodA))
+	require.NoError(t, dp.AddToSets([]*ipsets.IPSetMetadata{nodeTestNSSet, nodeTestAppBSet}, nodeTestPodB))
+	dp.CreateIPSets([]*ipsets.IPSetMetadata{nodeTestClientSet})
+	require.NoError(t, dp.UpdatePolicy(nodeTestPolicy("policy-a", nodeTestAppASet)))
+	require.NoError(t, dp.UpdatePolicy(nodeTestPolicy("policy-b", nodeTestAppBSet)))
+	return dp
+}
+
+func TestNodeGoalStateHydration(t *testing.T) {
+	dp := newNodeTestDPShim(t)
+
+	event, view, err := dp.NodeGoalState("node1", nil)
+	require.NoError(t, err)
+	require.Equal(t, protos.Events_Hydration, event.GetEventType())
+	require.Equal(t, []string{"ns1/policy-a"}, decodePolicyKeys(t, event, controlplane.PolicyApply))
+	require.Equal(t, []string{"ns-ns1", "podlabel-app:a", "podlabel-role:client"}, decodeSetNames(t, event, controlplane.IpsetApply))
+	require.NotContains(t, event.GetPayload(), controlplane.IpsetRemove)
+	require.NotContains(t, event.GetPayload(), controlplane.PolicyRemove)
+	require.Len(t, view.Sets, 3)
+	require.Len(t, view.Policies, 1)
+
+	event, _, err = dp.NodeGoalState("node3", nil)
+	require.NoError(t, err)
+	require.Nil(t, event, "no policies select a pod on node3")
+}
+
+func TestNodeGoalStateDeltas(t *testing.T) {
+	dp := newNodeTestDPShim(t)
+
+	_, view, err := dp.NodeGoalState("node2", nil)
+	require.NoError(t, err)
+	require.Contains(t, view.Policies, "ns1/policy-b")
+	require.NotContains(t, view.Policies, "ns1/policy-a")
+
+	event, nextView, err := dp.NodeGoalState("node2", view)
+	require.NoError(t, err)
+	require.Nil(t, event, "nothing changed")
+	require.Equal(t, view, nextView)
+
+	// a pod on node2 is selected by policy-a, so policy-a and its sets are sent
+	require.NoError(t, dp.AddToSets([]*ipsets.IPSetMetadata{nodeTestNSSet, nodeTestAppASet}, nodeTestPodAOnNode2))
+	require.NoError(t, dp.ApplyDataPlane())
+
+	event, view, err = dp.NodeGoalState("node2", view)
+	require.NoError(t, err)
+	require.Equal(t, protos.Events_GoalState, event.GetEventType())
+	require.Equal(t, []string{"ns1/policy-a"}, decodePolicyKeys(t, event, controlplane.PolicyApply))
+	require.Equal(t, []string{"ns-ns1", "podlabel-app:a"}, decodeSetNames(t, event, controlplane.IpsetApply))
+	require.NotContains(t, event.GetPayload(), controlplane.PolicyRemove)
+
+	// node1 only gets the updated sets
+	_, node1View, err := dp.NodeGoalState("node1", nil)
+	require.NoError(t, err)
+	require.NoError(t, dp.RemoveFromSets([]*ipsets.IPSetMetadata{nodeTestAppBSet}, nodeTestPodB))
+	require.NoError(t, dp.ApplyDataPlane())
+	event, _, err = dp.NodeGoalState("node1", node1View)
+	require.NoError(t, err)
+	require.Nil(t, event, "app:b isn't referenced by policies on node1")
+
+	// policy-b no longer selects a pod on node2, so it and its set are removed
+	event, _, err = dp.NodeGoalState("node2", view)
+	require.NoError(t, err)
+	require.Equal(t, []string{"ns1/policy-b"}, decodeStrings(t, event, controlplane.PolicyRemove))
+	require.Equal(t, []string{"podlabel-app:b"}, decodeStrings(t, event, controlplane.IpsetRemove))
+	require.NotContains(t, event.GetPayload(), controlplane.PolicyApply)
+}
+
+func decodePolicyKeys(t *testing.T, event *protos.Events, key string) []string {
+	t.Helper()
+	require.Contains(t, event.GetPayload(), key)
+	netpols, err := controlplane.DecodeNPMNetworkPolicies(bytes.NewBuffer(event.GetPayload()[key].GetData()))
+	require.NoError(t, err)
+	policyKeys := make([]string, 0, len(netpols))
+	for _, netpol := range netpols {
+		policyKeys = append(policyKeys, netpol.PolicyKey)
+	}
+	return policyKeys
+}
+
+func decodeSetNames(t *testing.T, event *protos.Events, key string) []string {
+	t.Helper()
+	require.Contains(t, event.GetPayload(), key)
+	sets, err := controlplane.DecodeControllerIPSets(bytes.NewBuffer(event.GetPayload()[key].GetData()))
+	require.NoError(t, err)
+	setNames := make([]string, 0, len(sets))
+	for _, set := range sets {
+		setNames = append(setNames, set.GetPrefixName())
+	}
+	return setNames
+}
+
+func decodeStrings(t *testing.T, event *protos.Events, key string) []string {
+	t.Helper()
+	require.Contains(t, event.GetPayload(), key)
+	names, err := controlplane.DecodeStrings(bytes.NewBuffer(event.GetPayload()[key].GetData()))
+	require.NoError(t, err)
+	return names
+}
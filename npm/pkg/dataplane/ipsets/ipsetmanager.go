@@ -7,6 +7,7 @@ import (
 
 	"github.com/Azure/azure-container-networking/common"
 	"github.com/Azure/azure-container-networking/npm/metrics"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/bpfpolicy"
 	"github.com/Azure/azure-container-networking/npm/util"
 	npmerrors "github.com/Azure/azure-container-networking/npm/util/errors"
 	"k8s.io/klog"
@@ -65,6 +66,12 @@ type IPSetManagerCfg struct {
 	// This is necessary for HNS (Windows); otherwise, an allow ACL with a list condition
 	// allows all IPs if the list has no members.
 	AddEmptySetToLists bool
+	// NativeNftables programs nftables sets in NPM's nftables table instead of kernel ipsets.
+	// Only affects Linux.
+	NativeNftables bool
+	// BPFMaps are programmed instead of kernel ipsets if set (i.e. in the PolicyManager's BPF mode).
+	// Only affects Linux.
+	BPFMaps bpfpolicy.Maps
 }
 
 func NewIPSetManager(iMgrCfg *IPSetManagerCfg, ioShim *common.IOShim) *IPSetManager {
@@ -491,6 +498,148 @@ func (iMgr *IPSetManager) GetAllIPSets() map[string]string {
 	return setMap
 }
 
+func (iMgr *IPSetManager) DoesIPSatisfySelectorIPSets(ip, podKey string, setList map[string]struct{}) (bool, error) {
+	if len(setList) == 0 {
+		klog.Infof("[ipset manager] unexpectedly encountered empty selector list")
+		return true, nil
+	}
+	iMgr.Lock()
+	defer iMgr.Unlock()
+
+	if err := iMgr.validateSelectorIPSets(setList); err != nil {
+		return false, err
+	}
+
+	for setName := range setList {
+		set := iMgr.setMap[setName]
+		if !set.isIPAffiliated(ip, podKey) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// GetIPsFromSelectorIPSets will take in a map of prefixedSetNames and return an intersection of IPs mapped to pod key
+func (iMgr *IPSetManager) GetIPsFromSelectorIPSets(setList map[string]struct{}) (map[string]string, error) {
+	ips := make(map[string]string)
+	if len(setList) == 0 {
+		return ips, nil
+	}
+	iMgr.Lock()
+	defer iMgr.Unlock()
+
+	if err := iMgr.validateSelectorIPSets(setList); err != nil {
+		return nil, err
+	}
+
+	// the following is a space/time optimized way to get the intersection of IPs from the selector sets
+	// we should always take the hash set branch because a pod selector always includes a namespace ipset,
+	// which is a hash set, and we favor hash sets for firstSet
+	var firstSet *IPSet
+	for setName := range setList {
+		firstSet = iMgr.setMap[setName]
+		if firstSet.Kind == HashSet {
+			// firstSet can be any set, but ideally is a hash set for efficiency (compare the branch for hash sets to the one for lists below)
+			break
+		}
+	}
+	if firstSet.Kind == HashSet {
+		// include every IP in firstSet that is also affiliated with every other selector set
+		for ip, podKey := range firstSet.IPPodKey {
+			isAffiliated := true
+			for otherSetName := range setList {
+				if otherSetName == firstSet.Name {
+					continue
+				}
+				otherSet := iMgr.setMap[otherSetName]
+				if !otherSet.isIPAffiliated(ip, podKey) {
+					isAffiliated = false
+					break
+				}
+			}
+
+			if isAffiliated {
+				ips[ip] = podKey
+			}
+		}
+	} else {
+		// should never reach this branch (see note above)
+		// include every IP affiliated with firstSet that is also affiliated with every other selector set
+		// identical to the hash set case, except we have to make space for all IPs affiliated with firstSet
+
+		// only loop over the unique affiliated IPs
+		for _, memberSet := range firstSet.MemberIPSets {
+			for ip, podKey := range memberSet.IPPodKey {
+				if oldKey, ok := ips[ip]; ok && oldKey != podKey {
+					// this could lead to unintentionally considering this Pod (Pod B) to be part of the selector set if:
+					// 1. Pod B has the same IP as a previous Pod A
+					// 2. Pod B create is somehow processed before Pod A delete
+					// 3. This method is called before Pod A delete
+					// again, this
+					klog.Warningf("[GetIPsFromSelectorIPSets] IP currently associated with two different pod keys. to ensure no issues occur with network policies, restart this ip: %s", ip)
+				}
+				ips[ip] = podKey
+			}
+		}
+		for ip, podKey := range ips {
+			// identical to the hash set case
+			isAffiliated := true
+			for otherSetName := range setList {
+				if otherSetName == firstSet.Name {
+					continue
+				}
+				otherSet := iMgr.setMap[otherSetName]
+				if !otherSet.isIPAffiliated(ip, podKey) {
+					isAffiliated = false
+					break
+				}
+			}
+
+			if !isAffiliated {
+				delete(ips, ip)
+			}
+		}
+	}
+	return ips, nil
+}
+
+func (iMgr *IPSetManager) GetSelectorReferencesBySet(setName string) (map[string]struct{}, error) {
+	iMgr.Lock()
+	defer iMgr.Unlock()
+	if !iMgr.exists(setName) {
+		return nil, npmerrors.Errorf(
+			npmerrors.GetSelectorReference,
+			false,
+			fmt.Sprintf("[ipset manager] selector ipset %s does not exist", setName))
+	}
+	set := iMgr.setMap[setName]
+	m := make(map[string]struct{}, len(set.SelectorReference))
+	for r := range set.SelectorReference {
+		m[r] = struct{}{}
+	}
+	return m, nil
+}
+
+func (iMgr *IPSetManager) validateSelectorIPSets(setList map[string]struct{}) error {
+	for setName := range setList {
+		if !iMgr.exists(setName) {
+			return npmerrors.Errorf(
+				npmerrors.GetSelectorReference,
+				false,
+				fmt.Sprintf("[ipset manager] selector ipset %s does not exist", setName))
+		}
+		set := iMgr.setMap[setName]
+		if !set.canSetBeSelectorIPSet() {
+			return npmerrors.Errorf(
+				npmerrors.IPSetIntersection,
+				false,
+				fmt.Sprintf("[IPSet] Selector IPSet cannot be of type %s", set.Type.String()))
+		}
+	}
+	return nil
+}
+
 func (iMgr *IPSetManager) exists(name string) bool {
 	_, ok := iMgr.setMap[name]
 	return ok
@@ -0,0 +1,122 @@
+package ipsets
+
+// This file contains code for programming NPM's sets into eBPF maps in the PolicyManager's BPF mode.
+
+import (
+	"net/netip"
+
+	"github.com/Azure/azure-container-networking/npm/metrics"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/bpfpolicy"
+	"github.com/Azure/azure-container-networking/npm/util"
+	npmerrors "github.com/Azure/azure-container-networking/npm/util/errors"
+)
+
+var bpfProtocols = map[string]uint8{
+	"tcp":  bpfpolicy.TCPProtocol,
+	"udp":  bpfpolicy.UDPProtocol,
+	"sctp": bpfpolicy.SCTPProtocol,
+}
+
+// BPFSetKind returns the kind of eBPF map which holds the members of a set type.
+// Lists are flattened into a hash set of their members' IPs.
+func BPFSetKind(setType SetType) bpfpolicy.SetKind {
+	switch setType {
+	case CIDRBlocks:
+		return bpfpolicy.CIDRSetKind
+	case NamedPorts:
+		return bpfpolicy.NamedPortSetKind
+	default:
+		return bpfpolicy.HashSetKind
+	}
+}
+
+// applyBPFSets replaces the members of dirty sets (and lists with a dirty member) and removes deleted sets.
+// Unlike ipset restore, there are no references between sets and policies in the maps, so sets can always be deleted.
+func (iMgr *IPSetManager) applyBPFSets() error {
+	bpfMaps := iMgr.iMgrCfg.BPFMaps
+	for _, prefixedName := range sortedSetNames(iMgr.setsToRefill()) {
+		set, ok := iMgr.setMap[prefixedName]
+		if !ok {
+			metrics.SendErrorLogAndMetric(util.IpsmID, "skipping eBPF refill for set %s since it isn't in the cache", prefixedName)
+			continue
+		}
+		if err := bpfMaps.ReplaceSet(iMgr.bpfSet(set)); err != nil {
+			return npmerrors.SimpleErrorWrapper("failed to replace eBPF set "+prefixedName, err)
+		}
+	}
+
+	for _, prefixedName := range sortedSetNames(iMgr.dirtyCache.setsToDelete()) {
+		if err := bpfMaps.DeleteSet(bpfpolicy.SetID(prefixedName)); err != nil {
+			return npmerrors.SimpleErrorWrapper("failed to delete eBPF set "+prefixedName, err)
+		}
+	}
+	return nil
+}
+
+// resetBPFSets destroys kernel ipsets left behind by iptables-based NPM on a best-effort basis.
+// The PolicyManager empties the eBPF maps during bootup.
+func (iMgr *IPSetManager) resetBPFSets() error {
+	if err := iMgr.resetKernelIPSets(); err != nil {
+		metrics.SendErrorLogAndMetric(util.IpsmID, "failed to reset kernel ipsets while using eBPF. err: %v", err)
+	}
+	return nil
+}
+
+func (iMgr *IPSetManager) bpfSet(set *IPSet) *bpfpolicy.Set {
+	bpfSet := &bpfpolicy.Set{
+		ID:   bpfpolicy.SetID(set.Name),
+		Kind: BPFSetKind(set.Type),
+	}
+
+	switch bpfSet.Kind {
+	case bpfpolicy.CIDRSetKind:
+		for member := range set.IPPodKey {
+			m, err := parseNftMember(member)
+			if err != nil {
+				metrics.SendErrorLogAndMetric(util.IpsmID, "skipping member %s of set %s for eBPF. err: %v", member, set.Name, err)
+				continue
+			}
+			bpfSet.CIDRs = append(bpfSet.CIDRs, bpfpolicy.CIDR{Prefix: m.prefix, NoMatch: m.nomatch})
+		}
+	case bpfpolicy.NamedPortSetKind:
+		for member := range set.IPPodKey {
+			m, err := parseNamedPortMember(member)
+			if err != nil {
+				metrics.SendErrorLogAndMetric(util.IpsmID, "skipping member %s of set %s for eBPF. err: %v", member, set.Name, err)
+				continue
+			}
+			protocol, ok := bpfProtocols[m.protocol]
+			if !ok {
+				metrics.SendErrorLogAndMetric(util.IpsmID, "skipping member %s of set %s for eBPF since the protocol is unknown", member, set.Name)
+				continue
+			}
+			bpfSet.NamedPorts = append(bpfSet.NamedPorts, bpfpolicy.NamedPort{IP: m.addr, Protocol: protocol, Port: m.port})
+		}
+	default:
+		if set.Kind != ListSet {
+			bpfSet.IPs = bpfIPs(set.Name, set.IPPodKey, bpfSet.IPs)
+			break
+		}
+		for _, memberSet := range set.MemberIPSets {
+			if memberSet.Type == NamedPorts {
+				metrics.SendErrorLogAndMetric(util.IpsmID, "skipping NamedPorts member %s of list %s for eBPF", memberSet.Name, set.Name)
+				continue
+			}
+			bpfSet.IPs = bpfIPs(set.Name, memberSet.IPPodKey, bpfSet.IPs)
+		}
+	}
+	return bpfSet
+}
+
+// bpfIPs appends the IPs of members to ips. Hash sets can't hold CIDRs, so other members are skipped.
+func bpfIPs(setName string, members map[string]string, ips []netip.Addr) []netip.Addr {
+	for member := range members {
+		m, err := parseNftMember(member)
+		if err != nil || m.nomatch || m.prefix.Bits() != m.prefix.Addr().BitLen() {
+			metrics.SendErrorLogAndMetric(util.IpsmID, "skipping member %s of set %s for eBPF since it isn't an IP", member, setName)
+			continue
+		}
+		ips = append(ips, m.prefix.Addr())
+	}
+	return ips
+}
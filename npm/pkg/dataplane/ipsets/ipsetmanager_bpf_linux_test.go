@@ -0,0 +1,85 @@
+package ipsets
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/bpfpolicy"
+	"github.com/Azure/azure-container-networking/npm/util"
+	"github.com/stretchr/testify/require"
+)
+
+func bpfApplyAlwaysCfg(bpfMaps bpfpolicy.Maps) *IPSetManagerCfg {
+	return &IPSetManagerCfg{
+		IPSetMode:   ApplyAllIPSets,
+		NetworkName: "azure",
+		BPFMaps:     bpfMaps,
+	}
+}
+
+func TestApplyBPFSets(t *testing.T) {
+	fake := bpfpolicy.NewFakeMaps()
+	iMgr := NewIPSetManager(bpfApplyAlwaysCfg(fake), common.NewMockIOShim(nil))
+
+	iMgr.CreateIPSets([]*IPSetMetadata{TestNSSet.Metadata, TestKeyPodSet.Metadata, TestNamedportSet.Metadata, TestCIDRSet.Metadata, TestKVPodSet.Metadata})
+	require.NoError(t, iMgr.AddToSets([]*IPSetMetadata{TestNSSet.Metadata, TestKeyPodSet.Metadata}, "10.0.0.1", "a"))
+	require.NoError(t, iMgr.AddToSets([]*IPSetMetadata{TestNSSet.Metadata}, "10.0.0.2", "b"))
+	require.NoError(t, iMgr.AddToSets([]*IPSetMetadata{TestNamedportSet.Metadata}, "10.0.0.1,TCP:8080", "a"))
+	require.NoError(t, iMgr.AddToSets([]*IPSetMetadata{TestNamedportSet.Metadata}, "10.0.0.2,8081", "b"))
+	require.NoError(t, iMgr.AddToSets([]*IPSetMetadata{TestCIDRSet.Metadata}, "10.0.0.0/16", ""))
+	require.NoError(t, iMgr.AddToSets([]*IPSetMetadata{TestCIDRSet.Metadata}, "10.0.1.0/24 nomatch", ""))
+	require.NoError(t, iMgr.AddToLists([]*IPSetMetadata{TestKeyNSList.Metadata}, []*IPSetMetadata{TestNSSet.Metadata}))
+	require.NoError(t, iMgr.ApplyIPSets())
+
+	nsSet := fake.Sets[bpfpolicy.SetID(TestNSSet.PrefixName)]
+	require.NotNil(t, nsSet)
+	require.Equal(t, bpfpolicy.HashSetKind, nsSet.Kind)
+	require.ElementsMatch(t, []netip.Addr{netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("10.0.0.2")}, nsSet.IPs)
+
+	// lists are flattened
+	list := fake.Sets[bpfpolicy.SetID(TestKeyNSList.PrefixName)]
+	require.NotNil(t, list)
+	require.Equal(t, bpfpolicy.HashSetKind, list.Kind)
+	require.ElementsMatch(t, nsSet.IPs, list.IPs)
+
+	cidrSet := fake.Sets[bpfpolicy.SetID(TestCIDRSet.PrefixName)]
+	require.NotNil(t, cidrSet)
+	require.Equal(t, bpfpolicy.CIDRSetKind, cidrSet.Kind)
+	require.ElementsMatch(t, []bpfpolicy.CIDR{
+		{Prefix: netip.MustParsePrefix("10.0.0.0/16")},
+		{Prefix: netip.MustParsePrefix("10.0.1.0/24"), NoMatch: true},
+	}, cidrSet.CIDRs)
+
+	namedPortSet := fake.Sets[bpfpolicy.SetID(TestNamedportSet.PrefixName)]
+	require.NotNil(t, namedPortSet)
+	require.Equal(t, bpfpolicy.NamedPortSetKind, namedPortSet.Kind)
+	require.ElementsMatch(t, []bpfpolicy.NamedPort{
+		{IP: netip.MustParseAddr("10.0.0.1"), Protocol: bpfpolicy.TCPProtocol, Port: 8080},
+		{IP: netip.MustParseAddr("10.0.0.2"), Protocol: bpfpolicy.TCPProtocol, Port: 8081},
+	}, namedPortSet.NamedPorts)
+
+	// adding a member to the Namespace set refills the list containing it, and deleted sets are removed
+	require.NoError(t, iMgr.AddToSets([]*IPSetMetadata{TestNSSet.Metadata}, "10.0.0.3", "c"))
+	iMgr.DeleteIPSet(TestKVPodSet.PrefixName, util.SoftDelete)
+	require.Contains(t, fake.Sets, bpfpolicy.SetID(TestKVPodSet.PrefixName))
+	require.NoError(t, iMgr.ApplyIPSets())
+	require.Len(t, fake.Sets[bpfpolicy.SetID(TestKeyNSList.PrefixName)].IPs, 3)
+	require.NotContains(t, fake.Sets, bpfpolicy.SetID(TestKVPodSet.PrefixName))
+}
+
+func TestApplyBPFSetsFailure(t *testing.T) {
+	fake := bpfpolicy.NewFakeMaps()
+	fake.Err = errors.New("test error")
+	iMgr := NewIPSetManager(bpfApplyAlwaysCfg(fake), common.NewMockIOShim(nil))
+
+	iMgr.CreateIPSets([]*IPSetMetadata{TestNSSet.Metadata})
+	require.Error(t, iMgr.ApplyIPSets())
+	// the set stays dirty so that the next apply retries
+	require.True(t, iMgr.dirtyCache.isSetToAddOrUpdate(TestNSSet.PrefixName))
+
+	fake.Err = nil
+	require.NoError(t, iMgr.ApplyIPSets())
+	require.Contains(t, fake.Sets, bpfpolicy.SetID(TestNSSet.PrefixName))
+}
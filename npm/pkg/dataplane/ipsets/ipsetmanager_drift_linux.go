@@ -0,0 +1,214 @@
+package ipsets
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/parse"
+	"github.com/Azure/azure-container-networking/npm/util"
+	npmerrors "github.com/Azure/azure-container-networking/npm/util/errors"
+	"k8s.io/klog"
+)
+
+const (
+	hostSuffix     = "/32"
+	defaultPortTCP = "tcp:"
+)
+
+var errDriftUnsupported = errors.New("drift detection is only supported for kernel ipsets")
+
+// IPSetDrift describes how the kernel's ipsets differ from the cache.
+// Members are written as in the cache (or as in ipset save output for extra members).
+type IPSetDrift struct {
+	// MissingSets are prefixed names of sets that should be in the kernel but aren't
+	MissingSets []string
+	// MissingMembers maps prefixed set names to members missing from the kernel
+	MissingMembers map[string][]string
+	// ExtraMembers maps prefixed set names to members in the kernel that aren't in the cache
+	ExtraMembers map[string][]string
+}
+
+// NumDriftedSets returns the number of sets that are missing or have different members.
+func (drift *IPSetDrift) NumDriftedSets() int {
+	numSets := len(drift.MissingSets) + len(drift.MissingMembers)
+	for setName := range drift.ExtraMembers {
+		if _, ok := drift.MissingMembers[setName]; !ok {
+			numSets++
+		}
+	}
+	return numSets
+}
+
+// expectedSet is a set in the cache which should be in the kernel, read while the IPSetManager is locked.
+type expectedSet struct {
+	hashedName string
+	// members maps each member, normalized as in ipset save output, to the member as in the cache
+	members map[string]string
+}
+
+// VerifyIPSets compares the ipsets in the kernel against the cache.
+// Sets in the dirty cache are skipped since they're about to be applied.
+// If markDirty is true, drifted sets are added to the dirty cache so that the next ApplyIPSets() repairs them.
+// The IPSetManager is only locked while the cache is read and marked dirty, so ipset save doesn't block updates.
+func (iMgr *IPSetManager) VerifyIPSets(markDirty bool) (*IPSetDrift, error) {
+	if iMgr.iMgrCfg.NativeNftables || iMgr.iMgrCfg.BPFMaps != nil {
+		return nil, errDriftUnsupported
+	}
+
+	expectedSets := iMgr.expectedKernelSets()
+
+	parser := parse.IPSetParser{IOShim: iMgr.ioShim}
+	kernelSets, err := parser.IPSets()
+	if err != nil {
+		return nil, npmerrors.SimpleErrorWrapper("failed to read ipsets from the kernel", err)
+	}
+
+	drift := &IPSetDrift{
+		MissingMembers: make(map[string][]string),
+		ExtraMembers:   make(map[string][]string),
+	}
+	for prefixedName, expected := range expectedSets {
+		kernelSet, ok := kernelSets[expected.hashedName]
+		if !ok {
+			drift.MissingSets = append(drift.MissingSets, prefixedName)
+			continue
+		}
+
+		missingMembers := make(map[string]string, len(expected.members))
+		for normalized, member := range expected.members {
+			missingMembers[normalized] = member
+		}
+		for member := range kernelSet.Members {
+			normalized := normalizeKernelMember(member)
+			if _, ok := missingMembers[normalized]; ok {
+				delete(missingMembers, normalized)
+				continue
+			}
+			drift.ExtraMembers[prefixedName] = append(drift.ExtraMembers[prefixedName], member)
+		}
+		for _, member := range missingMembers {
+			drift.MissingMembers[prefixedName] = append(drift.MissingMembers[prefixedName], member)
+		}
+	}
+
+	if drift.NumDriftedSets() > 0 {
+		klog.Warningf("[IPSetManager] ipsets in the kernel differ from the cache. missing sets: %v. missing members: %v. extra members: %v",
+			drift.MissingSets, drift.MissingMembers, drift.ExtraMembers)
+		if markDirty {
+			iMgr.markDrift(drift)
+		}
+	}
+	return drift, nil
+}
+
+// expectedKernelSets returns the sets which should be in the kernel, keyed by prefixed name.
+func (iMgr *IPSetManager) expectedKernelSets() map[string]*expectedSet {
+	iMgr.Lock()
+	defer iMgr.Unlock()
+
+	expectedSets := make(map[string]*expectedSet)
+	for prefixedName, set := range iMgr.setMap {
+		if !iMgr.shouldBeInKernel(set) || iMgr.dirtyCache.isSetToAddOrUpdate(prefixedName) || iMgr.dirtyCache.isSetToDelete(prefixedName) {
+			continue
+		}
+		expectedSets[prefixedName] = &expectedSet{
+			hashedName: set.HashedName,
+			members:    cacheMembers(set),
+		}
+	}
+	return expectedSets
+}
+
+// markDrift adds the drifted sets to the dirty cache.
+// Sets which were updated or deleted since they were verified are skipped, since their drift may be stale.
+func (iMgr *IPSetManager) markDrift(drift *IPSetDrift) {
+	iMgr.Lock()
+	defer iMgr.Unlock()
+
+	// check every set before any is marked dirty
+	driftedSets := make(map[string]*IPSet)
+	driftedMembers := make(map[string]map[string]string)
+	addSet := func(prefixedName string) {
+		set, ok := iMgr.setMap[prefixedName]
+		if !ok || !iMgr.shouldBeInKernel(set) || iMgr.dirtyCache.isSetToAddOrUpdate(prefixedName) || iMgr.dirtyCache.isSetToDelete(prefixedName) {
+			return
+		}
+		driftedSets[prefixedName] = set
+		driftedMembers[prefixedName] = cacheMembers(set)
+	}
+	for _, prefixedName := range drift.MissingSets {
+		addSet(prefixedName)
+	}
+	for prefixedName := range drift.ExtraMembers {
+		addSet(prefixedName)
+	}
+	for prefixedName := range drift.MissingMembers {
+		addSet(prefixedName)
+	}
+
+	for _, prefixedName := range drift.MissingSets {
+		if set, ok := driftedSets[prefixedName]; ok {
+			iMgr.dirtyCache.create(set)
+		}
+	}
+	for prefixedName, members := range drift.ExtraMembers {
+		set, ok := driftedSets[prefixedName]
+		if !ok {
+			continue
+		}
+		for _, member := range members {
+			if _, ok := driftedMembers[prefixedName][normalizeKernelMember(member)]; !ok {
+				iMgr.dirtyCache.deleteMember(set, member)
+			}
+		}
+	}
+	for prefixedName, members := range drift.MissingMembers {
+		set, ok := driftedSets[prefixedName]
+		if !ok {
+			continue
+		}
+		for _, member := range members {
+			if _, ok := driftedMembers[prefixedName][normalizeKernelMember(member)]; ok {
+				iMgr.dirtyCache.addMember(set, member)
+			}
+		}
+	}
+}
+
+// cacheMembers keys the members of the set by the normalized member so that e.g. 10.0.0.1/32 in the cache matches
+// 10.0.0.1 in the kernel.
+func cacheMembers(set *IPSet) map[string]string {
+	members := make(map[string]string)
+	if set.Kind == HashSet {
+		for member := range set.IPPodKey {
+			members[normalizeKernelMember(member)] = member
+		}
+	} else {
+		for _, memberSet := range set.MemberIPSets {
+			members[memberSet.HashedName] = memberSet.HashedName
+		}
+	}
+	return members
+}
+
+// normalizeKernelMember returns the member as ipset save would write it.
+// ipset save omits /32 for a single IP in a hash:net set and always writes the protocol for a port.
+func normalizeKernelMember(member string) string {
+	member = strings.ToLower(strings.TrimSpace(member))
+	member, nomatch := strings.CutSuffix(member, " "+util.IpsetNomatch)
+
+	ip, port, hasPort := strings.Cut(member, ",")
+	ip = strings.TrimSuffix(ip, hostSuffix)
+	if hasPort && !strings.Contains(port, ":") {
+		port = defaultPortTCP + port
+	}
+
+	normalized := ip
+	if hasPort {
+		normalized += "," + port
+	}
+	if nomatch {
+		normalized += " " + util.IpsetNomatch
+	}
+	return normalized
+}
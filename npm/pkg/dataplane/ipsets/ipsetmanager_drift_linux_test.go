@@ -0,0 +1,164 @@
+package ipsets
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/common"
+	dptestutils "github.com/Azure/azure-container-networking/npm/pkg/dataplane/testutils"
+	testutils "github.com/Azure/azure-container-networking/test/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func driftTestSaveCall(lines ...string) testutils.TestCmd {
+	return testutils.TestCmd{Cmd: []string{"ipset", "save"}, Stdout: strings.Join(lines, "\n") + "\n"}
+}
+
+func newDriftTestIPSetManager(t *testing.T, ioshim *common.IOShim) *IPSetManager {
+	iMgr := NewIPSetManager(applyAlwaysCfg, ioshim)
+	require.NoError(t, iMgr.AddToSets([]*IPSetMetadata{TestNSSet.Metadata}, "1.1.1.1", "a"))
+	require.NoError(t, iMgr.AddToSets([]*IPSetMetadata{TestNSSet.Metadata}, "2.2.2.2", "b"))
+	require.NoError(t, iMgr.AddToSets([]*IPSetMetadata{TestCIDRSet.Metadata}, "10.0.0.0/24 nomatch", ""))
+	require.NoError(t, iMgr.AddToSets([]*IPSetMetadata{TestCIDRSet.Metadata}, "10.0.0.1/32", ""))
+	require.NoError(t, iMgr.AddToSets([]*IPSetMetadata{TestNamedportSet.Metadata}, "1.2.3.4,tcp:567", "a"))
+	require.NoError(t, iMgr.AddToLists([]*IPSetMetadata{TestKeyNSList.Metadata}, []*IPSetMetadata{TestNSSet.Metadata}))
+	// pretend everything has been applied
+	iMgr.clearDirtyCache()
+	return iMgr
+}
+
+func TestVerifyIPSetsNoDrift(t *testing.T) {
+	calls := []testutils.TestCmd{
+		driftTestSaveCall(
+			fmt.Sprintf(createNethashFormat, TestNSSet.HashedName),
+			fmt.Sprintf("add %s 1.1.1.1", TestNSSet.HashedName),
+			fmt.Sprintf("add %s 2.2.2.2", TestNSSet.HashedName),
+			fmt.Sprintf(createNethashFormat, TestCIDRSet.HashedName),
+			fmt.Sprintf("add %s 10.0.0.0/24 nomatch", TestCIDRSet.HashedName),
+			fmt.Sprintf("add %s 10.0.0.1", TestCIDRSet.HashedName),
+			fmt.Sprintf(createPorthashFormat, TestNamedportSet.HashedName),
+			fmt.Sprintf("add %s 1.2.3.4,tcp:567", TestNamedportSet.HashedName),
+			fmt.Sprintf(createListFormat, TestKeyNSList.HashedName),
+			fmt.Sprintf("add %s %s", TestKeyNSList.HashedName, TestNSSet.HashedName),
+			// sets outside the cache are ignored
+			fmt.Sprintf(createNethashFormat, "azure-npm-1234"),
+		),
+	}
+	ioshim := common.NewMockIOShim(calls)
+	defer ioshim.VerifyCalls(t, calls)
+	iMgr := newDriftTestIPSetManager(t, ioshim)
+
+	drift, err := iMgr.VerifyIPSets(true)
+	require.NoError(t, err)
+	require.Equal(t, 0, drift.NumDriftedSets())
+	require.Equal(t, 0, iMgr.dirtyCache.numSetsToAddOrUpdate())
+}
+
+func TestVerifyIPSetsWithDrift(t *testing.T) {
+	calls := []testutils.TestCmd{
+		driftTestSaveCall(
+			fmt.Sprintf(createNethashFormat, TestNSSet.HashedName),
+			fmt.Sprintf("add %s 1.1.1.1", TestNSSet.HashedName),
+			fmt.Sprintf("add %s 9.9.9.9", TestNSSet.HashedName),
+			fmt.Sprintf(createNethashFormat, TestCIDRSet.HashedName),
+			fmt.Sprintf("add %s 10.0.0.1", TestCIDRSet.HashedName),
+			fmt.Sprintf(createListFormat, TestKeyNSList.HashedName),
+			fmt.Sprintf("add %s %s", TestKeyNSList.HashedName, TestNSSet.HashedName),
+		),
+		fakeRestoreSuccessCommand,
+	}
+	ioshim := common.NewMockIOShim(calls)
+	defer ioshim.VerifyCalls(t, calls)
+	iMgr := newDriftTestIPSetManager(t, ioshim)
+
+	drift, err := iMgr.VerifyIPSets(true)
+	require.NoError(t, err)
+	require.Equal(t, []string{TestNamedportSet.PrefixName}, drift.MissingSets)
+	require.Equal(t, map[string][]string{
+		TestNSSet.PrefixName:   {"2.2.2.2"},
+		TestCIDRSet.PrefixName: {"10.0.0.0/24 nomatch"},
+	}, drift.MissingMembers)
+	require.Equal(t, map[string][]string{TestNSSet.PrefixName: {"9.9.9.9"}}, drift.ExtraMembers)
+	require.Equal(t, 3, drift.NumDriftedSets())
+
+	expectedLines := []string{
+		fmt.Sprintf("-N %s --exist nethash", TestNSSet.HashedName),
+		fmt.Sprintf("-N %s --exist nethash maxelem 4294967295", TestCIDRSet.HashedName),
+		fmt.Sprintf("-N %s --exist hash:ip,port", TestNamedportSet.HashedName),
+		fmt.Sprintf("-D %s 9.9.9.9", TestNSSet.HashedName),
+		fmt.Sprintf("-A %s 2.2.2.2", TestNSSet.HashedName),
+		fmt.Sprintf("-A %s 10.0.0.0/24 nomatch", TestCIDRSet.HashedName),
+		fmt.Sprintf("-A %s 1.2.3.4,tcp:567", TestNamedportSet.HashedName),
+		"",
+	}
+	sortedExpectedLines := testAndSortRestoreFileLines(t, expectedLines)
+	creator := iMgr.fileCreatorForApply(len(calls))
+	actualLines := testAndSortRestoreFileString(t, creator.ToString())
+	dptestutils.AssertEqualLines(t, sortedExpectedLines, actualLines)
+	wasFileAltered, err := creator.RunCommandOnceWithFile("ipset", "restore")
+	require.NoError(t, err, "ipset restore should be successful")
+	require.False(t, wasFileAltered, "file should not be altered")
+}
+
+func TestVerifyIPSetsSkipsDirtySets(t *testing.T) {
+	calls := []testutils.TestCmd{driftTestSaveCall()}
+	ioshim := common.NewMockIOShim(calls)
+	defer ioshim.VerifyCalls(t, calls)
+	iMgr := NewIPSetManager(applyAlwaysCfg, ioshim)
+	require.NoError(t, iMgr.AddToSets([]*IPSetMetadata{TestNSSet.Metadata}, "1.1.1.1", "a"))
+
+	drift, err := iMgr.VerifyIPSets(false)
+	require.NoError(t, err)
+	require.Equal(t, 0, drift.NumDriftedSets())
+}
+
+func TestMarkDriftSkipsStaleDrift(t *testing.T) {
+	ioshim := common.NewMockIOShim(nil)
+	defer ioshim.VerifyCalls(t, nil)
+	iMgr := newDriftTestIPSetManager(t, ioshim)
+	drift := &IPSetDrift{
+		MissingSets: []string{TestNamedportSet.PrefixName},
+		MissingMembers: map[string][]string{
+			TestNSSet.PrefixName:   {"2.2.2.2"},
+			TestCIDRSet.PrefixName: {"10.0.0.0/24 nomatch"},
+		},
+		ExtraMembers: map[string][]string{TestNSSet.PrefixName: {"9.9.9.9"}},
+	}
+
+	// the missing member is removed and applied after the ipsets were verified
+	require.NoError(t, iMgr.RemoveFromSets([]*IPSetMetadata{TestCIDRSet.Metadata}, "10.0.0.0/24 nomatch", ""))
+	iMgr.clearDirtyCache()
+
+	iMgr.markDrift(drift)
+	require.True(t, iMgr.dirtyCache.isSetToAddOrUpdate(TestNamedportSet.PrefixName))
+	require.True(t, iMgr.dirtyCache.isSetToAddOrUpdate(TestNSSet.PrefixName))
+	require.False(t, iMgr.dirtyCache.isSetToAddOrUpdate(TestCIDRSet.PrefixName))
+}
+
+func TestVerifyIPSetsFailure(t *testing.T) {
+	calls := []testutils.TestCmd{{Cmd: []string{"ipset", "save"}, ExitCode: 1}}
+	ioshim := common.NewMockIOShim(calls)
+	defer ioshim.VerifyCalls(t, calls)
+	iMgr := NewIPSetManager(applyAlwaysCfg, ioshim)
+
+	_, err := iMgr.VerifyIPSets(true)
+	require.Error(t, err)
+}
+
+func TestNormalizeKernelMember(t *testing.T) {
+	tests := map[string]string{
+		"10.0.0.1":              "10.0.0.1",
+		"10.0.0.1/32":           "10.0.0.1",
+		"10.0.0.0/24":           "10.0.0.0/24",
+		"10.0.0.0/32 nomatch":   "10.0.0.0 nomatch",
+		"10.0.0.1,80":           "10.0.0.1,tcp:80",
+		"10.0.0.1,udp:53":       "10.0.0.1,udp:53",
+		"10.0.0.0/32,tcp:80":    "10.0.0.0,tcp:80",
+		"FE80::1":               "fe80::1",
+		"azure-npm-3216600258 ": "azure-npm-3216600258",
+	}
+	for member, expected := range tests {
+		require.Equal(t, expected, normalizeKernelMember(member), "member: %s", member)
+	}
+}
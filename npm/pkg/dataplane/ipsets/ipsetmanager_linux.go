@@ -101,6 +101,17 @@ prometheus metrics:
 	If a flush fails, we could update the num entries for that set, but that would be a lot of overhead.
 */
 func (iMgr *IPSetManager) resetIPSets() error {
+	if iMgr.iMgrCfg.BPFMaps != nil {
+		return iMgr.resetBPFSets()
+	}
+	if iMgr.iMgrCfg.NativeNftables {
+		return iMgr.resetNftSets()
+	}
+	return iMgr.resetKernelIPSets()
+}
+
+// resetKernelIPSets flushes and destroys all NPM ipsets in the kernel. See resetIPSets() for details.
+func (iMgr *IPSetManager) resetKernelIPSets() error {
 	if success := iMgr.resetWithoutRestore(); success {
 		return nil
 	}
@@ -421,8 +432,16 @@ example where:
 		-X set4
 */
 func (iMgr *IPSetManager) applyIPSets() error {
-	creator := iMgr.fileCreatorForApply(maxTryCount)
-	restoreError := creator.RunCommandWithFile(ipsetCommand, ipsetRestoreFlag)
+	var restoreError error
+	switch {
+	case iMgr.iMgrCfg.BPFMaps != nil:
+		restoreError = iMgr.applyBPFSets()
+	case iMgr.iMgrCfg.NativeNftables:
+		restoreError = iMgr.applyNftSets()
+	default:
+		creator := iMgr.fileCreatorForApply(maxTryCount)
+		restoreError = creator.RunCommandWithFile(ipsetCommand, ipsetRestoreFlag)
+	}
 	if restoreError != nil {
 		iMgr.consecutiveApplyFailures++
 		if iMgr.consecutiveApplyFailures >= maxConsecutiveFailures {
@@ -441,6 +460,28 @@ func (iMgr *IPSetManager) applyIPSets() error {
 	return nil
 }
 
+// setsToRefill returns the dirty sets and the lists in the kernel with a dirty member.
+// nftables sets and eBPF maps can't reference other sets, so these modes refill lists with their members' members.
+func (iMgr *IPSetManager) setsToRefill() map[string]struct{} {
+	setsToAddOrUpdate := iMgr.dirtyCache.setsToAddOrUpdate()
+	setsToRefill := make(map[string]struct{}, len(setsToAddOrUpdate))
+	for prefixedName := range setsToAddOrUpdate {
+		setsToRefill[prefixedName] = struct{}{}
+	}
+	for _, set := range iMgr.setMap {
+		if set.Kind != ListSet || !iMgr.shouldBeInKernel(set) || iMgr.dirtyCache.isSetToDelete(set.Name) {
+			continue
+		}
+		for _, member := range set.MemberIPSets {
+			if iMgr.dirtyCache.isSetToAddOrUpdate(member.Name) {
+				setsToRefill[set.Name] = struct{}{}
+				break
+			}
+		}
+	}
+	return setsToRefill
+}
+
 func (iMgr *IPSetManager) ipsetSave() ([]byte, error) {
 	command := iMgr.ioShim.Exec.Command(ipsetCommand, ipsetSaveFlag)
 	grepCommand := iMgr.ioShim.Exec.Command(ioutil.Grep, azureNPMPrefix)
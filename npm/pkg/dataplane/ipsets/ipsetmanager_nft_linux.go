@@ -0,0 +1,479 @@
+package ipsets
+
+// This file contains code for programming NPM's sets natively in nftables.
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/npm/metrics"
+	"github.com/Azure/azure-container-networking/npm/util"
+	npmerrors "github.com/Azure/azure-container-networking/npm/util/errors"
+	"github.com/Azure/azure-container-networking/npm/util/ioutil"
+)
+
+const (
+	nftIntervalSetSpec  = "{ type ipv4_addr ; flags interval ; }"
+	nftNamedPortSetSpec = "{ type ipv4_addr . inet_proto . inet_service ; }"
+	nftDispatchMapSpec  = "{ type ipv4_addr : verdict ; }"
+
+	// ipset uses tcp for a hash:ip,port member without a protocol
+	nftDefaultNamedPortProtocol = "tcp"
+
+	maxUint32 = 1<<32 - 1
+)
+
+var (
+	nftTable = util.NftFamily + " " + util.NftAzureTable
+
+	errInvalidNftMember = errors.New("invalid member for nftables set")
+)
+
+/*
+In native nftables mode, every NPM set is an nftables set in NPM's table, named by its hashed name:
+- NamedPorts sets have the type "ipv4_addr . inet_proto . inet_service"
+- all other sets have the type "ipv4_addr" with the interval flag
+
+nftables sets can't have other sets as members, so a list is programmed as the union of its members' IPs.
+"nomatch" CIDRs are subtracted from the interval set, which keeps ipset's longest-prefix match semantics.
+
+The set manager also owns the dispatch verdict maps, which map the IPs in each Namespace set to the chains for that namespace.
+The PolicyManager fills the namespace chains with jumps to policy chains.
+
+nft applies a file as one transaction, so a failure never leaves the kernel half-updated.
+Instead of tracking member diffs, a dirty set (and any list in the kernel with a dirty member) is flushed and refilled,
+so the kernel converges to the cache on every apply.
+
+example where ns-x has 10.0.0.1 and cidr-y has 10.0.0.0/16 except 10.0.1.0/24, and set z is deleted:
+
+	add table ip azure-npm
+	add map ip azure-npm AZURE-NPM-INGRESS-DISPATCH { type ipv4_addr : verdict ; }
+	add map ip azure-npm AZURE-NPM-EGRESS-DISPATCH { type ipv4_addr : verdict ; }
+	add set ip azure-npm azure-npm-111 { type ipv4_addr ; flags interval ; }
+	flush set ip azure-npm azure-npm-111
+	add element ip azure-npm azure-npm-111 { 10.0.0.0/24, 10.0.2.0-10.0.255.255 }
+	add set ip azure-npm azure-npm-222 { type ipv4_addr ; flags interval ; }
+	flush set ip azure-npm azure-npm-222
+	add element ip azure-npm azure-npm-222 { 10.0.0.1 }
+	flush map ip azure-npm AZURE-NPM-INGRESS-DISPATCH
+	flush map ip azure-npm AZURE-NPM-EGRESS-DISPATCH
+	add chain ip azure-npm AZURE-NPM-INGRESS-NS-333
+	add chain ip azure-npm AZURE-NPM-EGRESS-NS-333
+	add element ip azure-npm AZURE-NPM-INGRESS-DISPATCH { 10.0.0.1 : jump AZURE-NPM-INGRESS-NS-333 }
+	add element ip azure-npm AZURE-NPM-EGRESS-DISPATCH { 10.0.0.1 : jump AZURE-NPM-EGRESS-NS-333 }
+	add set ip azure-npm azure-npm-444 { type ipv4_addr ; flags interval ; }
+	delete set ip azure-npm azure-npm-444
+*/
+func (iMgr *IPSetManager) applyNftSets() error {
+	creator := iMgr.fileCreatorForNftApply(maxTryCount, true)
+	err := creator.RunCommandWithFile(util.Nft, util.NftFileFlag, util.NftStdinFile)
+	if err == nil || iMgr.dirtyCache.numSetsToDelete() == 0 {
+		return err //nolint:wrapcheck // caller wraps the error
+	}
+
+	// A set can't be deleted while a rule still references it, which fails the whole transaction.
+	// Salvage the other changes and leave the sets to delete in the kernel.
+	metrics.SendErrorLogAndMetric(util.IpsmID, "failed to apply nftables sets. retrying without deleting %d sets. err: %v",
+		iMgr.dirtyCache.numSetsToDelete(), err)
+	creator = iMgr.fileCreatorForNftApply(maxTryCount, false)
+	return creator.RunCommandWithFile(util.Nft, util.NftFileFlag, util.NftStdinFile) //nolint:wrapcheck // caller wraps the error
+}
+
+// resetNftSets empties the dispatch maps. The PolicyManager recreates NPM's nftables table (and hence all sets) during bootup.
+// Kernel ipsets left behind by iptables-based NPM are destroyed on a best-effort basis.
+func (iMgr *IPSetManager) resetNftSets() error {
+	if err := iMgr.resetKernelIPSets(); err != nil {
+		metrics.SendErrorLogAndMetric(util.IpsmID, "failed to reset kernel ipsets while using nftables. err: %v", err)
+	}
+
+	creator := iMgr.newNftCreator(maxTryCount)
+	creator.AddLine("", nil, "flush map", nftTable, util.NftIngressDispatchMap)
+	creator.AddLine("", nil, "flush map", nftTable, util.NftEgressDispatchMap)
+	if err := creator.RunCommandWithFile(util.Nft, util.NftFileFlag, util.NftStdinFile); err != nil {
+		return npmerrors.SimpleErrorWrapper("failed to reset nftables dispatch maps", err)
+	}
+	return nil
+}
+
+func (iMgr *IPSetManager) newNftCreator(maxTryCount int) *ioutil.FileCreator {
+	// no line failure patterns since nft never partially applies a file
+	creator := ioutil.NewFileCreator(iMgr.ioShim, maxTryCount)
+	creator.AddLine("", nil, "add table", nftTable)
+	creator.AddLine("", nil, "add map", nftTable, util.NftIngressDispatchMap, nftDispatchMapSpec)
+	creator.AddLine("", nil, "add map", nftTable, util.NftEgressDispatchMap, nftDispatchMapSpec)
+	return creator
+}
+
+func (iMgr *IPSetManager) fileCreatorForNftApply(maxTryCount int, includeDeletes bool) *ioutil.FileCreator {
+	creator := iMgr.newNftCreator(maxTryCount)
+	setsToAddOrUpdate := iMgr.dirtyCache.setsToAddOrUpdate()
+	setsToDelete := iMgr.dirtyCache.setsToDelete()
+
+	// 1. refill dirty sets and lists in the kernel with a dirty member
+	for _, prefixedName := range sortedSetNames(iMgr.setsToRefill()) {
+		set, ok := iMgr.setMap[prefixedName]
+		if !ok {
+			metrics.SendErrorLogAndMetric(util.IpsmID, "skipping nftables refill for set %s since it isn't in the cache", prefixedName)
+			continue
+		}
+		creator.AddLine("", nil, "add set", nftTable, set.HashedName, nftSetSpec(set.Type))
+		creator.AddLine("", nil, "flush set", nftTable, set.HashedName)
+		if elements := iMgr.nftElements(set); len(elements) > 0 {
+			creator.AddLine("", nil, "add element", nftTable, set.HashedName, "{", strings.Join(elements, ", "), "}")
+		}
+	}
+
+	// 2. rebuild the dispatch maps if a Namespace set changed
+	if hasNamespaceSet(setsToAddOrUpdate) || hasNamespaceSet(setsToDelete) {
+		iMgr.rebuildNftDispatchMaps(creator)
+	}
+
+	if !includeDeletes {
+		return creator
+	}
+
+	// 3. delete sets after the lists referring to them have been refilled.
+	// Declaring each set and chain first makes the deletes idempotent.
+	for _, prefixedName := range sortedSetNames(setsToDelete) {
+		hashedName := util.GetHashedName(prefixedName)
+		creator.AddLine("", nil, "add set", nftTable, hashedName, nftSetSpecForName(prefixedName))
+		creator.AddLine("", nil, "delete set", nftTable, hashedName)
+
+		namespace, isNamespaceSet := namespaceOfSet(prefixedName)
+		if !isNamespaceSet {
+			continue
+		}
+		// the dispatch maps no longer jump to these chains, and there are no policies left in the namespace
+		for _, chainPrefix := range []string{util.NftIngressNamespaceChainPrefix, util.NftEgressNamespaceChainPrefix} {
+			chain := util.NftNamespaceChainName(chainPrefix, namespace)
+			creator.AddLine("", nil, "add chain", nftTable, chain)
+			creator.AddLine("", nil, "flush chain", nftTable, chain)
+			creator.AddLine("", nil, "delete chain", nftTable, chain)
+		}
+	}
+	return creator
+}
+
+// rebuildNftDispatchMaps maps every IP of the Namespace sets in the kernel to the chains of its namespace.
+func (iMgr *IPSetManager) rebuildNftDispatchMaps(creator *ioutil.FileCreator) {
+	creator.AddLine("", nil, "flush map", nftTable, util.NftIngressDispatchMap)
+	creator.AddLine("", nil, "flush map", nftTable, util.NftEgressDispatchMap)
+
+	namespaceSets := make(map[string]struct{})
+	for _, set := range iMgr.setMap {
+		if set.Type == Namespace && iMgr.shouldBeInKernel(set) && !iMgr.dirtyCache.isSetToDelete(set.Name) {
+			namespaceSets[set.Name] = struct{}{}
+		}
+	}
+
+	seenIPs := make(map[string]struct{})
+	ingressElements := make([]string, 0)
+	egressElements := make([]string, 0)
+	for _, prefixedName := range sortedSetNames(namespaceSets) {
+		set := iMgr.setMap[prefixedName]
+		ingressChain := util.NftNamespaceChainName(util.NftIngressNamespaceChainPrefix, set.unprefixedName)
+		egressChain := util.NftNamespaceChainName(util.NftEgressNamespaceChainPrefix, set.unprefixedName)
+		creator.AddLine("", nil, "add chain", nftTable, ingressChain)
+		creator.AddLine("", nil, "add chain", nftTable, egressChain)
+
+		ips := make([]string, 0, len(set.IPPodKey))
+		for ip := range set.IPPodKey {
+			ips = append(ips, ip)
+		}
+		sort.Strings(ips)
+		for _, ip := range ips {
+			if _, ok := seenIPs[ip]; ok {
+				// a reused Pod IP can briefly be in two namespaces
+				continue
+			}
+			if addr, err := netip.ParseAddr(ip); err != nil || !addr.Is4() {
+				metrics.SendErrorLogAndMetric(util.IpsmID, "skipping dispatch for member %s of set %s since it isn't an IPv4 address", ip, set.Name)
+				continue
+			}
+			seenIPs[ip] = struct{}{}
+			ingressElements = append(ingressElements, fmt.Sprintf("%s : jump %s", ip, ingressChain))
+			egressElements = append(egressElements, fmt.Sprintf("%s : jump %s", ip, egressChain))
+		}
+	}
+
+	if len(ingressElements) > 0 {
+		creator.AddLine("", nil, "add element", nftTable, util.NftIngressDispatchMap, "{", strings.Join(ingressElements, ", "), "}")
+		creator.AddLine("", nil, "add element", nftTable, util.NftEgressDispatchMap, "{", strings.Join(egressElements, ", "), "}")
+	}
+}
+
+// nftElements returns the sorted nftables elements for the set based on the cache.
+func (iMgr *IPSetManager) nftElements(set *IPSet) []string {
+	if set.Kind == ListSet {
+		members := make([]string, 0)
+		for _, memberSet := range set.MemberIPSets {
+			if memberSet.Type == NamedPorts {
+				metrics.SendErrorLogAndMetric(util.IpsmID, "skipping NamedPorts member %s of list %s for nftables", memberSet.Name, set.Name)
+				continue
+			}
+			for member := range memberSet.IPPodKey {
+				members = append(members, member)
+			}
+		}
+		return nftIntervalElements(set.Name, members)
+	}
+
+	members := make([]string, 0, len(set.IPPodKey))
+	for member := range set.IPPodKey {
+		members = append(members, member)
+	}
+	if set.Type != NamedPorts {
+		return nftIntervalElements(set.Name, members)
+	}
+
+	elements := make([]string, 0, len(members))
+	for _, member := range members {
+		element, err := nftNamedPortElement(member)
+		if err != nil {
+			metrics.SendErrorLogAndMetric(util.IpsmID, "skipping member %s of set %s for nftables. err: %v", member, set.Name, err)
+			continue
+		}
+		elements = append(elements, element)
+	}
+	sort.Strings(elements)
+	return elements
+}
+
+func nftSetSpec(setType SetType) string {
+	if setType == NamedPorts {
+		return nftNamedPortSetSpec
+	}
+	return nftIntervalSetSpec
+}
+
+func nftSetSpecForName(prefixedName string) string {
+	if strings.HasPrefix(prefixedName, util.NamedPortIPSetPrefix) {
+		return nftNamedPortSetSpec
+	}
+	return nftIntervalSetSpec
+}
+
+// namespaceOfSet returns the namespace if the prefixed name belongs to a Namespace set.
+func namespaceOfSet(prefixedName string) (string, bool) {
+	if !strings.HasPrefix(prefixedName, util.NamespacePrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(prefixedName, util.NamespacePrefix), true
+}
+
+func hasNamespaceSet(prefixedNames map[string]struct{}) bool {
+	for prefixedName := range prefixedNames {
+		if _, ok := namespaceOfSet(prefixedName); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedSetNames(prefixedNames map[string]struct{}) []string {
+	names := make([]string, 0, len(prefixedNames))
+	for prefixedName := range prefixedNames {
+		names = append(names, prefixedName)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// nftNamedPortElement converts a hash:ip,port member like "10.0.0.1,TCP:8080" to "10.0.0.1 . tcp . 8080".
+func nftNamedPortElement(member string) (string, error) {
+	m, err := parseNamedPortMember(member)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s . %s . %d", m.addr.String(), m.protocol, m.port), nil
+}
+
+type namedPortMember struct {
+	addr netip.Addr
+	// protocol is lowercase
+	protocol string
+	port     uint16
+}
+
+// parseNamedPortMember parses a hash:ip,port member like "10.0.0.1,TCP:8080".
+func parseNamedPortMember(member string) (namedPortMember, error) {
+	ipAndPort := strings.Split(member, ",")
+	if len(ipAndPort) != 2 {
+		return namedPortMember{}, fmt.Errorf("expected an ip and a port in %s: %w", member, errInvalidNftMember)
+	}
+	addr, err := netip.ParseAddr(ipAndPort[0])
+	if err != nil || !addr.Is4() {
+		return namedPortMember{}, fmt.Errorf("expected an IPv4 address in %s: %w", member, errInvalidNftMember)
+	}
+
+	protocol := nftDefaultNamedPortProtocol
+	port := ipAndPort[1]
+	if protocolAndPort := strings.Split(port, util.IpsetLabelDelimter); len(protocolAndPort) == 2 {
+		protocol = strings.ToLower(protocolAndPort[0])
+		port = protocolAndPort[1]
+	}
+	portNumber, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return namedPortMember{}, fmt.Errorf("expected a port in %s: %w", member, errInvalidNftMember)
+	}
+	return namedPortMember{addr: addr, protocol: protocol, port: uint16(portNumber)}, nil
+}
+
+type nftMember struct {
+	prefix  netip.Prefix
+	nomatch bool
+}
+
+// ipv4Range is an inclusive range of IPv4 addresses.
+type ipv4Range struct {
+	start uint32
+	end   uint32
+}
+
+// nftIntervalElements converts hash:net members (IPs, CIDRs, and "nomatch" CIDRs) into sorted, non-overlapping nftables interval elements.
+// Members are applied from the least to the most specific prefix, so the most specific prefix containing an address decides
+// whether it matches, just like ipset.
+func nftIntervalElements(setName string, members []string) []string {
+	parsed := make([]nftMember, 0, len(members))
+	hasNomatch := false
+	for _, member := range members {
+		m, err := parseNftMember(member)
+		if err != nil {
+			metrics.SendErrorLogAndMetric(util.IpsmID, "skipping member %s of set %s for nftables. err: %v", member, setName, err)
+			continue
+		}
+		hasNomatch = hasNomatch || m.nomatch
+		parsed = append(parsed, m)
+	}
+
+	ranges := make([]ipv4Range, 0, len(parsed))
+	if !hasNomatch {
+		// common case (e.g. Pod IPs): a union of all members
+		for _, m := range parsed {
+			ranges = append(ranges, prefixToRange(m.prefix))
+		}
+		ranges = mergeRanges(ranges)
+	} else {
+		sort.SliceStable(parsed, func(i, j int) bool {
+			return parsed[i].prefix.Bits() < parsed[j].prefix.Bits()
+		})
+		for _, m := range parsed {
+			r := prefixToRange(m.prefix)
+			if m.nomatch {
+				ranges = subtractRange(ranges, r)
+			} else {
+				ranges = mergeRanges(append(ranges, r))
+			}
+		}
+	}
+
+	elements := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		elements = append(elements, r.nftString())
+	}
+	return elements
+}
+
+func parseNftMember(member string) (nftMember, error) {
+	fields := strings.Split(member, space)
+	if len(fields) > 2 || (len(fields) == 2 && fields[1] != util.IpsetNomatch) {
+		return nftMember{}, fmt.Errorf("unexpected fields in %s: %w", member, errInvalidNftMember)
+	}
+
+	var prefix netip.Prefix
+	if strings.Contains(fields[0], "/") {
+		p, err := netip.ParsePrefix(fields[0])
+		if err != nil {
+			return nftMember{}, fmt.Errorf("failed to parse CIDR in %s: %w", member, errInvalidNftMember)
+		}
+		prefix = p.Masked()
+	} else {
+		addr, err := netip.ParseAddr(fields[0])
+		if err != nil {
+			return nftMember{}, fmt.Errorf("failed to parse IP in %s: %w", member, errInvalidNftMember)
+		}
+		prefix = netip.PrefixFrom(addr, addr.BitLen())
+	}
+	if !prefix.Addr().Is4() {
+		return nftMember{}, fmt.Errorf("expected IPv4 in %s: %w", member, errInvalidNftMember)
+	}
+	return nftMember{prefix: prefix, nomatch: len(fields) == 2}, nil
+}
+
+func prefixToRange(prefix netip.Prefix) ipv4Range {
+	start := addrToUint32(prefix.Addr())
+	hostBits := 32 - prefix.Bits()
+	end := uint32(uint64(start) + (uint64(1)<<hostBits - 1))
+	return ipv4Range{start: start, end: end}
+}
+
+// mergeRanges sorts the ranges and merges overlapping and adjacent ranges.
+func mergeRanges(ranges []ipv4Range) []ipv4Range {
+	if len(ranges) == 0 {
+		return ranges
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].start < ranges[j].start
+	})
+	merged := []ipv4Range{ranges[0]}
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if last.end == maxUint32 || r.start <= last.end+1 {
+			if r.end > last.end {
+				last.end = r.end
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// subtractRange removes the addresses in toRemove from the sorted ranges.
+func subtractRange(ranges []ipv4Range, toRemove ipv4Range) []ipv4Range {
+	result := make([]ipv4Range, 0, len(ranges)+1)
+	for _, r := range ranges {
+		if r.end < toRemove.start || r.start > toRemove.end {
+			result = append(result, r)
+			continue
+		}
+		if r.start < toRemove.start {
+			result = append(result, ipv4Range{start: r.start, end: toRemove.start - 1})
+		}
+		if r.end > toRemove.end {
+			result = append(result, ipv4Range{start: toRemove.end + 1, end: r.end})
+		}
+	}
+	return result
+}
+
+// nftString returns an IP, a CIDR, or an IP range.
+func (r ipv4Range) nftString() string {
+	start := uint32ToAddr(r.start)
+	if r.start == r.end {
+		return start.String()
+	}
+	size := uint64(r.end) - uint64(r.start) + 1
+	if size&(size-1) == 0 && uint64(r.start)%size == 0 {
+		hostBits := 0
+		for size > 1 {
+			size >>= 1
+			hostBits++
+		}
+		return netip.PrefixFrom(start, 32-hostBits).String()
+	}
+	return start.String() + "-" + uint32ToAddr(r.end).String()
+}
+
+func addrToUint32(addr netip.Addr) uint32 {
+	b := addr.As4()
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
+
+func uint32ToAddr(n uint32) netip.Addr {
+	return netip.AddrFrom4([4]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)})
+}
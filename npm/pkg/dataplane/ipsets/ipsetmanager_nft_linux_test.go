@@ -0,0 +1,235 @@
+package ipsets
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/common"
+	dptestutils "github.com/Azure/azure-container-networking/npm/pkg/dataplane/testutils"
+	"github.com/Azure/azure-container-networking/npm/util"
+	testutils "github.com/Azure/azure-container-networking/test/utils"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	nftApplyAlwaysCfg = &IPSetManagerCfg{
+		IPSetMode:      ApplyAllIPSets,
+		NetworkName:    "azure",
+		NativeNftables: true,
+	}
+
+	nftStringSlice = []string{util.Nft, util.NftFileFlag, util.NftStdinFile}
+
+	nftHeaderLines = []string{
+		"add table ip azure-npm",
+		"add map ip azure-npm AZURE-NPM-INGRESS-DISPATCH { type ipv4_addr : verdict ; }",
+		"add map ip azure-npm AZURE-NPM-EGRESS-DISPATCH { type ipv4_addr : verdict ; }",
+	}
+)
+
+func TestNftApplyCreatorForAddsAndDeletes(t *testing.T) {
+	iMgr := NewIPSetManager(nftApplyAlwaysCfg, common.NewMockIOShim(nil))
+
+	iMgr.CreateIPSets([]*IPSetMetadata{TestNSSet.Metadata, TestKeyPodSet.Metadata, TestNamedportSet.Metadata, TestCIDRSet.Metadata})
+	require.NoError(t, iMgr.AddToSets([]*IPSetMetadata{TestNSSet.Metadata, TestKeyPodSet.Metadata}, "10.0.0.1", "a"))
+	require.NoError(t, iMgr.AddToSets([]*IPSetMetadata{TestNSSet.Metadata}, "10.0.0.2", "b"))
+	require.NoError(t, iMgr.AddToSets([]*IPSetMetadata{TestNamedportSet.Metadata}, "10.0.0.1,TCP:8080", "a"))
+	require.NoError(t, iMgr.AddToSets([]*IPSetMetadata{TestCIDRSet.Metadata}, "10.0.0.0/16", ""))
+	require.NoError(t, iMgr.AddToSets([]*IPSetMetadata{TestCIDRSet.Metadata}, "10.0.1.0/24 nomatch", ""))
+	require.NoError(t, iMgr.AddToLists([]*IPSetMetadata{TestKeyNSList.Metadata}, []*IPSetMetadata{TestNSSet.Metadata}))
+	iMgr.CreateIPSets([]*IPSetMetadata{TestKVPodSet.Metadata})
+	iMgr.clearDirtyCache()
+	iMgr.DeleteIPSet(TestKVPodSet.PrefixName, util.SoftDelete)
+
+	// adding a member to the Namespace set refills the list containing it
+	require.NoError(t, iMgr.AddToSets([]*IPSetMetadata{TestNSSet.Metadata}, "10.0.0.3", "c"))
+	require.NoError(t, iMgr.AddToSets([]*IPSetMetadata{TestCIDRSet.Metadata}, "10.0.2.0/24", ""))
+	require.NoError(t, iMgr.AddToSets([]*IPSetMetadata{TestNamedportSet.Metadata}, "10.0.0.2,8081", "b"))
+
+	ingressChain := util.NftNamespaceChainName(util.NftIngressNamespaceChainPrefix, TestNSSet.Metadata.Name)
+	egressChain := util.NftNamespaceChainName(util.NftEgressNamespaceChainPrefix, TestNSSet.Metadata.Name)
+	refillLines := map[string][]string{
+		TestCIDRSet.PrefixName: {
+			fmt.Sprintf("add set ip azure-npm %s { type ipv4_addr ; flags interval ; }", TestCIDRSet.HashedName),
+			fmt.Sprintf("flush set ip azure-npm %s", TestCIDRSet.HashedName),
+			fmt.Sprintf("add element ip azure-npm %s { 10.0.0.0/24, 10.0.2.0-10.0.255.255 }", TestCIDRSet.HashedName),
+		},
+		TestNamedportSet.PrefixName: {
+			fmt.Sprintf("add set ip azure-npm %s { type ipv4_addr . inet_proto . inet_service ; }", TestNamedportSet.HashedName),
+			fmt.Sprintf("flush set ip azure-npm %s", TestNamedportSet.HashedName),
+			fmt.Sprintf("add element ip azure-npm %s { 10.0.0.1 . tcp . 8080, 10.0.0.2 . tcp . 8081 }", TestNamedportSet.HashedName),
+		},
+		TestNSSet.PrefixName: {
+			fmt.Sprintf("add set ip azure-npm %s { type ipv4_addr ; flags interval ; }", TestNSSet.HashedName),
+			fmt.Sprintf("flush set ip azure-npm %s", TestNSSet.HashedName),
+			fmt.Sprintf("add element ip azure-npm %s { 10.0.0.1-10.0.0.3 }", TestNSSet.HashedName),
+		},
+		TestKeyNSList.PrefixName: {
+			fmt.Sprintf("add set ip azure-npm %s { type ipv4_addr ; flags interval ; }", TestKeyNSList.HashedName),
+			fmt.Sprintf("flush set ip azure-npm %s", TestKeyNSList.HashedName),
+			fmt.Sprintf("add element ip azure-npm %s { 10.0.0.1-10.0.0.3 }", TestKeyNSList.HashedName),
+		},
+	}
+	expectedLines := append([]string{}, nftHeaderLines...)
+	for _, prefixedName := range sortedSetNames(map[string]struct{}{
+		TestCIDRSet.PrefixName:      {},
+		TestNamedportSet.PrefixName: {},
+		TestNSSet.PrefixName:        {},
+		TestKeyNSList.PrefixName:    {},
+	}) {
+		expectedLines = append(expectedLines, refillLines[prefixedName]...)
+	}
+	expectedLines = append(expectedLines,
+		"flush map ip azure-npm AZURE-NPM-INGRESS-DISPATCH",
+		"flush map ip azure-npm AZURE-NPM-EGRESS-DISPATCH",
+		"add chain ip azure-npm "+ingressChain,
+		"add chain ip azure-npm "+egressChain,
+		fmt.Sprintf("add element ip azure-npm AZURE-NPM-INGRESS-DISPATCH { 10.0.0.1 : jump %s, 10.0.0.2 : jump %s, 10.0.0.3 : jump %s }",
+			ingressChain, ingressChain, ingressChain),
+		fmt.Sprintf("add element ip azure-npm AZURE-NPM-EGRESS-DISPATCH { 10.0.0.1 : jump %s, 10.0.0.2 : jump %s, 10.0.0.3 : jump %s }",
+			egressChain, egressChain, egressChain),
+		fmt.Sprintf("add set ip azure-npm %s { type ipv4_addr ; flags interval ; }", TestKVPodSet.HashedName),
+		fmt.Sprintf("delete set ip azure-npm %s", TestKVPodSet.HashedName),
+	)
+
+	creator := iMgr.fileCreatorForNftApply(1, true)
+	actualLines := nftFileLines(t, creator.ToString())
+	dptestutils.AssertEqualLines(t, expectedLines, actualLines)
+
+	// without deletes
+	creator = iMgr.fileCreatorForNftApply(1, false)
+	actualLines = nftFileLines(t, creator.ToString())
+	dptestutils.AssertEqualLines(t, expectedLines[:len(expectedLines)-2], actualLines)
+}
+
+func TestNftApplyCreatorForNamespaceDelete(t *testing.T) {
+	iMgr := NewIPSetManager(nftApplyAlwaysCfg, common.NewMockIOShim(nil))
+	iMgr.CreateIPSets([]*IPSetMetadata{TestNSSet.Metadata})
+	iMgr.clearDirtyCache()
+	iMgr.DeleteIPSet(TestNSSet.PrefixName, util.SoftDelete)
+
+	ingressChain := util.NftNamespaceChainName(util.NftIngressNamespaceChainPrefix, TestNSSet.Metadata.Name)
+	egressChain := util.NftNamespaceChainName(util.NftEgressNamespaceChainPrefix, TestNSSet.Metadata.Name)
+	expectedLines := append(append([]string{}, nftHeaderLines...),
+		"flush map ip azure-npm AZURE-NPM-INGRESS-DISPATCH",
+		"flush map ip azure-npm AZURE-NPM-EGRESS-DISPATCH",
+		fmt.Sprintf("add set ip azure-npm %s { type ipv4_addr ; flags interval ; }", TestNSSet.HashedName),
+		fmt.Sprintf("delete set ip azure-npm %s", TestNSSet.HashedName),
+		"add chain ip azure-npm "+ingressChain,
+		"flush chain ip azure-npm "+ingressChain,
+		"delete chain ip azure-npm "+ingressChain,
+		"add chain ip azure-npm "+egressChain,
+		"flush chain ip azure-npm "+egressChain,
+		"delete chain ip azure-npm "+egressChain,
+	)
+
+	creator := iMgr.fileCreatorForNftApply(1, true)
+	actualLines := nftFileLines(t, creator.ToString())
+	dptestutils.AssertEqualLines(t, expectedLines, actualLines)
+}
+
+func TestApplyNftSetsRetriesWithoutDeletes(t *testing.T) {
+	calls := make([]testutils.TestCmd, 0, maxTryCount+1)
+	for i := 0; i < maxTryCount; i++ {
+		calls = append(calls, testutils.TestCmd{Cmd: nftStringSlice, ExitCode: 1})
+	}
+	calls = append(calls, testutils.TestCmd{Cmd: nftStringSlice})
+	ioshim := common.NewMockIOShim(calls)
+	defer ioshim.VerifyCalls(t, calls)
+	iMgr := NewIPSetManager(nftApplyAlwaysCfg, ioshim)
+
+	// a set referenced by a rule can't be deleted, so the whole transaction fails
+	iMgr.CreateIPSets([]*IPSetMetadata{TestKeyPodSet.Metadata})
+	iMgr.clearDirtyCache()
+	iMgr.DeleteIPSet(TestKeyPodSet.PrefixName, util.SoftDelete)
+	require.NoError(t, iMgr.applyNftSets())
+}
+
+func TestResetNftSets(t *testing.T) {
+	calls := append(GetResetTestCalls(), testutils.TestCmd{Cmd: nftStringSlice})
+	ioshim := common.NewMockIOShim(calls)
+	defer ioshim.VerifyCalls(t, calls)
+	iMgr := NewIPSetManager(nftApplyAlwaysCfg, ioshim)
+	require.NoError(t, iMgr.resetIPSets())
+}
+
+func TestNftIntervalElements(t *testing.T) {
+	tests := []struct {
+		name     string
+		members  []string
+		expected []string
+	}{
+		{
+			name:     "no members",
+			members:  nil,
+			expected: []string{},
+		},
+		{
+			name:     "IPs and CIDRs are merged",
+			members:  []string{"10.0.0.5", "10.0.0.4/30", "10.0.0.8", "10.1.0.0/16", "10.1.2.0/24"},
+			expected: []string{"10.0.0.4-10.0.0.8", "10.1.0.0/16"},
+		},
+		{
+			name:     "nomatch is subtracted",
+			members:  []string{"10.0.0.0/8", "10.0.0.0/9 nomatch"},
+			expected: []string{"10.128.0.0/9"},
+		},
+		{
+			name:     "most specific prefix wins",
+			members:  []string{"10.0.0.0/24 nomatch", "0.0.0.0/0", "10.0.0.1"},
+			expected: []string{"0.0.0.0-9.255.255.255", "10.0.0.1", "10.0.1.0-255.255.255.255"},
+		},
+		{
+			name:     "nomatch without a match",
+			members:  []string{"10.0.0.0/24 nomatch"},
+			expected: []string{},
+		},
+		{
+			name:     "invalid members are skipped",
+			members:  []string{"10.0.0.1", "10.0.0.1/33", "abc", "fe80::1", "10.0.0.0/24 other"},
+			expected: []string{"10.0.0.1"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, nftIntervalElements("test-set", tt.members))
+		})
+	}
+}
+
+func TestNftNamedPortElement(t *testing.T) {
+	tests := []struct {
+		member   string
+		expected string
+		wantErr  bool
+	}{
+		{member: "10.0.0.1,TCP:8080", expected: "10.0.0.1 . tcp . 8080"},
+		{member: "10.0.0.1,UDP:53", expected: "10.0.0.1 . udp . 53"},
+		{member: "10.0.0.1,8080", expected: "10.0.0.1 . tcp . 8080"},
+		{member: "10.0.0.1", wantErr: true},
+		{member: "10.0.0.1,TCP:abc", wantErr: true},
+		{member: "fe80::1,TCP:80", wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.member, func(t *testing.T) {
+			element, err := nftNamedPortElement(tt.member)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, element)
+		})
+	}
+}
+
+// nftFileLines returns the lines of the nft file without the trailing blank line.
+// Unlike ipset restore files, line order matters for nft, so the lines aren't sorted.
+func nftFileLines(t *testing.T, fileString string) []string {
+	lines := strings.Split(fileString, "\n")
+	require.Equal(t, "", lines[len(lines)-1], "nft file must end with blank line")
+	return lines[:len(lines)-1]
+}
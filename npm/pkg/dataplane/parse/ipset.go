@@ -0,0 +1,81 @@
+package parse
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/npm/util"
+	"k8s.io/klog"
+)
+
+var (
+	// CreateBytes is the prefix of a create line in ipset save output
+	CreateBytes = []byte("create ")
+	// AddBytes is the prefix of an add line in ipset save output
+	AddBytes = []byte("add ")
+)
+
+// IPSet is an ipset in the kernel, as seen in ipset save output.
+type IPSet struct {
+	Name string
+	// Type is the ipset type e.g. hash:net or list:set
+	Type string
+	// Members holds each member as written in ipset save output e.g. "10.0.0.0/16 nomatch" or "10.0.0.1,tcp:80"
+	Members map[string]struct{}
+}
+
+type IPSetParser struct {
+	IOShim *common.IOShim
+}
+
+// IPSets creates a Go object for every ipset in the kernel by calling ipset save within node.
+func (i *IPSetParser) IPSets() (map[string]*IPSet, error) {
+	klog.Infof("Executing ipset command %s %s", util.Ipset, util.IpsetSaveFlag)
+
+	output, err := i.IOShim.Exec.Command(util.Ipset, util.IpsetSaveFlag).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run ipset command [%s %s] Stderr: [%s]: %w", util.Ipset, util.IpsetSaveFlag, string(bytes.TrimSpace(output)), err)
+	}
+	return IPSetSave(output), nil
+}
+
+// IPSetSave creates a Go object for every ipset in the given ipset save output.
+// Add lines for sets without a create line are still recorded, with an empty Type.
+func IPSetSave(ipsetBuffer []byte) map[string]*IPSet {
+	sets := make(map[string]*IPSet)
+	getSet := func(name string) *IPSet {
+		set, ok := sets[name]
+		if !ok {
+			set = &IPSet{Name: name, Members: make(map[string]struct{})}
+			sets[name] = set
+		}
+		return set
+	}
+
+	curReadIndex := 0
+	for curReadIndex < len(ipsetBuffer) {
+		line, nextReadIndex := Line(curReadIndex, ipsetBuffer)
+		curReadIndex = nextReadIndex
+		line = bytes.TrimSuffix(line, []byte("\n"))
+
+		switch {
+		case bytes.HasPrefix(line, CreateBytes):
+			fields := bytes.Fields(line[len(CreateBytes):])
+			if len(fields) == 0 {
+				continue
+			}
+			set := getSet(string(fields[0]))
+			if len(fields) > 1 {
+				set.Type = string(fields[1])
+			}
+		case bytes.HasPrefix(line, AddBytes):
+			fields := bytes.SplitN(line[len(AddBytes):], SpaceBytes, 2)
+			if len(fields) != 2 {
+				continue
+			}
+			getSet(string(fields[0])).Members[string(bytes.TrimSpace(fields[1]))] = struct{}{}
+		}
+	}
+	return sets
+}
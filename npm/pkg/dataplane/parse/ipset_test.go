@@ -0,0 +1,80 @@
+package parse
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-container-networking/common"
+	testutils "github.com/Azure/azure-container-networking/test/utils"
+	"github.com/stretchr/testify/require"
+)
+
+const ipsetSaveOutput = `create azure-npm-123 hash:net family inet hashsize 1024 maxelem 4294967295
+add azure-npm-123 10.0.0.0/16
+add azure-npm-123 10.0.0.0/24 nomatch
+create azure-npm-456 hash:ip,port family inet hashsize 1024 maxelem 65536
+add azure-npm-456 10.0.0.1,tcp:80
+create azure-npm-789 list:set size 8
+add azure-npm-789 azure-npm-123
+create azure-npm-000 hash:net family inet hashsize 1024 maxelem 65536
+`
+
+func TestIPSetSave(t *testing.T) {
+	expected := map[string]*IPSet{
+		"azure-npm-123": {
+			Name: "azure-npm-123",
+			Type: "hash:net",
+			Members: map[string]struct{}{
+				"10.0.0.0/16":         {},
+				"10.0.0.0/24 nomatch": {},
+			},
+		},
+		"azure-npm-456": {
+			Name:    "azure-npm-456",
+			Type:    "hash:ip,port",
+			Members: map[string]struct{}{"10.0.0.1,tcp:80": {}},
+		},
+		"azure-npm-789": {
+			Name:    "azure-npm-789",
+			Type:    "list:set",
+			Members: map[string]struct{}{"azure-npm-123": {}},
+		},
+		"azure-npm-000": {
+			Name:    "azure-npm-000",
+			Type:    "hash:net",
+			Members: map[string]struct{}{},
+		},
+	}
+	require.Equal(t, expected, IPSetSave([]byte(ipsetSaveOutput)))
+}
+
+func TestIPSetSaveMalformedLines(t *testing.T) {
+	sets := IPSetSave([]byte("create\nadd azure-npm-123\nadd azure-npm-123 1.2.3.4\nsome other line\n"))
+	require.Equal(t, map[string]*IPSet{
+		"azure-npm-123": {Name: "azure-npm-123", Members: map[string]struct{}{"1.2.3.4": {}}},
+	}, sets)
+}
+
+func TestParseIPSets(t *testing.T) {
+	calls := []testutils.TestCmd{
+		{Cmd: []string{"ipset", "save"}, Stdout: ipsetSaveOutput},
+	}
+	ioshim := common.NewMockIOShim(calls)
+	defer ioshim.VerifyCalls(t, calls)
+	parser := IPSetParser{IOShim: ioshim}
+
+	sets, err := parser.IPSets()
+	require.NoError(t, err)
+	require.Len(t, sets, 4)
+}
+
+func TestParseIPSetsFailure(t *testing.T) {
+	calls := []testutils.TestCmd{
+		{Cmd: []string{"ipset", "save"}, ExitCode: 1},
+	}
+	ioshim := common.NewMockIOShim(calls)
+	defer ioshim.VerifyCalls(t, calls)
+	parser := IPSetParser{IOShim: ioshim}
+
+	_, err := parser.IPSets()
+	require.Error(t, err)
+}
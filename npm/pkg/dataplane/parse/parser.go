@@ -87,16 +87,17 @@ func Iptables(tableName string) (*NPMIPtable.Table, error) {
 
 // IptablesFile creates a Go object from specified iptable by reading from an iptables-save file.
 func IptablesFile(tableName, iptableSaveFile string) (*NPMIPtable.Table, error) {
-	iptableBuffer := bytes.NewBuffer(nil)
 	byteArray, err := os.ReadFile(iptableSaveFile)
 	if err != nil {
 		return nil, fmt.Errorf("%w", err)
 	}
-	for _, b := range byteArray {
-		iptableBuffer.WriteByte(b)
-	}
-	chains := parseIptablesChainObject(tableName, iptableBuffer.Bytes())
-	return &NPMIPtable.Table{Name: tableName, Chains: chains}, nil
+	return IptablesSave(tableName, byteArray), nil
+}
+
+// IptablesSave creates a Go object from specified iptable in the given iptables-save output.
+func IptablesSave(tableName string, iptableBuffer []byte) *NPMIPtable.Table {
+	chains := parseIptablesChainObject(tableName, iptableBuffer)
+	return &NPMIPtable.Table{Name: tableName, Chains: chains}
 }
 
 // parseIptablesChainObject creates a map of iptable chain name and iptable chain object.
@@ -198,7 +199,8 @@ func parseChainNameFromRuleLine(ruleLine []byte) (chainName string, ruleReadInde
 	chainNameStart := spaceIndex + 1
 	spaceIndex = bytes.Index(ruleLine[chainNameStart:], SpaceBytes)
 	if spaceIndex == -1 {
-		panic(fmt.Sprintf("Unexpected chain line in iptables-save output: %v", string(ruleLine)))
+		// rule without any match or target
+		return string(ruleLine[chainNameStart:]), len(ruleLine)
 	}
 	chainNameEnd := chainNameStart + spaceIndex
 
@@ -222,7 +224,9 @@ func parseRuleFromLine(ruleLine []byte) *NPMIPtable.Rule {
 		case util.IptablesProtFlag:
 			spaceIndex = bytes.Index(ruleLine[start+1:], SpaceBytes)
 			if spaceIndex == -1 {
-				panic(fmt.Sprintf("Unexpected chain line in iptables-save : %v", string(ruleLine)))
+				// protocol at end of line
+				iptableRule.Protocol = string(ruleLine[start+1:])
+				return iptableRule
 			}
 			end := start + 1 + spaceIndex
 			protocol := string(ruleLine[start+1 : end])
@@ -323,7 +327,9 @@ func parseTargetOptionAndValue(nextIndex int, target *NPMIPtable.Target, current
 func parseModule(nextIndex int, module *NPMIPtable.Module, ruleLine []byte) int {
 	spaceIndex := bytes.Index(ruleLine[nextIndex:], SpaceBytes)
 	if spaceIndex == -1 {
-		panic(fmt.Sprintf("Unexpected chain line in iptables-save : %v", string(ruleLine)))
+		// module without options at end of line
+		module.Verb = string(ruleLine[nextIndex:])
+		return len(ruleLine)
 	}
 	verb := string(ruleLine[nextIndex : nextIndex+spaceIndex])
 	module.Verb = verb
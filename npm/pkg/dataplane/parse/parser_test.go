@@ -99,6 +99,10 @@ func TestParseChainNameFromRuleLine(t *testing.T) {
 			input:    "-A AZURE-NPM-INGRESS-PORT ",
 			expected: "AZURE-NPM-INGRESS-PORT",
 		},
+		{
+			input:    "-A AZURE-NPM-INGRESS-PORT",
+			expected: "AZURE-NPM-INGRESS-PORT",
+		}, // rule without any match or target
 	}
 	for _, tc := range tests {
 		tc := tc
@@ -154,6 +158,16 @@ func TestParseRuleFromLine(t *testing.T) {
 				`-j MARK --set-xmark 0x2000/0xffffffff`,
 			expected: testR1,
 		},
+		{
+			input:    "-p tcp",
+			expected: &NPMIPtable.Rule{Protocol: "tcp"},
+		}, // protocol at end of line
+		{
+			input: "-m tcp",
+			expected: &NPMIPtable.Rule{
+				Modules: []*NPMIPtable.Module{{Verb: "tcp", OptionValueMap: map[string][]string{}}},
+			},
+		}, // module without options at end of line
 	}
 	for _, tc := range tests {
 		tc := tc
@@ -221,6 +235,10 @@ func TestParseModule(t *testing.T) {
 		Verb:           "set",
 		OptionValueMap: map[string][]string{"return-nomatch": {}},
 	} // option with no values
+	testM4 := &NPMIPtable.Module{
+		Verb:           "tcp",
+		OptionValueMap: map[string][]string{},
+	} // no options
 	tests := []test{
 		{
 			input:    "set --match-set azure-npm-806075013 dst",
@@ -234,6 +252,10 @@ func TestParseModule(t *testing.T) {
 			input:    "set --return-nomatch",
 			expected: testM3,
 		},
+		{
+			input:    "tcp",
+			expected: testM4,
+		},
 	}
 
 	for _, tc := range tests {
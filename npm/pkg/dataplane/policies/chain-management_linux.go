@@ -186,6 +186,13 @@ TODO: could use one grep call instead of separate calls for getting jump line nu
   - would use a grep pattern like so: <line num...AZURE-NPM>|<Chain AZURE-NPM>
 */
 func (pMgr *PolicyManager) bootup(_ []string) error {
+	if pMgr.PolicyMode == BPFPolicyMode {
+		return pMgr.bootupBPF()
+	}
+	if pMgr.NativeNftables {
+		return pMgr.bootupNft()
+	}
+
 	klog.Infof("booting up iptables Azure chains")
 
 	// 0.1. Detect iptables version
@@ -315,6 +322,12 @@ func (pMgr *PolicyManager) cleanupOtherIptables() error {
 		}
 	}()
 
+	return pMgr.cleanupCurrentIptables()
+}
+
+// cleanupCurrentIptables deletes all NPM chains (and the jumps to AZURE-NPM) in the iptables version currently set in util.
+// See cleanupOtherIptables() for details.
+func (pMgr *PolicyManager) cleanupCurrentIptables() error {
 	deletedJumpRule := false
 
 	// 1.1. delete the deprecated jump to AZURE-NPM
@@ -454,7 +467,13 @@ func (pMgr *PolicyManager) creatorForCleanup(chains []string) *ioutil.FileCreato
 // reconcile does the following:
 // - creates the jump rule from FORWARD chain to AZURE-NPM chain (if it does not exist) and makes sure it's after the jumps to KUBE-FORWARD & KUBE-SERVICES chains (if they exist).
 // - cleans up stale policy chains. It can be forced to stop this process if reconcileManager.forceLock() is called.
+// In native nftables mode, there is nothing to reconcile since policy chains are deleted in the foreground.
+// The same goes for BPF mode, where there are no chains.
 func (pMgr *PolicyManager) reconcile() {
+	if pMgr.NativeNftables || pMgr.PolicyMode == BPFPolicyMode {
+		return
+	}
+
 	if err := pMgr.positionAzureChainJumpRule(); err != nil {
 		msg := fmt.Sprintf("failed to reconcile jump rule to Azure-NPM due to %s", err.Error())
 		metrics.SendErrorLogAndMetric(util.IptmID, "error: %s", msg)
@@ -565,6 +584,14 @@ func (pMgr *PolicyManager) creatorForBootup(currentChains map[string]struct{}) *
 		pMgr.staleChains.add(chain) // won't add base chains
 	}
 
+	writeBaseChainRules(creator)
+	creator.AddLine("", nil, util.IptablesRestoreCommit)
+	return creator
+}
+
+// writeBaseChainRules adds the rules for the base chains except AZURE-NPM, which has no rules until NPM is activated.
+// The chains must be empty or flushed earlier in the file.
+func writeBaseChainRules(creator *ioutil.FileCreator) {
 	// add AZURE-NPM-INGRESS chain rules
 	ingressDropSpecs := []string{util.IptablesAppendFlag, util.IptablesAzureIngressChain, util.IptablesJumpFlag, util.IptablesDrop}
 	ingressDropSpecs = append(ingressDropSpecs, onMarkSpecs(util.IptablesAzureIngressDropMarkHex)...)
@@ -591,8 +618,6 @@ func (pMgr *PolicyManager) creatorForBootup(currentChains map[string]struct{}) *
 
 	// add AZURE-NPM-ACCEPT chain rules
 	creator.AddLine("", nil, util.IptablesAppendFlag, util.IptablesAzureAcceptChain, util.IptablesJumpFlag, util.IptablesAccept)
-	creator.AddLine("", nil, util.IptablesRestoreCommit)
-	return creator
 }
 
 // add/reposition the jump from FORWARD chain to AZURE-NPM chain to be in the correct position based on config:
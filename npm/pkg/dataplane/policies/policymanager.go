@@ -6,13 +6,15 @@ import (
 
 	"github.com/Azure/azure-container-networking/common"
 	"github.com/Azure/azure-container-networking/npm/metrics"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/bpfpolicy"
 	"github.com/Azure/azure-container-networking/npm/util"
 	npmerrors "github.com/Azure/azure-container-networking/npm/util/errors"
 	"k8s.io/klog"
 )
 
 // PolicyManagerMode will be used in windows to decide if
-// SetPolicies should be used or not
+// SetPolicies should be used or not.
+// In Linux, it decides whether policies are enforced by iptables/nftables or eBPF.
 type PolicyManagerMode string
 
 const (
@@ -21,6 +23,9 @@ const (
 	// IPPolicyMode will replace ipset names with their value IPs in policies
 	// NOTE: this is currently unimplemented
 	IPPolicyMode PolicyManagerMode = "IP"
+	// BPFPolicyMode compiles policies into per-endpoint eBPF maps read by tc programs on each Pod's veth.
+	// Only supported in Linux.
+	BPFPolicyMode PolicyManagerMode = "BPF"
 
 	// this number is based on the implementation in chain-management_linux.go
 	// it represents the number of rules unrelated to policies
@@ -31,10 +36,15 @@ const (
 type PolicyManagerCfg struct {
 	// NodeIP is only used in Windows
 	NodeIP string
-	// PolicyMode only affects Windows
+	// PolicyMode can be IPSet or IP in Windows and IPSet or BPF in Linux
 	PolicyMode PolicyManagerMode
 	// PlaceAzureChainFirst only affects Linux
 	PlaceAzureChainFirst bool
+	// NativeNftables programs policies in NPM's nftables table instead of through iptables.
+	// Only affects Linux.
+	NativeNftables bool
+	// BPFMaps are programmed in BPFPolicyMode. The DataPlane sets this if nil.
+	BPFMaps bpfpolicy.Maps
 	// MaxBatchedACLsPerPod is the maximum number of ACLs that can be added to a Pod at once in Windows.
 	// The zero value is valid.
 	// A NetworkPolicy's ACLs are always in the same batch, and there will be at least one NetworkPolicy per batch.
@@ -224,7 +234,7 @@ func (pMgr *PolicyManager) RemovePolicy(policyKey string) error {
 }
 
 // RemovePolicyForEndpoints is identical to RemovePolicy except it will not remove the policy from the cache.
-// This function is intended for Windows only.
+// This function is intended for Windows and Linux's BPF mode only.
 func (pMgr *PolicyManager) RemovePolicyForEndpoints(policyKey string, endpointList map[string]string) error {
 	policy, ok := pMgr.GetPolicy(policyKey)
 
@@ -236,8 +246,9 @@ func (pMgr *PolicyManager) RemovePolicyForEndpoints(policyKey string, endpointLi
 		klog.Infof("[DataPlane] No ACLs in policy %s to remove for endpoints", policyKey)
 		return nil
 	}
+
 	// Call actual dataplane function to apply changes
-	err := pMgr.removePolicy(policy, endpointList)
+	err := pMgr.removePolicyForEndpoints(policy, endpointList)
 	// currently we only have acl rule exec time for "adding" rules, so we skip recording here
 	if err != nil {
 		// NOTE: Prometheus metrics may be off at this point since we don't know how many endpoints had rules applied successfully.
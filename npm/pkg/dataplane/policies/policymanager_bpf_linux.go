@@ -0,0 +1,210 @@
+package policies
+
+// This file contains code for the eBPF implementation of booting up and adding/removing policies.
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+
+	"github.com/Azure/azure-container-networking/npm/metrics"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/bpfpolicy"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/ipsets"
+	npmerrors "github.com/Azure/azure-container-networking/npm/util/errors"
+	"k8s.io/klog"
+)
+
+/*
+In BPF mode, policies are applied to endpoints like in Windows. Endpoints are the IPs of Pods on this node,
+and the DataPlane decides which endpoints a policy applies to.
+
+Every change to an endpoint compiles the ACLs of all policies applied to it and replaces the endpoint's rules in the maps.
+Rules refer to sets by ID, and the IPSetManager writes the members of sets to the maps.
+An endpoint without policies is removed from the maps, and the tc programs are detached from its veth.
+*/
+
+var bpfProtocols = map[Protocol]uint8{
+	TCP:                 bpfpolicy.TCPProtocol,
+	UDP:                 bpfpolicy.UDPProtocol,
+	SCTP:                bpfpolicy.SCTPProtocol,
+	UnspecifiedProtocol: bpfpolicy.AnyProtocol,
+}
+
+// bootupBPF cleans up iptables-based NPM and empties the maps.
+func (pMgr *PolicyManager) bootupBPF() error {
+	klog.Infof("booting up eBPF policy mode")
+	if pMgr.BPFMaps == nil {
+		return npmerrors.SimpleError("eBPF maps must be configured in BPF policy mode")
+	}
+
+	pMgr.cleanupAllIptables()
+
+	if err := pMgr.BPFMaps.Reset(); err != nil {
+		return npmerrors.SimpleErrorWrapper("failed to reset eBPF maps", err)
+	}
+	return nil
+}
+
+// AddAllPolicies adds the policies to the endpoint at once and returns the policies which were added.
+// The policies must be in the cache.
+func (pMgr *PolicyManager) AddAllPolicies(policyKeys map[string]struct{}, epToModifyID, epToModifyIP string) (map[string]struct{}, error) {
+	pMgr.policyMap.Lock()
+	defer pMgr.policyMap.Unlock()
+
+	klog.Infof("[PolicyManagerBPF] adding all policies. epID: %s. epIP: %s. policyKeys: %+v", epToModifyID, epToModifyIP, policyKeys)
+
+	networkPolicies := make([]*NPMNetworkPolicy, 0, len(policyKeys))
+	for policyKey := range policyKeys {
+		policy, ok := pMgr.policyMap.cache[policyKey]
+		if !ok {
+			klog.Infof("[PolicyManagerBPF] skipping policy which isn't in the cache. policyKey: %s", policyKey)
+			continue
+		}
+		networkPolicies = append(networkPolicies, policy)
+	}
+
+	if err := pMgr.replaceBPFEndpoint(epToModifyIP, networkPolicies, ""); err != nil {
+		return nil, fmt.Errorf("failed to add all policies to endpoint %s. err: %w", epToModifyIP, err)
+	}
+
+	successfulPolicies := make(map[string]struct{}, len(networkPolicies))
+	for _, policy := range networkPolicies {
+		addPodEndpoint(policy, epToModifyIP, epToModifyID)
+		successfulPolicies[policy.PolicyKey] = struct{}{}
+	}
+	return successfulPolicies, nil
+}
+
+func (pMgr *PolicyManager) addPoliciesBPF(networkPolicies []*NPMNetworkPolicy, endpointList map[string]string) error {
+	timer := metrics.StartNewTimer()
+	defer metrics.RecordIPTablesRestoreLatency(timer, metrics.CreateOp)
+
+	for _, ip := range sortedEndpointIPs(endpointList) {
+		if err := pMgr.replaceBPFEndpoint(ip, networkPolicies, ""); err != nil {
+			metrics.IncIPTablesRestoreFailures(metrics.CreateOp)
+			return fmt.Errorf("failed to add policies to endpoint %s. err: %w", ip, err)
+		}
+		for _, policy := range networkPolicies {
+			addPodEndpoint(policy, ip, endpointList[ip])
+		}
+	}
+	return nil
+}
+
+// removePolicyBPF removes the policy from the endpoints, or from all of its endpoints if endpointList is nil.
+func (pMgr *PolicyManager) removePolicyBPF(networkPolicy *NPMNetworkPolicy, endpointList map[string]string) error {
+	timer := metrics.StartNewTimer()
+	defer metrics.RecordIPTablesRestoreLatency(timer, metrics.DeleteOp)
+
+	if endpointList == nil {
+		endpointList = networkPolicy.PodEndpoints
+	}
+	for _, ip := range sortedEndpointIPs(endpointList) {
+		if err := pMgr.replaceBPFEndpoint(ip, nil, networkPolicy.PolicyKey); err != nil {
+			metrics.IncIPTablesRestoreFailures(metrics.DeleteOp)
+			return fmt.Errorf("failed to remove policy %s from endpoint %s. err: %w", networkPolicy.PolicyKey, ip, err)
+		}
+		delete(networkPolicy.PodEndpoints, ip)
+	}
+	return nil
+}
+
+// replaceBPFEndpoint recompiles the endpoint's rules from the policies in the cache applied to it,
+// plus policiesToAdd and minus the policy with policyKeyToRemove.
+// The caller must lock the PolicyMap.
+func (pMgr *PolicyManager) replaceBPFEndpoint(ip string, policiesToAdd []*NPMNetworkPolicy, policyKeyToRemove string) error {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return fmt.Errorf("failed to parse endpoint IP %s: %w", ip, err)
+	}
+
+	policies := make(map[string]*NPMNetworkPolicy)
+	for policyKey, policy := range pMgr.policyMap.cache {
+		if _, ok := policy.PodEndpoints[ip]; ok {
+			policies[policyKey] = policy
+		}
+	}
+	for _, policy := range policiesToAdd {
+		policies[policy.PolicyKey] = policy
+	}
+	delete(policies, policyKeyToRemove)
+
+	if len(policies) == 0 {
+		if err := pMgr.BPFMaps.DeleteEndpoint(addr); err != nil {
+			return npmerrors.SimpleErrorWrapper("failed to delete eBPF endpoint", err)
+		}
+		return nil
+	}
+
+	if err := pMgr.BPFMaps.ReplaceEndpoint(compileBPFEndpoint(addr, policies)); err != nil {
+		return npmerrors.SimpleErrorWrapper("failed to replace eBPF endpoint", err)
+	}
+	return nil
+}
+
+// compileBPFEndpoint converts the ACLs of the policies into the endpoint's rules.
+// Policies are sorted by key so that the rules are deterministic, although rule order doesn't affect the verdict.
+func compileBPFEndpoint(addr netip.Addr, policies map[string]*NPMNetworkPolicy) *bpfpolicy.Endpoint {
+	policyKeys := make([]string, 0, len(policies))
+	for policyKey := range policies {
+		policyKeys = append(policyKeys, policyKey)
+	}
+	sort.Strings(policyKeys)
+
+	ep := &bpfpolicy.Endpoint{IP: addr}
+	for _, policyKey := range policyKeys {
+		for _, aclPolicy := range policies[policyKey].ACLs {
+			rule := aclPolicy.bpfRule()
+			if aclPolicy.hasIngress() {
+				ep.Ingress = append(ep.Ingress, rule)
+			}
+			if aclPolicy.hasEgress() {
+				ep.Egress = append(ep.Egress, rule)
+			}
+		}
+	}
+	return ep
+}
+
+func (aclPolicy *ACLPolicy) bpfRule() bpfpolicy.Rule {
+	rule := bpfpolicy.Rule{
+		Allow:    aclPolicy.Target == Allowed,
+		Protocol: bpfProtocols[aclPolicy.Protocol],
+		// ValidatePolicy() ensures that ports fit in a uint16
+		PortStart: uint16(aclPolicy.DstPorts.Port),    //nolint:gosec // see above
+		PortEnd:   uint16(aclPolicy.DstPorts.EndPort), //nolint:gosec // see above
+		Matches:   make([]bpfpolicy.SetMatch, 0, len(aclPolicy.SrcList)+len(aclPolicy.DstList)),
+	}
+	for _, setInfo := range aclPolicy.SrcList {
+		rule.Matches = append(rule.Matches, setInfo.bpfMatch())
+	}
+	for _, setInfo := range aclPolicy.DstList {
+		rule.Matches = append(rule.Matches, setInfo.bpfMatch())
+	}
+	return rule
+}
+
+func (info SetInfo) bpfMatch() bpfpolicy.SetMatch {
+	return bpfpolicy.SetMatch{
+		SetID:    bpfpolicy.SetID(info.IPSet.GetPrefixName()),
+		Kind:     ipsets.BPFSetKind(info.IPSet.Type),
+		Included: info.Included,
+		Dst:      info.MatchType != SrcMatch,
+	}
+}
+
+func addPodEndpoint(policy *NPMNetworkPolicy, ip, epID string) {
+	if policy.PodEndpoints == nil {
+		policy.PodEndpoints = make(map[string]string)
+	}
+	policy.PodEndpoints[ip] = epID
+}
+
+func sortedEndpointIPs(endpointList map[string]string) []string {
+	ips := make([]string, 0, len(endpointList))
+	for ip := range endpointList {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	return ips
+}
@@ -0,0 +1,151 @@
+package policies
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/bpfpolicy"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/ipsets"
+	"github.com/stretchr/testify/require"
+)
+
+func bpfConfig(bpfMaps bpfpolicy.Maps) *PolicyManagerCfg {
+	return &PolicyManagerCfg{
+		PolicyMode: BPFPolicyMode,
+		BPFMaps:    bpfMaps,
+	}
+}
+
+func bpfTestPolicies() (ingressPolicy, egressPolicy *NPMNetworkPolicy) {
+	ingressPolicy = &NPMNetworkPolicy{
+		Namespace: "x",
+		PolicyKey: "x/ingress",
+		ACLs:      []*ACLPolicy{testACLs[0], testACLs[1]},
+	}
+	egressPolicy = &NPMNetworkPolicy{
+		Namespace: "x",
+		PolicyKey: "x/egress",
+		ACLs:      []*ACLPolicy{testACLs[2], testACLs[3]},
+	}
+	return ingressPolicy, egressPolicy
+}
+
+func TestCompileBPFEndpoint(t *testing.T) {
+	ingressPolicy, egressPolicy := bpfTestPolicies()
+	NormalizePolicy(ingressPolicy)
+	NormalizePolicy(egressPolicy)
+	addr := netip.MustParseAddr("10.0.0.1")
+
+	ep := compileBPFEndpoint(addr, map[string]*NPMNetworkPolicy{
+		ingressPolicy.PolicyKey: ingressPolicy,
+		egressPolicy.PolicyKey:  egressPolicy,
+	})
+
+	cidrSetID := bpfpolicy.SetID(ipsets.TestCIDRSet.PrefixName)
+	keyPodSetID := bpfpolicy.SetID(ipsets.TestKeyPodSet.PrefixName)
+	expected := &bpfpolicy.Endpoint{
+		IP: addr,
+		Ingress: []bpfpolicy.Rule{
+			{
+				Allow:     false,
+				Protocol:  bpfpolicy.TCPProtocol,
+				PortStart: 222,
+				PortEnd:   333,
+				Matches: []bpfpolicy.SetMatch{
+					{SetID: cidrSetID, Kind: bpfpolicy.CIDRSetKind, Included: true},
+					{SetID: keyPodSetID, Kind: bpfpolicy.HashSetKind, Included: false, Dst: true},
+				},
+			},
+			{
+				Allow:    true,
+				Protocol: bpfpolicy.UDPProtocol,
+				Matches:  []bpfpolicy.SetMatch{{SetID: cidrSetID, Kind: bpfpolicy.CIDRSetKind, Included: true}},
+			},
+		},
+		Egress: []bpfpolicy.Rule{
+			{
+				Allow:     false,
+				Protocol:  bpfpolicy.UDPProtocol,
+				PortStart: 144,
+				PortEnd:   144,
+				Matches:   []bpfpolicy.SetMatch{{SetID: cidrSetID, Kind: bpfpolicy.CIDRSetKind, Included: true}},
+			},
+			{
+				Allow:    true,
+				Protocol: bpfpolicy.AnyProtocol,
+				Matches:  []bpfpolicy.SetMatch{{SetID: cidrSetID, Kind: bpfpolicy.CIDRSetKind, Included: true}},
+			},
+		},
+	}
+	require.Equal(t, expected, ep)
+}
+
+func TestAddAndRemoveBPFPolicies(t *testing.T) {
+	fake := bpfpolicy.NewFakeMaps()
+	pMgr := NewPolicyManager(common.NewMockIOShim(nil), bpfConfig(fake))
+	ingressPolicy, egressPolicy := bpfTestPolicies()
+	ip1 := netip.MustParseAddr("10.0.0.1")
+	ip2 := netip.MustParseAddr("10.0.0.2")
+
+	require.NoError(t, pMgr.AddPolicies([]*NPMNetworkPolicy{ingressPolicy}, map[string]string{"10.0.0.1": "10.0.0.1", "10.0.0.2": "10.0.0.2"}))
+	require.NoError(t, pMgr.AddPolicies([]*NPMNetworkPolicy{egressPolicy}, map[string]string{"10.0.0.1": "10.0.0.1"}))
+	require.Equal(t, map[string]string{"10.0.0.1": "10.0.0.1", "10.0.0.2": "10.0.0.2"}, ingressPolicy.PodEndpoints)
+	require.Equal(t, map[string]string{"10.0.0.1": "10.0.0.1"}, egressPolicy.PodEndpoints)
+	require.Len(t, fake.Endpoints, 2)
+	require.Len(t, fake.Endpoints[ip1].Ingress, 2)
+	require.Len(t, fake.Endpoints[ip1].Egress, 2)
+	require.Len(t, fake.Endpoints[ip2].Ingress, 2)
+	require.Empty(t, fake.Endpoints[ip2].Egress)
+
+	// removing a policy for one endpoint keeps it in the cache
+	require.NoError(t, pMgr.RemovePolicyForEndpoints(ingressPolicy.PolicyKey, map[string]string{"10.0.0.2": "10.0.0.2"}))
+	require.NotContains(t, fake.Endpoints, ip2)
+	require.True(t, pMgr.PolicyExists(ingressPolicy.PolicyKey))
+
+	// removing a policy recompiles endpoints from the remaining policies
+	require.NoError(t, pMgr.RemovePolicy(ingressPolicy.PolicyKey))
+	require.Empty(t, fake.Endpoints[ip1].Ingress)
+	require.Len(t, fake.Endpoints[ip1].Egress, 2)
+	require.Empty(t, ingressPolicy.PodEndpoints)
+
+	require.NoError(t, pMgr.RemovePolicy(egressPolicy.PolicyKey))
+	require.Empty(t, fake.Endpoints)
+}
+
+func TestAddAllBPFPolicies(t *testing.T) {
+	fake := bpfpolicy.NewFakeMaps()
+	pMgr := NewPolicyManager(common.NewMockIOShim(nil), bpfConfig(fake))
+	ingressPolicy, egressPolicy := bpfTestPolicies()
+	require.NoError(t, pMgr.AddPolicies([]*NPMNetworkPolicy{ingressPolicy}, nil))
+	require.NoError(t, pMgr.AddPolicies([]*NPMNetworkPolicy{egressPolicy}, nil))
+	require.Empty(t, fake.Endpoints)
+
+	added, err := pMgr.AddAllPolicies(map[string]struct{}{
+		ingressPolicy.PolicyKey: {},
+		egressPolicy.PolicyKey:  {},
+		"x/missing":             {},
+	}, "10.0.0.1", "10.0.0.1")
+	require.NoError(t, err)
+	require.Equal(t, map[string]struct{}{ingressPolicy.PolicyKey: {}, egressPolicy.PolicyKey: {}}, added)
+	ep := fake.Endpoints[netip.MustParseAddr("10.0.0.1")]
+	require.NotNil(t, ep)
+	require.Len(t, ep.Ingress, 2)
+	require.Len(t, ep.Egress, 2)
+}
+
+func TestAddBPFPoliciesFailure(t *testing.T) {
+	fake := bpfpolicy.NewFakeMaps()
+	fake.Err = bpfpolicy.ErrNoVethForAddress
+	pMgr := NewPolicyManager(common.NewMockIOShim(nil), bpfConfig(fake))
+	ingressPolicy, _ := bpfTestPolicies()
+
+	require.Error(t, pMgr.AddPolicies([]*NPMNetworkPolicy{ingressPolicy}, map[string]string{"10.0.0.1": "10.0.0.1"}))
+	require.False(t, pMgr.PolicyExists(ingressPolicy.PolicyKey))
+	require.Empty(t, ingressPolicy.PodEndpoints)
+}
+
+func TestBPFBootupRequiresMaps(t *testing.T) {
+	pMgr := NewPolicyManager(common.NewMockIOShim(nil), bpfConfig(nil))
+	require.Error(t, pMgr.Bootup(nil))
+}
@@ -0,0 +1,274 @@
+package policies
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	NPMIPtable "github.com/Azure/azure-container-networking/npm/pkg/dataplane/iptables"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/parse"
+	"github.com/Azure/azure-container-networking/npm/util"
+	npmerrors "github.com/Azure/azure-container-networking/npm/util/errors"
+	"github.com/Azure/azure-container-networking/npm/util/ioutil"
+	"k8s.io/klog"
+)
+
+var errDriftUnsupported = errors.New("drift detection is only supported for iptables policies")
+
+// ChainDrift describes how NPM's iptables chains in the kernel differ from the cache.
+type ChainDrift struct {
+	// MissingJumpFromForward is true if the FORWARD chain doesn't jump to AZURE-NPM
+	MissingJumpFromForward bool
+	// BaseChains are the base chains which are missing or have unexpected rules
+	BaseChains []string
+	// PolicyKeys are the policies whose chains are missing, have the wrong number of rules, or aren't jumped to exactly once
+	PolicyKeys []string
+}
+
+// HasDrift returns whether there is any drift.
+func (drift *ChainDrift) HasDrift() bool {
+	return drift.MissingJumpFromForward || len(drift.BaseChains) > 0 || len(drift.PolicyKeys) > 0
+}
+
+// VerifyIptables compares NPM's chains in the filter table against the policies in the cache.
+// Rules are compared by their targets and count, which catches deleted, flushed, or duplicated rules and chains.
+// The cache is only locked while the expected chains are read, so iptables-save doesn't block policy updates.
+func (pMgr *PolicyManager) VerifyIptables() (*ChainDrift, error) {
+	if pMgr.NativeNftables || pMgr.PolicyMode == BPFPolicyMode {
+		return nil, errDriftUnsupported
+	}
+
+	// policy chains are jumped to from the ingress/egress base chains
+	policyForChain := make(map[string]string)
+	numRulesForChain := make(map[string]int)
+	pMgr.policyMap.RLock()
+	for policyKey, policy := range pMgr.policyMap.cache {
+		for chain, numRules := range expectedPolicyChainRules(policy) {
+			policyForChain[chain] = policyKey
+			numRulesForChain[chain] = numRules
+		}
+	}
+	baseChainTargets := pMgr.expectedBaseChainTargets()
+	pMgr.policyMap.RUnlock()
+
+	parser := parse.IPTablesParser{IOShim: pMgr.ioShim}
+	table, err := parser.Iptables(util.IptablesFilterTable)
+	if err != nil {
+		return nil, npmerrors.SimpleErrorWrapper("failed to read iptables from the kernel", err)
+	}
+
+	drift := &ChainDrift{
+		MissingJumpFromForward: !hasJumpTo(table.Chains[util.IptablesForwardChain], util.IptablesAzureChain),
+	}
+
+	for chain, numRules := range numRulesForChain {
+		kernelChain, ok := table.Chains[chain]
+		if !ok || len(kernelChain.Rules) != numRules {
+			drift.addPolicy(policyForChain[chain])
+		}
+	}
+
+	for chain, expectedTargets := range baseChainTargets {
+		kernelChain, ok := table.Chains[chain]
+		if !ok {
+			drift.BaseChains = append(drift.BaseChains, chain)
+			continue
+		}
+
+		targets := make([]string, 0, len(kernelChain.Rules))
+		numJumps := make(map[string]int)
+		for _, rule := range kernelChain.Rules {
+			target := ruleTarget(rule)
+			if _, ok := policyForChain[target]; ok {
+				numJumps[target]++
+				continue
+			}
+			targets = append(targets, target)
+		}
+		if !equalTargets(targets, expectedTargets) {
+			drift.BaseChains = append(drift.BaseChains, chain)
+		}
+
+		if chain != util.IptablesAzureIngressChain && chain != util.IptablesAzureEgressChain {
+			continue
+		}
+		for policyChain, policyKey := range policyForChain {
+			if isIngressPolicyChain(policyChain) != (chain == util.IptablesAzureIngressChain) {
+				continue
+			}
+			if numJumps[policyChain] != 1 {
+				drift.addPolicy(policyKey)
+			}
+		}
+	}
+
+	sort.Strings(drift.BaseChains)
+	sort.Strings(drift.PolicyKeys)
+	if drift.HasDrift() {
+		klog.Warningf("[PolicyManager] iptables differ from the cache. missing jump from FORWARD: %t. base chains: %v. policies: %v",
+			drift.MissingJumpFromForward, drift.BaseChains, drift.PolicyKeys)
+	}
+	return drift, nil
+}
+
+// RepairIptables re-applies the drifted chains from the cache.
+// If a base chain drifted, all of NPM's chains are rewritten. Otherwise, only the drifted policies are rewritten.
+func (pMgr *PolicyManager) RepairIptables(drift *ChainDrift) error {
+	if pMgr.NativeNftables || pMgr.PolicyMode == BPFPolicyMode {
+		return errDriftUnsupported
+	}
+
+	pMgr.policyMap.Lock()
+	defer pMgr.policyMap.Unlock()
+
+	if len(drift.BaseChains) > 0 || len(drift.PolicyKeys) > 0 {
+		if err := pMgr.repairChains(drift); err != nil {
+			return err
+		}
+	}
+
+	if drift.MissingJumpFromForward {
+		if err := pMgr.positionAzureChainJumpRule(); err != nil {
+			return fmt.Errorf("failed to repair jump from FORWARD chain. err: %w", err)
+		}
+	}
+	return nil
+}
+
+func (pMgr *PolicyManager) repairChains(drift *ChainDrift) error {
+	var policies []*NPMNetworkPolicy
+	if len(drift.BaseChains) > 0 {
+		policies = make([]*NPMNetworkPolicy, 0, len(pMgr.policyMap.cache))
+		for _, policy := range pMgr.policyMap.cache {
+			policies = append(policies, policy)
+		}
+		sort.Slice(policies, func(i, j int) bool { return policies[i].PolicyKey < policies[j].PolicyKey })
+	} else {
+		policies = make([]*NPMNetworkPolicy, 0, len(drift.PolicyKeys))
+		for _, policyKey := range drift.PolicyKeys {
+			// the policy may have been removed since it was verified
+			if policy, ok := pMgr.policyMap.cache[policyKey]; ok {
+				policies = append(policies, policy)
+			}
+		}
+	}
+	policyChains := chainNames(policies)
+
+	// Stop reconciling so we don't contend for iptables, and so reconcile doesn't delete policyChains.
+	pMgr.reconcileManager.forceLock()
+	defer pMgr.reconcileManager.forceUnlock()
+
+	var creator *ioutil.FileCreator
+	if len(drift.BaseChains) > 0 {
+		klog.Infof("[PolicyManager] rewriting all chains since base chains drifted: %v", drift.BaseChains)
+		creator = pMgr.creatorForRepairingBaseChains(policyChains, policies)
+	} else {
+		klog.Infof("[PolicyManager] rewriting chains for drifted policies: %v", drift.PolicyKeys)
+		for _, policy := range policies {
+			// avoid duplicate jumps when the policy is added back
+			if err := pMgr.deleteOldJumpRulesOnRemove(policy); err != nil {
+				return fmt.Errorf("failed to delete jumps to drifted policy chains. err: %w", err)
+			}
+		}
+		creator = pMgr.creatorForNewNetworkPolicies(policyChains, policies)
+	}
+
+	if err := restore(creator); err != nil {
+		return fmt.Errorf("failed to restore drifted chains. err: %w", err)
+	}
+
+	for _, chain := range policyChains {
+		pMgr.staleChains.remove(chain)
+	}
+	return nil
+}
+
+// creatorForRepairingBaseChains flushes and rewrites the base chains and the chains for every policy.
+func (pMgr *PolicyManager) creatorForRepairingBaseChains(policyChains []string, policies []*NPMNetworkPolicy) *ioutil.FileCreator {
+	chains := make([]string, 0, len(iptablesAzureChains)+len(policyChains))
+	chains = append(chains, iptablesAzureChains...)
+	chains = append(chains, policyChains...)
+	creator := pMgr.newCreatorWithChains(chains)
+	writeBaseChainRules(creator)
+	if len(policies) > 0 {
+		writeActivationRules(creator)
+	}
+	writeNetworkPoliciesWithJumps(creator, policies)
+	creator.AddLine("", nil, util.IptablesRestoreCommit)
+	return creator
+}
+
+// expectedBaseChainTargets returns the targets of the rules in each base chain, excluding jumps to policy chains.
+// See creatorForBootup() and creatorForNewNetworkPolicies().
+func (pMgr *PolicyManager) expectedBaseChainTargets() map[string][]string {
+	var azureChainTargets []string
+	if !pMgr.isFirstPolicy() {
+		azureChainTargets = []string{util.IptablesAzureIngressChain, util.IptablesAzureEgressChain, util.IptablesAzureAcceptChain}
+	}
+	return map[string][]string{
+		util.IptablesAzureChain:                 azureChainTargets,
+		util.IptablesAzureIngressChain:          {util.IptablesDrop},
+		util.IptablesAzureIngressAllowMarkChain: {util.IptablesMark, util.IptablesAzureEgressChain},
+		util.IptablesAzureEgressChain:           {util.IptablesDrop, util.IptablesAzureAcceptChain},
+		util.IptablesAzureAcceptChain:           {util.IptablesAccept},
+	}
+}
+
+// expectedPolicyChainRules returns the number of rules in each of the policy's chains.
+// See writeNetworkPolicyRules().
+func expectedPolicyChainRules(networkPolicy *NPMNetworkPolicy) map[string]int {
+	numRules := make(map[string]int, 2)
+	for _, aclPolicy := range networkPolicy.ACLs {
+		if aclPolicy.hasIngress() {
+			numRules[networkPolicy.ingressChainName()]++
+		} else {
+			numRules[networkPolicy.egressChainName()]++
+		}
+	}
+	return numRules
+}
+
+func (drift *ChainDrift) addPolicy(policyKey string) {
+	for _, key := range drift.PolicyKeys {
+		if key == policyKey {
+			return
+		}
+	}
+	drift.PolicyKeys = append(drift.PolicyKeys, policyKey)
+}
+
+func isIngressPolicyChain(chain string) bool {
+	return strings.HasPrefix(chain, util.IptablesAzureIngressPolicyChainPrefix+"-")
+}
+
+func hasJumpTo(chain *NPMIPtable.Chain, target string) bool {
+	if chain == nil {
+		return false
+	}
+	for _, rule := range chain.Rules {
+		if ruleTarget(rule) == target {
+			return true
+		}
+	}
+	return false
+}
+
+func ruleTarget(rule *NPMIPtable.Rule) string {
+	if rule.Target == nil {
+		return ""
+	}
+	return rule.Target.Name
+}
+
+func equalTargets(actual, expected []string) bool {
+	if len(actual) != len(expected) {
+		return false
+	}
+	for i := range actual {
+		if actual[i] != expected[i] {
+			return false
+		}
+	}
+	return true
+}
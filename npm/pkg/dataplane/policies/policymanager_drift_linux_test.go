@@ -0,0 +1,223 @@
+package policies
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/npm/metrics"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/ipsets"
+	dptestutils "github.com/Azure/azure-container-networking/npm/pkg/dataplane/testutils"
+	"github.com/Azure/azure-container-networking/npm/util"
+	testutils "github.com/Azure/azure-container-networking/test/utils"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	iptablesSaveCommandStrings = []string{"iptables-nft-save", "-t", "filter"}
+
+	// iptables-save output for bothDirectionsNetPol and egressNetPol
+	driftTestForwardJump = "-A FORWARD -m conntrack --ctstate NEW -j AZURE-NPM"
+	driftTestAcceptRule  = "-A AZURE-NPM-ACCEPT -j ACCEPT"
+	driftTestEgressJump  = fmt.Sprintf("-A AZURE-NPM-EGRESS -m comment --comment %s -j %s", egressNetPolJumpComment, egressNetPolChain)
+	driftTestEgressRule  = fmt.Sprintf("-A %s -m set --match-set %s dst -m comment --comment %s -j AZURE-NPM-ACCEPT",
+		egressNetPolChain, ipsets.TestNamedportSet.HashedName, egressAllowComment)
+	driftTestIngressJump = fmt.Sprintf("-A AZURE-NPM-INGRESS -m set --match-set %s dst -m comment --comment %s -j %s",
+		ipsets.TestKeyPodSet.HashedName, bothDirectionsNetPolIngressJumpComment, bothDirectionsNetPolIngressChain)
+)
+
+func driftTestIptablesSave(withoutLines ...string) string {
+	lines := []string{
+		"*filter",
+		":INPUT ACCEPT [0:0]",
+		":FORWARD ACCEPT [0:0]",
+		":OUTPUT ACCEPT [0:0]",
+		":AZURE-NPM - [0:0]",
+		":AZURE-NPM-ACCEPT - [0:0]",
+		":AZURE-NPM-EGRESS - [0:0]",
+		":AZURE-NPM-INGRESS - [0:0]",
+		":AZURE-NPM-INGRESS-ALLOW-MARK - [0:0]",
+		fmt.Sprintf(":%s - [0:0]", bothDirectionsNetPolIngressChain),
+		fmt.Sprintf(":%s - [0:0]", bothDirectionsNetPolEgressChain),
+		fmt.Sprintf(":%s - [0:0]", egressNetPolChain),
+		driftTestForwardJump,
+		"-A FORWARD -m comment --comment kubernetes-forwarding-rules -j KUBE-FORWARD",
+		"-A AZURE-NPM -j AZURE-NPM-INGRESS",
+		"-A AZURE-NPM -j AZURE-NPM-EGRESS",
+		"-A AZURE-NPM -j AZURE-NPM-ACCEPT",
+		driftTestAcceptRule,
+		fmt.Sprintf("-A AZURE-NPM-EGRESS -m set --match-set %s src -m comment --comment %s -j %s",
+			ipsets.TestKeyPodSet.HashedName, bothDirectionsNetPolEgressJumpComment, bothDirectionsNetPolEgressChain),
+		driftTestEgressJump,
+		"-A AZURE-NPM-EGRESS -m mark --mark 0x800/0x800 -m comment --comment DROP-ON-EGRESS-DROP-MARK-0x800/0x800 -j DROP",
+		"-A AZURE-NPM-EGRESS -m mark --mark 0x200/0x200 -m comment --comment ACCEPT-ON-INGRESS-ALLOW-MARK-0x200/0x200 -j AZURE-NPM-ACCEPT",
+		driftTestIngressJump,
+		"-A AZURE-NPM-INGRESS -m mark --mark 0x400/0x400 -m comment --comment DROP-ON-INGRESS-DROP-MARK-0x400/0x400 -j DROP",
+		"-A AZURE-NPM-INGRESS-ALLOW-MARK -m comment --comment SET-INGRESS-ALLOW-MARK-0x200/0x200 -j MARK --set-xmark 0x200/0x200",
+		"-A AZURE-NPM-INGRESS-ALLOW-MARK -j AZURE-NPM-EGRESS",
+		fmt.Sprintf("-A %s -p tcp -m multiport --dports 222:333 -m comment --comment %s -j MARK --set-xmark 0x400/0x400",
+			bothDirectionsNetPolIngressChain, ingressDropComment),
+		fmt.Sprintf("-A %s -m comment --comment %s -j AZURE-NPM-INGRESS-ALLOW-MARK", bothDirectionsNetPolIngressChain, ingressAllowComment),
+		fmt.Sprintf("-A %s -p udp -m comment --comment %s -j MARK --set-xmark 0x800/0x800", bothDirectionsNetPolEgressChain, egressDropComment),
+		fmt.Sprintf("-A %s -m comment --comment %s -j AZURE-NPM-ACCEPT", bothDirectionsNetPolEgressChain, egressAllowComment),
+		driftTestEgressRule,
+		"COMMIT",
+	}
+
+	skip := make(map[string]struct{}, len(withoutLines))
+	for _, line := range withoutLines {
+		skip[line] = struct{}{}
+	}
+	kept := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if _, ok := skip[line]; !ok {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n") + "\n"
+}
+
+func newDriftTestPolicyManager(t *testing.T, calls []testutils.TestCmd) *PolicyManager {
+	metrics.ReinitializeAll()
+	calls = append([]testutils.TestCmd{fakeIPTablesRestoreCommand, fakeIPTablesRestoreCommand}, calls...)
+	ioshim := common.NewMockIOShim(calls)
+	t.Cleanup(func() { ioshim.VerifyCalls(t, calls) })
+
+	pMgr := NewPolicyManager(ioshim, ipsetConfig)
+	require.NoError(t, pMgr.AddPolicies([]*NPMNetworkPolicy{bothDirectionsNetPol}, nil))
+	require.NoError(t, pMgr.AddPolicies([]*NPMNetworkPolicy{egressNetPol}, nil))
+	return pMgr
+}
+
+func TestVerifyIptablesNoDrift(t *testing.T) {
+	pMgr := newDriftTestPolicyManager(t, []testutils.TestCmd{
+		{Cmd: iptablesSaveCommandStrings, Stdout: driftTestIptablesSave()},
+	})
+
+	drift, err := pMgr.VerifyIptables()
+	require.NoError(t, err)
+	require.False(t, drift.HasDrift(), "unexpected drift: %+v", drift)
+}
+
+func TestVerifyIptablesPolicyDrift(t *testing.T) {
+	// the jump to one policy is missing and the other policy's chain was flushed
+	calls := []testutils.TestCmd{
+		{Cmd: iptablesSaveCommandStrings, Stdout: driftTestIptablesSave(driftTestIngressJump, driftTestEgressRule)},
+	}
+	removeCalls := GetRemovePolicyTestCalls(bothDirectionsNetPol)
+	calls = append(calls, removeCalls[:len(removeCalls)-1]...)
+	removeCalls = GetRemovePolicyTestCalls(egressNetPol)
+	calls = append(calls, removeCalls[:len(removeCalls)-1]...)
+	calls = append(calls, fakeIPTablesRestoreCommand)
+	pMgr := newDriftTestPolicyManager(t, calls)
+
+	drift, err := pMgr.VerifyIptables()
+	require.NoError(t, err)
+	require.Equal(t, &ChainDrift{PolicyKeys: []string{bothDirectionsNetPol.PolicyKey, egressNetPol.PolicyKey}}, drift)
+	require.NoError(t, pMgr.RepairIptables(drift))
+}
+
+func TestVerifyIptablesDuplicateJump(t *testing.T) {
+	save := strings.Replace(driftTestIptablesSave(), driftTestEgressJump, driftTestEgressJump+"\n"+driftTestEgressJump, 1)
+	pMgr := newDriftTestPolicyManager(t, []testutils.TestCmd{
+		{Cmd: iptablesSaveCommandStrings, Stdout: save},
+	})
+
+	drift, err := pMgr.VerifyIptables()
+	require.NoError(t, err)
+	require.Equal(t, &ChainDrift{PolicyKeys: []string{egressNetPol.PolicyKey}}, drift)
+}
+
+func TestVerifyIptablesBaseChainDrift(t *testing.T) {
+	pMgr := newDriftTestPolicyManager(t, []testutils.TestCmd{
+		{Cmd: iptablesSaveCommandStrings, Stdout: driftTestIptablesSave(driftTestForwardJump, driftTestAcceptRule)},
+		fakeIPTablesRestoreCommand,
+		{Cmd: listLineNumbersCommandStrings, PipedToCommand: true},
+		{Cmd: []string{"grep", "AZURE-NPM"}, ExitCode: 1},
+		{Cmd: []string{"iptables-nft", "-w", "60", "-I", "FORWARD", "-j", "AZURE-NPM", "-m", "conntrack", "--ctstate", "NEW"}},
+	})
+
+	drift, err := pMgr.VerifyIptables()
+	require.NoError(t, err)
+	require.Equal(t, &ChainDrift{MissingJumpFromForward: true, BaseChains: []string{util.IptablesAzureAcceptChain}}, drift)
+	require.NoError(t, pMgr.RepairIptables(drift))
+}
+
+func TestVerifyIptablesWithoutPolicies(t *testing.T) {
+	metrics.ReinitializeAll()
+	save := strings.Join([]string{
+		"*filter",
+		":FORWARD ACCEPT [0:0]",
+		":AZURE-NPM - [0:0]",
+		":AZURE-NPM-ACCEPT - [0:0]",
+		":AZURE-NPM-EGRESS - [0:0]",
+		":AZURE-NPM-INGRESS - [0:0]",
+		":AZURE-NPM-INGRESS-ALLOW-MARK - [0:0]",
+		driftTestForwardJump,
+		driftTestAcceptRule,
+		"-A AZURE-NPM-EGRESS -m mark --mark 0x800/0x800 -j DROP",
+		"-A AZURE-NPM-EGRESS -m mark --mark 0x200/0x200 -j AZURE-NPM-ACCEPT",
+		"-A AZURE-NPM-INGRESS -m mark --mark 0x400/0x400 -j DROP",
+		"-A AZURE-NPM-INGRESS-ALLOW-MARK -j MARK --set-xmark 0x200/0x200",
+		"-A AZURE-NPM-INGRESS-ALLOW-MARK -j AZURE-NPM-EGRESS",
+		// a leftover jump to an old policy chain
+		"-A AZURE-NPM-INGRESS -j AZURE-NPM-INGRESS-123456",
+		"COMMIT",
+	}, "\n")
+	calls := []testutils.TestCmd{{Cmd: iptablesSaveCommandStrings, Stdout: save}}
+	ioshim := common.NewMockIOShim(calls)
+	defer ioshim.VerifyCalls(t, calls)
+	pMgr := NewPolicyManager(ioshim, ipsetConfig)
+
+	drift, err := pMgr.VerifyIptables()
+	require.NoError(t, err)
+	require.Equal(t, &ChainDrift{BaseChains: []string{util.IptablesAzureIngressChain}}, drift)
+}
+
+func TestVerifyIptablesFailure(t *testing.T) {
+	calls := []testutils.TestCmd{{Cmd: iptablesSaveCommandStrings, ExitCode: 1}}
+	ioshim := common.NewMockIOShim(calls)
+	defer ioshim.VerifyCalls(t, calls)
+	pMgr := NewPolicyManager(ioshim, ipsetConfig)
+
+	_, err := pMgr.VerifyIptables()
+	require.Error(t, err)
+}
+
+func TestVerifyIptablesUnsupported(t *testing.T) {
+	pMgr := NewPolicyManager(common.NewMockIOShim(nil), &PolicyManagerCfg{NativeNftables: true})
+	_, err := pMgr.VerifyIptables()
+	require.ErrorIs(t, err, errDriftUnsupported)
+}
+
+func TestCreatorForRepairingBaseChains(t *testing.T) {
+	pMgr := NewPolicyManager(common.NewMockIOShim(nil), ipsetConfig)
+	policies := []*NPMNetworkPolicy{egressNetPol}
+	creator := pMgr.creatorForRepairingBaseChains(chainNames(policies), policies)
+	actualLines := strings.Split(creator.ToString(), "\n")
+	expectedLines := []string{
+		"*filter",
+		":AZURE-NPM - -",
+		":AZURE-NPM-INGRESS - -",
+		":AZURE-NPM-INGRESS-ALLOW-MARK - -",
+		":AZURE-NPM-EGRESS - -",
+		":AZURE-NPM-ACCEPT - -",
+		fmt.Sprintf(":%s - -", egressNetPolChain),
+		"-A AZURE-NPM-INGRESS -j DROP -m mark --mark 0x400/0x400 -m comment --comment DROP-ON-INGRESS-DROP-MARK-0x400/0x400",
+		"-A AZURE-NPM-INGRESS-ALLOW-MARK -j MARK --set-mark 0x200/0x200 -m comment --comment SET-INGRESS-ALLOW-MARK-0x200/0x200",
+		"-A AZURE-NPM-INGRESS-ALLOW-MARK -j AZURE-NPM-EGRESS",
+		"-A AZURE-NPM-EGRESS -j DROP -m mark --mark 0x800/0x800 -m comment --comment DROP-ON-EGRESS-DROP-MARK-0x800/0x800",
+		"-A AZURE-NPM-EGRESS -j AZURE-NPM-ACCEPT -m mark --mark 0x200/0x200 -m comment --comment ACCEPT-ON-INGRESS-ALLOW-MARK-0x200/0x200",
+		"-A AZURE-NPM-ACCEPT -j ACCEPT",
+		"-F AZURE-NPM",
+		"-A AZURE-NPM -j AZURE-NPM-INGRESS",
+		"-A AZURE-NPM -j AZURE-NPM-EGRESS",
+		"-A AZURE-NPM -j AZURE-NPM-ACCEPT",
+		fmt.Sprintf("-A %s %s", egressNetPolChain, egressAllowRule),
+		fmt.Sprintf("-I AZURE-NPM-EGRESS 1 %s", egressNetPolJump),
+		"COMMIT",
+		"",
+	}
+	dptestutils.AssertEqualLines(t, expectedLines, actualLines)
+}
@@ -41,7 +41,14 @@ Known errors that we should retry on:
     Another app is currently holding the xtables lock. Stopped waiting after 60s.
 */
 
-func (pMgr *PolicyManager) addPolicies(networkPolicies []*NPMNetworkPolicy, _ map[string]string) error {
+func (pMgr *PolicyManager) addPolicies(networkPolicies []*NPMNetworkPolicy, endpointList map[string]string) error {
+	if pMgr.PolicyMode == BPFPolicyMode {
+		return pMgr.addPoliciesBPF(networkPolicies, endpointList)
+	}
+	if pMgr.NativeNftables {
+		return pMgr.addPoliciesNft(networkPolicies)
+	}
+
 	// 1. Add rules for the network policies and activate NPM (if necessary).
 	chainsToCreate := chainNames(networkPolicies)
 	creator := pMgr.creatorForNewNetworkPolicies(chainsToCreate, networkPolicies)
@@ -65,7 +72,21 @@ func (pMgr *PolicyManager) addPolicies(networkPolicies []*NPMNetworkPolicy, _ ma
 	return nil
 }
 
-func (pMgr *PolicyManager) removePolicy(networkPolicy *NPMNetworkPolicy, _ map[string]string) error {
+// removePolicyForEndpoints locks the cache since removePolicyBPF() reads the other policies in it.
+func (pMgr *PolicyManager) removePolicyForEndpoints(networkPolicy *NPMNetworkPolicy, endpointList map[string]string) error {
+	pMgr.policyMap.Lock()
+	defer pMgr.policyMap.Unlock()
+	return pMgr.removePolicy(networkPolicy, endpointList)
+}
+
+func (pMgr *PolicyManager) removePolicy(networkPolicy *NPMNetworkPolicy, endpointList map[string]string) error {
+	if pMgr.PolicyMode == BPFPolicyMode {
+		return pMgr.removePolicyBPF(networkPolicy, endpointList)
+	}
+	if pMgr.NativeNftables {
+		return pMgr.removePolicyNft(networkPolicy)
+	}
+
 	chainsToDelete := chainNames([]*NPMNetworkPolicy{networkPolicy})
 	creator := pMgr.creatorForRemovingPolicies(chainsToDelete)
 
@@ -214,13 +235,25 @@ func (pMgr *PolicyManager) creatorForNewNetworkPolicies(policyChains []string, n
 
 	// 1. Activate NPM if necessary
 	if pMgr.isFirstPolicy() {
-		creator.AddLine("", nil, util.IptablesFlushFlag, util.IptablesAzureChain) // flush just in case there are old rules
-		creator.AddLine("", nil, util.IptablesAppendFlag, util.IptablesAzureChain, util.IptablesJumpFlag, util.IptablesAzureIngressChain)
-		creator.AddLine("", nil, util.IptablesAppendFlag, util.IptablesAzureChain, util.IptablesJumpFlag, util.IptablesAzureEgressChain)
-		creator.AddLine("", nil, util.IptablesAppendFlag, util.IptablesAzureChain, util.IptablesJumpFlag, util.IptablesAzureAcceptChain)
+		writeActivationRules(creator)
 	}
 
 	// 2. Add all rules for the network policies
+	writeNetworkPoliciesWithJumps(creator, networkPolicies)
+	creator.AddLine("", nil, util.IptablesRestoreCommit)
+	return creator
+}
+
+// writeActivationRules activates NPM by adding jumps from AZURE-NPM to the base chains.
+func writeActivationRules(creator *ioutil.FileCreator) {
+	creator.AddLine("", nil, util.IptablesFlushFlag, util.IptablesAzureChain) // flush just in case there are old rules
+	creator.AddLine("", nil, util.IptablesAppendFlag, util.IptablesAzureChain, util.IptablesJumpFlag, util.IptablesAzureIngressChain)
+	creator.AddLine("", nil, util.IptablesAppendFlag, util.IptablesAzureChain, util.IptablesJumpFlag, util.IptablesAzureEgressChain)
+	creator.AddLine("", nil, util.IptablesAppendFlag, util.IptablesAzureChain, util.IptablesJumpFlag, util.IptablesAzureAcceptChain)
+}
+
+// writeNetworkPoliciesWithJumps adds the rules for the policy chains and inserts jumps to them at the top of the base chains.
+func writeNetworkPoliciesWithJumps(creator *ioutil.FileCreator, networkPolicies []*NPMNetworkPolicy) {
 	ingressJumpLineNumber := 1
 	egressJumpLineNumber := 1
 	for _, networkPolicy := range networkPolicies {
@@ -240,8 +273,6 @@ func (pMgr *PolicyManager) creatorForNewNetworkPolicies(policyChains []string, n
 			egressJumpLineNumber++
 		}
 	}
-	creator.AddLine("", nil, util.IptablesRestoreCommit)
-	return creator
 }
 
 // write rules for the policy chain(s)
@@ -0,0 +1,386 @@
+package policies
+
+// This file contains code for the native nftables implementation of booting up and adding/removing policies.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/npm/metrics"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/ipsets"
+	"github.com/Azure/azure-container-networking/npm/util"
+	npmerrors "github.com/Azure/azure-container-networking/npm/util/errors"
+	"github.com/Azure/azure-container-networking/npm/util/ioutil"
+	"k8s.io/klog"
+)
+
+// nft rejects comments longer than 128 characters
+const maxNftCommentLength = 128
+
+var nftTable = util.NftFamily + " " + util.NftAzureTable
+
+/*
+In native nftables mode, NPM owns the nftables table "ip azure-npm" and never calls iptables (except to clean up iptables-based NPM).
+The chains mirror the iptables chains:
+
+	FORWARD (base chain hooked into forward)
+	  ct state new jump AZURE-NPM
+	AZURE-NPM (flushed while there are no policies)
+	  jump AZURE-NPM-INGRESS
+	  jump AZURE-NPM-EGRESS
+	  jump AZURE-NPM-ACCEPT
+	AZURE-NPM-INGRESS
+	  ip daddr vmap @AZURE-NPM-INGRESS-DISPATCH
+	  drop on ingress drop mark
+	AZURE-NPM-INGRESS-ALLOW-MARK
+	  set ingress allow mark
+	  jump AZURE-NPM-EGRESS
+	AZURE-NPM-EGRESS
+	  ip saddr vmap @AZURE-NPM-EGRESS-DISPATCH
+	  drop on egress drop mark
+	  jump AZURE-NPM-ACCEPT on ingress allow mark
+	AZURE-NPM-ACCEPT
+	  accept
+
+Instead of evaluating the jump to every policy chain, the dispatch maps (owned by the IPSetManager) jump straight to a chain for the Pod's namespace.
+Each namespace chain holds the jumps to the policy chains in that namespace, guarded by the policy's pod selector.
+Policy chains have the same names and rules as in iptables.
+
+Unlike iptables, accept only ends evaluation of NPM's base chain. Chains in other tables (e.g. kube-proxy's) are still evaluated, while drop is final.
+
+nft applies a file as one transaction, so each add/remove rebuilds the affected namespace chains in full and deletes old policy chains in the foreground.
+*/
+
+// bootupNft cleans up iptables-based NPM and recreates NPM's nftables table with the base chains.
+// The IPSetManager must be reset afterwards since deleting the table deletes all sets and maps.
+func (pMgr *PolicyManager) bootupNft() error {
+	klog.Infof("booting up nftables Azure chains")
+
+	pMgr.reconcileManager.forceLock()
+	defer pMgr.reconcileManager.forceUnlock()
+
+	pMgr.cleanupAllIptables()
+
+	creator := pMgr.creatorForNftBootup()
+	if err := runNft(creator); err != nil {
+		return npmerrors.SimpleErrorWrapper("failed to run nft for bootup", err)
+	}
+	return nil
+}
+
+// cleanupAllIptables deletes NPM chains in both iptables-nft and iptables-legacy.
+// Failures are only logged since the binaries may be missing on a node which doesn't use iptables.
+func (pMgr *PolicyManager) cleanupAllIptables() {
+	hadNFT := util.Iptables == util.IptablesNft
+	defer func() {
+		if hadNFT {
+			util.SetIptablesToNft()
+		} else {
+			util.SetIptablesToLegacy()
+		}
+	}()
+
+	util.SetIptablesToNft()
+	if err := pMgr.cleanupCurrentIptables(); err != nil {
+		metrics.SendErrorLogAndMetric(util.IptmID, "[cleanup] failed to clean up iptables-nft chains while not using iptables. err: %s", err.Error())
+	}
+
+	util.SetIptablesToLegacy()
+	if err := pMgr.cleanupCurrentIptables(); err != nil {
+		metrics.SendErrorLogAndMetric(util.IptmID, "[cleanup] failed to clean up iptables-legacy chains while not using iptables. err: %s", err.Error())
+	}
+}
+
+func (pMgr *PolicyManager) creatorForNftBootup() *ioutil.FileCreator {
+	creator := pMgr.newNftCreator()
+
+	// recreate the table to remove all old chains, sets, and maps
+	creator.AddLine("", nil, "add table", nftTable)
+	creator.AddLine("", nil, "delete table", nftTable)
+	creator.AddLine("", nil, "add table", nftTable)
+	creator.AddLine("", nil, "add map", nftTable, util.NftIngressDispatchMap, "{ type ipv4_addr : verdict ; }")
+	creator.AddLine("", nil, "add map", nftTable, util.NftEgressDispatchMap, "{ type ipv4_addr : verdict ; }")
+	for _, chain := range iptablesAzureChains {
+		creator.AddLine("", nil, "add chain", nftTable, chain)
+	}
+
+	priority := util.NftPriorityAfterKube
+	if pMgr.PlaceAzureChainFirst == util.PlaceAzureChainFirst {
+		priority = util.NftPriorityFirst
+	}
+	creator.AddLine("", nil, "add chain", nftTable, util.NftForwardChain, "{ type filter hook forward priority", priority, "; policy accept ; }")
+	// To leave NPM deactivated, don't specify any rules for AZURE-NPM chain.
+	addNftRule(creator, util.NftForwardChain, "ct state new jump", util.IptablesAzureChain)
+
+	// add AZURE-NPM-INGRESS chain rules
+	addNftRule(creator, util.IptablesAzureIngressChain, "ip daddr vmap", "@"+util.NftIngressDispatchMap)
+	addNftRule(creator, util.IptablesAzureIngressChain, nftOnMark(util.NftIngressDropMark), "drop",
+		nftComment("DROP-ON-INGRESS-DROP-MARK-"+util.NftIngressDropMark))
+
+	// add AZURE-NPM-INGRESS-ALLOW-MARK chain rules
+	addNftRule(creator, util.IptablesAzureIngressAllowMarkChain, nftSetMark(util.NftIngressAllowMark),
+		nftComment("SET-INGRESS-ALLOW-MARK-"+util.NftIngressAllowMark))
+	addNftRule(creator, util.IptablesAzureIngressAllowMarkChain, "jump", util.IptablesAzureEgressChain)
+
+	// add AZURE-NPM-EGRESS chain rules
+	addNftRule(creator, util.IptablesAzureEgressChain, "ip saddr vmap", "@"+util.NftEgressDispatchMap)
+	addNftRule(creator, util.IptablesAzureEgressChain, nftOnMark(util.NftEgressDropMark), "drop",
+		nftComment("DROP-ON-EGRESS-DROP-MARK-"+util.NftEgressDropMark))
+	addNftRule(creator, util.IptablesAzureEgressChain, nftOnMark(util.NftIngressAllowMark), "jump", util.IptablesAzureAcceptChain,
+		nftComment("ACCEPT-ON-INGRESS-ALLOW-MARK-"+util.NftIngressAllowMark))
+
+	// add AZURE-NPM-ACCEPT chain rules
+	addNftRule(creator, util.IptablesAzureAcceptChain, "accept")
+	return creator
+}
+
+func (pMgr *PolicyManager) addPoliciesNft(networkPolicies []*NPMNetworkPolicy) error {
+	creator := pMgr.creatorForNewNftPolicies(networkPolicies)
+
+	timer := metrics.StartNewTimer()
+	err := runNft(creator)
+	metrics.RecordIPTablesRestoreLatency(timer, metrics.CreateOp)
+	if err != nil {
+		metrics.IncIPTablesRestoreFailures(metrics.CreateOp)
+		return fmt.Errorf("failed to run nft with updated policies. err: %w", err)
+	}
+	return nil
+}
+
+func (pMgr *PolicyManager) removePolicyNft(networkPolicy *NPMNetworkPolicy) error {
+	creator := pMgr.creatorForRemovingNftPolicy(networkPolicy)
+
+	timer := metrics.StartNewTimer()
+	err := runNft(creator)
+	metrics.RecordIPTablesRestoreLatency(timer, metrics.DeleteOp)
+	if err != nil {
+		metrics.IncIPTablesRestoreFailures(metrics.DeleteOp)
+		return fmt.Errorf("failed to run nft to remove policy. err: %w", err)
+	}
+	return nil
+}
+
+func (pMgr *PolicyManager) creatorForNewNftPolicies(networkPolicies []*NPMNetworkPolicy) *ioutil.FileCreator {
+	creator := pMgr.newNftCreator()
+
+	// 1. Activate NPM if necessary
+	if pMgr.isFirstPolicy() {
+		creator.AddLine("", nil, "flush chain", nftTable, util.IptablesAzureChain) // flush just in case there are old rules
+		addNftRule(creator, util.IptablesAzureChain, "jump", util.IptablesAzureIngressChain)
+		addNftRule(creator, util.IptablesAzureChain, "jump", util.IptablesAzureEgressChain)
+		addNftRule(creator, util.IptablesAzureChain, "jump", util.IptablesAzureAcceptChain)
+	}
+
+	// 2. Add all rules for the network policies
+	for _, chain := range chainNames(networkPolicies) {
+		creator.AddLine("", nil, "add chain", nftTable, chain)
+		creator.AddLine("", nil, "flush chain", nftTable, chain)
+	}
+	for _, networkPolicy := range networkPolicies {
+		writeNftNetworkPolicyRules(creator, networkPolicy)
+	}
+
+	// 3. Rebuild the namespace chains with jumps to the policy chains
+	updated := make(map[string]*NPMNetworkPolicy, len(networkPolicies))
+	for _, networkPolicy := range networkPolicies {
+		updated[networkPolicy.PolicyKey] = networkPolicy
+	}
+	pMgr.writeNftNamespaceChains(creator, updated, "")
+	return creator
+}
+
+// NOTE: if removing multiple policies, would need to add a isLastPolicy argument instead
+func (pMgr *PolicyManager) creatorForRemovingNftPolicy(networkPolicy *NPMNetworkPolicy) *ioutil.FileCreator {
+	creator := pMgr.newNftCreator()
+
+	// 1. Deactivate NPM (if necessary).
+	if pMgr.isLastPolicy() {
+		creator.AddLine("", nil, "flush chain", nftTable, util.IptablesAzureChain)
+	}
+
+	// 2. Remove the jumps to the policy chains.
+	updated := map[string]*NPMNetworkPolicy{networkPolicy.PolicyKey: networkPolicy}
+	pMgr.writeNftNamespaceChains(creator, updated, networkPolicy.PolicyKey)
+
+	// 3. Delete the policy chains. Declaring each chain first makes the delete idempotent.
+	for _, chain := range chainNames([]*NPMNetworkPolicy{networkPolicy}) {
+		creator.AddLine("", nil, "add chain", nftTable, chain)
+		creator.AddLine("", nil, "flush chain", nftTable, chain)
+		creator.AddLine("", nil, "delete chain", nftTable, chain)
+	}
+	return creator
+}
+
+// writeNftNamespaceChains rebuilds the namespace chains for the namespaces of the updated policies.
+// The chains contain jumps for all policies in the cache plus the updated policies, except for the removed policy.
+func (pMgr *PolicyManager) writeNftNamespaceChains(creator *ioutil.FileCreator, updated map[string]*NPMNetworkPolicy, removedPolicyKey string) {
+	namespaces := make(map[string]struct{})
+	for _, networkPolicy := range updated {
+		namespaces[networkPolicy.Namespace] = struct{}{}
+	}
+
+	policiesByNamespace := make(map[string][]*NPMNetworkPolicy, len(namespaces))
+	addPolicy := func(networkPolicy *NPMNetworkPolicy) {
+		if networkPolicy.PolicyKey == removedPolicyKey {
+			return
+		}
+		if _, ok := namespaces[networkPolicy.Namespace]; ok {
+			policiesByNamespace[networkPolicy.Namespace] = append(policiesByNamespace[networkPolicy.Namespace], networkPolicy)
+		}
+	}
+	for policyKey, networkPolicy := range pMgr.policyMap.cache {
+		if _, ok := updated[policyKey]; !ok {
+			addPolicy(networkPolicy)
+		}
+	}
+	for _, networkPolicy := range updated {
+		addPolicy(networkPolicy)
+	}
+
+	sortedNamespaces := make([]string, 0, len(namespaces))
+	for namespace := range namespaces {
+		sortedNamespaces = append(sortedNamespaces, namespace)
+	}
+	sort.Strings(sortedNamespaces)
+
+	for _, namespace := range sortedNamespaces {
+		ingressChain := util.NftNamespaceChainName(util.NftIngressNamespaceChainPrefix, namespace)
+		egressChain := util.NftNamespaceChainName(util.NftEgressNamespaceChainPrefix, namespace)
+		creator.AddLine("", nil, "add chain", nftTable, ingressChain)
+		creator.AddLine("", nil, "flush chain", nftTable, ingressChain)
+		creator.AddLine("", nil, "add chain", nftTable, egressChain)
+		creator.AddLine("", nil, "flush chain", nftTable, egressChain)
+
+		networkPolicies := policiesByNamespace[namespace]
+		sort.Slice(networkPolicies, func(i, j int) bool {
+			return networkPolicies[i].PolicyKey < networkPolicies[j].PolicyKey
+		})
+		for _, networkPolicy := range networkPolicies {
+			hasIngress, hasEgress := networkPolicy.hasIngressAndEgress()
+			if hasIngress {
+				addNftRule(creator, ingressChain, nftJumpSpecs(networkPolicy, forIngress)...)
+			}
+			if hasEgress {
+				addNftRule(creator, egressChain, nftJumpSpecs(networkPolicy, forEgress)...)
+			}
+		}
+	}
+}
+
+func nftJumpSpecs(networkPolicy *NPMNetworkPolicy, direction UniqueDirection) []string {
+	matchType := SrcMatch
+	chainName := networkPolicy.egressChainName()
+	if direction == forIngress {
+		matchType = DstMatch
+		chainName = networkPolicy.ingressChainName()
+	}
+
+	specs := make([]string, 0, len(networkPolicy.PodSelectorList)+2)
+	for _, setInfo := range networkPolicy.PodSelectorList {
+		specs = append(specs, setInfo.nftMatchSpec(matchType))
+	}
+	specs = append(specs, "jump", chainName, nftComment(networkPolicy.commentForJump(direction)))
+	return specs
+}
+
+// write rules for the policy chain(s)
+func writeNftNetworkPolicyRules(creator *ioutil.FileCreator, networkPolicy *NPMNetworkPolicy) {
+	for _, aclPolicy := range networkPolicy.ACLs {
+		var chainName string
+		var actionSpec string
+		if aclPolicy.hasIngress() {
+			chainName = networkPolicy.ingressChainName()
+			if aclPolicy.Target == Allowed {
+				actionSpec = "jump " + util.IptablesAzureIngressAllowMarkChain
+			} else {
+				actionSpec = nftSetMark(util.NftIngressDropMark)
+			}
+		} else {
+			chainName = networkPolicy.egressChainName()
+			if aclPolicy.Target == Allowed {
+				actionSpec = "jump " + util.IptablesAzureAcceptChain
+			} else {
+				actionSpec = nftSetMark(util.NftEgressDropMark)
+			}
+		}
+		specs := append(nftRuleSpecs(aclPolicy), actionSpec, nftComment(aclPolicy.comment()))
+		addNftRule(creator, chainName, specs...)
+	}
+}
+
+func nftRuleSpecs(aclPolicy *ACLPolicy) []string {
+	specs := make([]string, 0)
+	if aclPolicy.Protocol != UnspecifiedProtocol {
+		specs = append(specs, "meta l4proto "+strings.ToLower(string(aclPolicy.Protocol)))
+	}
+	if !aclPolicy.DstPorts.isUnspecified() {
+		specs = append(specs, "th dport "+aclPolicy.DstPorts.toNftString())
+	}
+	for _, setInfo := range aclPolicy.SrcList {
+		specs = append(specs, setInfo.nftMatchSpec(setInfo.MatchType))
+	}
+	for _, setInfo := range aclPolicy.DstList {
+		specs = append(specs, setInfo.nftMatchSpec(setInfo.MatchType))
+	}
+	return specs
+}
+
+// nftMatchSpec is the nftables equivalent of matchSetSpecs().
+func (info SetInfo) nftMatchSpec(matchType MatchType) string {
+	var selector string
+	switch {
+	case info.IPSet.Type == ipsets.NamedPorts || matchType == DstDstMatch:
+		selector = "ip daddr . meta l4proto . th dport"
+	case matchType == SrcMatch:
+		selector = "ip saddr"
+	default:
+		selector = "ip daddr"
+	}
+
+	operator := ""
+	if !info.Included {
+		operator = "!= "
+	}
+	return fmt.Sprintf("%s %s@%s", selector, operator, info.IPSet.GetHashedName())
+}
+
+func (portRange *Ports) toNftString() string {
+	if portRange.Port >= portRange.EndPort {
+		return fmt.Sprint(portRange.Port)
+	}
+	return fmt.Sprintf("%d-%d", portRange.Port, portRange.EndPort)
+}
+
+func nftOnMark(mark string) string {
+	return fmt.Sprintf("meta mark and %s == %s", mark, mark)
+}
+
+func nftSetMark(mark string) string {
+	return "meta mark set meta mark or " + mark
+}
+
+func nftComment(comment string) string {
+	if len(comment) > maxNftCommentLength {
+		comment = comment[:maxNftCommentLength]
+	}
+	return fmt.Sprintf("comment %q", comment)
+}
+
+func addNftRule(creator *ioutil.FileCreator, chain string, specs ...string) {
+	line := append([]string{"add rule", nftTable, chain}, specs...)
+	creator.AddLine("", nil, line...) // TODO add error handler
+}
+
+func (pMgr *PolicyManager) newNftCreator() *ioutil.FileCreator {
+	// no line failure patterns since nft never partially applies a file
+	return ioutil.NewFileCreator(pMgr.ioShim, maxTryCount)
+}
+
+func runNft(creator *ioutil.FileCreator) error {
+	err := creator.RunCommandWithFile(util.Nft, util.NftFileFlag, util.NftStdinFile)
+	if err != nil {
+		return fmt.Errorf("failed to run nft file. err: %w", err)
+	}
+	return nil
+}
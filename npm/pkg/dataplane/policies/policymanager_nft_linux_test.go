@@ -0,0 +1,239 @@
+package policies
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/ipsets"
+	dptestutils "github.com/Azure/azure-container-networking/npm/pkg/dataplane/testutils"
+	"github.com/Azure/azure-container-networking/npm/util"
+	testutils "github.com/Azure/azure-container-networking/test/utils"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	nftConfig = &PolicyManagerCfg{
+		PolicyMode:           IPSetPolicyMode,
+		PlaceAzureChainFirst: util.PlaceAzureChainFirst,
+		NativeNftables:       true,
+	}
+
+	fakeNftCommand = testutils.TestCmd{Cmd: []string{"nft", "-f", "-"}}
+)
+
+// nft rule variables for ACLs
+var (
+	nftIngressDropRule = fmt.Sprintf(
+		"meta l4proto tcp th dport 222-333 ip saddr @%s ip daddr != @%s meta mark set meta mark or 0x400 comment %q",
+		ipsets.TestCIDRSet.HashedName,
+		ipsets.TestKeyPodSet.HashedName,
+		ingressDropComment,
+	)
+	nftIngressAllowRule = fmt.Sprintf("ip saddr @%s jump AZURE-NPM-INGRESS-ALLOW-MARK comment %q", ipsets.TestCIDRSet.HashedName, ingressAllowComment)
+	nftEgressDropRule   = fmt.Sprintf("meta l4proto udp th dport 144 ip daddr @%s meta mark set meta mark or 0x800 comment %q",
+		ipsets.TestCIDRSet.HashedName,
+		egressDropComment,
+	)
+	nftEgressAllowRule = fmt.Sprintf("ip daddr . meta l4proto . th dport @%s jump AZURE-NPM-ACCEPT comment %q", ipsets.TestNamedportSet.HashedName, egressAllowComment)
+
+	nftIngressNSChainX = util.NftNamespaceChainName(util.NftIngressNamespaceChainPrefix, "x")
+	nftEgressNSChainX  = util.NftNamespaceChainName(util.NftEgressNamespaceChainPrefix, "x")
+	nftIngressNSChainY = util.NftNamespaceChainName(util.NftIngressNamespaceChainPrefix, "y")
+	nftEgressNSChainY  = util.NftNamespaceChainName(util.NftEgressNamespaceChainPrefix, "y")
+	nftIngressNSChainZ = util.NftNamespaceChainName(util.NftIngressNamespaceChainPrefix, "z")
+	nftEgressNSChainZ  = util.NftNamespaceChainName(util.NftEgressNamespaceChainPrefix, "z")
+)
+
+func TestCreatorForNftBootup(t *testing.T) {
+	pMgr := NewPolicyManager(common.NewMockIOShim(nil), nftConfig)
+	creator := pMgr.creatorForNftBootup()
+	actualLines := strings.Split(creator.ToString(), "\n")
+	expectedLines := []string{
+		"add table ip azure-npm",
+		"delete table ip azure-npm",
+		"add table ip azure-npm",
+		"add map ip azure-npm AZURE-NPM-INGRESS-DISPATCH { type ipv4_addr : verdict ; }",
+		"add map ip azure-npm AZURE-NPM-EGRESS-DISPATCH { type ipv4_addr : verdict ; }",
+		"add chain ip azure-npm AZURE-NPM",
+		"add chain ip azure-npm AZURE-NPM-INGRESS",
+		"add chain ip azure-npm AZURE-NPM-INGRESS-ALLOW-MARK",
+		"add chain ip azure-npm AZURE-NPM-EGRESS",
+		"add chain ip azure-npm AZURE-NPM-ACCEPT",
+		"add chain ip azure-npm FORWARD { type filter hook forward priority -10 ; policy accept ; }",
+		"add rule ip azure-npm FORWARD ct state new jump AZURE-NPM",
+		"add rule ip azure-npm AZURE-NPM-INGRESS ip daddr vmap @AZURE-NPM-INGRESS-DISPATCH",
+		`add rule ip azure-npm AZURE-NPM-INGRESS meta mark and 0x400 == 0x400 drop comment "DROP-ON-INGRESS-DROP-MARK-0x400"`,
+		`add rule ip azure-npm AZURE-NPM-INGRESS-ALLOW-MARK meta mark set meta mark or 0x200 comment "SET-INGRESS-ALLOW-MARK-0x200"`,
+		"add rule ip azure-npm AZURE-NPM-INGRESS-ALLOW-MARK jump AZURE-NPM-EGRESS",
+		"add rule ip azure-npm AZURE-NPM-EGRESS ip saddr vmap @AZURE-NPM-EGRESS-DISPATCH",
+		`add rule ip azure-npm AZURE-NPM-EGRESS meta mark and 0x800 == 0x800 drop comment "DROP-ON-EGRESS-DROP-MARK-0x800"`,
+		`add rule ip azure-npm AZURE-NPM-EGRESS meta mark and 0x200 == 0x200 jump AZURE-NPM-ACCEPT comment "ACCEPT-ON-INGRESS-ALLOW-MARK-0x200"`,
+		"add rule ip azure-npm AZURE-NPM-ACCEPT accept",
+		"",
+	}
+	dptestutils.AssertEqualLines(t, expectedLines, actualLines)
+}
+
+func TestCreatorForNftBootupAfterKube(t *testing.T) {
+	cfg := *nftConfig
+	cfg.PlaceAzureChainFirst = util.PlaceAzureChainAfterKubeServices
+	pMgr := NewPolicyManager(common.NewMockIOShim(nil), &cfg)
+	creator := pMgr.creatorForNftBootup()
+	require.Contains(t, creator.ToString(), "add chain ip azure-npm FORWARD { type filter hook forward priority 10 ; policy accept ; }\n")
+}
+
+func TestCreatorForAddNftPolicies(t *testing.T) {
+	calls := []testutils.TestCmd{fakeNftCommand}
+	ioshim := common.NewMockIOShim(calls)
+	defer ioshim.VerifyCalls(t, calls)
+	pMgr := NewPolicyManager(ioshim, nftConfig)
+
+	// 1. test with activation
+	policies := []*NPMNetworkPolicy{bothDirectionsNetPol}
+	creator := pMgr.creatorForNewNftPolicies(policies)
+	actualLines := strings.Split(creator.ToString(), "\n")
+	expectedLines := []string{
+		"flush chain ip azure-npm AZURE-NPM",
+		// activation rules for AZURE-NPM chain
+		"add rule ip azure-npm AZURE-NPM jump AZURE-NPM-INGRESS",
+		"add rule ip azure-npm AZURE-NPM jump AZURE-NPM-EGRESS",
+		"add rule ip azure-npm AZURE-NPM jump AZURE-NPM-ACCEPT",
+		// all chains
+		"add chain ip azure-npm " + bothDirectionsNetPolIngressChain,
+		"flush chain ip azure-npm " + bothDirectionsNetPolIngressChain,
+		"add chain ip azure-npm " + bothDirectionsNetPolEgressChain,
+		"flush chain ip azure-npm " + bothDirectionsNetPolEgressChain,
+		// policy 1
+		fmt.Sprintf("add rule ip azure-npm %s %s", bothDirectionsNetPolIngressChain, nftIngressDropRule),
+		fmt.Sprintf("add rule ip azure-npm %s %s", bothDirectionsNetPolIngressChain, nftIngressAllowRule),
+		fmt.Sprintf("add rule ip azure-npm %s %s", bothDirectionsNetPolEgressChain, nftEgressDropRule),
+		fmt.Sprintf("add rule ip azure-npm %s %s", bothDirectionsNetPolEgressChain, nftEgressAllowRule),
+		// namespace x
+		"add chain ip azure-npm " + nftIngressNSChainX,
+		"flush chain ip azure-npm " + nftIngressNSChainX,
+		"add chain ip azure-npm " + nftEgressNSChainX,
+		"flush chain ip azure-npm " + nftEgressNSChainX,
+		fmt.Sprintf("add rule ip azure-npm %s ip daddr @%s jump %s comment %q",
+			nftIngressNSChainX, ipsets.TestKeyPodSet.HashedName, bothDirectionsNetPolIngressChain, bothDirectionsNetPolIngressJumpComment),
+		fmt.Sprintf("add rule ip azure-npm %s ip saddr @%s jump %s comment %q",
+			nftEgressNSChainX, ipsets.TestKeyPodSet.HashedName, bothDirectionsNetPolEgressChain, bothDirectionsNetPolEgressJumpComment),
+		"",
+	}
+	dptestutils.AssertEqualLines(t, expectedLines, actualLines)
+
+	// 2. test without activation
+	// the namespace chain for x keeps the jumps for the cached policy in x
+	require.NoError(t, pMgr.AddPolicies([]*NPMNetworkPolicy{bothDirectionsNetPol}, nil))
+	otherPolicyInX := &NPMNetworkPolicy{
+		Namespace: "x",
+		PolicyKey: "x/test0",
+		ACLs:      []*ACLPolicy{ingressAllowedACL},
+	}
+	otherPolicyInXChain := otherPolicyInX.ingressChainName()
+	policies = []*NPMNetworkPolicy{otherPolicyInX, ingressNetPol, egressNetPol}
+	creator = pMgr.creatorForNewNftPolicies(policies)
+	actualLines = strings.Split(creator.ToString(), "\n")
+	expectedLines = []string{
+		// all chains
+		"add chain ip azure-npm " + otherPolicyInXChain,
+		"flush chain ip azure-npm " + otherPolicyInXChain,
+		"add chain ip azure-npm " + ingressNetPolChain,
+		"flush chain ip azure-npm " + ingressNetPolChain,
+		"add chain ip azure-npm " + egressNetPolChain,
+		"flush chain ip azure-npm " + egressNetPolChain,
+		// policies
+		fmt.Sprintf("add rule ip azure-npm %s %s", otherPolicyInXChain, nftIngressAllowRule),
+		fmt.Sprintf("add rule ip azure-npm %s %s", ingressNetPolChain, nftIngressDropRule),
+		fmt.Sprintf("add rule ip azure-npm %s %s", egressNetPolChain, nftEgressAllowRule),
+		// namespace x (sorted by policy key)
+		"add chain ip azure-npm " + nftIngressNSChainX,
+		"flush chain ip azure-npm " + nftIngressNSChainX,
+		"add chain ip azure-npm " + nftEgressNSChainX,
+		"flush chain ip azure-npm " + nftEgressNSChainX,
+		fmt.Sprintf("add rule ip azure-npm %s jump %s comment %q",
+			nftIngressNSChainX, otherPolicyInXChain, "INGRESS-POLICY-x/test0-TO-all-IN-ns-x"),
+		fmt.Sprintf("add rule ip azure-npm %s ip daddr @%s jump %s comment %q",
+			nftIngressNSChainX, ipsets.TestKeyPodSet.HashedName, bothDirectionsNetPolIngressChain, bothDirectionsNetPolIngressJumpComment),
+		fmt.Sprintf("add rule ip azure-npm %s ip saddr @%s jump %s comment %q",
+			nftEgressNSChainX, ipsets.TestKeyPodSet.HashedName, bothDirectionsNetPolEgressChain, bothDirectionsNetPolEgressJumpComment),
+		// namespace y
+		"add chain ip azure-npm " + nftIngressNSChainY,
+		"flush chain ip azure-npm " + nftIngressNSChainY,
+		"add chain ip azure-npm " + nftEgressNSChainY,
+		"flush chain ip azure-npm " + nftEgressNSChainY,
+		fmt.Sprintf("add rule ip azure-npm %s ip daddr @%s ip daddr @%s jump %s comment %q",
+			nftIngressNSChainY, ipsets.TestKeyPodSet.HashedName, ipsets.TestNSSet.HashedName, ingressNetPolChain, ingressNetPolJumpComment),
+		// namespace z
+		"add chain ip azure-npm " + nftIngressNSChainZ,
+		"flush chain ip azure-npm " + nftIngressNSChainZ,
+		"add chain ip azure-npm " + nftEgressNSChainZ,
+		"flush chain ip azure-npm " + nftEgressNSChainZ,
+		fmt.Sprintf("add rule ip azure-npm %s jump %s comment %q", nftEgressNSChainZ, egressNetPolChain, egressNetPolJumpComment),
+		"",
+	}
+	dptestutils.AssertEqualLines(t, expectedLines, actualLines)
+}
+
+func TestCreatorForRemoveNftPolicy(t *testing.T) {
+	calls := []testutils.TestCmd{fakeNftCommand, fakeNftCommand}
+	ioshim := common.NewMockIOShim(calls)
+	defer ioshim.VerifyCalls(t, calls)
+	pMgr := NewPolicyManager(ioshim, nftConfig)
+
+	require.NoError(t, pMgr.AddPolicies([]*NPMNetworkPolicy{bothDirectionsNetPol, egressNetPol}, nil))
+
+	// 1. test without deactivation
+	creator := pMgr.creatorForRemovingNftPolicy(bothDirectionsNetPol)
+	actualLines := strings.Split(creator.ToString(), "\n")
+	expectedLines := []string{
+		"add chain ip azure-npm " + nftIngressNSChainX,
+		"flush chain ip azure-npm " + nftIngressNSChainX,
+		"add chain ip azure-npm " + nftEgressNSChainX,
+		"flush chain ip azure-npm " + nftEgressNSChainX,
+		"add chain ip azure-npm " + bothDirectionsNetPolIngressChain,
+		"flush chain ip azure-npm " + bothDirectionsNetPolIngressChain,
+		"delete chain ip azure-npm " + bothDirectionsNetPolIngressChain,
+		"add chain ip azure-npm " + bothDirectionsNetPolEgressChain,
+		"flush chain ip azure-npm " + bothDirectionsNetPolEgressChain,
+		"delete chain ip azure-npm " + bothDirectionsNetPolEgressChain,
+		"",
+	}
+	dptestutils.AssertEqualLines(t, expectedLines, actualLines)
+
+	// 2. test with deactivation
+	require.NoError(t, pMgr.RemovePolicy(bothDirectionsNetPol.PolicyKey))
+	creator = pMgr.creatorForRemovingNftPolicy(egressNetPol)
+	actualLines = strings.Split(creator.ToString(), "\n")
+	expectedLines = []string{
+		"flush chain ip azure-npm AZURE-NPM",
+		"add chain ip azure-npm " + nftIngressNSChainZ,
+		"flush chain ip azure-npm " + nftIngressNSChainZ,
+		"add chain ip azure-npm " + nftEgressNSChainZ,
+		"flush chain ip azure-npm " + nftEgressNSChainZ,
+		"add chain ip azure-npm " + egressNetPolChain,
+		"flush chain ip azure-npm " + egressNetPolChain,
+		"delete chain ip azure-npm " + egressNetPolChain,
+		"",
+	}
+	dptestutils.AssertEqualLines(t, expectedLines, actualLines)
+}
+
+func TestNftCommentIsTruncated(t *testing.T) {
+	comment := nftComment(strings.Repeat("a", maxNftCommentLength+10))
+	require.Equal(t, fmt.Sprintf("comment %q", strings.Repeat("a", maxNftCommentLength)), comment)
+}
+
+func TestAddNftPolicyFailure(t *testing.T) {
+	calls := []testutils.TestCmd{
+		{Cmd: []string{"nft", "-f", "-"}, ExitCode: 1},
+		{Cmd: []string{"nft", "-f", "-"}, ExitCode: 1},
+	}
+	ioshim := common.NewMockIOShim(calls)
+	defer ioshim.VerifyCalls(t, calls)
+	pMgr := NewPolicyManager(ioshim, nftConfig)
+
+	require.Error(t, pMgr.AddPolicies([]*NPMNetworkPolicy{bothDirectionsNetPol}, nil))
+	require.False(t, pMgr.PolicyExists(bothDirectionsNetPol.PolicyKey))
+}
@@ -336,6 +336,11 @@ func (pMgr *PolicyManager) addPolicy(policy *NPMNetworkPolicy, endpointList map[
 	return nil
 }
 
+// removePolicyForEndpoints doesn't lock the cache, so that the locking of the update path is unchanged.
+func (pMgr *PolicyManager) removePolicyForEndpoints(policy *NPMNetworkPolicy, endpointList map[string]string) error {
+	return pMgr.removePolicy(policy, endpointList)
+}
+
 // removePolicy will remove the policy from the specified endpoints, or
 // if the endpointList is nil, then the policy will be removed from the PodEndpoints of the policy
 func (pMgr *PolicyManager) removePolicy(policy *NPMNetworkPolicy, endpointList map[string]string) error {
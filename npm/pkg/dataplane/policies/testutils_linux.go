@@ -83,6 +83,20 @@ func GetBootupTestCalls() []testutils.TestCmd {
 	return bootUp
 }
 
+// GetBPFBootupTestCalls cleans up iptables-nft and iptables-legacy when there are no NPM chains
+func GetBPFBootupTestCalls() []testutils.TestCmd {
+	calls := []testutils.TestCmd{}
+	for _, iptables := range []string{"iptables-nft", "iptables-legacy"} {
+		calls = append(calls,
+			testutils.TestCmd{Cmd: []string{iptables, "-w", "60", "-D", "FORWARD", "-j", "AZURE-NPM"}, ExitCode: 2},                                        //nolint // AZURE-NPM chain didn't exist
+			testutils.TestCmd{Cmd: []string{iptables, "-w", "60", "-D", "FORWARD", "-j", "AZURE-NPM", "-m", "conntrack", "--ctstate", "NEW"}, ExitCode: 2}, //nolint // AZURE-NPM chain didn't exist
+			testutils.TestCmd{Cmd: []string{iptables, "-w", "60", "-t", "filter", "-n", "-L"}, PipedToCommand: true},
+			testutils.TestCmd{Cmd: []string{"grep", "Chain AZURE-NPM"}, ExitCode: 1},
+		)
+	}
+	return calls
+}
+
 func getFakeDeleteJumpCommand(chainName, jumpRule string) testutils.TestCmd {
 	args := []string{"iptables-nft", "-w", "60", "-D", chainName}
 	args = append(args, strings.Split(jumpRule, " ")...)
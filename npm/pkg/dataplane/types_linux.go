@@ -1,8 +1,21 @@
 package dataplane
 
-// npmEndpoint holds info relevant for endpoints in windows
+// npmEndpoint holds info relevant for endpoints in Linux's BPF policy mode.
+// Endpoints are Pods on this node, and the endpoint ID is the Pod IP.
 type npmEndpoint struct {
+	ip     string
+	podKey string
+	// Map with Key as Network Policy name to to emulate set
+	// and value as struct{} for minimal memory consumption
 	netPolReference map[string]struct{}
 }
 
+func newNPMEndpoint(ip, podKey string) *npmEndpoint {
+	return &npmEndpoint{
+		ip:              ip,
+		podKey:          podKey,
+		netPolReference: make(map[string]struct{}),
+	}
+}
+
 type endpointQuery struct{}
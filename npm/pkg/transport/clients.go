@@ -0,0 +1,76 @@
+package transport
+
+import (
+	"time"
+
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/dpshim"
+)
+
+// clientState is the state of a datapath client which outlives its connections,
+// so that the client can resume from its last sequence number after reconnecting.
+type clientState struct {
+	// history holds the view of the client after each of the last events sent to it, oldest first
+	history []sentView
+	// lastSequence is the sequence number of the last event sent to the client.
+	// It never decreases, even when the history is dropped, so that a sequence number the client
+	// resumes from can't match a different event than the one the client received.
+	lastSequence uint64
+	// disconnectedAt is when the last connection of the client ended, or zero if the client is connected
+	disconnectedAt time.Time
+}
+
+// sentView is the view of a client after it processes the event with the sequence number
+type sentView struct {
+	sequence uint64
+	view     *dpshim.NodeView
+}
+
+func newClientState() *clientState {
+	return &clientState{}
+}
+
+// sequence returns the sequence number of the last event sent to the client, or 0 if none were sent
+func (s *clientState) sequence() uint64 {
+	return s.lastSequence
+}
+
+// view returns the view of the client after the last event sent to it, or nil if the client needs hydration
+func (s *clientState) view() *dpshim.NodeView {
+	if len(s.history) == 0 {
+		return nil
+	}
+	return s.history[len(s.history)-1].view
+}
+
+// resume drops the events after lastSequence which the client missed.
+// It returns false if the client can't resume, in which case the client needs hydration.
+// Sequence numbers keep increasing after the missed events, so they aren't reused for different events.
+func (s *clientState) resume(lastSequence uint64) bool {
+	if lastSequence != 0 {
+		for i := len(s.history) - 1; i >= 0; i-- {
+			if s.history[i].sequence == lastSequence {
+				s.history = s.history[:i+1]
+				return true
+			}
+		}
+	}
+
+	s.history = nil
+	// the state may have been pruned while the client was disconnected
+	if lastSequence > s.lastSequence {
+		s.lastSequence = lastSequence
+	}
+	return false
+}
+
+// sent records the view of the client after it processes the event with the next sequence number.
+// It returns the sequence number for the event.
+func (s *clientState) sent(view *dpshim.NodeView) uint64 {
+	s.lastSequence++
+	sequence := s.lastSequence
+	s.history = append(s.history, sentView{sequence: sequence, view: view})
+	if len(s.history) > maxResumeHistory {
+		s.history = s.history[len(s.history)-maxResumeHistory:]
+	}
+	return sequence
+}
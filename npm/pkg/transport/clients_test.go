@@ -0,0 +1,46 @@
+package transport
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/dpshim"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientStateResume(t *testing.T) {
+	state := newClientState()
+	require.False(t, state.resume(0), "a new client needs hydration")
+	require.Nil(t, state.view())
+
+	views := make([]*dpshim.NodeView, maxResumeHistory+2)
+	for i := range views {
+		views[i] = dpshim.NewNodeView()
+		views[i].Policies["ns/policy"] = uint64(i)
+		state.sent(views[i])
+	}
+	require.Equal(t, uint64(maxResumeHistory+2), state.sequence())
+	require.Equal(t, views[len(views)-1], state.view())
+
+	require.True(t, state.resume(state.sequence()), "should resume a client which received every event")
+	require.Equal(t, uint64(maxResumeHistory+2), state.sequence())
+
+	require.True(t, state.resume(10), "should resume a client which missed recent events")
+	require.Equal(t, views[9], state.view())
+	// the sequence numbers of the missed events aren't reused
+	require.Equal(t, uint64(maxResumeHistory+3), state.sent(views[10]))
+	require.False(t, state.resume(11), "should hydrate a client from a missed event")
+
+	require.False(t, state.resume(2), "should hydrate a client which missed too many events")
+	require.Nil(t, state.view())
+	require.Equal(t, uint64(maxResumeHistory+4), state.sent(views[0]))
+	require.False(t, state.resume(1), "should not resume from an event sent before hydration")
+
+	state.sent(views[0])
+	require.False(t, state.resume(0), "should hydrate a restarted client")
+	require.Nil(t, state.view())
+
+	// a client whose state was pruned is sent sequence numbers after its last one
+	state = newClientState()
+	require.False(t, state.resume(100))
+	require.Equal(t, uint64(101), state.sent(views[0]))
+}
@@ -1,6 +1,13 @@
 package transport
 
+import "time"
+
 const (
 	// concurrentInputRegistrations = 10
 	grpcMaxConcurrentStreams = 100
+
+	// maxResumeHistory is the number of sent events a client can miss and still resume from its last sequence number
+	maxResumeHistory = 32
+	// clientStateTTL is how long the state of a disconnected client is kept for it to resume
+	clientStateTTL = 10 * time.Minute
 )
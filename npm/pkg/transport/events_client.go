@@ -89,7 +89,8 @@ func (c *EventsClient) run(ctx context.Context, stopCh <-chan struct{}) error {
 			return nil
 		default:
 			if connectClient == nil {
-				klog.Info("Reconnecting to gRPC server controller")
+				// resume from the last event received, so that the controller only sends what changed since then
+				klog.Infof("Reconnecting to gRPC server controller from sequence %d", clientMetadata.LastSequence)
 				opts := []grpc.CallOption{grpc.WaitForReady(false)}
 				connectClient, err = c.Connect(ctx, clientMetadata, opts...)
 				if err != nil {
@@ -105,6 +106,7 @@ func (c *EventsClient) run(ctx context.Context, stopCh <-chan struct{}) error {
 			}
 			klog.Infof("### Received event: %v", event)
 			c.outCh <- event
+			clientMetadata.LastSequence = event.GetSequence()
 		}
 	}
 }
@@ -4,12 +4,15 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"time"
 
+	"github.com/Azure/azure-container-networking/npm/metrics"
 	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/dpshim"
 	"github.com/Azure/azure-container-networking/npm/pkg/protos"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/stats"
+	"google.golang.org/protobuf/proto"
 	"k8s.io/klog/v2"
 )
 
@@ -27,6 +30,9 @@ type EventsServer struct {
 	// Registrations is a map of dataplane pod address to their associate connection stream
 	Registrations map[string]clientStreamConnection
 
+	// clients is a map of dataplane pod name to the state of the client across its connections
+	clients map[string]*clientState
+
 	// port is the port the manager is listening on
 	port int
 
@@ -59,6 +65,7 @@ func NewEventsServer(ctx context.Context, port int, dp *dpshim.DPShim) *EventsSe
 		Server:        NewServer(ctx, regCh),
 		Watchdog:      NewWatchdog(deregCh),
 		Registrations: make(map[string]clientStreamConnection),
+		clients:       make(map[string]*clientState),
 		port:          port,
 		inCh:          dp.OutChannel,
 		errCh:         make(chan error),
@@ -88,55 +95,22 @@ func (m *EventsServer) start(stopCh <-chan struct{}) error {
 		return fmt.Errorf("failed to start transport manager handlers: %w", err)
 	}
 
+	pruneTicker := time.NewTicker(clientStateTTL)
+	defer pruneTicker.Stop()
+
 	for {
 		select {
 		case client := <-m.regCh:
-			// (TODO) Hydration is a very expensive event, so we want to make sure
-			// that pagination is done for large clusters. In case of a daemon restart in a large cluster
-			// we should be able to hydrate daemon in multiple phases,
-			// 1. 1st Level IPSets
-			// 2. Nested IPSets
-			// 3. Network Policies
-			// within the same castegory we will have to paginate.
-			klog.Infof("Registering remote client %s", client)
-			m.Registrations[client.String()] = client
-			event, err := m.dp.HydrateClients()
-			if err != nil {
-				klog.Errorf("Failed to hydrate client %s: %v", client, err)
-			}
-			// (TODO) Hydration event takes a lock of whole DPShim instance, essentially blocking the
-			// controllers from receiving any more new events or servicing existing daemons.
-			// So we will need to add a buffering mechanism to wait until either we have a N number of daemons
-			// or hit S milliseconds of wait time and send huydration event to all the buffered daemons.
-			go func() {
-				klog.Infof("Hydrating remote client %s", client)
-				if err := client.stream.SendMsg(event); err != nil {
-					klog.Errorf("Failed to hydrate client %s: %v", client, err)
-				}
-			}()
+			m.register(client)
 		case ev := <-m.deregCh:
-			// (TODO) A heart beat for each daemon should also be added alongside watchdog to monitor
-			// daemon restarts and then if that fails, we will need to delete the client.
-			klog.Infof("Degregistering remote client %s", ev.remoteAddr)
-			if v, ok := m.Registrations[ev.remoteAddr]; ok {
-				if v.timestamp <= ev.timestamp {
-					klog.Infof("Deregistering remote client %s", ev.remoteAddr)
-					delete(m.Registrations, ev.remoteAddr)
-				} else {
-					klog.Info("Ignoring stale deregistration event")
-				}
-			}
-		case msg := <-m.inCh:
+			m.deregister(ev)
+		case <-m.inCh:
+			// The event only signals that the goal state changed.
+			// Each client is sent the changes relevant to its node since the last event it was sent.
 			klog.Infof("######## Received event to broadcast ######")
-			for clientName, client := range m.Registrations {
-				// (TODO) Should we call this SendMsg per client in a separate go routine?
-				klog.Infof("######## Servicing the event to %s ######", clientName)
-				if err := client.stream.SendMsg(msg); err != nil {
-					// (TODO) What happens if a portion of the clients fails?
-					// there should be a mechanism to retry the failed clients.
-					klog.Errorf("Failed to send message to client %s: %v", client, err)
-				}
-			}
+			m.broadcast()
+		case <-pruneTicker.C:
+			m.pruneClients(time.Now())
 		case <-m.ctx.Done():
 			klog.Info("Context Done. Stopping transport manager")
 			return nil
@@ -150,6 +124,118 @@ func (m *EventsServer) start(stopCh <-chan struct{}) error {
 	}
 }
 
+// register adds the client's connection and sends the client the goal state of its node.
+// A client which reconnects with the sequence number of an event it was recently sent is only sent what changed since that event,
+// otherwise the client is hydrated with the whole goal state of its node.
+func (m *EventsServer) register(client clientStreamConnection) {
+	klog.Infof("Registering remote client %s", client)
+	podName := client.GetPodName()
+	// a reconnecting client may still be registered with the address of its previous connection
+	for addr, registration := range m.Registrations {
+		if addr != client.String() && registration.GetPodName() == podName {
+			klog.Infof("Replacing registration %s of client %s", addr, podName)
+			delete(m.Registrations, addr)
+		}
+	}
+	m.Registrations[client.String()] = client
+
+	state, ok := m.clients[podName]
+	if !ok {
+		state = newClientState()
+		m.clients[podName] = state
+	}
+	state.disconnectedAt = time.Time{}
+
+	resumed := state.resume(client.GetLastSequence())
+	metrics.IncTransportReconnects(resumed)
+	if resumed {
+		klog.Infof("Resuming remote client %s from sequence %d", client, client.GetLastSequence())
+	} else {
+		// (TODO) Hydration is a very expensive event, so we want to make sure
+		// that pagination is done for large clusters. In case of a daemon restart in a large cluster
+		// we should be able to hydrate daemon in multiple phases,
+		// 1. 1st Level IPSets
+		// 2. Nested IPSets
+		// 3. Network Policies
+		// within the same castegory we will have to paginate.
+		klog.Infof("Hydrating remote client %s", client)
+	}
+
+	m.sendGoalState(client, state)
+}
+
+// deregister removes the client's connection unless the client has reconnected since the connection ended.
+func (m *EventsServer) deregister(ev deregistrationEvent) {
+	// (TODO) A heart beat for each daemon should also be added alongside watchdog to monitor
+	// daemon restarts and then if that fails, we will need to delete the client.
+	klog.Infof("Degregistering remote client %s", ev.remoteAddr)
+	v, ok := m.Registrations[ev.remoteAddr]
+	if !ok {
+		return
+	}
+	if v.timestamp > ev.timestamp {
+		klog.Info("Ignoring stale deregistration event")
+		return
+	}
+
+	klog.Infof("Deregistering remote client %s", ev.remoteAddr)
+	delete(m.Registrations, ev.remoteAddr)
+	if state, ok := m.clients[v.GetPodName()]; ok {
+		state.disconnectedAt = time.Now()
+	}
+}
+
+// broadcast sends each registered client the changes to the goal state of its node.
+func (m *EventsServer) broadcast() {
+	for clientName, client := range m.Registrations {
+		state, ok := m.clients[client.GetPodName()]
+		if !ok {
+			continue
+		}
+		klog.Infof("######## Servicing the event to %s ######", clientName)
+		m.sendGoalState(client, state)
+	}
+}
+
+// sendGoalState sends the client the changes to the goal state of its node since the last event it was sent.
+// If the send fails, the changes will be sent again with the next event.
+func (m *EventsServer) sendGoalState(client clientStreamConnection, state *clientState) {
+	podName := client.GetPodName()
+	event, view, err := m.dp.NodeGoalState(client.GetNodeName(), state.view())
+	if err != nil {
+		klog.Errorf("Failed to get goal state of node %s for client %s: %v", client.GetNodeName(), client, err)
+		return
+	}
+	if event == nil {
+		return
+	}
+
+	event.Sequence = state.sequence() + 1
+	// (TODO) Should we call this SendMsg per client in a separate go routine?
+	if err := client.stream.SendMsg(event); err != nil {
+		// (TODO) What happens if a portion of the clients fails?
+		// there should be a mechanism to retry the failed clients.
+		klog.Errorf("Failed to send message to client %s: %v", client, err)
+		metrics.IncTransportSendFailures(podName)
+		return
+	}
+
+	state.sent(view)
+	metrics.RecordTransportEventSent(podName, event.GetEventType().String(), proto.Size(event))
+}
+
+// pruneClients removes the state of clients which have been disconnected for longer than clientStateTTL.
+func (m *EventsServer) pruneClients(now time.Time) {
+	for podName, state := range m.clients {
+		if state.disconnectedAt.IsZero() || now.Sub(state.disconnectedAt) < clientStateTTL {
+			continue
+		}
+		klog.Infof("Removing state of client %s which disconnected at %s", podName, state.disconnectedAt)
+		delete(m.clients, podName)
+		metrics.DeleteTransportClient(podName)
+	}
+}
+
 func (m *EventsServer) handle() error {
 	klog.Infof("Starting transport manager listener on port %v", m.port)
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", m.port))
@@ -0,0 +1,186 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/npm/metrics"
+	"github.com/Azure/azure-container-networking/npm/pkg/controlplane"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/dpshim"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/ipsets"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/policies"
+	"github.com/Azure/azure-container-networking/npm/pkg/protos"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+var errStreamClosed = errors.New("stream closed")
+
+var (
+	testNSSet  = ipsets.NewIPSetMetadata("ns1", ipsets.Namespace)
+	testAppSet = ipsets.NewIPSetMetadata("app:a", ipsets.KeyValueLabelOfPod)
+)
+
+// fakeStream records the events sent to a client
+type fakeStream struct {
+	grpc.ServerStream
+	events []*protos.Events
+	closed bool
+}
+
+func (s *fakeStream) Send(event *protos.Events) error {
+	return s.SendMsg(event)
+}
+
+func (s *fakeStream) SendMsg(m interface{}) error {
+	if s.closed {
+		return errStreamClosed
+	}
+	s.events = append(s.events, m.(*protos.Events))
+	return nil
+}
+
+func newTestServer(t *testing.T) (*EventsServer, *dpshim.DPShim) {
+	t.Helper()
+	metrics.ReinitializeAll()
+
+	dp, err := dpshim.NewDPSim(nil)
+	require.NoError(t, err)
+	require.NoError(t, dp.AddToSets([]*ipsets.IPSetMetadata{testNSSet, testAppSet}, dataplane.NewPodMetadata("ns1/a", "10.0.0.1", "node1")))
+	require.NoError(t, dp.UpdatePolicy(&policies.NPMNetworkPolicy{
+		Namespace:         "ns1",
+		PolicyKey:         "ns1/policy",
+		PodSelectorIPSets: []*ipsets.TranslatedIPSet{{Metadata: testNSSet}, {Metadata: testAppSet}},
+	}))
+
+	return NewEventsServer(context.Background(), 0, dp), dp
+}
+
+func newTestClient(pod, node, addr string, lastSequence uint64) (clientStreamConnection, *fakeStream) {
+	stream := &fakeStream{}
+	return clientStreamConnection{
+		stream: stream,
+		DatapathPodMetadata: &protos.DatapathPodMetadata{
+			PodName:      pod,
+			NodeName:     node,
+			LastSequence: lastSequence,
+		},
+		addr:      addr,
+		timestamp: time.Now().Unix(),
+	}, stream
+}
+
+func TestRegisterFiltersByNode(t *testing.T) {
+	m, _ := newTestServer(t)
+
+	client1, stream1 := newTestClient("npm-1", "node1", "10.1.0.1:5000", 0)
+	m.register(client1)
+	require.Len(t, stream1.events, 1)
+	require.Equal(t, protos.Events_Hydration, stream1.events[0].GetEventType())
+	require.Equal(t, uint64(1), stream1.events[0].GetSequence())
+	require.Contains(t, stream1.events[0].GetPayload(), controlplane.PolicyApply)
+
+	client2, stream2 := newTestClient("npm-2", "node2", "10.1.0.2:5000", 0)
+	m.register(client2)
+	require.Empty(t, stream2.events, "no policies select a pod on node2")
+
+	count, err := metrics.TotalTransportEventsSent("npm-1", protos.Events_Hydration.String())
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	bytes, err := metrics.TotalTransportBytesSent("npm-1")
+	require.NoError(t, err)
+	require.Greater(t, bytes, 0)
+	hydrations, err := metrics.TotalTransportReconnects(false)
+	require.NoError(t, err)
+	require.Equal(t, 2, hydrations)
+}
+
+func TestBroadcastSendsDeltas(t *testing.T) {
+	m, dp := newTestServer(t)
+
+	client1, stream1 := newTestClient("npm-1", "node1", "10.1.0.1:5000", 0)
+	m.register(client1)
+	client2, stream2 := newTestClient("npm-2", "node2", "10.1.0.2:5000", 0)
+	m.register(client2)
+
+	// a pod on node2 is selected by the policy
+	require.NoError(t, dp.AddToSets([]*ipsets.IPSetMetadata{testNSSet, testAppSet}, dataplane.NewPodMetadata("ns1/b", "10.0.0.2", "node2")))
+	require.NoError(t, dp.ApplyDataPlane())
+	m.broadcast()
+
+	require.Len(t, stream1.events, 2)
+	require.Equal(t, protos.Events_GoalState, stream1.events[1].GetEventType())
+	require.Equal(t, uint64(2), stream1.events[1].GetSequence())
+	require.Contains(t, stream1.events[1].GetPayload(), controlplane.IpsetApply)
+	require.NotContains(t, stream1.events[1].GetPayload(), controlplane.PolicyApply, "node1 already has the policy")
+
+	require.Len(t, stream2.events, 1)
+	require.Equal(t, protos.Events_Hydration, stream2.events[0].GetEventType())
+	require.Contains(t, stream2.events[0].GetPayload(), controlplane.PolicyApply)
+
+	// nothing changed
+	m.broadcast()
+	require.Len(t, stream1.events, 2)
+	require.Len(t, stream2.events, 1)
+}
+
+func TestReconnectResumesFromSequence(t *testing.T) {
+	m, dp := newTestServer(t)
+
+	client, stream := newTestClient("npm-1", "node1", "10.1.0.1:5000", 0)
+	m.register(client)
+	require.Len(t, stream.events, 1)
+
+	// the client disconnects and misses an update
+	stream.closed = true
+	require.NoError(t, dp.AddToSets([]*ipsets.IPSetMetadata{testNSSet}, dataplane.NewPodMetadata("ns1/b", "10.0.0.2", "node2")))
+	require.NoError(t, dp.ApplyDataPlane())
+	m.broadcast()
+	failures, err := metrics.TotalTransportSendFailures("npm-1")
+	require.NoError(t, err)
+	require.Equal(t, 1, failures)
+
+	m.deregister(deregistrationEvent{remoteAddr: client.String(), timestamp: time.Now().Unix()})
+	require.Empty(t, m.Registrations)
+
+	// the client resumes from the last event it received on a new connection
+	client, stream = newTestClient("npm-1", "node1", "10.1.0.1:5001", 1)
+	m.register(client)
+	require.Len(t, stream.events, 1)
+	require.Equal(t, protos.Events_GoalState, stream.events[0].GetEventType())
+	require.Equal(t, uint64(2), stream.events[0].GetSequence())
+	require.Contains(t, stream.events[0].GetPayload(), controlplane.IpsetApply)
+	require.NotContains(t, stream.events[0].GetPayload(), controlplane.PolicyApply)
+	resumes, err := metrics.TotalTransportReconnects(true)
+	require.NoError(t, err)
+	require.Equal(t, 1, resumes)
+
+	// a client with an unknown sequence number is hydrated
+	client, stream = newTestClient("npm-1", "node1", "10.1.0.1:5002", 5)
+	m.register(client)
+	require.Len(t, m.Registrations, 1, "should replace the registration of the previous connection")
+	require.Len(t, stream.events, 1)
+	require.Equal(t, protos.Events_Hydration, stream.events[0].GetEventType())
+	// sequence numbers continue after the client's, so its stale sequence number can't match a later event
+	require.Equal(t, uint64(6), stream.events[0].GetSequence())
+}
+
+func TestPruneClients(t *testing.T) {
+	m, _ := newTestServer(t)
+
+	client, _ := newTestClient("npm-1", "node1", "10.1.0.1:5000", 0)
+	m.register(client)
+	m.deregister(deregistrationEvent{remoteAddr: client.String(), timestamp: time.Now().Unix()})
+
+	m.pruneClients(time.Now())
+	require.Contains(t, m.clients, "npm-1", "should keep the state for the client to resume")
+
+	m.pruneClients(time.Now().Add(clientStateTTL))
+	require.NotContains(t, m.clients, "npm-1")
+	bytes, err := metrics.TotalTransportBytesSent("npm-1")
+	require.NoError(t, err)
+	require.Equal(t, 0, bytes)
+}
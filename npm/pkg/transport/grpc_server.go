@@ -54,7 +54,10 @@ func (d *DataplaneEventsServer) Connect(m *protos.DatapathPodMetadata, stream pr
 	d.regCh <- conn
 
 	// This should block until the client disconnects
-	<-d.ctx.Done()
+	select {
+	case <-stream.Context().Done():
+	case <-d.ctx.Done():
+	}
 
 	return nil
 }
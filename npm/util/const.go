@@ -204,6 +204,35 @@ const (
 	SetPolicyDelimiter string = ","
 )
 
+// nftables related constants.
+// These are only used when NPM programs nftables natively instead of through iptables and ipset.
+const (
+	Nft          string = "nft"
+	NftFileFlag  string = "-f"
+	NftStdinFile string = "-"
+
+	NftFamily     string = "ip"
+	NftAzureTable string = "azure-npm"
+
+	// NftForwardChain is the base chain hooked into netfilter's forward hook.
+	NftForwardChain string = "FORWARD"
+	// NftPriorityFirst and NftPriorityAfterKube place the base chain before or after iptables-nft's filter FORWARD chain (priority 0).
+	NftPriorityFirst     string = "-10"
+	NftPriorityAfterKube string = "10"
+
+	// verdict maps keyed by Pod IP which jump to the chain of the Pod's namespace
+	NftIngressDispatchMap string = "AZURE-NPM-INGRESS-DISPATCH"
+	NftEgressDispatchMap  string = "AZURE-NPM-EGRESS-DISPATCH"
+
+	NftIngressNamespaceChainPrefix string = "AZURE-NPM-INGRESS-NS"
+	NftEgressNamespaceChainPrefix  string = "AZURE-NPM-EGRESS-NS"
+
+	// marks in native nftables mode (same bits as NPM v2 iptables marks)
+	NftIngressAllowMark string = "0x200"
+	NftIngressDropMark  string = "0x400"
+	NftEgressDropMark   string = "0x800"
+)
+
 const (
 	BashCommand     string = "bash"
 	BashCommandFlag string = "-c"
@@ -164,6 +164,11 @@ func GetHashedName(name string) string {
 	return AzureNpmPrefix + Hash(name)
 }
 
+// NftNamespaceChainName returns the name of the nftables chain holding the jumps to policy chains for a namespace.
+func NftNamespaceChainName(prefix, namespace string) string {
+	return prefix + "-" + Hash(namespace)
+}
+
 // CompareK8sVer compares two k8s versions.
 // returns -1, 0, 1 if firstVer smaller, equals, bigger than secondVer respectively.
 // returns -2 for error.
@@ -16,6 +16,13 @@ type TlsSettings struct {
 	UseMTLS                            bool
 	MinTLSVersion                      string
 	MtlsClientCertSubjectName          string
+	// CertificateExpiryWarningThreshold is how long before its expiration a certificate which hasn't been rotated
+	// is warned about. Zero disables the warnings.
+	CertificateExpiryWarningThreshold time.Duration
+	// SPIFFEWorkloadAPIAddress is the address of the SPIFFE Workload API serving the X509-SVID for mTLS.
+	SPIFFEWorkloadAPIAddress string
+	// MtlsAllowedClientSPIFFEIDs are the SPIFFE IDs allowed to connect over mTLS, instead of MtlsClientCertSubjectName.
+	MtlsAllowedClientSPIFFEIDs []string
 }
 
 func GetTlsCertificateRetriever(settings TlsSettings) (TlsCertificateRetriever, error) {
@@ -0,0 +1,56 @@
+// Copyright Microsoft. All rights reserved.
+// MIT License
+
+package telemetry
+
+// Sink receives the reports and metrics sent by CNI to the telemetry service.
+// Sinks are called in the order reports are received, so they must not block.
+type Sink interface {
+	SendReport(report CNIReport)
+	SendMetric(metric AIMetric)
+	// Close flushes anything buffered by the sink and releases its resources.
+	Close()
+}
+
+// SinkConfig configures the sinks the telemetry service sends to in addition to Application Insights.
+type SinkConfig struct {
+	// PrometheusAddress is the address CNI metrics are served on at /metrics, e.g. ":10093".
+	// The Prometheus sink is disabled if empty.
+	PrometheusAddress string `json:"prometheusAddress,omitempty"`
+	// OTLPEndpoint is the base URL of an OTLP/HTTP collector, e.g. http://localhost:4318.
+	// Reports are exported as logs to /v1/logs, and metrics to /v1/metrics.
+	// The OTLP sink is disabled if empty.
+	OTLPEndpoint string `json:"otlpEndpoint,omitempty"`
+	// OTLPHeaders are added to each export request, e.g. for authentication.
+	OTLPHeaders map[string]string `json:"otlpHeaders,omitempty"`
+}
+
+// aiSink sends reports and metrics to Application Insights once an AI telemetry handle is created.
+type aiSink struct{}
+
+func (aiSink) SendReport(report CNIReport) {
+	SendAITelemetry(report)
+}
+
+func (aiSink) SendMetric(metric AIMetric) {
+	SendAIMetric(metric)
+}
+
+// Close does nothing, since the AI telemetry handle is closed with CloseAITelemetryHandle.
+func (aiSink) Close() {}
+
+// AddSink adds a sink which receives the reports received by the server.
+func (tb *TelemetryBuffer) AddSink(sink Sink) {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+	tb.sinks = append(tb.sinks, sink)
+}
+
+// closeSinks closes the sinks of the server.
+func (tb *TelemetryBuffer) closeSinks() {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+	for _, sink := range tb.sinks {
+		sink.Close()
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright Microsoft. All rights reserved.
+// MIT License
+
+package sinks
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/Azure/azure-container-networking/telemetry"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/metric"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+const (
+	instrumentationName = "github.com/Azure/azure-container-networking/telemetry"
+	logsPath            = "/v1/logs"
+	metricsURLPath      = "/v1/metrics"
+)
+
+// OTLPSink exports reports as OTLP logs, and the durations and errors of CNI commands as OTLP metrics.
+type OTLPSink struct {
+	loggerProvider    *sdklog.LoggerProvider
+	meterProvider     *sdkmetric.MeterProvider
+	logger            log.Logger
+	operationDuration metric.Float64Histogram
+	operationErrors   metric.Int64Counter
+}
+
+// NewOTLPSink returns an OTLPSink which exports to the OTLP/HTTP collector at endpoint.
+func NewOTLPSink(ctx context.Context, endpoint string, headers map[string]string) (*OTLPSink, error) {
+	base, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse OTLP endpoint %s", endpoint)
+	}
+	res := resource.NewSchemaless(attribute.String("service.name", serviceName))
+
+	logOpts := []otlploghttp.Option{otlploghttp.WithEndpointURL(base.JoinPath(logsPath).String())}
+	metricOpts := []otlpmetrichttp.Option{otlpmetrichttp.WithEndpointURL(base.JoinPath(metricsURLPath).String())}
+	if len(headers) > 0 {
+		logOpts = append(logOpts, otlploghttp.WithHeaders(headers))
+		metricOpts = append(metricOpts, otlpmetrichttp.WithHeaders(headers))
+	}
+
+	logExporter, err := otlploghttp.New(ctx, logOpts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create OTLP log exporter")
+	}
+	metricExporter, err := otlpmetrichttp.New(ctx, metricOpts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create OTLP metric exporter")
+	}
+
+	s := &OTLPSink{
+		loggerProvider: sdklog.NewLoggerProvider(
+			sdklog.WithResource(res),
+			sdklog.WithProcessor(sdklog.NewBatchProcessor(logExporter)),
+		),
+		meterProvider: sdkmetric.NewMeterProvider(
+			sdkmetric.WithResource(res),
+			sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)),
+		),
+	}
+	s.logger = s.loggerProvider.Logger(instrumentationName)
+
+	meter := s.meterProvider.Meter(instrumentationName)
+	if s.operationDuration, err = meter.Float64Histogram("cni.operation.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of CNI commands."),
+		//nolint:gomnd // 50 ms to ~100 s, as in the Prometheus sink
+		metric.WithExplicitBucketBoundaries(0.05, 0.1, 0.2, 0.4, 0.8, 1.6, 3.2, 6.4, 12.8, 25.6, 51.2, 102.4),
+	); err != nil {
+		return nil, errors.Wrap(err, "failed to create operation duration histogram")
+	}
+	if s.operationErrors, err = meter.Int64Counter("cni.operation.errors",
+		metric.WithDescription("Number of CNI commands which failed."),
+	); err != nil {
+		return nil, errors.Wrap(err, "failed to create operation errors counter")
+	}
+
+	return s, nil
+}
+
+func (s *OTLPSink) SendReport(report telemetry.CNIReport) {
+	msg, ok := reportMessage(report)
+	if !ok {
+		return
+	}
+
+	var record log.Record
+	record.SetTimestamp(time.Now())
+	record.SetBody(log.StringValue(msg))
+	if report.ErrorMessage != "" {
+		record.SetSeverity(log.SeverityError)
+	} else {
+		record.SetSeverity(log.SeverityInfo)
+	}
+	record.AddAttributes(
+		log.String(telemetry.ContextStr, report.Context),
+		log.String(telemetry.SubContextStr, report.SubContext),
+		log.String(telemetry.OperationTypeStr, report.OperationType),
+		log.String(telemetry.VersionStr, report.Version),
+		log.String(telemetry.VMUptimeStr, report.VMUptime),
+		log.String("ContainerName", report.ContainerName),
+	)
+	s.logger.Emit(context.Background(), record)
+}
+
+func (s *OTLPSink) SendMetric(aiMetric telemetry.AIMetric) {
+	sample, ok := newOperationSample(aiMetric)
+	if !ok {
+		return
+	}
+	ctx := context.Background()
+	s.operationDuration.Record(ctx, sample.duration.Seconds(), metric.WithAttributes(
+		attribute.String(operationLabel, sample.operation),
+		attribute.String(statusLabel, sample.status),
+	))
+	if sample.failed() {
+		s.operationErrors.Add(ctx, 1, metric.WithAttributes(attribute.String(operationLabel, sample.operation)))
+	}
+}
+
+// Close exports the logs and metrics which haven't been exported yet.
+func (s *OTLPSink) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	_ = s.loggerProvider.Shutdown(ctx)
+	_ = s.meterProvider.Shutdown(ctx)
+}
@@ -0,0 +1,137 @@
+package sinks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/telemetry"
+	"github.com/stretchr/testify/require"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// collector is an in-process OTLP/HTTP collector which records the logs and metrics exported to it.
+type collector struct {
+	*httptest.Server
+	sync.Mutex
+	logs    []*logspb.LogRecord
+	metrics []*metricspb.Metric
+	headers []http.Header
+}
+
+func newCollector(t *testing.T) *collector {
+	c := &collector{}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var resp proto.Message
+		c.Lock()
+		defer c.Unlock()
+		switch r.URL.Path {
+		case logsPath:
+			var req collogspb.ExportLogsServiceRequest
+			if err := proto.Unmarshal(body, &req); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			for _, resourceLogs := range req.GetResourceLogs() {
+				for _, scopeLogs := range resourceLogs.GetScopeLogs() {
+					c.logs = append(c.logs, scopeLogs.GetLogRecords()...)
+				}
+			}
+			resp = &collogspb.ExportLogsServiceResponse{}
+		case metricsURLPath:
+			var req colmetricspb.ExportMetricsServiceRequest
+			if err := proto.Unmarshal(body, &req); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			for _, resourceMetrics := range req.GetResourceMetrics() {
+				for _, scopeMetrics := range resourceMetrics.GetScopeMetrics() {
+					c.metrics = append(c.metrics, scopeMetrics.GetMetrics()...)
+				}
+			}
+			resp = &colmetricspb.ExportMetricsServiceResponse{}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		c.headers = append(c.headers, r.Header.Clone())
+
+		b, _ := proto.Marshal(resp)
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		_, _ = w.Write(b)
+	}))
+	t.Cleanup(c.Close)
+	return c
+}
+
+func (c *collector) metric(t *testing.T, name string) *metricspb.Metric {
+	t.Helper()
+	c.Lock()
+	defer c.Unlock()
+	for _, m := range c.metrics {
+		if m.GetName() == name {
+			return m
+		}
+	}
+	require.FailNowf(t, "metric not exported", "no metric named %q", name)
+	return nil
+}
+
+func TestOTLPSink(t *testing.T) {
+	c := newCollector(t)
+
+	s, err := NewOTLPSink(context.Background(), c.URL, map[string]string{"authorization": "token"})
+	require.NoError(t, err)
+
+	s.SendReport(telemetry.CNIReport{EventMessage: "ADD command completed", Context: "AzureCNI", ContainerName: "pod"})
+	s.SendReport(telemetry.CNIReport{ErrorMessage: "failed to allocate IP"})
+	s.SendReport(telemetry.CNIReport{})
+	s.SendMetric(operationMetric(telemetry.CNIAddTimeMetricStr, 120, telemetry.SucceededStr))
+	s.SendMetric(operationMetric(telemetry.CNIAddTimeMetricStr, 3000, telemetry.FailedStr))
+	s.SendMetric(operationMetric("SomeOtherMetric", 1, telemetry.FailedStr))
+	s.Close()
+
+	c.Lock()
+	logs := c.logs
+	for _, h := range c.headers {
+		require.Equal(t, "token", h.Get("authorization"))
+	}
+	c.Unlock()
+
+	require.Len(t, logs, 2)
+	require.Equal(t, "ADD command completed", logs[0].GetBody().GetStringValue())
+	require.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_INFO, logs[0].GetSeverityNumber())
+	attrs := map[string]string{}
+	for _, attr := range logs[0].GetAttributes() {
+		attrs[attr.GetKey()] = attr.GetValue().GetStringValue()
+	}
+	require.Equal(t, "AzureCNI", attrs[telemetry.ContextStr])
+	require.Equal(t, "pod", attrs["ContainerName"])
+	require.Equal(t, "failed to allocate IP", logs[1].GetBody().GetStringValue())
+	require.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_ERROR, logs[1].GetSeverityNumber())
+
+	duration := c.metric(t, "cni.operation.duration").GetHistogram()
+	require.Len(t, duration.GetDataPoints(), 2)
+	for _, dp := range duration.GetDataPoints() {
+		require.Equal(t, uint64(1), dp.GetCount())
+	}
+
+	errs := c.metric(t, "cni.operation.errors").GetSum()
+	require.Len(t, errs.GetDataPoints(), 1)
+	require.Equal(t, int64(1), errs.GetDataPoints()[0].GetAsInt())
+	require.Equal(t, operationLabel, errs.GetDataPoints()[0].GetAttributes()[0].GetKey())
+	require.Equal(t, operationAdd, errs.GetDataPoints()[0].GetAttributes()[0].GetValue().GetStringValue())
+}
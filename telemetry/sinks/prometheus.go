@@ -0,0 +1,139 @@
+// Copyright Microsoft. All rights reserved.
+// MIT License
+
+package sinks
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-container-networking/telemetry"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+const (
+	metricsNamespace = "cni"
+	metricsPath      = "/metrics"
+
+	operationLabel  = "operation"
+	statusLabel     = "status"
+	reportTypeLabel = "type"
+
+	reportTypeEvent = "event"
+	reportTypeError = "error"
+
+	readHeaderTimeout = 5 * time.Second
+	shutdownTimeout   = 5 * time.Second
+)
+
+// PrometheusSink exposes the durations and errors of CNI commands as Prometheus metrics.
+type PrometheusSink struct {
+	registry          *prometheus.Registry
+	operationDuration *prometheus.HistogramVec
+	operationErrors   *prometheus.CounterVec
+	reports           *prometheus.CounterVec
+	server            *http.Server
+	logger            *zap.Logger
+}
+
+// NewPrometheusSink returns a PrometheusSink with its own registry, so only CNI metrics are exposed.
+func NewPrometheusSink(logger *zap.Logger) *PrometheusSink {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	s := &PrometheusSink{
+		logger:   logger,
+		registry: prometheus.NewRegistry(),
+		operationDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: metricsNamespace,
+				Name:      "operation_duration_seconds",
+				Help:      "Duration of CNI commands.",
+				//nolint:gomnd // 50 ms to ~100 s
+				Buckets: prometheus.ExponentialBuckets(0.05, 2, 12),
+			},
+			[]string{operationLabel, statusLabel},
+		),
+		operationErrors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: metricsNamespace,
+				Name:      "operation_errors_total",
+				Help:      "Number of CNI commands which failed.",
+			},
+			[]string{operationLabel},
+		),
+		reports: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: metricsNamespace,
+				Name:      "reports_total",
+				Help:      "Number of event and error reports sent by CNI.",
+			},
+			[]string{reportTypeLabel},
+		),
+	}
+	s.registry.MustRegister(s.operationDuration, s.operationErrors, s.reports)
+	return s
+}
+
+// Handler returns the handler which serves the metrics in the Prometheus exposition format.
+func (s *PrometheusSink) Handler() http.Handler {
+	return promhttp.HandlerFor(s.registry, promhttp.HandlerOpts{})
+}
+
+// Serve serves the metrics at /metrics on addr until the sink is closed.
+func (s *PrometheusSink) Serve(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Wrapf(err, "failed to listen on %s", addr)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, s.Handler())
+	s.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("Prometheus sink stopped serving", zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+func (s *PrometheusSink) SendReport(report telemetry.CNIReport) {
+	if _, ok := reportMessage(report); !ok {
+		return
+	}
+	reportType := reportTypeEvent
+	if report.ErrorMessage != "" {
+		reportType = reportTypeError
+	}
+	s.reports.WithLabelValues(reportType).Inc()
+}
+
+func (s *PrometheusSink) SendMetric(metric telemetry.AIMetric) {
+	sample, ok := newOperationSample(metric)
+	if !ok {
+		return
+	}
+	s.operationDuration.WithLabelValues(sample.operation, sample.status).Observe(sample.duration.Seconds())
+	if sample.failed() {
+		s.operationErrors.WithLabelValues(sample.operation).Inc()
+	}
+}
+
+// Close stops serving the metrics.
+func (s *PrometheusSink) Close() {
+	if s.server == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	_ = s.server.Shutdown(ctx)
+}
@@ -0,0 +1,64 @@
+package sinks
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/aitelemetry"
+	"github.com/Azure/azure-container-networking/telemetry"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func operationMetric(name string, valueMs float64, status string) telemetry.AIMetric {
+	return telemetry.AIMetric{
+		Metric: aitelemetry.Metric{
+			Name:             name,
+			Value:            valueMs,
+			CustomDimensions: map[string]string{telemetry.StatusStr: status},
+		},
+	}
+}
+
+func TestPrometheusSinkSendMetric(t *testing.T) {
+	s := NewPrometheusSink(nil)
+
+	s.SendMetric(operationMetric(telemetry.CNIAddTimeMetricStr, 120, telemetry.SucceededStr))
+	s.SendMetric(operationMetric(telemetry.CNIAddTimeMetricStr, 3000, telemetry.FailedStr))
+	s.SendMetric(operationMetric(telemetry.CNIDelTimeMetricStr, 40, telemetry.SucceededStr))
+	s.SendMetric(operationMetric("SomeOtherMetric", 1, telemetry.FailedStr))
+
+	require.Equal(t, 3, testutil.CollectAndCount(s.operationDuration))
+	require.InDelta(t, 1, testutil.ToFloat64(s.operationErrors.WithLabelValues(operationAdd)), 0)
+	require.InDelta(t, 0, testutil.ToFloat64(s.operationErrors.WithLabelValues(operationDelete)), 0)
+}
+
+func TestPrometheusSinkSendReport(t *testing.T) {
+	s := NewPrometheusSink(nil)
+
+	s.SendReport(telemetry.CNIReport{EventMessage: "ADD command completed"})
+	s.SendReport(telemetry.CNIReport{ErrorMessage: "failed to allocate IP"})
+	s.SendReport(telemetry.CNIReport{})
+
+	require.InDelta(t, 1, testutil.ToFloat64(s.reports.WithLabelValues(reportTypeEvent)), 0)
+	require.InDelta(t, 1, testutil.ToFloat64(s.reports.WithLabelValues(reportTypeError)), 0)
+}
+
+func TestPrometheusSinkHandler(t *testing.T) {
+	s := NewPrometheusSink(nil)
+	s.SendMetric(operationMetric(telemetry.CNIAddTimeMetricStr, 120, telemetry.SucceededStr))
+
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL) //nolint:noctx // test
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	require.Contains(t, string(body), `cni_operation_duration_seconds_bucket{operation="add",status="Succeeded",le="0.1"} 0`)
+	require.Contains(t, string(body), `cni_operation_duration_seconds_bucket{operation="add",status="Succeeded",le="0.2"} 1`)
+}
@@ -0,0 +1,98 @@
+// Copyright Microsoft. All rights reserved.
+// MIT License
+
+// Package sinks implements telemetry.Sinks which make the reports and metrics of CNI
+// available outside of Application Insights, as OTLP logs and metrics or Prometheus metrics.
+package sinks
+
+import (
+	"context"
+	"time"
+
+	"github.com/Azure/azure-container-networking/telemetry"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	serviceName = "azure-cni"
+
+	operationAdd    = "add"
+	operationDelete = "delete"
+	operationUpdate = "update"
+	statusUnknown   = "Unknown"
+)
+
+// operations maps the names of the metrics CNI reports the duration of its commands with to the command.
+var operations = map[string]string{
+	telemetry.CNIAddTimeMetricStr:    operationAdd,
+	telemetry.CNIDelTimeMetricStr:    operationDelete,
+	telemetry.CNIUpdateTimeMetricStr: operationUpdate,
+}
+
+// operationSample is the duration and status of a CNI command, reported by CNI as an AIMetric.
+type operationSample struct {
+	operation string
+	status    string
+	duration  time.Duration
+}
+
+func (s operationSample) failed() bool {
+	return s.status == telemetry.FailedStr
+}
+
+// newOperationSample returns the sample reported by metric, or false if metric isn't the duration of a CNI command.
+func newOperationSample(metric telemetry.AIMetric) (operationSample, bool) {
+	operation, ok := operations[metric.Metric.Name]
+	if !ok {
+		return operationSample{}, false
+	}
+
+	status := metric.Metric.CustomDimensions[telemetry.StatusStr]
+	if status == "" {
+		status = statusUnknown
+	}
+
+	return operationSample{
+		operation: operation,
+		status:    status,
+		duration:  time.Duration(metric.Metric.Value * float64(time.Millisecond)),
+	}, true
+}
+
+// reportMessage returns the message of a report, as sent to Application Insights, or false if it has none.
+func reportMessage(report telemetry.CNIReport) (string, bool) {
+	if report.ErrorMessage != "" {
+		return report.ErrorMessage, true
+	}
+	if report.EventMessage != "" {
+		return report.EventMessage, true
+	}
+	return "", false
+}
+
+// New returns the sinks enabled by cfg.
+func New(ctx context.Context, cfg telemetry.SinkConfig, logger *zap.Logger) ([]telemetry.Sink, error) {
+	var sinks []telemetry.Sink
+
+	if cfg.PrometheusAddress != "" {
+		prometheusSink := NewPrometheusSink(logger)
+		if err := prometheusSink.Serve(cfg.PrometheusAddress); err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, prometheusSink)
+	}
+
+	if cfg.OTLPEndpoint != "" {
+		otlpSink, err := NewOTLPSink(ctx, cfg.OTLPEndpoint, cfg.OTLPHeaders)
+		if err != nil {
+			for _, sink := range sinks {
+				sink.Close()
+			}
+			return nil, errors.Wrap(err, "failed to create OTLP sink")
+		}
+		sinks = append(sinks, otlpSink)
+	}
+
+	return sinks, nil
+}
@@ -34,6 +34,7 @@ type TelemetryConfig struct {
 	BatchSizeInBytes              int
 	GetEnvRetryCount              int
 	GetEnvRetryWaitTimeInSecs     int
+	Sinks                         SinkConfig
 }
 
 // FdName - file descriptor name
@@ -58,6 +59,7 @@ type TelemetryBuffer struct {
 	mutex       sync.Mutex
 	logger      *zap.Logger
 	plc         platform.ExecClient
+	sinks       []Sink
 }
 
 // Buffer object holds the different types of reports
@@ -74,6 +76,7 @@ func NewTelemetryBuffer(logger *zap.Logger) *TelemetryBuffer {
 	tb.connections = make([]net.Conn, 0)
 	tb.logger = logger
 	tb.plc = platform.NewExecClient(tb.logger)
+	tb.sinks = []Sink{aiSink{}}
 
 	return &tb
 }
@@ -205,12 +208,13 @@ func (tb *TelemetryBuffer) Connect() error {
 // PushData - PushData running an instance if it isn't already being run elsewhere
 func (tb *TelemetryBuffer) PushData(ctx context.Context) {
 	defer tb.Close()
+	defer tb.closeSinks()
 
 	for {
 		select {
 		case report := <-tb.data:
 			tb.mutex.Lock()
-			push(report)
+			tb.push(report)
 			tb.mutex.Unlock()
 		case <-tb.cancel:
 			if tb.logger != nil {
@@ -279,14 +283,18 @@ func (tb *TelemetryBuffer) Close() {
 	tb.connections = make([]net.Conn, 0)
 }
 
-// push - push the report (x) to corresponding slice
-func push(x interface{}) {
+// push - push the report (x) to each sink
+func (tb *TelemetryBuffer) push(x interface{}) {
 	switch y := x.(type) {
 	case CNIReport:
-		SendAITelemetry(y)
+		for _, sink := range tb.sinks {
+			sink.SendReport(y)
+		}
 
 	case AIMetric:
-		SendAIMetric(y)
+		for _, sink := range tb.sinks {
+			sink.SendMetric(y)
+		}
 	default:
 		log.Printf("Push fn: Default case:%+v", y)
 	}
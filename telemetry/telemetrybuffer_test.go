@@ -1,9 +1,11 @@
 package telemetry
 
 import (
+	"context"
 	"testing"
 	"time"
 
+	"github.com/Azure/azure-container-networking/aitelemetry"
 	"github.com/Azure/azure-container-networking/cni/log"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
@@ -207,3 +209,75 @@ func TestExtraneousClose(_ *testing.T) {
 	tb.Close()
 	tb.Close()
 }
+
+type fakeSink struct {
+	reports chan CNIReport
+	metrics chan AIMetric
+	closed  chan struct{}
+}
+
+func newFakeSink() *fakeSink {
+	return &fakeSink{
+		reports: make(chan CNIReport, 1),
+		metrics: make(chan AIMetric, 1),
+		closed:  make(chan struct{}),
+	}
+}
+
+func (s *fakeSink) SendReport(report CNIReport) { s.reports <- report }
+
+func (s *fakeSink) SendMetric(metric AIMetric) { s.metrics <- metric }
+
+func (s *fakeSink) Close() { close(s.closed) }
+
+func TestPushDataToSinks(t *testing.T) {
+	tbServer, closeTBServer := createTBServer(t)
+	defer closeTBServer()
+
+	sink := newFakeSink()
+	tbServer.AddSink(sink)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		tbServer.PushData(ctx)
+		close(done)
+	}()
+
+	tbClient := NewTelemetryBuffer(nil)
+	err := tbClient.Connect()
+	require.NoError(t, err)
+	defer tbClient.Close()
+
+	SendCNIEvent(tbClient, &CNIReport{EventMessage: "ADD command completed"})
+	select {
+	case report := <-sink.reports:
+		require.Equal(t, "ADD command completed", report.EventMessage)
+	case <-time.After(5 * time.Second):
+		t.Fatal("report wasn't sent to sink")
+	}
+
+	err = SendCNIMetric(&AIMetric{
+		aitelemetry.Metric{
+			Name:             CNIAddTimeMetricStr,
+			Value:            10,
+			CustomDimensions: map[string]string{StatusStr: SucceededStr},
+		},
+	}, tbClient)
+	require.NoError(t, err)
+	select {
+	case metric := <-sink.metrics:
+		require.Equal(t, CNIAddTimeMetricStr, metric.Metric.Name)
+		require.Equal(t, SucceededStr, metric.Metric.CustomDimensions[StatusStr])
+	case <-time.After(5 * time.Second):
+		t.Fatal("metric wasn't sent to sink")
+	}
+
+	cancel()
+	<-done
+	select {
+	case <-sink.closed:
+	default:
+		t.Fatal("sink wasn't closed")
+	}
+}
@@ -29,6 +29,11 @@ const (
 	FlagFollow      = "follow"
 	FlagLogFilePath = "log-file"
 
+	// CNI Events Flags
+	FlagEventsFilePath = "events-file"
+	FlagContainerID    = "container-id"
+	FlagPod            = "pod"
+
 	// tenancy flags
 	Singletenancy = "singletenancy"
 	Multitenancy  = "multitenancy"
@@ -68,6 +73,7 @@ const (
 	DefaultBinDirLinux      = "/opt/cni/bin/"
 	DefaultConflistDirLinux = "/etc/cni/net.d/"
 	DefaultLogFile          = "/var/log/azure-vnet.log"
+	DefaultEventsFile       = "/var/log/azure-vnet-events.jsonl"
 	Transparent             = "transparent"
 	Bridge                  = "bridge"
 	Azure0                  = "azure0"
@@ -104,6 +110,7 @@ var (
 		FlagConflistDirectory:          DefaultConflistDirLinux,
 		FlagVersion:                    Packaged,
 		FlagLogFilePath:                DefaultLogFile,
+		FlagEventsFilePath:             DefaultEventsFile,
 		FlagCNSUrl:                     DefaultCNSUrl,
 		FlagEnableExactMatchForPodName: DefaultEnableExactMatchForPodName,
 		EnvCNILogFile:                  EnvCNILogFile,
@@ -22,6 +22,8 @@ func CNICmd() *cobra.Command {
 
 	cmd.AddCommand(InstallCmd())
 	cmd.AddCommand(LogsCmd())
+	cmd.AddCommand(EventsCmd())
+	cmd.AddCommand(ReplayCmd())
 	cmd.AddCommand(ManagerCmd())
 	return cmd
 }
@@ -0,0 +1,99 @@
+//go:build !ignore_uncovered
+// +build !ignore_uncovered
+
+package cni
+
+import (
+	"fmt"
+
+	"github.com/Azure/azure-container-networking/cni/events"
+	"github.com/Azure/azure-container-networking/cni/network"
+	c "github.com/Azure/azure-container-networking/tools/acncli/api"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// EventsCmd prints the invocations of Azure CNI recorded in the events file
+func EventsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "events",
+		Short: fmt.Sprintf("Retrieves the invocations of %s binary", c.AzureCNIBin),
+		Long:  "The events command prints the ADD and DEL invocations of Azure CNI for a container or pod, oldest first",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			invs, err := readEvents(cmd)
+			if err != nil {
+				return err
+			}
+			for i := range invs {
+				c.PrettyPrint(invs[i])
+				fmt.Println()
+			}
+			return nil
+		},
+	}
+
+	addEventsFlags(cmd)
+	return cmd
+}
+
+// ReplayCmd replays the last recorded ADD of a container or pod in dry-run
+func ReplayCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "replay",
+		Short: "Replays an ADD of Azure CNI in dry-run",
+		Long: "The replay command runs the last recorded ADD of a container or pod again, against the recorded IPAM result " +
+			"and a mock network manager, so the host isn't changed. It prints the CNI result and the invocation of the replay",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			containerID, _ := cmd.Flags().GetString(c.FlagContainerID)
+			pod, _ := cmd.Flags().GetString(c.FlagPod)
+			if containerID == "" && pod == "" {
+				return errors.Errorf("one of --%s or --%s is required", c.FlagContainerID, c.FlagPod)
+			}
+			invs, err := readEvents(cmd)
+			if err != nil {
+				return err
+			}
+			var add *events.Invocation
+			for i := len(invs) - 1; i >= 0; i-- {
+				if invs[i].Command == network.CNI_ADD {
+					add = &invs[i]
+					break
+				}
+			}
+			if add == nil {
+				return errors.New("no recorded ADD matches")
+			}
+
+			fmt.Printf("🔁 - replaying ADD of container %s from %s\n", add.ContainerID, add.Start)
+			replayed, err := network.Replay(add)
+			if err != nil {
+				return errors.Wrap(err, "failed to replay ADD")
+			}
+			c.PrettyPrint(replayed)
+			fmt.Println()
+			return nil
+		},
+	}
+
+	addEventsFlags(cmd)
+	return cmd
+}
+
+func addEventsFlags(cmd *cobra.Command) {
+	cmd.Flags().String(c.FlagEventsFilePath, c.Defaults[c.FlagEventsFilePath], "Path of the Azure CNI events file")
+	cmd.Flags().String(c.FlagContainerID, "", "ID, or prefix of the ID, of the container")
+	cmd.Flags().String(c.FlagPod, "", "Name, or namespace/name, of the pod")
+}
+
+// readEvents returns the recorded invocations which match the container and pod flags of cmd.
+// The flags are read from cmd rather than viper, since the events and replay commands share their names.
+func readEvents(cmd *cobra.Command) ([]events.Invocation, error) {
+	path, _ := cmd.Flags().GetString(c.FlagEventsFilePath)
+	containerID, _ := cmd.Flags().GetString(c.FlagContainerID)
+	pod, _ := cmd.Flags().GetString(c.FlagPod)
+	invs, err := events.NewRing(path, events.DefaultMaxEntries).Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read events")
+	}
+	return events.Filter(invs, containerID, pod), nil
+}
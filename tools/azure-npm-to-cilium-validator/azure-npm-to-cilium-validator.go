@@ -27,10 +27,83 @@ func main() {
 	// Parse the kubeconfig flag
 	kubeconfig := flag.String("kubeconfig", "~/.kube/config", "absolute path to the kubeconfig file")
 	detailedMigrationSummary := flag.Bool("detailed-migration-summary", false, "display flagged network polices/services and total cluster resource count")
+	networkPoliciesFile := flag.String("network-policies-file", "", "read network policies from this YAML or JSON file instead of the cluster")
+	ciliumPoliciesOutput := flag.String("cilium-policies-output", "", "write the equivalent CiliumNetworkPolicies to this file (- for stdout)")
+	npmCacheFile := flag.String("npm-cache", "", "NPM cache file from a node, used with --iptables-save to compare NPM and Cilium verdicts")
+	iptablesSaveFile := flag.String("iptables-save", "", "iptables-save output from the same node as --npm-cache")
+	probePorts := flag.String("probe-ports", "TCP/80", "comma-separated ports to compare verdicts on for Pods without container ports")
 	flag.Parse()
 
+	var namespaces *corev1.NamespaceList
+	var policiesByNamespace map[string][]*networkingv1.NetworkPolicy
+	var servicesByNamespace map[string][]*corev1.Service
+	var podsByNamespace map[string][]*corev1.Pod
+	if *networkPoliciesFile != "" {
+		var err error
+		policiesByNamespace, err = readNetworkPoliciesFile(*networkPoliciesFile)
+		if err != nil {
+			log.Fatalf("Error reading network policies: %v", err)
+		}
+		namespaces = &corev1.NamespaceList{}
+		servicesByNamespace = make(map[string][]*corev1.Service)
+		podsByNamespace = make(map[string][]*corev1.Pod)
+	} else {
+		namespaces, policiesByNamespace, servicesByNamespace, podsByNamespace = getClusterResources(*kubeconfig)
+	}
+
+	// Create telemetry handle
+	// Note: npmVersionNum and imageVersion telemetry is not needed for this tool so they are set to abitrary values
+	err := metrics.CreateTelemetryHandle(0, "NPM-script-v0.0.1", "014c22bd-4107-459e-8475-67909e96edcb")
+
+	if err != nil {
+		klog.Infof("CreateTelemetryHandle failed with error %v. AITelemetry is not initialized.", err)
+	}
+
+	// Print the migration summary
+	printMigrationSummary(detailedMigrationSummary, namespaces, policiesByNamespace, servicesByNamespace, podsByNamespace)
+
+	if *ciliumPoliciesOutput == "" && *npmCacheFile == "" {
+		return
+	}
+
+	// Convert the network policies to CiliumNetworkPolicies
+	ciliumPolicies, notes := convertNetworkPolicies(policiesByNamespace)
+	notes = append(notes, serviceConversionNotes(getUnsafeExternalTrafficPolicyClusterServices(namespaces, servicesByNamespace, policiesByNamespace))...)
+	if *ciliumPoliciesOutput != "" {
+		if err := writeCiliumNetworkPoliciesFile(*ciliumPoliciesOutput, ciliumPolicies); err != nil {
+			log.Fatalf("Error writing CiliumNetworkPolicies: %v", err)
+		}
+		if len(notes) > 0 {
+			renderConversionNotesTable(notes)
+		}
+	}
+
+	// Compare the verdicts of NPM and the CiliumNetworkPolicies
+	if *npmCacheFile != "" {
+		if *iptablesSaveFile == "" {
+			log.Fatalf("--iptables-save is required with --npm-cache")
+		}
+		defaultPorts, err := parseProbePorts(*probePorts)
+		if err != nil {
+			log.Fatalf("Error parsing probe ports: %v", err)
+		}
+		analyzer, err := newNPMVerdictAnalyzer(*npmCacheFile, *iptablesSaveFile)
+		if err != nil {
+			log.Fatalf("Error reading NPM state: %v", err)
+		}
+		mismatches, numCompared := compareVerdicts(analyzer, ciliumPolicies, defaultPorts)
+		renderVerdictComparisonTable(mismatches, numCompared)
+	}
+}
+
+func getClusterResources(kubeconfig string) (
+	*corev1.NamespaceList,
+	map[string][]*networkingv1.NetworkPolicy,
+	map[string][]*corev1.Service,
+	map[string][]*corev1.Pod,
+) {
 	// Build the Kubernetes client config
-	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
 	if err != nil {
 		log.Fatalf("Error building kubeconfig: %v", err)
 	}
@@ -94,16 +167,7 @@ func main() {
 		}
 	}
 
-	// Create telemetry handle
-	// Note: npmVersionNum and imageVersion telemetry is not needed for this tool so they are set to abitrary values
-	err = metrics.CreateTelemetryHandle(0, "NPM-script-v0.0.1", "014c22bd-4107-459e-8475-67909e96edcb")
-
-	if err != nil {
-		klog.Infof("CreateTelemetryHandle failed with error %v. AITelemetry is not initialized.", err)
-	}
-
-	// Print the migration summary
-	printMigrationSummary(detailedMigrationSummary, namespaces, policiesByNamespace, servicesByNamespace, podsByNamespace)
+	return namespaces, policiesByNamespace, servicesByNamespace, podsByNamespace
 }
 
 func printMigrationSummary(
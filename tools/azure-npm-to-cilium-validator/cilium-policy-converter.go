@@ -0,0 +1,380 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	ciliumAPIVersion        = "cilium.io/v2"
+	ciliumNetworkPolicyKind = "CiliumNetworkPolicy"
+
+	// podNamespaceLabel is the label Cilium gives every endpoint for its namespace.
+	// Selectors without it only select endpoints in the policy's namespace.
+	podNamespaceLabel = "k8s:io.kubernetes.pod.namespace"
+	// namespaceLabelPrefix is the prefix Cilium gives every endpoint for the labels of its namespace.
+	namespaceLabelPrefix = "k8s:io.cilium.k8s.namespace.labels."
+
+	entityAll = "all"
+	// Cilium treats port 0 as all ports of the protocol
+	allPorts = "0"
+)
+
+var errUnknownManifestKind = errors.New("manifest is not a NetworkPolicy or a list of NetworkPolicies")
+
+type ciliumNetworkPolicy struct {
+	APIVersion string               `json:"apiVersion"`
+	Kind       string               `json:"kind"`
+	Metadata   ciliumPolicyMetadata `json:"metadata"`
+	Spec       ciliumRule           `json:"spec"`
+}
+
+type ciliumPolicyMetadata struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+type ciliumRule struct {
+	EndpointSelector metav1.LabelSelector `json:"endpointSelector"`
+	// A single empty rule denies all traffic in its direction
+	Ingress []ciliumIngressRule `json:"ingress,omitempty"`
+	Egress  []ciliumEgressRule  `json:"egress,omitempty"`
+}
+
+type ciliumIngressRule struct {
+	FromEndpoints []metav1.LabelSelector `json:"fromEndpoints,omitempty"`
+	FromCIDRSet   []ciliumCIDRRule       `json:"fromCIDRSet,omitempty"`
+	FromEntities  []string               `json:"fromEntities,omitempty"`
+	ToPorts       []ciliumPortRule       `json:"toPorts,omitempty"`
+}
+
+type ciliumEgressRule struct {
+	ToEndpoints []metav1.LabelSelector `json:"toEndpoints,omitempty"`
+	ToCIDRSet   []ciliumCIDRRule       `json:"toCIDRSet,omitempty"`
+	ToEntities  []string               `json:"toEntities,omitempty"`
+	ToPorts     []ciliumPortRule       `json:"toPorts,omitempty"`
+}
+
+type ciliumCIDRRule struct {
+	Cidr   string   `json:"cidr"`
+	Except []string `json:"except,omitempty"`
+}
+
+type ciliumPortRule struct {
+	Ports []ciliumPortProtocol `json:"ports"`
+}
+
+type ciliumPortProtocol struct {
+	Port     string `json:"port"`
+	EndPort  int32  `json:"endPort,omitempty"`
+	Protocol string `json:"protocol"`
+}
+
+// conversionNote explains where a converted policy or a Service behaves differently on Cilium than on NPM.
+type conversionNote struct {
+	Resource string
+	Note     string
+}
+
+// ciliumPeers is the direction-independent form of an ingress or egress rule.
+type ciliumPeers struct {
+	endpoints []metav1.LabelSelector
+	cidrs     []ciliumCIDRRule
+	entities  []string
+	ports     []ciliumPortRule
+}
+
+// convertNetworkPolicies converts every NetworkPolicy to an equivalent CiliumNetworkPolicy.
+// Policies are returned sorted by namespace and name.
+func convertNetworkPolicies(policiesByNamespace map[string][]*networkingv1.NetworkPolicy) ([]*ciliumNetworkPolicy, []conversionNote) {
+	namespaces := make([]string, 0, len(policiesByNamespace))
+	for namespace := range policiesByNamespace {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	var ciliumPolicies []*ciliumNetworkPolicy
+	var notes []conversionNote
+	for _, namespace := range namespaces {
+		policies := append([]*networkingv1.NetworkPolicy(nil), policiesByNamespace[namespace]...)
+		sort.Slice(policies, func(i, j int) bool { return policies[i].Name < policies[j].Name })
+		for _, policy := range policies {
+			ciliumPolicy, policyNotes := convertNetworkPolicy(namespace, policy)
+			ciliumPolicies = append(ciliumPolicies, ciliumPolicy)
+			for _, note := range policyNotes {
+				notes = append(notes, conversionNote{Resource: fmt.Sprintf("%s/%s", namespace, policy.Name), Note: note})
+			}
+		}
+	}
+	return ciliumPolicies, notes
+}
+
+func convertNetworkPolicy(namespace string, policy *networkingv1.NetworkPolicy) (*ciliumNetworkPolicy, []string) {
+	ciliumPolicy := &ciliumNetworkPolicy{
+		APIVersion: ciliumAPIVersion,
+		Kind:       ciliumNetworkPolicyKind,
+		Metadata:   ciliumPolicyMetadata{Name: policy.Name, Namespace: namespace},
+		Spec:       ciliumRule{EndpointSelector: *policy.Spec.PodSelector.DeepCopy()},
+	}
+
+	var notes []string
+	hasIngress, hasEgress := policyTypes(policy)
+	if hasIngress {
+		// an empty rule selects nothing, so it denies all ingress
+		ciliumPolicy.Spec.Ingress = []ciliumIngressRule{}
+		if len(policy.Spec.Ingress) == 0 {
+			ciliumPolicy.Spec.Ingress = append(ciliumPolicy.Spec.Ingress, ciliumIngressRule{})
+		}
+		for i, rule := range policy.Spec.Ingress {
+			peers, ruleNotes := convertPeers("ingress", i, rule.From, rule.Ports)
+			notes = append(notes, ruleNotes...)
+			ciliumPolicy.Spec.Ingress = append(ciliumPolicy.Spec.Ingress, ciliumIngressRule{
+				FromEndpoints: peers.endpoints,
+				FromCIDRSet:   peers.cidrs,
+				FromEntities:  peers.entities,
+				ToPorts:       peers.ports,
+			})
+		}
+	}
+	if hasEgress {
+		ciliumPolicy.Spec.Egress = []ciliumEgressRule{}
+		if len(policy.Spec.Egress) == 0 {
+			ciliumPolicy.Spec.Egress = append(ciliumPolicy.Spec.Egress, ciliumEgressRule{})
+		}
+		for i, rule := range policy.Spec.Egress {
+			peers, ruleNotes := convertPeers("egress", i, rule.To, rule.Ports)
+			notes = append(notes, ruleNotes...)
+			ciliumPolicy.Spec.Egress = append(ciliumPolicy.Spec.Egress, ciliumEgressRule{
+				ToEndpoints: peers.endpoints,
+				ToCIDRSet:   peers.cidrs,
+				ToEntities:  peers.entities,
+				ToPorts:     peers.ports,
+			})
+		}
+	}
+	return ciliumPolicy, notes
+}
+
+// policyTypes returns the directions the policy isolates, defaulting policyTypes the same way the API server does.
+func policyTypes(policy *networkingv1.NetworkPolicy) (hasIngress, hasEgress bool) {
+	if len(policy.Spec.PolicyTypes) == 0 {
+		return true, len(policy.Spec.Egress) > 0
+	}
+	for _, policyType := range policy.Spec.PolicyTypes {
+		switch policyType {
+		case networkingv1.PolicyTypeIngress:
+			hasIngress = true
+		case networkingv1.PolicyTypeEgress:
+			hasEgress = true
+		}
+	}
+	return hasIngress, hasEgress
+}
+
+func convertPeers(direction string, ruleIndex int, peers []networkingv1.NetworkPolicyPeer, ports []networkingv1.NetworkPolicyPort) (ciliumPeers, []string) {
+	var converted ciliumPeers
+	var notes []string
+
+	// no peers allows all sources or destinations, including ones outside the cluster
+	if len(peers) == 0 {
+		converted.entities = []string{entityAll}
+	}
+
+	for _, peer := range peers {
+		if peer.IPBlock != nil {
+			converted.cidrs = append(converted.cidrs, ciliumCIDRRule{Cidr: peer.IPBlock.CIDR, Except: peer.IPBlock.Except})
+			notes = append(notes, fmt.Sprintf("%s rule %d: ipBlock %s doesn't match Pod IPs on Cilium. Select Pods in this range with endpoints instead", direction, ruleIndex, peer.IPBlock.CIDR))
+			if len(peer.IPBlock.Except) > 0 {
+				notes = append(notes, fmt.Sprintf("%s rule %d: ipBlock except %v only carves out external IPs on Cilium since Pods never match CIDR rules", direction, ruleIndex, peer.IPBlock.Except))
+			}
+			continue
+		}
+		converted.endpoints = append(converted.endpoints, endpointSelector(peer))
+	}
+
+	if len(ports) > 0 {
+		portRule := ciliumPortRule{Ports: make([]ciliumPortProtocol, 0, len(ports))}
+		for _, port := range ports {
+			protocol := string(corev1.ProtocolTCP)
+			if port.Protocol != nil {
+				protocol = string(*port.Protocol)
+			}
+
+			portProtocol := ciliumPortProtocol{Port: allPorts, Protocol: protocol}
+			if port.Port != nil {
+				portProtocol.Port = port.Port.String()
+				if port.Port.Type == intstr.String {
+					notes = append(notes, fmt.Sprintf("%s rule %d: named port %q is resolved per node on Cilium. Pods on the same node must not map it to different port numbers", direction, ruleIndex, port.Port.StrVal))
+				}
+			}
+			if port.EndPort != nil {
+				portProtocol.EndPort = *port.EndPort
+			}
+			portRule.Ports = append(portRule.Ports, portProtocol)
+		}
+		converted.ports = []ciliumPortRule{portRule}
+	}
+
+	return converted, notes
+}
+
+// endpointSelector combines a peer's pod and namespace selectors into one Cilium endpoint selector.
+func endpointSelector(peer networkingv1.NetworkPolicyPeer) metav1.LabelSelector {
+	selector := metav1.LabelSelector{}
+	if peer.PodSelector != nil {
+		selector = *peer.PodSelector.DeepCopy()
+	}
+	if peer.NamespaceSelector == nil {
+		return selector
+	}
+
+	if selector.MatchLabels == nil && len(peer.NamespaceSelector.MatchLabels) > 0 {
+		selector.MatchLabels = make(map[string]string, len(peer.NamespaceSelector.MatchLabels))
+	}
+	for key, value := range peer.NamespaceSelector.MatchLabels {
+		selector.MatchLabels[namespaceLabelPrefix+key] = value
+	}
+	for _, expression := range peer.NamespaceSelector.MatchExpressions {
+		expression := *expression.DeepCopy()
+		expression.Key = namespaceLabelPrefix + expression.Key
+		selector.MatchExpressions = append(selector.MatchExpressions, expression)
+	}
+	// otherwise Cilium would only select endpoints in the policy's namespace
+	selector.MatchExpressions = append(selector.MatchExpressions, metav1.LabelSelectorRequirement{
+		Key:      podNamespaceLabel,
+		Operator: metav1.LabelSelectorOpExists,
+	})
+	return selector
+}
+
+// serviceConversionNotes explains the Services flagged by getUnsafeExternalTrafficPolicyClusterServices.
+func serviceConversionNotes(unsafeServices []string) []conversionNote {
+	notes := make([]conversionNote, 0, len(unsafeServices))
+	for _, service := range unsafeServices {
+		notes = append(notes, conversionNote{
+			Resource: service,
+			Note:     "externalTrafficPolicy=Cluster: Cilium enforces ingress policies on traffic forwarded from other nodes, and no converted policy allows it to all target ports. Allow it explicitly or use externalTrafficPolicy=Local",
+		})
+	}
+	return notes
+}
+
+// writeCiliumNetworkPolicies writes the policies as a multi-document YAML stream.
+func writeCiliumNetworkPolicies(w io.Writer, ciliumPolicies []*ciliumNetworkPolicy) error {
+	for i, ciliumPolicy := range ciliumPolicies {
+		out, err := yaml.Marshal(ciliumPolicy)
+		if err != nil {
+			return fmt.Errorf("failed to marshal CiliumNetworkPolicy %s/%s: %w", ciliumPolicy.Metadata.Namespace, ciliumPolicy.Metadata.Name, err)
+		}
+		if i > 0 {
+			if _, err := io.WriteString(w, "---\n"); err != nil {
+				return fmt.Errorf("failed to write CiliumNetworkPolicies: %w", err)
+			}
+		}
+		if _, err := w.Write(out); err != nil {
+			return fmt.Errorf("failed to write CiliumNetworkPolicies: %w", err)
+		}
+	}
+	return nil
+}
+
+// readNetworkPolicies reads NetworkPolicies from a YAML or JSON file, e.g. the output of "kubectl get networkpolicy -A -o yaml".
+func readNetworkPolicies(r io.Reader) (map[string][]*networkingv1.NetworkPolicy, error) {
+	policiesByNamespace := make(map[string][]*networkingv1.NetworkPolicy)
+	addPolicy := func(policy *networkingv1.NetworkPolicy) {
+		namespace := policy.Namespace
+		if namespace == "" {
+			namespace = metav1.NamespaceDefault
+		}
+		policiesByNamespace[namespace] = append(policiesByNamespace[namespace], policy)
+	}
+
+	decoder := k8syaml.NewYAMLOrJSONDecoder(r, 4096) //nolint:gomnd // buffer size to sniff for JSON
+	for {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				return policiesByNamespace, nil
+			}
+			return nil, fmt.Errorf("failed to decode manifest: %w", err)
+		}
+		if len(raw) == 0 || string(raw) == "null" {
+			continue
+		}
+
+		var typeMeta metav1.TypeMeta
+		if err := json.Unmarshal(raw, &typeMeta); err != nil {
+			return nil, fmt.Errorf("failed to decode manifest kind: %w", err)
+		}
+		switch {
+		case typeMeta.Kind == "NetworkPolicy":
+			policy := &networkingv1.NetworkPolicy{}
+			if err := json.Unmarshal(raw, policy); err != nil {
+				return nil, fmt.Errorf("failed to decode NetworkPolicy: %w", err)
+			}
+			addPolicy(policy)
+		case strings.HasSuffix(typeMeta.Kind, "List"):
+			list := &networkingv1.NetworkPolicyList{}
+			if err := json.Unmarshal(raw, list); err != nil {
+				return nil, fmt.Errorf("failed to decode NetworkPolicy list: %w", err)
+			}
+			for i := range list.Items {
+				addPolicy(&list.Items[i])
+			}
+		default:
+			return nil, fmt.Errorf("%w: %s", errUnknownManifestKind, typeMeta.Kind)
+		}
+	}
+}
+
+func readNetworkPoliciesFile(path string) (map[string][]*networkingv1.NetworkPolicy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+	return readNetworkPolicies(f)
+}
+
+func writeCiliumNetworkPoliciesFile(path string, ciliumPolicies []*ciliumNetworkPolicy) error {
+	if path == "-" {
+		return writeCiliumNetworkPolicies(os.Stdout, ciliumPolicies)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if err := writeCiliumNetworkPolicies(f, ciliumPolicies); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", path, err)
+	}
+	return nil
+}
+
+func renderConversionNotesTable(notes []conversionNote) {
+	notesTable := tablewriter.NewWriter(os.Stdout)
+	notesTable.SetHeader([]string{"Resource", "Note"})
+	notesTable.SetRowLine(true)
+	for _, note := range notes {
+		notesTable.Append([]string{note.Resource, note.Note})
+	}
+
+	fmt.Println("\nConversion Notes:")
+	notesTable.Render()
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	intstr "k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const testNetworkPoliciesFile = "../../npm/pkg/dataplane/testdata/netpol.yaml"
+
+const expectedBaseCiliumNetworkPolicy = `apiVersion: cilium.io/v2
+kind: CiliumNetworkPolicy
+metadata:
+  name: base
+  namespace: "y"
+spec:
+  egress:
+  - toEndpoints:
+    - matchExpressions:
+      - key: pod
+        operator: In
+        values:
+        - a
+        - b
+      - key: k8s:io.cilium.k8s.namespace.labels.ns
+        operator: In
+        values:
+        - "y"
+        - z
+      - key: k8s:io.kubernetes.pod.namespace
+        operator: Exists
+    toPorts:
+    - ports:
+      - port: "80"
+        protocol: TCP
+  - toEntities:
+    - all
+    toPorts:
+    - ports:
+      - port: "53"
+        protocol: UDP
+      - port: "53"
+        protocol: TCP
+  endpointSelector:
+    matchLabels:
+      pod: a
+  ingress:
+  - fromEndpoints:
+    - matchExpressions:
+      - key: pod
+        operator: In
+        values:
+        - b
+        - c
+      - key: k8s:io.cilium.k8s.namespace.labels.ns
+        operator: In
+        values:
+        - x
+        - "y"
+      - key: k8s:io.kubernetes.pod.namespace
+        operator: Exists
+    toPorts:
+    - ports:
+      - port: "80"
+        protocol: TCP
+`
+
+func TestConvertNetworkPoliciesFromFile(t *testing.T) {
+	policiesByNamespace, err := readNetworkPoliciesFile(testNetworkPoliciesFile)
+	if err != nil {
+		t.Fatalf("failed to read network policies: %v", err)
+	}
+
+	ciliumPolicies, notes := convertNetworkPolicies(policiesByNamespace)
+	if len(notes) != 0 {
+		t.Errorf("expected no notes, got %v", notes)
+	}
+
+	var out bytes.Buffer
+	if err := writeCiliumNetworkPolicies(&out, ciliumPolicies); err != nil {
+		t.Fatalf("failed to write CiliumNetworkPolicies: %v", err)
+	}
+	if out.String() != expectedBaseCiliumNetworkPolicy {
+		t.Errorf("expected:\n%s\ngot:\n%s", expectedBaseCiliumNetworkPolicy, out.String())
+	}
+}
+
+func TestConvertNetworkPolicy(t *testing.T) {
+	udp := corev1.ProtocolUDP
+	tests := []struct {
+		name            string
+		policy          *networkingv1.NetworkPolicy
+		expectedIngress []ciliumIngressRule
+		expectedEgress  []ciliumEgressRule
+		expectedNotes   int
+	}{
+		{
+			name: "Deny all ingress",
+			policy: &networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "deny-all"},
+				Spec:       networkingv1.NetworkPolicySpec{PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}},
+			},
+			expectedIngress: []ciliumIngressRule{{}},
+		},
+		{
+			name: "Allow all ingress and deny all egress",
+			policy: &networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "allow-all"},
+				Spec: networkingv1.NetworkPolicySpec{
+					Ingress:     []networkingv1.NetworkPolicyIngressRule{{}},
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+				},
+			},
+			expectedIngress: []ciliumIngressRule{{FromEntities: []string{entityAll}}},
+			expectedEgress:  []ciliumEgressRule{{}},
+		},
+		{
+			name: "Pod selector in the same namespace and protocol without port",
+			policy: &networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "same-namespace"},
+				Spec: networkingv1.NetworkPolicySpec{
+					Ingress: []networkingv1.NetworkPolicyIngressRule{
+						{
+							From:  []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "client"}}}},
+							Ports: []networkingv1.NetworkPolicyPort{{Protocol: &udp}},
+						},
+					},
+				},
+			},
+			expectedIngress: []ciliumIngressRule{
+				{
+					FromEndpoints: []metav1.LabelSelector{{MatchLabels: map[string]string{"app": "client"}}},
+					ToPorts:       []ciliumPortRule{{Ports: []ciliumPortProtocol{{Port: allPorts, Protocol: "UDP"}}}},
+				},
+			},
+		},
+		{
+			name: "All namespaces",
+			policy: &networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "all-namespaces"},
+				Spec: networkingv1.NetworkPolicySpec{
+					Egress: []networkingv1.NetworkPolicyEgressRule{
+						{To: []networkingv1.NetworkPolicyPeer{{NamespaceSelector: &metav1.LabelSelector{}}}},
+					},
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+				},
+			},
+			expectedEgress: []ciliumEgressRule{
+				{
+					ToEndpoints: []metav1.LabelSelector{
+						{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: podNamespaceLabel, Operator: metav1.LabelSelectorOpExists}}},
+					},
+				},
+			},
+		},
+		{
+			name: "Namespace labels",
+			policy: &networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "namespace-labels"},
+				Spec: networkingv1.NetworkPolicySpec{
+					Ingress: []networkingv1.NetworkPolicyIngressRule{
+						{From: []networkingv1.NetworkPolicyPeer{{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}}}}},
+					},
+				},
+			},
+			expectedIngress: []ciliumIngressRule{
+				{
+					FromEndpoints: []metav1.LabelSelector{
+						{
+							MatchLabels:      map[string]string{namespaceLabelPrefix + "team": "a"},
+							MatchExpressions: []metav1.LabelSelectorRequirement{{Key: podNamespaceLabel, Operator: metav1.LabelSelectorOpExists}},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "ipBlock with except, named port, and endPort",
+			policy: &networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "cidr"},
+				Spec: networkingv1.NetworkPolicySpec{
+					Egress: []networkingv1.NetworkPolicyEgressRule{
+						{
+							To: []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.0/16", Except: []string{"10.0.1.0/24"}}}},
+							Ports: []networkingv1.NetworkPolicyPort{
+								{Port: intstrPtr(intstr.FromString("http"))},
+								{Port: intstrPtr(intstr.FromInt(8000)), EndPort: int32Ptr(8080)},
+							},
+						},
+					},
+				},
+			},
+			expectedIngress: []ciliumIngressRule{{}},
+			expectedEgress: []ciliumEgressRule{
+				{
+					ToCIDRSet: []ciliumCIDRRule{{Cidr: "10.0.0.0/16", Except: []string{"10.0.1.0/24"}}},
+					ToPorts: []ciliumPortRule{
+						{Ports: []ciliumPortProtocol{{Port: "http", Protocol: "TCP"}, {Port: "8000", EndPort: 8080, Protocol: "TCP"}}},
+					},
+				},
+			},
+			expectedNotes: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ciliumPolicy, notes := convertNetworkPolicy("namespace1", tt.policy)
+			if ciliumPolicy.Metadata.Name != tt.policy.Name || ciliumPolicy.Metadata.Namespace != "namespace1" {
+				t.Errorf("unexpected metadata %+v", ciliumPolicy.Metadata)
+			}
+			if !reflect.DeepEqual(ciliumPolicy.Spec.Ingress, tt.expectedIngress) {
+				t.Errorf("expected ingress %+v, got %+v", tt.expectedIngress, ciliumPolicy.Spec.Ingress)
+			}
+			if !reflect.DeepEqual(ciliumPolicy.Spec.Egress, tt.expectedEgress) {
+				t.Errorf("expected egress %+v, got %+v", tt.expectedEgress, ciliumPolicy.Spec.Egress)
+			}
+			if len(notes) != tt.expectedNotes {
+				t.Errorf("expected %d notes, got %v", tt.expectedNotes, notes)
+			}
+		})
+	}
+}
+
+func TestReadNetworkPolicies(t *testing.T) {
+	tests := []struct {
+		name          string
+		manifest      string
+		expectedNames map[string][]string
+		expectErr     bool
+	}{
+		{
+			name: "List",
+			manifest: `apiVersion: v1
+kind: List
+items:
+- apiVersion: networking.k8s.io/v1
+  kind: NetworkPolicy
+  metadata:
+    name: a
+    namespace: x
+- apiVersion: networking.k8s.io/v1
+  kind: NetworkPolicy
+  metadata:
+    name: b
+`,
+			expectedNames: map[string][]string{"x": {"a"}, "default": {"b"}},
+		},
+		{
+			name:          "Multiple documents in JSON",
+			manifest:      `{"kind": "NetworkPolicy", "metadata": {"name": "a", "namespace": "x"}}` + "\n" + `{"kind": "NetworkPolicy", "metadata": {"name": "b", "namespace": "x"}}`,
+			expectedNames: map[string][]string{"x": {"a", "b"}},
+		},
+		{
+			name:      "Unknown kind",
+			manifest:  "kind: Service\nmetadata:\n  name: a\n",
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policiesByNamespace, err := readNetworkPolicies(strings.NewReader(tt.manifest))
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			names := make(map[string][]string)
+			for namespace, policies := range policiesByNamespace {
+				for _, policy := range policies {
+					names[namespace] = append(names[namespace], policy.Name)
+				}
+			}
+			if !reflect.DeepEqual(names, tt.expectedNames) {
+				t.Errorf("expected policies %v, got %v", tt.expectedNames, names)
+			}
+		})
+	}
+}
+
+func TestServiceConversionNotes(t *testing.T) {
+	notes := serviceConversionNotes([]string{"namespace1/service1"})
+	if len(notes) != 1 || notes[0].Resource != "namespace1/service1" {
+		t.Errorf("unexpected notes %v", notes)
+	}
+}
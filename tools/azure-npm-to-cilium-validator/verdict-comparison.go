@@ -0,0 +1,415 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	npmcommon "github.com/Azure/azure-container-networking/npm/pkg/controlplane/controllers/common"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/debug"
+	"github.com/Azure/azure-container-networking/npm/pkg/dataplane/pb"
+	"github.com/Azure/azure-container-networking/npm/util"
+	"github.com/olekukonko/tablewriter"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+var (
+	errUnexpectedNPMCache = errors.New("unexpected NPM cache type")
+	errInvalidProbePort   = errors.New("invalid probe port, expected <protocol>/<port>")
+)
+
+// probePort is a port a destination Pod is probed on.
+type probePort struct {
+	Protocol corev1.Protocol
+	Port     int32
+}
+
+func (p probePort) String() string {
+	return fmt.Sprintf("%s/%d", p.Protocol, p.Port)
+}
+
+// parseProbePorts parses a comma-separated list like "TCP/80,UDP/53".
+func parseProbePorts(s string) ([]probePort, error) {
+	var ports []probePort
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		protocol, port, ok := strings.Cut(field, "/")
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", errInvalidProbePort, field)
+		}
+		portNum, err := strconv.ParseInt(port, 10, 32)
+		if err != nil || portNum <= 0 {
+			return nil, fmt.Errorf("%w: %s", errInvalidProbePort, field)
+		}
+		ports = append(ports, probePort{Protocol: corev1.Protocol(strings.ToUpper(protocol)), Port: int32(portNum)})
+	}
+	return ports, nil
+}
+
+// verdictMismatch is a connection that NPM and the converted CiliumNetworkPolicies disagree on.
+type verdictMismatch struct {
+	Source        string
+	Destination   string
+	Port          probePort
+	NPMAllowed    bool
+	CiliumAllowed bool
+}
+
+// npmVerdictAnalyzer computes NPM's verdicts from a node's NPM cache and iptables-save output.
+// The NPM traffic analyzer resolves the rules in NPM's policy chains, but its hit rules
+// only require one of a rule's sets to match, so the rules are evaluated here instead.
+type npmVerdictAnalyzer struct {
+	cache *npmcommon.Cache
+	// rules in NPM's policy chains, which include the sets of the jumps to the chain
+	rules []*pb.RuleResponse
+}
+
+func newNPMVerdictAnalyzer(npmCacheFile, iptablesSaveFile string) (*npmVerdictAnalyzer, error) {
+	c := &debug.Converter{EnableV2NPM: true}
+	allRules, err := c.GetProtobufRulesFromIptableFile(util.IptablesFilterTable, npmCacheFile, iptablesSaveFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read NPM rules: %w", err)
+	}
+	cache, ok := c.NPMCache.(*npmcommon.Cache)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", errUnexpectedNPMCache, c.NPMCache)
+	}
+
+	a := &npmVerdictAnalyzer{cache: cache}
+	for rule := range allRules {
+		if strings.HasPrefix(rule.Chain, util.IptablesAzureIngressPolicyChainPrefix+"-") ||
+			strings.HasPrefix(rule.Chain, util.IptablesAzureEgressPolicyChainPrefix+"-") {
+			a.rules = append(a.rules, rule)
+		}
+	}
+	return a, nil
+}
+
+// allows returns whether NPM allows the port from src to dst.
+// Traffic must be allowed on egress from the source and on ingress to the destination.
+func (a *npmVerdictAnalyzer) allows(src, dst *npmcommon.NpmPod, port probePort) bool {
+	return a.allowsInDirection(src, dst, port, pb.Direction_EGRESS) && a.allowsInDirection(src, dst, port, pb.Direction_INGRESS)
+}
+
+func (a *npmVerdictAnalyzer) allowsInDirection(src, dst *npmcommon.NpmPod, port probePort, direction pb.Direction) bool {
+	isolated := false
+	for _, rule := range a.rules {
+		if rule.Direction != direction || !a.matchesSets(rule.SrcList, src, port) || !a.matchesSets(rule.DstList, dst, port) {
+			continue
+		}
+		if !rule.Allowed {
+			// the last rule of a policy chain marks all traffic from/to selected Pods to be dropped
+			isolated = true
+			continue
+		}
+		if npmRuleMatchesPort(rule, port) {
+			return true
+		}
+	}
+	return !isolated
+}
+
+// matchesSets returns whether the Pod matches all of the sets, like iptables' set module.
+func (a *npmVerdictAnalyzer) matchesSets(sets []*pb.RuleResponse_SetInfo, pod *npmcommon.NpmPod, port probePort) bool {
+	for _, setInfo := range sets {
+		if a.matchesSet(setInfo.Name, pod, port) != setInfo.Included {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *npmVerdictAnalyzer) matchesSet(name string, pod *npmcommon.NpmPod, port probePort) bool {
+	var nsLabels map[string]string
+	if ns, ok := a.cache.NsMap[pod.Namespace]; ok {
+		nsLabels = ns.LabelsMap
+	}
+
+	switch {
+	case strings.HasPrefix(name, util.NamespacePrefix):
+		return pod.Namespace == strings.TrimPrefix(name, util.NamespacePrefix)
+	case strings.HasPrefix(name, util.NamespaceLabelPrefix):
+		label := strings.TrimPrefix(name, util.NamespaceLabelPrefix)
+		if label == util.KubeAllNamespacesFlag {
+			return true
+		}
+		return matchesLabel(nsLabels, label)
+	case strings.HasPrefix(name, util.PodLabelPrefix):
+		return matchesLabel(pod.Labels, strings.TrimPrefix(name, util.PodLabelPrefix))
+	case strings.HasPrefix(name, util.NestedLabelPrefix):
+		key, values, _ := strings.Cut(strings.TrimPrefix(name, util.NestedLabelPrefix), util.IpsetLabelDelimter)
+		value, ok := pod.Labels[key]
+		if !ok {
+			return false
+		}
+		for _, v := range strings.Split(values, util.IpsetLabelDelimter) {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	case strings.HasPrefix(name, util.NamedPortIPSetPrefix):
+		portName := strings.TrimPrefix(name, util.NamedPortIPSetPrefix)
+		for _, containerPort := range pod.ContainerPorts {
+			if containerPort.Name == portName && containerPort.ContainerPort == port.Port && containerPort.Protocol == port.Protocol {
+				return true
+			}
+		}
+		return false
+	default:
+		// the members of CIDR sets aren't in the NPM cache
+		return false
+	}
+}
+
+// matchesLabel returns whether the labels have the key, or the key and value for "key:value".
+func matchesLabel(labels map[string]string, label string) bool {
+	key, value, hasValue := strings.Cut(label, util.IpsetLabelDelimter)
+	actual, ok := labels[key]
+	if !ok {
+		return false
+	}
+	return !hasValue || actual == value
+}
+
+func npmRuleMatchesPort(rule *pb.RuleResponse, port probePort) bool {
+	if rule.Protocol != "" && !strings.EqualFold(rule.Protocol, string(port.Protocol)) {
+		return false
+	}
+	return rule.DPort == 0 || rule.DPort == port.Port
+}
+
+// ciliumAllows returns whether the CiliumNetworkPolicies allow the port from src to dst.
+// CIDR rules never match since both endpoints are Pods.
+func ciliumAllows(ciliumPolicies []*ciliumNetworkPolicy, src, dst *npmcommon.NpmPod, nsLabels map[string]map[string]string, port probePort) bool {
+	srcLabels := endpointLabels(src, nsLabels)
+	dstLabels := endpointLabels(dst, nsLabels)
+
+	egressIsolated, egressAllowed := false, false
+	ingressIsolated, ingressAllowed := false, false
+	for _, ciliumPolicy := range ciliumPolicies {
+		namespace := ciliumPolicy.Metadata.Namespace
+		if ciliumPolicy.Spec.Egress != nil && selectsEndpoint(ciliumPolicy.Spec.EndpointSelector, namespace, src.Namespace, srcLabels) {
+			egressIsolated = true
+			for _, rule := range ciliumPolicy.Spec.Egress {
+				peers := ciliumPeers{endpoints: rule.ToEndpoints, cidrs: rule.ToCIDRSet, entities: rule.ToEntities, ports: rule.ToPorts}
+				if peers.matchesPeer(namespace, dst, dstLabels) && portsMatch(peers.ports, dst, port) {
+					egressAllowed = true
+				}
+			}
+		}
+		if ciliumPolicy.Spec.Ingress != nil && selectsEndpoint(ciliumPolicy.Spec.EndpointSelector, namespace, dst.Namespace, dstLabels) {
+			ingressIsolated = true
+			for _, rule := range ciliumPolicy.Spec.Ingress {
+				peers := ciliumPeers{endpoints: rule.FromEndpoints, cidrs: rule.FromCIDRSet, entities: rule.FromEntities, ports: rule.ToPorts}
+				// ports are always the destination's
+				if peers.matchesPeer(namespace, src, srcLabels) && portsMatch(peers.ports, dst, port) {
+					ingressAllowed = true
+				}
+			}
+		}
+	}
+	return (!egressIsolated || egressAllowed) && (!ingressIsolated || ingressAllowed)
+}
+
+// matchesPeer returns whether the rule's entities or endpoints select the peer.
+func (peers ciliumPeers) matchesPeer(policyNamespace string, peer *npmcommon.NpmPod, peerLabels labels.Set) bool {
+	for _, entity := range peers.entities {
+		if entity == entityAll {
+			return true
+		}
+	}
+	for _, selector := range peers.endpoints {
+		if selectsEndpoint(selector, policyNamespace, peer.Namespace, peerLabels) {
+			return true
+		}
+	}
+	return false
+}
+
+// portsMatch returns whether the port of the destination Pod matches the rule's ports.
+func portsMatch(portRules []ciliumPortRule, dst *npmcommon.NpmPod, port probePort) bool {
+	if len(portRules) == 0 {
+		return true
+	}
+	for _, portRule := range portRules {
+		for _, portProtocol := range portRule.Ports {
+			if !strings.EqualFold(portProtocol.Protocol, string(port.Protocol)) {
+				continue
+			}
+			if portProtocol.Port == allPorts {
+				return true
+			}
+			portNum, err := strconv.ParseInt(portProtocol.Port, 10, 32)
+			if err != nil {
+				// named port
+				for _, containerPort := range dst.ContainerPorts {
+					if containerPort.Name == portProtocol.Port && containerPort.ContainerPort == port.Port && containerPort.Protocol == port.Protocol {
+						return true
+					}
+				}
+				continue
+			}
+			endPort := portProtocol.EndPort
+			if endPort == 0 {
+				endPort = int32(portNum)
+			}
+			if port.Port >= int32(portNum) && port.Port <= endPort {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// selectsEndpoint returns whether the selector selects the endpoint. Like Cilium, a selector without
+// the namespace label only selects endpoints in the policy's namespace.
+func selectsEndpoint(selector metav1.LabelSelector, policyNamespace, namespace string, endpointLabels labels.Set) bool {
+	if !selectsNamespace(selector) && namespace != policyNamespace {
+		return false
+	}
+	// Cilium's label keys aren't valid Kubernetes label keys, so they can't be validated with metav1.LabelSelectorAsSelector
+	for key, value := range selector.MatchLabels {
+		if actual, ok := endpointLabels[key]; !ok || actual != value {
+			return false
+		}
+	}
+	for _, expression := range selector.MatchExpressions {
+		actual, ok := endpointLabels[expression.Key]
+		switch expression.Operator {
+		case metav1.LabelSelectorOpIn:
+			if !ok || !slices.Contains(expression.Values, actual) {
+				return false
+			}
+		case metav1.LabelSelectorOpNotIn:
+			if ok && slices.Contains(expression.Values, actual) {
+				return false
+			}
+		case metav1.LabelSelectorOpExists:
+			if !ok {
+				return false
+			}
+		case metav1.LabelSelectorOpDoesNotExist:
+			if ok {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func selectsNamespace(selector metav1.LabelSelector) bool {
+	if _, ok := selector.MatchLabels[podNamespaceLabel]; ok {
+		return true
+	}
+	for _, expression := range selector.MatchExpressions {
+		if expression.Key == podNamespaceLabel {
+			return true
+		}
+	}
+	return false
+}
+
+// endpointLabels returns the labels Cilium gives the Pod's endpoint.
+func endpointLabels(pod *npmcommon.NpmPod, nsLabels map[string]map[string]string) labels.Set {
+	endpoint := make(labels.Set, len(pod.Labels)+len(nsLabels[pod.Namespace])+1)
+	for key, value := range pod.Labels {
+		endpoint[key] = value
+	}
+	for key, value := range nsLabels[pod.Namespace] {
+		endpoint[namespaceLabelPrefix+key] = value
+	}
+	endpoint[podNamespaceLabel] = pod.Namespace
+	return endpoint
+}
+
+// compareVerdicts compares NPM's verdicts against the CiliumNetworkPolicies' for every pair of Pods in the NPM cache.
+// Each destination is probed on its container ports, or on defaultPorts if it has none.
+func compareVerdicts(a *npmVerdictAnalyzer, ciliumPolicies []*ciliumNetworkPolicy, defaultPorts []probePort) (mismatches []verdictMismatch, numCompared int) {
+	pods := make([]*npmcommon.NpmPod, 0, len(a.cache.PodMap))
+	for _, pod := range a.cache.PodMap {
+		if pod.PodIP != "" {
+			pods = append(pods, pod)
+		}
+	}
+	sort.Slice(pods, func(i, j int) bool { return podKey(pods[i]) < podKey(pods[j]) })
+
+	nsLabels := make(map[string]map[string]string, len(a.cache.NsMap))
+	for name, ns := range a.cache.NsMap {
+		nsLabels[name] = ns.LabelsMap
+	}
+
+	for _, src := range pods {
+		for _, dst := range pods {
+			if src == dst {
+				continue
+			}
+			for _, port := range destinationPorts(dst, defaultPorts) {
+				numCompared++
+				npmAllowed := a.allows(src, dst, port)
+				ciliumAllowed := ciliumAllows(ciliumPolicies, src, dst, nsLabels, port)
+				if npmAllowed != ciliumAllowed {
+					mismatches = append(mismatches, verdictMismatch{
+						Source:        podKey(src),
+						Destination:   podKey(dst),
+						Port:          port,
+						NPMAllowed:    npmAllowed,
+						CiliumAllowed: ciliumAllowed,
+					})
+				}
+			}
+		}
+	}
+	return mismatches, numCompared
+}
+
+func destinationPorts(dst *npmcommon.NpmPod, defaultPorts []probePort) []probePort {
+	if len(dst.ContainerPorts) == 0 {
+		return defaultPorts
+	}
+	ports := make([]probePort, 0, len(dst.ContainerPorts))
+	for _, containerPort := range dst.ContainerPorts {
+		protocol := containerPort.Protocol
+		if protocol == "" {
+			protocol = corev1.ProtocolTCP
+		}
+		ports = append(ports, probePort{Protocol: protocol, Port: containerPort.ContainerPort})
+	}
+	return ports
+}
+
+func podKey(pod *npmcommon.NpmPod) string {
+	return pod.Namespace + "/" + pod.Name
+}
+
+func renderVerdictComparisonTable(mismatches []verdictMismatch, numCompared int) {
+	verdict := func(allowed bool) string {
+		if allowed {
+			return "allow"
+		}
+		return "deny"
+	}
+
+	comparisonTable := tablewriter.NewWriter(os.Stdout)
+	comparisonTable.SetHeader([]string{"Source", "Destination", "Port", "NPM", "Cilium"})
+	comparisonTable.SetRowLine(true)
+	for _, mismatch := range mismatches {
+		comparisonTable.Append([]string{mismatch.Source, mismatch.Destination, mismatch.Port.String(), verdict(mismatch.NPMAllowed), verdict(mismatch.CiliumAllowed)})
+	}
+
+	fmt.Printf("\nVerdict Comparison (%d of %d connections differ):\n", len(mismatches), numCompared)
+	if len(mismatches) > 0 {
+		comparisonTable.Render()
+	}
+}
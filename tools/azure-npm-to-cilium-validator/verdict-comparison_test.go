@@ -0,0 +1,158 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	npmcommon "github.com/Azure/azure-container-networking/npm/pkg/controlplane/controllers/common"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	testNPMCacheFile     = "../../npm/pkg/dataplane/testdata/npmcachev2.json"
+	testIptablesSaveFile = "../../npm/pkg/dataplane/testdata/iptablesave-v2"
+)
+
+// testClusterPolicies returns the policies that were applied when the NPM cache and iptables-save test files were captured.
+func testClusterPolicies(t *testing.T) map[string][]*networkingv1.NetworkPolicy {
+	policiesByNamespace, err := readNetworkPoliciesFile(testNetworkPoliciesFile)
+	if err != nil {
+		t.Fatalf("failed to read network policies: %v", err)
+	}
+	policiesByNamespace["kube-system"] = []*networkingv1.NetworkPolicy{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "default-deny-ingress", Namespace: "kube-system"},
+			Spec:       networkingv1.NetworkPolicySpec{PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "konnectivity-agent", Namespace: "kube-system"},
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "konnectivity-agent"}},
+				Egress:      []networkingv1.NetworkPolicyEgressRule{{}},
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+			},
+		},
+	}
+	return policiesByNamespace
+}
+
+func TestCompareVerdicts(t *testing.T) {
+	analyzer, err := newNPMVerdictAnalyzer(testNPMCacheFile, testIptablesSaveFile)
+	if err != nil {
+		t.Fatalf("failed to create analyzer: %v", err)
+	}
+	ciliumPolicies, _ := convertNetworkPolicies(testClusterPolicies(t))
+
+	mismatches, numCompared := compareVerdicts(analyzer, ciliumPolicies, []probePort{{Protocol: corev1.ProtocolTCP, Port: 80}})
+	if numCompared == 0 {
+		t.Errorf("expected connections to be compared")
+	}
+	if len(mismatches) != 0 {
+		t.Errorf("expected no mismatches, got %+v", mismatches)
+	}
+
+	// without the deny policy, Cilium allows ingress to kube-system while NPM doesn't
+	policiesByNamespace := testClusterPolicies(t)
+	policiesByNamespace["kube-system"] = policiesByNamespace["kube-system"][1:]
+	ciliumPolicies, _ = convertNetworkPolicies(policiesByNamespace)
+	mismatches, _ = compareVerdicts(analyzer, ciliumPolicies, []probePort{{Protocol: corev1.ProtocolTCP, Port: 80}})
+	if len(mismatches) == 0 {
+		t.Fatalf("expected mismatches")
+	}
+	for _, mismatch := range mismatches {
+		if mismatch.NPMAllowed || !mismatch.CiliumAllowed {
+			t.Errorf("expected only NPM to deny, got %+v", mismatch)
+		}
+		dst := analyzer.cache.PodMap[mismatch.Destination]
+		if dst == nil || dst.Namespace != "kube-system" {
+			t.Errorf("expected only connections to kube-system to differ, got %+v", mismatch)
+		}
+	}
+}
+
+func TestNPMVerdicts(t *testing.T) {
+	analyzer, err := newNPMVerdictAnalyzer(testNPMCacheFile, testIptablesSaveFile)
+	if err != nil {
+		t.Fatalf("failed to create analyzer: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		src      string
+		dst      string
+		port     probePort
+		expected bool
+	}{
+		{name: "Allowed by ingress and egress rules", src: "y/b", dst: "y/a", port: probePort{Protocol: corev1.ProtocolTCP, Port: 80}, expected: true},
+		{name: "Denied port on ingress", src: "y/b", dst: "y/a", port: probePort{Protocol: corev1.ProtocolTCP, Port: 81}, expected: false},
+		{name: "Denied source on ingress", src: "z/b", dst: "y/a", port: probePort{Protocol: corev1.ProtocolTCP, Port: 80}, expected: false},
+		{name: "Allowed by egress rule", src: "y/a", dst: "z/b", port: probePort{Protocol: corev1.ProtocolTCP, Port: 80}, expected: true},
+		{name: "Denied destination on egress", src: "y/a", dst: "x/a", port: probePort{Protocol: corev1.ProtocolTCP, Port: 80}, expected: false},
+		{name: "Denied by ingress deny all", src: "y/a", dst: "kube-system/coredns-69c47794-9vtmc", port: probePort{Protocol: corev1.ProtocolUDP, Port: 53}, expected: false},
+		{name: "No policies", src: "x/a", dst: "z/c", port: probePort{Protocol: corev1.ProtocolUDP, Port: 81}, expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if allowed := analyzer.allows(analyzer.cache.PodMap[tt.src], analyzer.cache.PodMap[tt.dst], tt.port); allowed != tt.expected {
+				t.Errorf("expected allowed=%t, got %t", tt.expected, allowed)
+			}
+		})
+	}
+}
+
+func TestCiliumAllowsNamedPort(t *testing.T) {
+	src := &npmcommon.NpmPod{Name: "client", Namespace: "x", Labels: map[string]string{"app": "client"}}
+	dst := &npmcommon.NpmPod{
+		Name:           "server",
+		Namespace:      "x",
+		Labels:         map[string]string{"app": "server"},
+		ContainerPorts: []corev1.ContainerPort{{Name: "http", ContainerPort: 8080, Protocol: corev1.ProtocolTCP}},
+	}
+	ciliumPolicies := []*ciliumNetworkPolicy{
+		{
+			Metadata: ciliumPolicyMetadata{Name: "named-port", Namespace: "x"},
+			Spec: ciliumRule{
+				EndpointSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "server"}},
+				Ingress: []ciliumIngressRule{
+					{
+						FromEndpoints: []metav1.LabelSelector{{MatchLabels: map[string]string{"app": "client"}}},
+						ToPorts:       []ciliumPortRule{{Ports: []ciliumPortProtocol{{Port: "http", Protocol: "TCP"}}}},
+					},
+				},
+			},
+		},
+	}
+
+	if !ciliumAllows(ciliumPolicies, src, dst, nil, probePort{Protocol: corev1.ProtocolTCP, Port: 8080}) {
+		t.Errorf("expected the named port to be allowed")
+	}
+	if ciliumAllows(ciliumPolicies, src, dst, nil, probePort{Protocol: corev1.ProtocolTCP, Port: 80}) {
+		t.Errorf("expected other ports to be denied")
+	}
+
+	// the selector only selects Pods in the policy's namespace
+	src.Namespace = "y"
+	if ciliumAllows(ciliumPolicies, src, dst, nil, probePort{Protocol: corev1.ProtocolTCP, Port: 8080}) {
+		t.Errorf("expected Pods in other namespaces to be denied")
+	}
+}
+
+func TestParseProbePorts(t *testing.T) {
+	ports, err := parseProbePorts("TCP/80, udp/53,")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []probePort{{Protocol: corev1.ProtocolTCP, Port: 80}, {Protocol: corev1.ProtocolUDP, Port: 53}}
+	if !reflect.DeepEqual(ports, expected) {
+		t.Errorf("expected ports %v, got %v", expected, ports)
+	}
+
+	for _, invalid := range []string{"80", "TCP/http", "TCP/0"} {
+		if _, err := parseProbePorts(invalid); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright Microsoft. All rights reserved.
+// MIT License
+
+package tracing
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	httpMethodKey     = attribute.Key("http.request.method")
+	httpRouteKey      = attribute.Key("http.route")
+	httpStatusCodeKey = attribute.Key("http.response.status_code")
+	urlPathKey        = attribute.Key("url.path")
+)
+
+// HandlerFunc wraps handler in a server span which continues the trace propagated by the caller, if any.
+// The span is named after route, which should be the pattern the handler is registered with.
+func HandlerFunc(route string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := otel.Tracer(instrumentationName).Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				httpMethodKey.String(r.Method),
+				httpRouteKey.String(route),
+				urlPathKey.String(r.URL.Path),
+			))
+		defer span.End()
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		handler(sw, r.WithContext(ctx))
+
+		span.SetAttributes(httpStatusCodeKey.Int(sw.status))
+		if sw.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(sw.status))
+		}
+	}
+}
+
+// statusWriter records the status code written by a handler.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Flush flushes the wrapped ResponseWriter, if it's an http.Flusher, so that handlers can stream responses.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped ResponseWriter, which http.ResponseController uses for the optional interfaces,
+// e.g. http.Hijacker, which statusWriter doesn't implement.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Transport is an http.RoundTripper which wraps each request in a client span
+// and propagates the trace context to the server in the request headers.
+type Transport struct {
+	base http.RoundTripper
+}
+
+// NewTransport returns a Transport which sends requests with base, or http.DefaultTransport if base is nil.
+func NewTransport(base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{base: base}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := otel.Tracer(instrumentationName).Start(req.Context(), req.Method+" "+req.URL.Path,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			httpMethodKey.String(req.Method),
+			urlPathKey.String(req.URL.Path),
+		))
+	defer span.End()
+
+	// RoundTrippers must not modify the request, so the headers are set on a copy.
+	req = req.Clone(ctx)
+	propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err //nolint:wrapcheck // the client wraps transport errors
+	}
+
+	span.SetAttributes(httpStatusCodeKey.Int(resp.StatusCode))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	}
+	return resp, nil
+}
@@ -0,0 +1,106 @@
+// Copyright Microsoft. All rights reserved.
+// MIT License
+
+// Package tracing configures OpenTelemetry tracing and propagates W3C trace context over HTTP,
+// so that a pod's CNI invocation and the CNS requests it makes are recorded as a single trace.
+package tracing
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = "github.com/Azure/azure-container-networking"
+	defaultTracesPath   = "/v1/traces"
+	serviceNameKey      = attribute.Key("service.name")
+)
+
+// Config configures the export of spans to an OTLP/HTTP collector.
+type Config struct {
+	// OTLPEndpoint is the URL spans are exported to, e.g. http://localhost:4318/v1/traces.
+	// If the URL has no path, /v1/traces is used. Tracing is disabled if empty.
+	OTLPEndpoint string `json:"otlpEndpoint,omitempty"`
+	// OTLPHeaders are added to each export request, e.g. for authentication.
+	OTLPHeaders map[string]string `json:"otlpHeaders,omitempty"`
+	// SampleRatio is the fraction of new traces which are sampled, defaulting to 1.
+	// Spans which continue a remote trace follow the sampling decision of the caller.
+	SampleRatio float64 `json:"sampleRatio,omitempty"`
+}
+
+// Enabled returns true if spans are exported.
+func (c Config) Enabled() bool {
+	return c.OTLPEndpoint != ""
+}
+
+// ShutdownFunc flushes pending spans and stops the exporter.
+type ShutdownFunc func(context.Context) error
+
+// propagator is used directly rather than through otel's global propagator,
+// so trace context is propagated even if this process doesn't export spans.
+var propagator = propagation.TraceContext{}
+
+// Init installs a global tracer provider which exports the spans of serviceName as configured by cfg.
+// The returned ShutdownFunc must be called before the process exits, or buffered spans are lost.
+// If tracing is disabled, Init does nothing and spans are not recorded.
+func Init(ctx context.Context, serviceName string, cfg Config) (ShutdownFunc, error) {
+	if !cfg.Enabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	endpoint, err := url.Parse(cfg.OTLPEndpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse OTLP endpoint %s", cfg.OTLPEndpoint)
+	}
+	if endpoint.Path == "" {
+		endpoint.Path = defaultTracesPath
+	}
+
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpointURL(endpoint.String())}
+	if len(cfg.OTLPHeaders) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(cfg.OTLPHeaders))
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create OTLP trace exporter")
+	}
+
+	ratio := cfg.SampleRatio
+	if ratio <= 0 || ratio > 1 {
+		ratio = 1
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(serviceNameKey.String(serviceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		return errors.Wrap(provider.Shutdown(ctx), "failed to shut down tracer provider")
+	}, nil
+}
+
+// Start starts a span which is a child of the span in ctx, if any.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...)) //nolint:spancheck // ended by the caller
+}
+
+// End records err on span, if not nil, and ends the span.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
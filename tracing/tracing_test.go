@@ -0,0 +1,182 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// collector is an in-process OTLP/HTTP collector which records the spans exported to it.
+type collector struct {
+	*httptest.Server
+	sync.Mutex
+	spans    []*tracepb.Span
+	services []string
+	headers  []http.Header
+}
+
+func newCollector(t *testing.T) *collector {
+	c := &collector{}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != defaultTracesPath {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var req coltracepb.ExportTraceServiceRequest
+		if err := proto.Unmarshal(body, &req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		c.Lock()
+		c.headers = append(c.headers, r.Header.Clone())
+		for _, resourceSpans := range req.GetResourceSpans() {
+			for _, attr := range resourceSpans.GetResource().GetAttributes() {
+				if attr.GetKey() == string(serviceNameKey) {
+					c.services = append(c.services, attr.GetValue().GetStringValue())
+				}
+			}
+			for _, scopeSpans := range resourceSpans.GetScopeSpans() {
+				c.spans = append(c.spans, scopeSpans.GetSpans()...)
+			}
+		}
+		c.Unlock()
+
+		resp, _ := proto.Marshal(&coltracepb.ExportTraceServiceResponse{})
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		_, _ = w.Write(resp)
+	}))
+	t.Cleanup(c.Close)
+	return c
+}
+
+func (c *collector) span(t *testing.T, name string, kind tracepb.Span_SpanKind) *tracepb.Span {
+	t.Helper()
+	c.Lock()
+	defer c.Unlock()
+	for _, span := range c.spans {
+		if span.GetName() == name && span.GetKind() == kind {
+			return span
+		}
+	}
+	require.FailNowf(t, "span not exported", "no %s span named %q", kind, name)
+	return nil
+}
+
+func initTracing(t *testing.T, cfg Config) ShutdownFunc {
+	t.Helper()
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+	shutdown, err := Init(context.Background(), "test-service", cfg)
+	require.NoError(t, err)
+	return shutdown
+}
+
+func TestInitExportsSpans(t *testing.T) {
+	c := newCollector(t)
+	shutdown := initTracing(t, Config{
+		OTLPEndpoint: c.URL,
+		OTLPHeaders:  map[string]string{"x-test-token": "token"},
+	})
+
+	_, span := Start(context.Background(), "operation")
+	End(span, errors.New("operation failed"))
+	require.NoError(t, shutdown(context.Background()))
+
+	exported := c.span(t, "operation", tracepb.Span_SPAN_KIND_INTERNAL)
+	require.Equal(t, tracepb.Status_STATUS_CODE_ERROR, exported.GetStatus().GetCode())
+	require.Equal(t, "operation failed", exported.GetStatus().GetMessage())
+	require.Equal(t, []string{"test-service"}, c.services)
+	require.Equal(t, "token", c.headers[0].Get("x-test-token"))
+}
+
+func TestPropagation(t *testing.T) {
+	c := newCollector(t)
+	shutdown := initTracing(t, Config{OTLPEndpoint: c.URL})
+
+	var serverSpan trace.SpanContext
+	server := httptest.NewServer(HandlerFunc("/route", func(w http.ResponseWriter, r *http.Request) {
+		serverSpan = trace.SpanContextFromContext(r.Context())
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, parent := Start(context.Background(), "parent")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/route", http.NoBody)
+	require.NoError(t, err)
+	resp, err := (&http.Client{Transport: NewTransport(nil)}).Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	End(parent, nil)
+	require.NoError(t, shutdown(context.Background()))
+
+	traceID := parent.SpanContext().TraceID()
+	require.Equal(t, traceID, serverSpan.TraceID(), "server should continue the caller's trace")
+
+	require.Len(t, c.spans, 3)
+	client := c.span(t, "POST /route", tracepb.Span_SPAN_KIND_CLIENT)
+	handler := c.span(t, "POST /route", tracepb.Span_SPAN_KIND_SERVER)
+	require.Equal(t, traceID[:], client.GetTraceId())
+	require.Equal(t, traceID[:], handler.GetTraceId())
+	spanID := parent.SpanContext().SpanID()
+	require.Equal(t, spanID[:], client.GetParentSpanId())
+	require.Equal(t, client.GetSpanId(), handler.GetParentSpanId())
+	require.Equal(t, tracepb.Status_STATUS_CODE_ERROR, handler.GetStatus().GetCode())
+}
+
+func TestDisabled(t *testing.T) {
+	shutdown := initTracing(t, Config{})
+	require.NoError(t, shutdown(context.Background()))
+
+	// trace context received from a caller is still propagated when spans aren't recorded
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer server.Close()
+
+	const incoming = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	handler := HandlerFunc("/", func(_ http.ResponseWriter, r *http.Request) {
+		req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, server.URL, http.NoBody)
+		require.NoError(t, err)
+		resp, err := (&http.Client{Transport: NewTransport(nil)}).Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+	req.Header.Set("traceparent", incoming)
+	handler(httptest.NewRecorder(), req)
+
+	require.Equal(t, incoming, traceparent)
+}
+
+func TestHandlerFuncStreams(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	handler := HandlerFunc("/", func(w http.ResponseWriter, _ *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		require.True(t, ok, "streaming handlers need an http.Flusher")
+		_, _ = w.Write([]byte("event"))
+		flusher.Flush()
+		require.True(t, recorder.Flushed)
+
+		// http.ResponseController reaches the recorder through Unwrap
+		require.Equal(t, recorder, w.(interface{ Unwrap() http.ResponseWriter }).Unwrap())
+	})
+	handler(recorder, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+}
@@ -96,14 +96,12 @@ func (c *Core) Write(entry zapcore.Entry, fields []zapcore.Field) error {
 
 	// set fields
 	for i := range fields {
-		// handle zap object first
-		if fields[i].Type == zapcore.ObjectMarshalerType {
-			fields[i].AddTo(c.enc)
-		} else if mapper, ok := c.fieldMappers[fields[i].Key]; ok {
-			// check mapped fields
+		// check mapped fields first
+		if mapper, ok := c.fieldMappers[fields[i].Key]; ok && fields[i].Type != zapcore.ObjectMarshalerType {
 			mapper(t, fieldStringer(&fields[i]))
 		} else {
-			t.Properties[fields[i].Key] = fieldStringer(&fields[i])
+			// flatten everything else in to the trace properties
+			fields[i].AddTo(c.enc)
 		}
 	}
 	b, err := c.enc.encode(t)
@@ -2,17 +2,36 @@ package zapai
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/gob"
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/microsoft/ApplicationInsights-Go/appinsights"
 	"github.com/pkg/errors"
 	"go.uber.org/zap/zapcore"
 )
 
+const (
+	// maxPropertyKeyLength and maxPropertyValueLength are the limits appinsights applies to trace properties.
+	maxPropertyKeyLength   = 150
+	maxPropertyValueLength = 8192
+	// maxArrayLength is the number of array elements flattened in to properties, the rest are dropped.
+	maxArrayLength = 64
+	// maxDepth is the number of nested objects and arrays flattened in to properties,
+	// deeper objects and arrays are added as a single JSON property.
+	maxDepth = 4
+)
+
+var (
+	_ zapcore.ObjectEncoder = (*gobber)(nil)
+	_ zapcore.ArrayEncoder  = (*arrayEncoder)(nil)
+)
+
 type traceEncoder interface {
 	zapcore.ObjectEncoder
 	encode(*appinsights.TraceTelemetry) ([]byte, error)
@@ -39,121 +58,344 @@ type gobber struct {
 	buffer         *bytes.Buffer
 	traceTelemetry *appinsights.TraceTelemetry
 	keyPrefix      string
+	depth          int
 	sync.Mutex
 }
 
-func (g *gobber) AddObject(key string, marshaler zapcore.ObjectMarshaler) error {
-	curPrefix := g.keyPrefix
-	if len(g.keyPrefix) == 0 {
-		g.keyPrefix = key
-	} else {
-		g.keyPrefix = g.keyPrefix + "_" + key
+// key returns the flattened property key for key, prefixed by the enclosing objects and namespaces.
+func (g *gobber) key(key string) string {
+	if g.keyPrefix == "" {
+		return key
 	}
-	marshaler.MarshalLogObject(g)
+	return g.keyPrefix + "_" + key
+}
+
+// set sets the property at the flattened key to value, truncating both to the appinsights limits.
+func (g *gobber) set(key, value string) {
+	g.traceTelemetry.Properties[truncate(g.key(key), maxPropertyKeyLength)] = truncate(value, maxPropertyValueLength)
+}
+
+// nest calls f with the key prefix set to the flattened key, so that the properties set by f are nested under key.
+func (g *gobber) nest(key string, f func()) {
+	curPrefix := g.keyPrefix
+	g.keyPrefix = g.key(key)
+	g.depth++
+	f()
+	g.depth--
 	g.keyPrefix = curPrefix
+}
+
+func (g *gobber) AddObject(key string, marshaler zapcore.ObjectMarshaler) error {
+	if g.depth >= maxDepth {
+		return g.addJSON(key, func(enc zapcore.ObjectEncoder) error { return enc.AddObject(key, marshaler) })
+	}
+	var err error
+	g.nest(key, func() { err = marshaler.MarshalLogObject(g) })
+	return err //nolint:wrapcheck // errors are added to the trace by zap
+}
+
+func (g *gobber) AddArray(key string, marshaler zapcore.ArrayMarshaler) error {
+	if g.depth >= maxDepth {
+		return g.addJSON(key, func(enc zapcore.ObjectEncoder) error { return enc.AddArray(key, marshaler) })
+	}
+	arr := &arrayEncoder{gobber: g}
+	var err error
+	g.nest(key, func() { err = marshaler.MarshalLogArray(arr) })
+	if arr.dropped > 0 {
+		g.set(key+"_dropped", strconv.Itoa(arr.dropped))
+	}
+	return err //nolint:wrapcheck // errors are added to the trace by zap
+}
+
+// addJSON sets the property at key to the JSON encoding of the field added by add.
+// It is used for objects and arrays nested deeper than maxDepth, which are not flattened any further.
+func (g *gobber) addJSON(key string, add func(zapcore.ObjectEncoder) error) error {
+	enc := zapcore.NewMapObjectEncoder()
+	if err := add(enc); err != nil {
+		return err
+	}
+	b, err := json.Marshal(enc.Fields[key])
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal %s", key)
+	}
+	g.set(key, string(b))
 	return nil
 }
 
-func (g *gobber) AddString(key, value string) {
-	g.traceTelemetry.Properties[g.keyPrefix+"_"+key] = value
+func (g *gobber) AddBinary(key string, value []byte) {
+	g.set(key, base64.StdEncoding.EncodeToString(value))
+}
+
+func (g *gobber) AddByteString(key string, value []byte) {
+	g.set(key, string(value))
 }
 
 func (g *gobber) AddBool(key string, value bool) {
-	g.traceTelemetry.Properties[g.keyPrefix+"_"+key] = strconv.FormatBool(value)
+	g.set(key, strconv.FormatBool(value))
+}
+
+func (g *gobber) AddComplex128(key string, value complex128) {
+	g.set(key, strconv.FormatComplex(value, 'g', -1, 128))
+}
+
+func (g *gobber) AddComplex64(key string, value complex64) {
+	g.set(key, strconv.FormatComplex(complex128(value), 'g', -1, 64))
+}
+
+func (g *gobber) AddDuration(key string, value time.Duration) {
+	g.set(key, value.String())
+}
+
+func (g *gobber) AddFloat64(key string, value float64) {
+	g.set(key, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+func (g *gobber) AddFloat32(key string, value float32) {
+	g.set(key, strconv.FormatFloat(float64(value), 'g', -1, 32))
 }
 
 func (g *gobber) AddInt(key string, value int) {
-	g.traceTelemetry.Properties[g.keyPrefix+"_"+key] = strconv.Itoa(value)
+	g.set(key, strconv.Itoa(value))
 }
 
 func (g *gobber) AddInt64(key string, value int64) {
-	g.traceTelemetry.Properties[g.keyPrefix+"_"+key] = strconv.FormatInt(value, 10)
+	g.set(key, strconv.FormatInt(value, 10))
+}
+
+func (g *gobber) AddInt32(key string, value int32) {
+	g.set(key, strconv.FormatInt(int64(value), 10))
+}
+
+func (g *gobber) AddInt16(key string, value int16) {
+	g.set(key, strconv.FormatInt(int64(value), 10))
+}
+
+func (g *gobber) AddInt8(key string, value int8) {
+	g.set(key, strconv.FormatInt(int64(value), 10))
+}
+
+func (g *gobber) AddString(key, value string) {
+	g.set(key, value)
+}
+
+func (g *gobber) AddTime(key string, value time.Time) {
+	g.set(key, value.Format(time.RFC3339Nano))
+}
+
+func (g *gobber) AddUint(key string, value uint) {
+	g.set(key, strconv.FormatUint(uint64(value), 10))
+}
+
+func (g *gobber) AddUint64(key string, value uint64) {
+	g.set(key, strconv.FormatUint(value, 10))
+}
+
+func (g *gobber) AddUint32(key string, value uint32) {
+	g.set(key, strconv.FormatUint(uint64(value), 10))
 }
 
 func (g *gobber) AddUint16(key string, value uint16) {
-	g.traceTelemetry.Properties[g.keyPrefix+"_"+key] = strconv.FormatUint(uint64(value), 10)
+	g.set(key, strconv.FormatUint(uint64(value), 10))
 }
 
-func (g *gobber) AddArray(_ string, _ zapcore.ArrayMarshaler) error {
-	// TODO to be implemented
+func (g *gobber) AddUint8(key string, value uint8) {
+	g.set(key, strconv.FormatUint(uint64(value), 10))
+}
+
+func (g *gobber) AddUintptr(key string, value uintptr) {
+	g.set(key, "0x"+strconv.FormatUint(uint64(value), 16))
+}
+
+// AddReflected sets the property at key to the JSON encoding of value.
+func (g *gobber) AddReflected(key string, value interface{}) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal %s", key)
+	}
+	g.set(key, string(b))
 	return nil
 }
 
-func (g *gobber) AddBinary(_ string, _ []byte) {
-	// TODO to be implemented
+// OpenNamespace nests the properties of all fields added after it under key, until the trace is reset.
+func (g *gobber) OpenNamespace(key string) {
+	g.keyPrefix = g.key(key)
 }
 
-func (g *gobber) AddByteString(_ string, _ []byte) {
-	// TODO to be implemented
+// arrayEncoder flattens the elements of an array in to the properties of the gobber, keyed by their index.
+type arrayEncoder struct {
+	*gobber
+	index   int
+	dropped int
 }
 
-func (g *gobber) AddComplex128(_ string, _ complex128) {
-	// TODO to be implemented
+// next returns the key of the next element, or false if the array is already maxArrayLength long.
+func (a *arrayEncoder) next() (string, bool) {
+	if a.index >= maxArrayLength {
+		a.dropped++
+		return "", false
+	}
+	key := strconv.Itoa(a.index)
+	a.index++
+	return key, true
 }
 
-func (g *gobber) AddComplex64(_ string, _ complex64) {
-	// TODO to be implemented
+func (a *arrayEncoder) AppendArray(marshaler zapcore.ArrayMarshaler) error {
+	if key, ok := a.next(); ok {
+		return a.AddArray(key, marshaler)
+	}
+	return nil
 }
 
-func (g *gobber) AddDuration(_ string, _ time.Duration) {
-	// TODO to be implemented
+func (a *arrayEncoder) AppendObject(marshaler zapcore.ObjectMarshaler) error {
+	if key, ok := a.next(); ok {
+		return a.AddObject(key, marshaler)
+	}
+	return nil
 }
 
-func (g *gobber) AddFloat64(_ string, _ float64) {
-	// TODO to be implemented
+func (a *arrayEncoder) AppendReflected(value interface{}) error {
+	if key, ok := a.next(); ok {
+		return a.AddReflected(key, value)
+	}
+	return nil
 }
 
-func (g *gobber) AddFloat32(_ string, _ float32) {
-	// TODO to be implemented
+func (a *arrayEncoder) AppendBool(value bool) {
+	if key, ok := a.next(); ok {
+		a.AddBool(key, value)
+	}
 }
 
-func (g *gobber) AddInt32(_ string, _ int32) {
-	// TODO to be implemented
+func (a *arrayEncoder) AppendByteString(value []byte) {
+	if key, ok := a.next(); ok {
+		a.AddByteString(key, value)
+	}
 }
 
-func (g *gobber) AddInt16(_ string, _ int16) {
-	// TODO to be implemented
+func (a *arrayEncoder) AppendComplex128(value complex128) {
+	if key, ok := a.next(); ok {
+		a.AddComplex128(key, value)
+	}
 }
 
-func (g *gobber) AddInt8(_ string, _ int8) {
-	// TODO to be implemented
+func (a *arrayEncoder) AppendComplex64(value complex64) {
+	if key, ok := a.next(); ok {
+		a.AddComplex64(key, value)
+	}
 }
 
-func (g *gobber) AddTime(_ string, _ time.Time) {
-	// TODO to be implemented
+func (a *arrayEncoder) AppendFloat64(value float64) {
+	if key, ok := a.next(); ok {
+		a.AddFloat64(key, value)
+	}
 }
 
-func (g *gobber) AddUint(_ string, _ uint) {
-	// TODO to be implemented
+func (a *arrayEncoder) AppendFloat32(value float32) {
+	if key, ok := a.next(); ok {
+		a.AddFloat32(key, value)
+	}
 }
 
-func (g *gobber) AddUint64(_ string, _ uint64) {
-	// TODO to be implemented
+func (a *arrayEncoder) AppendInt(value int) {
+	if key, ok := a.next(); ok {
+		a.AddInt(key, value)
+	}
 }
 
-func (g *gobber) AddUint32(_ string, _ uint32) {
-	// TODO to be implemented
+func (a *arrayEncoder) AppendInt64(value int64) {
+	if key, ok := a.next(); ok {
+		a.AddInt64(key, value)
+	}
 }
 
-func (g *gobber) AddUint8(_ string, _ uint8) {
-	// TODO to be implemented
+func (a *arrayEncoder) AppendInt32(value int32) {
+	if key, ok := a.next(); ok {
+		a.AddInt32(key, value)
+	}
 }
 
-func (g *gobber) AddUintptr(_ string, _ uintptr) {
-	// TODO to be implemented
+func (a *arrayEncoder) AppendInt16(value int16) {
+	if key, ok := a.next(); ok {
+		a.AddInt16(key, value)
+	}
 }
 
-func (g *gobber) AddReflected(_ string, _ interface{}) error {
-	// TODO to be implemented
-	return nil
+func (a *arrayEncoder) AppendInt8(value int8) {
+	if key, ok := a.next(); ok {
+		a.AddInt8(key, value)
+	}
+}
+
+func (a *arrayEncoder) AppendString(value string) {
+	if key, ok := a.next(); ok {
+		a.AddString(key, value)
+	}
 }
 
-func (g *gobber) OpenNamespace(_ string) {
-	// TODO to be implemented
+func (a *arrayEncoder) AppendUint(value uint) {
+	if key, ok := a.next(); ok {
+		a.AddUint(key, value)
+	}
+}
+
+func (a *arrayEncoder) AppendUint64(value uint64) {
+	if key, ok := a.next(); ok {
+		a.AddUint64(key, value)
+	}
+}
+
+func (a *arrayEncoder) AppendUint32(value uint32) {
+	if key, ok := a.next(); ok {
+		a.AddUint32(key, value)
+	}
+}
+
+func (a *arrayEncoder) AppendUint16(value uint16) {
+	if key, ok := a.next(); ok {
+		a.AddUint16(key, value)
+	}
+}
+
+func (a *arrayEncoder) AppendUint8(value uint8) {
+	if key, ok := a.next(); ok {
+		a.AddUint8(key, value)
+	}
+}
+
+func (a *arrayEncoder) AppendUintptr(value uintptr) {
+	if key, ok := a.next(); ok {
+		a.AddUintptr(key, value)
+	}
+}
+
+func (a *arrayEncoder) AppendDuration(value time.Duration) {
+	if key, ok := a.next(); ok {
+		a.AddDuration(key, value)
+	}
+}
+
+func (a *arrayEncoder) AppendTime(value time.Time) {
+	if key, ok := a.next(); ok {
+		a.AddTime(key, value)
+	}
+}
+
+// truncate shortens s to at most n bytes, without splitting a multi-byte character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
 }
 
+// setTraceTelemetry resets the encoder to add the properties of the next trace to traceTelemetry.
 func (g *gobber) setTraceTelemetry(traceTelemetry *appinsights.TraceTelemetry) {
 	g.traceTelemetry = traceTelemetry
+	g.keyPrefix = ""
+	g.depth = 0
 }
 
 // newTraceEncoder creates a gobber that can only encode.
@@ -218,6 +460,8 @@ func fieldStringer(f *zapcore.Field) string {
 	case zapcore.BoolType:
 		return strconv.FormatBool(f.Integer == 1)
 	default:
-		return fmt.Sprintf("%v", f)
+		enc := zapcore.NewMapObjectEncoder()
+		f.AddTo(enc)
+		return fmt.Sprintf("%v", enc.Fields[f.Key])
 	}
 }
@@ -0,0 +1,179 @@
+package zapai
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// traceSink decodes the traces written by a Core.
+type traceSink struct {
+	dec    traceDecoder
+	traces []*appinsights.TraceTelemetry
+}
+
+func (s *traceSink) Write(b []byte) (int, error) {
+	t, err := s.dec.decode(b)
+	if err != nil {
+		return 0, err
+	}
+	s.traces = append(s.traces, t)
+	return len(b), nil
+}
+
+func (s *traceSink) Sync() error { return nil }
+
+// properties logs fields with a Core and returns the properties of the trace.
+func properties(t *testing.T, fields ...zap.Field) map[string]string {
+	t.Helper()
+	sink := &traceSink{dec: newTraceDecoder()}
+	logger := zap.New(NewCore(zapcore.DebugLevel, sink))
+	logger.Info("test", fields...)
+	require.Len(t, sink.traces, 1)
+	return sink.traces[0].Properties
+}
+
+type object struct {
+	name   string
+	nested *object
+}
+
+func (o *object) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("name", o.name)
+	if o.nested != nil {
+		return enc.AddObject("nested", o.nested) //nolint:wrapcheck // test
+	}
+	return nil
+}
+
+type stringer string
+
+func (s stringer) String() string { return string(s) }
+
+func TestEncoderGolden(t *testing.T) {
+	ts := time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC)
+	fields := []zap.Field{
+		zap.Any("any", map[string]int{"b": 2, "a": 1}),
+		zap.Binary("binary", []byte{0, 1, 2, 0xff}),
+		zap.Bool("bool", true),
+		zap.Bools("bools", []bool{true, false}),
+		zap.ByteString("bytestring", []byte("bytes")),
+		zap.ByteStrings("bytestrings", [][]byte{[]byte("a"), []byte("b")}),
+		zap.Complex128("complex128", complex(1, -2)),
+		zap.Complex64("complex64", complex(1.5, 2)),
+		zap.Complex128s("complex128s", []complex128{complex(0, 1)}),
+		zap.Duration("duration", 1500*time.Millisecond),
+		zap.Durations("durations", []time.Duration{time.Second, time.Minute}),
+		zap.Error(errors.New("boom")),
+		zap.NamedError("namedError", errors.New("bang")),
+		zap.Errors("errors", []error{errors.New("one"), errors.New("two")}),
+		zap.Float64("float64", 3.14159),
+		zap.Float32("float32", 2.5),
+		zap.Float64s("float64s", []float64{1, 0.5}),
+		zap.Float32s("float32s", []float32{0.25}),
+		zap.Int("int", -1),
+		zap.Int64("int64", -64),
+		zap.Int32("int32", -32),
+		zap.Int16("int16", -16),
+		zap.Int8("int8", -8),
+		zap.Ints("ints", []int{1, 2, 3}),
+		zap.Int64s("int64s", []int64{64}),
+		zap.Int32s("int32s", []int32{32}),
+		zap.Int16s("int16s", []int16{16}),
+		zap.Int8s("int8s", []int8{8}),
+		zap.Uint("uint", 1),
+		zap.Uint64("uint64", 64),
+		zap.Uint32("uint32", 32),
+		zap.Uint16("uint16", 16),
+		zap.Uint8("uint8", 8),
+		zap.Uintptr("uintptr", 0xdead),
+		zap.Uints("uints", []uint{1}),
+		zap.Uint64s("uint64s", []uint64{64}),
+		zap.Uint32s("uint32s", []uint32{32}),
+		zap.Uint16s("uint16s", []uint16{16}),
+		zap.Uint8s("uint8s", []uint8{8}),
+		zap.Uintptrs("uintptrs", []uintptr{0xbeef}),
+		zap.String("string", "value"),
+		zap.Strings("strings", []string{"a", "b"}),
+		zap.Stringer("stringer", stringer("stringer")),
+		zap.Stringers("stringers", []stringer{"x", "y"}),
+		zap.Time("time", ts),
+		zap.Times("times", []time.Time{ts}),
+		zap.Reflect("reflect", struct {
+			A string `json:"a"`
+			B []int  `json:"b"`
+		}{A: "a", B: []int{1}}),
+		zap.Object("object", &object{name: "outer", nested: &object{name: "inner"}}),
+		zap.Objects("objects", []*object{{name: "first"}, {name: "second"}}),
+		zap.Inline(&object{name: "inline"}),
+		zap.Any("ip", net.ParseIP("10.0.0.1")),
+		zap.Skip(),
+		zap.Namespace("namespace"),
+		zap.String("inNamespace", "value"),
+	}
+
+	got, err := json.MarshalIndent(properties(t, fields...), "", "  ")
+	require.NoError(t, err)
+
+	golden := filepath.Join("testdata", "fields.golden")
+	if *update {
+		require.NoError(t, os.WriteFile(golden, got, 0o600))
+	}
+	want, err := os.ReadFile(golden)
+	require.NoError(t, err)
+	require.JSONEq(t, string(want), string(got))
+}
+
+func TestEncoderLimits(t *testing.T) {
+	long := strings.Repeat("a", maxPropertyValueLength-1) + "ü"
+	ints := make([]int, maxArrayLength+3)
+	deep := &object{name: "0"}
+	for i := 1; i <= maxDepth; i++ {
+		deep = &object{name: "x", nested: deep}
+	}
+
+	props := properties(t,
+		zap.String("long", long),
+		zap.String(strings.Repeat("k", maxPropertyKeyLength+1), "key"),
+		zap.Ints("ints", ints),
+		zap.Object("deep", deep),
+	)
+
+	// the value is truncated without splitting the last character
+	require.Equal(t, long[:maxPropertyValueLength-1], props["long"])
+	require.Equal(t, "key", props[strings.Repeat("k", maxPropertyKeyLength)])
+
+	require.Contains(t, props, "ints_63")
+	require.NotContains(t, props, "ints_64")
+	require.Equal(t, "3", props["ints_dropped"])
+
+	require.Equal(t, "x", props["deep_nested_nested_nested_name"])
+	require.JSONEq(t, `{"name":"0"}`, props["deep_nested_nested_nested_nested"])
+}
+
+func TestEncoderWithFields(t *testing.T) {
+	sink := &traceSink{dec: newTraceDecoder()}
+	logger := zap.New(NewCore(zapcore.DebugLevel, sink).WithFieldMappers(DefaultMappers)).
+		With(zap.Namespace("ctx"), zap.Int("id", 1), zap.String("version", "1.2.3"))
+
+	logger.Info("first", zap.Int32("count", 2))
+	logger.Info("second")
+
+	require.Len(t, sink.traces, 2)
+	require.Equal(t, map[string]string{"ctx_id": "1", "ctx_count": "2"}, sink.traces[0].Properties)
+	require.Equal(t, map[string]string{"ctx_id": "1"}, sink.traces[1].Properties)
+	require.Equal(t, "1.2.3", sink.traces[0].Tags[ApplicationContextMappers["version"]])
+}